@@ -53,6 +53,11 @@ func HandleGetMetrics(rw http.ResponseWriter, r *http.Request, p httprouter.Para
 
 func HandleGetMetric(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
 	id := p.ByName("id")
+	// The router can't have /v1/metrics/stream next to /v1/metrics/:id
+	if id == "stream" {
+		HandleGetMetricsStream(rw, r, p)
+		return
+	}
 	engine := common.GetEngine(r.Context())
 
 	var t time.Duration
@@ -0,0 +1,104 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"math"
+	"time"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// MetricsSnapshot is a message of the metrics stream. It has only the metrics
+// that changed since the previous snapshot, and the threshold events since
+// then, so the first snapshot has all of the metrics.
+type MetricsSnapshot struct {
+	Time            time.Time         `json:"time" yaml:"time"`
+	Elapsed         types.Duration    `json:"elapsed" yaml:"elapsed"`
+	Metrics         map[string]Metric `json:"metrics" yaml:"metrics"`
+	ThresholdEvents []ThresholdEvent  `json:"threshold-events,omitempty" yaml:"threshold-events,omitempty"`
+}
+
+// metricsStream keeps track of what was already sent to a client of the
+// metrics stream.
+type metricsStream struct {
+	engine     *core.Engine
+	sent       map[string]Metric
+	sentEvents int
+}
+
+func newMetricsStream(engine *core.Engine) *metricsStream {
+	return &metricsStream{engine: engine, sent: make(map[string]Metric)}
+}
+
+// next returns the changes since the previous snapshot. It returns false if
+// nothing changed.
+func (s *metricsStream) next() (MetricsSnapshot, bool) {
+	var t time.Duration
+	if s.engine.ExecutionScheduler != nil {
+		t = s.engine.ExecutionScheduler.GetState().GetCurrentTestRunDuration()
+	}
+	snapshot := MetricsSnapshot{
+		Time:    time.Now(),
+		Elapsed: types.Duration(t),
+		Metrics: make(map[string]Metric),
+	}
+
+	s.engine.MetricsLock.Lock()
+	for name, m := range s.engine.Metrics {
+		metric := NewMetric(m, t)
+		// Rates are infinite or NaN before the test run starts, and those
+		// can't be encoded as JSON
+		for k, v := range metric.Sample {
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				delete(metric.Sample, k)
+			}
+		}
+		if sent, ok := s.sent[name]; ok && sent.equal(metric) {
+			continue
+		}
+		s.sent[name] = metric
+		snapshot.Metrics[name] = metric
+	}
+	s.engine.MetricsLock.Unlock()
+
+	events := s.engine.GetThresholdEvents()
+	for i := s.sentEvents; i < len(events); i++ {
+		snapshot.ThresholdEvents = append(snapshot.ThresholdEvents, NewThresholdEvent(i, events[i]))
+	}
+	s.sentEvents = len(events)
+
+	return snapshot, len(snapshot.Metrics) > 0 || len(snapshot.ThresholdEvents) > 0
+}
+
+func (m Metric) equal(other Metric) bool {
+	if m.Type != other.Type || m.Contains != other.Contains || m.Tainted != other.Tainted ||
+		len(m.Sample) != len(other.Sample) {
+		return false
+	}
+	for k, v := range m.Sample {
+		if ov, ok := other.Sample[k]; !ok || ov != v {
+			return false
+		}
+	}
+	return true
+}
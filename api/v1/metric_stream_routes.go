@@ -0,0 +1,129 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/julienschmidt/httprouter"
+
+	"github.com/loadimpact/k6/api/common"
+	"github.com/loadimpact/k6/lib/types"
+)
+
+const defaultMetricsStreamInterval = 1 * time.Second
+
+// HandleGetMetricsStream pushes the changes of the metrics and the threshold
+// events to the client, as Server-Sent Events or, if the client asks for it,
+// over a WebSocket. The interval between the snapshots can be set with the
+// interval query parameter.
+func HandleGetMetricsStream(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	interval := defaultMetricsStreamInterval
+	if v := r.URL.Query().Get("interval"); v != "" {
+		d, err := types.ParseExtendedDuration(v)
+		if err != nil || d <= 0 {
+			apiError(rw, "Invalid interval", fmt.Sprintf("'%s' isn't a valid positive duration", v), http.StatusBadRequest)
+			return
+		}
+		interval = d
+	}
+	stream := newMetricsStream(common.GetEngine(r.Context()))
+
+	if websocket.IsWebSocketUpgrade(r) {
+		streamMetricsOverWebSocket(rw, r, stream, interval)
+		return
+	}
+
+	flusher, ok := rw.(http.Flusher)
+	if !ok {
+		apiError(rw, "Streaming unsupported", "the connection can't be streamed", http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "text/event-stream")
+	rw.Header().Set("Cache-Control", "no-cache")
+	rw.Header().Set("Connection", "keep-alive")
+	rw.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	streamMetrics(r, stream, interval, func(snapshot MetricsSnapshot) error {
+		data, err := json.Marshal(snapshot)
+		if err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(rw, "event: metrics\ndata: %s\n\n", data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	})
+}
+
+func streamMetricsOverWebSocket(rw http.ResponseWriter, r *http.Request, stream *metricsStream, interval time.Duration) {
+	conn, err := (&websocket.Upgrader{}).Upgrade(rw, r, nil)
+	if err != nil {
+		return // the upgrader has already responded with an error
+	}
+	defer func() { _ = conn.Close() }()
+
+	// The stream is stopped when the client closes the connection, which is
+	// noticed only when reading from it.
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	streamMetrics(r, stream, interval, func(snapshot MetricsSnapshot) error {
+		select {
+		case <-closed:
+			return websocket.ErrCloseSent
+		default:
+		}
+		return conn.WriteJSON(snapshot)
+	})
+}
+
+// streamMetrics sends a snapshot right away and then one every interval, until
+// the client goes away.
+func streamMetrics(r *http.Request, stream *metricsStream, interval time.Duration, send func(MetricsSnapshot) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if snapshot, changed := stream.next(); changed {
+			if err := send(snapshot); err != nil {
+				return
+			}
+		}
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
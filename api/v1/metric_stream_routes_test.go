@@ -0,0 +1,138 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/api/common"
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/lib/testutils/minirunner"
+	"github.com/loadimpact/k6/stats"
+)
+
+func newMetricsStreamServer(t *testing.T) (*core.Engine, *httptest.Server) {
+	logger := logrus.New()
+	logger.SetOutput(testutils.NewTestOutput(t))
+	execScheduler, err := local.NewExecutionScheduler(&minirunner.MiniRunner{}, logger)
+	require.NoError(t, err)
+	engine, err := core.NewEngine(execScheduler, lib.Options{}, lib.RuntimeOptions{}, nil, logger)
+	require.NoError(t, err)
+	engine.Metrics = map[string]*stats.Metric{
+		"my_counter": stats.New("my_counter", stats.Counter),
+		"my_gauge":   stats.New("my_gauge", stats.Gauge),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		NewHandler().ServeHTTP(rw, r.WithContext(common.WithEngine(r.Context(), engine)))
+	}))
+	t.Cleanup(srv.Close)
+	return engine, srv
+}
+
+func addSample(engine *core.Engine, name string, value float64) {
+	engine.MetricsLock.Lock()
+	defer engine.MetricsLock.Unlock()
+	engine.Metrics[name].Sink.Add(stats.Sample{Time: time.Now(), Value: value})
+}
+
+func TestGetMetricsStreamSSE(t *testing.T) {
+	engine, srv := newMetricsStreamServer(t)
+
+	res, err := http.Get(srv.URL + "/v1/metrics/stream?interval=50ms")
+	require.NoError(t, err)
+	defer func() { _ = res.Body.Close() }()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	reader := bufio.NewReader(res.Body)
+	readSnapshot := func() MetricsSnapshot {
+		event, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "event: metrics\n", event)
+		data, err := reader.ReadString('\n')
+		require.NoError(t, err)
+		_, err = reader.ReadString('\n')
+		require.NoError(t, err)
+
+		var snapshot MetricsSnapshot
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &snapshot))
+		return snapshot
+	}
+
+	snapshot := readSnapshot()
+	assert.Len(t, snapshot.Metrics, 2)
+	assert.Equal(t, float64(0), snapshot.Metrics["my_counter"].Sample["count"])
+
+	addSample(engine, "my_counter", 5)
+	snapshot = readSnapshot()
+	require.Len(t, snapshot.Metrics, 1)
+	assert.Equal(t, float64(5), snapshot.Metrics["my_counter"].Sample["count"])
+
+	addSample(engine, "my_gauge", 3)
+	snapshot = readSnapshot()
+	require.Len(t, snapshot.Metrics, 1)
+	assert.Equal(t, float64(3), snapshot.Metrics["my_gauge"].Sample["value"])
+}
+
+func TestGetMetricsStreamWebSocket(t *testing.T) {
+	engine, srv := newMetricsStreamServer(t)
+
+	url := "ws" + strings.TrimPrefix(srv.URL, "http") + "/v1/metrics/stream?interval=50ms"
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	var snapshot MetricsSnapshot
+	require.NoError(t, conn.ReadJSON(&snapshot))
+	assert.Len(t, snapshot.Metrics, 2)
+
+	addSample(engine, "my_counter", 2)
+	snapshot = MetricsSnapshot{}
+	require.NoError(t, conn.ReadJSON(&snapshot))
+	require.Len(t, snapshot.Metrics, 1)
+	assert.Equal(t, float64(2), snapshot.Metrics["my_counter"].Sample["count"])
+}
+
+func TestGetMetricsStreamInvalidInterval(t *testing.T) {
+	_, srv := newMetricsStreamServer(t)
+
+	for _, interval := range []string{"nope", "-1s", "0"} {
+		res, err := http.Get(srv.URL + "/v1/metrics/stream?interval=" + interval)
+		require.NoError(t, err)
+		_ = res.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, res.StatusCode, interval)
+	}
+}
@@ -33,7 +33,13 @@ func NewHandler() http.Handler {
 	router.PATCH("/v1/status", HandlePatchStatus)
 
 	router.GET("/v1/metrics", HandleGetMetrics)
-	router.GET("/v1/metrics/:id", HandleGetMetric)
+	router.GET("/v1/metrics/:id", HandleGetMetric) // and /v1/metrics/stream
+
+	router.GET("/v1/threshold-events", HandleGetThresholdEvents)
+
+	router.GET("/v1/scenarios", HandleGetScenarios)
+	router.GET("/v1/scenarios/:name", HandleGetScenario)
+	router.PATCH("/v1/scenarios/:name", HandlePatchScenario)
 
 	router.GET("/v1/groups", HandleGetGroups)
 	router.GET("/v1/groups/:id", HandleGetGroup)
@@ -0,0 +1,75 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/executor"
+)
+
+// Scenario is the live state of a scenario of the test run.
+type Scenario struct {
+	Name     string `json:"-" yaml:"name"`
+	Executor string `json:"executor" yaml:"executor"`
+
+	// Whether only this scenario is paused, while the rest of the test can
+	// keep running.
+	Paused null.Bool `json:"paused" yaml:"paused"`
+
+	// The current iteration rate, only for externally-driven-arrival-rate
+	// scenarios, where it can also be changed.
+	Rate null.Int `json:"rate" yaml:"rate"`
+
+	// The current number of active VUs, only for externally-controlled
+	// scenarios, where it can also be changed.
+	VUs null.Int `json:"vus" yaml:"vus"`
+}
+
+// NewScenario returns the API representation of the scenario of the executor.
+func NewScenario(ex lib.Executor) Scenario {
+	config := ex.GetConfig()
+	scenario := Scenario{Name: config.GetName(), Executor: config.GetType()}
+	if pausable, ok := ex.(lib.ScenarioPausableExecutor); ok {
+		scenario.Paused = null.BoolFrom(pausable.IsScenarioPaused())
+	}
+	switch typed := ex.(type) {
+	case *executor.ExternallyDrivenArrivalRate:
+		scenario.Rate = null.IntFrom(typed.GetRate())
+	case *executor.ExternallyControlled:
+		scenario.VUs = typed.GetCurrentConfig().VUs
+	}
+	return scenario
+}
+
+func (s Scenario) GetName() string {
+	return "scenarios"
+}
+
+func (s Scenario) GetID() string {
+	return s.Name
+}
+
+func (s *Scenario) SetID(id string) error {
+	s.Name = id
+	return nil
+}
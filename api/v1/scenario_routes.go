@@ -0,0 +1,164 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/manyminds/api2go/jsonapi"
+
+	"github.com/loadimpact/k6/api/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/executor"
+)
+
+// getExecutor returns the executor of the scenario with the given name, or
+// nil if there isn't one.
+func getExecutor(execScheduler lib.ExecutionScheduler, name string) lib.Executor {
+	for _, ex := range execScheduler.GetExecutors() {
+		if ex.GetConfig().GetName() == name {
+			return ex
+		}
+	}
+	return nil
+}
+
+// HandleGetScenarios returns the live state of all scenarios.
+func HandleGetScenarios(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	engine := common.GetEngine(r.Context())
+
+	executors := engine.ExecutionScheduler.GetExecutors()
+	scenarios := make([]Scenario, len(executors))
+	for i, ex := range executors {
+		scenarios[i] = NewScenario(ex)
+	}
+
+	data, err := jsonapi.Marshal(scenarios)
+	if err != nil {
+		apiError(rw, "Encoding error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = rw.Write(data)
+}
+
+// HandleGetScenario returns the live state of a single scenario.
+func HandleGetScenario(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	name := p.ByName("name")
+	engine := common.GetEngine(r.Context())
+
+	ex := getExecutor(engine.ExecutionScheduler, name)
+	if ex == nil {
+		apiError(rw, "Not Found", "No scenario with that name was found", http.StatusNotFound)
+		return
+	}
+
+	data, err := jsonapi.Marshal(NewScenario(ex))
+	if err != nil {
+		apiError(rw, "Encoding error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = rw.Write(data)
+}
+
+// HandlePatchScenario changes the live state of a scenario. Any scenario can be
+// paused and resumed, while the rate can be changed only for
+// externally-driven-arrival-rate scenarios and the VUs only for
+// externally-controlled ones.
+func HandlePatchScenario(rw http.ResponseWriter, r *http.Request, p httprouter.Params) {
+	name := p.ByName("name")
+	engine := common.GetEngine(r.Context())
+
+	ex := getExecutor(engine.ExecutionScheduler, name)
+	if ex == nil {
+		apiError(rw, "Not Found", "No scenario with that name was found", http.StatusNotFound)
+		return
+	}
+
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		apiError(rw, "Couldn't read request", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var scenario Scenario
+	if err = jsonapi.Unmarshal(body, &scenario); err != nil {
+		apiError(rw, "Invalid data", err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if scenario.Paused.Valid {
+		pausable, ok := ex.(lib.ScenarioPausableExecutor)
+		if !ok {
+			apiError(rw, "Pause error", fmt.Sprintf(
+				"%s executor '%s' can't be paused on its own", ex.GetConfig().GetType(), name,
+			), http.StatusBadRequest)
+			return
+		}
+		if pausable.IsScenarioPaused() != scenario.Paused.Bool {
+			if err = pausable.SetScenarioPaused(scenario.Paused.Bool); err != nil {
+				apiError(rw, "Pause error", err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	if scenario.Rate.Valid {
+		edar, ok := ex.(*executor.ExternallyDrivenArrivalRate)
+		if !ok {
+			apiError(rw, "Execution config error", fmt.Sprintf(
+				"the rate can only be changed for externally-driven-arrival-rate scenarios, but '%s' is %s",
+				name, ex.GetConfig().GetType(),
+			), http.StatusBadRequest)
+			return
+		}
+		if err = edar.SetRate(scenario.Rate.Int64); err != nil {
+			apiError(rw, "Config update error", err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if scenario.VUs.Valid {
+		ec, ok := ex.(*executor.ExternallyControlled)
+		if !ok {
+			apiError(rw, "Execution config error", fmt.Sprintf(
+				"the VUs can only be changed for externally-controlled scenarios, but '%s' is %s",
+				name, ex.GetConfig().GetType(),
+			), http.StatusBadRequest)
+			return
+		}
+		newConfig := ec.GetCurrentConfig().ExternallyControlledConfigParams
+		newConfig.VUs = scenario.VUs
+		if err = ec.UpdateConfig(r.Context(), newConfig); err != nil {
+			apiError(rw, "Config update error", err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := jsonapi.Marshal(NewScenario(ex))
+	if err != nil {
+		apiError(rw, "Encoding error", err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = rw.Write(data)
+}
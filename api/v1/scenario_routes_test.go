@@ -0,0 +1,144 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/lib/testutils/minirunner"
+)
+
+func newScenariosTestEngine(t *testing.T) *core.Engine {
+	logger := logrus.New()
+	logger.SetOutput(testutils.NewTestOutput(t))
+
+	scenarios := lib.ScenarioConfigs{}
+	require.NoError(t, json.Unmarshal([]byte(`{
+		"driven": {"executor": "externally-driven-arrival-rate", "maxRate": 100, "duration": "1s", "preAllocatedVUs": 1, "maxVUs": 1},
+		"constant": {"executor": "constant-vus", "vus": 1, "duration": "1s"},
+		"controlled": {"executor": "externally-controlled", "vus": 1, "maxVUs": 2, "duration": "1s"}
+	}`), &scenarios))
+	options := lib.Options{Scenarios: scenarios}
+
+	execScheduler, err := local.NewExecutionScheduler(&minirunner.MiniRunner{Options: options}, logger)
+	require.NoError(t, err)
+	engine, err := core.NewEngine(execScheduler, options, lib.RuntimeOptions{}, nil, logger)
+	require.NoError(t, err)
+	return engine
+}
+
+func TestGetScenarios(t *testing.T) {
+	engine := newScenariosTestEngine(t)
+
+	rw := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "GET", "/v1/scenarios", nil))
+	res := rw.Result()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var scenarios []Scenario
+	require.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &scenarios))
+	assert.ElementsMatch(t, []Scenario{
+		{Name: "driven", Executor: "externally-driven-arrival-rate", Paused: null.BoolFrom(false), Rate: null.IntFrom(0)},
+		{Name: "constant", Executor: "constant-vus", Paused: null.BoolFrom(false)},
+		{Name: "controlled", Executor: "externally-controlled", Paused: null.BoolFrom(false), VUs: null.IntFrom(1)},
+	}, scenarios)
+
+	t.Run("not found", func(t *testing.T) {
+		rw := httptest.NewRecorder()
+		NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "GET", "/v1/scenarios/missing", nil))
+		assert.Equal(t, http.StatusNotFound, rw.Result().StatusCode)
+	})
+}
+
+func TestPatchScenario(t *testing.T) {
+	testdata := map[string]struct {
+		StatusCode int
+		Name       string
+		Scenario   Scenario
+	}{
+		"nothing":         {200, "driven", Scenario{}},
+		"rate":            {200, "driven", Scenario{Rate: null.IntFrom(20)}},
+		"too high rate":   {400, "driven", Scenario{Rate: null.IntFrom(200)}},
+		"wrong type":      {400, "constant", Scenario{Rate: null.IntFrom(20)}},
+		"not found":       {404, "missing", Scenario{Rate: null.IntFrom(20)}},
+		"pause":           {200, "constant", Scenario{Paused: null.BoolFrom(true)}},
+		"pause and rate":  {200, "driven", Scenario{Paused: null.BoolFrom(true), Rate: null.IntFrom(20)}},
+		"already running": {200, "constant", Scenario{Paused: null.BoolFrom(false)}},
+		"vus":             {200, "controlled", Scenario{VUs: null.IntFrom(2)}},
+		"too many vus":    {400, "controlled", Scenario{VUs: null.IntFrom(3)}},
+		"vus wrong type":  {400, "constant", Scenario{VUs: null.IntFrom(2)}},
+	}
+
+	for name, indata := range testdata {
+		t.Run(name, func(t *testing.T) {
+			engine := newScenariosTestEngine(t)
+			ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+			defer cancel()
+			run, wait, err := engine.Init(ctx, ctx)
+			require.NoError(t, err)
+			defer wait()
+
+			go func() { _ = run() }()
+			// wait for the executors to initialize to avoid a potential data race below
+			time.Sleep(100 * time.Millisecond)
+
+			body, err := jsonapi.Marshal(indata.Scenario)
+			require.NoError(t, err)
+
+			rw := httptest.NewRecorder()
+			NewHandler().ServeHTTP(rw, newRequestWithEngine(
+				engine, "PATCH", "/v1/scenarios/"+indata.Name, bytes.NewReader(body)))
+			res := rw.Result()
+			if !assert.Equal(t, indata.StatusCode, res.StatusCode) || indata.StatusCode != 200 {
+				return
+			}
+
+			var scenario Scenario
+			require.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &scenario))
+			assert.Equal(t, indata.Name, scenario.Name)
+			if indata.Scenario.Paused.Valid {
+				assert.Equal(t, indata.Scenario.Paused, scenario.Paused)
+			}
+			if indata.Scenario.Rate.Valid {
+				assert.Equal(t, indata.Scenario.Rate, scenario.Rate)
+			}
+			if indata.Scenario.VUs.Valid {
+				assert.Equal(t, indata.Scenario.VUs, scenario.VUs)
+			}
+		})
+	}
+}
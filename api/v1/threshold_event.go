@@ -0,0 +1,74 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// ThresholdEvent is a threshold breach, recovery or abort of the test run.
+// Its ID is its position in the order of the events.
+type ThresholdEvent struct {
+	ID int `json:"-" yaml:"id"`
+
+	Type        string             `json:"type" yaml:"type"`
+	Time        time.Time          `json:"time" yaml:"time"`
+	Elapsed     types.Duration     `json:"elapsed" yaml:"elapsed"`
+	Metric      string             `json:"metric" yaml:"metric"`
+	Threshold   string             `json:"threshold" yaml:"threshold"`
+	AbortOnFail bool               `json:"abort-on-fail" yaml:"abort-on-fail"`
+	Values      map[string]float64 `json:"values" yaml:"values"`
+}
+
+// NewThresholdEvent returns the API representation of the i-th event.
+func NewThresholdEvent(i int, event lib.ThresholdEvent) ThresholdEvent {
+	return ThresholdEvent{
+		ID:          i,
+		Type:        event.Type,
+		Time:        event.Time,
+		Elapsed:     event.Elapsed,
+		Metric:      event.Metric,
+		Threshold:   event.Threshold,
+		AbortOnFail: event.AbortOnFail,
+		Values:      event.Values,
+	}
+}
+
+func (e ThresholdEvent) GetName() string {
+	return "threshold-events"
+}
+
+func (e ThresholdEvent) GetID() string {
+	return strconv.Itoa(e.ID)
+}
+
+func (e *ThresholdEvent) SetID(id string) error {
+	i, err := strconv.Atoi(id)
+	if err != nil {
+		return err
+	}
+	e.ID = i
+	return nil
+}
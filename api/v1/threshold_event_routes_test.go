@@ -0,0 +1,83 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package v1
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/manyminds/api2go/jsonapi"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/lib/testutils/minirunner"
+	"github.com/loadimpact/k6/stats"
+)
+
+func TestGetThresholdEvents(t *testing.T) {
+	logger := logrus.New()
+	logger.SetOutput(testutils.NewTestOutput(t))
+
+	metric := stats.New("my_metric", stats.Trend, stats.Time)
+	ths, err := stats.NewThresholds([]string{"avg<100"})
+	require.NoError(t, err)
+	options := lib.Options{Thresholds: map[string]stats.Thresholds{metric.Name: ths}}
+
+	runner := &minirunner.MiniRunner{
+		Options: options,
+		SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
+			out <- stats.Sample{Metric: metric, Value: 200}
+			return nil, nil
+		},
+	}
+	execScheduler, err := local.NewExecutionScheduler(runner, logger)
+	require.NoError(t, err)
+	engine, err := core.NewEngine(execScheduler, options, lib.RuntimeOptions{}, nil, logger)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	run, wait, err := engine.Init(ctx, ctx)
+	require.NoError(t, err)
+	defer wait()
+	defer cancel()
+	require.NoError(t, run())
+
+	rw := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rw, newRequestWithEngine(engine, "GET", "/v1/threshold-events", nil))
+	res := rw.Result()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	var events []ThresholdEvent
+	require.NoError(t, jsonapi.Unmarshal(rw.Body.Bytes(), &events))
+	require.Len(t, events, 1)
+	assert.Equal(t, 0, events[0].ID)
+	assert.Equal(t, lib.ThresholdBreached, events[0].Type)
+	assert.Equal(t, "my_metric", events[0].Metric)
+	assert.Equal(t, "avg<100", events[0].Threshold)
+	assert.Equal(t, 200.0, events[0].Values["avg"])
+}
@@ -22,6 +22,7 @@ package cloudapi
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"mime/multipart"
 	"net/http"
@@ -48,6 +49,8 @@ type TestRun struct {
 	Thresholds map[string][]string `json:"thresholds"`
 	// Duration of test in seconds. -1 for unknown length, 0 for continuous running.
 	Duration int64 `json:"duration"`
+	// Key-values used to correlate the test run with e.g. a commit or a CI job.
+	Metadata map[string]string `json:"metadata,omitempty"`
 }
 
 type CreateTestRunResponse struct {
@@ -86,7 +89,11 @@ func (c *Client) CreateTestRun(testRun *TestRun) (*CreateTestRunResponse, error)
 	return &ctrr, nil
 }
 
-func (c *Client) StartCloudTestRun(name string, projectID int64, arc *lib.Archive) (string, error) {
+// StartCloudTestRun uploads the archive and starts a cloud test run for it,
+// with the given metadata, like the ones of Config.TestRunMetadata().
+func (c *Client) StartCloudTestRun(
+	name string, projectID int64, arc *lib.Archive, metadata map[string]string,
+) (string, error) {
 	requestUrl := fmt.Sprintf("%s/archive-upload", c.baseURL)
 
 	var buf bytes.Buffer
@@ -102,6 +109,16 @@ func (c *Client) StartCloudTestRun(name string, projectID int64, arc *lib.Archiv
 		}
 	}
 
+	if len(metadata) > 0 {
+		data, err := json.Marshal(metadata)
+		if err != nil {
+			return "", err
+		}
+		if err := mp.WriteField("metadata", string(data)); err != nil {
+			return "", err
+		}
+	}
+
 	fw, err := mp.CreateFormFile("file", "archive.tar")
 	if err != nil {
 		return "", err
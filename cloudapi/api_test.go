@@ -25,13 +25,16 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/testutils"
 	"github.com/loadimpact/k6/lib/types"
 )
@@ -174,6 +177,35 @@ func TestRetrySuccessOnSecond(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestRetryPolicy(t *testing.T) {
+	called := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called++
+		w.WriteHeader(503)
+	}))
+	defer server.Close()
+
+	client := NewClient(testutils.NewLogger(t), "token", server.URL, "1.0")
+	req, err := client.NewRequest(http.MethodPost, server.URL, nil)
+	require.NoError(t, err)
+	err = client.DoWithRetries(req, nil, RetryPolicy{Attempts: 5, Interval: time.Millisecond, MaxInterval: time.Millisecond})
+	assert.Equal(t, 5, called)
+	assert.Error(t, err)
+
+	policy := RetryPolicy{Interval: 100 * time.Millisecond, MaxInterval: time.Second}
+	assert.Equal(t, 100*time.Millisecond, policy.wait(1))
+	assert.Equal(t, 200*time.Millisecond, policy.wait(2))
+	assert.Equal(t, 800*time.Millisecond, policy.wait(4))
+	assert.Equal(t, time.Second, policy.wait(5))
+	assert.Equal(t, time.Second, policy.wait(10))
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		wait := policy.wait(2)
+		assert.True(t, wait > 100*time.Millisecond && wait <= 200*time.Millisecond, wait)
+	}
+}
+
 func TestIdempotencyKey(t *testing.T) {
 	const idempotencyKey = "xxx"
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -200,3 +232,38 @@ func TestIdempotencyKey(t *testing.T) {
 	assert.NoError(t, err)
 	assert.NoError(t, client.Do(req, nil))
 }
+
+func TestStartCloudTestRunMetadata(t *testing.T) {
+	t.Parallel()
+	fields := make(chan map[string][]string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, r.ParseMultipartForm(1<<20))
+		fields <- r.MultipartForm.Value
+		fprintf(t, w, `{"reference_id": "1"}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(testutils.NewLogger(t), "token", server.URL, "1.0")
+	script := []byte(`export default function() {}`)
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/script.js", script, 0o644))
+	arc := &lib.Archive{
+		Type:        "js",
+		FilenameURL: &url.URL{Scheme: "file", Path: "/script.js"},
+		PwdURL:      &url.URL{Scheme: "file", Path: "/"},
+		Data:        script,
+		Filesystems: map[string]afero.Fs{"file": fs, "https": afero.NewMemMapFs()},
+	}
+	refID, err := client.StartCloudTestRun("test", 0, arc, map[string]string{MetadataGitBranch: "main"})
+	require.NoError(t, err)
+	assert.Equal(t, "1", refID)
+	assert.Equal(t, map[string][]string{
+		"name":     {"test"},
+		"metadata": {`{"` + MetadataGitBranch + `":"main"}`},
+	}, <-fields)
+
+	// The field is left out if there is no metadata
+	_, err = client.StartCloudTestRun("test", 0, arc, nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{"name": {"test"}}, <-fields)
+}
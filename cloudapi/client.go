@@ -46,6 +46,36 @@ const (
 	k6IdempotencyKeyHeader = "k6-Idempotency-Key"
 )
 
+// RetryPolicy specifies how many times a request is attempted and how long to
+// wait between the attempts.
+type RetryPolicy struct {
+	Attempts int
+
+	// The wait after the first failed attempt, it's doubled after every next
+	// one until it reaches MaxInterval.
+	Interval    time.Duration
+	MaxInterval time.Duration
+
+	// The fraction of the wait (from 0 to 1) that is randomly cut from it, so
+	// that concurrent requests don't all retry at the same time.
+	Jitter float64
+}
+
+// wait returns how long to wait after the given failed attempt.
+func (p RetryPolicy) wait(attempt int) time.Duration {
+	wait := p.Interval
+	for i := 1; i < attempt && wait < p.MaxInterval; i++ {
+		wait *= 2
+		if wait > p.MaxInterval {
+			wait = p.MaxInterval
+		}
+	}
+	if p.Jitter > 0 {
+		wait -= time.Duration(rand.Float64() * p.Jitter * float64(wait)) //nolint:gosec
+	}
+	return wait
+}
+
 // Client handles communication with Load Impact cloud API.
 type Client struct {
 	client  *http.Client
@@ -98,6 +128,16 @@ func (c *Client) NewRequest(method, url string, data interface{}) (*http.Request
 }
 
 func (c *Client) Do(req *http.Request, v interface{}) error {
+	return c.DoWithRetries(req, v, RetryPolicy{
+		Attempts:    c.retries,
+		Interval:    c.retryInterval,
+		MaxInterval: c.retryInterval,
+	})
+}
+
+// DoWithRetries is the same as Do, except that the attempts and the waiting
+// between them are specified by the given retry policy.
+func (c *Client) DoWithRetries(req *http.Request, v interface{}, policy RetryPolicy) error {
 	if req.Body != nil && req.GetBody == nil {
 		originalBody, err := ioutil.ReadAll(req.Body)
 		if err != nil {
@@ -116,11 +156,11 @@ func (c *Client) Do(req *http.Request, v interface{}) error {
 	// TODO(cuonglm): finding away to move this back to NewRequest
 	c.prepareHeaders(req)
 
-	for i := 1; i <= c.retries; i++ {
-		retry, err := c.do(req, v, i)
+	for i := 1; i <= policy.Attempts; i++ {
+		retry, err := c.do(req, v, i, policy.Attempts)
 
 		if retry {
-			time.Sleep(c.retryInterval)
+			time.Sleep(policy.wait(i))
 			if req.GetBody != nil {
 				req.Body, _ = req.GetBody()
 			}
@@ -149,7 +189,7 @@ func (c *Client) prepareHeaders(req *http.Request) {
 	req.Header.Set("User-Agent", "k6cloud/"+c.version)
 }
 
-func (c *Client) do(req *http.Request, v interface{}, attempt int) (retry bool, err error) {
+func (c *Client) do(req *http.Request, v interface{}, attempt, attempts int) (retry bool, err error) {
 	resp, err := c.client.Do(req)
 
 	defer func() {
@@ -160,7 +200,7 @@ func (c *Client) do(req *http.Request, v interface{}, attempt int) (retry bool,
 		}
 	}()
 
-	if shouldRetry(resp, err, attempt, c.retries) {
+	if shouldRetry(resp, err, attempt, attempts) {
 		return true, err
 	}
 
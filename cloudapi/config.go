@@ -45,14 +45,60 @@ type Config struct {
 	WebAppURL   null.String `json:"webAppURL" envconfig:"K6_CLOUD_WEB_APP_URL"`
 	NoCompress  null.Bool   `json:"noCompress" envconfig:"K6_CLOUD_NO_COMPRESS"`
 
+	// Arbitrary key-values that are attached to the test run, e.g. to correlate it with a deployment.
+	Metadata map[string]string `json:"metadata" envconfig:"K6_CLOUD_METADATA"`
+
+	// Whether metadata like the git commit, branch and CI job URL is detected from the environment.
+	AutoMetadata null.Bool `json:"autoMetadata" envconfig:"K6_CLOUD_AUTO_METADATA"`
+
+	// An explicit proxy for all requests to the cloud, used instead of the HTTP_PROXY and HTTPS_PROXY env vars.
+	ProxyURL      null.String `json:"proxyURL" envconfig:"K6_CLOUD_PROXY_URL"`
+	ProxyUsername null.String `json:"proxyUsername" envconfig:"K6_CLOUD_PROXY_USERNAME"`
+	ProxyPassword null.String `json:"proxyPassword" envconfig:"K6_CLOUD_PROXY_PASSWORD"`
+	// Path to a PEM bundle with extra CA certificates, e.g. for proxies that intercept TLS connections.
+	ProxyCACert null.String `json:"proxyCACert" envconfig:"K6_CLOUD_PROXY_CA_CERT"`
+
 	MaxMetricSamplesPerPackage null.Int `json:"maxMetricSamplesPerPackage" envconfig:"K6_CLOUD_MAX_METRIC_SAMPLES_PER_PACKAGE"`
 
 	// The time interval between periodic API calls for sending samples to the cloud ingest service.
 	MetricPushInterval types.NullDuration `json:"metricPushInterval" envconfig:"K6_CLOUD_METRIC_PUSH_INTERVAL"`
 
+	// The maximum bytes per second used for pushing metrics to the cloud, 0 means unlimited.
+	// When the pushes get close to it, HTTP metrics are aggregated more coarsely.
+	MaxBandwidth null.Int `json:"maxBandwidth" envconfig:"K6_CLOUD_MAX_BANDWIDTH"`
+
+	// A directory where every metrics payload is also written to, exactly as it's sent to the cloud.
+	PayloadDumpDir null.String `json:"payloadDumpDir" envconfig:"K6_CLOUD_PAYLOAD_DUMP"`
+	// Whether the metrics payloads are only written to PayloadDumpDir, without creating a test run or sending anything.
+	PayloadDumpOnly null.Bool `json:"payloadDumpOnly" envconfig:"K6_CLOUD_PAYLOAD_DUMP_ONLY"`
+
 	// This is how many concurrent pushes will be done at the same time to the cloud
 	MetricPushConcurrency null.Int `json:"metricPushConcurrency" envconfig:"K6_CLOUD_METRIC_PUSH_CONCURRENCY"`
 
+	// How many times a metrics push is attempted when it fails with a network error, a 5xx or a 429 response.
+	MetricPushAttempts null.Int `json:"metricPushAttempts" envconfig:"K6_CLOUD_METRIC_PUSH_ATTEMPTS"`
+	// The wait between the push attempts starts at MetricPushRetryInterval and doubles after every attempt,
+	// up to MetricPushRetryMaxInterval. Up to MetricPushRetryJitter (from 0 to 1) of it is randomly cut.
+	MetricPushRetryInterval    types.NullDuration `json:"metricPushRetryInterval" envconfig:"K6_CLOUD_METRIC_PUSH_RETRY_INTERVAL"`
+	MetricPushRetryMaxInterval types.NullDuration `json:"metricPushRetryMaxInterval" envconfig:"K6_CLOUD_METRIC_PUSH_RETRY_MAX_INTERVAL"`
+	MetricPushRetryJitter      null.Float         `json:"metricPushRetryJitter" envconfig:"K6_CLOUD_METRIC_PUSH_RETRY_JITTER"`
+
+	// After this many consecutive failed pushes, the pushing is paused for MetricPushCircuitBreakerCooldown
+	// and the samples are kept in the buffer until it's resumed. 0 disables the circuit breaker, in which
+	// case the samples of failed pushes are dropped.
+	MetricPushCircuitBreakerThreshold null.Int           `json:"metricPushCircuitBreakerThreshold" envconfig:"K6_CLOUD_METRIC_PUSH_CIRCUIT_BREAKER_THRESHOLD"`
+	MetricPushCircuitBreakerCooldown  types.NullDuration `json:"metricPushCircuitBreakerCooldown" envconfig:"K6_CLOUD_METRIC_PUSH_CIRCUIT_BREAKER_COOLDOWN"`
+	// The most samples that are kept in the buffer, e.g. while the pushes are failing or the circuit
+	// breaker is open, 0 means unlimited. When it's reached, the oldest samples are dropped and a
+	// warning is logged.
+	MaxBufferedSamples null.Int `json:"maxBufferedSamples" envconfig:"K6_CLOUD_MAX_BUFFERED_SAMPLES"`
+
+	// Whether the test run should be stopped when the cloud marks it as failed, e.g. because of its thresholds.
+	AbortOnRemoteFailure null.Bool `json:"abortOnRemoteFailure" envconfig:"K6_CLOUD_ABORT_ON_REMOTE_FAILURE"`
+
+	// How often the cloud is asked for the test run status, if AbortOnRemoteFailure is enabled.
+	RemoteStatusPollInterval types.NullDuration `json:"remoteStatusPollInterval" envconfig:"K6_CLOUD_REMOTE_STATUS_POLL_INTERVAL"`
+
 	// Aggregation docs:
 	//
 	// If AggregationPeriod is specified and if it is greater than 0, HTTP metric aggregation
@@ -163,7 +209,16 @@ func NewConfig() Config {
 		WebAppURL:                  null.NewString("https://app.k6.io", false),
 		MetricPushInterval:         types.NewNullDuration(1*time.Second, false),
 		MetricPushConcurrency:      null.NewInt(1, false),
+		MetricPushAttempts:         null.NewInt(3, false),
+		MetricPushRetryInterval:    types.NewNullDuration(500*time.Millisecond, false),
+		MetricPushRetryMaxInterval: types.NewNullDuration(5*time.Second, false),
+		MetricPushRetryJitter:      null.NewFloat(0.2, false),
 		MaxMetricSamplesPerPackage: null.NewInt(100000, false),
+		RemoteStatusPollInterval:   types.NewNullDuration(5*time.Second, false),
+
+		MetricPushCircuitBreakerCooldown: types.NewNullDuration(30*time.Second, false),
+		MaxBufferedSamples:               null.NewInt(1000000, false),
+
 		// Aggregation is disabled by default, since AggregationPeriod has no default value
 		// but if it's enabled manually or from the cloud service, those are the default values it will use:
 		AggregationCalcInterval:         types.NewNullDuration(3*time.Second, false),
@@ -209,15 +264,76 @@ func (c Config) Apply(cfg Config) Config {
 	if cfg.NoCompress.Valid {
 		c.NoCompress = cfg.NoCompress
 	}
+	if cfg.ProxyURL.Valid {
+		c.ProxyURL = cfg.ProxyURL
+	}
+	if cfg.ProxyUsername.Valid {
+		c.ProxyUsername = cfg.ProxyUsername
+	}
+	if cfg.ProxyPassword.Valid {
+		c.ProxyPassword = cfg.ProxyPassword
+	}
+	if cfg.ProxyCACert.Valid {
+		c.ProxyCACert = cfg.ProxyCACert
+	}
+	if len(cfg.Metadata) > 0 {
+		metadata := make(map[string]string, len(c.Metadata)+len(cfg.Metadata))
+		for k, v := range c.Metadata {
+			metadata[k] = v
+		}
+		for k, v := range cfg.Metadata {
+			metadata[k] = v
+		}
+		c.Metadata = metadata
+	}
+	if cfg.AutoMetadata.Valid {
+		c.AutoMetadata = cfg.AutoMetadata
+	}
 	if cfg.MaxMetricSamplesPerPackage.Valid {
 		c.MaxMetricSamplesPerPackage = cfg.MaxMetricSamplesPerPackage
 	}
 	if cfg.MetricPushInterval.Valid {
 		c.MetricPushInterval = cfg.MetricPushInterval
 	}
+	if cfg.MaxBandwidth.Valid {
+		c.MaxBandwidth = cfg.MaxBandwidth
+	}
+	if cfg.PayloadDumpDir.Valid {
+		c.PayloadDumpDir = cfg.PayloadDumpDir
+	}
+	if cfg.PayloadDumpOnly.Valid {
+		c.PayloadDumpOnly = cfg.PayloadDumpOnly
+	}
 	if cfg.MetricPushConcurrency.Valid {
 		c.MetricPushConcurrency = cfg.MetricPushConcurrency
 	}
+	if cfg.MetricPushAttempts.Valid {
+		c.MetricPushAttempts = cfg.MetricPushAttempts
+	}
+	if cfg.MetricPushRetryInterval.Valid {
+		c.MetricPushRetryInterval = cfg.MetricPushRetryInterval
+	}
+	if cfg.MetricPushRetryMaxInterval.Valid {
+		c.MetricPushRetryMaxInterval = cfg.MetricPushRetryMaxInterval
+	}
+	if cfg.MetricPushRetryJitter.Valid {
+		c.MetricPushRetryJitter = cfg.MetricPushRetryJitter
+	}
+	if cfg.MetricPushCircuitBreakerThreshold.Valid {
+		c.MetricPushCircuitBreakerThreshold = cfg.MetricPushCircuitBreakerThreshold
+	}
+	if cfg.MetricPushCircuitBreakerCooldown.Valid {
+		c.MetricPushCircuitBreakerCooldown = cfg.MetricPushCircuitBreakerCooldown
+	}
+	if cfg.MaxBufferedSamples.Valid {
+		c.MaxBufferedSamples = cfg.MaxBufferedSamples
+	}
+	if cfg.AbortOnRemoteFailure.Valid {
+		c.AbortOnRemoteFailure = cfg.AbortOnRemoteFailure
+	}
+	if cfg.RemoteStatusPollInterval.Valid {
+		c.RemoteStatusPollInterval = cfg.RemoteStatusPollInterval
+	}
 
 	if cfg.AggregationPeriod.Valid {
 		c.AggregationPeriod = cfg.AggregationPeriod
@@ -249,7 +365,7 @@ func (c Config) Apply(cfg Config) Config {
 	return c
 }
 
-// MergeFromExternal merges three fields from the JSON in a loadimpact key of
+// MergeFromExternal merges four fields from the JSON in a loadimpact key of
 // the provided external map. Used for options.ext.loadimpact settings.
 func MergeFromExternal(external map[string]json.RawMessage, conf *Config) error {
 	if val, ok := external["loadimpact"]; ok {
@@ -258,7 +374,7 @@ func MergeFromExternal(external map[string]json.RawMessage, conf *Config) error
 		if err := json.Unmarshal(val, &tmpConfig); err != nil {
 			return err
 		}
-		// Only take out the ProjectID, Name and Token from the options.ext.loadimpact map:
+		// Only take out the ProjectID, Name, Token and Metadata from the options.ext.loadimpact map:
 		if tmpConfig.ProjectID.Valid {
 			conf.ProjectID = tmpConfig.ProjectID
 		}
@@ -268,6 +384,9 @@ func MergeFromExternal(external map[string]json.RawMessage, conf *Config) error
 		if tmpConfig.Token.Valid {
 			conf.Token = tmpConfig.Token
 		}
+		if len(tmpConfig.Metadata) > 0 {
+			*conf = conf.Apply(Config{Metadata: tmpConfig.Metadata})
+		}
 	}
 	return nil
 }
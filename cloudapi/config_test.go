@@ -39,27 +39,45 @@ func TestConfigApply(t *testing.T) {
 	assert.Equal(t, defaults, defaults.Apply(empty).Apply(empty))
 
 	full := Config{
-		Token:                           null.NewString("Token", true),
-		DeprecatedToken:                 null.NewString("DeprecatedToken", true),
-		ProjectID:                       null.NewInt(1, true),
-		Name:                            null.NewString("Name", true),
-		Host:                            null.NewString("Host", true),
-		LogsTailURL:                     null.NewString("LogsTailURL", true),
-		PushRefID:                       null.NewString("PushRefID", true),
-		WebAppURL:                       null.NewString("foo", true),
-		NoCompress:                      null.NewBool(true, true),
-		MaxMetricSamplesPerPackage:      null.NewInt(2, true),
-		MetricPushInterval:              types.NewNullDuration(1*time.Second, true),
-		MetricPushConcurrency:           null.NewInt(3, true),
-		AggregationPeriod:               types.NewNullDuration(2*time.Second, true),
-		AggregationCalcInterval:         types.NewNullDuration(3*time.Second, true),
-		AggregationWaitPeriod:           types.NewNullDuration(4*time.Second, true),
-		AggregationMinSamples:           null.NewInt(4, true),
-		AggregationSkipOutlierDetection: null.NewBool(true, true),
-		AggregationOutlierAlgoThreshold: null.NewInt(5, true),
-		AggregationOutlierIqrRadius:     null.NewFloat(6, true),
-		AggregationOutlierIqrCoefLower:  null.NewFloat(7, true),
-		AggregationOutlierIqrCoefUpper:  null.NewFloat(8, true),
+		Token:                             null.NewString("Token", true),
+		DeprecatedToken:                   null.NewString("DeprecatedToken", true),
+		ProjectID:                         null.NewInt(1, true),
+		Name:                              null.NewString("Name", true),
+		Host:                              null.NewString("Host", true),
+		LogsTailURL:                       null.NewString("LogsTailURL", true),
+		PushRefID:                         null.NewString("PushRefID", true),
+		WebAppURL:                         null.NewString("foo", true),
+		NoCompress:                        null.NewBool(true, true),
+		ProxyURL:                          null.NewString("http://proxy:3128", true),
+		ProxyUsername:                     null.NewString("user", true),
+		ProxyPassword:                     null.NewString("pass", true),
+		ProxyCACert:                       null.NewString("ca.pem", true),
+		Metadata:                          map[string]string{"foo": "bar"},
+		AutoMetadata:                      null.NewBool(false, true),
+		MaxMetricSamplesPerPackage:        null.NewInt(2, true),
+		MetricPushInterval:                types.NewNullDuration(1*time.Second, true),
+		MetricPushConcurrency:             null.NewInt(3, true),
+		MetricPushAttempts:                null.NewInt(5, true),
+		MetricPushRetryInterval:           types.NewNullDuration(1*time.Second, true),
+		MetricPushRetryMaxInterval:        types.NewNullDuration(10*time.Second, true),
+		MetricPushRetryJitter:             null.NewFloat(0.5, true),
+		MetricPushCircuitBreakerThreshold: null.NewInt(4, true),
+		MetricPushCircuitBreakerCooldown:  types.NewNullDuration(1*time.Minute, true),
+		MaxBufferedSamples:                null.NewInt(1000, true),
+		MaxBandwidth:                      null.NewInt(1024, true),
+		PayloadDumpDir:                    null.NewString("payloads", true),
+		PayloadDumpOnly:                   null.NewBool(true, true),
+		AbortOnRemoteFailure:              null.NewBool(true, true),
+		RemoteStatusPollInterval:          types.NewNullDuration(2*time.Second, true),
+		AggregationPeriod:                 types.NewNullDuration(2*time.Second, true),
+		AggregationCalcInterval:           types.NewNullDuration(3*time.Second, true),
+		AggregationWaitPeriod:             types.NewNullDuration(4*time.Second, true),
+		AggregationMinSamples:             null.NewInt(4, true),
+		AggregationSkipOutlierDetection:   null.NewBool(true, true),
+		AggregationOutlierAlgoThreshold:   null.NewInt(5, true),
+		AggregationOutlierIqrRadius:       null.NewFloat(6, true),
+		AggregationOutlierIqrCoefLower:    null.NewFloat(7, true),
+		AggregationOutlierIqrCoefUpper:    null.NewFloat(8, true),
 	}
 
 	assert.Equal(t, full, full.Apply(empty))
@@ -22,6 +22,7 @@ package cloudapi
 
 import (
 	"context"
+	"crypto/tls"
 	"fmt"
 	"net/http"
 	"net/url"
@@ -31,6 +32,8 @@ import (
 	"github.com/gorilla/websocket"
 	"github.com/mailru/easyjson"
 	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/lib/fips"
 )
 
 //go:generate easyjson -pkg -no_std_marshalers -gen_build_flags -mod=mod .
@@ -119,9 +122,17 @@ func (c *Config) StreamLogsToLogger(
 	headers := make(http.Header)
 	headers.Add("Sec-WebSocket-Protocol", "token="+c.Token.String)
 
+	dialer := *websocket.DefaultDialer
+	if fips.Enabled() {
+		dialer.TLSClientConfig = &tls.Config{} //nolint:gosec
+		if err = fips.RestrictTLS(dialer.TLSClientConfig); err != nil {
+			return err
+		}
+	}
+
 	// We don't need to close the http body or use it for anything until we want to actually log
 	// what the server returned as body when it errors out
-	conn, _, err := websocket.DefaultDialer.DialContext(ctx, u.String(), headers) //nolint:bodyclose
+	conn, _, err := dialer.DialContext(ctx, u.String(), headers) //nolint:bodyclose
 	if err != nil {
 		return err
 	}
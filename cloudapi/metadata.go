@@ -0,0 +1,108 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cloudapi
+
+import "strings"
+
+// Well-known metadata keys that are detected automatically from the
+// environment of common CI systems.
+const (
+	MetadataGitCommit = "git_commit"
+	MetadataGitBranch = "git_branch"
+	MetadataCIJobURL  = "ci_job_url"
+)
+
+// metadataEnvVars lists, for every automatically detected metadata key, the
+// environment variables that may hold its value, in order of precedence.
+//
+//nolint:gochecknoglobals
+var metadataEnvVars = map[string][]string{
+	MetadataGitCommit: {
+		"K6_CLOUD_GIT_COMMIT",
+		"GITHUB_SHA",          // GitHub Actions
+		"CI_COMMIT_SHA",       // GitLab CI
+		"GIT_COMMIT",          // Jenkins
+		"CIRCLE_SHA1",         // CircleCI
+		"BUILD_SOURCEVERSION", // Azure Pipelines
+		"BITBUCKET_COMMIT",    // Bitbucket Pipelines
+		"TRAVIS_COMMIT",       // Travis CI
+	},
+	MetadataGitBranch: {
+		"K6_CLOUD_GIT_BRANCH",
+		"GITHUB_HEAD_REF",
+		"GITHUB_REF_NAME",
+		"CI_COMMIT_REF_NAME",
+		"GIT_BRANCH",
+		"CIRCLE_BRANCH",
+		"BUILD_SOURCEBRANCHNAME",
+		"BITBUCKET_BRANCH",
+		"TRAVIS_BRANCH",
+	},
+	MetadataCIJobURL: {
+		"K6_CLOUD_CI_JOB_URL",
+		"CI_JOB_URL",
+		"BUILD_URL",
+		"CIRCLE_BUILD_URL",
+		"TRAVIS_JOB_WEB_URL",
+	},
+}
+
+// DetectMetadata returns the test run metadata that could be found in the
+// given environment variables, like the git commit and branch and the URL of
+// the CI job that is running k6.
+func DetectMetadata(env map[string]string) map[string]string {
+	result := make(map[string]string)
+	for key, vars := range metadataEnvVars {
+		for _, name := range vars {
+			if val := strings.TrimSpace(env[name]); val != "" {
+				result[key] = val
+				break
+			}
+		}
+	}
+
+	// GitHub Actions doesn't have a single variable with the job URL
+	if _, ok := result[MetadataCIJobURL]; !ok && env["GITHUB_RUN_ID"] != "" {
+		server, repo := env["GITHUB_SERVER_URL"], env["GITHUB_REPOSITORY"]
+		if server != "" && repo != "" {
+			result[MetadataCIJobURL] = server + "/" + repo + "/actions/runs/" + env["GITHUB_RUN_ID"]
+		}
+	}
+	return result
+}
+
+// TestRunMetadata returns the metadata that should be attached to a new test
+// run. Explicitly configured values take precedence over detected ones.
+func (c Config) TestRunMetadata(env map[string]string) map[string]string {
+	result := make(map[string]string)
+	if !c.AutoMetadata.Valid || c.AutoMetadata.Bool {
+		for k, v := range DetectMetadata(env) {
+			result[k] = v
+		}
+	}
+	for k, v := range c.Metadata {
+		result[k] = v
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
@@ -0,0 +1,73 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cloudapi
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/guregu/null.v3"
+)
+
+func TestDetectMetadata(t *testing.T) {
+	t.Parallel()
+
+	assert.Empty(t, DetectMetadata(nil))
+	assert.Equal(t, map[string]string{
+		MetadataGitCommit: "abc123",
+		MetadataGitBranch: "feature",
+		MetadataCIJobURL:  "https://github.com/org/repo/actions/runs/42",
+	}, DetectMetadata(map[string]string{
+		"GITHUB_SHA":        "abc123",
+		"GITHUB_REF_NAME":   "feature",
+		"GITHUB_SERVER_URL": "https://github.com",
+		"GITHUB_REPOSITORY": "org/repo",
+		"GITHUB_RUN_ID":     "42",
+	}))
+	assert.Equal(t, map[string]string{
+		MetadataGitCommit: "def456",
+		MetadataGitBranch: "main",
+		MetadataCIJobURL:  "https://gitlab.example.com/job/1",
+	}, DetectMetadata(map[string]string{
+		"K6_CLOUD_GIT_COMMIT": "def456",
+		"CI_COMMIT_SHA":       "abc123",
+		"CI_COMMIT_REF_NAME":  "main",
+		"CI_JOB_URL":          "https://gitlab.example.com/job/1",
+	}))
+}
+
+func TestTestRunMetadata(t *testing.T) {
+	t.Parallel()
+
+	env := map[string]string{"GIT_COMMIT": "abc123", "GIT_BRANCH": "main"}
+
+	conf := NewConfig()
+	assert.Nil(t, conf.TestRunMetadata(nil))
+	assert.Equal(t, map[string]string{MetadataGitCommit: "abc123", MetadataGitBranch: "main"},
+		conf.TestRunMetadata(env))
+
+	conf = conf.Apply(Config{Metadata: map[string]string{MetadataGitBranch: "release", "team": "qa"}})
+	assert.Equal(t, map[string]string{MetadataGitCommit: "abc123", MetadataGitBranch: "release", "team": "qa"},
+		conf.TestRunMetadata(env))
+
+	conf = conf.Apply(Config{AutoMetadata: null.BoolFrom(false)})
+	assert.Equal(t, map[string]string{MetadataGitBranch: "release", "team": "qa"}, conf.TestRunMetadata(env))
+}
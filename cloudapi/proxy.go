@@ -0,0 +1,110 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cloudapi
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/pkg/errors"
+
+	"github.com/loadimpact/k6/lib/fips"
+)
+
+// newTransport returns the HTTP transport for the cloud API clients, or nil if
+// the default one can be used. A transport is needed to send all requests
+// through the proxy in the given config, regardless of the HTTP_PROXY and
+// HTTPS_PROXY environment variables, and to restrict the TLS settings to the
+// approved ones in FIPS mode.
+func newTransport(conf Config) (*http.Transport, error) {
+	hasProxy := conf.ProxyURL.Valid && conf.ProxyURL.String != ""
+	if !hasProxy && !fips.Enabled() {
+		return nil, nil
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	tlsConfig := &tls.Config{} //nolint:gosec
+	if hasProxy {
+		proxyURL, err := newProxyURL(conf)
+		if err != nil {
+			return nil, err
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
+
+		if conf.ProxyCACert.Valid && conf.ProxyCACert.String != "" {
+			if tlsConfig.RootCAs, err = loadProxyCACert(conf.ProxyCACert.String); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := fips.RestrictTLS(tlsConfig); err != nil {
+		return nil, err
+	}
+	if tlsConfig.RootCAs != nil || fips.Enabled() {
+		transport.TLSClientConfig = tlsConfig
+	}
+
+	return transport, nil
+}
+
+func newProxyURL(conf Config) (*url.URL, error) {
+	proxyURL, err := url.Parse(conf.ProxyURL.String)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid cloud proxy URL")
+	}
+	if proxyURL.Scheme != "http" && proxyURL.Scheme != "https" {
+		return nil, errors.Errorf("unsupported cloud proxy URL scheme '%s'", proxyURL.Scheme)
+	}
+	if conf.ProxyUsername.Valid && conf.ProxyUsername.String != "" {
+		proxyURL.User = url.UserPassword(conf.ProxyUsername.String, conf.ProxyPassword.String)
+	}
+	return proxyURL, nil
+}
+
+func loadProxyCACert(filename string) (*x509.CertPool, error) {
+	pem, err := ioutil.ReadFile(filename) //nolint:gosec
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read the cloud proxy CA bundle")
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil || pool == nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no certificates found in the cloud proxy CA bundle '%s'", filename)
+	}
+	return pool, nil
+}
+
+// ConfigureTransport makes the client send its requests through the proxy from
+// the given config, if one is configured. In FIPS mode, it also restricts the
+// TLS settings of the client to the approved ones.
+func (c *Client) ConfigureTransport(conf Config) error {
+	transport, err := newTransport(conf)
+	if err != nil || transport == nil {
+		return err
+	}
+	c.client.Transport = transport
+	return nil
+}
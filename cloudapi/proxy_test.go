@@ -0,0 +1,110 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cloudapi
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib/testutils"
+)
+
+func TestClientConfigureTransport(t *testing.T) {
+	t.Parallel()
+
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth := "Basic " + base64.StdEncoding.EncodeToString([]byte("user:pass"))
+		if r.Header.Get("Proxy-Authorization") != auth {
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+		assert.Equal(t, "cloud.invalid", r.Host)
+		fprintf(t, w, `{"reference_id": "1"}`)
+	}))
+	defer proxy.Close()
+
+	client := NewClient(testutils.NewLogger(t), "token", "http://cloud.invalid", "1.0")
+	client.retries = 1
+	require.NoError(t, client.ConfigureTransport(Config{
+		ProxyURL:      null.StringFrom(proxy.URL),
+		ProxyUsername: null.StringFrom("user"),
+		ProxyPassword: null.StringFrom("pass"),
+	}))
+
+	resp, err := client.CreateTestRun(&TestRun{Name: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, "1", resp.ReferenceID)
+
+	require.NoError(t, client.ConfigureTransport(Config{ProxyURL: null.StringFrom(proxy.URL)}))
+	_, err = client.CreateTestRun(&TestRun{Name: "test"})
+	require.Error(t, err)
+}
+
+func TestNewProxyTransport(t *testing.T) {
+	t.Parallel()
+
+	transport, err := newTransport(NewConfig())
+	require.NoError(t, err)
+	assert.Nil(t, transport)
+
+	_, err = newTransport(Config{ProxyURL: null.StringFrom("socks5://proxy:1080")})
+	assert.EqualError(t, err, "unsupported cloud proxy URL scheme 'socks5'")
+
+	dir, err := ioutil.TempDir("", "k6-cloud-proxy-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	_, err = newTransport(Config{
+		ProxyURL:    null.StringFrom("http://proxy:3128"),
+		ProxyCACert: null.StringFrom(filepath.Join(dir, "missing.pem")),
+	})
+	assert.Error(t, err)
+
+	badCA := filepath.Join(dir, "bad.pem")
+	require.NoError(t, ioutil.WriteFile(badCA, []byte("not a certificate"), 0o600))
+	_, err = newTransport(Config{
+		ProxyURL:    null.StringFrom("http://proxy:3128"),
+		ProxyCACert: null.StringFrom(badCA),
+	})
+	assert.Contains(t, err.Error(), "no certificates found")
+
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	goodCA := filepath.Join(dir, "ca.pem")
+	require.NoError(t, ioutil.WriteFile(goodCA, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+	transport, err = newTransport(Config{
+		ProxyURL:    null.StringFrom("https://proxy:3128"),
+		ProxyCACert: null.StringFrom(goodCA),
+	})
+	require.NoError(t, err)
+	require.NotNil(t, transport.TLSClientConfig)
+	assert.NotNil(t, transport.TLSClientConfig.RootCAs)
+}
@@ -0,0 +1,261 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/distributed"
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/js"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/output"
+)
+
+//nolint:funlen
+func getAgentCmd(ctx context.Context, logger *logrus.Logger) *cobra.Command {
+	var (
+		coordinatorAddress, name string
+		security                 agentSecurityFlags
+	)
+
+	// agentCmd represents the agent command
+	agentCmd := &cobra.Command{
+		Use:   "agent",
+		Short: "Join a distributed load test",
+		Long: `Join a distributed load test.
+
+The agent connects to a coordinator started with ` + "`k6 coordinator`" + `, gets
+the script and its part of the test run from it, and sends its metrics back to
+it. The thresholds and the end-of-test summary are handled by the coordinator.`,
+		Example: `
+  # Connect to the coordinator and wait for the test run to start.
+  K6_COORDINATOR_TOKEN=s3cr3t k6 agent --coordinator 10.0.0.1:6566 --tls-ca ca.crt`[1:],
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if name == "" {
+				name, _ = os.Hostname()
+			}
+
+			globalCtx, globalCancel := context.WithCancel(ctx)
+			defer globalCancel()
+			runCtx, runCancel := context.WithCancel(globalCtx)
+			defer runCancel()
+
+			sigC := make(chan os.Signal, 1)
+			signal.Notify(sigC, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+			defer signal.Stop(sigC)
+			go func() {
+				sig := <-sigC
+				logger.WithField("sig", sig).Debug("Stopping the agent in response to signal...")
+				runCancel()
+
+				sig = <-sigC
+				logger.WithField("sig", sig).Error("Aborting k6 in response to signal")
+				globalCancel()
+				os.Exit(externalAbortErrorCode)
+			}()
+
+			sec, err := security.get(buildEnvMap(os.Environ()))
+			if err != nil {
+				return ExitCode{error: err, Code: invalidConfigErrorCode}
+			}
+			logger.Infof("Connecting to the coordinator at %s...", coordinatorAddress)
+			agent, err := distributed.Connect(runCtx, coordinatorAddress, sec, logger)
+			if err != nil {
+				return err
+			}
+			defer func() { _ = agent.Close() }()
+
+			work, err := agent.Register(runCtx, name)
+			if err != nil {
+				return err
+			}
+			logger.Infof("Registered as agent %d of %d, with execution segment %s",
+				work.InstanceID, work.Instances, work.ExecutionSegment)
+
+			runErr := runAgentWork(globalCtx, runCtx, logger, agent, work)
+			if errors.Is(runErr, distributed.ErrAborted) {
+				logger.Info("The test run was stopped by the coordinator")
+				runErr = nil
+			}
+			if err = agent.Done(globalCtx, runErr); err != nil {
+				logger.WithError(err).Error("Couldn't tell the coordinator that the agent is done")
+			}
+			return runErr
+		},
+	}
+
+	agentCmd.Flags().SortFlags = false
+	agentCmd.Flags().AddFlagSet(agentCmdFlagSet(&coordinatorAddress, &name, &security))
+
+	return agentCmd
+}
+
+// runAgentWork runs the part of the test run that the coordinator assigned to
+// the agent.
+func runAgentWork(
+	globalCtx, runCtx context.Context, logger *logrus.Logger, agent *distributed.Agent, work *distributed.Work,
+) error {
+	arc, err := lib.ReadArchive(bytes.NewReader(work.Archive))
+	if err != nil {
+		return err
+	}
+	// The thresholds and the summary are handled by the coordinator
+	runtimeOptions := lib.RuntimeOptions{
+		NoThresholds: null.BoolFrom(true),
+		NoSummary:    null.BoolFrom(true),
+		FIPSMode:     null.BoolFrom(work.FIPSMode),
+	}
+	enableFIPSMode(runtimeOptions)
+	runner, err := js.NewFromArchive(logger, arc, runtimeOptions)
+	if err != nil {
+		return err
+	}
+
+	// setup() and teardown() are run by the coordinator as well
+	options := runner.GetOptions()
+	options.ExecutionSegment = work.ExecutionSegment
+	options.ExecutionSegmentSequence = work.ExecutionSegmentSequence
+	options.NoSetup = null.BoolFrom(true)
+	options.NoTeardown = null.BoolFrom(true)
+	options.Thresholds = nil
+	if err = runner.SetOptions(options); err != nil {
+		return err
+	}
+
+	execScheduler, err := local.NewExecutionScheduler(runner, logger)
+	if err != nil {
+		return err
+	}
+	out := agent.NewOutput(execScheduler.GetState())
+	engine, err := core.NewEngine(execScheduler, options, runtimeOptions, []output.Output{out}, logger)
+	if err != nil {
+		return err
+	}
+	if err = engine.StartOutputs(); err != nil {
+		return err
+	}
+
+	engineCtx, engineCancel := context.WithCancel(globalCtx)
+	defer engineCancel()
+	engineRunCtx, engineRunCancel := context.WithCancel(engineCtx)
+	defer engineRunCancel()
+	engineRun, engineWait, err := engine.Init(engineCtx, engineRunCtx)
+	if err != nil {
+		engine.StopOutputs()
+		return err
+	}
+	var stopOnce sync.Once
+	stopEngine := func() {
+		stopOnce.Do(func() {
+			engineRunCancel()
+			engineCancel()
+			engineWait()
+			engine.StopOutputs()
+		})
+	}
+	defer stopEngine()
+
+	setupData, abort, err := agent.Ready(runCtx)
+	if err != nil {
+		return err
+	}
+	if abort {
+		return distributed.ErrAborted
+	}
+	runner.SetSetupData(setupData)
+
+	// Stopping the agent stops only its own part of the test run
+	go func() {
+		select {
+		case <-runCtx.Done():
+			engineRunCancel()
+		case <-engineRunCtx.Done():
+		}
+	}()
+	if err = engineRun(); err != nil {
+		return err
+	}
+	// The remaining samples are sent to the coordinator before it's told
+	// that the agent is done.
+	stopEngine()
+	return engine.GetStopError()
+}
+
+// agentSecurityFlags are the flags for the token and the TLS settings of the
+// connection to the coordinator.
+type agentSecurityFlags struct {
+	token  string
+	useTLS bool
+	tlsCA  string
+}
+
+func (f agentSecurityFlags) get(environment map[string]string) (distributed.Security, error) {
+	sec := distributed.Security{Token: f.token}
+	if sec.Token == "" {
+		sec.Token = environment["K6_COORDINATOR_TOKEN"]
+	}
+	if !f.useTLS && f.tlsCA == "" {
+		return sec, nil
+	}
+	sec.TLSConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	if f.tlsCA != "" {
+		pem, err := ioutil.ReadFile(f.tlsCA)
+		if err != nil {
+			return sec, err
+		}
+		sec.TLSConfig.RootCAs = x509.NewCertPool()
+		if !sec.TLSConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return sec, fmt.Errorf("no certificates found in %s", f.tlsCA)
+		}
+	}
+	return sec, nil
+}
+
+func agentCmdFlagSet(coordinatorAddress, name *string, security *agentSecurityFlags) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+	flags.SortFlags = false
+	flags.StringVar(coordinatorAddress, "coordinator", "localhost:6566", "`address` of the coordinator")
+	flags.StringVar(name, "name", "", "name of the agent, shown by the coordinator (default: the hostname)")
+	flags.StringVar(&security.token, "token", "",
+		"`token` to authenticate with to the coordinator, can also be set with K6_COORDINATOR_TOKEN")
+	flags.BoolVar(&security.useTLS, "tls", false, "connect to the coordinator with TLS")
+	flags.StringVar(&security.tlsCA, "tls-ca", "",
+		"CA certificate `file` the certificate of the coordinator is verified with, implies --tls")
+	return flags
+}
@@ -65,6 +65,7 @@ An archive is a fully self-contained test run, and can be executed identically e
 			if err != nil {
 				return err
 			}
+			enableFIPSMode(runtimeOptions)
 
 			r, err := newRunner(logger, src, runType, filesystems, runtimeOptions)
 			if err != nil {
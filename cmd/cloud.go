@@ -109,6 +109,7 @@ This will execute the test on the k6 cloud service. Use "k6 login cloud" to auth
 			if err != nil {
 				return err
 			}
+			enableFIPSMode(runtimeOptions)
 
 			modifyAndPrintBar(progressBar, pb.WithConstProgress(0, "Getting script options"))
 			r, err := newRunner(logger, src, runType, filesystems, runtimeOptions)
@@ -203,12 +204,17 @@ This will execute the test on the k6 cloud service. Use "k6 login cloud" to auth
 			// Start cloud test run
 			modifyAndPrintBar(progressBar, pb.WithConstProgress(0, "Validating script options"))
 			client := cloudapi.NewClient(logger, cloudConfig.Token.String, cloudConfig.Host.String, consts.Version)
+			if err = client.ConfigureTransport(cloudConfig); err != nil {
+				return err
+			}
 			if err = client.ValidateOptions(arc.Options); err != nil {
 				return err
 			}
 
 			modifyAndPrintBar(progressBar, pb.WithConstProgress(0, "Uploading archive"))
-			refID, err := client.StartCloudTestRun(name, cloudConfig.ProjectID.Int64, arc)
+			refID, err := client.StartCloudTestRun(
+				name, cloudConfig.ProjectID.Int64, arc, cloudConfig.TestRunMetadata(osEnvironment),
+			)
 			if err != nil {
 				return err
 			}
@@ -36,6 +36,7 @@ import (
 // Use these when interacting with fs and writing to terminal, makes a command testable
 var defaultFs = afero.NewOsFs()
 var defaultWriter io.Writer = os.Stdout
+var defaultErrWriter io.Writer = os.Stderr
 
 // Panic if the given error is not nil.
 func must(err error) {
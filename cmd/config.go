@@ -36,6 +36,7 @@ import (
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/executor"
 	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/output"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -58,6 +59,9 @@ type Config struct {
 
 	// TODO: deprecate
 	Collectors map[string]json.RawMessage `json:"collectors"`
+
+	// Which metric samples are sent to the outputs of the given types.
+	OutputFilters map[string]output.FilterConfig `json:"outputFilters"`
 }
 
 // Validate checks if all of the specified options make sense
@@ -83,6 +87,9 @@ func (c Config) Apply(cfg Config) Config {
 	if len(cfg.Collectors) > 0 {
 		c.Collectors = cfg.Collectors
 	}
+	if len(cfg.OutputFilters) > 0 {
+		c.OutputFilters = cfg.OutputFilters
+	}
 	return c
 }
 
@@ -261,5 +268,10 @@ func validateScenarioConfig(conf lib.ExecutorConfig, isExecutable func(string) b
 	if !isExecutable(execFn) {
 		return fmt.Errorf("executor %s: function '%s' not found in exports", conf.GetName(), execFn)
 	}
+	for _, fn := range []string{conf.GetSetup(), conf.GetTeardown()} {
+		if fn != "" && !isExecutable(fn) {
+			return fmt.Errorf("executor %s: function '%s' not found in exports", conf.GetName(), fn)
+		}
+	}
 	return nil
 }
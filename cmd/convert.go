@@ -22,14 +22,18 @@ package cmd
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"path/filepath"
+	"strings"
 
 	"github.com/spf13/cobra"
 	"gopkg.in/guregu/null.v3"
 
+	"github.com/loadimpact/k6/converter/artillery"
 	"github.com/loadimpact/k6/converter/har"
+	"github.com/loadimpact/k6/converter/jmeter"
 	"github.com/loadimpact/k6/lib"
 )
 
@@ -53,12 +57,21 @@ var (
 func getConvertCmd() *cobra.Command {
 	convertCmd := &cobra.Command{
 		Use:   "convert",
-		Short: "Convert a HAR file to a k6 script",
-		Long:  "Convert a HAR (HTTP Archive) file to a k6 script",
+		Short: "Convert a HAR file, a JMeter test plan or an Artillery script to a k6 script",
+		Long: "Convert a HAR (HTTP Archive) file, a JMeter test plan (.jmx file), or an Artillery script\n" +
+			"(.yml file) to a k6 script.\n\n" +
+			"The thread groups of JMeter test plans and the phases of Artillery scripts are converted to\n" +
+			"scenarios, and the parts that couldn't be converted are listed when the conversion is done.",
 		Example: `
   # Convert a HAR file to a k6 script.
   k6 convert -O har-session.js session.har
 
+  # Convert a JMeter test plan to a k6 script.
+  k6 convert -O plan.js plan.jmx
+
+  # Convert an Artillery script to a k6 script.
+  k6 convert -O artillery.js artillery.yml
+
   # Convert a HAR file to a k6 script creating requests only for the given domain/s.
   k6 convert -O har-session.js --only yourdomain.com,additionaldomain.com session.har
 
@@ -74,6 +87,12 @@ func getConvertCmd() *cobra.Command {
 			if err != nil {
 				return err
 			}
+			switch strings.ToLower(filepath.Ext(filePath)) {
+			case ".jmx":
+				return convertJMeterPlan(filePath)
+			case ".yml", ".yaml":
+				return convertArtilleryScript(filePath)
+			}
 			r, err := defaultFs.Open(filePath)
 			if err != nil {
 				return err
@@ -108,27 +127,7 @@ func getConvertCmd() *cobra.Command {
 				return err
 			}
 
-			// Write script content to stdout or file
-			if convertOutput == "" || convertOutput == "-" { //nolint:nestif
-				if _, err := io.WriteString(defaultWriter, script); err != nil {
-					return err
-				}
-			} else {
-				f, err := defaultFs.Create(convertOutput)
-				if err != nil {
-					return err
-				}
-				if _, err := f.WriteString(script); err != nil {
-					return err
-				}
-				if err := f.Sync(); err != nil {
-					return err
-				}
-				if err := f.Close(); err != nil {
-					return err
-				}
-			}
-			return nil
+			return writeConvertedScript(script)
 		},
 	}
 
@@ -152,3 +151,74 @@ func getConvertCmd() *cobra.Command {
 	convertCmd.Flags().UintVarP(&maxSleep, "max-sleep", "", 40, "the maximum amount of seconds to sleep after each iteration")
 	return convertCmd
 }
+
+// writeConvertedScript writes the script to stdout or to the --output file.
+func writeConvertedScript(script string) error {
+	if convertOutput == "" || convertOutput == "-" {
+		_, err := io.WriteString(defaultWriter, script)
+		return err
+	}
+	f, err := defaultFs.Create(convertOutput)
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(script); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func convertJMeterPlan(filePath string) error {
+	r, err := defaultFs.Open(filePath)
+	if err != nil {
+		return err
+	}
+	plan, err := jmeter.Decode(r)
+	if err != nil {
+		return err
+	}
+	if err = r.Close(); err != nil {
+		return err
+	}
+	result, err := jmeter.Convert(plan)
+	if err != nil {
+		return err
+	}
+	return writeConversionResult(result.Script, result.Unsupported, "test plan")
+}
+
+func convertArtilleryScript(filePath string) error {
+	r, err := defaultFs.Open(filePath)
+	if err != nil {
+		return err
+	}
+	script, err := artillery.Decode(r)
+	if err != nil {
+		return err
+	}
+	if err = r.Close(); err != nil {
+		return err
+	}
+	result, err := artillery.Convert(script)
+	if err != nil {
+		return err
+	}
+	return writeConversionResult(result.Script, result.Unsupported, "Artillery script")
+}
+
+// writeConversionResult writes the converted script and lists the parts of
+// the source that couldn't be fully converted.
+func writeConversionResult(script string, unsupported []string, source string) error {
+	if err := writeConvertedScript(script); err != nil {
+		return err
+	}
+	if len(unsupported) == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(defaultErrWriter, "These parts of the %s couldn't be fully converted:\n  - %s\n",
+		source, strings.Join(unsupported, "\n  - "))
+	return err
+}
@@ -208,6 +208,44 @@ func TestIntegrationConvertCmd(t *testing.T) {
 		assert.NoError(t, err)
 		assert.Equal(t, testHARConvertResult, string(output))
 	})
+	t.Run("JMeter", func(t *testing.T) {
+		jmxFile, err := filepath.Abs("plan.jmx")
+		require.NoError(t, err)
+		jmx, err := ioutil.ReadFile("../converter/jmeter/testdata/plan.jmx")
+		require.NoError(t, err)
+		expectedScript, err := ioutil.ReadFile("../converter/jmeter/testdata/plan.js")
+		require.NoError(t, err)
+		defaultFs = afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(defaultFs, jmxFile, jmx, 0o644))
+
+		buf, errBuf := &bytes.Buffer{}, &bytes.Buffer{}
+		defaultWriter, defaultErrWriter = buf, errBuf
+
+		convertCmd := getConvertCmd()
+		require.NoError(t, convertCmd.RunE(convertCmd, []string{jmxFile}))
+		assert.Equal(t, string(expectedScript), buf.String())
+		assert.Contains(t, errBuf.String(), "These parts of the test plan couldn't be fully converted:\n"+
+			"  - ThreadGroup \"Browsing users\" › IfController \"Sometimes\"")
+	})
+	t.Run("Artillery", func(t *testing.T) {
+		ymlFile, err := filepath.Abs("artillery.yml")
+		require.NoError(t, err)
+		yml, err := ioutil.ReadFile("../converter/artillery/testdata/shop.yml")
+		require.NoError(t, err)
+		expectedScript, err := ioutil.ReadFile("../converter/artillery/testdata/shop.js")
+		require.NoError(t, err)
+		defaultFs = afero.NewMemMapFs()
+		require.NoError(t, afero.WriteFile(defaultFs, ymlFile, yml, 0o644))
+
+		buf, errBuf := &bytes.Buffer{}, &bytes.Buffer{}
+		defaultWriter, defaultErrWriter = buf, errBuf
+
+		convertCmd := getConvertCmd()
+		require.NoError(t, convertCmd.RunE(convertCmd, []string{ymlFile}))
+		assert.Equal(t, string(expectedScript), buf.String())
+		assert.Contains(t, errBuf.String(), "These parts of the Artillery script couldn't be fully converted:\n"+
+			"  - config.processor")
+	})
 	// TODO: test options injection; right now that's difficult because when there are multiple
 	// options, they can be emitted in different order in the JSON
 }
@@ -0,0 +1,289 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/distributed"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/consts"
+	"github.com/loadimpact/k6/loader"
+	"github.com/loadimpact/k6/ui/pb"
+)
+
+//nolint:funlen,gocognit
+func getCoordinatorCmd(ctx context.Context, logger *logrus.Logger) *cobra.Command {
+	var (
+		instances int
+		listen    string
+		security  coordinatorSecurityFlags
+	)
+
+	// coordinatorCmd represents the coordinator command
+	coordinatorCmd := &cobra.Command{
+		Use:   "coordinator",
+		Short: "Start a distributed load test",
+		Long: `Start a distributed load test.
+
+The coordinator waits for the given number of agents to connect to it, splits
+the test run between them and starts it. The agents send their metrics back to
+the coordinator, which evaluates the thresholds, sends the metrics to the
+outputs and shows the end-of-test summary for the whole test run.
+
+The agents get the script archive, with its environment variables, so when the
+coordinator listens on a network interface, the agents should be authenticated
+with a --token, which can also be set with K6_COORDINATOR_TOKEN, and the
+connections should be encrypted with --tls-cert and --tls-key.`,
+		Example: `
+  # Split a test run between 3 agents.
+  K6_COORDINATOR_TOKEN=s3cr3t k6 coordinator --instances 3 --listen 10.0.0.1:6566 \
+    --tls-cert coordinator.crt --tls-key coordinator.key script.js
+
+  # Connect an agent to the coordinator, on each of the 3 machines.
+  K6_COORDINATOR_TOKEN=s3cr3t k6 agent --coordinator 10.0.0.1:6566 --tls-ca ca.crt`[1:],
+		Args: exactArgsWithMsg(1, "arg should either be \"-\", if reading script from stdin, or a path to a script file"),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			_, _ = BannerColor.Fprintf(stdout, "\n%s\n\n", consts.Banner())
+
+			pwd, err := os.Getwd()
+			if err != nil {
+				return err
+			}
+			filename := args[0]
+			filesystems := loader.CreateFilesystems()
+			src, err := loader.ReadSource(logger, filename, pwd, filesystems, os.Stdin)
+			if err != nil {
+				return err
+			}
+
+			osEnvironment := buildEnvMap(os.Environ())
+			runtimeOptions, err := getRuntimeOptions(cmd.Flags(), osEnvironment)
+			if err != nil {
+				return err
+			}
+			enableFIPSMode(runtimeOptions)
+			initRunner, err := newRunner(logger, src, runType, filesystems, runtimeOptions)
+			if err != nil {
+				return err
+			}
+
+			cliConf, err := getConfig(cmd.Flags())
+			if err != nil {
+				return err
+			}
+			conf, err := getConsolidatedConfig(afero.NewOsFs(), cliConf, initRunner)
+			if err != nil {
+				return err
+			}
+			conf, cerr := deriveAndValidateConfig(conf, initRunner.IsExecutable)
+			if cerr != nil {
+				return ExitCode{error: cerr, Code: invalidConfigErrorCode}
+			}
+			if err = initRunner.SetOptions(conf.Options); err != nil {
+				return err
+			}
+
+			// The agents get the script, its dependencies and the consolidated
+			// options as an archive, like with `k6 archive`.
+			var archive bytes.Buffer
+			if err = initRunner.MakeArchive().Write(&archive); err != nil {
+				return err
+			}
+
+			sec, err := security.get(osEnvironment)
+			if err != nil {
+				return ExitCode{error: err, Code: invalidConfigErrorCode}
+			}
+			if sec.Token == "" {
+				logger.Warn("No --token was given, so anyone who can connect to the coordinator " +
+					"can join the test run and get the script archive")
+			}
+			if sec.TLSConfig == nil {
+				logger.Warn("No --tls-cert and --tls-key were given, so the connections to the agents aren't encrypted")
+			}
+			coordinator, err := distributed.NewCoordinator(initRunner, archive.Bytes(), instances, sec, logger)
+			if err != nil {
+				return ExitCode{error: err, Code: invalidConfigErrorCode}
+			}
+			listener, err := net.Listen("tcp", listen)
+			if err != nil {
+				return err
+			}
+			go func() {
+				if serr := coordinator.Serve(listener); serr != nil {
+					logger.WithError(serr).Error("The coordinator stopped serving the agents")
+				}
+			}()
+			defer coordinator.Stop()
+			logger.Infof("Waiting for %d agents on %s...", instances, listener.Addr())
+
+			globalCtx, globalCancel := context.WithCancel(ctx)
+			defer globalCancel()
+			runCtx, runCancel := context.WithCancel(globalCtx)
+			defer runCancel()
+
+			progressCtx, progressCancel := context.WithCancel(globalCtx)
+			defer progressCancel()
+			progressBarWG := &sync.WaitGroup{}
+			progressBarWG.Add(1)
+			go func() {
+				showProgress(progressCtx, conf, []*pb.ProgressBar{coordinator.GetProgressBar()}, logger)
+				progressBarWG.Done()
+			}()
+
+			executionPlan := coordinator.GetExecutionPlan()
+			outputs, err := createOutputs(conf.Out, src, conf, runtimeOptions, executionPlan, osEnvironment, logger)
+			if err != nil {
+				return err
+			}
+			engine, err := core.NewEngine(coordinator, conf.Options, runtimeOptions, outputs, logger)
+			if err != nil {
+				return err
+			}
+			if err = engine.StartOutputs(); err != nil {
+				return err
+			}
+			defer engine.StopOutputs()
+
+			printExecutionDescription(
+				"distributed", filename, "", conf, coordinator.GetState().ExecutionTuple,
+				executionPlan, outputs)
+
+			sigC := make(chan os.Signal, 1)
+			signal.Notify(sigC, os.Interrupt, syscall.SIGINT, syscall.SIGTERM)
+			defer signal.Stop(sigC)
+			go func() {
+				sig := <-sigC
+				logger.WithField("sig", sig).Debug("Stopping the distributed test run in response to signal...")
+				runCancel() // the agents are stopped as well
+
+				sig = <-sigC
+				logger.WithField("sig", sig).Error("Aborting k6 in response to signal")
+				globalCancel()
+				os.Exit(externalAbortErrorCode)
+			}()
+
+			engineRun, engineWait, err := engine.Init(globalCtx, runCtx)
+			if err != nil {
+				return getExitCodeFromEngine(err)
+			}
+			if err = engineRun(); err != nil {
+				return getExitCodeFromEngine(err)
+			}
+			runCancel()
+			logger.Debug("Engine run terminated cleanly")
+
+			progressCancel()
+			progressBarWG.Wait()
+
+			executionState := coordinator.GetState()
+			if !runtimeOptions.NoSummary.Bool {
+				summary := &lib.Summary{
+					Metrics:         engine.Metrics,
+					RootGroup:       initRunner.GetDefaultGroup(),
+					TestRunDuration: executionState.GetCurrentTestRunDuration(),
+					RequestTimings:  engine.RequestTimings,
+				}
+				summaryResult, err := initRunner.HandleSummary(globalCtx, summary)
+				if err == nil {
+					err = handleSummaryResult(afero.NewOsFs(), stdout, stderr, summaryResult)
+				}
+				if err != nil {
+					logger.WithError(err).Error("failed to handle the end-of-test summary")
+				}
+			}
+
+			globalCancel()
+			engineWait()
+			if err := engine.GetStopError(); err != nil {
+				return ExitCode{error: err, Code: outputAbortErrorCode}
+			}
+			if engine.IsTainted() {
+				return ExitCode{error: errors.New("some thresholds have failed"), Code: thresholdHaveFailedErrorCode}
+			}
+			return nil
+		},
+	}
+
+	coordinatorCmd.Flags().SortFlags = false
+	coordinatorCmd.Flags().AddFlagSet(coordinatorCmdFlagSet(&instances, &listen, &security))
+
+	return coordinatorCmd
+}
+
+// coordinatorSecurityFlags are the flags for the token and the TLS settings of
+// the coordinator.
+type coordinatorSecurityFlags struct {
+	token           string
+	tlsCert, tlsKey string
+}
+
+func (f coordinatorSecurityFlags) get(environment map[string]string) (distributed.Security, error) {
+	sec := distributed.Security{Token: f.token}
+	if sec.Token == "" {
+		sec.Token = environment["K6_COORDINATOR_TOKEN"]
+	}
+	if f.tlsCert == "" && f.tlsKey == "" {
+		return sec, nil
+	}
+	if f.tlsCert == "" || f.tlsKey == "" {
+		return sec, errors.New("both --tls-cert and --tls-key are needed for TLS")
+	}
+	cert, err := tls.LoadX509KeyPair(f.tlsCert, f.tlsKey)
+	if err != nil {
+		return sec, fmt.Errorf("couldn't load the TLS certificate of the coordinator: %w", err)
+	}
+	sec.TLSConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	return sec, nil
+}
+
+func coordinatorCmdFlagSet(instances *int, listen *string, security *coordinatorSecurityFlags) *pflag.FlagSet {
+	flags := pflag.NewFlagSet("", pflag.ContinueOnError)
+	flags.SortFlags = false
+	flags.IntVar(instances, "instances", 1, "number of agents to split the test run between")
+	flags.StringVar(listen, "listen", "localhost:6566", "`address` on which the agents connect to the coordinator")
+	flags.StringVar(&security.token, "token", "",
+		"`token` the agents have to authenticate with, can also be set with K6_COORDINATOR_TOKEN")
+	flags.StringVar(&security.tlsCert, "tls-cert", "", "TLS certificate `file` of the coordinator")
+	flags.StringVar(&security.tlsKey, "tls-key", "", "TLS private key `file` of the coordinator")
+	flags.AddFlagSet(optionFlagSet())
+	flags.AddFlagSet(runtimeOptionFlagSet(true))
+	flags.AddFlagSet(configFlagSet())
+	flags.StringVarP(&runType, "type", "t", runType, "override file `type`, \"js\" or \"archive\"")
+	flags.Lookup("type").DefValue = ""
+	return flags
+}
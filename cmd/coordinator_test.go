@@ -0,0 +1,54 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCoordinatorSecurityFlags(t *testing.T) {
+	t.Parallel()
+	env := map[string]string{"K6_COORDINATOR_TOKEN": "from-env"}
+
+	sec, err := coordinatorSecurityFlags{}.get(env)
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", sec.Token)
+	assert.Nil(t, sec.TLSConfig)
+
+	sec, err = coordinatorSecurityFlags{token: "from-flag"}.get(env)
+	require.NoError(t, err)
+	assert.Equal(t, "from-flag", sec.Token)
+
+	_, err = coordinatorSecurityFlags{tlsCert: "coordinator.crt"}.get(env)
+	assert.EqualError(t, err, "both --tls-cert and --tls-key are needed for TLS")
+
+	sec, err = agentSecurityFlags{useTLS: true}.get(env)
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", sec.Token)
+	require.NotNil(t, sec.TLSConfig)
+	assert.Nil(t, sec.TLSConfig.RootCAs)
+
+	_, err = agentSecurityFlags{tlsCA: "missing-ca.crt"}.get(env)
+	assert.Error(t, err)
+}
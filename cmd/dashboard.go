@@ -0,0 +1,234 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"golang.org/x/crypto/ssh/terminal"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/loadimpact/k6/ui"
+	"github.com/loadimpact/k6/ui/pb"
+)
+
+// TODO: fix this, global variables are not very testable...
+var dashboardMode bool //nolint:gochecknoglobals
+
+// The trends on the dashboard, if the test run has them.
+var dashboardTrends = []*stats.Metric{metrics.HTTPReqDuration, metrics.IterationDuration} //nolint:gochecknoglobals
+
+const (
+	dashboardPercentile = 0.95
+	// How often the trends on the dashboard get a new value. The dashboard
+	// itself is redrawn much more often.
+	dashboardSampleInterval = 1 * time.Second
+)
+
+// dashboardCollector gets the data for the dashboard from the engine and keeps
+// the history of its trends.
+type dashboardCollector struct {
+	engine  *core.Engine
+	state   *lib.ExecutionState
+	history map[string][]float64
+	maxLen  int
+}
+
+func newDashboardCollector(engine *core.Engine, state *lib.ExecutionState) *dashboardCollector {
+	return &dashboardCollector{
+		engine:  engine,
+		state:   state,
+		history: make(map[string][]float64),
+		maxLen:  defaultTermWidth * 4,
+	}
+}
+
+// sample adds the current values of the trends to their history.
+func (dc *dashboardCollector) sample() {
+	dc.engine.MetricsLock.Lock()
+	defer dc.engine.MetricsLock.Unlock()
+	for _, trend := range dashboardTrends {
+		m, ok := dc.engine.Metrics[trend.Name]
+		if !ok {
+			continue
+		}
+		sink, ok := m.Sink.(interface{ P(float64) float64 })
+		if !ok {
+			continue
+		}
+		history := append(dc.history[trend.Name], sink.P(dashboardPercentile))
+		if len(history) > dc.maxLen {
+			history = history[len(history)-dc.maxLen:]
+		}
+		dc.history[trend.Name] = history
+	}
+}
+
+// collect returns the current state of the test run for the dashboard.
+func (dc *dashboardCollector) collect() ui.Dashboard {
+	d := ui.Dashboard{
+		Elapsed:    dc.state.GetCurrentTestRunDuration(),
+		ActiveVUs:  dc.state.GetCurrentlyActiveVUsCount(),
+		MaxVUs:     dc.state.GetInitializedVUsCount(),
+		Iterations: dc.state.GetFullIterationCount(),
+	}
+
+	dc.engine.MetricsLock.Lock()
+	defer dc.engine.MetricsLock.Unlock()
+	for _, trend := range dashboardTrends {
+		history := dc.history[trend.Name]
+		m, ok := dc.engine.Metrics[trend.Name]
+		if !ok || len(history) == 0 {
+			continue
+		}
+		d.Trends = append(d.Trends, ui.DashboardTrend{
+			Metric:     trend.Name,
+			Percentile: "p(95)",
+			History:    history,
+			Value:      m.HumanizeValue(history[len(history)-1], ""),
+		})
+	}
+
+	if m, ok := dc.engine.Metrics[metrics.HTTPReqFailed.Name]; ok {
+		if sink, ok := m.Sink.(*stats.RateSink); ok && sink.Total > 0 {
+			d.ErrorRates = append(d.ErrorRates, ui.DashboardRate{
+				Name: "failed requests", Rate: float64(sink.Trues) / float64(sink.Total), Total: sink.Total,
+			})
+		}
+	}
+	if m, ok := dc.engine.Metrics[metrics.Checks.Name]; ok {
+		if sink, ok := m.Sink.(*stats.RateSink); ok && sink.Total > 0 {
+			d.ErrorRates = append(d.ErrorRates, ui.DashboardRate{
+				Name: "failed checks", Rate: float64(sink.Total-sink.Trues) / float64(sink.Total), Total: sink.Total,
+			})
+		}
+	}
+
+	for name, m := range dc.engine.Metrics {
+		for _, th := range m.Thresholds.Thresholds {
+			d.Thresholds = append(d.Thresholds, ui.DashboardThreshold{
+				Metric: name, Source: th.Source, Failed: th.LastFailed,
+			})
+		}
+	}
+	sort.SliceStable(d.Thresholds, func(i, j int) bool {
+		return d.Thresholds[i].Metric < d.Thresholds[j].Metric
+	})
+	return d
+}
+
+// showDashboard is like showProgress, but it also shows the trends, the error
+// rates and the state of the thresholds under the progress bars. It's only
+// used in interactive terminals.
+func showDashboard( //nolint:funlen
+	ctx context.Context, pbs []*pb.ProgressBar, engine *core.Engine, logger *logrus.Logger,
+) {
+	if quiet {
+		return
+	}
+
+	fd := int(os.Stdout.Fd())
+	termWidth := defaultTermWidth
+	if tw, _, err := terminal.GetSize(fd); tw > 0 && err == nil {
+		termWidth = tw
+	} else {
+		logger.WithError(err).Warn("error getting terminal size")
+	}
+
+	var leftLen int64
+	for _, pb := range pbs {
+		leftLen = lib.Max(int64(len(pb.Left())), leftLen)
+	}
+	maxLeft := int(lib.Min(leftLen, maxLeftLength))
+
+	collector := newDashboardCollector(engine, engine.ExecutionScheduler.GetState())
+	var (
+		lastRenderLock sync.Mutex
+		lastRender     []byte
+		widthDelta     int
+	)
+	render := func(goBack bool) {
+		bars, longestLine := renderMultipleBars(true, false, maxLeft, termWidth, widthDelta, pbs)
+		widthDelta = termWidth - longestLine - termPadding
+
+		lines := collector.collect().Render(termWidth-termPadding, noColor)
+		text := bars + strings.Join(lines, "\x1b[0K\n") + "\x1b[0K\n"
+		if goBack {
+			// Clear the rest of the screen and go back to the first line
+			text += fmt.Sprintf("\r\x1b[J\x1b[%dA", strings.Count(bars, "\n")+len(lines))
+		}
+		lastRenderLock.Lock()
+		lastRender = []byte(text)
+		lastRenderLock.Unlock()
+	}
+	printDashboard := func() {
+		lastRenderLock.Lock()
+		_, _ = stdout.Writer.Write(lastRender)
+		lastRenderLock.Unlock()
+	}
+
+	outMutex.Lock()
+	stdout.PersistentText = printDashboard
+	stderr.PersistentText = printDashboard
+	outMutex.Unlock()
+	defer func() {
+		outMutex.Lock()
+		stdout.PersistentText = nil
+		stderr.PersistentText = nil
+		outMutex.Unlock()
+	}()
+
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	sampleTicker := time.NewTicker(dashboardSampleInterval)
+	defer sampleTicker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			collector.sample()
+			render(false)
+			outMutex.Lock()
+			printDashboard()
+			outMutex.Unlock()
+			return
+		case <-sampleTicker.C:
+			collector.sample()
+		case <-ticker.C:
+			if tw, _, err := terminal.GetSize(fd); tw > 0 && err == nil {
+				termWidth = tw
+			}
+		}
+		render(true)
+		outMutex.Lock()
+		printDashboard()
+		outMutex.Unlock()
+	}
+}
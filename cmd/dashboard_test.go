@@ -0,0 +1,90 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/core"
+	"github.com/loadimpact/k6/core/local"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/lib/testutils/minirunner"
+	"github.com/loadimpact/k6/stats"
+	"github.com/loadimpact/k6/ui"
+)
+
+func TestDashboardCollector(t *testing.T) {
+	t.Parallel()
+	logger := logrus.New()
+	logger.SetOutput(testutils.NewTestOutput(t))
+	execScheduler, err := local.NewExecutionScheduler(&minirunner.MiniRunner{}, logger)
+	require.NoError(t, err)
+	engine, err := core.NewEngine(execScheduler, lib.Options{}, lib.RuntimeOptions{}, nil, logger)
+	require.NoError(t, err)
+
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	duration.Thresholds, err = stats.NewThresholds([]string{"p(95)<500"})
+	require.NoError(t, err)
+	failed := stats.New("http_req_failed", stats.Rate)
+	checks := stats.New("checks", stats.Rate)
+	checks.Thresholds, err = stats.NewThresholds([]string{"rate>0.99"})
+	require.NoError(t, err)
+	checks.Thresholds.Thresholds[0].LastFailed = true
+	engine.Metrics = map[string]*stats.Metric{
+		duration.Name: duration, failed.Name: failed, checks.Name: checks,
+	}
+	add := func(m *stats.Metric, values ...float64) {
+		for _, v := range values {
+			m.Sink.Add(stats.Sample{Metric: m, Time: time.Now(), Value: v})
+		}
+	}
+	add(duration, 100, 200, 300)
+	add(failed, 1, 0, 0, 0)
+	add(checks, 1, 1, 1, 0)
+
+	collector := newDashboardCollector(engine, execScheduler.GetState())
+	d := collector.collect()
+	assert.Empty(t, d.Trends, "there is no history before the first sample")
+
+	collector.sample()
+	add(duration, 1000, 1000, 1000)
+	collector.sample()
+	d = collector.collect()
+
+	require.Len(t, d.Trends, 1)
+	assert.Equal(t, "http_req_duration", d.Trends[0].Metric)
+	assert.Equal(t, []float64{290, 1000}, d.Trends[0].History)
+	assert.Equal(t, "1s", d.Trends[0].Value)
+	assert.Equal(t, []ui.DashboardRate{
+		{Name: "failed requests", Rate: 0.25, Total: 4},
+		{Name: "failed checks", Rate: 0.25, Total: 4},
+	}, d.ErrorRates)
+	assert.Equal(t, []ui.DashboardThreshold{
+		{Metric: "checks", Source: "rate>0.99", Failed: true},
+		{Metric: "http_req_duration", Source: "p(95)<500"},
+	}, d.Thresholds)
+}
@@ -0,0 +1,188 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/loadimpact/k6/lib/envfile"
+	"github.com/loadimpact/k6/lib/secrets"
+)
+
+const envFileKeyTimeout = 30 * time.Second
+
+// getEnvFileKey returns the key for encrypted env files. It's either given
+// directly in K6_ENV_FILE_KEY, as a data key encrypted with AWS KMS when
+// prefixed with "awskms:", or it's fetched from the configured secret sources
+// when K6_ENV_FILE_KEY_SECRET has the name of the secret.
+func getEnvFileKey(environment map[string]string, secretSources []string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), envFileKeyTimeout)
+	defer cancel()
+
+	if name, ok := environment["K6_ENV_FILE_KEY_SECRET"]; ok {
+		if len(secretSources) == 0 {
+			return nil, fmt.Errorf("K6_ENV_FILE_KEY_SECRET requires at least one --secret-source")
+		}
+		manager, err := secrets.NewManagerFromConfig(secretSources)
+		if err != nil {
+			return nil, err
+		}
+		value, err := manager.Get(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+		return envfile.ParseKey(value)
+	}
+
+	value, ok := environment["K6_ENV_FILE_KEY"]
+	if !ok {
+		return nil, fmt.Errorf("encrypted env files require the K6_ENV_FILE_KEY or K6_ENV_FILE_KEY_SECRET " +
+			"environment variable")
+	}
+	if !strings.HasPrefix(value, "awskms:") {
+		return envfile.ParseKey(value)
+	}
+
+	blob, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, "awskms:"))
+	if err != nil {
+		return nil, fmt.Errorf("the AWS KMS ciphertext blob in K6_ENV_FILE_KEY isn't valid base64: %w", err)
+	}
+	key, err := secrets.DecryptAWSKMS(ctx, blob)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != envfile.KeySize {
+		return nil, fmt.Errorf("the AWS KMS data key should be %d bytes long, but is %d", envfile.KeySize, len(key))
+	}
+	return key, nil
+}
+
+// readEnvFile reads and parses an env file, decrypting it first if needed.
+// The values from encrypted files are redacted from the logs.
+func readEnvFile(path string, environment map[string]string, secretSources []string) (map[string]string, error) {
+	data, err := ioutil.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, err
+	}
+	encrypted := envfile.IsEncrypted(data)
+	if encrypted {
+		key, err := getEnvFileKey(environment, secretSources)
+		if err != nil {
+			return nil, err
+		}
+		if data, err = envfile.Decrypt(data, key); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	env, err := envfile.Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if encrypted {
+		for _, value := range env {
+			secrets.AddRedacted(value)
+		}
+	}
+	return env, nil
+}
+
+func getEnvFileCmd() *cobra.Command {
+	envFileCmd := &cobra.Command{
+		Use:   "env-file",
+		Short: "Manage encrypted env files",
+		Long: `Manage encrypted env files.
+
+Env files contain one NAME=value per line and are loaded with --env-file. They
+can be encrypted, so they can be stored alongside the scripts. The key is read
+from the K6_ENV_FILE_KEY environment variable (base64, or "awskms:" followed by
+a data key encrypted with AWS KMS), or from the secret sources configured with
+--secret-source when K6_ENV_FILE_KEY_SECRET is set to the secret name.
+
+The values of env files are never saved in archives, so they aren't sent to the
+cloud or to distributed agents either, and --env-file has to be given again when
+running an archive.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Usage()
+		},
+	}
+
+	keygenCmd := &cobra.Command{
+		Use:   "keygen",
+		Short: "Generate a new key for encrypting env files",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			key, err := envfile.GenerateKey()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintln(cmd.OutOrStdout(), key)
+			return err
+		},
+	}
+
+	var output string
+	var secretSources []string
+	encryptCmd := &cobra.Command{
+		Use:   "encrypt [file]",
+		Short: "Encrypt an env file",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			if envfile.IsEncrypted(data) {
+				return fmt.Errorf("%s is already encrypted", args[0])
+			}
+			if _, err = envfile.Parse(data); err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			key, err := getEnvFileKey(buildEnvMap(os.Environ()), secretSources)
+			if err != nil {
+				return err
+			}
+			encrypted, err := envfile.Encrypt(data, key)
+			if err != nil {
+				return err
+			}
+			if output == "" {
+				_, err = cmd.OutOrStdout().Write(encrypted)
+				return err
+			}
+			return ioutil.WriteFile(output, encrypted, 0o600)
+		},
+	}
+	encryptCmd.Flags().StringVarP(&output, "output", "o", "", "write the encrypted file to `path` instead of stdout")
+	encryptCmd.Flags().StringArrayVar(&secretSources, "secret-source", nil,
+		"resolve K6_ENV_FILE_KEY_SECRET from `type=arg`, where type is one of env, file, vault, aws or gcp")
+
+	envFileCmd.AddCommand(keygenCmd, encryptCmd)
+	return envFileCmd
+}
@@ -61,6 +61,7 @@ func getInspectCmd(logger logrus.FieldLogger) *cobra.Command {
 			if err != nil {
 				return err
 			}
+			enableFIPSMode(runtimeOptions)
 
 			var (
 				opts lib.Options
@@ -117,6 +117,9 @@ This will set the default token used when just "k6 run -o cloud" is passed.`,
 				password := vals["Password"].(string)
 
 				client := cloudapi.NewClient(logger, "", consolidatedCurrentConfig.Host.String, consts.Version)
+				if err = client.ConfigureTransport(consolidatedCurrentConfig); err != nil {
+					return err
+				}
 				res, err := client.Login(email, password)
 				if err != nil {
 					return err
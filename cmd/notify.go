@@ -0,0 +1,170 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/notify"
+)
+
+// notificationTimeout is how long all of the notifications together can take
+// to be sent at the end of the test.
+const notificationTimeout = 30 * time.Second
+
+func getNotifiers(fs afero.Fs, opts lib.RuntimeOptions) ([]*notify.Notifier, error) {
+	if len(opts.Notify) == 0 {
+		return nil, nil
+	}
+	var tmpl string
+	if opts.NotifyTemplate.String != "" {
+		data, err := afero.ReadFile(fs, opts.NotifyTemplate.String)
+		if err != nil {
+			return nil, err
+		}
+		tmpl = string(data)
+	}
+
+	notifiers := make([]*notify.Notifier, 0, len(opts.Notify))
+	for _, target := range opts.Notify {
+		n, err := notify.New(target, tmpl)
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
+
+func getThresholdNotifiers(opts lib.RuntimeOptions) ([]*notify.Notifier, error) {
+	notifiers := make([]*notify.Notifier, 0, len(opts.NotifyThresholds))
+	for _, target := range opts.NotifyThresholds {
+		n, err := notify.New(target, "")
+		if err != nil {
+			return nil, err
+		}
+		notifiers = append(notifiers, n)
+	}
+	return notifiers, nil
+}
+
+// sendNotifications posts the summary to all notifiers. Failures are only
+// logged, they don't affect the result of the test.
+func sendNotifications(logger logrus.FieldLogger, notifiers []*notify.Notifier, summary notify.Summary) {
+	ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+	defer cancel()
+	for _, n := range notifiers {
+		if err := n.Send(ctx, summary); err != nil {
+			logger.WithError(err).Warn("Failed to send the end-of-test notification")
+			continue
+		}
+		logger.WithField("kind", n.Kind).Debug("Sent the end-of-test notification")
+	}
+}
+
+// thresholdEventQueueSize is how many threshold events can wait to be sent,
+// before any new ones are dropped.
+const thresholdEventQueueSize = 100
+
+// thresholdNotifications posts the threshold events of the engine to the
+// notifiers in the background, so slow targets don't block the engine.
+type thresholdNotifications struct {
+	logger    logrus.FieldLogger
+	notifiers []*notify.Notifier
+	test      string
+
+	events chan lib.ThresholdEvent
+	mu     sync.Mutex
+	closed bool
+	done   chan struct{}
+}
+
+func startThresholdNotifications(
+	logger logrus.FieldLogger, notifiers []*notify.Notifier, test string,
+) *thresholdNotifications {
+	tn := &thresholdNotifications{
+		logger:    logger,
+		notifiers: notifiers,
+		test:      test,
+		events:    make(chan lib.ThresholdEvent, thresholdEventQueueSize),
+		done:      make(chan struct{}),
+	}
+	go tn.run()
+	return tn
+}
+
+// add queues the event to be sent, it's meant to be used as an engine hook.
+func (tn *thresholdNotifications) add(event lib.ThresholdEvent) {
+	tn.mu.Lock()
+	defer tn.mu.Unlock()
+	if tn.closed {
+		return
+	}
+	select {
+	case tn.events <- event:
+	default:
+		tn.logger.WithField("threshold", event.Threshold).Warn("Too many threshold events, dropping a notification")
+	}
+}
+
+func (tn *thresholdNotifications) run() {
+	defer close(tn.done)
+	for event := range tn.events {
+		ctx, cancel := context.WithTimeout(context.Background(), notificationTimeout)
+		for _, n := range tn.notifiers {
+			if err := n.SendThresholdEvent(ctx, tn.test, event); err != nil {
+				tn.logger.WithError(err).Warn("Failed to send the threshold notification")
+				continue
+			}
+			tn.logger.WithField("kind", n.Kind).Debugf("Sent the threshold %s notification", event.Type)
+		}
+		cancel()
+	}
+}
+
+// stop waits for the already queued events to be sent, but not for longer
+// than it takes to send the end-of-test notifications.
+func (tn *thresholdNotifications) stop() {
+	tn.mu.Lock()
+	tn.closed = true
+	close(tn.events)
+	tn.mu.Unlock()
+
+	select {
+	case <-tn.done:
+	case <-time.After(notificationTimeout):
+		tn.logger.Warn("Timed out sending the threshold notifications")
+	}
+}
+
+func notificationTestName(filename string) string {
+	if filename == "-" {
+		return "stdin"
+	}
+	return filepath.Base(filename)
+}
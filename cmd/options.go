@@ -58,6 +58,9 @@ func optionFlagSet() *pflag.FlagSet {
 	flags.BoolP("paused", "p", false, "start the test in a paused state")
 	flags.Bool("no-setup", false, "don't run setup()")
 	flags.Bool("no-teardown", false, "don't run teardown()")
+	flags.Bool("lazy-setup-data", false, "pass a handle to the setup() data to VUs, instead of a copy of all of it")
+	flags.Int64("seed", 0, "seed Math.random and the simulated network conditions, to reproduce a run")
+	flags.Duration("teardown-timeout", 60*time.Second, "maximum time teardown() can run for, even when the test was aborted")
 	flags.Int64("max-redirects", 10, "follow at most n redirects")
 	flags.Int64("batch", 20, "max parallel batch reqs")
 	flags.Int64("batch-per-host", 6, "max parallel batch reqs per host")
@@ -69,10 +72,14 @@ func optionFlagSet() *pflag.FlagSet {
 	flags.Bool("no-connection-reuse", false, "disable keep-alive connections")
 	flags.Bool("no-vu-connection-reuse", false, "don't reuse connections between iterations")
 	flags.Duration("min-iteration-duration", 0, "minimum amount of time k6 will take executing a single iteration")
+	flags.Duration("discard-metrics-for", 0, "discard the metric samples emitted during the first `duration` of the test, e.g. 30s")
 	flags.BoolP("throw", "w", false, "throw warnings (like failed http requests) as errors")
 	flags.StringSlice("blacklist-ip", nil, "blacklist an `ip range` from being called")
 	flags.StringSlice("block-hostnames", nil, "block a case-insensitive hostname `pattern`,"+
 		" with optional leading wildcard, from being called")
+	flags.String("socks-proxy", "", "tunnel all connections through the SOCKS5 proxy at `url`, e.g. socks5h://localhost:1080")
+	flags.String("url-grouping", "", "group the URLs of unnamed requests in the `name` tag, either 'true' to replace"+
+		" ID-like segments or a list of patterns like '/users/{id}'")
 
 	// The comment about system-tags also applies for summary-trend-stats. The default values
 	// are set in applyDefault().
@@ -110,6 +117,9 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		Paused:                getNullBool(flags, "paused"),
 		NoSetup:               getNullBool(flags, "no-setup"),
 		NoTeardown:            getNullBool(flags, "no-teardown"),
+		TeardownTimeout:       getNullDuration(flags, "teardown-timeout"),
+		LazySetupData:         getNullBool(flags, "lazy-setup-data"),
+		Seed:                  getNullInt64(flags, "seed"),
 		MaxRedirects:          getNullInt64(flags, "max-redirects"),
 		Batch:                 getNullInt64(flags, "batch"),
 		BatchPerHost:          getNullInt64(flags, "batch-per-host"),
@@ -118,16 +128,18 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		HTTPDebug:             getNullString(flags, "http-debug"),
 		InsecureSkipTLSVerify: getNullBool(flags, "insecure-skip-tls-verify"),
 		NoConnectionReuse:     getNullBool(flags, "no-connection-reuse"),
+		SOCKSProxy:            getNullString(flags, "socks-proxy"),
 		NoVUConnectionReuse:   getNullBool(flags, "no-vu-connection-reuse"),
 		MinIterationDuration:  getNullDuration(flags, "min-iteration-duration"),
+		DiscardMetricsFor:     getNullDuration(flags, "discard-metrics-for"),
 		Throw:                 getNullBool(flags, "throw"),
 		DiscardResponseBodies: getNullBool(flags, "discard-response-bodies"),
 		// Default values for options without CLI flags:
 		// TODO: find a saner and more dev-friendly and error-proof way to handle options
-		SetupTimeout:    types.NullDuration{Duration: types.Duration(60 * time.Second), Valid: false},
-		TeardownTimeout: types.NullDuration{Duration: types.Duration(60 * time.Second), Valid: false},
+		SetupTimeout: types.NullDuration{Duration: types.Duration(60 * time.Second), Valid: false},
 
-		MetricSamplesBufferSize: null.NewInt(1000, false),
+		MetricSamplesBufferSize:  null.NewInt(1000, false),
+		MetricsProcessingWorkers: null.NewInt(1, false),
 	}
 
 	// Using Changed() because GetStringSlice() doesn't differentiate between empty and no value
@@ -206,6 +218,16 @@ func getOptions(flags *pflag.FlagSet) (lib.Options, error) {
 		}
 	}
 
+	if flags.Changed("url-grouping") {
+		urlGrouping, err := flags.GetString("url-grouping")
+		if err != nil {
+			return opts, err
+		}
+		if err = opts.URLGrouping.UnmarshalText([]byte(urlGrouping)); err != nil {
+			return opts, err
+		}
+	}
+
 	localIpsString, err := flags.GetString("local-ips")
 	if err != nil {
 		return opts, err
@@ -32,8 +32,14 @@ import (
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/loader"
 	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/output/azuredevops"
+	"github.com/loadimpact/k6/output/clickhouse"
 	"github.com/loadimpact/k6/output/cloud"
 	"github.com/loadimpact/k6/output/json"
+	"github.com/loadimpact/k6/output/otlp"
+	"github.com/loadimpact/k6/output/plugin"
+	"github.com/loadimpact/k6/output/report"
+	"github.com/loadimpact/k6/output/teamcity"
 	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/stats/csv"
 	"github.com/loadimpact/k6/stats/datadog"
@@ -47,8 +53,14 @@ import (
 func getAllOutputConstructors() (map[string]func(output.Params) (output.Output, error), error) {
 	// Start with the built-in outputs
 	result := map[string]func(output.Params) (output.Output, error){
-		"json":  json.New,
-		"cloud": cloud.New,
+		"json":        json.New,
+		"cloud":       cloud.New,
+		"report":      report.New,
+		"teamcity":    teamcity.New,
+		"azuredevops": azuredevops.New,
+		"otlp":        otlp.New,
+		"clickhouse":  clickhouse.New,
+		"plugin":      plugin.New,
 
 		// TODO: remove all of these
 		"influxdb": func(params output.Params) (output.Output, error) {
@@ -164,11 +176,16 @@ func createOutputs(
 		params.ConfigArgument = outputArg
 		params.JSONConfig = conf.Collectors[outputType]
 
-		output, err := outputConstructor(params)
+		out, err := outputConstructor(params)
 		if err != nil {
 			return nil, fmt.Errorf("could not create the '%s' output: %w", outputType, err)
 		}
-		result = append(result, output)
+		if filterConf, ok := conf.OutputFilters[outputType]; ok {
+			if out, err = output.WithFilter(out, filterConf); err != nil {
+				return nil, fmt.Errorf("invalid output filter for the '%s' output: %w", outputType, err)
+			}
+		}
+		result = append(result, out)
 	}
 
 	return result, nil
@@ -0,0 +1,241 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/spf13/cobra"
+
+	"github.com/loadimpact/k6/lib/history"
+)
+
+const (
+	defaultResultsDBFileName = "history.jsonl"
+	trendBarWidth            = 40
+
+	resultPassMark = "✓"
+	resultFailMark = "✗"
+)
+
+// sparkline returns the values as a line of block characters, scaled between
+// their minimum and maximum.
+func sparkline(values []float64) string {
+	const ticks = "▁▂▃▄▅▆▇█"
+	levels := []rune(ticks)
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		min, max = math.Min(min, v), math.Max(max, v)
+	}
+	var sb strings.Builder
+	for _, v := range values {
+		level := 0
+		if max > min {
+			level = int((v - min) / (max - min) * float64(len(levels)-1))
+		}
+		sb.WriteRune(levels[level])
+	}
+	return sb.String()
+}
+
+func printTrend(w io.Writer, runs []*history.Run, metric, stat string) {
+	var (
+		times  []time.Time
+		values []float64
+		passed []bool
+	)
+	for _, run := range runs {
+		metricValues, ok := run.Metrics[metric]
+		if !ok {
+			continue
+		}
+		s := stat
+		if s == "" {
+			s = history.DefaultStat(metricValues)
+		}
+		v, ok := metricValues[s]
+		if !ok {
+			continue
+		}
+		stat = s
+		times, values, passed = append(times, run.Time), append(values, v), append(passed, run.Passed)
+	}
+	if len(values) == 0 {
+		_, _ = fmt.Fprintf(w, "%s: no data\n\n", metric)
+		return
+	}
+
+	max := 0.0
+	for _, v := range values {
+		max = math.Max(max, math.Abs(v))
+	}
+	_, _ = fmt.Fprintf(w, "%s %s  %s\n", metric, stat, sparkline(values))
+	for i, v := range values {
+		mark := resultPassMark
+		if !passed[i] {
+			mark = resultFailMark
+		}
+		change := ""
+		if i > 0 && values[i-1] != 0 {
+			change = fmt.Sprintf("%+.1f%%", (v-values[i-1])/math.Abs(values[i-1])*100)
+		}
+		bar := 0
+		if max > 0 {
+			bar = int(math.Round(math.Abs(v) / max * trendBarWidth))
+		}
+		_, _ = fmt.Fprintf(w, "  %s %s %12.3f %8s %s\n",
+			mark, times[i].Local().Format("2006-01-02 15:04"), v, change, strings.Repeat("█", bar))
+	}
+	_, _ = fmt.Fprintln(w)
+}
+
+//nolint:funlen
+func getResultsCmd() *cobra.Command {
+	fs := afero.NewOsFs()
+	dbPath := os.Getenv("K6_RESULTS_DB")
+	if dbPath == "" {
+		dbPath = filepath.Join(filepath.Dir(defaultConfigFilePath), defaultResultsDBFileName)
+	}
+
+	resultsCmd := &cobra.Command{
+		Use:   "results",
+		Short: "Keep a local history of test results",
+		Long: `Keep a local history of test results.
+
+The end-of-test summaries exported with --summary-export are saved in a local
+database, so the trends of their metrics can be followed across the last runs
+of each test, without any external infrastructure.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return cmd.Usage()
+		},
+	}
+	resultsCmd.PersistentFlags().StringVar(&dbPath, "db", dbPath,
+		"the history database `file`, can also be set with K6_RESULTS_DB")
+
+	var test string
+	var runTime string
+	saveCmd := &cobra.Command{
+		Use:   "save [summary-export.json]",
+		Short: "Save the summary of a test run to the history",
+		Example: `
+  k6 run --summary-export=summary.json script.js
+  k6 results save --test checkout summary.json`[1:],
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			data, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				return err
+			}
+			t := time.Now()
+			if runTime != "" {
+				if t, err = time.Parse(time.RFC3339, runTime); err != nil {
+					return fmt.Errorf("invalid run time: %w", err)
+				}
+			}
+			run, err := history.FromSummaryExport(test, t, data)
+			if err != nil {
+				return fmt.Errorf("%s: %w", args[0], err)
+			}
+			return history.Open(fs, dbPath).Add(run)
+		},
+	}
+	saveCmd.Flags().StringVar(&test, "test", "default", "the `name` of the test the run is of")
+	saveCmd.Flags().StringVar(&runTime, "time", "", "the `time` of the run in RFC 3339 format, now by default")
+
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the tests in the history",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			tests, err := history.Open(fs, dbPath).Tests()
+			if err != nil {
+				return err
+			}
+			w := cmd.OutOrStdout()
+			for _, info := range tests {
+				mark := resultPassMark
+				if !info.LastRun.Passed {
+					mark = resultFailMark
+				}
+				_, _ = fmt.Fprintf(w, "%s %s: %d runs, last on %s\n",
+					mark, info.Name, info.Runs, info.LastRun.Time.Local().Format("2006-01-02 15:04"))
+			}
+			return nil
+		},
+	}
+
+	var last int
+	var stat string
+	trendCmd := &cobra.Command{
+		Use:   "trend [metric...]",
+		Short: "Show the trends of metrics across the last runs of a test",
+		Long: `Show the trends of metrics across the last runs of a test.
+
+Without metrics, the trends of all metrics of the test are shown. Each metric
+is shown with its p(95), avg, value, rate or count, the first one it has,
+unless --stat is given.`,
+		Example: `
+  k6 results trend --test checkout --last 20 http_req_duration
+  k6 results trend --test checkout --stat "p(99)" http_req_duration`[1:],
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := history.Open(fs, dbPath).Runs(test, last)
+			if err != nil {
+				return err
+			}
+			if len(runs) == 0 {
+				return fmt.Errorf("there are no runs of the test %q", test)
+			}
+
+			metrics := args
+			if len(metrics) == 0 {
+				seen := make(map[string]bool)
+				for _, run := range runs {
+					for name := range run.Metrics {
+						if !seen[name] {
+							seen[name] = true
+							metrics = append(metrics, name)
+						}
+					}
+				}
+				sort.Strings(metrics)
+			}
+			for _, metric := range metrics {
+				printTrend(cmd.OutOrStdout(), runs, metric, stat)
+			}
+			return nil
+		},
+	}
+	trendCmd.Flags().StringVar(&test, "test", "default", "the `name` of the test")
+	trendCmd.Flags().IntVar(&last, "last", 10, "show only the last `n` runs, or all of them with 0")
+	trendCmd.Flags().StringVar(&stat, "stat", "", "the metric `value` to show, e.g. p(99) or max")
+
+	resultsCmd.AddCommand(saveCmd, listCmd, trendCmd)
+	return resultsCmd
+}
@@ -0,0 +1,63 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/loadimpact/k6/lib/history"
+)
+
+func TestSparkline(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "▁▄█", sparkline([]float64{1, 2, 3}))
+	assert.Equal(t, "▁▁", sparkline([]float64{5, 5}))
+}
+
+func TestPrintTrend(t *testing.T) {
+	t.Parallel()
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local)
+	runs := []*history.Run{
+		{Time: start, Passed: true, Metrics: map[string]map[string]float64{
+			"http_req_duration": {"avg": 80, "p(95)": 100},
+		}},
+		{Time: start.Add(time.Hour), Passed: false, Metrics: map[string]map[string]float64{
+			"http_req_duration": {"avg": 100, "p(95)": 150},
+		}},
+		{Time: start.Add(2 * time.Hour), Passed: true},
+	}
+
+	buf := &bytes.Buffer{}
+	printTrend(buf, runs, "http_req_duration", "")
+	lines := strings.Split(buf.String(), "\n")
+	assert.Equal(t, "http_req_duration p(95)  ▁█", lines[0])
+	assert.Contains(t, lines[1], "✓ 2021-01-01 00:00      100.000          ")
+	assert.Contains(t, lines[2], "✗ 2021-01-01 01:00      150.000   +50.0% "+strings.Repeat("█", 40))
+
+	buf.Reset()
+	printTrend(buf, runs, "vus", "")
+	assert.Equal(t, "vus: no data\n\n", buf.String())
+}
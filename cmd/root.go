@@ -40,6 +40,7 @@ import (
 	"github.com/spf13/pflag"
 
 	"github.com/loadimpact/k6/lib/consts"
+	"github.com/loadimpact/k6/lib/secrets"
 	"github.com/loadimpact/k6/log"
 )
 
@@ -181,13 +182,17 @@ func Execute() {
 	loginCmd := getLoginCmd()
 	loginCmd.AddCommand(getLoginCloudCommand(logger), getLoginInfluxDBCommand(logger))
 	c.cmd.AddCommand(
+		getAgentCmd(ctx, logger),
 		getArchiveCmd(logger),
 		getCloudCmd(ctx, logger),
 		getConvertCmd(),
+		getCoordinatorCmd(ctx, logger),
+		getEnvFileCmd(),
 		getInspectCmd(logger),
 		loginCmd,
 		getPauseCmd(ctx),
 		getResumeCmd(ctx),
+		getResultsCmd(),
 		getScaleCmd(ctx),
 		getRunCmd(ctx, logger),
 		getStatsCmd(ctx),
@@ -273,6 +278,9 @@ func (c *rootCommand) setupLoggers() (<-chan struct{}, error) {
 	ch := make(chan struct{})
 	close(ch)
 
+	// Redact the values of resolved secrets before any other hook sees them
+	c.logger.AddHook(secrets.RedactionHook{})
+
 	if c.verbose {
 		c.logger.SetLevel(logrus.DebugLevel)
 	}
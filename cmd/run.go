@@ -40,6 +40,7 @@ import (
 	"github.com/spf13/afero"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/api"
 	"github.com/loadimpact/k6/core"
@@ -47,6 +48,9 @@ import (
 	"github.com/loadimpact/k6/js"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/consts"
+	"github.com/loadimpact/k6/lib/notify"
+	"github.com/loadimpact/k6/lib/redact"
+	"github.com/loadimpact/k6/lib/slo"
 	"github.com/loadimpact/k6/loader"
 	"github.com/loadimpact/k6/ui/pb"
 )
@@ -63,6 +67,8 @@ const (
 	invalidConfigErrorCode       = 104
 	externalAbortErrorCode       = 105
 	cannotStartRESTAPIErrorCode  = 106
+	outputAbortErrorCode         = 107
+	teardownErrorCode            = 108
 )
 
 // TODO: fix this, global variables are not very testable...
@@ -121,6 +127,15 @@ a commandline interface for interacting with it.`,
 			if err != nil {
 				return err
 			}
+			enableFIPSMode(runtimeOptions)
+			notifiers, err := getNotifiers(afero.NewOsFs(), runtimeOptions)
+			if err != nil {
+				return err
+			}
+			thresholdNotifiers, err := getThresholdNotifiers(runtimeOptions)
+			if err != nil {
+				return err
+			}
 
 			initRunner, err := newRunner(logger, src, runType, filesystems, runtimeOptions)
 			if err != nil {
@@ -143,11 +158,55 @@ a commandline interface for interacting with it.`,
 				return ExitCode{error: cerr, Code: invalidConfigErrorCode}
 			}
 
+			// The service level objectives are checked by thresholds during
+			// the test run, and reported in the summary after it.
+			var slos *slo.Config
+			if runtimeOptions.SLO.Valid {
+				data, rerr := afero.ReadFile(afero.NewOsFs(), runtimeOptions.SLO.String)
+				if rerr != nil {
+					return rerr
+				}
+				if slos, err = slo.Load(data); err != nil {
+					return ExitCode{error: err, Code: invalidConfigErrorCode}
+				}
+				if conf.Thresholds, err = slos.AddThresholds(conf.Thresholds); err != nil {
+					return ExitCode{error: err, Code: invalidConfigErrorCode}
+				}
+			}
+
+			// Only the work that was left is done when resuming a test run,
+			// with the setup() data of the earlier one.
+			var checkpoint *lib.Checkpoint
+			if runtimeOptions.Resume.Valid {
+				checkpoint, err = lib.LoadCheckpoint(afero.NewOsFs(), runtimeOptions.Resume.String)
+				if err != nil {
+					return err
+				}
+				if conf.Scenarios, err = checkpoint.ResumeScenarios(conf.Scenarios); err != nil {
+					return ExitCode{error: err, Code: invalidConfigErrorCode}
+				}
+				if conf.Options, err = checkpoint.ResumeExecutionSegment(conf.Options); err != nil {
+					return ExitCode{error: err, Code: invalidConfigErrorCode}
+				}
+				if checkpoint.SetupData != nil {
+					conf.NoSetup = null.BoolFrom(true)
+					initRunner.SetSetupData(checkpoint.SetupData)
+				}
+			}
+
 			// Write options back to the runner too.
 			if err = initRunner.SetOptions(conf.Options); err != nil {
 				return err
 			}
 
+			if conf.Redact != nil {
+				redactor, rerr := redact.New(*conf.Redact)
+				if rerr != nil {
+					return rerr
+				}
+				logger.AddHook(redactor)
+			}
+
 			// We prepare a bunch of contexts:
 			//  - The runCtx is cancelled as soon as the Engine's run() lambda finishes,
 			//    and can trigger things like the usage report and end of test summary.
@@ -179,16 +238,23 @@ a commandline interface for interacting with it.`,
 			progressCtx, progressCancel := context.WithCancel(globalCtx)
 			defer progressCancel()
 			initBar := execScheduler.GetInitProgressBar()
+			pbs := []*pb.ProgressBar{execScheduler.GetInitProgressBar()}
+			for _, s := range execScheduler.GetExecutors() {
+				pbs = append(pbs, s.GetProgress())
+			}
 			progressBarWG := &sync.WaitGroup{}
 			progressBarWG.Add(1)
-			go func() {
-				pbs := []*pb.ProgressBar{execScheduler.GetInitProgressBar()}
-				for _, s := range execScheduler.GetExecutors() {
-					pbs = append(pbs, s.GetProgress())
-				}
-				showProgress(progressCtx, conf, pbs, logger)
-				progressBarWG.Done()
-			}()
+			// The dashboard needs the engine, so it's started once there is one
+			if dashboardMode && !stdoutTTY {
+				logger.Warn("The dashboard needs an interactive terminal, showing the progress bars instead")
+				dashboardMode = false
+			}
+			if !dashboardMode {
+				go func() {
+					showProgress(progressCtx, conf, pbs, logger)
+					progressBarWG.Done()
+				}()
+			}
 
 			// Create all outputs.
 			executionPlan := execScheduler.GetExecutionPlan()
@@ -203,6 +269,24 @@ a commandline interface for interacting with it.`,
 			if err != nil {
 				return err
 			}
+			if checkpoint != nil {
+				if err = engine.Resume(checkpoint); err != nil {
+					return err
+				}
+			}
+			if dashboardMode {
+				go func() {
+					showDashboard(progressCtx, pbs, engine, logger)
+					progressBarWG.Done()
+				}()
+			}
+			if len(thresholdNotifiers) > 0 {
+				thresholdEvents := startThresholdNotifications(
+					logger, thresholdNotifiers, notificationTestName(filename),
+				)
+				engine.OnThresholdEvent(thresholdEvents.add)
+				defer thresholdEvents.stop()
+			}
 
 			// Spin up the REST API server, if not disabled.
 			if address != "" {
@@ -277,6 +361,12 @@ a commandline interface for interacting with it.`,
 			// Start the test run
 			initBar.Modify(pb.WithConstProgress(0, "Starting test..."))
 			if err := engineRun(); err != nil {
+				// teardown() failing after the thresholds aborted the test run
+				// doesn't change why it was aborted
+				if _, ok := errors.Cause(err).(lib.TeardownError); ok && engine.IsAbortedByThresholds() {
+					logger.WithError(err).Error("teardown() failed after the test run was aborted by the thresholds")
+					return ExitCode{error: errors.New("some thresholds have failed"), Code: thresholdHaveFailedErrorCode}
+				}
 				return getExitCodeFromEngine(err)
 			}
 			runCancel()
@@ -293,11 +383,16 @@ a commandline interface for interacting with it.`,
 
 			// Handle the end-of-test summary.
 			if !runtimeOptions.NoSummary.Bool {
-				summaryResult, err := initRunner.HandleSummary(globalCtx, &lib.Summary{
+				summary := &lib.Summary{
 					Metrics:         engine.Metrics,
 					RootGroup:       engine.ExecutionScheduler.GetRunner().GetDefaultGroup(),
 					TestRunDuration: executionState.GetCurrentTestRunDuration(),
-				})
+					RequestTimings:  engine.RequestTimings,
+				}
+				if slos != nil {
+					summary.SLOs = slos.Evaluate(engine.Metrics)
+				}
+				summaryResult, err := initRunner.HandleSummary(globalCtx, summary)
 				if err == nil {
 					err = handleSummaryResult(afero.NewOsFs(), stdout, stderr, summaryResult)
 				}
@@ -305,6 +400,12 @@ a commandline interface for interacting with it.`,
 					logger.WithError(err).Error("failed to handle the end-of-test summary")
 				}
 			}
+			if len(notifiers) > 0 {
+				sendNotifications(logger, notifiers, notify.NewSummary(
+					notificationTestName(filename), engine.Metrics,
+					executionState.GetCurrentTestRunDuration(), runtimeOptions.NotifyLink.String,
+				))
+			}
 
 			if conf.Linger.Bool {
 				select {
@@ -321,6 +422,9 @@ a commandline interface for interacting with it.`,
 			logger.Debug("Waiting for engine processes to finish...")
 			engineWait()
 			logger.Debug("Everything has finished, exiting k6!")
+			if err := engine.GetStopError(); err != nil {
+				return ExitCode{error: err, Code: outputAbortErrorCode}
+			}
 			if engine.IsTainted() {
 				return ExitCode{error: errors.New("some thresholds have failed"), Code: thresholdHaveFailedErrorCode}
 			}
@@ -336,6 +440,14 @@ a commandline interface for interacting with it.`,
 
 func getExitCodeFromEngine(err error) ExitCode {
 	switch e := errors.Cause(err).(type) {
+	case lib.TeardownError:
+		if te, ok := errors.Cause(e.Unwrap()).(lib.TimeoutError); ok {
+			return ExitCode{error: err, Code: teardownTimeoutErrorCode, Hint: te.Hint()}
+		}
+		return ExitCode{
+			error: errors.Wrap(err, consts.TeardownFn), Code: teardownErrorCode,
+			Hint: "resources created by setup() or the test run may not have been cleaned up",
+		}
 	case lib.TimeoutError:
 		switch e.Place() {
 		case consts.SetupFn:
@@ -398,6 +510,8 @@ func runCmdFlagSet() *pflag.FlagSet {
 	// - and finally, global variables are not very testable... :/
 	flags.StringVarP(&runType, "type", "t", runType, "override file `type`, \"js\" or \"archive\"")
 	flags.Lookup("type").DefValue = ""
+	flags.BoolVar(&dashboardMode, "dashboard", dashboardMode,
+		"show a live dashboard of the test run in the terminal instead of the progress bars")
 	return flags
 }
 
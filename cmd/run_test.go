@@ -29,7 +29,10 @@ import (
 	"path/filepath"
 	"runtime"
 	"testing"
+	"time"
 
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/consts"
 	"github.com/loadimpact/k6/lib/fsext"
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
@@ -124,3 +127,19 @@ func TestHandleSummaryResultError(t *testing.T) {
 	assertEqual(t, "file summary 1", files[filePath1])
 	assertEqual(t, "file summary 2", files[filePath2])
 }
+
+func TestGetExitCodeFromEngine(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		err  error
+		code int
+	}{
+		{errors.New("oops"), genericEngineErrorCode},
+		{lib.NewTimeoutError(consts.SetupFn, time.Second), setupTimeoutErrorCode},
+		{lib.NewTeardownError(errors.New("oops")), teardownErrorCode},
+		{lib.NewTeardownError(lib.NewTimeoutError(consts.TeardownFn, time.Second)), teardownTimeoutErrorCode},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.code, getExitCodeFromEngine(tc.err).Code, tc.err.Error())
+	}
+}
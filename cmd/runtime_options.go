@@ -31,6 +31,7 @@ import (
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/fips"
 )
 
 // TODO: move this whole file out of the cmd package? maybe when fixing
@@ -66,6 +67,7 @@ extended: base + Babel with ES2015 preset + core.js v2,
           slower and memory consuming but with greater JS support
 `)
 	flags.StringArrayP("env", "e", nil, "add/override environment variable with `VAR=value`")
+	flags.StringArray("env-file", nil, "load environment variables from a `file`, optionally encrypted, which are never saved in archives")
 	flags.Bool("no-thresholds", false, "don't run thresholds")
 	flags.Bool("no-summary", false, "don't show the summary at the end of the test")
 	flags.String(
@@ -73,6 +75,69 @@ extended: base + Babel with ES2015 preset + core.js v2,
 		"",
 		"output the end-of-test summary report to JSON file",
 	)
+	flags.String(
+		"summary-export-csv",
+		"",
+		"output the end-of-test summary with a row for each metric to a CSV `file`",
+	)
+	flags.String(
+		"summary-markdown",
+		"",
+		"output the end-of-test summary as Markdown tables to a `file`, or to stdout instead of the text summary",
+	)
+	flags.String(
+		"report-html",
+		"",
+		"output the end-of-test summary as a standalone HTML report with latency distribution charts to a `file`",
+	)
+	flags.String(
+		"report-junit",
+		"",
+		"output the thresholds and checks as JUnit XML test cases to a `file`",
+	)
+	flags.String(
+		"slo",
+		"",
+		"compile the service level objectives in the YAML `file` into thresholds and report them in the summary",
+	)
+	flags.StringArray(
+		"notify",
+		nil,
+		"post the end-of-test summary to `kind=url`, where kind is one of slack, teams or webhook",
+	)
+	flags.String("notify-template", "", "render the notification message with the text/template in `file`")
+	flags.String("notify-link", "", "include a link to a dashboard with the results in the notifications")
+	flags.StringArray(
+		"notify-thresholds",
+		nil,
+		"post the threshold breaches, recoveries and aborts to `kind=url` as they happen",
+	)
+	flags.Bool(
+		"summary-github-actions",
+		false,
+		"print GitHub Actions annotations for failed thresholds and checks, and fill in the job step summary",
+	)
+	flags.String(
+		"trend-spill-dir",
+		"",
+		"keep the raw values of trend metrics in memory-mapped files in `dir` instead of on the heap",
+	)
+	flags.String(
+		"checkpoint-file",
+		"",
+		"periodically save the progress of the test run to `file` and the trend values next to it, so it can be resumed with --resume",
+	)
+	// the engine falls back to its own default, so only the usage shows it
+	flags.Duration("checkpoint-interval", 0, "how often the checkpoint file is saved")
+	flags.Lookup("checkpoint-interval").DefValue = "1m0s"
+	flags.String("resume", "", "resume the test run saved in the checkpoint `file` from where it stopped")
+	flags.Bool("fips", false, "restrict TLS and k6/crypto to FIPS-approved algorithms")
+	flags.Bool("no-strict-options", false, "only warn about unknown script options instead of failing")
+	flags.StringArray(
+		"secret-source",
+		nil,
+		"resolve secrets from `type=arg`, where type is one of env, file, vault, aws or gcp",
+	)
 	return flags
 }
 
@@ -92,6 +157,15 @@ func saveBoolFromEnv(env map[string]string, varName string, placeholder *null.Bo
 	return nil
 }
 
+// enableFIPSMode turns on the FIPS mode for the whole process if the runtime
+// options ask for it. Every command that accepts the runtime options should call
+// it before it compiles the script or makes any TLS connections.
+func enableFIPSMode(opts lib.RuntimeOptions) {
+	if opts.FIPSMode.Bool {
+		fips.Enable()
+	}
+}
+
 func getRuntimeOptions(flags *pflag.FlagSet, environment map[string]string) (lib.RuntimeOptions, error) {
 	// TODO: refactor with composable helpers as a part of #883, to reduce copy-paste
 	// TODO: get these options out of the JSON config file as well?
@@ -101,6 +175,20 @@ func getRuntimeOptions(flags *pflag.FlagSet, environment map[string]string) (lib
 		NoThresholds:         getNullBool(flags, "no-thresholds"),
 		NoSummary:            getNullBool(flags, "no-summary"),
 		SummaryExport:        getNullString(flags, "summary-export"),
+		SummaryExportCSV:     getNullString(flags, "summary-export-csv"),
+		SummaryMarkdown:      getNullString(flags, "summary-markdown"),
+		SummaryGitHubActions: getNullBool(flags, "summary-github-actions"),
+		ReportHTML:           getNullString(flags, "report-html"),
+		ReportJUnit:          getNullString(flags, "report-junit"),
+		SLO:                  getNullString(flags, "slo"),
+		NotifyTemplate:       getNullString(flags, "notify-template"),
+		NotifyLink:           getNullString(flags, "notify-link"),
+		TrendSpillDir:        getNullString(flags, "trend-spill-dir"),
+		CheckpointFile:       getNullString(flags, "checkpoint-file"),
+		CheckpointInterval:   getNullDuration(flags, "checkpoint-interval"),
+		Resume:               getNullString(flags, "resume"),
+		FIPSMode:             getNullBool(flags, "fips"),
+		NoStrictOptions:      getNullBool(flags, "no-strict-options"),
 		Env:                  make(map[string]string),
 	}
 
@@ -124,6 +212,19 @@ func getRuntimeOptions(flags *pflag.FlagSet, environment map[string]string) (lib
 	if err := saveBoolFromEnv(environment, "K6_NO_SUMMARY", &opts.NoSummary); err != nil {
 		return opts, err
 	}
+	if err := saveBoolFromEnv(environment, "K6_SUMMARY_GITHUB_ACTIONS", &opts.SummaryGitHubActions); err != nil {
+		return opts, err
+	}
+	// Set by GitHub Actions for every step of a job
+	if envVar, ok := environment["GITHUB_STEP_SUMMARY"]; ok && opts.SummaryGitHubActions.Bool {
+		opts.GitHubStepSummary = null.StringFrom(envVar)
+	}
+	if err := saveBoolFromEnv(environment, "K6_FIPS", &opts.FIPSMode); err != nil {
+		return opts, err
+	}
+	if err := saveBoolFromEnv(environment, "K6_NO_STRICT_OPTIONS", &opts.NoStrictOptions); err != nil {
+		return opts, err
+	}
 
 	if envVar, ok := environment["K6_SUMMARY_EXPORT"]; ok {
 		if !opts.SummaryExport.Valid {
@@ -131,10 +232,124 @@ func getRuntimeOptions(flags *pflag.FlagSet, environment map[string]string) (lib
 		}
 	}
 
+	if envVar, ok := environment["K6_SUMMARY_EXPORT_CSV"]; ok {
+		if !opts.SummaryExportCSV.Valid {
+			opts.SummaryExportCSV = null.StringFrom(envVar)
+		}
+	}
+
+	if envVar, ok := environment["K6_SUMMARY_MARKDOWN"]; ok {
+		if !opts.SummaryMarkdown.Valid {
+			opts.SummaryMarkdown = null.StringFrom(envVar)
+		}
+	}
+
+	if envVar, ok := environment["K6_REPORT_HTML"]; ok {
+		if !opts.ReportHTML.Valid {
+			opts.ReportHTML = null.StringFrom(envVar)
+		}
+	}
+
+	if envVar, ok := environment["K6_REPORT_JUNIT"]; ok {
+		if !opts.ReportJUnit.Valid {
+			opts.ReportJUnit = null.StringFrom(envVar)
+		}
+	}
+
+	if envVar, ok := environment["K6_SLO"]; ok {
+		if !opts.SLO.Valid {
+			opts.SLO = null.StringFrom(envVar)
+		}
+	}
+
+	notify, err := flags.GetStringArray("notify")
+	if err != nil {
+		return opts, err
+	}
+	if envVar, ok := environment["K6_NOTIFY"]; ok && len(notify) == 0 {
+		notify = strings.Split(envVar, ",")
+	}
+	if len(notify) > 0 {
+		opts.Notify = notify
+	}
+
+	notifyThresholds, err := flags.GetStringArray("notify-thresholds")
+	if err != nil {
+		return opts, err
+	}
+	if envVar, ok := environment["K6_NOTIFY_THRESHOLDS"]; ok && len(notifyThresholds) == 0 {
+		notifyThresholds = strings.Split(envVar, ",")
+	}
+	if len(notifyThresholds) > 0 {
+		opts.NotifyThresholds = notifyThresholds
+	}
+
+	if envVar, ok := environment["K6_NOTIFY_TEMPLATE"]; ok {
+		if !opts.NotifyTemplate.Valid {
+			opts.NotifyTemplate = null.StringFrom(envVar)
+		}
+	}
+
+	if envVar, ok := environment["K6_NOTIFY_LINK"]; ok {
+		if !opts.NotifyLink.Valid {
+			opts.NotifyLink = null.StringFrom(envVar)
+		}
+	}
+
+	if envVar, ok := environment["K6_TREND_SPILL_DIR"]; ok {
+		if !opts.TrendSpillDir.Valid {
+			opts.TrendSpillDir = null.StringFrom(envVar)
+		}
+	}
+
+	if envVar, ok := environment["K6_CHECKPOINT_FILE"]; ok {
+		if !opts.CheckpointFile.Valid {
+			opts.CheckpointFile = null.StringFrom(envVar)
+		}
+	}
+
+	if envVar, ok := environment["K6_CHECKPOINT_INTERVAL"]; ok && !opts.CheckpointInterval.Valid {
+		if err := opts.CheckpointInterval.UnmarshalText([]byte(envVar)); err != nil {
+			return opts, fmt.Errorf("env var 'K6_CHECKPOINT_INTERVAL' is not a valid duration: %w", err)
+		}
+	}
+
+	secretSources, err := flags.GetStringArray("secret-source")
+	if err != nil {
+		return opts, err
+	}
+	if envVar, ok := environment["K6_SECRET_SOURCE"]; ok && len(secretSources) == 0 {
+		secretSources = strings.Split(envVar, ",")
+	}
+	if len(secretSources) > 0 {
+		opts.SecretSources = secretSources
+	}
+
 	if opts.IncludeSystemEnvVars.Bool { // If enabled, gather the actual system environment variables
 		opts.Env = environment
 	}
 
+	// Load any env files, which can still be overridden by --env
+	envFiles, err := flags.GetStringArray("env-file")
+	if err != nil {
+		return opts, err
+	}
+	if envVar, ok := environment["K6_ENV_FILE"]; ok && len(envFiles) == 0 {
+		envFiles = strings.Split(envVar, ",")
+	}
+	for _, path := range envFiles {
+		fileEnv, err := readEnvFile(path, environment, opts.SecretSources)
+		if err != nil {
+			return opts, err
+		}
+		if opts.FileEnv == nil {
+			opts.FileEnv = make(map[string]string, len(fileEnv))
+		}
+		for k, v := range fileEnv {
+			opts.FileEnv[k] = v
+		}
+	}
+
 	// Set/overwrite environment variables with custom user-supplied values
 	envVars, err := flags.GetStringArray("env")
 	if err != nil {
@@ -147,6 +362,7 @@ func getRuntimeOptions(flags *pflag.FlagSet, environment map[string]string) (lib
 			return opts, errors.Errorf("Invalid environment variable name '%s'", k)
 		}
 		opts.Env[k] = v
+		delete(opts.FileEnv, k)
 	}
 
 	return opts, nil
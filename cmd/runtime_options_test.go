@@ -23,7 +23,10 @@ package cmd
 import (
 	"bytes"
 	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/spf13/afero"
@@ -32,6 +35,8 @@ import (
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/envfile"
+	"github.com/loadimpact/k6/lib/secrets"
 	"github.com/loadimpact/k6/lib/testutils"
 	"github.com/loadimpact/k6/loader"
 )
@@ -61,6 +66,46 @@ var runtimeOptionsTestCases = map[string]runtimeOptionsTestCase{ //nolint:gochec
 			Env:                  nil,
 		},
 	},
+	"fips mode by cli": {
+		useSysEnv: false,
+		cliFlags:  []string{"--fips"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			FIPSMode:             null.NewBool(true, true),
+			Env:                  map[string]string{},
+		},
+	},
+	"fips mode by env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_FIPS": "true"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			FIPSMode:             null.BoolFrom(true),
+			Env:                  map[string]string{},
+		},
+	},
+	"no strict options by cli": {
+		useSysEnv: false,
+		cliFlags:  []string{"--no-strict-options"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			NoStrictOptions:      null.NewBool(true, true),
+			Env:                  map[string]string{},
+		},
+	},
+	"no strict options by env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_NO_STRICT_OPTIONS": "true"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			NoStrictOptions:      null.BoolFrom(true),
+			Env:                  map[string]string{},
+		},
+	},
 	"disabled sys env by default": {
 		useSysEnv: false,
 		systemEnv: map[string]string{"test1": "val1"},
@@ -285,6 +330,115 @@ var runtimeOptionsTestCases = map[string]runtimeOptionsTestCase{ //nolint:gochec
 		cliFlags:  []string{"--no-summary", "true"},
 		expErr:    true,
 	},
+	"summary github actions from env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_SUMMARY_GITHUB_ACTIONS": "true", "GITHUB_STEP_SUMMARY": "/tmp/step"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+			SummaryGitHubActions: null.NewBool(true, true),
+			GitHubStepSummary:    null.NewString("/tmp/step", true),
+		},
+	},
+	"step summary ignored without github actions summary": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"GITHUB_STEP_SUMMARY": "/tmp/step"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+		},
+	},
+	"secret sources from env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_SECRET_SOURCE": "env,env=MY_"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+			SecretSources:        []string{"env", "env=MY_"},
+		},
+	},
+	"secret sources cli flags override env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_SECRET_SOURCE": "env"},
+		cliFlags:  []string{"--secret-source", "env=A_", "--secret-source", "env=B_"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+			SecretSources:        []string{"env=A_", "env=B_"},
+		},
+	},
+	"notifications from env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{
+			"K6_NOTIFY":      "slack=https://hooks.slack.com/a,webhook=https://example.com",
+			"K6_NOTIFY_LINK": "https://dashboards/run/1",
+		},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+			Notify:               []string{"slack=https://hooks.slack.com/a", "webhook=https://example.com"},
+			NotifyLink:           null.StringFrom("https://dashboards/run/1"),
+		},
+	},
+	"notifications cli flags override env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_NOTIFY": "slack=https://hooks.slack.com/a", "K6_NOTIFY_TEMPLATE": "a.tmpl"},
+		cliFlags:  []string{"--notify", "teams=https://example.com", "--notify-template", "b.tmpl"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+			Notify:               []string{"teams=https://example.com"},
+			NotifyTemplate:       null.StringFrom("b.tmpl"),
+		},
+	},
+	"slo file from env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_SLO": "slo.yaml"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+			SLO:                  null.StringFrom("slo.yaml"),
+		},
+	},
+	"slo file cli flag overrides env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_SLO": "slo.yaml"},
+		cliFlags:  []string{"--slo", "other.yaml"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+			SLO:                  null.StringFrom("other.yaml"),
+		},
+	},
+	"threshold notifications": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_NOTIFY_THRESHOLDS": "slack=https://hooks.slack.com/a,webhook=https://example.com"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+			NotifyThresholds:     []string{"slack=https://hooks.slack.com/a", "webhook=https://example.com"},
+		},
+	},
+	"threshold notifications cli flags override env": {
+		useSysEnv: false,
+		systemEnv: map[string]string{"K6_NOTIFY_THRESHOLDS": "slack=https://hooks.slack.com/a"},
+		cliFlags:  []string{"--notify-thresholds", "webhook=https://example.com"},
+		expRTOpts: lib.RuntimeOptions{
+			IncludeSystemEnvVars: null.NewBool(false, false),
+			CompatibilityMode:    defaultCompatMode,
+			Env:                  map[string]string{},
+			NotifyThresholds:     []string{"webhook=https://example.com"},
+		},
+	},
 }
 
 func testRuntimeOptionsCase(t *testing.T, tc runtimeOptionsTestCase) {
@@ -363,3 +517,53 @@ func TestRuntimeOptions(t *testing.T) {
 		})
 	}
 }
+
+func TestRuntimeOptionsEnvFile(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "k6-env-file")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	encodedKey, err := envfile.GenerateKey()
+	require.NoError(t, err)
+	key, err := envfile.ParseKey(encodedKey)
+	require.NoError(t, err)
+	encrypted, err := envfile.Encrypt([]byte("TOKEN=s3cr3t\nHOST=encrypted\n"), key)
+	require.NoError(t, err)
+
+	plainPath, encPath := filepath.Join(dir, "plain.env"), filepath.Join(dir, "secrets.env.enc")
+	require.NoError(t, ioutil.WriteFile(plainPath, []byte("HOST=plain\nUSER=me\n"), 0o600))
+	require.NoError(t, ioutil.WriteFile(encPath, encrypted, 0o600))
+
+	getOpts := func(env map[string]string, cliFlags ...string) (lib.RuntimeOptions, error) {
+		flags := runtimeOptionFlagSet(false)
+		require.NoError(t, flags.Parse(cliFlags))
+		return getRuntimeOptions(flags, env)
+	}
+
+	rtOpts, err := getOpts(map[string]string{"K6_ENV_FILE_KEY": encodedKey},
+		"--env-file", plainPath, "--env-file", encPath, "-e", "USER=cli")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"USER": "cli"}, rtOpts.Env)
+	assert.Equal(t, map[string]string{"HOST": "encrypted", "TOKEN": "s3cr3t"}, rtOpts.FileEnv)
+	assert.Equal(t, map[string]string{"HOST": "encrypted", "TOKEN": "s3cr3t", "USER": "cli"}, rtOpts.VUEnv())
+	assert.Equal(t, "token="+secrets.Redacted, secrets.Redact("token=s3cr3t"))
+
+	rtOpts, err = getOpts(map[string]string{"K6_ENV_FILE": plainPath})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"HOST": "plain", "USER": "me"}, rtOpts.VUEnv())
+	assert.Empty(t, rtOpts.Env)
+
+	_, err = getOpts(map[string]string{}, "--env-file", encPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "require the K6_ENV_FILE_KEY or K6_ENV_FILE_KEY_SECRET")
+
+	otherKey, err := envfile.GenerateKey()
+	require.NoError(t, err)
+	_, err = getOpts(map[string]string{"K6_ENV_FILE_KEY": otherKey}, "--env-file", encPath)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the key is wrong")
+
+	_, err = getOpts(map[string]string{}, "--env-file", filepath.Join(dir, "missing.env"))
+	assert.Error(t, err)
+}
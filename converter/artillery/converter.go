@@ -0,0 +1,755 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package artillery
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+//nolint:gochecknoglobals
+var (
+	templateRe     = regexp.MustCompile(`\{\{\s*(.*?)\s*\}\}`)
+	varNameRe      = regexp.MustCompile(`^[A-Za-z_][\w-]*$`)
+	envRe          = regexp.MustCompile(`^\$(?:processEnvironment|env)\.(\w+)$`)
+	randomNumberRe = regexp.MustCompile(`^\$randomNumber\(\s*(-?\d+)\s*,\s*(-?\d+)\s*\)$`)
+	jsonPathRe     = regexp.MustCompile(`^\$((?:\.[\w-]+|\[\d+\])+)$`)
+	jsonIndexRe    = regexp.MustCompile(`\[(\d+)\]`)
+	identifierRe   = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+	templateEscape = strings.NewReplacer("\\", "\\\\", "`", "\\`", "${", "\\${")
+
+	reservedIdentifiers = map[string]bool{
+		"setup": true, "teardown": true, "default": true, "options": true, "http": true, "check": true,
+		"group": true, "sleep": true, "vars": true, "res": true, "pick": true, "function": true,
+		"export": true, "import": true, "let": true, "const": true, "var": true, "return": true, "new": true,
+	}
+	requestMethods = map[string]bool{
+		"get": true, "post": true, "put": true, "patch": true, "delete": true, "head": true, "options": true,
+	}
+)
+
+// Result is a k6 script converted from an Artillery script, along with the
+// parts of it that couldn't be converted, or only partially.
+type Result struct {
+	Script      string
+	Unsupported []string
+}
+
+type stage struct {
+	Duration string `json:"duration"`
+	Target   int64  `json:"target"`
+}
+
+type flow struct {
+	name   string
+	weight float64
+	*Scenario
+}
+
+type converter struct {
+	script      *Script
+	init        []string
+	functions   bytes.Buffer
+	indent      int
+	identifiers map[string]bool
+	unsupported []string
+}
+
+// Convert converts the phases of an Artillery script to the stages of a k6
+// scenario with the ramping-arrival-rate executor, where every iteration runs
+// one of the flows of the Artillery scenarios, like an Artillery virtual user.
+func Convert(script *Script) (*Result, error) {
+	c := &converter{script: script, identifiers: make(map[string]bool)}
+	config := script.Config
+	if config.Processor != "" {
+		c.report("config.processor", "custom JS functions are not supported, the steps that use them were skipped")
+	}
+	if len(config.Environments) > 0 {
+		c.report("config.environments", "not supported, only the default config was converted")
+	}
+	for _, plugin := range config.Plugins {
+		if name := fmt.Sprint(plugin.Key); name != "expect" {
+			c.report("config.plugins."+name, "not supported, it was skipped")
+		}
+	}
+
+	scenario, err := c.arrivalRateScenario()
+	if err != nil {
+		return nil, err
+	}
+	options := map[string]interface{}{"scenarios": map[string]interface{}{"phases": scenario}}
+	if thresholds := c.thresholds(); len(thresholds) > 0 {
+		options["thresholds"] = thresholds
+	}
+	if config.TLS.RejectUnauthorized != nil && !*config.TLS.RejectUnauthorized {
+		options["insecureSkipTLSVerify"] = true
+	}
+
+	var flows []flow
+	for i := range script.Scenarios {
+		s := &script.Scenarios[i]
+		if s.Engine != "" && s.Engine != "http" {
+			c.report(scenarioPath(i, s), "the %s engine is not supported, it was skipped", s.Engine)
+			continue
+		}
+		weight := s.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		name := s.Name
+		if name == "" {
+			name = fmt.Sprintf("scenario%d", i+1)
+		}
+		flows = append(flows, flow{name: c.identifier(name), weight: weight, Scenario: s})
+	}
+	if len(flows) == 0 {
+		return nil, errors.New("the script doesn't have any HTTP scenarios that can be converted")
+	}
+
+	c.defaultFunction(flows)
+	for i, f := range flows {
+		c.line("")
+		c.line("function %s(vars) {", f.name)
+		c.indent++
+		c.line("let res;")
+		c.steps(f.Flow, scenarioPath(i, f.Scenario))
+		c.indent--
+		c.line("}")
+	}
+
+	var b bytes.Buffer
+	b.WriteString("import http from 'k6/http';\n")
+	b.WriteString("import { check, sleep } from 'k6';\n\n")
+	b.WriteString("// Converted from an Artillery script\n\n")
+	for _, line := range c.init {
+		b.WriteString(line + "\n")
+	}
+	if len(c.init) > 0 {
+		b.WriteString("\n")
+	}
+	// The thresholds contain < and >, which shouldn't be escaped
+	b.WriteString("export let options = ")
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "    ")
+	if err := enc.Encode(options); err != nil {
+		return nil, err
+	}
+	b.Truncate(b.Len() - 1)
+	b.WriteString(";\n")
+	b.Write(c.functions.Bytes())
+	return &Result{Script: b.String(), Unsupported: c.unsupported}, nil
+}
+
+func scenarioPath(i int, s *Scenario) string {
+	if s.Name == "" {
+		return fmt.Sprintf("scenarios[%d]", i)
+	}
+	return fmt.Sprintf("scenarios[%d] %s", i, quote(s.Name))
+}
+
+func (c *converter) line(format string, a ...interface{}) {
+	c.functions.WriteString(strings.Repeat("\t", c.indent))
+	fmt.Fprintf(&c.functions, format, a...)
+	c.functions.WriteString("\n")
+}
+
+func (c *converter) report(path, format string, a ...interface{}) {
+	c.unsupported = append(c.unsupported, path+": "+fmt.Sprintf(format, a...))
+}
+
+// identifier returns a unique JS identifier for the scenario with the given
+// name.
+func (c *converter) identifier(name string) string {
+	id := strings.Trim(identifierRe.ReplaceAllString(name, "_"), "_")
+	if id == "" {
+		id = "scenario"
+	}
+	if id[0] >= '0' && id[0] <= '9' || reservedIdentifiers[id] {
+		id = "_" + id
+	}
+	unique := id
+	for i := 2; c.identifiers[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", id, i)
+	}
+	c.identifiers[unique] = true
+	return unique
+}
+
+func quote(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case float64:
+		return n, true
+	case string:
+		f, err := strconv.ParseFloat(strings.TrimSpace(n), 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func lookup(m yaml.MapSlice, key string) (interface{}, bool) {
+	for _, item := range m {
+		if fmt.Sprint(item.Key) == key {
+			return item.Value, true
+		}
+	}
+	return nil, false
+}
+
+// value returns a JS expression for an Artillery string, in which templates,
+// like {{ user }} and {{ $processEnvironment.HOST }}, are replaced by their
+// k6 equivalents. A string that is a single template keeps the type of the
+// value, like in Artillery.
+func (c *converter) value(s, path string) string {
+	matches := templateRe.FindAllStringSubmatchIndex(s, -1)
+	if len(matches) == 0 {
+		return quote(s)
+	}
+	if m := matches[0]; len(matches) == 1 && m[0] == 0 && m[1] == len(s) {
+		if expr, ok := c.reference(s[m[2]:m[3]]); ok {
+			return expr
+		}
+	}
+	var b strings.Builder
+	b.WriteByte('`')
+	last := 0
+	for _, m := range matches {
+		b.WriteString(templateEscape.Replace(s[last:m[0]]))
+		ref := s[m[2]:m[3]]
+		if expr, ok := c.reference(ref); ok {
+			b.WriteString("${" + expr + "}")
+		} else {
+			c.report(path, "the template {{ %s }} is not supported, it was kept as text", ref)
+			b.WriteString(templateEscape.Replace(s[m[0]:m[1]]))
+		}
+		last = m[1]
+	}
+	b.WriteString(templateEscape.Replace(s[last:]))
+	b.WriteByte('`')
+	return b.String()
+}
+
+func (c *converter) reference(ref string) (string, bool) {
+	switch ref {
+	case "$loopElement":
+		return "loopElement", true
+	case "$loopCount":
+		return "loopCount", true
+	case "$randomString()":
+		return "Math.random().toString(36).slice(2)", true
+	}
+	if varNameRe.MatchString(ref) {
+		return fmt.Sprintf("vars[%s]", quote(ref)), true
+	}
+	if m := envRe.FindStringSubmatch(ref); m != nil {
+		return fmt.Sprintf("__ENV[%s]", quote(m[1])), true
+	}
+	if m := randomNumberRe.FindStringSubmatch(ref); m != nil {
+		return fmt.Sprintf("Math.floor(Math.random() * (%s - %s + 1)) + %s", m[2], m[1], m[1]), true
+	}
+	return "", false
+}
+
+// literal returns a JS literal for a YAML value, with its strings converted
+// by value().
+func (c *converter) literal(v interface{}, path string) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return c.value(t, path)
+	case []interface{}:
+		items := make([]string, len(t))
+		for i, item := range t {
+			items[i] = c.literal(item, path)
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	case yaml.MapSlice:
+		if len(t) == 0 {
+			return "{}"
+		}
+		fields := make([]string, len(t))
+		for i, item := range t {
+			fields[i] = quote(fmt.Sprint(item.Key)) + ": " + c.literal(item.Value, path)
+		}
+		return "{ " + strings.Join(fields, ", ") + " }"
+	case float64:
+		return formatFloat(t)
+	default:
+		return fmt.Sprint(t)
+	}
+}
+
+// arrivalRateScenario converts the phases to the stages of a scenario with
+// the ramping-arrival-rate executor. The phases with a constant arrival rate
+// become a stage that instantly ramps to the rate and one that keeps it.
+func (c *converter) arrivalRateScenario() (map[string]interface{}, error) {
+	phases := c.script.Config.Phases
+	timeUnit, scale := "1s", 1.0
+	for _, p := range phases {
+		if p.ArrivalCount > 0 {
+			timeUnit, scale = "1m", 60
+		}
+	}
+	rate := func(v float64, path string) int64 {
+		r := math.Round(v * scale)
+		if math.Abs(r-v*scale) > 1e-9 {
+			c.report(path, "the arrival rate %s per %s was rounded to %d", formatFloat(v*scale), timeUnit, int64(r))
+		}
+		return int64(r)
+	}
+
+	var (
+		stages          []stage
+		startRate, prev int64
+		peak            int64
+		maxVUs          int64
+		started         bool
+	)
+	for i, p := range phases {
+		path := fmt.Sprintf("config.phases[%d]", i)
+		var from, to int64
+		duration := float64(p.Duration)
+		switch {
+		case p.Pause > 0:
+			duration = float64(p.Pause)
+		case duration <= 0:
+			c.report(path, "phases without a duration are not supported, it was skipped")
+			continue
+		default:
+			r := p.ArrivalRate
+			if p.ArrivalCount > 0 {
+				r = p.ArrivalCount / duration
+			}
+			from = rate(r, path)
+			to = from
+			if p.RampTo > 0 {
+				to = rate(p.RampTo, path)
+			}
+		}
+		if !started {
+			startRate, started = from, true
+		} else if from != prev {
+			stages = append(stages, stage{Duration: "0s", Target: from})
+		}
+		stages = append(stages, stage{Duration: formatFloat(duration) + "s", Target: to})
+		prev = to
+		if from > peak {
+			peak = from
+		}
+		if to > peak {
+			peak = to
+		}
+		if p.MaxVusers > maxVUs {
+			maxVUs = p.MaxVusers
+		}
+	}
+	if len(stages) == 0 {
+		return nil, errors.New("the config doesn't have any phases that can be converted")
+	}
+
+	// Artillery starts a new virtual user for every arrival, so k6 needs at
+	// least as many VUs as the peak rate per second, and more for long flows.
+	preAllocatedVUs := int64(math.Ceil(float64(peak) / scale))
+	if preAllocatedVUs < 1 {
+		preAllocatedVUs = 1
+	}
+	if maxVUs == 0 {
+		maxVUs = 10 * preAllocatedVUs
+	} else if maxVUs < preAllocatedVUs {
+		preAllocatedVUs = maxVUs
+	}
+	return map[string]interface{}{
+		"executor":        "ramping-arrival-rate",
+		"startRate":       startRate,
+		"timeUnit":        timeUnit,
+		"preAllocatedVUs": preAllocatedVUs,
+		"maxVUs":          maxVUs,
+		"stages":          stages,
+	}, nil
+}
+
+// thresholds converts the legacy ensure checks of Artillery, which fail the
+// test if the latency percentiles or the error rate exceed a value.
+func (c *converter) thresholds() map[string][]string {
+	thresholds := make(map[string][]string)
+	for _, item := range c.script.Config.Ensure {
+		key := fmt.Sprint(item.Key)
+		path := "config.ensure." + key
+		v, ok := toFloat(item.Value)
+		if !ok {
+			c.report(path, "not supported, it was skipped")
+			continue
+		}
+		stat := map[string]string{"p95": "p(95)", "p99": "p(99)", "median": "med", "max": "max", "min": "min"}[key]
+		switch {
+		case stat != "":
+			thresholds["http_req_duration"] = append(thresholds["http_req_duration"], stat+"<="+formatFloat(v))
+		case key == "maxErrorRate":
+			thresholds["http_req_failed"] = append(thresholds["http_req_failed"], "rate<="+formatFloat(v/100))
+		default:
+			c.report(path, "not supported, it was skipped")
+		}
+	}
+	return thresholds
+}
+
+func (c *converter) defaultFunction(flows []flow) {
+	config := c.script.Config
+	c.line("")
+	c.line("export default function () {")
+	c.indent++
+	c.line("let vars = {};")
+	for _, item := range config.Variables {
+		name := fmt.Sprint(item.Key)
+		path := "config.variables." + name
+		if values, ok := item.Value.([]interface{}); ok {
+			c.line("vars[%s] = %s[Math.floor(Math.random() * %d)];", quote(name), c.literal(values, path), len(values))
+		} else {
+			c.line("vars[%s] = %s;", quote(name), c.literal(item.Value, path))
+		}
+	}
+	for i, p := range config.Payload {
+		c.payload(i, p)
+	}
+
+	if len(flows) == 1 {
+		c.line("%s(vars);", flows[0].name)
+	} else {
+		var total float64
+		for _, f := range flows {
+			total += f.weight
+		}
+		c.line("const pick = Math.random() * %s;", formatFloat(total))
+		var cumulative float64
+		for i, f := range flows {
+			cumulative += f.weight
+			switch i {
+			case 0:
+				c.line("if (pick < %s) {", formatFloat(cumulative))
+			case len(flows) - 1:
+				c.line("} else {")
+			default:
+				c.line("} else if (pick < %s) {", formatFloat(cumulative))
+			}
+			c.indent++
+			c.line("%s(vars);", f.name)
+			c.indent--
+		}
+		c.line("}")
+	}
+	c.indent--
+	c.line("}")
+}
+
+// payload loads a CSV payload file in the init context and picks a random
+// row of it for the variables of every iteration, like Artillery does for
+// every virtual user by default.
+func (c *converter) payload(i int, p Payload) {
+	path := fmt.Sprintf("config.payload[%d]", i)
+	if p.Path == "" || len(p.Fields) == 0 {
+		c.report(path, "only payloads with a path and fields are supported, it was skipped")
+		return
+	}
+	if p.Order == "sequence" {
+		c.report(path, "the sequence order is not supported, the rows are picked randomly")
+	}
+	delimiter := p.Delimiter
+	if delimiter == "" {
+		delimiter = ","
+	}
+	skipHeader := ""
+	if p.SkipHeader {
+		skipHeader = ".slice(1)"
+	}
+	data := fmt.Sprintf("payload%d", i+1)
+	c.init = append(c.init, fmt.Sprintf(
+		"const %s = open(%s).split(/\\r?\\n/)%s.filter((l) => l !== \"\").map((l) => l.split(%s));",
+		data, quote(p.Path), skipHeader, quote(delimiter),
+	))
+	c.line("let %sRow = %s[Math.floor(Math.random() * %s.length)];", data, data, data)
+	for j, field := range p.Fields {
+		c.line("vars[%s] = %sRow[%d];", quote(field), data, j)
+	}
+}
+
+func (c *converter) steps(steps []yaml.MapSlice, path string) {
+	for i, step := range steps {
+		stepPath := fmt.Sprintf("%s › flow[%d]", path, i)
+		if v, ok := lookup(step, "loop"); ok {
+			c.loop(step, v, stepPath)
+			continue
+		}
+		if len(step) == 0 {
+			continue
+		}
+		action, v := fmt.Sprint(step[0].Key), step[0].Value
+		switch {
+		case requestMethods[action]:
+			c.request(strings.ToUpper(action), v, stepPath)
+		case action == "think":
+			if f, ok := toFloat(v); ok {
+				c.line("sleep(%s);", formatFloat(f))
+			} else {
+				c.line("sleep(Number(%s));", c.literal(v, stepPath))
+			}
+		case action == "log":
+			c.line("console.log(%s);", c.literal(v, stepPath))
+		default:
+			c.report(stepPath, "the %s step is not supported, it was skipped", action)
+			c.line("// TODO: convert the %s step", action)
+		}
+	}
+}
+
+func toSteps(v interface{}) []yaml.MapSlice {
+	items, _ := v.([]interface{})
+	steps := make([]yaml.MapSlice, 0, len(items))
+	for _, item := range items {
+		if step, ok := item.(yaml.MapSlice); ok {
+			steps = append(steps, step)
+		}
+	}
+	return steps
+}
+
+func (c *converter) loop(step yaml.MapSlice, v interface{}, path string) {
+	over, hasOver := lookup(step, "over")
+	count, hasCount := lookup(step, "count")
+	n, isNumber := toFloat(count)
+	switch {
+	case hasOver:
+		if name, ok := over.(string); ok && varNameRe.MatchString(name) {
+			c.line("for (const loopElement of vars[%s]) {", quote(name))
+		} else {
+			c.line("for (const loopElement of %s) {", c.literal(over, path))
+		}
+	case hasCount && isNumber:
+		c.line("for (let loopCount = 1; loopCount <= %d; loopCount++) {", int64(n))
+	default:
+		c.report(path, "loops without a count are not supported, it loops once")
+		c.line("{")
+	}
+	c.indent++
+	c.steps(toSteps(v), path)
+	c.indent--
+	c.line("}")
+}
+
+type header struct {
+	name, value string
+}
+
+func setHeader(headers []header, name, value string) []header {
+	for i, h := range headers {
+		if strings.EqualFold(h.name, name) {
+			headers[i].value = value
+			return headers
+		}
+	}
+	return append(headers, header{name, value})
+}
+
+func (c *converter) request(method string, v interface{}, path string) {
+	req, ok := v.(yaml.MapSlice)
+	if !ok {
+		c.report(path, "the %s request is not supported, it was skipped", strings.ToLower(method))
+		return
+	}
+	rawURL, _ := lookup(req, "url")
+	reqURL := fmt.Sprint(rawURL)
+	if !strings.HasPrefix(reqURL, "http://") && !strings.HasPrefix(reqURL, "https://") {
+		reqURL = c.script.Config.Target + reqURL
+	}
+
+	var headers []header
+	for _, h := range c.script.Config.Defaults.Headers {
+		headers = setHeader(headers, fmt.Sprint(h.Key), fmt.Sprint(h.Value))
+	}
+	body := "null"
+	var capture, expect interface{}
+	for _, item := range req {
+		key := fmt.Sprint(item.Key)
+		switch key {
+		case "url":
+		case "headers":
+			hs, _ := item.Value.(yaml.MapSlice)
+			for _, h := range hs {
+				headers = setHeader(headers, fmt.Sprint(h.Key), fmt.Sprint(h.Value))
+			}
+		case "qs":
+			qs, _ := item.Value.(yaml.MapSlice)
+			params := make([]string, len(qs))
+			for i, q := range qs {
+				params[i] = fmt.Sprint(q.Key) + "=" + fmt.Sprint(q.Value)
+			}
+			separator := "?"
+			if strings.Contains(reqURL, "?") {
+				separator = "&"
+			}
+			reqURL += separator + strings.Join(params, "&")
+		case "json":
+			body = "JSON.stringify(" + c.literal(item.Value, path) + ")"
+			headers = setHeader(headers, "Content-Type", "application/json")
+		case "body":
+			body = c.literal(item.Value, path)
+		case "form":
+			body = c.literal(item.Value, path)
+		case "capture":
+			capture = item.Value
+		case "expect":
+			expect = item.Value
+		default:
+			c.report(path, "the %s request option is not supported, it was ignored", key)
+		}
+	}
+
+	var params []string
+	if len(headers) > 0 {
+		hs := make([]string, len(headers))
+		for i, h := range headers {
+			hs[i] = quote(h.name) + ": " + c.value(h.value, path)
+		}
+		params = append(params, "headers: { "+strings.Join(hs, ", ")+" }")
+	}
+	if strings.Contains(reqURL, "{{") {
+		// group the requests to URLs with templates, like Artillery does
+		params = append(params, "tags: { name: "+quote(reqURL)+" }")
+	}
+	paramsArg := ""
+	if len(params) > 0 {
+		paramsArg = ", { " + strings.Join(params, ", ") + " }"
+	}
+	c.line("res = http.request(%s, %s, %s%s);", quote(method), c.value(reqURL, path), body, paramsArg)
+
+	c.checks(expect, path)
+	c.captures(capture, path)
+}
+
+func listOfMaps(v interface{}) []yaml.MapSlice {
+	if m, ok := v.(yaml.MapSlice); ok {
+		return []yaml.MapSlice{m}
+	}
+	return toSteps(v)
+}
+
+// jsonSelector converts a simple JSONPath, like $.items[0].id, to the GJSON
+// selector of res.json(), like items.0.id.
+func jsonSelector(path string) (string, bool) {
+	if !jsonPathRe.MatchString(path) {
+		return "", false
+	}
+	selector := jsonIndexRe.ReplaceAllString(strings.TrimPrefix(path, "$"), ".$1")
+	return strings.TrimPrefix(selector, "."), true
+}
+
+func (c *converter) captures(v interface{}, path string) {
+	for _, capture := range listOfMaps(v) {
+		as, _ := lookup(capture, "as")
+		name := quote(fmt.Sprint(as))
+		if p, ok := lookup(capture, "json"); ok {
+			selector, ok := jsonSelector(fmt.Sprint(p))
+			if !ok {
+				c.report(path, "the JSONPath %s is not supported, it wasn't captured", p)
+				continue
+			}
+			c.line("vars[%s] = res.json(%s);", name, quote(selector))
+		} else if re, ok := lookup(capture, "regexp"); ok {
+			group := "0"
+			if g, ok := lookup(capture, "group"); ok {
+				if n, isNumber := toFloat(g); isNumber {
+					group = strconv.Itoa(int(n))
+				}
+			}
+			c.line("vars[%s] = ((m) => m ? m[%s] : \"\")((res.body || \"\").match(new RegExp(%s)));",
+				name, group, c.literal(re, path))
+		} else if h, ok := lookup(capture, "header"); ok {
+			c.line("vars[%s] = res.headers[%s];", name, quote(textproto.CanonicalMIMEHeaderKey(fmt.Sprint(h))))
+		} else {
+			c.report(path, "only json, regexp and header captures are supported, %s wasn't captured", name)
+		}
+	}
+}
+
+func (c *converter) checks(v interface{}, path string) {
+	var lines []string
+	for _, expectation := range listOfMaps(v) {
+		for _, item := range expectation {
+			key := fmt.Sprint(item.Key)
+			switch key {
+			case "statusCode":
+				if codes, ok := item.Value.([]interface{}); ok {
+					lines = append(lines, fmt.Sprintf("%s: (r) => %s.includes(r.status),",
+						quote(fmt.Sprintf("statusCode %v", codes)), c.literal(codes, path)))
+				} else {
+					lines = append(lines, fmt.Sprintf("%s: (r) => r.status === %s,",
+						quote(fmt.Sprintf("statusCode %v", item.Value)), c.literal(item.Value, path)))
+				}
+			case "contentType":
+				contentType := fmt.Sprint(item.Value)
+				if contentType == "json" {
+					contentType = "application/json"
+				}
+				lines = append(lines, fmt.Sprintf("%s: (r) => (r.headers[\"Content-Type\"] || \"\").includes(%s),",
+					quote("contentType "+fmt.Sprint(item.Value)), c.value(contentType, path)))
+			case "hasProperty":
+				selector := strings.TrimPrefix(fmt.Sprint(item.Value), "$.")
+				lines = append(lines, fmt.Sprintf("%s: (r) => r.json(%s) !== undefined,",
+					quote("hasProperty "+fmt.Sprint(item.Value)), quote(selector)))
+			default:
+				c.report(path, "the %s expectation is not supported, it was skipped", key)
+			}
+		}
+	}
+	if len(lines) == 0 {
+		return
+	}
+	c.line("check(res, {")
+	c.indent++
+	for _, l := range lines {
+		c.line("%s", l)
+	}
+	c.indent--
+	c.line("});")
+}
@@ -0,0 +1,152 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package artillery
+
+import (
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js"
+	"github.com/loadimpact/k6/lib"
+	_ "github.com/loadimpact/k6/lib/executor" // for the executor of the converted scenario
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/loader"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+	_, err := Decode(strings.NewReader("config:\n  target: http://localhost\n"))
+	assert.EqualError(t, err, "invalid Artillery script, it doesn't have any scenarios")
+
+	_, err = Decode(strings.NewReader("config:\n  phases:\n    - duration: soon\nscenarios: []\n"))
+	assert.EqualError(t, err, "invalid duration 'soon'")
+
+	script, err := Decode(strings.NewReader(`
+config:
+  phases:
+    - duration: 2m
+      arrivalRate: 1
+    - duration: "30"
+      arrivalRate: 2
+  payload:
+    path: users.csv
+    fields: [user]
+scenarios:
+  - flow:
+      - get:
+          url: /
+`))
+	require.NoError(t, err)
+	assert.Equal(t, seconds(120), script.Config.Phases[0].Duration)
+	assert.Equal(t, seconds(30), script.Config.Phases[1].Duration)
+	assert.Equal(t, payloads{{Path: "users.csv", Fields: []string{"user"}}}, script.Config.Payload)
+	require.Len(t, script.Scenarios, 1)
+	require.Len(t, script.Scenarios[0].Flow, 1)
+}
+
+func TestValue(t *testing.T) {
+	t.Parallel()
+	c := &converter{}
+	assert.Equal(t, `"plain"`, c.value("plain", "path"))
+	assert.Equal(t, `vars["id"]`, c.value("{{ id }}", "path"))
+	assert.Equal(t, "`/users/${vars[\"id\"]}?env=${__ENV[\"ENV\"]}`", c.value("/users/{{id}}?env={{ $env.ENV }}", "path"))
+	assert.Equal(t, "`\\` ${loopElement}`", c.value("` {{ $loopElement }}", "path"))
+	assert.Empty(t, c.unsupported)
+
+	assert.Equal(t, "`id-{{ $uuid() }}`", c.value("id-{{ $uuid() }}", "path"))
+	assert.Equal(t, []string{"path: the template {{ $uuid() }} is not supported, it was kept as text"}, c.unsupported)
+}
+
+func TestJSONSelector(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{"$.id": "id", "$.items[0].id": "items.0.id", "$[1].name": "1.name"}
+	for path, expected := range testCases {
+		selector, ok := jsonSelector(path)
+		assert.True(t, ok, path)
+		assert.Equal(t, expected, selector)
+	}
+	for _, path := range []string{"$", "$..id", "$.items[*].id", "id"} {
+		_, ok := jsonSelector(path)
+		assert.False(t, ok, path)
+	}
+}
+
+func TestArrivalRateScenario(t *testing.T) {
+	t.Parallel()
+	c := &converter{script: &Script{Config: Config{Phases: []Phase{
+		{Duration: 10, ArrivalRate: 2.5},
+		{Duration: 10, ArrivalRate: 4, MaxVusers: 3},
+	}}}}
+	scenario, err := c.arrivalRateScenario()
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"executor":        "ramping-arrival-rate",
+		"startRate":       int64(3),
+		"timeUnit":        "1s",
+		"preAllocatedVUs": int64(3),
+		"maxVUs":          int64(3),
+		"stages": []stage{
+			{Duration: "10s", Target: 3},
+			{Duration: "0s", Target: 4},
+			{Duration: "10s", Target: 4},
+		},
+	}, scenario)
+	assert.Equal(t, []string{"config.phases[0]: the arrival rate 2.5 per 1s was rounded to 3"}, c.unsupported)
+
+	c = &converter{script: &Script{Config: Config{Phases: []Phase{{ArrivalRate: 1}}}}}
+	_, err = c.arrivalRateScenario()
+	assert.EqualError(t, err, "the config doesn't have any phases that can be converted")
+}
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+	f, err := os.Open("testdata/shop.yml")
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	script, err := Decode(f)
+	require.NoError(t, err)
+	expected, err := ioutil.ReadFile("testdata/shop.js")
+	require.NoError(t, err)
+
+	result, err := Convert(script)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), result.Script)
+	assert.Equal(t, []string{
+		"config.processor: custom JS functions are not supported, the steps that use them were skipped",
+		`scenarios[2] "Socket": the ws engine is not supported, it was skipped`,
+		`scenarios[1] "Buy" › flow[2]: the function step is not supported, it was skipped`,
+	}, result.Unsupported)
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/users.csv", []byte("username,password\nadmin,123\n"), 0o644))
+	_, err = js.New(testutils.NewLogger(t), &loader.SourceData{
+		URL:  &url.URL{Scheme: "file", Path: "/script.js"},
+		Data: []byte(result.Script),
+	}, map[string]afero.Fs{"file": fs}, lib.RuntimeOptions{})
+	assert.NoError(t, err)
+}
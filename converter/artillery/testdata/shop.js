@@ -0,0 +1,92 @@
+import http from 'k6/http';
+import { check, sleep } from 'k6';
+
+// Converted from an Artillery script
+
+const payload1 = open("users.csv").split(/\r?\n/).slice(1).filter((l) => l !== "").map((l) => l.split(","));
+
+export let options = {
+    "insecureSkipTLSVerify": true,
+    "scenarios": {
+        "phases": {
+            "executor": "ramping-arrival-rate",
+            "maxVUs": 200,
+            "preAllocatedVUs": 20,
+            "stages": [
+                {
+                    "duration": "60s",
+                    "target": 300
+                },
+                {
+                    "duration": "120s",
+                    "target": 1200
+                },
+                {
+                    "duration": "0s",
+                    "target": 0
+                },
+                {
+                    "duration": "30s",
+                    "target": 0
+                },
+                {
+                    "duration": "0s",
+                    "target": 90
+                },
+                {
+                    "duration": "60s",
+                    "target": 90
+                }
+            ],
+            "startRate": 300,
+            "timeUnit": "1m"
+        }
+    },
+    "thresholds": {
+        "http_req_duration": [
+            "p(95)<=250"
+        ],
+        "http_req_failed": [
+            "rate<=0.01"
+        ]
+    }
+};
+
+export default function () {
+	let vars = {};
+	vars["color"] = ["red", "blue"][Math.floor(Math.random() * 2)];
+	let payload1Row = payload1[Math.floor(Math.random() * payload1.length)];
+	vars["username"] = payload1Row[0];
+	vars["password"] = payload1Row[1];
+	const pick = Math.random() * 4;
+	if (pick < 3) {
+		Browse(vars);
+	} else {
+		Buy(vars);
+	}
+}
+
+function Browse(vars) {
+	let res;
+	res = http.request("GET", `https://test.k6.io/products?color=${vars["color"]}`, null, { headers: { "User-Agent": "Artillery" }, tags: { name: "https://test.k6.io/products?color={{ color }}" } });
+	check(res, {
+		"statusCode 200": (r) => r.status === 200,
+		"contentType json": (r) => (r.headers["Content-Type"] || "").includes("application/json"),
+	});
+	vars["id"] = res.json("items.0.id");
+	sleep(2);
+	for (const loopElement of [1, 2]) {
+		res = http.request("GET", `https://test.k6.io/products/${loopElement}`, null, { headers: { "User-Agent": "Artillery" }, tags: { name: "https://test.k6.io/products/{{ $loopElement }}" } });
+	}
+}
+
+function Buy(vars) {
+	let res;
+	res = http.request("POST", "https://test.k6.io/login", JSON.stringify({ "username": vars["username"], "password": vars["password"] }), { headers: { "User-Agent": "Artillery", "Content-Type": "application/json" } });
+	vars["session"] = res.headers["X-Session"];
+	res = http.request("POST", "https://test.k6.io/cart", { "item": Math.floor(Math.random() * (10 - 1 + 1)) + 1, "quantity": 1 }, { headers: { "User-Agent": "Artillery", "X-Session": vars["session"] } });
+	// TODO: convert the function step
+	for (let loopCount = 1; loopCount <= 2; loopCount++) {
+		res = http.request("GET", `https://test.k6.io/orders?page=${loopCount}`, null, { headers: { "User-Agent": "Artillery" }, tags: { name: "https://test.k6.io/orders?page={{ $loopCount }}" } });
+	}
+}
@@ -0,0 +1,151 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package artillery converts Artillery test scripts (YAML files) to k6
+// scripts.
+package artillery
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Script is an Artillery test script.
+type Script struct {
+	Config    Config     `yaml:"config"`
+	Scenarios []Scenario `yaml:"scenarios"`
+}
+
+// Config is the config section of an Artillery test script.
+type Config struct {
+	Target       string        `yaml:"target"`
+	Phases       []Phase       `yaml:"phases"`
+	Payload      payloads      `yaml:"payload"`
+	Variables    yaml.MapSlice `yaml:"variables"`
+	Defaults     Defaults      `yaml:"defaults"`
+	TLS          TLS           `yaml:"tls"`
+	Ensure       yaml.MapSlice `yaml:"ensure"`
+	Processor    string        `yaml:"processor"`
+	Environments yaml.MapSlice `yaml:"environments"`
+	Plugins      yaml.MapSlice `yaml:"plugins"`
+}
+
+// Phase is a period of the test with an arrival rate of new virtual users.
+type Phase struct {
+	Name         string  `yaml:"name"`
+	Duration     seconds `yaml:"duration"`
+	ArrivalRate  float64 `yaml:"arrivalRate"`
+	RampTo       float64 `yaml:"rampTo"`
+	ArrivalCount float64 `yaml:"arrivalCount"`
+	Pause        seconds `yaml:"pause"`
+	MaxVusers    int64   `yaml:"maxVusers"`
+}
+
+// Payload is a CSV file with values for the variables of virtual users.
+type Payload struct {
+	Path       string   `yaml:"path"`
+	Fields     []string `yaml:"fields"`
+	Order      string   `yaml:"order"`
+	SkipHeader bool     `yaml:"skipHeader"`
+	Delimiter  string   `yaml:"delimiter"`
+}
+
+// payloads are one or more payloads, since Artillery accepts both.
+type payloads []Payload
+
+func (p *payloads) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var single Payload
+	if err := unmarshal(&single); err == nil {
+		*p = payloads{single}
+		return nil
+	}
+	var list []Payload
+	if err := unmarshal(&list); err != nil {
+		return err
+	}
+	*p = list
+	return nil
+}
+
+// Defaults are the defaults of all requests.
+type Defaults struct {
+	Headers yaml.MapSlice `yaml:"headers"`
+}
+
+// TLS are the TLS settings of the requests.
+type TLS struct {
+	RejectUnauthorized *bool `yaml:"rejectUnauthorized"`
+}
+
+// Scenario is a flow of requests that a virtual user runs.
+type Scenario struct {
+	Name   string          `yaml:"name"`
+	Weight float64         `yaml:"weight"`
+	Engine string          `yaml:"engine"`
+	Flow   []yaml.MapSlice `yaml:"flow"`
+}
+
+// seconds is a duration in seconds, which can also be written like "5m".
+type seconds float64
+
+func (s *seconds) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var f float64
+	if err := unmarshal(&f); err == nil {
+		*s = seconds(f)
+		return nil
+	}
+	var str string
+	if err := unmarshal(&str); err != nil {
+		return err
+	}
+	if f, err := strconv.ParseFloat(strings.TrimSpace(str), 64); err == nil {
+		*s = seconds(f)
+		return nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(str))
+	if err != nil {
+		return fmt.Errorf("invalid duration '%s'", str)
+	}
+	*s = seconds(d.Seconds())
+	return nil
+}
+
+// Decode reads an Artillery test script.
+func Decode(r io.Reader) (*Script, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	var script Script
+	if err := yaml.Unmarshal(data, &script); err != nil {
+		return nil, err
+	}
+	if len(script.Scenarios) == 0 {
+		return nil, errors.New("invalid Artillery script, it doesn't have any scenarios")
+	}
+	return &script, nil
+}
@@ -0,0 +1,729 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package jmeter
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// foreverDuration is the duration of the scenarios converted from thread
+// groups that loop forever, since k6 scenarios always have an end.
+const foreverDuration = 10 * 60
+
+//nolint:gochecknoglobals
+var (
+	refRe          = regexp.MustCompile(`\$\{([^{}]*)\}`)
+	varNameRe      = regexp.MustCompile(`^[\w.-]+$`)
+	propertyRe     = regexp.MustCompile(`^__(?:P|property)\(\s*([\w.-]+)\s*(?:,\s*([^,]*?)\s*)?\)$`)
+	randomRe       = regexp.MustCompile(`^__Random\(\s*(-?\d+)\s*,\s*(-?\d+)\s*(?:,\s*[\w.-]*\s*)?\)$`)
+	templateRe     = regexp.MustCompile(`^\$(\d+)\$$`)
+	identifierRe   = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+	templateEscape = strings.NewReplacer("\\", "\\\\", "`", "\\`", "${", "\\${")
+
+	reservedIdentifiers = map[string]bool{
+		"setup": true, "teardown": true, "default": true, "options": true, "http": true, "check": true,
+		"group": true, "sleep": true, "vars": true, "res": true, "function": true, "export": true,
+		"import": true, "let": true, "const": true, "var": true, "return": true, "new": true,
+	}
+)
+
+// Result is a k6 script converted from a JMeter test plan, along with the
+// elements of the plan that couldn't be converted, or only partially.
+type Result struct {
+	Script      string
+	Unsupported []string
+}
+
+type header struct {
+	name, value string
+}
+
+type csvDataSet struct {
+	data  string
+	names []string
+}
+
+// scope holds the configuration elements that apply to the samplers in a
+// part of the test plan. In JMeter, they apply to all samplers at the same
+// level and below, regardless of their position.
+type scope struct {
+	headers    []header
+	defaults   *element
+	timers     []*element
+	assertions []*element
+	extractors []*element
+	csvs       []*csvDataSet
+}
+
+type stage struct {
+	Duration string `json:"duration"`
+	Target   int64  `json:"target"`
+}
+
+type converter struct {
+	planName    string
+	variables   []element
+	init        []string
+	scenarios   map[string]map[string]interface{}
+	functions   bytes.Buffer
+	indent      int
+	identifiers map[string]bool
+	unsupported []string
+}
+
+// Convert converts the thread groups of a JMeter test plan to k6 scenarios,
+// and their samplers, controllers, assertions, extractors, CSV data sets and
+// timers to the scenario functions, where their semantics map to k6.
+func Convert(plan *TestPlan) (*Result, error) {
+	c := &converter{
+		planName:    plan.root.name(),
+		variables:   plan.root.collection("TestPlan.user_defined_variables", "Arguments.arguments"),
+		scenarios:   make(map[string]map[string]interface{}),
+		identifiers: make(map[string]bool),
+	}
+	root := c.scope(scope{}, plan.root.children, "")
+	for _, n := range plan.root.children {
+		if !n.enabled() || isConfig(n.kind()) {
+			continue
+		}
+		path := fmt.Sprintf("%s %q", n.kind(), n.name())
+		switch n.kind() {
+		case "ThreadGroup":
+			c.threadGroup(n, root, path)
+		case "SetupThreadGroup":
+			c.hookThreadGroup("setup", n, root, path)
+		case "PostThreadGroup":
+			c.hookThreadGroup("teardown", n, root, path)
+		default:
+			c.skip(path)
+		}
+	}
+	if len(c.scenarios) == 0 {
+		return nil, errors.New("the test plan doesn't contain any enabled thread groups that can be converted")
+	}
+
+	options, err := json.MarshalIndent(map[string]interface{}{"scenarios": c.scenarios}, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	b.WriteString("import http from 'k6/http';\n")
+	b.WriteString("import { check, group, sleep } from 'k6';\n\n")
+	fmt.Fprintf(&b, "// Converted from the JMeter test plan %s\n\n", quote(c.planName))
+	for _, line := range c.init {
+		b.WriteString(line + "\n")
+	}
+	if len(c.init) > 0 {
+		b.WriteString("\n")
+	}
+	fmt.Fprintf(&b, "export let options = %s;\n", options)
+	b.Write(c.functions.Bytes())
+	return &Result{Script: b.String(), Unsupported: c.unsupported}, nil
+}
+
+func (c *converter) line(format string, a ...interface{}) {
+	c.functions.WriteString(strings.Repeat("\t", c.indent))
+	fmt.Fprintf(&c.functions, format, a...)
+	c.functions.WriteString("\n")
+}
+
+func (c *converter) report(path, format string, a ...interface{}) {
+	c.unsupported = append(c.unsupported, path+": "+fmt.Sprintf(format, a...))
+}
+
+func (c *converter) skip(path string) {
+	c.report(path, "not supported, it was skipped")
+}
+
+// identifier returns a unique JS identifier, which is also a valid scenario
+// name, for the element with the given name.
+func (c *converter) identifier(name string) string {
+	id := strings.Trim(identifierRe.ReplaceAllString(name, "_"), "_")
+	if id == "" {
+		id = "threadGroup"
+	}
+	if id[0] >= '0' && id[0] <= '9' || reservedIdentifiers[id] {
+		id = "_" + id
+	}
+	unique := id
+	for i := 2; c.identifiers[unique]; i++ {
+		unique = fmt.Sprintf("%s_%d", id, i)
+	}
+	c.identifiers[unique] = true
+	return unique
+}
+
+func quote(s string) string {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// value returns a JS expression for a JMeter string, in which variable
+// references and some functions, like ${user} and ${__P(host,localhost)},
+// are replaced by their k6 equivalents.
+func (c *converter) value(s, path string) string {
+	if !strings.Contains(s, "${") {
+		return quote(s)
+	}
+	var b strings.Builder
+	b.WriteByte('`')
+	last := 0
+	for _, m := range refRe.FindAllStringSubmatchIndex(s, -1) {
+		b.WriteString(templateEscape.Replace(s[last:m[0]]))
+		ref := s[m[2]:m[3]]
+		if expr, ok := c.reference(ref); ok {
+			b.WriteString("${" + expr + "}")
+		} else {
+			c.report(path, "the function ${%s} is not supported, it was kept as text", ref)
+			b.WriteString(templateEscape.Replace(s[m[0]:m[1]]))
+		}
+		last = m[1]
+	}
+	b.WriteString(templateEscape.Replace(s[last:]))
+	b.WriteByte('`')
+	return b.String()
+}
+
+func (c *converter) reference(ref string) (string, bool) {
+	ref = strings.TrimSpace(ref)
+	if !strings.HasPrefix(ref, "__") && varNameRe.MatchString(ref) {
+		return fmt.Sprintf("vars[%s]", quote(ref)), true
+	}
+	if m := propertyRe.FindStringSubmatch(ref); m != nil {
+		if m[2] == "" {
+			return fmt.Sprintf("__ENV[%s]", quote(m[1])), true
+		}
+		return fmt.Sprintf("__ENV[%s] || %s", quote(m[1]), quote(m[2])), true
+	}
+	if m := randomRe.FindStringSubmatch(ref); m != nil {
+		return fmt.Sprintf("Math.floor(Math.random() * (%s - %s + 1)) + %s", m[2], m[1], m[1]), true
+	}
+	switch ref {
+	case "__threadNum", "__threadNum()":
+		return "__VU", true
+	case "__time", "__time()":
+		return "Date.now()", true
+	}
+	return "", false
+}
+
+// number returns the value of a numeric property, which may also be set
+// with a property function with a default, like ${__P(users,10)}.
+func (c *converter) number(e *element, name string, def int64, path string) int64 {
+	s := strings.TrimSpace(e.prop(name))
+	if s == "" {
+		return def
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v
+	}
+	if m := refRe.FindStringSubmatch(s); m != nil && m[0] == s {
+		if pm := propertyRe.FindStringSubmatch(strings.TrimSpace(m[1])); pm != nil {
+			if v, err := strconv.ParseInt(pm[2], 10, 64); err == nil {
+				return v
+			}
+		}
+	}
+	c.report(path, "the value '%s' of %s is not supported, %d was used instead", s, name, def)
+	return def
+}
+
+func isConfig(kind string) bool {
+	switch kind {
+	case "HeaderManager", "ConfigTestElement", "CookieManager", "Arguments", "CSVDataSet",
+		"ConstantTimer", "UniformRandomTimer", "ResponseAssertion", "DurationAssertion", "RegexExtractor":
+		return true
+	}
+	return false
+}
+
+// scope returns the parent scope with the configuration elements among the
+// given nodes added to it.
+func (c *converter) scope(parent scope, nodes []*node, path string) scope {
+	sc := scope{
+		headers:    append([]header(nil), parent.headers...),
+		defaults:   parent.defaults,
+		timers:     append([]*element(nil), parent.timers...),
+		assertions: append([]*element(nil), parent.assertions...),
+		extractors: append([]*element(nil), parent.extractors...),
+		csvs:       append([]*csvDataSet(nil), parent.csvs...),
+	}
+	for _, n := range nodes {
+		if !n.enabled() {
+			continue
+		}
+		elementPath := fmt.Sprintf("%s%s %q", path, n.kind(), n.name())
+		switch n.kind() {
+		case "HeaderManager":
+			for _, h := range n.collection("HeaderManager.headers") {
+				sc.headers = setHeader(sc.headers, h.prop("Header.name"), h.prop("Header.value"))
+			}
+		case "ConfigTestElement":
+			if n.attr("guiclass") == "HttpDefaultsGui" {
+				sc.defaults = n.element
+			} else {
+				c.skip(elementPath)
+			}
+		case "ConstantTimer", "UniformRandomTimer":
+			sc.timers = append(sc.timers, n.element)
+		case "ResponseAssertion", "DurationAssertion":
+			sc.assertions = append(sc.assertions, n.element)
+		case "RegexExtractor":
+			sc.extractors = append(sc.extractors, n.element)
+		case "CSVDataSet":
+			if csv := c.csvDataSet(n.element, elementPath); csv != nil {
+				sc.csvs = append(sc.csvs, csv)
+			}
+		case "Arguments":
+			c.variables = append(c.variables, n.collection("Arguments.arguments")...)
+		case "CookieManager":
+			// k6 VUs have their own cookie jars, which are reset every iteration
+		}
+	}
+	return sc
+}
+
+func setHeader(headers []header, name, value string) []header {
+	for i, h := range headers {
+		if strings.EqualFold(h.name, name) {
+			headers[i].value = value
+			return headers
+		}
+	}
+	return append(headers, header{name, value})
+}
+
+func (c *converter) csvDataSet(e *element, path string) *csvDataSet {
+	filename := e.prop("filename")
+	if filename == "" || strings.Contains(filename, "${") {
+		c.report(path, "only CSV data sets with a fixed file name are supported, it was skipped")
+		return nil
+	}
+	var names []string
+	for _, name := range strings.Split(e.prop("variableNames"), ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		c.report(path, "only CSV data sets with variable names are supported, it was skipped")
+		return nil
+	}
+	delimiter := e.prop("delimiter")
+	switch delimiter {
+	case "":
+		delimiter = ","
+	case `\t`:
+		delimiter = "\t"
+	}
+	if e.boolProp("quotedData") {
+		c.report(path, "quoted CSV data is not supported, the lines are split at every delimiter")
+	}
+
+	csv := &csvDataSet{data: fmt.Sprintf("csvData%d", len(c.init)+1), names: names}
+	skipHeader := ""
+	if e.boolProp("ignoreFirstLine") {
+		skipHeader = ".slice(1)"
+	}
+	c.init = append(c.init, fmt.Sprintf(
+		"const %s = open(%s).split(/\\r?\\n/)%s.filter((l) => l !== \"\").map((l) => l.split(%s));",
+		csv.data, quote(filename), skipHeader, quote(delimiter),
+	))
+	return csv
+}
+
+func (c *converter) threadGroup(n *node, parent scope, path string) {
+	name := c.identifier(n.name())
+	vus := c.number(n.element, "ThreadGroup.num_threads", 1, path)
+	rampUp := c.number(n.element, "ThreadGroup.ramp_time", 0, path)
+	loops := int64(1)
+	if lc := n.child("ThreadGroup.main_controller"); lc != nil {
+		loops = c.number(lc, "LoopController.loops", 1, path)
+		if lc.boolProp("LoopController.continue_forever") && loops <= 0 {
+			loops = -1
+		}
+	}
+	scheduler := n.boolProp("ThreadGroup.scheduler")
+	duration := int64(0)
+	if scheduler {
+		duration = c.number(n.element, "ThreadGroup.duration", 0, path)
+	}
+
+	scenario := map[string]interface{}{"exec": name}
+	switch {
+	case duration > 0:
+		if loops > 0 {
+			c.report(path, "the loop count is not supported along with a duration, only the duration was converted")
+		}
+		if rampUp > 0 && rampUp < duration {
+			scenario["executor"] = "ramping-vus"
+			scenario["startVUs"] = 0
+			scenario["stages"] = []stage{
+				{Duration: fmt.Sprintf("%ds", rampUp), Target: vus},
+				{Duration: fmt.Sprintf("%ds", duration-rampUp), Target: vus},
+			}
+		} else {
+			scenario["executor"] = "constant-vus"
+			scenario["vus"] = vus
+			scenario["duration"] = fmt.Sprintf("%ds", duration)
+		}
+	case loops < 0:
+		c.report(path, "looping forever is not supported, it was converted to a %ds duration", foreverDuration)
+		scenario["executor"] = "constant-vus"
+		scenario["vus"] = vus
+		scenario["duration"] = fmt.Sprintf("%ds", foreverDuration)
+	default:
+		if rampUp > 0 {
+			c.report(path, "the ramp-up period is not supported along with a loop count, it was ignored")
+		}
+		scenario["executor"] = "per-vu-iterations"
+		scenario["vus"] = vus
+		scenario["iterations"] = loops
+	}
+	if delay := c.number(n.element, "ThreadGroup.delay", 0, path); scheduler && delay > 0 {
+		scenario["startTime"] = fmt.Sprintf("%ds", delay)
+	}
+	c.scenarios[name] = scenario
+
+	c.line("")
+	c.line("export function %s() {", name)
+	c.function(n, parent, fmt.Sprintf("__VU - 1 + __ITER * %d", vus), path)
+}
+
+// hookThreadGroup converts setUp and tearDown thread groups to the setup()
+// and teardown() functions.
+func (c *converter) hookThreadGroup(fn string, n *node, parent scope, path string) {
+	if c.identifiers[fn] {
+		c.report(path, "only one %s thread group is supported, it was skipped", fn)
+		return
+	}
+	c.identifiers[fn] = true
+	if c.number(n.element, "ThreadGroup.num_threads", 1, path) != 1 {
+		c.report(path, "the number of threads is not supported, %s() runs once", fn)
+	}
+
+	c.line("")
+	c.line("export function %s() {", fn)
+	c.function(n, parent, "0", path)
+}
+
+func (c *converter) function(n *node, parent scope, rowIndex, path string) {
+	c.indent++
+	sc := c.scope(parent, n.children, path+" › ")
+	c.line("let vars = {};")
+	for _, v := range c.variables {
+		c.line("vars[%s] = %s;", quote(v.prop("Argument.name")), c.value(v.prop("Argument.value"), path))
+	}
+	for _, csv := range sc.csvs {
+		c.line("let %sRow = %s[(%s) %% %s.length];", csv.data, csv.data, rowIndex, csv.data)
+		for i, name := range csv.names {
+			c.line("vars[%s] = %sRow[%d];", quote(name), csv.data, i)
+		}
+	}
+	c.line("let res;")
+	c.body(n.children, sc, path+" › ")
+	c.indent--
+	c.line("}")
+}
+
+func (c *converter) body(nodes []*node, sc scope, path string) {
+	for _, n := range nodes {
+		if !n.enabled() || isConfig(n.kind()) {
+			continue
+		}
+		elementPath := fmt.Sprintf("%s%s %q", path, n.kind(), n.name())
+		switch n.kind() {
+		case "HTTPSamplerProxy":
+			c.sampler(n, sc, elementPath)
+		case "TransactionController":
+			c.line("group(%s, function () {", c.value(n.name(), elementPath))
+			c.indent++
+			c.body(n.children, c.scope(sc, n.children, elementPath+" › "), elementPath+" › ")
+			c.indent--
+			c.line("});")
+		case "LoopController":
+			loops := c.number(n.element, "LoopController.loops", 1, elementPath)
+			if loops < 0 {
+				c.report(elementPath, "looping forever is not supported, it loops once")
+				loops = 1
+			}
+			c.line("for (let i = 0; i < %d; i++) {", loops)
+			c.block(n, sc, elementPath)
+		case "OnceOnlyController":
+			c.line("if (__ITER === 0) {")
+			c.block(n, sc, elementPath)
+		case "GenericController":
+			c.line("// %s", n.name())
+			c.line("{")
+			c.block(n, sc, elementPath)
+		default:
+			if strings.HasSuffix(n.kind(), "Controller") {
+				c.report(elementPath, "not supported, its elements were converted as if they were always executed")
+				c.line("// TODO: convert the %s %s", n.kind(), quote(n.name()))
+				c.line("{")
+				c.block(n, sc, elementPath)
+				continue
+			}
+			c.skip(elementPath)
+		}
+	}
+}
+
+func (c *converter) block(n *node, sc scope, path string) {
+	c.indent++
+	c.body(n.children, c.scope(sc, n.children, path+" › "), path+" › ")
+	c.indent--
+	c.line("}")
+}
+
+// samplerURL returns the URL of a HTTP sampler, with the protocol, host and
+// port from the HTTP Request Defaults, if they aren't set.
+func samplerURL(e, defaults *element) string {
+	get := func(name string) string {
+		v := e.prop("HTTPSampler." + name)
+		if v == "" && defaults != nil {
+			v = defaults.prop("HTTPSampler." + name)
+		}
+		return strings.TrimSpace(v)
+	}
+	path := get("path")
+	if strings.HasPrefix(path, "http://") || strings.HasPrefix(path, "https://") {
+		return path
+	}
+	protocol, domain, port := strings.ToLower(get("protocol")), get("domain"), get("port")
+	if protocol == "" {
+		protocol = "http"
+		if port == "443" {
+			protocol = "https"
+		}
+	}
+	u := protocol + "://" + domain
+	if port != "" && !(protocol == "http" && port == "80") && !(protocol == "https" && port == "443") {
+		u += ":" + port
+	}
+	if path != "" && !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return u + path
+}
+
+func (c *converter) sampler(n *node, parent scope, path string) {
+	sc := c.scope(parent, n.children, path+" › ")
+	for _, child := range n.children {
+		if child.enabled() && !isConfig(child.kind()) {
+			c.skip(fmt.Sprintf("%s › %s %q", path, child.kind(), child.name()))
+		}
+	}
+	for _, t := range sc.timers {
+		c.timer(t, path)
+	}
+
+	method := strings.ToUpper(strings.TrimSpace(n.prop("HTTPSampler.method")))
+	if method == "" {
+		method = "GET"
+	}
+	rawURL := samplerURL(n.element, sc.defaults)
+	body := "null"
+	args := n.collection("HTTPsampler.Arguments", "Arguments.arguments")
+	switch {
+	case len(args) == 0:
+	case n.boolProp("HTTPSampler.postBodyRaw"):
+		body = c.value(args[0].prop("Argument.value"), path)
+	case method == "POST" || method == "PUT" || method == "PATCH":
+		fields := make([]string, len(args))
+		for i, a := range args {
+			fields[i] = quote(a.prop("Argument.name")) + ": " + c.value(a.prop("Argument.value"), path)
+		}
+		body = "{ " + strings.Join(fields, ", ") + " }"
+	default:
+		query := make([]string, len(args))
+		for i, a := range args {
+			query[i] = a.prop("Argument.name") + "=" + a.prop("Argument.value")
+		}
+		separator := "?"
+		if strings.Contains(rawURL, "?") {
+			separator = "&"
+		}
+		rawURL += separator + strings.Join(query, "&")
+	}
+	if len(n.collection("HTTPsampler.Files", "HTTPFileArgs.files")) > 0 {
+		c.report(path, "file uploads are not supported, they were skipped")
+	}
+
+	params := ""
+	if len(sc.headers) > 0 {
+		headers := make([]string, len(sc.headers))
+		for i, h := range sc.headers {
+			headers[i] = quote(h.name) + ": " + c.value(h.value, path)
+		}
+		params = "headers: { " + strings.Join(headers, ", ") + " }, "
+	}
+	params += "tags: { name: " + c.value(n.name(), path) + " }"
+	c.line("res = http.request(%s, %s, %s, { %s });", quote(method), c.value(rawURL, path), body, params)
+
+	c.checks(sc.assertions, path)
+	for _, e := range sc.extractors {
+		c.extractor(e, path)
+	}
+}
+
+func (c *converter) timer(t *element, path string) {
+	delay, err := strconv.ParseFloat(strings.TrimSpace(t.prop("ConstantTimer.delay")), 64)
+	if err != nil {
+		c.report(path, "the delay of the %s %s is not supported, it was skipped", t.kind(), quote(t.name()))
+		return
+	}
+	if t.kind() == "ConstantTimer" {
+		c.line("sleep(%s);", strconv.FormatFloat(delay/1000, 'f', -1, 64))
+		return
+	}
+	rng, err := strconv.ParseFloat(strings.TrimSpace(t.prop("RandomTimer.range")), 64)
+	if err != nil {
+		c.report(path, "the range of the %s %s is not supported, it was skipped", t.kind(), quote(t.name()))
+		return
+	}
+	c.line("sleep((%s + Math.random() * %s) / 1000);",
+		strconv.FormatFloat(delay, 'f', -1, 64), strconv.FormatFloat(rng, 'f', -1, 64))
+}
+
+func (c *converter) checks(assertions []*element, path string) {
+	var lines []string
+	names := make(map[string]bool)
+	for _, a := range assertions {
+		expr, ok := c.assertion(a, path)
+		if !ok {
+			continue
+		}
+		name := a.name()
+		if name == "" {
+			name = a.kind()
+		}
+		unique := name
+		for i := 2; names[unique]; i++ {
+			unique = fmt.Sprintf("%s (%d)", name, i)
+		}
+		names[unique] = true
+		lines = append(lines, fmt.Sprintf("%s: (r) => %s,", quote(unique), expr))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	c.line("check(res, {")
+	c.indent++
+	for _, l := range lines {
+		c.line("%s", l)
+	}
+	c.indent--
+	c.line("});")
+}
+
+// Response assertion test types, the "not" and "or" types are flags
+const (
+	assertMatches   = 1
+	assertContains  = 2
+	assertNot       = 4
+	assertEquals    = 8
+	assertSubstring = 16
+	assertOr        = 32
+)
+
+func (c *converter) assertion(a *element, path string) (string, bool) {
+	assertionPath := fmt.Sprintf("%s › %s %q", path, a.kind(), a.name())
+	if a.kind() == "DurationAssertion" {
+		d, err := strconv.ParseInt(strings.TrimSpace(a.prop("DurationAssertion.duration")), 10, 64)
+		if err != nil {
+			c.report(assertionPath, "the duration is not supported, it was skipped")
+			return "", false
+		}
+		return fmt.Sprintf("r.timings.duration <= %d", d), true
+	}
+
+	var subject string
+	switch a.prop("Assertion.test_field") {
+	case "Assertion.response_code":
+		subject = "String(r.status)"
+	case "Assertion.response_data", "":
+		subject = `(r.body || "")`
+	default:
+		c.report(assertionPath, "the field %s is not supported, it was skipped", a.prop("Assertion.test_field"))
+		return "", false
+	}
+	testType, _ := strconv.Atoi(strings.TrimSpace(a.prop("Assertion.test_type")))
+	// JMeter has a typo in the property name, but the newer versions fixed it
+	patterns := a.collection("Asserion.test_strings")
+	if patterns == nil {
+		patterns = a.collection("Assertion.test_strings")
+	}
+	if len(patterns) == 0 {
+		c.report(assertionPath, "assertions without patterns are not supported, it was skipped")
+		return "", false
+	}
+
+	exprs := make([]string, len(patterns))
+	for i, p := range patterns {
+		v := c.value(p.Text, assertionPath)
+		switch testType &^ (assertNot | assertOr) {
+		case assertMatches:
+			exprs[i] = fmt.Sprintf(`new RegExp("^(?:" + %s + ")$").test(%s)`, v, subject)
+		case assertContains:
+			exprs[i] = fmt.Sprintf("new RegExp(%s).test(%s)", v, subject)
+		case assertEquals:
+			exprs[i] = fmt.Sprintf("%s === %s", subject, v)
+		case assertSubstring:
+			exprs[i] = fmt.Sprintf("%s.includes(%s)", subject, v)
+		default:
+			c.report(assertionPath, "the test type %d is not supported, it was skipped", testType)
+			return "", false
+		}
+		if testType&assertNot != 0 {
+			exprs[i] = "!(" + exprs[i] + ")"
+		}
+	}
+	if testType&assertOr != 0 {
+		return strings.Join(exprs, " || "), true
+	}
+	return strings.Join(exprs, " && "), true
+}
+
+func (c *converter) extractor(e *element, path string) {
+	extractorPath := fmt.Sprintf("%s › %s %q", path, e.kind(), e.name())
+	m := templateRe.FindStringSubmatch(strings.TrimSpace(e.prop("RegexExtractor.template")))
+	matchNumber := strings.TrimSpace(e.prop("RegexExtractor.match_number"))
+	useHeaders := e.prop("RegexExtractor.useHeaders")
+	if m == nil || (matchNumber != "" && matchNumber != "1") || (useHeaders != "" && useHeaders != "false") {
+		c.report(extractorPath, "only extracting a single group of the first match in the body is supported, "+
+			"it was skipped")
+		return
+	}
+	c.line("vars[%s] = ((m) => m ? m[%s] : %s)((res.body || \"\").match(new RegExp(%s)));",
+		quote(e.prop("RegexExtractor.refname")), m[1],
+		c.value(e.prop("RegexExtractor.default"), extractorPath),
+		c.value(e.prop("RegexExtractor.regex"), extractorPath))
+}
@@ -0,0 +1,130 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package jmeter
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js"
+	"github.com/loadimpact/k6/lib"
+	_ "github.com/loadimpact/k6/lib/executor" // for the executors of the converted scenarios
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/loader"
+)
+
+func TestDecode(t *testing.T) {
+	t.Parallel()
+	_, err := Decode(strings.NewReader(`<html></html>`))
+	assert.EqualError(t, err, "invalid JMX file, the root element should be jmeterTestPlan")
+
+	_, err = Decode(strings.NewReader(`<jmeterTestPlan><hashTree></hashTree></jmeterTestPlan>`))
+	assert.EqualError(t, err, "invalid JMX file, it doesn't contain a TestPlan element")
+
+	plan, err := Decode(strings.NewReader(`<jmeterTestPlan><hashTree>
+		<TestPlan testname="Plan"/><hashTree><ThreadGroup testname="Users"/><hashTree/></hashTree>
+	</hashTree></jmeterTestPlan>`))
+	require.NoError(t, err)
+	assert.Equal(t, "Plan", plan.root.name())
+	require.Len(t, plan.root.children, 1)
+	assert.Equal(t, "ThreadGroup", plan.root.children[0].kind())
+}
+
+func TestValue(t *testing.T) {
+	t.Parallel()
+	c := &converter{}
+	assert.Equal(t, `"plain \"text\""`, c.value(`plain "text"`, "path"))
+	assert.Equal(t, "`${vars[\"user\"]}:${__ENV[\"pass\"]}`", c.value("${user}:${__P(pass)}", "path"))
+	assert.Equal(t, "`${__VU} \\` \\\\ ${__ENV[\"env\"] || \"dev\"}`", c.value("${__threadNum} ` \\ ${__P(env,dev)}", "path"))
+	assert.Empty(t, c.unsupported)
+
+	assert.Equal(t, "`id-\\${__UUID()}`", c.value("id-${__UUID()}", "path"))
+	assert.Equal(t, []string{"path: the function ${__UUID()} is not supported, it was kept as text"}, c.unsupported)
+}
+
+func TestNumber(t *testing.T) {
+	t.Parallel()
+	c := &converter{}
+	e := &element{Children: []element{
+		{Attrs: attrs("name", "a"), Text: "10"},
+		{Attrs: attrs("name", "b"), Text: "${__P(b,5)}"},
+		{Attrs: attrs("name", "c"), Text: "${c}"},
+	}}
+	assert.Equal(t, int64(10), c.number(e, "a", 1, "path"))
+	assert.Equal(t, int64(5), c.number(e, "b", 1, "path"))
+	assert.Equal(t, int64(1), c.number(e, "c", 1, "path"))
+	assert.Equal(t, int64(2), c.number(e, "d", 2, "path"))
+	assert.Equal(t, []string{"path: the value '${c}' of c is not supported, 1 was used instead"}, c.unsupported)
+}
+
+func TestConvertNoThreadGroups(t *testing.T) {
+	t.Parallel()
+	plan, err := Decode(strings.NewReader(`<jmeterTestPlan><hashTree>
+		<TestPlan testname="Plan"/><hashTree><ThreadGroup testname="Users" enabled="false"/><hashTree/></hashTree>
+	</hashTree></jmeterTestPlan>`))
+	require.NoError(t, err)
+	_, err = Convert(plan)
+	assert.EqualError(t, err, "the test plan doesn't contain any enabled thread groups that can be converted")
+}
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+	f, err := os.Open("testdata/plan.jmx")
+	require.NoError(t, err)
+	defer func() { _ = f.Close() }()
+	plan, err := Decode(f)
+	require.NoError(t, err)
+	expected, err := ioutil.ReadFile("testdata/plan.js")
+	require.NoError(t, err)
+
+	result, err := Convert(plan)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), result.Script)
+	assert.Equal(t, []string{
+		`ThreadGroup "Browsing users" › IfController "Sometimes": not supported, ` +
+			`its elements were converted as if they were always executed`,
+		`ResultCollector "View Results Tree": not supported, it was skipped`,
+	}, result.Unsupported)
+
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/products.csv", []byte("id,name\n1,shoes\n"), 0o644))
+	_, err = js.New(testutils.NewLogger(t), &loader.SourceData{
+		URL:  &url.URL{Scheme: "file", Path: "/script.js"},
+		Data: []byte(result.Script),
+	}, map[string]afero.Fs{"file": fs}, lib.RuntimeOptions{})
+	assert.NoError(t, err)
+}
+
+func attrs(nameValues ...string) []xml.Attr {
+	result := make([]xml.Attr, 0, len(nameValues)/2)
+	for i := 0; i+1 < len(nameValues); i += 2 {
+		result = append(result, xml.Attr{Name: xml.Name{Local: nameValues[i]}, Value: nameValues[i+1]})
+	}
+	return result
+}
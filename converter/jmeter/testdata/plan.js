@@ -0,0 +1,59 @@
+import http from 'k6/http';
+import { check, group, sleep } from 'k6';
+
+// Converted from the JMeter test plan "Shop"
+
+const csvData1 = open("products.csv").split(/\r?\n/).slice(1).filter((l) => l !== "").map((l) => l.split(","));
+
+export let options = {
+    "scenarios": {
+        "Browsing_users": {
+            "exec": "Browsing_users",
+            "executor": "ramping-vus",
+            "stages": [
+                {
+                    "duration": "30s",
+                    "target": 20
+                },
+                {
+                    "duration": "270s",
+                    "target": 20
+                }
+            ],
+            "startTime": "5s",
+            "startVUs": 0
+        }
+    }
+};
+
+export function setup() {
+	let vars = {};
+	vars["host"] = `${__ENV["host"] || "test.k6.io"}`;
+	let res;
+	res = http.request("DELETE", `https://${vars["host"]}/reset`, null, { headers: { "Accept": "application/json" }, tags: { name: "Reset" } });
+}
+
+export function Browsing_users() {
+	let vars = {};
+	vars["host"] = `${__ENV["host"] || "test.k6.io"}`;
+	let csvData1Row = csvData1[(__VU - 1 + __ITER * 20) % csvData1.length];
+	vars["id"] = csvData1Row[0];
+	vars["name"] = csvData1Row[1];
+	let res;
+	group("Product page", function () {
+		sleep((1000 + Math.random() * 2000) / 1000);
+		res = http.request("GET", `https://${vars["host"]}/products?id=${vars["id"]}`, null, { headers: { "Accept": "application/json" }, tags: { name: "Product" } });
+		check(res, {
+			"Is OK": (r) => String(r.status) === "200",
+			"Has name": (r) => (r.body || "").includes(`${vars["name"]}`),
+		});
+		vars["price"] = ((m) => m ? m[1] : "0")((res.body || "").match(new RegExp("\"price\":\\s*([\\d.]+)")));
+		sleep((1000 + Math.random() * 2000) / 1000);
+		res = http.request("POST", `https://${vars["host"]}/cart`, `{"id": ${vars["id"]}, "price": ${vars["price"]}}`, { headers: { "Accept": "application/json", "Content-Type": "application/json" }, tags: { name: "Add to cart" } });
+	});
+	// TODO: convert the IfController "Sometimes"
+	{
+		sleep((1000 + Math.random() * 2000) / 1000);
+		res = http.request("POST", `https://${vars["host"]}/login`, { "user": `user${Math.floor(Math.random() * (100 - 1 + 1)) + 1}` }, { headers: { "Accept": "application/json" }, tags: { name: "Login" } });
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package jmeter converts JMeter test plans (.jmx files) to k6 scripts.
+package jmeter
+
+import (
+	"encoding/xml"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// element is a generic XML element of a JMX file. Test plan elements, like
+// ThreadGroup or HTTPSamplerProxy, keep their settings in property children,
+// like <stringProp name="HTTPSampler.path">/</stringProp>.
+type element struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr `xml:",any,attr"`
+	Children []element  `xml:",any"`
+	Text     string     `xml:",chardata"`
+}
+
+func (e *element) attr(name string) string {
+	for _, a := range e.Attrs {
+		if a.Name.Local == name {
+			return a.Value
+		}
+	}
+	return ""
+}
+
+// kind returns the type of the test plan element, e.g. ThreadGroup.
+func (e *element) kind() string {
+	return e.XMLName.Local
+}
+
+// name returns the name the element was given in the JMeter UI.
+func (e *element) name() string {
+	return e.attr("testname")
+}
+
+func (e *element) enabled() bool {
+	return e.attr("enabled") != "false"
+}
+
+// child returns the property child element with the given name, if any.
+func (e *element) child(name string) *element {
+	for i := range e.Children {
+		if e.Children[i].attr("name") == name {
+			return &e.Children[i]
+		}
+	}
+	return nil
+}
+
+// prop returns the value of a stringProp, intProp, boolProp, etc. child.
+func (e *element) prop(name string) string {
+	if c := e.child(name); c != nil {
+		return c.Text
+	}
+	return ""
+}
+
+func (e *element) boolProp(name string) bool {
+	b, _ := strconv.ParseBool(strings.TrimSpace(e.prop(name)))
+	return b
+}
+
+// collection returns the elements of a collectionProp, or of the
+// collectionProp of an elementProp, like the arguments of a HTTP sampler.
+func (e *element) collection(names ...string) []element {
+	c := e
+	for _, name := range names {
+		if c = c.child(name); c == nil {
+			return nil
+		}
+	}
+	return c.Children
+}
+
+// node is an element of the test plan with the elements it contains. In JMX
+// files, the contained elements are in the <hashTree> sibling that follows
+// every element.
+type node struct {
+	*element
+	children []*node
+}
+
+func buildTree(hashTree *element) []*node {
+	var nodes []*node
+	for i := range hashTree.Children {
+		c := &hashTree.Children[i]
+		if c.kind() == "hashTree" {
+			if len(nodes) > 0 {
+				nodes[len(nodes)-1].children = buildTree(c)
+			}
+			continue
+		}
+		nodes = append(nodes, &node{element: c})
+	}
+	return nodes
+}
+
+// TestPlan is a decoded JMeter test plan.
+type TestPlan struct {
+	root *node
+}
+
+// Decode reads a JMeter test plan from a JMX file.
+func Decode(r io.Reader) (*TestPlan, error) {
+	var doc element
+	if err := xml.NewDecoder(r).Decode(&doc); err != nil {
+		return nil, err
+	}
+	if doc.kind() != "jmeterTestPlan" {
+		return nil, errors.New("invalid JMX file, the root element should be jmeterTestPlan")
+	}
+	for i := range doc.Children {
+		if doc.Children[i].kind() != "hashTree" {
+			continue
+		}
+		for _, n := range buildTree(&doc.Children[i]) {
+			if n.kind() == "TestPlan" {
+				return &TestPlan{root: n}, nil
+			}
+		}
+	}
+	return nil, errors.New("invalid JMX file, it doesn't contain a TestPlan element")
+}
@@ -0,0 +1,253 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+// How often the checkpoint file is saved, if not configured.
+const defaultCheckpointInterval = 1 * time.Minute
+
+// Checkpoint returns a snapshot of the progress of the test run and of the
+// cumulative values of all metrics, including the ones of the test run that
+// was resumed, if any. If a checkpoint file is configured, the trend values
+// are only the ones added since the previous checkpoint, which the checkpoint
+// writer appends to the ones it already saved.
+func (e *Engine) Checkpoint() (*lib.Checkpoint, error) {
+	checkpoint := &lib.Checkpoint{
+		Elapsed:               types.Duration(e.executionState.GetCurrentTestRunDuration()),
+		FullIterations:        e.executionState.GetFullIterationCount(),
+		InterruptedIterations: e.executionState.GetPartialIterationCount(),
+		Scenarios:             make(map[string]uint64),
+		Metrics:               make(map[string]lib.MetricCheckpoint),
+		SetupData:             e.ExecutionScheduler.GetRunner().GetSetupData(),
+
+		ExecutionSegment:         e.executionState.Options.ExecutionSegment,
+		ExecutionSegmentSequence: e.executionState.Options.ExecutionSegmentSequence,
+	}
+	if e.resumedFrom != nil {
+		checkpoint.Elapsed += e.resumedFrom.Elapsed
+		for name, iterations := range e.resumedFrom.Scenarios {
+			checkpoint.Scenarios[name] = iterations
+		}
+	}
+	for name := range e.executionState.Options.Scenarios {
+		checkpoint.Scenarios[name] += e.executionState.GetScenarioFullIterationCount(name)
+	}
+
+	// Only copies of the sinks are taken while the metrics are locked, they
+	// are serialized afterwards
+	sinks := make(map[string]stats.Sink)
+	e.MetricsLock.Lock()
+	for name, m := range e.Metrics {
+		sink, values := copySink(m.Sink)
+		sinks[name] = sink
+		checkpoint.Metrics[name] = lib.MetricCheckpoint{
+			Type: m.Type, Contains: m.Contains, Unit: m.Unit, Description: m.Description, Values: values,
+		}
+	}
+	e.MetricsLock.Unlock()
+
+	for name, sink := range sinks {
+		data, err := json.Marshal(sink)
+		if err != nil {
+			return nil, err
+		}
+		mc := checkpoint.Metrics[name]
+		mc.Sink = data
+		checkpoint.Metrics[name] = mc
+	}
+	return checkpoint, nil
+}
+
+// copySink returns a copy of the sink for the checkpoint. Trend sinks are
+// copied without their values, which are returned separately: either the ones
+// added since the previous checkpoint, if the sink keeps track of them, or a
+// copy of all of them.
+func copySink(sink stats.Sink) (stats.Sink, []float64) {
+	switch sink := sink.(type) {
+	case *stats.CounterSink:
+		c := *sink
+		return &c, nil
+	case *stats.GaugeSink:
+		c := *sink
+		return &c, nil
+	case *stats.RateSink:
+		c := *sink
+		return &c, nil
+	case *stats.TrendSink:
+		values := sink.TakeNewValues()
+		if !sink.TracksNewValues() {
+			values = append([]float64(nil), sink.Values...)
+		}
+		return &stats.TrendSink{
+			Count: sink.Count, Min: sink.Min, Max: sink.Max, Sum: sink.Sum, Avg: sink.Avg,
+		}, values
+	case *stats.HistogramSink:
+		c := &stats.HistogramSink{}
+		c.Merge(sink)
+		return c, nil
+	default:
+		return sink, nil
+	}
+}
+
+// Resume restores the metrics and the iteration counts from the checkpoint of
+// an earlier test run, which the current one continues. It should be called
+// before Init().
+func (e *Engine) Resume(checkpoint *lib.Checkpoint) error {
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+
+	// The submetrics are restored only after all of the metrics, since they
+	// are attached to their parents.
+	for name, mc := range checkpoint.Metrics {
+		if strings.Contains(name, "{") {
+			continue
+		}
+		m := e.newMetric(name, mc.Type, mc.Contains)
+		m.Unit, m.Description = mc.Unit, mc.Description
+		m.Thresholds = e.thresholds[name]
+		m.Submetrics = e.submetrics[name]
+		if err := restoreSink(m.Sink, mc); err != nil {
+			return err
+		}
+		e.Metrics[name] = m
+	}
+	for name, mc := range checkpoint.Metrics {
+		parent := strings.SplitN(name, "{", 2)[0]
+		for _, sm := range e.submetrics[parent] {
+			if sm.Name != name {
+				continue
+			}
+			sm.Metric = e.newMetric(name, mc.Type, mc.Contains)
+			sm.Metric.Unit, sm.Metric.Description = mc.Unit, mc.Description
+			sm.Metric.Sub = *sm
+			sm.Metric.Thresholds = e.thresholds[name]
+			if err := restoreSink(sm.Metric.Sink, mc); err != nil {
+				return err
+			}
+			e.Metrics[name] = sm.Metric
+		}
+	}
+
+	e.executionState.AddFullIterations(checkpoint.FullIterations)
+	e.executionState.AddInterruptedIterations(checkpoint.InterruptedIterations)
+	e.resumedFrom = checkpoint
+	return nil
+}
+
+// restoreSink adds the values from the checkpoint of a metric of the same type
+// to the given empty sink. Gauges and trends are restored by adding their
+// values as samples, since their sinks have some internal state, and histograms
+// are merged.
+func restoreSink(sink stats.Sink, mc lib.MetricCheckpoint) error {
+	data := mc.Sink
+	switch sink := sink.(type) {
+	case *stats.CounterSink, *stats.RateSink:
+		return json.Unmarshal(data, sink)
+	case *stats.GaugeSink:
+		var gauge stats.GaugeSink
+		if err := json.Unmarshal(data, &gauge); err != nil {
+			return err
+		}
+		for _, value := range []float64{gauge.Min, gauge.Max, gauge.Value} {
+			sink.Add(stats.Sample{Value: value})
+		}
+	case *stats.TrendSink:
+		values := mc.Values
+		if values == nil {
+			var trend stats.TrendSink
+			if err := json.Unmarshal(data, &trend); err != nil {
+				return err
+			}
+			values = trend.Values
+		}
+		for _, value := range values {
+			sink.Add(stats.Sample{Value: value})
+		}
+	case *stats.HistogramSink:
+		var histogram stats.HistogramSink
+		if err := json.Unmarshal(data, &histogram); err != nil {
+			return err
+		}
+		sink.Merge(&histogram)
+	}
+	return nil
+}
+
+// runCheckpoints periodically saves the checkpoint file while the test is
+// running. The last one is saved by the metrics processing, after the test
+// run has finished and its remaining metrics have been processed.
+func (e *Engine) runCheckpoints(runCtx context.Context) {
+	interval := time.Duration(e.runtimeOptions.CheckpointInterval.Duration)
+	if interval <= 0 {
+		interval = defaultCheckpointInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if e.executionState.GetCurrentExecutionStatus() == lib.ExecutionStatusRunning {
+				e.saveCheckpoint(false)
+			}
+		case <-runCtx.Done():
+			return
+		}
+	}
+}
+
+// saveCheckpoint writes the current checkpoint to the checkpoint file. Once
+// the final one is saved, any later periodic ones are ignored, since they may
+// have been taken before it.
+func (e *Engine) saveCheckpoint(final bool) {
+	e.checkpointMu.Lock()
+	defer e.checkpointMu.Unlock()
+	if e.savedFinalCheckpoint {
+		return
+	}
+	e.savedFinalCheckpoint = final
+
+	if e.checkpointWriter == nil {
+		e.checkpointWriter = lib.NewCheckpointWriter(afero.NewOsFs(), e.runtimeOptions.CheckpointFile.String)
+	}
+	checkpoint, err := e.Checkpoint()
+	if err == nil {
+		err = e.checkpointWriter.Save(checkpoint)
+	}
+	if err != nil {
+		e.logger.WithError(err).Warn("Couldn't save the checkpoint of the test run")
+		return
+	}
+	e.logger.WithField("elapsed", checkpoint.Elapsed).Debug("Saved the checkpoint of the test run")
+}
@@ -0,0 +1,242 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package distributed
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/consts"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/output"
+)
+
+// ErrAborted is the reason for stopping the test run of an agent, when the
+// coordinator tells it to stop.
+var ErrAborted = errors.New("the test run was stopped by the coordinator")
+
+// Agent is a connection of an agent to the coordinator.
+type Agent struct {
+	logger     logrus.FieldLogger
+	conn       *grpc.ClientConn
+	instanceID int
+}
+
+// Work is the part of the test run that the coordinator assigned to an agent.
+type Work struct {
+	InstanceID               int
+	Instances                int
+	Archive                  []byte
+	ExecutionSegment         *lib.ExecutionSegment
+	ExecutionSegmentSequence *lib.ExecutionSegmentSequence
+	// Whether the coordinator runs in FIPS mode, so the agent should too
+	FIPSMode bool
+}
+
+// Connect connects to the coordinator at the given address.
+func Connect(ctx context.Context, address string, security Security, logger logrus.FieldLogger) (*Agent, error) {
+	dialOpts := []grpc.DialOption{
+		grpc.WithBlock(),
+		grpc.WithDefaultCallOptions(
+			grpc.ForceCodec(jsonCodec{}),
+			grpc.MaxCallRecvMsgSize(maxMessageSize),
+			grpc.MaxCallSendMsgSize(maxMessageSize),
+		),
+	}
+	if security.TLSConfig != nil {
+		dialOpts = append(dialOpts, grpc.WithTransportCredentials(credentials.NewTLS(security.TLSConfig)))
+	} else {
+		dialOpts = append(dialOpts, grpc.WithInsecure())
+	}
+	if security.Token != "" {
+		dialOpts = append(dialOpts, grpc.WithPerRPCCredentials(tokenCredentials(security.Token)))
+	}
+
+	conn, err := grpc.DialContext(ctx, address, dialOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't connect to the coordinator at %s: %w", address, err)
+	}
+	return &Agent{logger: logger, conn: conn}, nil
+}
+
+// tokenCredentials sends the token of the coordinator with every call.
+type tokenCredentials string
+
+func (t tokenCredentials) GetRequestMetadata(context.Context, ...string) (map[string]string, error) {
+	return map[string]string{authorizationKey: "Bearer " + string(t)}, nil
+}
+
+// RequireTransportSecurity returns false, since whether to use TLS is up to
+// the user, who is warned by the coordinator when it isn't used.
+func (t tokenCredentials) RequireTransportSecurity() bool {
+	return false
+}
+
+// Register registers the agent with the coordinator. It blocks until all of
+// the agents have registered and returns the work of this agent.
+func (a *Agent) Register(ctx context.Context, name string) (*Work, error) {
+	var resp registerResponse
+	req := registerRequest{Name: name, Version: consts.Version}
+	if err := a.conn.Invoke(ctx, methodRegister, &req, &resp); err != nil {
+		return nil, fmt.Errorf("couldn't register with the coordinator: %w", err)
+	}
+	a.instanceID = resp.InstanceID
+
+	segment, err := lib.NewExecutionSegmentFromString(resp.ExecutionSegment)
+	if err != nil {
+		return nil, err
+	}
+	sequence, err := lib.NewExecutionSegmentSequenceFromString(resp.ExecutionSegmentSequence)
+	if err != nil {
+		return nil, err
+	}
+	return &Work{
+		InstanceID:               resp.InstanceID,
+		Instances:                resp.Instances,
+		Archive:                  resp.Archive,
+		ExecutionSegment:         segment,
+		ExecutionSegmentSequence: &sequence,
+		FIPSMode:                 resp.FIPSMode,
+	}, nil
+}
+
+// Ready tells the coordinator that the VUs of the agent are initialized. It
+// blocks until the test run is started and returns the data returned by the
+// setup() function. If the test run was stopped before it was started, abort
+// is true.
+func (a *Agent) Ready(ctx context.Context) (setupData json.RawMessage, abort bool, err error) {
+	var resp readyResponse
+	req := readyRequest{InstanceID: a.instanceID}
+	if err := a.conn.Invoke(ctx, methodReady, &req, &resp); err != nil {
+		return nil, false, fmt.Errorf("couldn't start the test run: %w", err)
+	}
+	return resp.SetupData, resp.Abort, nil
+}
+
+// Done tells the coordinator that the agent has finished its part of the test
+// run, with the given error, if any.
+func (a *Agent) Done(ctx context.Context, runErr error) error {
+	req := doneRequest{InstanceID: a.instanceID}
+	if runErr != nil {
+		req.Error = runErr.Error()
+	}
+	var resp doneResponse
+	return a.conn.Invoke(ctx, methodDone, &req, &resp)
+}
+
+// Close closes the connection to the coordinator.
+func (a *Agent) Close() error {
+	return a.conn.Close()
+}
+
+// NewOutput returns an output that sends the metric samples of the agent and
+// its execution state to the coordinator.
+func (a *Agent) NewOutput(state *lib.ExecutionState) *Output {
+	return &Output{agent: a, state: state}
+}
+
+// Output is the output of an agent, it sends its metric samples to the
+// coordinator. The vus and vus_max samples aren't sent, since the coordinator
+// emits them itself for the whole test run.
+type Output struct {
+	output.SampleBuffer
+
+	agent           *Agent
+	state           *lib.ExecutionState
+	periodicFlusher *output.PeriodicFlusher
+	stopCallback    func(error)
+	stopOnce        sync.Once
+}
+
+var _ output.WithTestRunStop = &Output{}
+
+// Description returns a human-readable description of the output.
+func (o *Output) Description() string {
+	return fmt.Sprintf("coordinator (agent %d)", o.agent.instanceID)
+}
+
+// SetTestRunStopCallback receives the function that stops the test run of the
+// agent, when the coordinator says so.
+func (o *Output) SetTestRunStopCallback(callback func(error)) {
+	o.stopCallback = callback
+}
+
+// Start starts sending the metric samples to the coordinator.
+func (o *Output) Start() error {
+	pf, err := output.NewPeriodicFlusher(pushInterval, o.flushMetrics)
+	if err != nil {
+		return err
+	}
+	o.periodicFlusher = pf
+	return nil
+}
+
+// Stop sends the remaining metric samples to the coordinator.
+func (o *Output) Stop() error {
+	o.periodicFlusher.Stop()
+	return nil
+}
+
+func (o *Output) flushMetrics() {
+	// Until the test run is started, the coordinator isn't ready for the
+	// samples and doesn't expect any heartbeats.
+	if !o.state.HasStarted() {
+		return
+	}
+
+	containers := o.GetBufferedSamples()
+	req := pushMetricsRequest{
+		InstanceID:            o.agent.instanceID,
+		ActiveVUs:             o.state.GetCurrentlyActiveVUsCount(),
+		InitializedVUs:        o.state.GetInitializedVUsCount(),
+		FullIterations:        o.state.GetFullIterationCount(),
+		InterruptedIterations: o.state.GetPartialIterationCount(),
+	}
+	for _, sc := range containers {
+		for _, s := range sc.GetSamples() {
+			if s.Metric.Name == metrics.VUs.Name || s.Metric.Name == metrics.VUsMax.Name {
+				continue
+			}
+			req.Samples = append(req.Samples, newSample(s))
+		}
+	}
+	o.ReleaseBufferedSamples(containers)
+
+	ctx, cancel := context.WithTimeout(context.Background(), agentTimeout)
+	defer cancel()
+	var resp pushMetricsResponse
+	if err := o.agent.conn.Invoke(ctx, methodPushMetrics, &req, &resp); err != nil {
+		o.agent.logger.WithError(err).WithField("samples", len(req.Samples)).
+			Error("Couldn't send the samples to the coordinator")
+		return
+	}
+	if resp.Abort && o.stopCallback != nil {
+		o.stopOnce.Do(func() { o.stopCallback(ErrAborted) })
+	}
+}
@@ -0,0 +1,649 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package distributed
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/consts"
+	"github.com/loadimpact/k6/lib/fips"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+	"github.com/loadimpact/k6/ui/pb"
+)
+
+// Coordinator is a lib.ExecutionScheduler that doesn't run any VUs itself.
+// Instead, it splits the test run between the agents that connect to it and
+// funnels the metric samples they send through the Engine, so the thresholds,
+// the outputs and the end-of-test summary all work like for a local test run.
+// The global setup() and teardown() functions are run by the coordinator.
+type Coordinator struct {
+	runner        lib.Runner
+	logger        *logrus.Logger
+	options       lib.Options
+	archive       []byte
+	instances     int
+	token         string
+	sequence      lib.ExecutionSegmentSequence
+	executionPlan []lib.ExecutionStep
+	state         *lib.ExecutionState
+	progress      *pb.ProgressBar
+	grpcServer    *grpc.Server
+
+	mu         sync.Mutex
+	agents     []*agentState
+	samplesOut chan<- stats.SampleContainer
+	metrics    map[string]*stats.Metric
+	setupData  json.RawMessage
+	registered chan struct{} // closed when all of the agents have registered
+	ready      chan struct{} // closed when all of the agents have initialized their VUs
+	started    chan struct{} // closed when the agents should start executing
+	done       chan struct{} // closed when all of the agents have finished
+	stopped    chan struct{} // closed when the coordinator is stopped
+	aborted    uint32
+}
+
+var errStopped = status.Error(codes.Unavailable, "the coordinator was stopped")
+
+// agentState is what the coordinator knows about a registered agent.
+type agentState struct {
+	id                    int
+	name                  string
+	lastSeen              time.Time
+	isReady, isDone       bool
+	err                   string
+	activeVUs             int64
+	initializedVUs        int64
+	fullIterations        uint64
+	interruptedIterations uint64
+}
+
+// Check to see if we implement the lib.ExecutionScheduler interface
+var _ lib.ExecutionScheduler = &Coordinator{}
+
+// NewCoordinator returns a coordinator that splits the test run of the given
+// runner between the given number of agents. The archive is sent to the
+// agents, so they can execute the same script with the same options.
+func NewCoordinator(
+	runner lib.Runner, archive []byte, instances int, security Security, logger *logrus.Logger,
+) (*Coordinator, error) {
+	if instances < 1 {
+		return nil, fmt.Errorf("the number of agents should be at least 1, but it's %d", instances)
+	}
+	options := runner.GetOptions()
+	if options.ExecutionSegment != nil || options.ExecutionSegmentSequence != nil {
+		return nil, errors.New("the execution segments are assigned to the agents by the coordinator, " +
+			"so they can't be specified for distributed test runs")
+	}
+	if options.Paused.Bool {
+		return nil, errors.New("distributed test runs can't be started in a paused state")
+	}
+	for name, conf := range options.Scenarios {
+		if conf.GetSetup() != "" || conf.GetTeardown() != "" {
+			return nil, fmt.Errorf("scenario '%s' has setup or teardown functions, "+
+				"which aren't supported in distributed test runs", name)
+		}
+	}
+
+	// The test run is split evenly between the agents
+	segments := make([]string, instances+1)
+	for i := range segments {
+		segments[i] = big.NewRat(int64(i), int64(instances)).RatString()
+	}
+	sequence, err := lib.NewExecutionSegmentSequenceFromString(strings.Join(segments, ","))
+	if err != nil {
+		return nil, err
+	}
+
+	et, err := lib.NewExecutionTuple(nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	executionPlan := options.Scenarios.GetFullExecutionRequirements(et)
+	state := lib.NewExecutionState(
+		options, et, lib.GetMaxPlannedVUs(executionPlan), lib.GetMaxPossibleVUs(executionPlan),
+	)
+
+	c := &Coordinator{
+		runner:        runner,
+		logger:        logger,
+		options:       options,
+		archive:       archive,
+		instances:     instances,
+		token:         security.Token,
+		sequence:      sequence,
+		executionPlan: executionPlan,
+		state:         state,
+		metrics:       make(map[string]*stats.Metric),
+		registered:    make(chan struct{}),
+		ready:         make(chan struct{}),
+		started:       make(chan struct{}),
+		done:          make(chan struct{}),
+		stopped:       make(chan struct{}),
+	}
+	c.progress = pb.New(pb.WithConstLeft("coordinator"), pb.WithProgress(c.getProgress))
+	serverOpts := []grpc.ServerOption{
+		grpc.CustomCodec(jsonCodec{}), //nolint:staticcheck
+		grpc.MaxRecvMsgSize(maxMessageSize),
+		grpc.MaxSendMsgSize(maxMessageSize),
+		grpc.UnknownServiceHandler(c.handle),
+	}
+	if security.TLSConfig != nil {
+		serverOpts = append(serverOpts, grpc.Creds(credentials.NewTLS(security.TLSConfig)))
+	}
+	c.grpcServer = grpc.NewServer(serverOpts...)
+	return c, nil
+}
+
+// Serve accepts the connections of the agents on the given listener, until
+// Stop() is called.
+func (c *Coordinator) Serve(listener net.Listener) error {
+	return c.grpcServer.Serve(listener)
+}
+
+// Stop stops serving the agents. The calls that are waiting for the other
+// agents fail, but the ones that are already handled are finished first, so
+// the agents get their responses.
+func (c *Coordinator) Stop() {
+	close(c.stopped)
+	c.grpcServer.GracefulStop()
+}
+
+// GetRunner returns the wrapped lib.Runner instance.
+func (c *Coordinator) GetRunner() lib.Runner {
+	return c.runner
+}
+
+// GetState returns the execution state of the whole distributed test run.
+func (c *Coordinator) GetState() *lib.ExecutionState {
+	return c.state
+}
+
+// GetExecutors returns nothing, since the executors are run by the agents.
+func (c *Coordinator) GetExecutors() []lib.Executor {
+	return nil
+}
+
+// GetExecutionPlan returns the execution plan of the whole test run.
+func (c *Coordinator) GetExecutionPlan() []lib.ExecutionStep {
+	return c.executionPlan
+}
+
+// GetProgressBar returns the progress bar that shows the state of the agents.
+func (c *Coordinator) GetProgressBar() *pb.ProgressBar {
+	return c.progress
+}
+
+// Init waits for all of the agents to register and to initialize their VUs.
+func (c *Coordinator) Init(ctx context.Context, samplesOut chan<- stats.SampleContainer) error {
+	c.mu.Lock()
+	c.samplesOut = samplesOut
+	c.mu.Unlock()
+
+	c.logger.Debugf("Waiting for %d agents...", c.instances)
+	c.state.SetExecutionStatus(lib.ExecutionStatusInitVUs)
+	select {
+	case <-c.ready:
+		c.state.SetExecutionStatus(lib.ExecutionStatusInitDone)
+		c.logger.Debug("All agents are ready")
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("the test run was stopped before all agents were ready: %w", ctx.Err())
+	}
+}
+
+// Run runs setup(), starts the test run on all of the agents and waits for
+// them to finish, and then runs teardown().
+func (c *Coordinator) Run(globalCtx, runCtx context.Context, samplesOut chan<- stats.SampleContainer) error {
+	c.state.MarkStarted()
+	defer c.state.MarkEnded()
+
+	if !c.options.NoSetup.Bool {
+		c.logger.Debug("Running setup()")
+		c.state.SetExecutionStatus(lib.ExecutionStatusSetup)
+		if err := c.runner.Setup(runCtx, samplesOut); err != nil {
+			c.logger.WithField("error", err).Debug("setup() aborted by error")
+			c.abort()
+			c.start(nil)
+			return err
+		}
+	}
+
+	c.logger.Debug("Starting the agents...")
+	c.state.SetExecutionStatus(lib.ExecutionStatusRunning)
+	c.start(c.runner.GetSetupData())
+	err := c.waitForAgents(globalCtx, runCtx)
+
+	if !c.options.NoTeardown.Bool {
+		c.logger.Debug("Running teardown()")
+		c.state.SetExecutionStatus(lib.ExecutionStatusTeardown)
+		// Like in local test runs, teardown() isn't interrupted by aborts
+		if terr := c.runner.Teardown(globalCtx, samplesOut); terr != nil {
+			c.logger.WithField("error", terr).Debug("teardown() aborted by error")
+			if err != nil {
+				c.logger.WithError(terr).Error("teardown() failed after the test run was aborted by an error")
+				return err
+			}
+			return lib.NewTeardownError(terr)
+		}
+	}
+	return err
+}
+
+// SetPaused returns an error, since distributed test runs can't be paused.
+func (c *Coordinator) SetPaused(paused bool) error {
+	return errors.New("distributed test runs can't be paused")
+}
+
+// waitForAgents waits until all of the agents have finished. When the test run
+// is stopped, the agents are told to stop as well.
+func (c *Coordinator) waitForAgents(globalCtx, runCtx context.Context) error {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	runDone := runCtx.Done()
+	for {
+		select {
+		case <-c.done:
+			return c.getAgentsError()
+		case <-runDone:
+			c.logger.Debug("The test run was stopped, stopping the agents...")
+			c.abort()
+			runDone = nil
+		case <-ticker.C:
+			if name := c.getTimedOutAgent(); name != "" {
+				c.abort()
+				return fmt.Errorf("agent '%s' stopped responding", name)
+			}
+		case <-globalCtx.Done():
+			return nil
+		}
+	}
+}
+
+func (c *Coordinator) start(setupData json.RawMessage) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setupData = setupData
+	close(c.started)
+}
+
+func (c *Coordinator) abort() {
+	atomic.StoreUint32(&c.aborted, 1)
+}
+
+func (c *Coordinator) isAborted() bool {
+	return atomic.LoadUint32(&c.aborted) == 1
+}
+
+func (c *Coordinator) getAgentsError() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, agent := range c.agents {
+		if agent.err != "" {
+			return fmt.Errorf("agent '%s' failed: %s", agent.name, agent.err)
+		}
+	}
+	return nil
+}
+
+func (c *Coordinator) getTimedOutAgent() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, agent := range c.agents {
+		if !agent.isDone && time.Since(agent.lastSeen) > agentTimeout {
+			return agent.name
+		}
+	}
+	return ""
+}
+
+func (c *Coordinator) getProgress() (float64, []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var ready, done int
+	for _, agent := range c.agents {
+		if agent.isReady {
+			ready++
+		}
+		if agent.isDone {
+			done++
+		}
+	}
+	agentsFmt := pb.GetFixedLengthIntFormat(int64(c.instances))
+	switch {
+	case len(c.agents) < c.instances || ready == 0:
+		return 0, []string{fmt.Sprintf(agentsFmt+"/"+agentsFmt+" agents registered", len(c.agents), c.instances)}
+	case ready < c.instances:
+		return 0, []string{fmt.Sprintf(agentsFmt+"/"+agentsFmt+" agents ready", ready, c.instances)}
+	default:
+		return float64(done) / float64(c.instances), []string{
+			fmt.Sprintf(agentsFmt+"/"+agentsFmt+" agents done", done, c.instances),
+			fmt.Sprintf("%d VUs", c.state.GetCurrentlyActiveVUsCount()),
+			fmt.Sprintf("%d complete iterations", c.state.GetFullIterationCount()),
+		}
+	}
+}
+
+// handle dispatches the calls of the agents, since there is no generated
+// service code.
+func (c *Coordinator) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	ctx := stream.Context()
+	if err := c.authenticate(ctx); err != nil {
+		return err
+	}
+
+	var (
+		resp interface{}
+		err  error
+	)
+	switch method {
+	case methodRegister:
+		var req registerRequest
+		if err = stream.RecvMsg(&req); err == nil {
+			resp, err = c.register(ctx, req)
+		}
+	case methodReady:
+		var req readyRequest
+		if err = stream.RecvMsg(&req); err == nil {
+			resp, err = c.markReady(ctx, req)
+		}
+	case methodPushMetrics:
+		var req pushMetricsRequest
+		if err = stream.RecvMsg(&req); err == nil {
+			resp, err = c.pushMetrics(ctx, req)
+		}
+	case methodDone:
+		var req doneRequest
+		if err = stream.RecvMsg(&req); err == nil {
+			resp, err = c.markDone(req)
+		}
+	default:
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+	if err != nil {
+		return err
+	}
+	return stream.SendMsg(resp)
+}
+
+// authenticate checks that the call has the token of the coordinator, if it
+// has one.
+func (c *Coordinator) authenticate(ctx context.Context) error {
+	if c.token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	expected := []byte("Bearer " + c.token)
+	for _, value := range md.Get(authorizationKey) {
+		if subtle.ConstantTimeCompare([]byte(value), expected) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "the agent doesn't have the token of the coordinator")
+}
+
+// register adds the agent to the test run and waits for all of the other
+// agents, before it returns the part of the test run that the agent should do.
+func (c *Coordinator) register(ctx context.Context, req registerRequest) (*registerResponse, error) {
+	if req.Version != consts.Version {
+		return nil, status.Errorf(codes.FailedPrecondition,
+			"the agent has k6 v%s, but the coordinator has k6 v%s", req.Version, consts.Version)
+	}
+
+	c.mu.Lock()
+	if len(c.agents) == c.instances {
+		c.mu.Unlock()
+		return nil, status.Errorf(codes.ResourceExhausted, "all %d agents have already registered", c.instances)
+	}
+	agent := &agentState{name: req.Name, lastSeen: time.Now()}
+	c.agents = append(c.agents, agent)
+	if agent.name == "" {
+		agent.name = fmt.Sprintf("agent-%d", len(c.agents))
+	}
+	if len(c.agents) == c.instances {
+		// The IDs are assigned only once everyone is here, since agents
+		// that disconnect before that are removed.
+		for i, a := range c.agents {
+			a.id = i + 1
+		}
+		close(c.registered)
+	}
+	c.mu.Unlock()
+	c.logger.WithField("agent", agent.name).Info("Agent registered")
+
+	select {
+	case <-c.registered:
+	case <-ctx.Done():
+		c.removeAgent(agent)
+		return nil, ctx.Err()
+	case <-c.stopped:
+		return nil, errStopped
+	}
+
+	segment := c.sequence[agent.id-1]
+	return &registerResponse{
+		InstanceID:               agent.id,
+		Instances:                c.instances,
+		Archive:                  c.archive,
+		ExecutionSegment:         segment.String(),
+		ExecutionSegmentSequence: c.sequence.String(),
+		FIPSMode:                 fips.Enabled(),
+	}, nil
+}
+
+func (c *Coordinator) removeAgent(agent *agentState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.registered:
+		return // too late, the agent already has its ID
+	default:
+	}
+	for i, a := range c.agents {
+		if a == agent {
+			c.agents = append(c.agents[:i], c.agents[i+1:]...)
+			break
+		}
+	}
+	c.logger.WithField("agent", agent.name).Warn("Agent disconnected before the test run started")
+}
+
+func (c *Coordinator) getAgent(id int) (*agentState, error) {
+	select {
+	case <-c.registered:
+	default:
+		return nil, status.Error(codes.FailedPrecondition, "not all agents have registered yet")
+	}
+	if id < 1 || id > len(c.agents) {
+		return nil, status.Errorf(codes.NotFound, "unknown agent instance %d", id)
+	}
+	return c.agents[id-1], nil
+}
+
+// markReady records that the agent has initialized its VUs and waits until
+// the test run is started. Repeated calls, e.g. retries, just wait as well.
+func (c *Coordinator) markReady(ctx context.Context, req readyRequest) (*readyResponse, error) {
+	c.mu.Lock()
+	agent, err := c.getAgent(req.InstanceID)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	wasReady := agent.isReady
+	agent.isReady, agent.lastSeen = true, time.Now()
+	allReady := true
+	for _, a := range c.agents {
+		allReady = allReady && a.isReady
+	}
+	if allReady && !wasReady {
+		close(c.ready)
+	}
+	c.mu.Unlock()
+	c.logger.WithField("agent", agent.name).Debug("Agent ready")
+
+	select {
+	case <-c.started:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-c.stopped:
+		return nil, errStopped
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	agent.lastSeen = time.Now()
+	return &readyResponse{SetupData: c.setupData, Abort: c.isAborted()}, nil
+}
+
+// pushMetrics funnels the samples of the agent through the Engine and updates
+// the execution state of the whole test run with the one of the agent.
+func (c *Coordinator) pushMetrics(ctx context.Context, req pushMetricsRequest) (*pushMetricsResponse, error) {
+	c.mu.Lock()
+	agent, err := c.getAgent(req.InstanceID)
+	if err != nil {
+		c.mu.Unlock()
+		return nil, err
+	}
+	agent.lastSeen = time.Now()
+	c.state.ModCurrentlyActiveVUsCount(req.ActiveVUs - agent.activeVUs)
+	c.state.ModInitializedVUsCount(req.InitializedVUs - agent.initializedVUs)
+	if req.FullIterations > agent.fullIterations {
+		c.state.AddFullIterations(req.FullIterations - agent.fullIterations)
+	}
+	if req.InterruptedIterations > agent.interruptedIterations {
+		c.state.AddInterruptedIterations(req.InterruptedIterations - agent.interruptedIterations)
+	}
+	agent.activeVUs, agent.initializedVUs = req.ActiveVUs, req.InitializedVUs
+	agent.fullIterations, agent.interruptedIterations = req.FullIterations, req.InterruptedIterations
+
+	samples := make(stats.Samples, 0, len(req.Samples))
+	for _, s := range req.Samples {
+		metric, ok := c.metrics[s.Metric]
+		if !ok {
+			metric = stats.New(s.Metric, s.Type, s.Contains)
+			c.metrics[s.Metric] = metric
+		}
+		tags := s.Tags
+		sample := stats.Sample{
+			Metric: metric,
+			Time:   time.Unix(0, s.Time),
+			Value:  s.Value,
+			Tags:   stats.IntoSampleTags(&tags),
+		}
+		if metric.Name == metrics.Checks.Name {
+			c.recordCheck(sample)
+		}
+		samples = append(samples, sample)
+	}
+	samplesOut := c.samplesOut
+	c.mu.Unlock()
+
+	if len(samples) > 0 && samplesOut != nil {
+		select {
+		case samplesOut <- samples:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-c.stopped:
+			return nil, errStopped
+		}
+	}
+	return &pushMetricsResponse{Abort: c.isAborted()}, nil
+}
+
+// recordCheck counts the result of a check in the default group of the runner,
+// since the end-of-test summary gets the checks from there.
+func (c *Coordinator) recordCheck(sample stats.Sample) {
+	name, ok := sample.Tags.Get("check")
+	if !ok {
+		return
+	}
+	group := c.runner.GetDefaultGroup()
+	if path, _ := sample.Tags.Get("group"); path != "" {
+		for _, groupName := range strings.Split(path, lib.GroupSeparator)[1:] {
+			var err error
+			if group, err = group.Group(groupName); err != nil {
+				return
+			}
+		}
+	}
+	check, err := group.Check(name)
+	if err != nil {
+		return
+	}
+	if sample.Value != 0 {
+		atomic.AddInt64(&check.Passes, 1)
+	} else {
+		atomic.AddInt64(&check.Fails, 1)
+	}
+}
+
+// markDone records that the agent has finished its part of the test run. If
+// it failed, the rest of the agents are stopped.
+func (c *Coordinator) markDone(req doneRequest) (*doneResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	agent, err := c.getAgent(req.InstanceID)
+	if err != nil {
+		return nil, err
+	}
+	if agent.isDone {
+		return &doneResponse{}, nil
+	}
+	agent.isDone, agent.err, agent.lastSeen = true, req.Error, time.Now()
+
+	logger := c.logger.WithField("agent", agent.name)
+	if req.Error != "" {
+		logger.WithField("error", req.Error).Error("Agent failed, stopping the test run...")
+		c.abort()
+	} else {
+		logger.Debug("Agent done")
+	}
+
+	allDone := true
+	for _, a := range c.agents {
+		allDone = allDone && a.isDone
+	}
+	if allDone {
+		close(c.done)
+	}
+	return &doneResponse{}, nil
+}
@@ -0,0 +1,164 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package distributed implements running a single test on several k6
+// instances. The coordinator splits the test into execution segments, one for
+// every agent, and the agents execute their segments and send their metric
+// samples back to it. The coordinator evaluates the thresholds for the whole
+// test and produces the end-of-test summary, just like a local test run.
+package distributed
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"time"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// The coordinator and the agents are both k6, so instead of generated code,
+// the gRPC methods are dispatched by hand and their messages are just JSON.
+const (
+	methodRegister    = "/k6.distributed.v1.Coordinator/Register"
+	methodReady       = "/k6.distributed.v1.Coordinator/Ready"
+	methodPushMetrics = "/k6.distributed.v1.Coordinator/PushMetrics"
+	methodDone        = "/k6.distributed.v1.Coordinator/Done"
+)
+
+const (
+	// The agents accept bigger messages than the gRPC default of 4MB, since
+	// the archive with the script and its dependencies can be big.
+	maxMessageSize = 256 << 20
+
+	// How often the agents send their metric samples to the coordinator. They
+	// do it even when there are no new samples, so the coordinator knows
+	// they are still alive.
+	pushInterval = 1 * time.Second
+
+	// How long the coordinator waits for an agent that stopped sending its
+	// metric samples before it fails the test run.
+	agentTimeout = 30 * time.Second
+)
+
+// The metadata key of the token the agents send with every call.
+const authorizationKey = "authorization"
+
+// Security holds the settings that protect the connections between the
+// coordinator and the agents.
+type Security struct {
+	// If it's not empty, the agents have to send this token with every call,
+	// or the coordinator rejects them.
+	Token string
+
+	// The TLS config of the coordinator's server or of the agent's connection
+	// to it. If it's nil, the connections aren't encrypted.
+	TLSConfig *tls.Config
+}
+
+type registerRequest struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type registerResponse struct {
+	InstanceID               int    `json:"instanceID"`
+	Instances                int    `json:"instances"`
+	Archive                  []byte `json:"archive"`
+	ExecutionSegment         string `json:"executionSegment"`
+	ExecutionSegmentSequence string `json:"executionSegmentSequence"`
+	FIPSMode                 bool   `json:"fipsMode"`
+}
+
+type readyRequest struct {
+	InstanceID int `json:"instanceID"`
+}
+
+type readyResponse struct {
+	SetupData json.RawMessage `json:"setupData,omitempty"`
+	Abort     bool            `json:"abort"`
+}
+
+type pushMetricsRequest struct {
+	InstanceID int      `json:"instanceID"`
+	Samples    []sample `json:"samples"`
+
+	// The current execution state of the agent, so the coordinator can keep
+	// track of the VUs and iterations of the whole test.
+	ActiveVUs             int64  `json:"activeVUs"`
+	InitializedVUs        int64  `json:"initializedVUs"`
+	FullIterations        uint64 `json:"fullIterations"`
+	InterruptedIterations uint64 `json:"interruptedIterations"`
+}
+
+type pushMetricsResponse struct {
+	Abort bool `json:"abort"`
+}
+
+type doneRequest struct {
+	InstanceID int    `json:"instanceID"`
+	Error      string `json:"error,omitempty"`
+}
+
+type doneResponse struct{}
+
+// sample is a metric sample sent by an agent.
+type sample struct {
+	Metric   string            `json:"metric"`
+	Type     stats.MetricType  `json:"type"`
+	Contains stats.ValueType   `json:"contains"`
+	Time     int64             `json:"time"`
+	Value    float64           `json:"value"`
+	Tags     map[string]string `json:"tags,omitempty"`
+}
+
+func newSample(s stats.Sample) sample {
+	var tags map[string]string
+	if s.Tags != nil {
+		tags = s.Tags.CloneTags()
+	}
+	return sample{
+		Metric:   s.Metric.Name,
+		Type:     s.Metric.Type,
+		Contains: s.Metric.Contains,
+		Time:     s.Time.UnixNano(),
+		Value:    s.Value,
+		Tags:     tags,
+	}
+}
+
+// jsonCodec encodes the gRPC messages as JSON.
+type jsonCodec struct{}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+func (jsonCodec) Name() string {
+	return "json"
+}
+
+// String makes jsonCodec usable as a server codec as well.
+func (jsonCodec) String() string {
+	return "json"
+}
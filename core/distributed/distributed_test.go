@@ -0,0 +1,351 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package distributed
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/executor"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/lib/testutils/minirunner"
+	"github.com/loadimpact/k6/stats"
+)
+
+func newTestCoordinator(t *testing.T, runner lib.Runner, instances int) (*Coordinator, string) {
+	return newSecureTestCoordinator(t, runner, instances, Security{})
+}
+
+func newSecureTestCoordinator(
+	t *testing.T, runner lib.Runner, instances int, security Security,
+) (*Coordinator, string) {
+	c, err := NewCoordinator(runner, []byte("archive"), instances, security, testutils.NewLogger(t))
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = c.Serve(listener) }()
+	t.Cleanup(c.Stop)
+	return c, listener.Addr().String()
+}
+
+func newTestRunner(t *testing.T) *minirunner.MiniRunner {
+	options, err := executor.DeriveScenariosFromShortcuts(lib.Options{
+		VUs:        null.IntFrom(2),
+		Iterations: null.IntFrom(4),
+	})
+	require.NoError(t, err)
+	group, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+	return &minirunner.MiniRunner{Options: options, Group: group}
+}
+
+func newTestState(t *testing.T) *lib.ExecutionState {
+	et, err := lib.NewExecutionTuple(nil, nil)
+	require.NoError(t, err)
+	state := lib.NewExecutionState(lib.Options{}, et, 1, 1)
+	state.MarkStarted()
+	return state
+}
+
+func TestNewCoordinatorErrors(t *testing.T) {
+	t.Parallel()
+
+	segment, err := lib.NewExecutionSegmentFromString("0:1/2")
+	require.NoError(t, err)
+	withSetup := executor.NewConstantVUsConfig("with_setup")
+	withSetup.Setup = null.StringFrom("prepare")
+
+	testCases := []struct {
+		name      string
+		options   lib.Options
+		instances int
+		expErr    string
+	}{
+		{"no instances", lib.Options{}, 0, "the number of agents should be at least 1"},
+		{"segment", lib.Options{ExecutionSegment: segment}, 2, "the execution segments are assigned"},
+		{"paused", lib.Options{Paused: null.BoolFrom(true)}, 2, "can't be started in a paused state"},
+		{
+			"scenario setup",
+			lib.Options{Scenarios: lib.ScenarioConfigs{"with_setup": withSetup}}, 2,
+			"scenario 'with_setup' has setup or teardown functions",
+		},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			runner := &minirunner.MiniRunner{Options: tc.options}
+			_, err := NewCoordinator(runner, nil, tc.instances, Security{}, testutils.NewLogger(t))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.expErr)
+		})
+	}
+}
+
+func TestCoordinatorRun(t *testing.T) {
+	t.Parallel()
+	runner := newTestRunner(t)
+	runner.SetupFn = func(context.Context, chan<- stats.SampleContainer) ([]byte, error) {
+		return []byte(`{"v":1}`), nil
+	}
+	c, addr := newTestCoordinator(t, runner, 2)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	samples := make(chan stats.SampleContainer, 100)
+	initErr := make(chan error, 1)
+	go func() { initErr <- c.Init(ctx, samples) }()
+
+	var (
+		mu    sync.Mutex
+		works []*Work
+		wg    sync.WaitGroup
+	)
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			agent, err := Connect(ctx, addr, Security{}, testutils.NewLogger(t))
+			require.NoError(t, err)
+			defer func() { _ = agent.Close() }()
+
+			work, err := agent.Register(ctx, "")
+			require.NoError(t, err)
+			mu.Lock()
+			works = append(works, work)
+			mu.Unlock()
+
+			setupData, abort, err := agent.Ready(ctx)
+			require.NoError(t, err)
+			assert.False(t, abort)
+			assert.JSONEq(t, `{"v":1}`, string(setupData))
+
+			state := newTestState(t)
+			state.AddFullIterations(2)
+			out := agent.NewOutput(state)
+			require.NoError(t, out.Start())
+			out.AddMetricSamples([]stats.SampleContainer{stats.Samples{
+				{
+					Metric: metrics.Checks, Time: time.Now(), Value: 1,
+					Tags: stats.IntoSampleTags(&map[string]string{"group": "::g", "check": "ok"}),
+				},
+				{Metric: metrics.VUs, Time: time.Now(), Value: 1},
+			}})
+			require.NoError(t, out.Stop())
+			require.NoError(t, agent.Done(ctx, nil))
+		}()
+	}
+
+	require.NoError(t, <-initErr)
+	require.NoError(t, c.Run(ctx, ctx, samples))
+	wg.Wait()
+
+	require.Len(t, works, 2)
+	segments := []string{works[0].ExecutionSegment.String(), works[1].ExecutionSegment.String()}
+	sort.Strings(segments)
+	assert.Equal(t, []string{"0:1/2", "1/2:1"}, segments)
+	for _, work := range works {
+		assert.Equal(t, "0,1/2,1", work.ExecutionSegmentSequence.String())
+		assert.Equal(t, []byte("archive"), work.Archive)
+		assert.Equal(t, 2, work.Instances)
+		assert.False(t, work.FIPSMode)
+	}
+
+	close(samples)
+	var checks int
+	for sc := range samples {
+		for _, s := range sc.GetSamples() {
+			assert.Equal(t, metrics.Checks.Name, s.Metric.Name)
+			checks++
+		}
+	}
+	assert.Equal(t, 2, checks)
+	assert.Equal(t, uint64(4), c.GetState().GetFullIterationCount())
+
+	group, err := runner.GetDefaultGroup().Group("g")
+	require.NoError(t, err)
+	check, err := group.Check("ok")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), check.Passes)
+	assert.Equal(t, int64(0), check.Fails)
+}
+
+func TestCoordinatorAgentError(t *testing.T) {
+	t.Parallel()
+	c, addr := newTestCoordinator(t, newTestRunner(t), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	samples := make(chan stats.SampleContainer, 100)
+	initErr := make(chan error, 1)
+	go func() { initErr <- c.Init(ctx, samples) }()
+
+	agentErr := make(chan error, 1)
+	go func() {
+		agent, err := Connect(ctx, addr, Security{}, testutils.NewLogger(t))
+		if err == nil {
+			_, err = agent.Register(ctx, "agent-one")
+		}
+		if err == nil {
+			_, _, err = agent.Ready(ctx)
+		}
+		if err == nil {
+			err = agent.Done(ctx, errors.New("something went wrong"))
+		}
+		agentErr <- err
+	}()
+
+	require.NoError(t, <-initErr)
+	err := c.Run(ctx, ctx, samples)
+	require.NoError(t, <-agentErr)
+	require.Error(t, err)
+	assert.Equal(t, "agent 'agent-one' failed: something went wrong", err.Error())
+}
+
+func TestCoordinatorAbort(t *testing.T) {
+	t.Parallel()
+	c, addr := newTestCoordinator(t, newTestRunner(t), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	samples := make(chan stats.SampleContainer, 100)
+	initErr := make(chan error, 1)
+	go func() { initErr <- c.Init(ctx, samples) }()
+
+	agent, err := Connect(ctx, addr, Security{}, testutils.NewLogger(t))
+	require.NoError(t, err)
+	defer func() { _ = agent.Close() }()
+	_, err = agent.Register(ctx, "")
+	require.NoError(t, err)
+
+	runCtx, runCancel := context.WithCancel(ctx)
+	runCancel()
+	runErr := make(chan error, 1)
+	go func() {
+		if err := <-initErr; err != nil {
+			runErr <- err
+			return
+		}
+		runErr <- c.Run(ctx, runCtx, samples)
+	}()
+
+	_, _, err = agent.Ready(ctx)
+	require.NoError(t, err)
+	for !c.isAborted() {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var stopErr error
+	out := agent.NewOutput(newTestState(t))
+	out.SetTestRunStopCallback(func(err error) { stopErr = err })
+	require.NoError(t, out.Start())
+	require.NoError(t, out.Stop())
+	assert.Equal(t, ErrAborted, stopErr)
+
+	require.NoError(t, agent.Done(ctx, nil))
+	assert.NoError(t, <-runErr)
+}
+
+func TestCoordinatorDuplicateReady(t *testing.T) {
+	t.Parallel()
+	c, addr := newTestCoordinator(t, newTestRunner(t), 1)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	samples := make(chan stats.SampleContainer, 100)
+	initErr := make(chan error, 1)
+	go func() { initErr <- c.Init(ctx, samples) }()
+
+	agent, err := Connect(ctx, addr, Security{}, testutils.NewLogger(t))
+	require.NoError(t, err)
+	defer func() { _ = agent.Close() }()
+	_, err = agent.Register(ctx, "")
+	require.NoError(t, err)
+
+	readyErrs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, _, err := agent.Ready(ctx)
+			readyErrs <- err
+		}()
+	}
+	require.NoError(t, <-initErr)
+	c.start(nil)
+	require.NoError(t, <-readyErrs)
+	require.NoError(t, <-readyErrs)
+
+	// a retry after the test run was started doesn't fail either
+	_, abort, err := agent.Ready(ctx)
+	require.NoError(t, err)
+	assert.False(t, abort)
+}
+
+func TestCoordinatorSecurity(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewTLSServer(http.NotFoundHandler())
+	defer srv.Close()
+	serverTLS := srv.TLS.Clone()
+	serverTLS.NextProtos = nil
+	clientTLS := srv.Client().Transport.(*http.Transport).TLSClientConfig.Clone()
+	clientTLS.ServerName = "example.com"
+
+	_, addr := newSecureTestCoordinator(t, newTestRunner(t), 2, Security{Token: "s3cr3t", TLSConfig: serverTLS})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	register := func(security Security) error {
+		agent, err := Connect(ctx, addr, security, testutils.NewLogger(t))
+		require.NoError(t, err)
+		defer func() { _ = agent.Close() }()
+		// the call fails right away, or it waits for the other agent
+		registerCtx, registerCancel := context.WithTimeout(ctx, 200*time.Millisecond)
+		defer registerCancel()
+		_, err = agent.Register(registerCtx, "")
+		return err
+	}
+
+	err := register(Security{TLSConfig: clientTLS})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(errors.Unwrap(err)))
+
+	err = register(Security{Token: "wrong", TLSConfig: clientTLS})
+	require.Error(t, err)
+	assert.Equal(t, codes.Unauthenticated, status.Code(errors.Unwrap(err)))
+
+	err = register(Security{Token: "s3cr3t", TLSConfig: clientTLS})
+	require.Error(t, err)
+	assert.Equal(t, codes.DeadlineExceeded, status.Code(errors.Unwrap(err)))
+}
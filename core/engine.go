@@ -23,6 +23,7 @@ package core
 import (
 	"context"
 	"errors"
+	"io"
 	"strings"
 	"sync"
 	"time"
@@ -31,7 +32,10 @@ import (
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/cardinality"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/redact"
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/output"
 	"github.com/loadimpact/k6/stats"
 )
@@ -40,6 +44,10 @@ const (
 	metricsRate    = 1 * time.Second
 	collectRate    = 50 * time.Millisecond
 	thresholdsRate = 2 * time.Second
+
+	// How many values a trend metric keeps on the heap before they are spilled
+	// to disk, if the trend spilling is enabled.
+	trendSpillThreshold = 1 << 16
 )
 
 // The Engine is the beating heart of k6.
@@ -63,9 +71,17 @@ type Engine struct {
 	stopOnce sync.Once
 	stopChan chan struct{}
 
+	// The reason an output stopped the test run, if it did.
+	stopErr   error
+	stopErrMu sync.Mutex
+
 	Metrics     map[string]*stats.Metric
 	MetricsLock sync.Mutex
 
+	// The phase timings of the HTTP requests for the summary, nil if the
+	// summary is disabled.
+	RequestTimings *lib.RequestTimings
+
 	Samples chan stats.SampleContainer
 
 	// Assigned to metrics upon first received sample.
@@ -74,6 +90,35 @@ type Engine struct {
 
 	// Are thresholds tainted?
 	thresholdsTainted bool
+	// Closed when the thresholds abort the test run
+	thresholdAbort chan struct{}
+
+	// Used for all trend metrics, if their values should be spilled to disk
+	trendSpill *stats.TrendSpill
+
+	// The workers for the sharded processing of samples, only used when there
+	// is more than one metrics processing worker.
+	metricsWorkers *metricsWorkers
+
+	// Removes sensitive data from the samples before they reach the outputs
+	redactor *redact.Redactor
+
+	// Keeps the number of time series the outputs see in check
+	cardinalityLimiter *cardinality.Limiter
+
+	// Drops the samples emitted during the warm-up windows, if there are any
+	warmupFilter *warmupFilter
+
+	// All threshold events so far, and the functions they are passed to
+	thresholdEvents     []lib.ThresholdEvent
+	thresholdEventsMu   sync.Mutex
+	thresholdEventHooks []func(lib.ThresholdEvent)
+
+	// The checkpoint of the earlier test run that this one resumed, if any
+	resumedFrom          *lib.Checkpoint
+	checkpointMu         sync.Mutex
+	checkpointWriter     *lib.CheckpointWriter
+	savedFinalCheckpoint bool
 }
 
 // NewEngine instantiates a new Engine, without doing any heavy initialization.
@@ -94,9 +139,46 @@ func NewEngine(
 		Metrics:        make(map[string]*stats.Metric),
 		Samples:        make(chan stats.SampleContainer, opts.MetricSamplesBufferSize.Int64),
 		stopChan:       make(chan struct{}),
+		thresholdAbort: make(chan struct{}),
 		logger:         logger.WithField("component", "engine"),
 	}
 
+	if !rtOpts.NoSummary.Bool {
+		e.RequestTimings = lib.NewRequestTimings()
+	}
+
+	if rtOpts.TrendSpillDir.Valid {
+		e.trendSpill = &stats.TrendSpill{
+			Dir:       rtOpts.TrendSpillDir.String,
+			Threshold: trendSpillThreshold,
+			OnError: func(err error) {
+				e.logger.WithError(err).Warn("Couldn't spill trend metric values to disk, keeping them in memory")
+			},
+		}
+	}
+
+	if opts.Redact != nil {
+		redactor, err := redact.New(*opts.Redact)
+		if err != nil {
+			return nil, err
+		}
+		e.redactor = redactor
+	}
+
+	if opts.CardinalityLimit != nil {
+		limiter, err := cardinality.New(*opts.CardinalityLimit, e.logger)
+		if err != nil {
+			return nil, err
+		}
+		e.cardinalityLimiter = limiter
+	}
+
+	e.warmupFilter = newWarmupFilter(opts, e.executionState)
+
+	if workers := opts.MetricsProcessingWorkers.Int64; workers > 1 {
+		e.metricsWorkers = newMetricsWorkers(int(workers))
+	}
+
 	e.thresholds = opts.Thresholds
 	e.submetrics = make(map[string][]*stats.Submetric)
 	for name := range e.thresholds {
@@ -138,6 +220,10 @@ func (e *Engine) StartOutputs() error {
 			thresholdOut.SetThresholds(e.thresholds)
 		}
 
+		if stopOut, ok := out.(output.WithTestRunStop); ok {
+			stopOut.SetTestRunStopCallback(e.stopWithError)
+		}
+
 		if err := out.Start(); err != nil {
 			e.stopOutputs(i)
 			return err
@@ -239,7 +325,6 @@ func (e *Engine) startBackgroundProcesses(
 
 	// Update the test run status when the test finishes
 	processes.Add(1)
-	thresholdAbortChan := make(chan struct{})
 	go func() {
 		defer processes.Done()
 		select {
@@ -256,15 +341,29 @@ func (e *Engine) startBackgroundProcesses(
 			e.setRunStatus(lib.RunStatusAbortedUser)
 		case <-e.stopChan:
 			runSubCancel()
-			e.logger.Debug("run: stopped by user; exiting...")
-			e.setRunStatus(lib.RunStatusAbortedUser)
-		case <-thresholdAbortChan:
+			if err := e.GetStopError(); err != nil {
+				e.logger.WithError(err).Debug("run: stopped by an output; exiting...")
+				e.setRunStatus(lib.RunStatusAbortedSystem)
+			} else {
+				e.logger.Debug("run: stopped by user; exiting...")
+				e.setRunStatus(lib.RunStatusAbortedUser)
+			}
+		case <-e.thresholdAbort:
 			e.logger.Debug("run: stopped by thresholds; exiting...")
 			runSubCancel()
 			e.setRunStatus(lib.RunStatusAbortedThreshold)
 		}
 	}()
 
+	// Periodically save the progress of the test run, if enabled.
+	if e.runtimeOptions.CheckpointFile.Valid {
+		processes.Add(1)
+		go func() {
+			defer processes.Done()
+			e.runCheckpoints(runCtx)
+		}()
+	}
+
 	// Run thresholds, if not disabled.
 	if !e.runtimeOptions.NoThresholds.Bool {
 		processes.Add(1)
@@ -278,7 +377,7 @@ func (e *Engine) startBackgroundProcesses(
 				select {
 				case <-ticker.C:
 					if e.processThresholds() {
-						close(thresholdAbortChan)
+						close(e.thresholdAbort)
 						return
 					}
 				case <-runCtx.Done():
@@ -308,6 +407,12 @@ func (e *Engine) processMetrics(globalCtx context.Context, processMetricsAfterRu
 		if !e.runtimeOptions.NoThresholds.Bool {
 			e.processThresholds() // Process the thresholds one final time
 		}
+		if e.metricsWorkers != nil {
+			e.MetricsLock.Lock()
+			e.metricsWorkers.stop()
+			e.MetricsLock.Unlock()
+		}
+		e.closeSinks()
 	}()
 
 	ticker := time.NewTicker(collectRate)
@@ -342,6 +447,10 @@ func (e *Engine) processMetrics(globalCtx context.Context, processMetricsAfterRu
 			if !e.runtimeOptions.NoThresholds.Bool {
 				e.processThresholds()
 			}
+			status := e.executionState.GetCurrentExecutionStatus()
+			if e.runtimeOptions.CheckpointFile.Valid && status >= lib.ExecutionStatusRunning {
+				e.saveCheckpoint(true)
+			}
 			processMetricsAfterRun <- struct{}{}
 
 		case sc := <-e.Samples:
@@ -352,6 +461,23 @@ func (e *Engine) processMetrics(globalCtx context.Context, processMetricsAfterRu
 	}
 }
 
+// closeSinks releases the resources held by the metric sinks, i.e. the files
+// of the trend values that were spilled to disk, once no more samples will be
+// added to them.
+func (e *Engine) closeSinks() {
+	e.MetricsLock.Lock()
+	defer e.MetricsLock.Unlock()
+	for name, m := range e.Metrics {
+		closer, ok := m.Sink.(io.Closer)
+		if !ok {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			e.logger.WithError(err).WithField("metric", name).Warn("Couldn't close the metric sink")
+		}
+	}
+}
+
 func (e *Engine) setRunStatus(status lib.RunStatus) {
 	for _, out := range e.outputs {
 		if statUpdOut, ok := out.(output.WithRunStatusUpdates); ok {
@@ -364,6 +490,17 @@ func (e *Engine) IsTainted() bool {
 	return e.thresholdsTainted
 }
 
+// IsAbortedByThresholds returns whether the test run was aborted because of
+// thresholds with abortOnFail.
+func (e *Engine) IsAbortedByThresholds() bool {
+	select {
+	case <-e.thresholdAbort:
+		return true
+	default:
+		return false
+	}
+}
+
 // Stop closes a signal channel, forcing a running Engine to return
 func (e *Engine) Stop() {
 	e.stopOnce.Do(func() {
@@ -371,6 +508,27 @@ func (e *Engine) Stop() {
 	})
 }
 
+// stopWithError records the reason for stopping the test run before stopping
+// the Engine. It's given to outputs that can stop the test run, and it's also
+// used when the cardinality limit is reached with the abort action.
+func (e *Engine) stopWithError(err error) {
+	e.logger.WithError(err).Error("Stopping the test run")
+	e.stopErrMu.Lock()
+	if e.stopErr == nil {
+		e.stopErr = err
+	}
+	e.stopErrMu.Unlock()
+	e.Stop()
+}
+
+// GetStopError returns the reason an output or the cardinality limit stopped
+// the test run, or nil if the test run wasn't stopped by them.
+func (e *Engine) GetStopError() error {
+	e.stopErrMu.Lock()
+	defer e.stopErrMu.Unlock()
+	return e.stopErr
+}
+
 // IsStopped returns a bool indicating whether the Engine has been stopped
 func (e *Engine) IsStopped() bool {
 	select {
@@ -430,12 +588,19 @@ func (e *Engine) processThresholds() (shouldAbort bool) {
 		}
 		m.Tainted = null.BoolFrom(false)
 
+		lastFailed := make([]bool, len(m.Thresholds.Thresholds))
+		for i, th := range m.Thresholds.Thresholds {
+			lastFailed[i] = th.LastFailed
+		}
+		wasAborting := m.Thresholds.Abort
+
 		e.logger.WithField("m", m.Name).Debug("running thresholds")
 		succ, err := m.Thresholds.Run(m.Sink, t)
 		if err != nil {
 			e.logger.WithField("m", m.Name).WithError(err).Error("Threshold error")
 			continue
 		}
+		e.emitThresholdEvents(m, lastFailed, wasAborting, t)
 		if !succ {
 			e.logger.WithField("m", m.Name).Debug("Thresholds failed")
 			m.Tainted = null.BoolFrom(true)
@@ -449,7 +614,164 @@ func (e *Engine) processThresholds() (shouldAbort bool) {
 	return shouldAbort
 }
 
+// emitThresholdEvents records the changes in the results of the thresholds of
+// the metric since they were last run, and passes them to the hooks.
+func (e *Engine) emitThresholdEvents(m *stats.Metric, lastFailed []bool, wasAborting bool, t time.Duration) {
+	var events []lib.ThresholdEvent
+	var values map[string]float64
+	newEvent := func(typ string, th *stats.Threshold) lib.ThresholdEvent {
+		if values == nil {
+			values = m.Sink.Format(t)
+		}
+		return lib.ThresholdEvent{
+			Type:        typ,
+			Time:        time.Now(),
+			Elapsed:     types.Duration(t),
+			Metric:      m.Name,
+			Threshold:   th.Source,
+			AbortOnFail: th.AbortOnFail,
+			Values:      values,
+		}
+	}
+	for i, th := range m.Thresholds.Thresholds {
+		switch {
+		case th.LastFailed && !lastFailed[i]:
+			events = append(events, newEvent(lib.ThresholdBreached, th))
+		case !th.LastFailed && lastFailed[i]:
+			events = append(events, newEvent(lib.ThresholdRecovered, th))
+		}
+		if th.LastFailed && th.AbortOnFail && m.Thresholds.Abort && !wasAborting {
+			events = append(events, newEvent(lib.ThresholdAborted, th))
+		}
+	}
+	if len(events) == 0 {
+		return
+	}
+
+	e.thresholdEventsMu.Lock()
+	e.thresholdEvents = append(e.thresholdEvents, events...)
+	e.thresholdEventsMu.Unlock()
+	for _, event := range events {
+		e.logger.WithFields(logrus.Fields{"metric": event.Metric, "threshold": event.Threshold}).
+			Debugf("Threshold %s", event.Type)
+		for _, hook := range e.thresholdEventHooks {
+			hook(event)
+		}
+	}
+}
+
+// OnThresholdEvent registers a function that's called with every threshold
+// event. It has to be called before the engine is initialized, and the hook
+// shouldn't block, since the metrics are locked while it runs.
+func (e *Engine) OnThresholdEvent(hook func(lib.ThresholdEvent)) {
+	e.thresholdEventHooks = append(e.thresholdEventHooks, hook)
+}
+
+// GetThresholdEvents returns all threshold events of the test run so far.
+func (e *Engine) GetThresholdEvents() []lib.ThresholdEvent {
+	e.thresholdEventsMu.Lock()
+	defer e.thresholdEventsMu.Unlock()
+	return append([]lib.ThresholdEvent(nil), e.thresholdEvents...)
+}
+
+// newMetric creates a new metric for the engine's own use, configuring its sink
+// according to the engine options.
+func (e *Engine) newMetric(name string, typ stats.MetricType, contains stats.ValueType) *stats.Metric {
+	m := stats.New(name, typ, contains)
+	if trendSink, ok := m.Sink.(*stats.TrendSink); ok {
+		if e.trendSpill != nil {
+			trendSink.SetSpill(e.trendSpill)
+		}
+		trendSink.Percentiles = e.trendPercentiles(name)
+		if e.runtimeOptions.CheckpointFile.Valid {
+			trendSink.TrackNewValues()
+		}
+	}
+	return m
+}
+
+// trendPercentiles returns the configured percentiles of the trend metric or
+// submetric with the given name. Submetrics have the percentiles of their
+// parent metric, unless they have their own.
+func (e *Engine) trendPercentiles(name string) []float64 {
+	columns, ok := e.Options.TrendPercentiles[name]
+	if !ok {
+		columns = e.Options.TrendPercentiles[strings.SplitN(name, "{", 2)[0]]
+	}
+	var percentiles []float64
+	for _, col := range columns {
+		// The percentiles were already validated with the options
+		if percentile, err := stats.ParsePercentile(col); err == nil {
+			percentiles = append(percentiles, percentile)
+		}
+	}
+	return percentiles
+}
+
+// getOrCreateMetric returns the engine's own copy of the metric for the given
+// sample, creating it if it doesn't exist yet. It needs to be called with the
+// MetricsLock held and it is not safe to be called concurrently.
+func (e *Engine) getOrCreateMetric(sample stats.Sample) *stats.Metric {
+	m, ok := e.Metrics[sample.Metric.Name]
+	if !ok {
+		m = e.newMetric(sample.Metric.Name, sample.Metric.Type, sample.Metric.Contains)
+		m.Unit, m.Description = sample.Metric.Unit, sample.Metric.Description
+		m.Thresholds = e.thresholds[m.Name]
+		m.Submetrics = e.submetrics[m.Name]
+		e.Metrics[m.Name] = m
+	}
+	return m
+}
+
+// matchingSubmetrics appends the submetrics of the metric whose tags match the
+// ones of the sample to the given slice.
+func matchingSubmetrics(m *stats.Metric, sample stats.Sample, matched []*stats.Submetric) []*stats.Submetric {
+	for _, sm := range m.Submetrics {
+		if sample.Tags.Contains(sm.Tags) {
+			matched = append(matched, sm)
+		}
+	}
+	return matched
+}
+
+// addSampleToMetric adds the sample to the sinks of the metric and of the
+// given matching submetrics. Any submetrics that have to be created for the
+// first time are returned, so they can be registered in the Metrics map by the
+// caller, since this function may be called concurrently by the metrics workers.
+func (e *Engine) addSampleToMetric(
+	m *stats.Metric, sample stats.Sample, matched []*stats.Submetric, newSubmetrics []*stats.Metric,
+) []*stats.Metric {
+	m.Sink.Add(sample)
+	m.Thresholds.AddSample(sample)
+
+	for _, sm := range matched {
+		if sm.Metric == nil {
+			e.newSubmetric(sm, sample.Metric)
+			newSubmetrics = append(newSubmetrics, sm.Metric)
+		}
+		sm.Metric.Sink.Add(sample)
+		sm.Metric.Thresholds.AddSample(sample)
+	}
+	return newSubmetrics
+}
+
+// newSubmetric creates the metric of the submetric, like the given metric of
+// its samples.
+func (e *Engine) newSubmetric(sm *stats.Submetric, sampleMetric *stats.Metric) {
+	sm.Metric = e.newMetric(sm.Name, sampleMetric.Type, sampleMetric.Contains)
+	sm.Metric.Unit, sm.Metric.Description = sampleMetric.Unit, sampleMetric.Description
+	sm.Metric.Sub = *sm
+	sm.Metric.Thresholds = e.thresholds[sm.Name]
+}
+
 func (e *Engine) processSamplesForMetrics(sampleContainers []stats.SampleContainer) {
+	if e.metricsWorkers != nil {
+		e.processSamplesForMetricsSharded(sampleContainers)
+		return
+	}
+
+	var newSubmetrics []*stats.Metric
+	var matched []*stats.Submetric
 	for _, sampleContainer := range sampleContainers {
 		samples := sampleContainer.GetSamples()
 
@@ -458,30 +780,28 @@ func (e *Engine) processSamplesForMetrics(sampleContainers []stats.SampleContain
 		}
 
 		for _, sample := range samples {
-			m, ok := e.Metrics[sample.Metric.Name]
-			if !ok {
-				m = stats.New(sample.Metric.Name, sample.Metric.Type, sample.Metric.Contains)
-				m.Thresholds = e.thresholds[m.Name]
-				m.Submetrics = e.submetrics[m.Name]
-				e.Metrics[m.Name] = m
-			}
-			m.Sink.Add(sample)
-
-			for _, sm := range m.Submetrics {
-				if !sample.Tags.Contains(sm.Tags) {
-					continue
-				}
-
-				if sm.Metric == nil {
-					sm.Metric = stats.New(sm.Name, sample.Metric.Type, sample.Metric.Contains)
-					sm.Metric.Sub = *sm
-					sm.Metric.Thresholds = e.thresholds[sm.Name]
-					e.Metrics[sm.Name] = sm.Metric
-				}
-				sm.Metric.Sink.Add(sample)
-			}
+			m := e.getOrCreateMetric(sample)
+			matched = matchingSubmetrics(m, sample, matched[:0])
+			newSubmetrics = e.addSampleToMetric(m, sample, matched, newSubmetrics)
 		}
 	}
+	for _, sm := range newSubmetrics {
+		e.Metrics[sm.Name] = sm
+	}
+}
+
+// fnv32a is an inlined allocation-free version of the 32-bit FNV-1a hash.
+func fnv32a(s string) uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	hash := uint32(offset32)
+	for i := 0; i < len(s); i++ {
+		hash ^= uint32(s[i])
+		hash *= prime32
+	}
+	return hash
 }
 
 func (e *Engine) processSamples(sampleContainers []stats.SampleContainer) {
@@ -489,6 +809,18 @@ func (e *Engine) processSamples(sampleContainers []stats.SampleContainer) {
 		return
 	}
 
+	// Warm-up samples are dropped before everything else, so they don't
+	// affect the thresholds, the summary or any of the outputs.
+	if e.warmupFilter != nil {
+		if sampleContainers = e.warmupFilter.Samples(sampleContainers); len(sampleContainers) == 0 {
+			return
+		}
+	}
+
+	// Executors like adaptive-arrival-rate adjust their load based on what
+	// they observe here, so they have to see the samples the thresholds see.
+	e.ExecutionScheduler.GetState().ObserveSamples(sampleContainers)
+
 	// TODO: optimize this...
 	e.MetricsLock.Lock()
 	defer e.MetricsLock.Unlock()
@@ -497,6 +829,24 @@ func (e *Engine) processSamples(sampleContainers []stats.SampleContainer) {
 	if !(e.runtimeOptions.NoSummary.Bool && e.runtimeOptions.NoThresholds.Bool) {
 		e.processSamplesForMetrics(sampleContainers)
 	}
+	if e.RequestTimings != nil {
+		for _, sc := range sampleContainers {
+			e.RequestTimings.Add(sc.GetSamples())
+		}
+	}
+
+	// Redaction happens only after the thresholds and the summary had a chance
+	// to see the original tags, so submetrics like `{url:...}` still work.
+	if e.redactor != nil {
+		e.redactor.Samples(sampleContainers)
+	}
+	// The same goes for the cardinality limit, which only matters to the
+	// outputs, since the thresholds and the summary don't keep time series.
+	if e.cardinalityLimiter != nil {
+		if err := e.cardinalityLimiter.Samples(sampleContainers); err != nil {
+			e.stopWithError(err)
+		}
+	}
 
 	for _, out := range e.outputs {
 		out.AddMetricSamples(sampleContainers)
@@ -22,13 +22,20 @@ package core
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
+	"path/filepath"
 	"runtime"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"gopkg.in/guregu/null.v3"
@@ -36,8 +43,10 @@ import (
 	"github.com/loadimpact/k6/core/local"
 	"github.com/loadimpact/k6/js"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/cardinality"
 	"github.com/loadimpact/k6/lib/executor"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/redact"
 	"github.com/loadimpact/k6/lib/testutils"
 	"github.com/loadimpact/k6/lib/testutils/httpmultibin"
 	"github.com/loadimpact/k6/lib/testutils/minirunner"
@@ -52,7 +61,7 @@ const isWindows = runtime.GOOS == "windows"
 
 // Wrapper around NewEngine that applies a logger and manages the options.
 func newTestEngine( //nolint:golint
-	t *testing.T, runCtx context.Context, runner lib.Runner, outputs []output.Output, opts lib.Options,
+	t testing.TB, runCtx context.Context, runner lib.Runner, outputs []output.Output, opts lib.Options,
 ) (engine *Engine, run func() error, wait func()) {
 	if runner == nil {
 		runner = &minirunner.MiniRunner{}
@@ -195,6 +204,56 @@ func TestEngineStopped(t *testing.T) {
 	e.Stop() // test that a second stop doesn't panic
 }
 
+type stoppingOutput struct {
+	*mockoutput.MockOutput
+	stopFunc func(error)
+}
+
+func (so *stoppingOutput) SetTestRunStopCallback(stopFunc func(error)) {
+	so.stopFunc = stopFunc
+}
+
+func TestEngineStoppedByOutput(t *testing.T) {
+	started := make(chan struct{})
+	runner := &minirunner.MiniRunner{Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+		close(started)
+		<-ctx.Done()
+		return nil
+	}}
+
+	out := &stoppingOutput{MockOutput: mockoutput.New()}
+	e, run, wait := newTestEngine(t, nil, runner, []output.Output{out}, lib.Options{
+		VUs:        null.IntFrom(1),
+		Iterations: null.IntFrom(1),
+	})
+	require.NoError(t, e.StartOutputs())
+	require.NotNil(t, out.stopFunc)
+	assert.NoError(t, e.GetStopError())
+
+	go func() {
+		<-started
+		out.stopFunc(errors.New("remote failure"))
+	}()
+
+	runResult := make(chan error, 1)
+	go func() {
+		runResult <- run()
+	}()
+
+	select {
+	case err := <-runResult:
+		assert.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the test run should have been stopped")
+	}
+	wait()
+	e.StopOutputs()
+
+	assert.True(t, e.IsStopped())
+	assert.EqualError(t, e.GetStopError(), "remote failure")
+	assert.Equal(t, lib.RunStatusAbortedSystem, out.RunStatus)
+}
+
 func TestEngineOutput(t *testing.T) {
 	testMetric := stats.New("test_metric", stats.Trend)
 
@@ -267,6 +326,457 @@ func TestEngine_processSamples(t *testing.T) {
 	})
 }
 
+func TestEngineCheckpointResume(t *testing.T) {
+	t.Parallel()
+	ths, err := stats.NewThresholds([]string{`1+1==2`})
+	require.NoError(t, err)
+	opts := lib.Options{Thresholds: map[string]stats.Thresholds{"my_trend{a:1}": ths}}
+
+	trend := stats.New("my_trend", stats.Trend)
+	trend.Unit, trend.Description = "ms", "The time of my operation"
+	counter := stats.New("my_counter", stats.Counter)
+	gauge := stats.New("my_gauge", stats.Gauge)
+	rate := stats.New("my_rate", stats.Rate)
+	tags := stats.IntoSampleTags(&map[string]string{"a": "1"})
+	var samples []stats.SampleContainer
+	for i, value := range []float64{3, -1, 2, 0} {
+		samples = append(samples,
+			stats.Sample{Metric: trend, Value: value, Tags: tags},
+			stats.Sample{Metric: counter, Value: value, Tags: tags},
+			stats.Sample{Metric: gauge, Value: value, Tags: tags},
+			stats.Sample{Metric: rate, Value: float64(i % 2), Tags: tags},
+		)
+	}
+
+	e, _, wait := newTestEngine(t, nil, nil, nil, opts)
+	defer wait()
+	e.processSamples(samples)
+	checkpoint, err := e.Checkpoint()
+	require.NoError(t, err)
+	assert.Len(t, checkpoint.Metrics, 5)
+
+	resumed, _, resumedWait := newTestEngine(t, nil, nil, nil, opts)
+	defer resumedWait()
+	require.NoError(t, resumed.Resume(checkpoint))
+	require.Len(t, resumed.Metrics, 5)
+	for name, m := range e.Metrics {
+		assert.Equal(t, m.Sink.Format(time.Second), resumed.Metrics[name].Sink.Format(time.Second), name)
+	}
+	assert.Equal(t, resumed.Metrics["my_trend{a:1}"], resumed.submetrics["my_trend"][0].Metric)
+	for _, name := range []string{"my_trend", "my_trend{a:1}"} {
+		assert.Equal(t, "ms", e.Metrics[name].Unit)
+		assert.Equal(t, "The time of my operation", resumed.Metrics[name].Description)
+	}
+
+	again, err := resumed.Checkpoint()
+	require.NoError(t, err)
+	assert.Equal(t, checkpoint.Metrics["my_counter"], again.Metrics["my_counter"])
+}
+
+func TestEngineCheckpointNewTrendValues(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	w := lib.NewCheckpointWriter(fs, "/checkpoint.json")
+	trend := stats.New("my_trend", stats.Trend)
+
+	e, _, wait := newTestEngine(t, nil, nil, nil, lib.Options{})
+	defer wait()
+	e.runtimeOptions.CheckpointFile = null.StringFrom("/checkpoint.json")
+	for _, values := range [][]float64{{3, 1}, {2}, {}} {
+		var samples []stats.SampleContainer
+		for _, value := range values {
+			samples = append(samples, stats.Sample{Metric: trend, Value: value})
+		}
+		e.processSamples(samples)
+		e.Metrics["my_trend"].Sink.Calc()
+
+		// Only the values added since the previous checkpoint are in it
+		checkpoint, err := e.Checkpoint()
+		require.NoError(t, err)
+		assert.Equal(t, values, append([]float64{}, checkpoint.Metrics["my_trend"].Values...))
+		require.NoError(t, w.Save(checkpoint))
+	}
+
+	checkpoint, err := lib.LoadCheckpoint(fs, "/checkpoint.json")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{3, 1, 2}, checkpoint.Metrics["my_trend"].Values)
+	resumed, _, resumedWait := newTestEngine(t, nil, nil, nil, lib.Options{})
+	defer resumedWait()
+	require.NoError(t, resumed.Resume(checkpoint))
+	assert.Equal(t, e.Metrics["my_trend"].Sink.Format(time.Second), resumed.Metrics["my_trend"].Sink.Format(time.Second))
+}
+
+func TestEngineClosesTrendSpillFiles(t *testing.T) {
+	t.Parallel()
+	if runtime.GOOS != "linux" {
+		t.Skip("the open spill files are found through /proc")
+	}
+	dir, err := ioutil.TempDir("", "k6-spill-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	// The spill files are unlinked as soon as they are created, so only the
+	// open file descriptors of the process still point to them
+	openSpillFiles := func() int {
+		fds, err := ioutil.ReadDir("/proc/self/fd")
+		require.NoError(t, err)
+		count := 0
+		for _, fd := range fds {
+			target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name()))
+			if err == nil && strings.HasPrefix(target, dir) {
+				count++
+			}
+		}
+		return count
+	}
+
+	e, _, wait := newTestEngine(t, nil, nil, nil, lib.Options{})
+	e.trendSpill = &stats.TrendSpill{Dir: dir, Threshold: 2}
+	trend := stats.New("my_trend", stats.Trend)
+	var samples []stats.SampleContainer
+	for _, value := range []float64{3, 1, 4, 1, 5} {
+		samples = append(samples, stats.Sample{Metric: trend, Value: value})
+	}
+	e.processSamples(samples)
+	assert.Equal(t, 1, openSpillFiles())
+
+	wait()
+	assert.Equal(t, 0, openSpillFiles())
+	// The aggregates can still be used after the sinks are closed
+	sink := e.Metrics["my_trend"].Sink
+	assert.Equal(t, 5.0, sink.Format(0)["max"])
+	assert.Equal(t, 3.0, sink.Format(0)["med"])
+}
+
+func TestEngine_processSamplesRedacted(t *testing.T) {
+	t.Parallel()
+
+	ths, err := stats.NewThresholds([]string{`count>0`})
+	require.NoError(t, err)
+	mockOutput := mockoutput.New()
+	e, _, wait := newTestEngine(t, nil, nil, []output.Output{mockOutput}, lib.Options{
+		Redact: &redact.Config{Tags: []string{"token"}, Values: []string{`email=[^&]+`}},
+		Thresholds: map[string]stats.Thresholds{
+			"my_metric{token:abc}": ths,
+		},
+	})
+	defer wait()
+
+	metric := stats.New("my_metric", stats.Counter)
+	e.processSamples([]stats.SampleContainer{stats.Sample{
+		Metric: metric,
+		Value:  1,
+		Tags:   stats.IntoSampleTags(&map[string]string{"token": "abc", "url": "/?email=a@b.c&x=1"}),
+	}})
+
+	// The submetric still matches the original tags...
+	assert.Equal(t, float64(1), e.Metrics["my_metric{token:abc}"].Sink.(*stats.CounterSink).Value)
+	// ... but the outputs see only the redacted ones
+	require.Len(t, mockOutput.Samples, 1)
+	assert.Equal(t,
+		map[string]string{"token": "***", "url": "/?***&x=1"},
+		mockOutput.Samples[0].Tags.CloneTags(),
+	)
+}
+
+func TestEngine_processSamplesTrendPercentiles(t *testing.T) {
+	t.Parallel()
+
+	ths, err := stats.NewThresholds([]string{`p(99.9)<1000`})
+	require.NoError(t, err)
+	e, _, wait := newTestEngine(t, nil, nil, nil, lib.Options{
+		TrendPercentiles: map[string][]string{"my_trend": {"p(75)", "p(99.9)"}},
+		Thresholds:       map[string]stats.Thresholds{"my_trend{a:1}": ths},
+	})
+	defer wait()
+
+	metric := stats.New("my_trend", stats.Trend)
+	other := stats.New("other_trend", stats.Trend)
+	tags := stats.IntoSampleTags(&map[string]string{"a": "1"})
+	e.processSamples([]stats.SampleContainer{
+		stats.Sample{Metric: metric, Value: 1, Tags: tags},
+		stats.Sample{Metric: other, Value: 1, Tags: tags},
+	})
+
+	assert.Equal(t, []float64{75, 99.9}, e.Metrics["my_trend"].Sink.(*stats.TrendSink).Percentiles)
+	assert.Contains(t, e.Metrics["my_trend{a:1}"].Sink.Format(0), "p(99.9)")
+	assert.Empty(t, e.Metrics["other_trend"].Sink.(*stats.TrendSink).Percentiles)
+	assert.Contains(t, e.Metrics["other_trend"].Sink.Format(0), "p(95)")
+}
+
+func TestEngine_processSamplesCardinalityLimit(t *testing.T) {
+	t.Parallel()
+
+	mockOutput := mockoutput.New()
+	e, _, wait := newTestEngine(t, nil, nil, []output.Output{mockOutput}, lib.Options{
+		CardinalityLimit: &cardinality.Config{MaxSeriesPerMetric: 2, Action: cardinality.ActionAbort},
+	})
+	defer wait()
+
+	metric := stats.New("my_metric", stats.Counter)
+	for i := 0; i < 3; i++ {
+		e.processSamples([]stats.SampleContainer{stats.Sample{
+			Metric: metric,
+			Value:  1,
+			Tags:   stats.IntoSampleTags(&map[string]string{"url": fmt.Sprintf("/%d", i)}),
+		}})
+		assert.Equal(t, i == 2, e.IsStopped())
+	}
+	require.Len(t, mockOutput.Samples, 3)
+	require.Error(t, e.GetStopError())
+	assert.Contains(t, e.GetStopError().Error(), "the metric 'my_metric' reached the limit of 2 time series")
+}
+
+func TestEngine_processSamplesWarmup(t *testing.T) {
+	t.Parallel()
+
+	newScenario := func(name string, discardFor types.NullDuration) lib.ExecutorConfig {
+		conf := executor.NewConstantVUsConfig(name)
+		conf.Duration = types.NullDurationFrom(time.Minute)
+		conf.DiscardMetricsFor = discardFor
+		return conf
+	}
+	mockOutput := mockoutput.New()
+	e, _, wait := newTestEngine(t, nil, nil, []output.Output{mockOutput}, lib.Options{
+		DiscardMetricsFor: types.NullDurationFrom(time.Minute),
+		Scenarios: lib.ScenarioConfigs{
+			"global": newScenario("global", types.NullDuration{}),
+			"short":  newScenario("short", types.NullDurationFrom(time.Second)),
+			"none":   newScenario("none", types.NullDurationFrom(0)),
+		},
+	})
+	defer wait()
+
+	e.executionState.MarkStarted()
+	for _, name := range []string{"global", "short", "none"} {
+		e.executionState.MarkScenarioStarted(name)
+	}
+
+	metric := stats.New("my_metric", stats.Counter)
+	newSample := func(scenario string, after time.Duration) stats.Sample {
+		tags := map[string]string{}
+		if scenario != "" {
+			tags["scenario"] = scenario
+		}
+		return stats.Sample{
+			Metric: metric,
+			Time:   time.Now().Add(after),
+			Value:  1,
+			Tags:   stats.IntoSampleTags(&tags),
+		}
+	}
+	e.processSamples([]stats.SampleContainer{
+		newSample("", 0),
+		newSample("global", 0),
+		newSample("short", 0),
+		newSample("none", 0),
+		stats.Samples{newSample("short", 0), newSample("short", 2*time.Second)},
+		newSample("", 2*time.Minute),
+		newSample("global", 2*time.Minute),
+	})
+
+	require.Len(t, mockOutput.Samples, 4)
+	assert.Equal(t, "none", mockOutput.Samples[0].Tags.CloneTags()["scenario"])
+	assert.Equal(t, "short", mockOutput.Samples[1].Tags.CloneTags()["scenario"])
+	assert.Equal(t, float64(4), e.Metrics["my_metric"].Sink.(*stats.CounterSink).Value)
+}
+
+func TestEngine_processSamplesObservers(t *testing.T) {
+	t.Parallel()
+	e, _, wait := newTestEngine(t, nil, nil, nil, lib.Options{})
+	defer wait()
+
+	var observed []stats.SampleContainer
+	remove := e.executionState.AddSampleObserver(func(sampleContainers []stats.SampleContainer) {
+		observed = append(observed, sampleContainers...)
+	})
+
+	metric := stats.New("my_metric", stats.Counter)
+	sample := stats.Sample{Metric: metric, Time: time.Now(), Value: 1}
+	e.processSamples([]stats.SampleContainer{sample})
+	assert.Equal(t, []stats.SampleContainer{sample}, observed)
+
+	remove()
+	e.processSamples([]stats.SampleContainer{sample})
+	assert.Len(t, observed, 1)
+}
+
+func TestEngine_processSamplesSharded(t *testing.T) {
+	t.Parallel()
+
+	ths, err := stats.NewThresholds([]string{`1+1==2`})
+	require.NoError(t, err)
+
+	e, _, wait := newTestEngine(t, nil, nil, nil, lib.Options{
+		MetricsProcessingWorkers: null.IntFrom(4),
+		Thresholds: map[string]stats.Thresholds{
+			"metric_0{a:1}": ths,
+		},
+	})
+	defer wait()
+	require.Len(t, e.metricsWorkers.shards, 4)
+
+	const metricsCount, samplesPerMetric = 20, 50
+	containers := make([]stats.SampleContainer, 0, metricsCount*samplesPerMetric)
+	for i := 0; i < samplesPerMetric; i++ {
+		for j := 0; j < metricsCount; j++ {
+			containers = append(containers, stats.Sample{
+				Metric: stats.New(fmt.Sprintf("metric_%d", j), stats.Counter),
+				Value:  1,
+				Tags:   stats.IntoSampleTags(&map[string]string{"a": strconv.Itoa(i % 2)}),
+			})
+		}
+	}
+	e.processSamples(containers)
+
+	require.Len(t, e.Metrics, metricsCount+1)
+	for j := 0; j < metricsCount; j++ {
+		m := e.Metrics[fmt.Sprintf("metric_%d", j)]
+		require.NotNil(t, m)
+		assert.Equal(t, float64(samplesPerMetric), m.Sink.(*stats.CounterSink).Value)
+	}
+	sm := e.Metrics["metric_0{a:1}"]
+	require.NotNil(t, sm)
+	assert.Equal(t, float64(samplesPerMetric/2), sm.Sink.(*stats.CounterSink).Value)
+
+	// The samples of gauges are added in order, even if they have different tags
+	gauge := stats.New("my_gauge", stats.Gauge)
+	containers = containers[:0]
+	for i := 0; i < 100; i++ {
+		containers = append(containers, stats.Sample{
+			Metric: gauge,
+			Value:  float64(i),
+			Tags:   stats.IntoSampleTags(&map[string]string{"a": strconv.Itoa(i)}),
+		})
+	}
+	e.processSamples(containers)
+	assert.Equal(t, float64(99), e.Metrics["my_gauge"].Sink.(*stats.GaugeSink).Value)
+}
+
+func TestEngine_processSamplesShardedMatchesSequential(t *testing.T) {
+	t.Parallel()
+
+	ths, err := stats.NewThresholds([]string{`1+1==2`})
+	require.NoError(t, err)
+	windowed, err := stats.NewThresholds([]string{`avg_over(1m) < 200`})
+	require.NoError(t, err)
+	thresholds := map[string]stats.Thresholds{
+		"my_trend":        windowed,
+		"my_trend{a:1}":   ths,
+		"my_rate{a:0}":    ths,
+		"my_counter{a:2}": ths,
+	}
+
+	now := time.Now()
+	testMetrics := []*stats.Metric{
+		stats.New("my_trend", stats.Trend), stats.New("my_rate", stats.Rate),
+		stats.New("my_counter", stats.Counter), stats.New("my_gauge", stats.Gauge),
+	}
+	containers := make([]stats.SampleContainer, 0, 300)
+	for i := 0; i < 300; i++ {
+		tags := stats.IntoSampleTags(&map[string]string{"a": strconv.Itoa(i % 3), "b": strconv.Itoa(i % 7)})
+		samples := make([]stats.Sample, 0, len(testMetrics))
+		for j, m := range testMetrics {
+			samples = append(samples, stats.Sample{
+				Metric: m, Time: now.Add(time.Duration(i) * time.Millisecond), Value: float64((i * j) % 11), Tags: tags,
+			})
+		}
+		containers = append(containers, stats.ConnectedSamples{Samples: samples, Tags: tags})
+	}
+
+	process := func(workers int64) map[string]stats.Sink {
+		e, _, wait := newTestEngine(t, nil, nil, nil, lib.Options{
+			MetricsProcessingWorkers: null.IntFrom(workers),
+			Thresholds:               thresholds,
+		})
+		defer wait()
+		// In a few batches, so the sinks of the workers are merged and reused
+		for i := 0; i < len(containers); i += 100 {
+			e.processSamples(containers[i : i+100])
+		}
+		sinks := make(map[string]stats.Sink, len(e.Metrics))
+		for name, m := range e.Metrics {
+			sinks[name] = m.Sink
+		}
+		assert.False(t, e.processThresholds())
+		return sinks
+	}
+
+	sequential, sharded := process(1), process(4)
+	require.Len(t, sharded, len(sequential))
+	for name, sink := range sequential {
+		require.Contains(t, sharded, name)
+		assert.Equal(t, sink.Format(time.Second), sharded[name].Format(time.Second), name)
+	}
+}
+
+func BenchmarkProcessSamples(b *testing.B) {
+	ths, err := stats.NewThresholds([]string{`1+1==2`})
+	require.NoError(b, err)
+	thresholds := map[string]stats.Thresholds{
+		"http_req_duration":              ths,
+		"http_req_duration{status:200}":  ths,
+		"http_req_duration{url:/page/0}": ths,
+		"http_req_failed{method:GET}":    ths,
+	}
+
+	// Every request emits the same samples as the HTTP module, with a mix of
+	// tags like in a test that hits a few different URLs
+	const requests = 1000
+	trends := []*stats.Metric{
+		metrics.HTTPReqDuration, metrics.HTTPReqBlocked, metrics.HTTPReqDNSLookup, metrics.HTTPReqConnecting,
+		metrics.HTTPReqTLSHandshaking, metrics.HTTPReqSending, metrics.HTTPReqWaiting, metrics.HTTPReqReceiving,
+	}
+	containers := make([]stats.SampleContainer, 0, requests)
+	for i := 0; i < requests; i++ {
+		status, failed := "200", 0.0
+		if i%10 == 0 {
+			status, failed = "404", 1.0
+		}
+		tags := stats.IntoSampleTags(&map[string]string{
+			"method": []string{"GET", "POST"}[i%2], "url": fmt.Sprintf("/page/%d", i%20),
+			"name": fmt.Sprintf("/page/%d", i%20), "status": status, "proto": "HTTP/1.1", "scenario": "default",
+		})
+		samples := []stats.Sample{
+			{Metric: metrics.HTTPReqs, Value: 1, Tags: tags},
+			{Metric: metrics.HTTPReqFailed, Value: failed, Tags: tags},
+		}
+		for j, trend := range trends {
+			samples = append(samples, stats.Sample{Metric: trend, Value: float64(i*j%97) / 7, Tags: tags})
+		}
+		containers = append(containers, stats.ConnectedSamples{Samples: samples, Tags: tags})
+	}
+
+	// A single busy metric, whose samples all used to wait for the same lock
+	hot := make([]stats.SampleContainer, 0, requests)
+	for i := 0; i < requests; i++ {
+		tags := stats.IntoSampleTags(&map[string]string{"url": fmt.Sprintf("/page/%d", i%50), "status": "200"})
+		hot = append(hot, stats.Sample{Metric: metrics.HTTPReqDuration, Value: float64(i % 97), Tags: tags})
+	}
+
+	for _, bc := range []struct {
+		name       string
+		containers []stats.SampleContainer
+	}{{"http", containers}, {"hot", hot}} {
+		for _, workers := range []int64{1, 4, 8} {
+			bc, workers := bc, workers
+			b.Run(fmt.Sprintf("%s/workers=%d", bc.name, workers), func(b *testing.B) {
+				e, _, wait := newTestEngine(b, nil, nil, nil, lib.Options{
+					MetricsProcessingWorkers: null.IntFrom(workers),
+					Thresholds:               thresholds,
+				})
+				defer wait()
+
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					e.processSamples(bc.containers)
+				}
+			})
+		}
+	}
+}
+
 func TestEngineThresholdsWillAbort(t *testing.T) {
 	metric := stats.New("my_metric", stats.Gauge)
 
@@ -285,6 +795,67 @@ func TestEngineThresholdsWillAbort(t *testing.T) {
 	assert.True(t, e.processThresholds())
 }
 
+func TestEngineWindowedThresholds(t *testing.T) {
+	t.Parallel()
+	metric := stats.New("my_metric", stats.Trend)
+
+	ths, err := stats.NewThresholds([]string{"avg_over(1m) < 200"})
+	require.NoError(t, err)
+	ths.Thresholds[0].AbortOnFail = true
+
+	e, _, wait := newTestEngine(t, nil, nil, nil, lib.Options{
+		Thresholds: map[string]stats.Thresholds{metric.Name: ths},
+	})
+	defer wait()
+
+	now := time.Now()
+	e.processSamples([]stats.SampleContainer{
+		stats.Sample{Metric: metric, Time: now.Add(-5 * time.Minute), Value: 1000},
+		stats.Sample{Metric: metric, Time: now, Value: 100},
+	})
+	assert.False(t, e.processThresholds())
+	assert.False(t, e.IsTainted())
+
+	e.processSamples([]stats.SampleContainer{stats.Sample{Metric: metric, Time: now, Value: 500}})
+	assert.True(t, e.processThresholds())
+	assert.True(t, e.IsTainted())
+}
+
+func TestEngineThresholdEvents(t *testing.T) {
+	t.Parallel()
+	metric := stats.New("my_metric", stats.Gauge)
+
+	ths, err := stats.NewThresholds([]string{"value<10", "value<100"})
+	require.NoError(t, err)
+	ths.Thresholds[0].AbortOnFail = true
+
+	e, _, wait := newTestEngine(t, nil, nil, nil, lib.Options{
+		Thresholds: map[string]stats.Thresholds{metric.Name: ths},
+	})
+	defer wait()
+	var hooked []lib.ThresholdEvent
+	e.OnThresholdEvent(func(event lib.ThresholdEvent) { hooked = append(hooked, event) })
+
+	for _, value := range []float64{5, 20, 30, 5} {
+		e.processSamples([]stats.SampleContainer{stats.Sample{Metric: metric, Time: time.Now(), Value: value}})
+		e.processThresholds()
+	}
+
+	events := e.GetThresholdEvents()
+	assert.Equal(t, hooked, events)
+	require.Len(t, events, 3)
+	assert.Equal(t, lib.ThresholdBreached, events[0].Type)
+	assert.Equal(t, lib.ThresholdAborted, events[1].Type)
+	assert.Equal(t, lib.ThresholdRecovered, events[2].Type)
+	for _, event := range events {
+		assert.Equal(t, "my_metric", event.Metric)
+		assert.Equal(t, "value<10", event.Threshold)
+		assert.True(t, event.AbortOnFail)
+	}
+	assert.Equal(t, map[string]float64{"value": 20}, events[0].Values)
+	assert.Equal(t, map[string]float64{"value": 5}, events[2].Values)
+}
+
 func TestEngineAbortedByThresholds(t *testing.T) {
 	metric := stats.New("my_metric", stats.Gauge)
 
@@ -302,8 +873,9 @@ func TestEngineAbortedByThresholds(t *testing.T) {
 		return nil
 	}}
 
-	_, run, wait := newTestEngine(t, nil, runner, nil, lib.Options{Thresholds: thresholds})
+	e, run, wait := newTestEngine(t, nil, runner, nil, lib.Options{Thresholds: thresholds})
 	defer wait()
+	assert.False(t, e.IsAbortedByThresholds())
 
 	go func() {
 		assert.NoError(t, run())
@@ -311,7 +883,7 @@ func TestEngineAbortedByThresholds(t *testing.T) {
 
 	select {
 	case <-done:
-		return
+		assert.True(t, e.IsAbortedByThresholds())
 	case <-time.After(10 * time.Second):
 		assert.Fail(t, "Test should have completed within 10 seconds")
 	}
@@ -975,3 +1547,44 @@ func TestEngineRunsTeardownEvenAfterTestRunIsAborted(t *testing.T) {
 	}
 	assert.Equal(t, 1.0, count)
 }
+
+func TestEngineRunsTeardownAfterThresholdAbort(t *testing.T) {
+	t.Parallel()
+	metric := stats.New("my_metric", stats.Gauge)
+	teardownMetric := stats.New("teardown_metric", stats.Counter)
+	ths, err := stats.NewThresholds([]string{"1+1==3"})
+	require.NoError(t, err)
+	ths.Thresholds[0].AbortOnFail = true
+
+	runner := &minirunner.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			out <- stats.Sample{Metric: metric, Value: 1}
+			<-ctx.Done()
+			return nil
+		},
+		TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			out <- stats.Sample{Metric: teardownMetric, Value: 1}
+			return nil
+		},
+	}
+
+	mockOutput := mockoutput.New()
+	e, run, wait := newTestEngine(t, nil, runner, []output.Output{mockOutput}, lib.Options{
+		VUs:        null.IntFrom(1),
+		Duration:   types.NullDurationFrom(time.Hour),
+		Thresholds: map[string]stats.Thresholds{metric.Name: ths},
+	})
+
+	errC := make(chan error)
+	go func() { errC <- run() }()
+	select {
+	case err := <-errC:
+		require.NoError(t, err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the test run wasn't aborted by the thresholds")
+	}
+	wait()
+
+	assert.True(t, e.IsTainted())
+	assert.Equal(t, 1.0, getMetricSum(mockOutput, teardownMetric.Name))
+}
@@ -80,6 +80,10 @@ func NewExecutionScheduler(runner lib.Runner, logger *logrus.Logger) (*Execution
 			)
 			continue
 		}
+		if _, ok := runner.(lib.ScenarioSetupRunner); !ok && (sc.GetSetup() != "" || sc.GetTeardown() != "") {
+			return nil, fmt.Errorf("scenario '%s' has setup or teardown functions, which the runner doesn't support",
+				sc.GetName())
+		}
 		s, err := sc.NewExecutor(executionState, logger.WithFields(logrus.Fields{
 			"scenario": sc.GetName(),
 			"executor": sc.GetType(),
@@ -286,52 +290,119 @@ func (e *ExecutionScheduler) Init(ctx context.Context, samplesOut chan<- stats.S
 // runExecutor gets called by the public Run() method once per configured
 // executor, each time in a new goroutine. It is responsible for waiting out the
 // configured startTime for the specific executor and then running its Run()
-// method.
+// method - once for every occurrence, if it's scheduled with startCron or
+// startAt, so the test keeps running until all of them are done.
 func (e *ExecutionScheduler) runExecutor(
-	runCtx context.Context, runResults chan<- error, engineOut chan<- stats.SampleContainer, executor lib.Executor,
+	globalCtx, runCtx context.Context, runResults chan<- error, engineOut chan<- stats.SampleContainer,
+	executor lib.Executor,
 ) {
 	executorConfig := executor.GetConfig()
-	executorStartTime := executorConfig.GetStartTime()
-	executorLogger := e.logger.WithFields(logrus.Fields{
-		"executor":  executorConfig.GetName(),
-		"type":      executorConfig.GetType(),
-		"startTime": executorStartTime,
-	})
+	scheduleStart := time.Now()
+	startTimes := executorConfig.GetStartTimes(scheduleStart)
+	if len(startTimes) == 0 {
+		e.logger.WithField("executor", executorConfig.GetName()).Warn(
+			"The executor won't run, since none of its scheduled start times is in the future")
+		executor.GetProgress().Modify(pb.WithConstProgress(0, "no scheduled runs"))
+		runResults <- nil
+		return
+	}
+
+	var err error
+	for i, executorStartTime := range startTimes {
+		executorLogger := e.logger.WithFields(logrus.Fields{
+			"executor":  executorConfig.GetName(),
+			"type":      executorConfig.GetType(),
+			"startTime": executorStartTime,
+		})
+		if i > 0 {
+			// Occurrences that were missed while the previous one was still
+			// running are skipped, the executor never runs concurrently with itself
+			if time.Since(scheduleStart) > executorStartTime {
+				executorLogger.Warnf("Skipping a scheduled run, since the previous one ended after its start time")
+				continue
+			}
+			executorLogger = executorLogger.WithField("occurrence", i+1)
+		}
+
+		var started bool
+		started, err = e.runExecutorOnce(
+			globalCtx, runCtx, engineOut, executor, scheduleStart.Add(executorStartTime), executorLogger,
+		)
+		if !started || err != nil || runCtx.Err() != nil {
+			break
+		}
+	}
+	runResults <- err
+}
+
+// runExecutorOnce waits until the given start time and then runs the executor
+// with its scenario setup and teardown functions. It returns false if the run
+// context was cancelled before the executor could start.
+func (e *ExecutionScheduler) runExecutorOnce(
+	globalCtx, runCtx context.Context, engineOut chan<- stats.SampleContainer,
+	executor lib.Executor, startAt time.Time, executorLogger *logrus.Entry,
+) (bool, error) {
+	executorConfig := executor.GetConfig()
 	executorProgress := executor.GetProgress()
 
 	// Check if we have to wait before starting the actual executor execution
-	if executorStartTime > 0 {
-		startTime := time.Now()
+	if waitTime := time.Until(startAt); waitTime > 0 {
 		executorProgress.Modify(
 			pb.WithStatus(pb.Waiting),
 			pb.WithProgress(func() (float64, []string) {
-				remWait := (executorStartTime - time.Since(startTime))
-				return 0, []string{"waiting", pb.GetFixedLengthDuration(remWait, executorStartTime)}
+				return 0, []string{"waiting", pb.GetFixedLengthDuration(time.Until(startAt), waitTime)}
 			}),
 		)
 
 		executorLogger.Debugf("Waiting for executor start time...")
 		select {
 		case <-runCtx.Done():
-			runResults <- nil // no error since executor hasn't started yet
-			return
-		case <-time.After(executorStartTime):
+			return false, nil // no error since executor hasn't started yet
+		case <-time.After(waitTime):
 			// continue
 		}
 	}
+	var err error
+	if setupFn := executorConfig.GetSetup(); setupFn != "" && !e.options.NoSetup.Bool {
+		executorLogger.Debugf("Running %s()", setupFn)
+		executorProgress.Modify(pb.WithConstProgress(0, setupFn+"()"))
+		if err = e.runner.(lib.ScenarioSetupRunner).ScenarioSetup(
+			runCtx, engineOut, executorConfig.GetName(), setupFn,
+		); err != nil {
+			executorLogger.WithField("error", err).Debugf("%s() aborted by error", setupFn)
+		}
+	}
 
-	executorProgress.Modify(
-		pb.WithStatus(pb.Running),
-		pb.WithConstProgress(0, "started"),
-	)
-	executorLogger.Debugf("Starting executor")
-	err := executor.Run(runCtx, engineOut) // executor should handle context cancel itself
+	// Just like with setup(), the scenario teardown still runs if its setup
+	// function failed and the executor didn't
 	if err == nil {
-		executorLogger.Debugf("Executor finished successfully")
-	} else {
-		executorLogger.WithField("error", err).Errorf("Executor error")
+		executorProgress.Modify(
+			pb.WithStatus(pb.Running),
+			pb.WithConstProgress(0, "started"),
+		)
+		executorLogger.Debugf("Starting executor")
+		e.state.MarkScenarioStarted(executorConfig.GetName())
+		err = executor.Run(runCtx, engineOut) // executor should handle context cancel itself
+		if err == nil {
+			executorLogger.Debugf("Executor finished successfully")
+		} else {
+			executorLogger.WithField("error", err).Errorf("Executor error")
+		}
 	}
-	runResults <- err
+
+	if teardownFn := executorConfig.GetTeardown(); teardownFn != "" && !e.options.NoTeardown.Bool {
+		executorLogger.Debugf("Running %s()", teardownFn)
+		// Like teardown(), it isn't interrupted by aborts of the test run
+		if terr := e.runner.(lib.ScenarioSetupRunner).ScenarioTeardown(
+			globalCtx, engineOut, executorConfig.GetName(), teardownFn,
+		); terr != nil {
+			executorLogger.WithField("error", terr).Debugf("%s() aborted by error", teardownFn)
+			if err == nil {
+				err = lib.NewTeardownError(terr)
+			}
+		}
+	}
+	return true, err
 }
 
 // Run the ExecutionScheduler, funneling all generated metric samples through the supplied
@@ -365,36 +436,42 @@ func (e *ExecutionScheduler) Run(globalCtx, runCtx context.Context, engineOut ch
 	defer cancel() // just in case, and to shut up go vet...
 
 	// Run setup() before any executors, if it's not disabled
+	var firstErr error
 	if !e.options.NoSetup.Bool {
 		logger.Debug("Running setup()")
 		e.state.SetExecutionStatus(lib.ExecutionStatusSetup)
 		e.initProgress.Modify(pb.WithConstProgress(1, "setup()"))
 		if err := e.runner.Setup(runSubCtx, engineOut); err != nil {
 			logger.WithField("error", err).Debug("setup() aborted by error")
-			return err
+			firstErr = err
 		}
 	}
-	e.initProgress.Modify(pb.WithHijack(e.getRunStats))
 
-	// Start all executors at their particular startTime in a separate goroutine...
-	logger.Debug("Start all executors...")
-	e.state.SetExecutionStatus(lib.ExecutionStatusRunning)
-	for _, exec := range e.executors {
-		go e.runExecutor(runSubCtx, runResults, engineOut, exec)
-	}
+	// The executors don't run if setup() failed, but teardown() still does,
+	// since setup() could have created some external resources before that
+	if firstErr == nil {
+		e.initProgress.Modify(pb.WithHijack(e.getRunStats))
 
-	// Wait for all executors to finish
-	var firstErr error
-	for range e.executors {
-		err := <-runResults
-		if err != nil && firstErr == nil {
-			logger.WithError(err).Debug("Executor returned with an error, cancelling test run...")
-			firstErr = err
-			cancel()
+		// Start all executors at their particular startTime in a separate goroutine...
+		logger.Debug("Start all executors...")
+		e.state.SetExecutionStatus(lib.ExecutionStatusRunning)
+		for _, exec := range e.executors {
+			go e.runExecutor(globalCtx, runSubCtx, runResults, engineOut, exec)
+		}
+
+		// Wait for all executors to finish
+		for range e.executors {
+			err := <-runResults
+			if err != nil && firstErr == nil {
+				logger.WithError(err).Debug("Executor returned with an error, cancelling test run...")
+				firstErr = err
+				cancel()
+			}
 		}
 	}
 
-	// Run teardown() after all executors are done, if it's not disabled
+	// Run teardown() after all executors are done, if it's not disabled. It
+	// runs after user interrupts, threshold aborts and errors alike.
 	if !e.options.NoTeardown.Bool {
 		logger.Debug("Running teardown()")
 		e.state.SetExecutionStatus(lib.ExecutionStatusTeardown)
@@ -404,7 +481,13 @@ func (e *ExecutionScheduler) Run(globalCtx, runCtx context.Context, engineOut ch
 		// aborts caused by thresholds or even Ctrl+C (unless used twice).
 		if err := e.runner.Teardown(globalCtx, engineOut); err != nil {
 			logger.WithField("error", err).Debug("teardown() aborted by error")
-			return err
+			// The earlier error is why the test run failed, so it's the one
+			// that's returned and that decides the exit code
+			if firstErr != nil {
+				logger.WithError(err).Error("teardown() failed after the test run was aborted by an error")
+				return firstErr
+			}
+			return lib.NewTeardownError(err)
 		}
 	}
 
@@ -164,6 +164,148 @@ func TestExecutionSchedulerRunNonDefault(t *testing.T) {
 	}
 }
 
+func TestExecutionSchedulerScenarioSetupTeardown(t *testing.T) {
+	t.Parallel()
+	script := []byte(`
+	import { Counter } from "k6/metrics";
+
+	let calls = new Counter("calls");
+
+	export let options = {
+		scenarios: {
+			with_setup: {
+				executor: "per-vu-iterations",
+				vus: 1,
+				iterations: 2,
+				exec: "withSetup",
+				setup: "setupWithSetup",
+				teardown: "teardownWithSetup",
+			},
+			without_setup: {
+				executor: "per-vu-iterations",
+				vus: 1,
+				iterations: 1,
+				exec: "withoutSetup",
+			},
+		}
+	}
+
+	function call(fn, data, expected) {
+		if (data.from !== expected) {
+			throw new Error(fn + " got the data of " + data.from);
+		}
+		calls.add(1, { fn: fn });
+	}
+
+	export function setup() { return { from: "setup" }; }
+	export function setupWithSetup() { return { from: "setupWithSetup" }; }
+	export function teardownWithSetup(data) { call("teardownWithSetup", data, "setupWithSetup"); }
+	export function withSetup(data) { call("withSetup", data, "setupWithSetup"); }
+	export function withoutSetup(data) { call("withoutSetup", data, "setup"); }
+	`)
+
+	logger := logrus.New()
+	logger.SetOutput(testutils.NewTestOutput(t))
+	runner, err := js.New(logger, &loader.SourceData{URL: &url.URL{Path: "/script.js"}, Data: script},
+		nil, lib.RuntimeOptions{})
+	require.NoError(t, err)
+
+	require.NoError(t, runner.SetOptions(runner.GetOptions().Apply(lib.Options{
+		SetupTimeout:    types.NullDurationFrom(10 * time.Second),
+		TeardownTimeout: types.NullDurationFrom(10 * time.Second),
+	})))
+	execScheduler, err := NewExecutionScheduler(runner, logger)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	samples := make(chan stats.SampleContainer, 1000)
+	require.NoError(t, execScheduler.Init(ctx, samples))
+	require.NoError(t, execScheduler.Run(ctx, ctx, samples))
+	close(samples)
+
+	calls := map[string]float64{}
+	for sc := range samples {
+		for _, s := range sc.GetSamples() {
+			if s.Metric.Name == "calls" {
+				fn, _ := s.Tags.Get("fn")
+				calls[fn] += s.Value
+			}
+		}
+	}
+	assert.Equal(t, map[string]float64{"withSetup": 2, "withoutSetup": 1, "teardownWithSetup": 1}, calls)
+}
+
+func TestExecutionSchedulerTeardownAfterScenarioError(t *testing.T) {
+	t.Parallel()
+	script := []byte(`
+	import { sleep } from "k6";
+	import { Counter } from "k6/metrics";
+
+	let calls = new Counter("calls");
+
+	export let options = {
+		scenarios: {
+			failing: {
+				executor: "per-vu-iterations",
+				vus: 1,
+				iterations: 1,
+				exec: "iteration",
+				setup: "failingSetup",
+				teardown: "scenarioTeardown",
+			},
+			long: {
+				executor: "constant-vus",
+				vus: 1,
+				duration: "1h",
+				exec: "iteration",
+			},
+		}
+	}
+
+	export function failingSetup() { throw new Error("scenario setup error"); }
+	export function scenarioTeardown(data) { calls.add(1, { fn: "scenarioTeardown" }); }
+	export function iteration() { calls.add(1, { fn: "iteration" }); sleep(0.1); }
+	export function teardown(data) { calls.add(1, { fn: "teardown" }); }
+	`)
+
+	logger := logrus.New()
+	logger.SetOutput(testutils.NewTestOutput(t))
+	runner, err := js.New(logger, &loader.SourceData{URL: &url.URL{Path: "/script.js"}, Data: script},
+		nil, lib.RuntimeOptions{})
+	require.NoError(t, err)
+	require.NoError(t, runner.SetOptions(runner.GetOptions().Apply(lib.Options{
+		SetupTimeout:    types.NullDurationFrom(10 * time.Second),
+		TeardownTimeout: types.NullDurationFrom(10 * time.Second),
+	})))
+	execScheduler, err := NewExecutionScheduler(runner, logger)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	samples := make(chan stats.SampleContainer, 100000)
+	require.NoError(t, execScheduler.Init(ctx, samples))
+	// The error of a scenario aborts the whole test run, which still runs
+	// both of the teardown functions
+	err = execScheduler.Run(ctx, ctx, samples)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "scenario setup error")
+	require.NoError(t, ctx.Err())
+	close(samples)
+
+	calls := map[string]float64{}
+	for sc := range samples {
+		for _, s := range sc.GetSamples() {
+			if s.Metric.Name == "calls" {
+				fn, _ := s.Tags.Get("fn")
+				calls[fn]++
+			}
+		}
+	}
+	assert.Equal(t, 1.0, calls["teardown"])
+	assert.Equal(t, 1.0, calls["scenarioTeardown"])
+}
+
 func TestExecutionSchedulerRunEnv(t *testing.T) {
 	t.Parallel()
 
@@ -705,14 +847,45 @@ func TestExecutionSchedulerSetupTeardownRun(t *testing.T) {
 		assert.NoError(t, <-err)
 	})
 	t.Run("Setup Error", func(t *testing.T) {
+		var teardownCalled bool
 		runner := &minirunner.MiniRunner{
 			SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
 				return nil, errors.New("setup error")
 			},
+			Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				return errors.New("the iterations shouldn't run")
+			},
+			TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				teardownCalled = true
+				return nil
+			},
 		}
-		ctx, cancel, execScheduler, samples := newTestExecutionScheduler(t, runner, nil, lib.Options{})
+		ctx, cancel, execScheduler, samples := newTestExecutionScheduler(t, runner, nil, lib.Options{
+			VUs:        null.IntFrom(1),
+			Iterations: null.IntFrom(1),
+		})
 		defer cancel()
 		assert.EqualError(t, execScheduler.Run(ctx, ctx, samples), "setup error")
+		assert.True(t, teardownCalled)
+		assert.Equal(t, uint64(0), execScheduler.GetState().GetFullIterationCount())
+	})
+	t.Run("Teardown Error After Setup Error", func(t *testing.T) {
+		runner := &minirunner.MiniRunner{
+			SetupFn: func(ctx context.Context, out chan<- stats.SampleContainer) ([]byte, error) {
+				return nil, errors.New("setup error")
+			},
+			TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				return errors.New("teardown error")
+			},
+		}
+		ctx, cancel, execScheduler, samples := newTestExecutionScheduler(t, runner, nil, lib.Options{
+			VUs:        null.IntFrom(1),
+			Iterations: null.IntFrom(1),
+		})
+		defer cancel()
+		err := execScheduler.Run(ctx, ctx, samples)
+		assert.EqualError(t, err, "setup error")
+		assert.False(t, errors.As(err, &lib.TeardownError{}))
 	})
 	t.Run("Don't Run Setup", func(t *testing.T) {
 		runner := &minirunner.MiniRunner{
@@ -766,6 +939,27 @@ func TestExecutionSchedulerSetupTeardownRun(t *testing.T) {
 		defer cancel()
 		assert.NoError(t, execScheduler.Run(ctx, ctx, samples))
 	})
+	t.Run("Teardown After Interrupt", func(t *testing.T) {
+		runner := &minirunner.MiniRunner{
+			TeardownFn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return errors.New("teardown error")
+			},
+		}
+		ctx, cancel, execScheduler, samples := newTestExecutionScheduler(t, runner, nil, lib.Options{
+			VUs:      null.IntFrom(1),
+			Duration: types.NullDurationFrom(time.Hour),
+		})
+		defer cancel()
+		runCtx, runCancel := context.WithCancel(ctx)
+		runCancel()
+
+		err := execScheduler.Run(ctx, runCtx, samples)
+		assert.EqualError(t, err, "teardown error")
+		assert.IsType(t, lib.TeardownError{}, err)
+	})
 }
 
 func TestExecutionSchedulerStages(t *testing.T) {
@@ -1374,3 +1568,37 @@ func TestNewExecutionSchedulerHasWork(t *testing.T) {
 	assert.Len(t, execScheduler.executors, 2)
 	assert.Len(t, execScheduler.executorConfigs, 3)
 }
+
+func TestExecutionSchedulerStartAt(t *testing.T) {
+	t.Parallel()
+
+	exec := executor.NewPerVUIterationsConfig("scheduled")
+	exec.VUs = null.IntFrom(1)
+	exec.Iterations = null.IntFrom(1)
+	now := time.Now()
+	exec.StartAt = []time.Time{
+		now.Add(1500 * time.Millisecond),
+		now.Add(-time.Hour), // already in the past, so it's skipped
+		now.Add(500 * time.Millisecond),
+	}
+
+	var iterations int64
+	runner := &minirunner.MiniRunner{
+		Fn: func(ctx context.Context, out chan<- stats.SampleContainer) error {
+			atomic.AddInt64(&iterations, 1)
+			return nil
+		},
+		Options: lib.Options{
+			Scenarios: lib.ScenarioConfigs{exec.GetName(): exec},
+		},
+	}
+	ctx, cancel, execScheduler, samples := newTestExecutionScheduler(t, runner, nil, lib.Options{})
+	defer cancel()
+
+	startTime := time.Now()
+	assert.NoError(t, execScheduler.Run(ctx, ctx, samples))
+	runTime := time.Since(startTime)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&iterations))
+	assert.True(t, runTime > 1*time.Second, "the test didn't wait for the second occurrence")
+	assert.True(t, runTime < 10*time.Second, "took more than 10 seconds")
+}
@@ -0,0 +1,264 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"sync"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// metricsWorkers is a fixed pool of long-lived goroutines that add the samples
+// to the metric sinks when MetricsProcessingWorkers is more than 1. The
+// samples are sharded between the workers by their time series, i.e. by their
+// metric name and tags, so that even a single busy metric like
+// http_req_duration is spread between all of them.
+//
+// Every worker adds its samples to its own sinks, so the workers never wait
+// for each other while they process a batch, not even for the same metric.
+// Once they are done, they merge their sinks into the ones of the engine's
+// metrics, which the thresholds and the summary use. The merging is split
+// between the workers too, by metric, and it's much cheaper than adding the
+// samples, since it's done once per metric per batch.
+type metricsWorkers struct {
+	shards  []*metricsShard
+	wg      sync.WaitGroup
+	started bool
+}
+
+// metricsShard is the work and the state of a single worker.
+type metricsShard struct {
+	samples []stats.Sample
+	// The sinks of the worker, with the samples of the current batch, for
+	// every metric and submetric that it ever got samples for
+	sinks       map[*stats.Metric]*shardSink
+	sinksOrder  []*stats.Metric
+	windowed    []shardSample
+	index       uint32
+	shardsCount uint32
+	// Submetrics that got their first samples, found while merging, maybe
+	// more than once
+	newSubmetrics []*stats.Metric
+	jobs          chan func(*metricsShard)
+}
+
+// shardSink is the sink of a metric in a single worker.
+type shardSink struct {
+	sink    stats.Sink
+	samples int
+	// The worker that merges the sink into the sink of the metric
+	merger uint32
+}
+
+// shardSample is a sample for the windowed thresholds of a metric, which are
+// shared, so they are added to them when the sinks are merged.
+type shardSample struct {
+	metric *stats.Metric
+	sample stats.Sample
+	merger uint32
+}
+
+func newMetricsWorkers(count int) *metricsWorkers {
+	mw := &metricsWorkers{shards: make([]*metricsShard, count)}
+	for i := range mw.shards {
+		mw.shards[i] = &metricsShard{
+			sinks:       make(map[*stats.Metric]*shardSink),
+			index:       uint32(i),
+			shardsCount: uint32(count),
+		}
+	}
+	return mw
+}
+
+// start starts the workers if they aren't running already. Like the rest of
+// the methods, it should be called with the MetricsLock held.
+func (mw *metricsWorkers) start() {
+	if mw.started {
+		return
+	}
+	mw.started = true
+	for _, shard := range mw.shards {
+		shard.jobs = make(chan func(*metricsShard))
+		go func(shard *metricsShard) {
+			for job := range shard.jobs {
+				job(shard)
+				mw.wg.Done()
+			}
+		}(shard)
+	}
+}
+
+// stop stops the workers, once no more samples are going to be processed.
+func (mw *metricsWorkers) stop() {
+	if !mw.started {
+		return
+	}
+	mw.started = false
+	for _, shard := range mw.shards {
+		close(shard.jobs)
+	}
+}
+
+// run runs the job in all of the workers and waits for them to finish it.
+func (mw *metricsWorkers) run(job func(*metricsShard)) {
+	mw.wg.Add(len(mw.shards))
+	for _, shard := range mw.shards {
+		shard.jobs <- job
+	}
+	mw.wg.Wait()
+}
+
+// processSamplesForMetricsSharded distributes the samples between the metrics
+// workers, waits for them to add the samples to their own sinks and then to
+// merge them into the sinks of the metrics. The metrics and the submetrics are
+// created sequentially here, and the submetrics that got their first samples
+// are registered after the workers are done, so the workers never write to
+// the Metrics map.
+func (e *Engine) processSamplesForMetricsSharded(sampleContainers []stats.SampleContainer) {
+	mw := e.metricsWorkers
+	mw.start()
+	for _, shard := range mw.shards {
+		shard.samples = shard.samples[:0]
+	}
+
+	shardCount := uint32(len(mw.shards))
+	var lastTags *stats.SampleTags
+	var lastMetric *stats.Metric
+	var tagsHash uint32
+	for _, sampleContainer := range sampleContainers {
+		for _, sample := range sampleContainer.GetSamples() {
+			m := e.getOrCreateMetric(sample)
+			if m != lastMetric {
+				e.createSubmetrics(m, sample.Metric)
+				lastMetric = m
+			}
+			hash := fnv32a(m.Name)
+			// The sinks of gauges keep the last value, so all of their samples
+			// have to be added in order, by the same worker.
+			if m.Type != stats.Gauge {
+				// The samples of a container usually share their tags
+				if sample.Tags != lastTags {
+					lastTags, tagsHash = sample.Tags, sample.Tags.Hash()
+				}
+				hash ^= tagsHash
+			}
+			shard := mw.shards[hash%shardCount]
+			shard.samples = append(shard.samples, sample)
+		}
+	}
+
+	mw.run(e.processMetricsShard)
+	mw.run(e.mergeMetricsShard)
+
+	for _, shard := range mw.shards {
+		for _, sm := range shard.newSubmetrics {
+			e.Metrics[sm.Name] = sm
+		}
+		shard.newSubmetrics = shard.newSubmetrics[:0]
+		shard.windowed = shard.windowed[:0]
+	}
+}
+
+// createSubmetrics creates the metrics of all submetrics of the given metric
+// that don't have them yet, so the workers don't have to. They are only
+// registered in the Metrics map once they get their first samples.
+func (e *Engine) createSubmetrics(m *stats.Metric, sampleMetric *stats.Metric) {
+	for _, sm := range m.Submetrics {
+		if sm.Metric == nil {
+			e.newSubmetric(sm, sampleMetric)
+		}
+	}
+}
+
+// processMetricsShard adds the samples of the shard to the sinks of the
+// worker. Nothing is shared with the other workers, so no locks are needed.
+func (e *Engine) processMetricsShard(shard *metricsShard) {
+	for _, sample := range shard.samples {
+		// This is safe, since the Metrics map isn't modified until all of the
+		// workers are done.
+		m := e.Metrics[sample.Metric.Name]
+		shard.add(m, sample)
+		for _, sm := range m.Submetrics {
+			if sample.Tags.Contains(sm.Tags) {
+				shard.add(sm.Metric, sample)
+			}
+		}
+	}
+}
+
+func (shard *metricsShard) add(m *stats.Metric, sample stats.Sample) {
+	s, ok := shard.sinks[m]
+	if !ok {
+		s = &shardSink{sink: stats.NewSink(m.Type), merger: fnv32a(m.Name) % shard.shardsCount}
+		shard.sinks[m] = s
+		shard.sinksOrder = append(shard.sinksOrder, m)
+	}
+	s.sink.Add(sample)
+	s.samples++
+	if m.Thresholds.HasWindows() {
+		shard.windowed = append(shard.windowed, shardSample{metric: m, sample: sample, merger: s.merger})
+	}
+}
+
+// mergeMetricsShard merges the sinks of all workers for the metrics that this
+// worker is responsible for into the sinks of the metrics, and empties them
+// for the next batch.
+func (e *Engine) mergeMetricsShard(shard *metricsShard) {
+	for _, other := range e.metricsWorkers.shards {
+		for _, m := range other.sinksOrder {
+			s := other.sinks[m]
+			if s.merger != shard.index || s.samples == 0 {
+				continue
+			}
+			mergeSink(m.Sink, s.sink)
+			s.samples = 0
+			if trend, ok := s.sink.(*stats.TrendSink); ok {
+				*trend = stats.TrendSink{Values: trend.Values[:0]}
+			} else {
+				s.sink = stats.NewSink(m.Type)
+			}
+			if _, ok := e.Metrics[m.Name]; !ok {
+				shard.newSubmetrics = append(shard.newSubmetrics, m)
+			}
+		}
+		for _, ws := range other.windowed {
+			if ws.merger == shard.index {
+				ws.metric.Thresholds.AddSample(ws.sample)
+			}
+		}
+	}
+}
+
+// mergeSink adds the values of the src sink to the dst sink of the same type.
+func mergeSink(dst, src stats.Sink) {
+	switch src := src.(type) {
+	case *stats.CounterSink:
+		dst.(*stats.CounterSink).Merge(src)
+	case *stats.GaugeSink:
+		dst.(*stats.GaugeSink).Merge(src)
+	case *stats.TrendSink:
+		dst.(*stats.TrendSink).Merge(src)
+	case *stats.RateSink:
+		dst.(*stats.RateSink).Merge(src)
+	case *stats.HistogramSink:
+		dst.(*stats.HistogramSink).Merge(src)
+	}
+}
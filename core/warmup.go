@@ -0,0 +1,106 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package core
+
+import (
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+// warmupFilter discards the metric samples emitted during the warm-up windows
+// of the test run and of its scenarios, i.e. the discardMetricsFor options.
+// Samples of a scenario are discarded for the duration of its window after
+// the scenario started running, and samples without a scenario tag, like the
+// ones of setup() or the ones emitted while the scenario system tag is
+// disabled, during the global window after the start of the test run.
+type warmupFilter struct {
+	state     *lib.ExecutionState
+	global    time.Duration
+	scenarios map[string]time.Duration
+}
+
+// newWarmupFilter returns a filter for the configured warm-up windows, or nil
+// if neither the test run nor any of its scenarios has one.
+func newWarmupFilter(opts lib.Options, state *lib.ExecutionState) *warmupFilter {
+	global := time.Duration(opts.DiscardMetricsFor.Duration)
+	scenarios := make(map[string]time.Duration, len(opts.Scenarios))
+	hasWindow := global > 0
+	for name, conf := range opts.Scenarios {
+		window := global
+		if scenarioWindow := conf.GetDiscardMetricsFor(); scenarioWindow.Valid {
+			window = time.Duration(scenarioWindow.Duration)
+		}
+		scenarios[name] = window
+		hasWindow = hasWindow || window > 0
+	}
+	if !hasWindow {
+		return nil
+	}
+	return &warmupFilter{state: state, global: global, scenarios: scenarios}
+}
+
+// discards returns whether the given sample was emitted during a warm-up.
+func (wf *warmupFilter) discards(sample stats.Sample) bool {
+	window, startTime := wf.global, wf.state.GetStartTime()
+	if sample.Tags != nil {
+		if scenario, ok := sample.Tags.Get("scenario"); ok {
+			window, startTime = wf.scenarios[scenario], wf.state.GetScenarioStartTime(scenario)
+		}
+	}
+	if window <= 0 || startTime.IsZero() {
+		return false
+	}
+	return sample.Time.Before(startTime.Add(window))
+}
+
+// Samples returns the given sample containers without the warm-up samples.
+// Containers that are only partially discarded are replaced with plain
+// stats.Samples ones. The slice is filtered in place.
+func (wf *warmupFilter) Samples(sampleContainers []stats.SampleContainer) []stats.SampleContainer {
+	filtered := sampleContainers[:0]
+	for _, sc := range sampleContainers {
+		samples := sc.GetSamples()
+		discarded := 0
+		for _, sample := range samples {
+			if wf.discards(sample) {
+				discarded++
+			}
+		}
+
+		switch discarded {
+		case 0:
+			filtered = append(filtered, sc)
+		case len(samples):
+			continue
+		default:
+			kept := make(stats.Samples, 0, len(samples)-discarded)
+			for _, sample := range samples {
+				if !wf.discards(sample) {
+					kept = append(kept, sample)
+				}
+			}
+			filtered = append(filtered, kept)
+		}
+	}
+	return filtered
+}
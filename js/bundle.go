@@ -37,6 +37,7 @@ import (
 	"github.com/loadimpact/k6/js/compiler"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/consts"
+	"github.com/loadimpact/k6/lib/secrets"
 	"github.com/loadimpact/k6/loader"
 )
 
@@ -53,6 +54,7 @@ type Bundle struct {
 	RuntimeOptions    lib.RuntimeOptions
 	CompatibilityMode lib.CompatibilityMode // parsed value
 
+	secrets *secrets.Manager
 	exports map[string]goja.Callable
 }
 
@@ -76,6 +78,11 @@ func NewBundle(
 		return nil, err
 	}
 
+	secretsManager, err := secrets.NewManagerFromConfig(rtOpts.SecretSources)
+	if err != nil {
+		return nil, err
+	}
+
 	// Compile sources, both ES5 and ES6 are supported.
 	code := string(src.Data)
 	c := compiler.New(logger)
@@ -93,13 +100,14 @@ func NewBundle(
 			filesystems, loader.Dir(src.URL)),
 		RuntimeOptions:    rtOpts,
 		CompatibilityMode: compatMode,
+		secrets:           secretsManager,
 		exports:           make(map[string]goja.Callable),
 	}
 	if err = bundle.instantiate(logger, rt, bundle.BaseInitContext, 0); err != nil {
 		return nil, err
 	}
 
-	err = bundle.getExports(rt, true)
+	err = bundle.getExports(logger, rt, true)
 	if err != nil {
 		return nil, err
 	}
@@ -123,6 +131,11 @@ func NewBundleFromArchive(logger logrus.FieldLogger, arc *lib.Archive, rtOpts li
 		return nil, err
 	}
 
+	secretsManager, err := secrets.NewManagerFromConfig(rtOpts.SecretSources)
+	if err != nil {
+		return nil, err
+	}
+
 	c := compiler.New(logger)
 	pgm, _, err := c.Compile(string(arc.Data), arc.FilenameURL.String(), "", "", true, compatMode)
 	if err != nil {
@@ -150,6 +163,7 @@ func NewBundleFromArchive(logger logrus.FieldLogger, arc *lib.Archive, rtOpts li
 		BaseInitContext:   initctx,
 		RuntimeOptions:    rtOpts,
 		CompatibilityMode: compatMode,
+		secrets:           secretsManager,
 		exports:           make(map[string]goja.Callable),
 	}
 
@@ -159,7 +173,7 @@ func NewBundleFromArchive(logger logrus.FieldLogger, arc *lib.Archive, rtOpts li
 
 	// Grab exported objects, but avoid overwriting options, which would
 	// be initialized from the metadata.json at this point.
-	err = bundle.getExports(rt, false)
+	err = bundle.getExports(logger, rt, false)
 	if err != nil {
 		return nil, err
 	}
@@ -189,7 +203,7 @@ func (b *Bundle) makeArchive() *lib.Archive {
 }
 
 // getExports validates and extracts exported objects
-func (b *Bundle) getExports(rt *goja.Runtime, options bool) error {
+func (b *Bundle) getExports(logger logrus.FieldLogger, rt *goja.Runtime, options bool) error {
 	exportsV := rt.Get("exports")
 	if goja.IsNull(exportsV) || goja.IsUndefined(exportsV) {
 		return errors.New("exports must be an object")
@@ -211,6 +225,12 @@ func (b *Bundle) getExports(rt *goja.Runtime, options bool) error {
 			if err != nil {
 				return err
 			}
+			if err := lib.FindUnknownKeys(data, &b.Options); err != nil {
+				if !b.RuntimeOptions.NoStrictOptions.Bool {
+					return err
+				}
+				logger.WithError(err).Warn("Ignoring unknown options")
+			}
 			if err := json.Unmarshal(data, &b.Options); err != nil {
 				return err
 			}
@@ -246,7 +266,7 @@ func (b *Bundle) Instantiate(logger logrus.FieldLogger, vuID int64) (bi *BundleI
 		Runtime: rt,
 		Context: ctxPtr,
 		exports: make(map[string]goja.Callable),
-		env:     b.RuntimeOptions.Env,
+		env:     b.RuntimeOptions.VUEnv(),
 	}
 
 	// Grab any exported functions that could be executed. These were
@@ -274,12 +294,21 @@ func (b *Bundle) Instantiate(logger logrus.FieldLogger, vuID int64) (bi *BundleI
 	return bi, instErr
 }
 
+// newRandSource returns the source of Math.random for the given VU, seeded
+// deterministically if the seed option is set.
+func (b *Bundle) newRandSource(vuID int64) goja.RandSource {
+	if !b.Options.Seed.Valid {
+		return common.NewRandSource()
+	}
+	return common.NewSeededRandSource(lib.DeriveSeed(b.Options.Seed.Int64, vuID))
+}
+
 // Instantiates the bundle into an existing runtime. Not public because it also messes with a bunch
 // of other things, will potentially thrash data and makes a mess in it if the operation fails.
 func (b *Bundle) instantiate(logger logrus.FieldLogger, rt *goja.Runtime, init *InitContext, vuID int64) error {
 	rt.SetParserOptions(parser.WithDisableSourceMaps)
 	rt.SetFieldNameMapper(common.FieldNameMapper{})
-	rt.SetRandSource(common.NewRandSource())
+	rt.SetRandSource(b.newRandSource(vuID))
 
 	exports := rt.NewObject()
 	rt.Set("exports", exports)
@@ -287,13 +316,10 @@ func (b *Bundle) instantiate(logger logrus.FieldLogger, rt *goja.Runtime, init *
 	_ = module.Set("exports", exports)
 	rt.Set("module", module)
 
-	env := make(map[string]string, len(b.RuntimeOptions.Env))
-	for key, value := range b.RuntimeOptions.Env {
-		env[key] = value
-	}
-	rt.Set("__ENV", env)
+	rt.Set("__ENV", b.RuntimeOptions.VUEnv())
 	rt.Set("__VU", vuID)
 	rt.Set("console", common.Bind(rt, newConsole(logger), init.ctxPtr))
+	rt.Set("performance", common.Bind(rt, newPerformance(), init.ctxPtr))
 
 	if init.compatibilityMode == lib.CompatibilityModeExtended {
 		rt.Set("global", rt.GlobalObject())
@@ -306,6 +332,7 @@ func (b *Bundle) instantiate(logger logrus.FieldLogger, rt *goja.Runtime, init *
 		Logger:        logger,
 		FileSystems:   init.filesystems,
 		CWD:           init.pwd,
+		Secrets:       b.secrets,
 	}
 	ctx := common.WithInitEnv(context.Background(), initenv)
 	*init.ctxPtr = common.WithRuntime(ctx, rt)
@@ -316,7 +343,7 @@ func (b *Bundle) instantiate(logger logrus.FieldLogger, rt *goja.Runtime, init *
 	unbindInit()
 	*init.ctxPtr = nil
 
-	rt.SetRandSource(common.NewRandSource())
+	rt.SetRandSource(b.newRandSource(vuID))
 
 	return nil
 }
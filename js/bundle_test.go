@@ -200,6 +200,33 @@ func TestNewBundle(t *testing.T) {
 			}
 		})
 
+		t.Run("Unknown", func(t *testing.T) {
+			script := `
+				export let options = {
+					vus: 10,
+					iteration: 100,
+				};
+				export default function() {};
+			`
+			_, err := getSimpleBundle(t, "/script.js", script)
+			assert.EqualError(t, err, "unknown option 'iteration', did you mean 'iterations'?")
+
+			_, err = getSimpleBundle(t, "/script.js", `
+				export let options = {
+					thresholds: { checks: [{ threshold: "rate>0.9", abortOnFial: true }] },
+				};
+				export default function() {};
+			`)
+			assert.EqualError(t, err,
+				"unknown option 'thresholds.checks[0].abortOnFial', did you mean 'abortOnFail'?")
+
+			rtOpts := lib.RuntimeOptions{NoStrictOptions: null.BoolFrom(true)}
+			b, err := getSimpleBundle(t, "/script.js", script, rtOpts)
+			if assert.NoError(t, err) {
+				assert.Equal(t, null.IntFrom(10), b.Options.VUs)
+			}
+		})
+
 		t.Run("Paused", func(t *testing.T) {
 			b, err := getSimpleBundle(t, "/script.js", `
 				export let options = {
@@ -789,6 +816,39 @@ func TestBundleEnv(t *testing.T) {
 	}
 }
 
+func TestBundleFileEnvNotArchived(t *testing.T) {
+	t.Parallel()
+	rtOpts := lib.RuntimeOptions{
+		Env:     map[string]string{"HOST": "env"},
+		FileEnv: map[string]string{"HOST": "file", "TOKEN": "s3cr3t"},
+	}
+	data := `
+		export default function() {
+			if (__ENV.HOST !== "file") { throw new Error("Invalid HOST: " + __ENV.HOST); }
+			if (__ENV.TOKEN !== "s3cr3t") { throw new Error("Invalid TOKEN: " + __ENV.TOKEN); }
+		}
+	`
+	b, err := getSimpleBundle(t, "/script.js", data, rtOpts)
+	require.NoError(t, err)
+
+	arc := b.makeArchive()
+	assert.Equal(t, map[string]string{"HOST": "env"}, arc.Env)
+
+	logger := testutils.NewLogger(t)
+	bi, err := b.Instantiate(logger, 0)
+	require.NoError(t, err)
+	_, err = bi.exports[consts.DefaultFn](goja.Undefined())
+	assert.NoError(t, err)
+
+	// the env files have to be given again when running the archive
+	b, err = NewBundleFromArchive(logger, arc, lib.RuntimeOptions{FileEnv: rtOpts.FileEnv})
+	require.NoError(t, err)
+	bi, err = b.Instantiate(logger, 0)
+	require.NoError(t, err)
+	_, err = bi.exports[consts.DefaultFn](goja.Undefined())
+	assert.NoError(t, err)
+}
+
 func TestBundleNotSharable(t *testing.T) {
 	data := `
 		export default function() {
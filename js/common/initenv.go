@@ -27,6 +27,8 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/afero"
+
+	"github.com/loadimpact/k6/lib/secrets"
 )
 
 // InitEnvironment contains properties that can be accessed by Go code executed
@@ -35,6 +37,7 @@ type InitEnvironment struct {
 	Logger      logrus.FieldLogger
 	FileSystems map[string]afero.Fs
 	CWD         *url.URL
+	Secrets     *secrets.Manager
 	// TODO: add RuntimeOptions and other properties, goja sources, etc.
 	// ideally, we should leave this as the only data structure necessary for
 	// executing the init context for all JS modules
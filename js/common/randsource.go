@@ -40,3 +40,9 @@ func NewRandSource() goja.RandSource {
 	}
 	return rand.New(rand.NewSource(seed)).Float64
 }
+
+// NewSeededRandSource returns a RandSource producing the same sequence of
+// numbers for the same seed. It is NOT safe for concurrent use either.
+func NewSeededRandSource(seed int64) goja.RandSource {
+	return rand.New(rand.NewSource(seed)).Float64 //nolint:gosec
+}
@@ -26,6 +26,7 @@ import (
 	"net/url"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/dop251/goja"
 	"github.com/pkg/errors"
@@ -45,6 +46,54 @@ type programWithSource struct {
 	module *goja.Object
 }
 
+// initCache holds the contents of the files opened with open() and the
+// programs compiled by require() that weren't already in the programs of the
+// base init context, e.g. because they are only required conditionally. This
+// saves reading the same files and compiling the same modules again for every
+// VU, and lets the VUs share the same strings in memory.
+//
+// It isn't a snapshot of the init context: every VU still runs the init code
+// in its own runtime, since goja runtimes can't be cloned, so the time it
+// takes to initialize the VUs still grows with the cost of the init code.
+type initCache struct {
+	mu       sync.RWMutex
+	files    map[string]string
+	programs map[string]programWithSource
+}
+
+func newInitCache() *initCache {
+	return &initCache{
+		files:    make(map[string]string),
+		programs: make(map[string]programWithSource),
+	}
+}
+
+func (c *initCache) getFile(filename string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	data, ok := c.files[filename]
+	return data, ok
+}
+
+func (c *initCache) setFile(filename, data string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.files[filename] = data
+}
+
+func (c *initCache) getProgram(key string) (programWithSource, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	pgm, ok := c.programs[key]
+	return pgm, ok
+}
+
+func (c *initCache) setProgram(key string, pgm programWithSource) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.programs[key] = programWithSource{pgm: pgm.pgm, src: pgm.src}
+}
+
 const openCantBeUsedOutsideInitContextMsg = `The "open()" function is only available in the init stage ` +
 	`(i.e. the global scope), see https://k6.io/docs/using-k6/test-life-cycle for more information`
 
@@ -71,6 +120,7 @@ type InitContext struct {
 	logger logrus.FieldLogger
 
 	sharedObjects *common.SharedObjects
+	cache         *initCache
 }
 
 // NewInitContext creates a new initcontext with the provided arguments
@@ -88,6 +138,7 @@ func NewInitContext(
 		compatibilityMode: compatMode,
 		logger:            logger,
 		sharedObjects:     common.NewSharedObjects(),
+		cache:             newInitCache(),
 	}
 }
 
@@ -114,6 +165,7 @@ func newBoundInitContext(base *InitContext, ctxPtr *context.Context, rt *goja.Ru
 		compatibilityMode: base.compatibilityMode,
 		logger:            base.logger,
 		sharedObjects:     base.sharedObjects,
+		cache:             base.cache,
 	}
 }
 
@@ -164,6 +216,13 @@ func (i *InitContext) requireFile(name string) (goja.Value, error) {
 		pgm.module = i.runtime.NewObject()
 		_ = pgm.module.Set("exports", exports)
 
+		if pgm.pgm == nil {
+			// Some other VU may have already compiled the same file.
+			if cached, ok := i.cache.getProgram(fileURL.String()); ok {
+				pgm.pgm, pgm.src = cached.pgm, cached.src
+			}
+		}
+
 		if pgm.pgm == nil {
 			// Load the sources; the loader takes care of remote loading, etc.
 			data, err := loader.Load(i.logger, i.filesystems, fileURL, name)
@@ -178,6 +237,7 @@ func (i *InitContext) requireFile(name string) (goja.Value, error) {
 			if err != nil {
 				return goja.Undefined(), err
 			}
+			i.cache.setProgram(fileURL.String(), pgm)
 		}
 
 		i.programs[fileURL.String()] = pgm
@@ -223,23 +283,31 @@ func (i *InitContext) Open(ctx context.Context, filename string, args ...string)
 		filename = filepath.Join(i.pwd.Path, filename)
 	}
 	filename = filepath.Clean(filename)
-	fs := i.filesystems["file"]
 	if filename[0:1] != afero.FilePathSeparator {
 		filename = afero.FilePathSeparator + filename
 	}
-	// Workaround for https://github.com/spf13/afero/issues/201
-	if isDir, err := afero.IsDir(fs, filename); err != nil {
-		return nil, err
-	} else if isDir {
-		return nil, fmt.Errorf("open() can't be used with directories, path: %q", filename)
-	}
-	data, err := afero.ReadFile(fs, filename)
-	if err != nil {
-		return nil, err
+
+	data, ok := i.cache.getFile(filename)
+	if !ok {
+		fs := i.filesystems["file"]
+		// Workaround for https://github.com/spf13/afero/issues/201
+		if isDir, err := afero.IsDir(fs, filename); err != nil {
+			return nil, err
+		} else if isDir {
+			return nil, fmt.Errorf("open() can't be used with directories, path: %q", filename)
+		}
+		rawData, err := afero.ReadFile(fs, filename)
+		if err != nil {
+			return nil, err
+		}
+		data = string(rawData)
+		i.cache.setFile(filename, data)
 	}
 
 	if len(args) > 0 && args[0] == "b" {
-		return i.runtime.ToValue(data), nil
+		// Binary data is mutable in JS, so every VU needs its own copy
+		return i.runtime.ToValue([]byte(data)), nil
 	}
-	return i.runtime.ToValue(string(data)), nil
+	// Strings are immutable, so all VUs can share the same underlying memory
+	return i.runtime.ToValue(data), nil
 }
@@ -329,6 +329,34 @@ func TestInitContextOpen(t *testing.T) {
 	})
 }
 
+func TestInitContextOpenIsShared(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	require.NoError(t, afero.WriteFile(fs, "/data.txt", []byte("original"), 0o644))
+	require.NoError(t, afero.WriteFile(fs, "/lib.js", []byte(`exports.value = "lib";`), 0o644))
+
+	b, err := getSimpleBundle(t, "/script.js", `
+		var data = open("/data.txt");
+		var bin = open("/data.txt", "b");
+		var lib = require("/lib.js");
+		exports.default = function() {}
+	`, fs)
+	require.NoError(t, err)
+
+	// The VUs should get the cached file contents and compiled programs, even
+	// if the files somehow changed after the bundle was created
+	require.NoError(t, afero.WriteFile(fs, "/data.txt", []byte("changed"), 0o644))
+	require.NoError(t, fs.Remove("/lib.js"))
+
+	for i := int64(1); i <= 2; i++ {
+		bi, err := b.Instantiate(testutils.NewLogger(t), i)
+		require.NoError(t, err)
+		assert.Equal(t, "original", bi.Runtime.Get("data").Export())
+		assert.Equal(t, []byte("original"), bi.Runtime.Get("bin").Export())
+		assert.Equal(t, "lib", bi.Runtime.Get("lib").ToObject(bi.Runtime).Get("value").Export())
+	}
+}
+
 func TestRequestWithBinaryFile(t *testing.T) {
 	t.Parallel()
 
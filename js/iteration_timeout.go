@@ -0,0 +1,61 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// iterationTimeoutError is used to interrupt the iterations that run longer
+// than the iterationTimeout of their scenario.
+type iterationTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e iterationTimeoutError) Error() string {
+	return fmt.Sprintf("the iteration was interrupted because it exceeded the iterationTimeout of %s", e.timeout)
+}
+
+// watchIterationTimeout returns the context for an iteration of the VU, which
+// is cancelled together with the interruption of its JS runtime when the
+// iteration runs longer than the timeout, so any pending requests are aborted
+// as well. The returned function stops the watching and returns the error the
+// runtime was interrupted with, if it timed out.
+func (u *ActiveVU) watchIterationTimeout(timeout time.Duration) (context.Context, func() *iterationTimeoutError) {
+	ctx, cancel := context.WithCancel(u.RunContext)
+	result := make(chan *iterationTimeoutError, 1)
+	timer := time.AfterFunc(timeout, func() {
+		timeoutErr := &iterationTimeoutError{timeout: timeout}
+		result <- timeoutErr
+		u.Runtime.Interrupt(timeoutErr)
+		cancel()
+	})
+
+	return ctx, func() *iterationTimeoutError {
+		defer cancel()
+		if timer.Stop() {
+			return nil
+		}
+		return <-result
+	}
+}
@@ -0,0 +1,134 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dustin/go-humanize"
+)
+
+// How often the Go heap is checked while iterations are running, since reading
+// its statistics briefly stops the world.
+const heapCheckPeriod = 500 * time.Millisecond
+
+// heapMonitor enforces the maxHeapMemory limit. goja doesn't support
+// per-runtime memory accounting, since all JS values of all VUs live on the
+// shared Go heap, so the limit is for the whole heap of the k6 process. A
+// single monitor goroutine per runner checks it while any iterations are
+// running and, if the heap is still over the limit after a garbage collection,
+// interrupts all of them, since it can't tell which one is responsible. That's
+// coarse, but it's enough to catch the common case of a script that
+// accumulates data in every iteration before it takes down the whole load
+// generator. There is no memory usage metric for the same reason, a per-VU one
+// would be made up and the heap size of the process is better watched from
+// the outside.
+type heapMonitor struct {
+	mu        sync.Mutex
+	running   map[*goja.Runtime]*heapLimitError
+	monitored bool
+}
+
+func newHeapMonitor() *heapMonitor {
+	return &heapMonitor{running: make(map[*goja.Runtime]*heapLimitError)}
+}
+
+// watch starts watching the heap while the given runtime runs an iteration.
+// The returned function stops the watching and returns the error the runtime
+// was interrupted with, if any.
+func (m *heapMonitor) watch(rt *goja.Runtime, limit uint64) (stop func() *heapLimitError) {
+	m.mu.Lock()
+	m.running[rt] = nil
+	if !m.monitored {
+		m.monitored = true
+		go m.monitor(limit)
+	}
+	m.mu.Unlock()
+
+	return func() *heapLimitError {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		limitErr := m.running[rt]
+		delete(m.running, rt)
+		return limitErr
+	}
+}
+
+// monitor periodically checks the heap, until no iterations were running for
+// a whole period.
+func (m *heapMonitor) monitor(limit uint64) {
+	ticker := time.NewTicker(heapCheckPeriod)
+	defer ticker.Stop()
+	idle := false
+	for range ticker.C {
+		heapAlloc := readHeapAlloc()
+		if heapAlloc > limit {
+			// Only live objects count against the limit
+			runtime.GC()
+			heapAlloc = readHeapAlloc()
+		}
+
+		m.mu.Lock()
+		if len(m.running) == 0 {
+			if idle {
+				m.monitored = false
+				m.mu.Unlock()
+				return
+			}
+			idle = true
+		} else {
+			idle = false
+		}
+		if heapAlloc > limit {
+			for rt, limitErr := range m.running {
+				if limitErr == nil {
+					limitErr = &heapLimitError{usage: heapAlloc, limit: limit}
+					rt.Interrupt(limitErr)
+					m.running[rt] = limitErr
+				}
+			}
+		}
+		m.mu.Unlock()
+	}
+}
+
+func readHeapAlloc() uint64 {
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	return memStats.HeapAlloc
+}
+
+// heapLimitError is used to interrupt the JS runtimes of the VUs that were
+// running iterations when the heap went over the configured limit.
+type heapLimitError struct {
+	usage, limit uint64
+}
+
+func (e heapLimitError) Error() string {
+	return fmt.Sprintf(
+		"the iteration was interrupted because the Go heap size of %s exceeded the maxHeapMemory limit of %s",
+		humanize.IBytes(e.usage), humanize.IBytes(e.limit),
+	)
+}
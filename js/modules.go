@@ -27,8 +27,15 @@ import (
 	_ "github.com/loadimpact/k6/js/modules/k6/crypto/x509"
 	_ "github.com/loadimpact/k6/js/modules/k6/data"
 	_ "github.com/loadimpact/k6/js/modules/k6/encoding"
+	_ "github.com/loadimpact/k6/js/modules/k6/experimental/concurrency"
+	_ "github.com/loadimpact/k6/js/modules/k6/experimental/events"
+	_ "github.com/loadimpact/k6/js/modules/k6/experimental/oauth"
+	_ "github.com/loadimpact/k6/js/modules/k6/experimental/signalr"
+	_ "github.com/loadimpact/k6/js/modules/k6/experimental/socketio"
+	_ "github.com/loadimpact/k6/js/modules/k6/experimental/vu"
 	_ "github.com/loadimpact/k6/js/modules/k6/grpc"
 	_ "github.com/loadimpact/k6/js/modules/k6/http"
 	_ "github.com/loadimpact/k6/js/modules/k6/metrics"
+	_ "github.com/loadimpact/k6/js/modules/k6/secrets"
 	_ "github.com/loadimpact/k6/js/modules/k6/ws"
 )
@@ -38,6 +38,7 @@ import (
 
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/js/internal/modules"
+	"github.com/loadimpact/k6/lib/fips"
 )
 
 func init() {
@@ -136,6 +137,9 @@ func (c *Crypto) Ripemd160(ctx context.Context, input interface{}, outputEncodin
 func (*Crypto) CreateHash(ctx context.Context, algorithm string) *Hasher {
 	hasher := Hasher{}
 	hasher.ctx = ctx
+	if err := fips.CheckHash(algorithm); err != nil {
+		common.Throw(common.GetRuntime(ctx), err)
+	}
 
 	switch algorithm {
 	case "md4":
@@ -219,6 +223,9 @@ func (c Crypto) CreateHMAC(ctx context.Context, algorithm string, key interface{
 	if err != nil {
 		common.Throw(common.GetRuntime(hasher.ctx), err)
 	}
+	if err = fips.CheckHash(algorithm); err != nil {
+		common.Throw(common.GetRuntime(hasher.ctx), err)
+	}
 
 	switch algorithm {
 	case "md4":
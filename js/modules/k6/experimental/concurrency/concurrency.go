@@ -0,0 +1,236 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package concurrency implements the k6/experimental/concurrency module, with
+// counters, semaphores and once gates that are shared by all VUs of a k6
+// instance by name.
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/internal/modules"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+)
+
+func init() {
+	modules.Register("k6/experimental/concurrency", New())
+}
+
+var errWaitInInitContext = common.NewInitContextError("waiting in the init context is not supported")
+
+// Concurrency is the k6/experimental/concurrency module.
+type Concurrency struct {
+	mu         sync.Mutex
+	counters   map[string]*int64
+	semaphores map[string]chan struct{}
+	onces      map[string]*once
+
+	rateLimiters map[string]*rateLimiter
+}
+
+// New returns a new k6/experimental/concurrency module.
+func New() *Concurrency {
+	return &Concurrency{
+		counters:   make(map[string]*int64),
+		semaphores: make(map[string]chan struct{}),
+		onces:      make(map[string]*once),
+
+		rateLimiters: make(map[string]*rateLimiter),
+	}
+}
+
+// XCounter is the Counter constructor (e.g. `new concurrency.Counter("name")`),
+// every counter with the same name is the same one.
+func (c *Concurrency) XCounter(ctxPtr *context.Context, name string) interface{} {
+	c.mu.Lock()
+	value, ok := c.counters[name]
+	if !ok {
+		value = new(int64)
+		c.counters[name] = value
+	}
+	c.mu.Unlock()
+
+	return common.Bind(common.GetRuntime(*ctxPtr), &Counter{value: value}, ctxPtr)
+}
+
+// XSemaphore is the Semaphore constructor (e.g. `new concurrency.Semaphore("name", 10)`),
+// the permits are shared by every semaphore with the same name.
+func (c *Concurrency) XSemaphore(ctxPtr *context.Context, name string, permits int64) (interface{}, error) {
+	if permits < 1 {
+		return nil, errors.New("a semaphore needs at least one permit")
+	}
+
+	c.mu.Lock()
+	sem, ok := c.semaphores[name]
+	if !ok {
+		sem = make(chan struct{}, permits)
+		c.semaphores[name] = sem
+	}
+	c.mu.Unlock()
+	if int64(cap(sem)) != permits {
+		return nil, fmt.Errorf("semaphore %q already exists with %d permits", name, cap(sem))
+	}
+
+	return common.Bind(common.GetRuntime(*ctxPtr), &Semaphore{sem: sem}, ctxPtr), nil
+}
+
+// XOnce is the Once constructor (e.g. `new concurrency.Once("name")`), a
+// function passed to any Once with the same name runs only once per test.
+func (c *Concurrency) XOnce(ctxPtr *context.Context, name string) interface{} {
+	c.mu.Lock()
+	o, ok := c.onces[name]
+	if !ok {
+		o = &once{done: make(chan struct{})}
+		c.onces[name] = o
+	}
+	c.mu.Unlock()
+
+	return common.Bind(common.GetRuntime(*ctxPtr), &Once{once: o}, ctxPtr)
+}
+
+// Counter is an integer counter that can be changed atomically.
+type Counter struct {
+	value *int64
+}
+
+// Add adds the delta, which defaults to 1, and returns the new value.
+func (c *Counter) Add(delta goja.Value) int64 {
+	d := int64(1)
+	if delta != nil && !goja.IsUndefined(delta) {
+		d = delta.ToInteger()
+	}
+	return atomic.AddInt64(c.value, d)
+}
+
+// Get returns the current value.
+func (c *Counter) Get() int64 {
+	return atomic.LoadInt64(c.value)
+}
+
+// CompareAndSet sets the value to next if it's currently old, and reports
+// whether it did.
+func (c *Counter) CompareAndSet(old, next int64) bool {
+	return atomic.CompareAndSwapInt64(c.value, old, next)
+}
+
+// Semaphore limits how many VUs can hold one of its permits at the same time.
+type Semaphore struct {
+	sem  chan struct{}
+	held int // by this VU, released when the VU calls release()
+}
+
+// Acquire waits for a permit and reports whether it got one before the timeout,
+// if one is given, or the VU is stopped.
+func (s *Semaphore) Acquire(ctx context.Context, timeout goja.Value) (bool, error) {
+	if lib.GetState(ctx) == nil {
+		return false, errWaitInInitContext
+	}
+
+	var timeoutCh <-chan time.Time
+	if timeout != nil && !goja.IsUndefined(timeout) && !goja.IsNull(timeout) {
+		d, err := types.GetDurationValue(timeout.Export())
+		if err != nil {
+			return false, fmt.Errorf("invalid timeout: %w", err)
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case s.sem <- struct{}{}:
+		s.held++
+		return true, nil
+	case <-timeoutCh:
+		return false, nil
+	case <-ctx.Done():
+		return false, nil
+	}
+}
+
+// TryAcquire takes a permit if one is available, without waiting.
+func (s *Semaphore) TryAcquire() bool {
+	select {
+	case s.sem <- struct{}{}:
+		s.held++
+		return true
+	default:
+		return false
+	}
+}
+
+// Release returns a permit taken by the VU.
+func (s *Semaphore) Release() error {
+	if s.held == 0 {
+		return errors.New("the semaphore wasn't acquired")
+	}
+	s.held--
+	<-s.sem
+	return nil
+}
+
+// With calls the function while holding a permit, which is released even if
+// the function throws, and returns its result.
+func (s *Semaphore) With(ctx context.Context, fn goja.Callable) (goja.Value, error) {
+	acquired, err := s.Acquire(ctx, nil)
+	if err != nil || !acquired {
+		return goja.Undefined(), err
+	}
+	defer func() { _ = s.Release() }()
+
+	return fn(goja.Undefined())
+}
+
+type once struct {
+	started int32
+	done    chan struct{}
+}
+
+// Once runs a function only once per test, no matter how many VUs call it.
+type Once struct {
+	once *once
+}
+
+// Do calls the function if no VU has called it yet and reports whether it did.
+// The VUs that call it in the meantime wait until the function returns, so
+// they can rely on its side effects.
+func (o *Once) Do(ctx context.Context, fn goja.Callable) (bool, error) {
+	if atomic.CompareAndSwapInt32(&o.once.started, 0, 1) {
+		defer close(o.once.done)
+		_, err := fn(goja.Undefined())
+		return true, err
+	}
+
+	select {
+	case <-o.once.done:
+	case <-ctx.Done():
+	}
+	return false, nil
+}
@@ -0,0 +1,193 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package concurrency
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+)
+
+func newVU(t *testing.T, c *Concurrency, script string) *goja.Runtime {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctxPtr := new(context.Context)
+	*ctxPtr = common.WithRuntime(context.Background(), rt)
+	rt.Set("concurrency", common.Bind(rt, c, ctxPtr))
+
+	_, err := rt.RunString(script)
+	require.NoError(t, err)
+	*ctxPtr = lib.WithState(*ctxPtr, &lib.State{})
+
+	return rt
+}
+
+func TestCounter(t *testing.T) {
+	t.Parallel()
+	c := New()
+
+	const vus, iterations = 10, 100
+	var wg sync.WaitGroup
+	for i := 0; i < vus; i++ {
+		rt := newVU(t, c, `var counter = new concurrency.Counter("requests");`)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := rt.RunString(`for (var i = 0; i < 100; i++) { counter.add(); }`)
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	rt := newVU(t, c, `var counter = new concurrency.Counter("requests");`)
+	v, err := rt.RunString(`counter.get()`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(vus*iterations), v.ToInteger())
+
+	v, err = rt.RunString(`counter.add(-1000) + ":" + counter.compareAndSet(0, 5) + ":" + counter.compareAndSet(0, 6)`)
+	require.NoError(t, err)
+	assert.Equal(t, "0:true:false", v.String())
+}
+
+func TestSemaphore(t *testing.T) {
+	t.Parallel()
+	c := New()
+
+	rt1 := newVU(t, c, `var sem = new concurrency.Semaphore("admin", 2);`)
+	rt2 := newVU(t, c, `var sem = new concurrency.Semaphore("admin", 2);`)
+
+	v, err := rt1.RunString(`sem.acquire() && sem.tryAcquire()`)
+	require.NoError(t, err)
+	assert.True(t, v.ToBoolean())
+
+	v, err = rt2.RunString(`sem.tryAcquire() || sem.acquire("10ms")`)
+	require.NoError(t, err)
+	assert.False(t, v.ToBoolean())
+
+	_, err = rt2.RunString(`sem.release()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the semaphore wasn't acquired")
+
+	_, err = rt1.RunString(`sem.release()`)
+	require.NoError(t, err)
+	v, err = rt2.RunString(`
+	var result;
+	try {
+		sem.with(function() { throw new Error("oops"); });
+	} catch (e) {
+		result = sem.with(function() { return "done"; });
+	}
+	result;
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "done", v.String())
+	assert.Len(t, c.semaphores["admin"], 1)
+
+	rt := goja.New()
+	ctx := common.WithRuntime(context.Background(), rt)
+	_, err = c.XSemaphore(&ctx, "admin", 3)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `semaphore "admin" already exists with 2 permits`)
+	_, err = c.XSemaphore(&ctx, "other", 0)
+	require.Error(t, err)
+}
+
+func TestOnce(t *testing.T) {
+	t.Parallel()
+	c := New()
+
+	const vus = 10
+	var wg sync.WaitGroup
+	results := make([]bool, vus)
+	var calls int64
+	for i := 0; i < vus; i++ {
+		rt := newVU(t, c, `var once = new concurrency.Once("provision");`)
+		rt.Set("provision", func() { calls++ })
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			v, err := rt.RunString(`once.do(provision)`)
+			assert.NoError(t, err)
+			results[i] = v.ToBoolean()
+		}(i)
+	}
+	wg.Wait()
+
+	ran := 0
+	for _, r := range results {
+		if r {
+			ran++
+		}
+	}
+	assert.Equal(t, 1, ran)
+	assert.Equal(t, int64(1), calls)
+}
+
+func TestRateLimiter(t *testing.T) {
+	t.Parallel()
+	c := New()
+
+	rt1 := newVU(t, c, `var limiter = new concurrency.RateLimiter(1, { name: "api", burst: 2 });`)
+	rt2 := newVU(t, c, `var limiter = new concurrency.RateLimiter(1, { name: "api", burst: 2 });`)
+
+	v, err := rt1.RunString(`limiter.take() && limiter.tryTake()`)
+	require.NoError(t, err)
+	assert.True(t, v.ToBoolean())
+
+	v, err = rt2.RunString(`limiter.tryTake()`)
+	require.NoError(t, err)
+	assert.False(t, v.ToBoolean())
+
+	_, err = rt2.RunString(`limiter.take(3)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't take 3 tokens at once with a burst of 2")
+
+	rt := goja.New()
+	ctx := common.WithRuntime(context.Background(), rt)
+	_, err = c.XRateLimiter(&ctx, 2, map[string]interface{}{"name": "api"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `rate limiter "api" already exists with a rate of 1 and a burst of 2`)
+	_, err = c.XRateLimiter(&ctx, 0, nil)
+	require.Error(t, err)
+
+	rl, err := c.XRateLimiter(&ctx, 10, nil)
+	require.NoError(t, err)
+	rt.Set("limiter", rl)
+	_, err = rt.RunString(`limiter.take()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), errWaitInInitContext.Error())
+
+	t.Run("Segment", func(t *testing.T) {
+		t.Parallel()
+		segment, err := lib.NewExecutionSegmentFromString("0:1/4")
+		require.NoError(t, err)
+		state := &lib.State{Options: lib.Options{ExecutionSegment: segment}}
+		rl := &rateLimiter{perSecond: 100, burst: 1}
+		assert.Equal(t, 25.0, float64(rl.get(state).Limit()))
+	})
+}
@@ -0,0 +1,151 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package concurrency
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+	"golang.org/x/time/rate"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+)
+
+// rateLimiter is a token bucket shared by all VUs of the instance. The bucket
+// is only created on the first take, when the execution segment is known, so
+// that the instances of a distributed test share the rate between them.
+type rateLimiter struct {
+	perSecond float64
+	burst     int
+
+	once    sync.Once
+	limiter *rate.Limiter
+}
+
+func (r *rateLimiter) get(state *lib.State) *rate.Limiter {
+	r.once.Do(func() {
+		perSecond := r.perSecond * state.Options.ExecutionSegment.FloatLength()
+		r.limiter = rate.NewLimiter(rate.Limit(perSecond), r.burst)
+	})
+	return r.limiter
+}
+
+// XRateLimiter is the RateLimiter constructor (e.g. `new concurrency.RateLimiter(100)`),
+// which allows the given number of takes per second with the burst option,
+// 1 by default, as the bucket size. Limiters with the same name share their
+// tokens; without a name, the ones with the same rate and burst do.
+func (c *Concurrency) XRateLimiter(
+	ctxPtr *context.Context, perSecond float64, options map[string]interface{},
+) (interface{}, error) {
+	if perSecond <= 0 {
+		return nil, errors.New("the rate of a rate limiter must be positive")
+	}
+
+	name, burst := "", int64(1)
+	for k, v := range options {
+		switch k {
+		case "name":
+			var ok bool
+			if name, ok = v.(string); !ok {
+				return nil, errors.New("the name option must be a string")
+			}
+		case "burst":
+			var ok bool
+			if burst, ok = v.(int64); !ok || burst < 1 {
+				return nil, errors.New("the burst option must be a positive integer")
+			}
+		default:
+			return nil, fmt.Errorf("unknown rate limiter option: %q", k)
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("%g/%d", perSecond, burst)
+	}
+
+	c.mu.Lock()
+	rl, ok := c.rateLimiters[name]
+	if !ok {
+		rl = &rateLimiter{perSecond: perSecond, burst: int(burst)}
+		c.rateLimiters[name] = rl
+	}
+	c.mu.Unlock()
+	if rl.perSecond != perSecond || int64(rl.burst) != burst {
+		return nil, fmt.Errorf("rate limiter %q already exists with a rate of %g and a burst of %d",
+			name, rl.perSecond, rl.burst)
+	}
+
+	return common.Bind(common.GetRuntime(*ctxPtr), &RateLimiter{rl: rl}, ctxPtr), nil
+}
+
+// RateLimiter throttles the VUs that take from it to its rate.
+type RateLimiter struct {
+	rl *rateLimiter
+}
+
+func tokens(n goja.Value) (int, error) {
+	if n == nil || goja.IsUndefined(n) {
+		return 1, nil
+	}
+	if n.ToInteger() < 1 {
+		return 0, errors.New("the number of tokens must be positive")
+	}
+	return int(n.ToInteger()), nil
+}
+
+// Take waits until the given number of tokens, 1 by default, is available and
+// reports whether it got them before the VU was stopped.
+func (r *RateLimiter) Take(ctx context.Context, n goja.Value) (bool, error) {
+	state := lib.GetState(ctx)
+	if state == nil {
+		return false, errWaitInInitContext
+	}
+	count, err := tokens(n)
+	if err != nil {
+		return false, err
+	}
+	limiter := r.rl.get(state)
+	if count > limiter.Burst() {
+		return false, fmt.Errorf("can't take %d tokens at once with a burst of %d", count, limiter.Burst())
+	}
+	if err := limiter.WaitN(ctx, count); err != nil {
+		return false, nil // the VU was stopped
+	}
+	return true, nil
+}
+
+// TryTake takes the given number of tokens, 1 by default, if they are
+// available right away.
+func (r *RateLimiter) TryTake(ctx context.Context, n goja.Value) (bool, error) {
+	state := lib.GetState(ctx)
+	if state == nil {
+		return false, errWaitInInitContext
+	}
+	count, err := tokens(n)
+	if err != nil {
+		return false, err
+	}
+	return r.rl.get(state).AllowN(time.Now(), count), nil
+}
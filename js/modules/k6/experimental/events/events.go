@@ -0,0 +1,299 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package events implements the k6/experimental/events module, which lets the
+// VUs of a k6 instance send messages to each other over named topics.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/internal/modules"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+)
+
+func init() {
+	modules.Register("k6/experimental/events", New())
+}
+
+// defaultBufferSize is how many messages a subscription keeps by default
+// before it starts dropping new ones.
+const defaultBufferSize = 1000
+
+var errReceiveInInitContext = common.NewInitContextError("receiving events in the init context is not supported")
+
+// Events is the k6/experimental/events module. Its topics are shared by all
+// VUs of the instance.
+type Events struct {
+	mu     sync.Mutex
+	topics map[string]*topic
+}
+
+// topic delivers every message to each of its subscriptions, except that the
+// subscriptions of a group share a single queue, so only one of them receives
+// any given message.
+type topic struct {
+	subscriptions map[*Subscription]struct{}
+	groups        map[string]*groupQueue
+}
+
+type groupQueue struct {
+	ch      chan []byte
+	members int
+	active  int
+}
+
+// New returns a new k6/experimental/events module.
+func New() *Events {
+	return &Events{topics: make(map[string]*topic)}
+}
+
+// Publish sends the data, which must be serializable to JSON, to all current
+// subscribers of the topic and returns how many of them it was queued for.
+// Only active subscriptions are counted, i.e. the ones that were made or
+// received from while a VU was running, since subscriptions made in the init
+// context may belong to runtimes that never run, like the one used to get the
+// script options. Messages published before anyone subscribed to the topic
+// are lost.
+func (e *Events) Publish(name string, data goja.Value) (int, error) {
+	var exported interface{}
+	if data != nil {
+		exported = data.Export()
+	}
+	msg, err := json.Marshal(exported)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't serialize the event data: %w", err)
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.topics[name]
+	if !ok {
+		return 0, nil
+	}
+
+	delivered := 0
+	deliver := func(ch chan []byte, active bool) {
+		select {
+		case ch <- msg:
+			if active {
+				delivered++
+			}
+		default: // the buffer is full
+		}
+	}
+	for sub := range t.subscriptions {
+		deliver(sub.ch, sub.active)
+	}
+	for _, q := range t.groups {
+		deliver(q.ch, q.active > 0)
+	}
+
+	return delivered, nil
+}
+
+// Subscribe subscribes to the topic. The options are group, to share the
+// messages among the subscriptions of the group instead of copying them to
+// each one, and buffer, the number of messages kept for the subscription.
+// Subscriptions can be made in the init context, so they don't miss any
+// messages published during the first iterations.
+func (e *Events) Subscribe(
+	ctxPtr *context.Context, name string, options map[string]interface{},
+) (interface{}, error) {
+	sub, err := e.subscribe(name, options, lib.GetState(*ctxPtr) != nil)
+	if err != nil {
+		return nil, err
+	}
+	return common.Bind(common.GetRuntime(*ctxPtr), sub, ctxPtr), nil
+}
+
+func (e *Events) subscribe(name string, options map[string]interface{}, active bool) (*Subscription, error) {
+	group, bufferSize := "", int64(defaultBufferSize)
+	for k, v := range options {
+		switch k {
+		case "group":
+			var ok bool
+			if group, ok = v.(string); !ok {
+				return nil, errors.New("the group option must be a string")
+			}
+		case "buffer":
+			var ok bool
+			if bufferSize, ok = v.(int64); !ok || bufferSize < 1 {
+				return nil, errors.New("the buffer option must be a positive integer")
+			}
+		default:
+			return nil, fmt.Errorf("unknown subscribe option: %q", k)
+		}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.topics[name]
+	if !ok {
+		t = &topic{subscriptions: make(map[*Subscription]struct{}), groups: make(map[string]*groupQueue)}
+		e.topics[name] = t
+	}
+
+	sub := &Subscription{events: e, topic: name, group: group, active: active}
+	if group == "" {
+		sub.ch = make(chan []byte, bufferSize)
+		t.subscriptions[sub] = struct{}{}
+		return sub, nil
+	}
+
+	q, ok := t.groups[group]
+	if !ok {
+		// the buffer of the first member is used for the whole group
+		q = &groupQueue{ch: make(chan []byte, bufferSize)}
+		t.groups[group] = q
+	}
+	q.members++
+	if active {
+		q.active++
+	}
+	sub.ch = q.ch
+
+	return sub, nil
+}
+
+func (e *Events) unsubscribe(sub *Subscription) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	t, ok := e.topics[sub.topic]
+	if !ok {
+		return
+	}
+	if sub.group == "" {
+		delete(t.subscriptions, sub)
+	} else if q, ok := t.groups[sub.group]; ok {
+		q.members--
+		if sub.active {
+			q.active--
+		}
+		if q.members == 0 {
+			delete(t.groups, sub.group)
+		}
+	}
+	if len(t.subscriptions) == 0 && len(t.groups) == 0 {
+		delete(e.topics, sub.topic)
+	}
+}
+
+// activate marks the subscription as active, so the messages queued for it
+// are counted by Publish.
+func (e *Events) activate(sub *Subscription) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	sub.active = true
+	if t, ok := e.topics[sub.topic]; ok && sub.group != "" {
+		if q, ok := t.groups[sub.group]; ok {
+			q.active++
+		}
+	}
+}
+
+// Subscription receives the messages of a topic.
+type Subscription struct {
+	events       *Events
+	topic        string
+	group        string
+	ch           chan []byte
+	unsubscribed bool
+	active       bool // only written by its VU, under the lock of events
+}
+
+func (s *Subscription) decode(ctx context.Context, msg []byte) (goja.Value, error) {
+	var data interface{}
+	if err := json.Unmarshal(msg, &data); err != nil {
+		return nil, err
+	}
+	return common.GetRuntime(ctx).ToValue(data), nil
+}
+
+// Receive waits for the next message and returns its data, or null if none
+// arrives before the timeout, if one is given, or the VU is stopped.
+func (s *Subscription) Receive(ctx context.Context, timeout goja.Value) (goja.Value, error) {
+	if lib.GetState(ctx) == nil {
+		return nil, errReceiveInInitContext
+	}
+	if s.unsubscribed {
+		return nil, errors.New("can't receive events after unsubscribing")
+	}
+	if !s.active {
+		s.events.activate(s)
+	}
+
+	var timeoutCh <-chan time.Time
+	if timeout != nil && !goja.IsUndefined(timeout) && !goja.IsNull(timeout) {
+		d, err := types.GetDurationValue(timeout.Export())
+		if err != nil {
+			return nil, fmt.Errorf("invalid timeout: %w", err)
+		}
+		timer := time.NewTimer(d)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+
+	select {
+	case msg := <-s.ch:
+		return s.decode(ctx, msg)
+	case <-timeoutCh:
+		return goja.Null(), nil
+	case <-ctx.Done():
+		return goja.Null(), nil
+	}
+}
+
+// TryReceive returns the data of the next message if there is one already, or
+// null otherwise, without waiting.
+func (s *Subscription) TryReceive(ctx context.Context) (goja.Value, error) {
+	if lib.GetState(ctx) == nil {
+		return nil, errReceiveInInitContext
+	}
+	if s.unsubscribed {
+		return nil, errors.New("can't receive events after unsubscribing")
+	}
+	if !s.active {
+		s.events.activate(s)
+	}
+	select {
+	case msg := <-s.ch:
+		return s.decode(ctx, msg)
+	default:
+		return goja.Null(), nil
+	}
+}
+
+// Unsubscribe stops the delivery of messages to the subscription.
+func (s *Subscription) Unsubscribe() {
+	if !s.unsubscribed {
+		s.unsubscribed = true
+		s.events.unsubscribe(s)
+	}
+}
@@ -0,0 +1,194 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package events
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+)
+
+// newVU returns a runtime with the module, as a VU in the init context would
+// see it, and a function that moves it to the VU context.
+func newVU(t *testing.T, e *Events) (*goja.Runtime, func()) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctxPtr := new(context.Context)
+	*ctxPtr = common.WithRuntime(context.Background(), rt)
+	rt.Set("events", common.Bind(rt, e, ctxPtr))
+
+	return rt, func() {
+		*ctxPtr = lib.WithState(*ctxPtr, &lib.State{})
+	}
+}
+
+func TestEventsBroadcast(t *testing.T) {
+	t.Parallel()
+	e := New()
+
+	producer, startProducer := newVU(t, e)
+	consumer1, startConsumer1 := newVU(t, e)
+	consumer2, startConsumer2 := newVU(t, e)
+	for _, rt := range []*goja.Runtime{consumer1, consumer2} {
+		_, err := rt.RunString(`var sub = events.subscribe("ids");`)
+		require.NoError(t, err)
+	}
+	startProducer()
+	startConsumer1()
+	startConsumer2()
+
+	// the init context subscriptions are active once their VUs receive
+	v, err := producer.RunString(`events.publish("ids", { id: 41 })`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), v.ToInteger())
+	for _, rt := range []*goja.Runtime{consumer1, consumer2} {
+		v, err = rt.RunString(`sub.tryReceive().id`)
+		require.NoError(t, err)
+		assert.Equal(t, int64(41), v.ToInteger())
+	}
+
+	v, err = producer.RunString(`events.publish("ids", { id: 42 })`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), v.ToInteger())
+
+	for _, rt := range []*goja.Runtime{consumer1, consumer2} {
+		v, err := rt.RunString(`sub.receive("1s").id`)
+		require.NoError(t, err)
+		assert.Equal(t, int64(42), v.ToInteger())
+
+		v, err = rt.RunString(`sub.tryReceive()`)
+		require.NoError(t, err)
+		assert.True(t, goja.IsNull(v))
+	}
+
+	start := time.Now()
+	v, err = consumer1.RunString(`sub.receive(50)`)
+	require.NoError(t, err)
+	assert.True(t, goja.IsNull(v))
+	assert.True(t, time.Since(start) >= 50*time.Millisecond)
+
+	_, err = consumer1.RunString(`sub.unsubscribe(); sub.tryReceive()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "can't receive events after unsubscribing")
+
+	v, err = producer.RunString(`events.publish("ids", 43)`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), v.ToInteger())
+}
+
+func TestEventsGroup(t *testing.T) {
+	t.Parallel()
+	e := New()
+
+	producer, startProducer := newVU(t, e)
+	startProducer()
+	consumers := make([]*goja.Runtime, 3)
+	for i := range consumers {
+		var start func()
+		consumers[i], start = newVU(t, e)
+		_, err := consumers[i].RunString(`var sub = events.subscribe("jobs", { group: "workers", buffer: 10 });`)
+		require.NoError(t, err)
+		start()
+	}
+
+	v, err := producer.RunString(`events.publish("jobs", 0)`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), v.ToInteger())
+	v, err = consumers[2].RunString(`sub.receive("1s")`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), v.ToInteger())
+
+	_, err = producer.RunString(`for (var i = 0; i < 3; i++) { events.publish("jobs", i); }`)
+	require.NoError(t, err)
+
+	seen := map[int64]bool{}
+	for _, rt := range consumers {
+		v, err := rt.RunString(`sub.receive("1s")`)
+		require.NoError(t, err)
+		seen[v.ToInteger()] = true
+	}
+	assert.Equal(t, map[int64]bool{0: true, 1: true, 2: true}, seen)
+
+	v, err = consumers[0].RunString(`sub.tryReceive()`)
+	require.NoError(t, err)
+	assert.True(t, goja.IsNull(v))
+}
+
+func TestEventsCountsOnlyActiveSubscriptions(t *testing.T) {
+	t.Parallel()
+	e := New()
+
+	producer, startProducer := newVU(t, e)
+	startProducer()
+	// like the runtime used for getting the script options, it never runs
+	unused, _ := newVU(t, e)
+	_, err := unused.RunString(`var sub = events.subscribe("ids"); events.subscribe("ids", { group: "g" })`)
+	require.NoError(t, err)
+	_, err = unused.RunString(`sub.tryReceive()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "receiving events in the init context is not supported")
+
+	v, err := producer.RunString(`events.publish("ids", 1)`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), v.ToInteger())
+
+	// subscriptions made while the VU is running are active right away
+	v, err = producer.RunString(`var own = events.subscribe("ids"); events.publish("ids", 2)`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), v.ToInteger())
+
+	_, err = producer.RunString(`own.unsubscribe()`)
+	require.NoError(t, err)
+	v, err = producer.RunString(`events.publish("ids", 3)`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), v.ToInteger())
+}
+
+func TestEventsErrors(t *testing.T) {
+	t.Parallel()
+	e := New()
+	rt, _ := newVU(t, e)
+
+	_, err := rt.RunString(`events.subscribe("x").receive()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "receiving events in the init context is not supported")
+
+	_, err = rt.RunString(`events.subscribe("x", { buffer: 0 })`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the buffer option must be a positive integer")
+
+	_, err = rt.RunString(`events.subscribe("x", { foo: 1 })`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown subscribe option: "foo"`)
+
+	sub, err := e.subscribe("full", map[string]interface{}{"buffer": int64(1)}, true)
+	require.NoError(t, err)
+	_, err = rt.RunString(`events.publish("full", 1); events.publish("full", 2)`)
+	require.NoError(t, err)
+	assert.Len(t, sub.ch, 1)
+}
@@ -0,0 +1,201 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package oauth
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// The supported grant types.
+const (
+	grantClientCredentials = "client_credentials"
+	grantPassword          = "password"
+	grantAuthorizationCode = "authorization_code"
+	grantRefreshToken      = "refresh_token"
+)
+
+const (
+	defaultRefreshBefore = 30 * time.Second
+	defaultTimeout       = 60 * time.Second
+)
+
+type config struct {
+	grant        string
+	tokenURL     string
+	clientID     string
+	clientSecret string
+	clientAuth   string // "header" (HTTP basic auth) or "body"
+	scopes       []string
+	audience     string
+
+	// password grant
+	username, password string
+
+	// authorization_code grant
+	code, redirectURL, codeVerifier string
+
+	shared        bool
+	refreshBefore time.Duration
+	timeout       time.Duration
+	emitMetrics   bool
+	tags          map[string]string
+}
+
+//nolint:funlen,gocyclo
+func parseConfig(params map[string]interface{}) (config, error) {
+	conf := config{
+		grant:         grantClientCredentials,
+		clientAuth:    "header",
+		refreshBefore: defaultRefreshBefore,
+		timeout:       defaultTimeout,
+		emitMetrics:   true,
+	}
+
+	for k, v := range params {
+		var err error
+		switch k {
+		case "grant":
+			conf.grant, err = stringParam(k, v)
+		case "tokenURL":
+			conf.tokenURL, err = stringParam(k, v)
+		case "clientID":
+			conf.clientID, err = stringParam(k, v)
+		case "clientSecret":
+			conf.clientSecret, err = stringParam(k, v)
+		case "clientAuth":
+			conf.clientAuth, err = stringParam(k, v)
+		case "audience":
+			conf.audience, err = stringParam(k, v)
+		case "username":
+			conf.username, err = stringParam(k, v)
+		case "password":
+			conf.password, err = stringParam(k, v)
+		case "code":
+			conf.code, err = stringParam(k, v)
+		case "redirectURL":
+			conf.redirectURL, err = stringParam(k, v)
+		case "codeVerifier":
+			conf.codeVerifier, err = stringParam(k, v)
+		case "scopes":
+			conf.scopes, err = stringsParam(k, v)
+		case "shared":
+			conf.shared, _ = v.(bool)
+		case "emitMetrics":
+			conf.emitMetrics, _ = v.(bool)
+		case "refreshBefore":
+			conf.refreshBefore, err = types.GetDurationValue(v)
+		case "timeout":
+			conf.timeout, err = types.GetDurationValue(v)
+		case "tags":
+			tags, ok := v.(map[string]interface{})
+			if !ok {
+				return conf, fmt.Errorf("invalid tags value: %v", v)
+			}
+			conf.tags = make(map[string]string, len(tags))
+			for tk, tv := range tags {
+				conf.tags[tk] = fmt.Sprint(tv)
+			}
+		default:
+			return conf, fmt.Errorf("unknown OAuth client param: %q", k)
+		}
+		if err != nil {
+			return conf, err
+		}
+	}
+
+	return conf, conf.validate()
+}
+
+func (c config) validate() error {
+	if c.tokenURL == "" {
+		return fmt.Errorf("tokenURL is required")
+	}
+	if u, err := url.Parse(c.tokenURL); err != nil || u.Host == "" {
+		return fmt.Errorf("invalid tokenURL %q", c.tokenURL)
+	}
+	if c.clientID == "" {
+		return fmt.Errorf("clientID is required")
+	}
+	if c.clientAuth != "header" && c.clientAuth != "body" {
+		return fmt.Errorf("clientAuth should be either 'header' or 'body', got %q", c.clientAuth)
+	}
+	if c.refreshBefore < 0 {
+		return fmt.Errorf("refreshBefore can't be negative")
+	}
+	if c.timeout <= 0 {
+		return fmt.Errorf("timeout should be positive")
+	}
+
+	switch c.grant {
+	case grantClientCredentials:
+	case grantPassword:
+		if c.username == "" {
+			return fmt.Errorf("username is required for the password grant")
+		}
+	case grantAuthorizationCode:
+		if c.code == "" {
+			return fmt.Errorf("code is required for the authorization_code grant")
+		}
+	default:
+		return fmt.Errorf("unsupported grant %q", c.grant)
+	}
+	return nil
+}
+
+// key identifies the token a client config would receive, for sharing tokens
+// between VUs.
+func (c config) key() string {
+	return strings.Join([]string{
+		c.grant, c.tokenURL, c.clientID, c.audience, c.username, c.code, strings.Join(c.scopes, " "),
+	}, "\x00")
+}
+
+func stringParam(name string, v interface{}) (string, error) {
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("%s should be a string, got %v", name, v)
+	}
+	return s, nil
+}
+
+func stringsParam(name string, v interface{}) ([]string, error) {
+	switch vals := v.(type) {
+	case string:
+		return strings.Fields(vals), nil
+	case []interface{}:
+		res := make([]string, len(vals))
+		for i, val := range vals {
+			s, err := stringParam(name, val)
+			if err != nil {
+				return nil, err
+			}
+			res[i] = s
+		}
+		return res, nil
+	default:
+		return nil, fmt.Errorf("%s should be a string or an array of strings, got %v", name, v)
+	}
+}
@@ -0,0 +1,144 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package oauth implements the k6/experimental/oauth module, which fetches
+// OAuth2/OIDC access tokens and transparently refreshes them before they expire.
+package oauth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sync"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/internal/modules"
+	"github.com/loadimpact/k6/lib"
+)
+
+func init() {
+	modules.Register("k6/experimental/oauth", New())
+}
+
+var errTokenInInitContext = common.NewInitContextError("fetching OAuth tokens in the init context is not supported")
+
+// OAuth is the k6/experimental/oauth module.
+type OAuth struct {
+	// Token sources for clients with `shared: true`, keyed by config, so that
+	// all VUs with the same client configuration use the same token.
+	mu     sync.Mutex
+	shared map[string]*tokenSource
+}
+
+// New returns a new k6/experimental/oauth module.
+func New() *OAuth {
+	return &OAuth{shared: make(map[string]*tokenSource)}
+}
+
+// XClient is the Client constructor (e.g. `new oauth.Client({...})`). Clients
+// have to be created in the init context.
+func (o *OAuth) XClient(ctxPtr *context.Context, params map[string]interface{}) (interface{}, error) {
+	if lib.GetState(*ctxPtr) != nil {
+		return nil, errors.New("OAuth clients must be created in the init context")
+	}
+	conf, err := parseConfig(params)
+	if err != nil {
+		return nil, err
+	}
+
+	src := &tokenSource{conf: conf}
+	if conf.shared {
+		o.mu.Lock()
+		if existing, ok := o.shared[conf.key()]; ok {
+			src = existing
+		} else {
+			o.shared[conf.key()] = src
+		}
+		o.mu.Unlock()
+	}
+
+	rt := common.GetRuntime(*ctxPtr)
+	return common.Bind(rt, &Client{src: src}, ctxPtr), nil
+}
+
+// PKCE holds a PKCE code verifier and the matching challenge, as described in
+// RFC 7636.
+type PKCE struct {
+	Verifier  string `js:"verifier"`
+	Challenge string `js:"challenge"`
+	Method    string `js:"method"`
+}
+
+// GeneratePKCE returns a new random PKCE code verifier and its S256 challenge,
+// for use with the authorization_code grant.
+func (*OAuth) GeneratePKCE() (PKCE, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return PKCE{}, err
+	}
+	verifier := base64.RawURLEncoding.EncodeToString(buf)
+	sum := sha256.Sum256([]byte(verifier))
+	return PKCE{
+		Verifier:  verifier,
+		Challenge: base64.RawURLEncoding.EncodeToString(sum[:]),
+		Method:    "S256",
+	}, nil
+}
+
+// Client fetches and caches access tokens for a single OAuth2 client config.
+type Client struct {
+	src *tokenSource
+}
+
+// Token returns a valid access token, fetching a new one or refreshing the
+// cached one if it's missing or about to expire.
+func (c *Client) Token(ctx context.Context) (string, error) {
+	state := lib.GetState(ctx)
+	if state == nil {
+		return "", errTokenInInitContext
+	}
+	tok, err := c.src.get(ctx, state)
+	if err != nil {
+		return "", err
+	}
+	return tok.accessToken, nil
+}
+
+// Header returns the value for an Authorization header with a valid token,
+// e.g. "Bearer <token>".
+func (c *Client) Header(ctx context.Context) (string, error) {
+	state := lib.GetState(ctx)
+	if state == nil {
+		return "", errTokenInInitContext
+	}
+	tok, err := c.src.get(ctx, state)
+	if err != nil {
+		return "", err
+	}
+	return tok.tokenType + " " + tok.accessToken, nil
+}
+
+// Invalidate drops the cached token, so the next call to Token() fetches a new
+// one, e.g. after the server has rejected it.
+func (c *Client) Invalidate() {
+	c.src.invalidate()
+}
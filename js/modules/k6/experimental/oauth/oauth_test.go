@@ -0,0 +1,262 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package oauth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+type tokenServer struct {
+	*httptest.Server
+	requests  int64
+	expiresIn int
+	lastForm  map[string]string
+}
+
+func newTokenServer(t *testing.T, expiresIn int) *tokenServer {
+	ts := &tokenServer{expiresIn: expiresIn}
+	ts.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt64(&ts.requests, 1)
+		require.NoError(t, r.ParseForm())
+		ts.lastForm = make(map[string]string)
+		for k := range r.PostForm {
+			ts.lastForm[k] = r.PostForm.Get(k)
+		}
+		if id, secret, ok := r.BasicAuth(); ok {
+			ts.lastForm["basic"] = id + ":" + secret
+		}
+		if r.PostForm.Get("client_id") == "bad" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"error":"invalid_client","error_description":"unknown client"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"access_token":  "token" + string(rune('0'+n)),
+			"token_type":    "bearer",
+			"expires_in":    ts.expiresIn,
+			"refresh_token": "refresh" + string(rune('0'+n)),
+		})
+	}))
+	return ts
+}
+
+func newRuntime(t *testing.T, mod *OAuth) (*goja.Runtime, *context.Context, chan stats.SampleContainer) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("oauth", common.Bind(rt, mod, &ctx))
+	return rt, &ctx, make(chan stats.SampleContainer, 100)
+}
+
+func toVUContext(ctx *context.Context, samples chan stats.SampleContainer) {
+	logger := logrus.New()
+	logger.SetLevel(logrus.PanicLevel)
+	*ctx = lib.WithState(*ctx, &lib.State{
+		Logger:    logger,
+		Transport: http.DefaultTransport,
+		Samples:   samples,
+		Tags:      map[string]string{},
+	})
+}
+
+func TestClientCredentials(t *testing.T) {
+	t.Parallel()
+	ts := newTokenServer(t, 3600)
+	defer ts.Close()
+
+	rt, ctx, samples := newRuntime(t, New())
+	_, err := rt.RunString(`var client = new oauth.Client({
+		tokenURL: "` + ts.URL + `", clientID: "id", clientSecret: "s3cr3t",
+		scopes: ["read", "write"], tags: {name: "auth"},
+	})`)
+	require.NoError(t, err)
+
+	_, err = rt.RunString(`client.token()`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "init context")
+
+	toVUContext(ctx, samples)
+	v, err := rt.RunString(`client.header()`)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer token1", v.String())
+	assert.Equal(t, map[string]string{
+		"grant_type": "client_credentials",
+		"scope":      "read write",
+		"basic":      "id:s3cr3t",
+	}, ts.lastForm)
+
+	// The cached token is used until it's about to expire
+	v, err = rt.RunString(`client.token()`)
+	require.NoError(t, err)
+	assert.Equal(t, "token1", v.String())
+	assert.Equal(t, int64(1), atomic.LoadInt64(&ts.requests))
+
+	require.Len(t, samples, 1)
+	sample := (<-samples).(stats.Sample)
+	assert.Equal(t, metrics.OAuthTokenDuration, sample.Metric)
+	assert.Equal(t, map[string]string{
+		"grant_type": "client_credentials", "status": "200", "name": "auth",
+	}, sample.Tags.CloneTags())
+
+	_, err = rt.RunString(`client.invalidate(); client.token()`)
+	require.NoError(t, err)
+	assert.Equal(t, "refresh_token", ts.lastForm["grant_type"])
+	assert.Equal(t, "refresh1", ts.lastForm["refresh_token"])
+}
+
+func TestRefreshBeforeExpiry(t *testing.T) {
+	t.Parallel()
+	ts := newTokenServer(t, 10)
+	defer ts.Close()
+
+	rt, ctx, samples := newRuntime(t, New())
+	_, err := rt.RunString(`var client = new oauth.Client({
+		tokenURL: "` + ts.URL + `", clientID: "id", clientAuth: "body",
+		grant: "password", username: "user", password: "pass",
+		refreshBefore: "20s", emitMetrics: false,
+	})`)
+	require.NoError(t, err)
+	toVUContext(ctx, samples)
+
+	v, err := rt.RunString(`client.token()`)
+	require.NoError(t, err)
+	assert.Equal(t, "token1", v.String())
+	assert.Equal(t, map[string]string{
+		"grant_type": "password", "username": "user", "password": "pass", "client_id": "id",
+	}, ts.lastForm)
+
+	// The token expires within refreshBefore, so it's refreshed right away
+	v, err = rt.RunString(`client.token()`)
+	require.NoError(t, err)
+	assert.Equal(t, "token2", v.String())
+	assert.Equal(t, "refresh1", ts.lastForm["refresh_token"])
+	assert.Empty(t, samples)
+}
+
+func TestAuthorizationCodePKCE(t *testing.T) {
+	t.Parallel()
+	ts := newTokenServer(t, 0)
+	defer ts.Close()
+
+	rt, ctx, samples := newRuntime(t, New())
+	v, err := rt.RunString(`var pkce = oauth.generatePKCE();
+		var client = new oauth.Client({
+			tokenURL: "` + ts.URL + `", clientID: "id", grant: "authorization_code",
+			code: "abc", redirectURL: "http://localhost/cb", codeVerifier: pkce.verifier,
+		});
+		[pkce.verifier, pkce.challenge, pkce.method]`)
+	require.NoError(t, err)
+	var pkce []string
+	require.NoError(t, rt.ExportTo(v, &pkce))
+	sum := sha256.Sum256([]byte(pkce[0]))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), pkce[1])
+	assert.Equal(t, "S256", pkce[2])
+
+	toVUContext(ctx, samples)
+	_, err = rt.RunString(`client.token()`)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"grant_type": "authorization_code", "code": "abc", "redirect_uri": "http://localhost/cb",
+		"code_verifier": pkce[0], "basic": "id:",
+	}, ts.lastForm)
+}
+
+func TestSharedClients(t *testing.T) {
+	t.Parallel()
+	ts := newTokenServer(t, 3600)
+	defer ts.Close()
+
+	mod := New()
+	script := `var client = new oauth.Client({tokenURL: "` + ts.URL + `", clientID: "id", shared: true}); client`
+	var tokens []string
+	for i := 0; i < 3; i++ {
+		rt, ctx, samples := newRuntime(t, mod)
+		_, err := rt.RunString(script)
+		require.NoError(t, err)
+		toVUContext(ctx, samples)
+		v, err := rt.RunString(`client.token()`)
+		require.NoError(t, err)
+		tokens = append(tokens, v.String())
+	}
+	assert.Equal(t, []string{"token1", "token1", "token1"}, tokens)
+	assert.Equal(t, int64(1), atomic.LoadInt64(&ts.requests))
+}
+
+func TestClientErrors(t *testing.T) {
+	t.Parallel()
+	ts := newTokenServer(t, 3600)
+	defer ts.Close()
+
+	testCases := map[string]string{
+		`{clientID: "id"}`: "tokenURL is required",
+		`{tokenURL: "TS"}`: "clientID is required",
+		`{tokenURL: "TS", clientID: "id", grant: "implicit"}`:   `unsupported grant "implicit"`,
+		`{tokenURL: "TS", clientID: "id", grant: "password"}`:   "username is required",
+		`{tokenURL: "TS", clientID: "id", clientAuth: "nope"}`:  "clientAuth should be",
+		`{tokenURL: "TS", clientID: "id", refreshBefore: "x"}`:  "invalid duration",
+		`{tokenURL: "TS", clientID: "id", unknown: true}`:       `unknown OAuth client param: "unknown"`,
+		`{tokenURL: "TS", clientID: "id", scopes: 1}`:           "scopes should be",
+		`{tokenURL: "TS", clientID: "id", tags: "nope"}`:        "invalid tags value",
+		`{tokenURL: "TS", clientID: "id", clientAuth: "body"}`:  "",
+		`{tokenURL: "TS", clientID: "bad", clientAuth: "body"}`: "",
+	}
+	for params, expErr := range testCases {
+		params, expErr := params, expErr
+		t.Run(params, func(t *testing.T) {
+			rt, _, _ := newRuntime(t, New())
+			_, err := rt.RunString(`new oauth.Client(` + strings.Replace(params, "TS", ts.URL, 1) + `)`)
+			if expErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), expErr)
+		})
+	}
+
+	t.Run("token endpoint error", func(t *testing.T) {
+		rt, ctx, samples := newRuntime(t, New())
+		_, err := rt.RunString(`var client = new oauth.Client({tokenURL: "` + ts.URL + `", clientID: "bad", clientAuth: "body"})`)
+		require.NoError(t, err)
+		toVUContext(ctx, samples)
+		_, err = rt.RunString(`client.token()`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "OAuth token request failed with invalid_client: unknown client")
+	})
+}
@@ -0,0 +1,254 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/secrets"
+	"github.com/loadimpact/k6/stats"
+)
+
+type token struct {
+	accessToken  string
+	tokenType    string
+	refreshToken string
+	expiry       time.Time // zero if the token doesn't expire
+}
+
+func (t *token) validFor(d time.Duration) bool {
+	return t != nil && (t.expiry.IsZero() || time.Now().Add(d).Before(t.expiry))
+}
+
+type tokenResponse struct {
+	AccessToken  string      `json:"access_token"`
+	TokenType    string      `json:"token_type"`
+	RefreshToken string      `json:"refresh_token"`
+	ExpiresIn    json.Number `json:"expires_in"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// tokenSource caches the token for a client config. It may be shared between
+// VUs, in which case only one of them fetches a new token at a time.
+type tokenSource struct {
+	conf config
+
+	mu       sync.Mutex
+	tok      *token
+	codeUsed bool
+}
+
+func (s *tokenSource) get(ctx context.Context, state *lib.State) (*token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.tok.validFor(s.conf.refreshBefore) {
+		return s.tok, nil
+	}
+
+	if s.tok != nil && s.tok.refreshToken != "" {
+		form := url.Values{"grant_type": {grantRefreshToken}, "refresh_token": {s.tok.refreshToken}}
+		tok, err := s.fetch(ctx, state, grantRefreshToken, form)
+		if err == nil {
+			if tok.refreshToken == "" {
+				tok.refreshToken = s.tok.refreshToken
+				secrets.AddRedacted(tok.refreshToken)
+			}
+			s.setToken(tok)
+			return tok, nil
+		}
+		// Fall back to the original grant, if it can be repeated
+		if s.conf.grant == grantAuthorizationCode {
+			return nil, err
+		}
+		state.Logger.WithError(err).Debug("Refreshing the OAuth token failed, requesting a new one")
+	}
+
+	if s.conf.grant == grantAuthorizationCode && s.codeUsed {
+		return nil, fmt.Errorf("the OAuth token has expired and the authorization code was already used")
+	}
+
+	tok, err := s.fetch(ctx, state, s.conf.grant, s.grantForm())
+	if err != nil {
+		return nil, err
+	}
+	if s.conf.grant == grantAuthorizationCode {
+		s.codeUsed = true
+	}
+	s.setToken(tok)
+	return tok, nil
+}
+
+// setToken replaces the cached token. The values of the old one aren't
+// redacted anymore, so the redacted values don't pile up during long tests.
+func (s *tokenSource) setToken(tok *token) {
+	if s.tok != nil {
+		secrets.RemoveRedacted(s.tok.accessToken)
+		secrets.RemoveRedacted(s.tok.refreshToken)
+	}
+	s.tok = tok
+}
+
+func (s *tokenSource) invalidate() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.tok == nil {
+		return
+	}
+	// Keep the refresh token, if there is one
+	tok := *s.tok
+	tok.expiry = time.Now()
+	s.tok = &tok
+}
+
+func (s *tokenSource) grantForm() url.Values {
+	form := url.Values{"grant_type": {s.conf.grant}}
+	if len(s.conf.scopes) > 0 {
+		form.Set("scope", strings.Join(s.conf.scopes, " "))
+	}
+	if s.conf.audience != "" {
+		form.Set("audience", s.conf.audience)
+	}
+	switch s.conf.grant {
+	case grantPassword:
+		form.Set("username", s.conf.username)
+		form.Set("password", s.conf.password)
+	case grantAuthorizationCode:
+		form.Set("code", s.conf.code)
+		if s.conf.redirectURL != "" {
+			form.Set("redirect_uri", s.conf.redirectURL)
+		}
+		if s.conf.codeVerifier != "" {
+			form.Set("code_verifier", s.conf.codeVerifier)
+		}
+	}
+	return form
+}
+
+// fetch requests a token from the token endpoint. The request doesn't emit the
+// usual http_req_* metrics, only oauth_token_duration, so the token endpoint
+// latency doesn't skew the results of the actual test.
+func (s *tokenSource) fetch(ctx context.Context, state *lib.State, grant string, form url.Values) (*token, error) {
+	if s.conf.clientAuth == "body" {
+		form.Set("client_id", s.conf.clientID)
+		if s.conf.clientSecret != "" {
+			form.Set("client_secret", s.conf.clientSecret)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.conf.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.conf.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if s.conf.clientAuth == "header" {
+		req.SetBasicAuth(url.QueryEscape(s.conf.clientID), url.QueryEscape(s.conf.clientSecret))
+	}
+	if ua := state.Options.UserAgent; ua.Valid {
+		req.Header.Set("User-Agent", ua.String)
+	}
+
+	start := time.Now()
+	resp, err := (&http.Client{Transport: state.Transport}).Do(req)
+	status := 0
+	if resp != nil {
+		status = resp.StatusCode
+	}
+	s.emitDuration(ctx, state, grant, status, start)
+	if err != nil {
+		return nil, fmt.Errorf("OAuth token request failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading the OAuth token response failed: %w", err)
+	}
+
+	var tr tokenResponse
+	if err = json.Unmarshal(body, &tr); err != nil && resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("invalid OAuth token response: %w", err)
+	}
+	if tr.Error != "" {
+		if tr.ErrorDescription != "" {
+			return nil, fmt.Errorf("OAuth token request failed with %s: %s", tr.Error, tr.ErrorDescription)
+		}
+		return nil, fmt.Errorf("OAuth token request failed with %s", tr.Error)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("OAuth token request failed with status %d", resp.StatusCode)
+	}
+	if tr.AccessToken == "" {
+		return nil, fmt.Errorf("the OAuth token response has no access_token")
+	}
+
+	tok := &token{accessToken: tr.AccessToken, tokenType: tr.TokenType, refreshToken: tr.RefreshToken}
+	if tok.tokenType == "" || strings.EqualFold(tok.tokenType, "bearer") {
+		tok.tokenType = "Bearer"
+	}
+	if tr.ExpiresIn != "" {
+		secs, err := strconv.ParseFloat(tr.ExpiresIn.String(), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expires_in value %q in the OAuth token response", tr.ExpiresIn)
+		}
+		tok.expiry = start.Add(time.Duration(secs * float64(time.Second)))
+	}
+
+	// Tokens are credentials, so keep them out of logs and outputs
+	secrets.AddRedacted(tok.accessToken)
+	secrets.AddRedacted(tok.refreshToken)
+	return tok, nil
+}
+
+func (s *tokenSource) emitDuration(ctx context.Context, state *lib.State, grant string, status int, start time.Time) {
+	if !s.conf.emitMetrics {
+		return
+	}
+	now := time.Now()
+	tags := state.CloneTags()
+	for k, v := range s.conf.tags {
+		tags[k] = v
+	}
+	tags["grant_type"] = grant
+	tags["status"] = strconv.Itoa(status)
+	stats.PushIfNotDone(ctx, state.Samples, stats.Sample{
+		Time:   now,
+		Metric: metrics.OAuthTokenDuration,
+		Value:  stats.D(now.Sub(start)),
+		Tags:   stats.IntoSampleTags(&tags),
+	})
+}
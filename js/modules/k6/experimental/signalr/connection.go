@@ -0,0 +1,432 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package signalr
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/modules/k6/ws"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// recordSeparator terminates every message of the JSON hub protocol
+const recordSeparator = "\x1e"
+
+// The message types of the hub protocol
+const (
+	messageInvocation       = 1
+	messageStreamItem       = 2
+	messageCompletion       = 3
+	messageStreamInvocation = 4
+	messagePing             = 6
+	messageClose            = 7
+)
+
+// keepAliveInterval is how often pings are sent to the server, the same as the
+// default of the JavaScript client, so the server doesn't time out the client.
+const keepAliveInterval = 15 * time.Second
+
+type invocationMessage struct {
+	Type         int           `json:"type"`
+	InvocationID string        `json:"invocationId,omitempty"`
+	Target       string        `json:"target"`
+	Arguments    []interface{} `json:"arguments"`
+}
+
+type hubMessage struct {
+	Type         int             `json:"type"`
+	InvocationID string          `json:"invocationId"`
+	Target       string          `json:"target"`
+	Arguments    []interface{}   `json:"arguments"`
+	Item         interface{}     `json:"item"`
+	Result       json.RawMessage `json:"result"`
+	Error        string          `json:"error"`
+}
+
+type streamSubscriber struct {
+	next, complete, error goja.Callable
+}
+
+type pendingInvocation struct {
+	target   string
+	sent     time.Time
+	callback goja.Callable
+	stream   *streamSubscriber
+}
+
+// Connection is a connection to a SignalR hub.
+type Connection struct {
+	Connected bool `js:"connected"`
+
+	ctx   context.Context
+	state *lib.State
+	tags  map[string]string
+
+	ws            *ws.Socket
+	handshakeDone bool
+	closeError    string
+
+	// hub method names are case-insensitive, so the keys are lowercased
+	handlers      map[string][]goja.Callable
+	openHandlers  []goja.Callable
+	closeHandlers []goja.Callable
+	errorHandlers []goja.Callable
+
+	sendBuffer        []string
+	invocations       map[string]*pendingInvocation
+	invocationCounter int64
+}
+
+func newConnection(ctx context.Context, state *lib.State, tags map[string]string) *Connection {
+	return &Connection{
+		ctx:         ctx,
+		state:       state,
+		tags:        tags,
+		handlers:    make(map[string][]goja.Callable),
+		invocations: make(map[string]*pendingInvocation),
+	}
+}
+
+// attach starts the hub protocol handshake on the WebSocket connection.
+func (c *Connection) attach(wsSocket *ws.Socket) error {
+	rt := common.GetRuntime(c.ctx)
+	c.ws = wsSocket
+
+	wsSocket.On("message", rt.ToValue(c.handleMessages))
+	wsSocket.On("close", rt.ToValue(func(int) { c.handleClose() }))
+	wsSocket.On("error", rt.ToValue(func(err goja.Value) {
+		c.callHandlers(c.errorHandlers, err)
+	}))
+
+	ping, _ := goja.AssertFunction(rt.ToValue(func() {
+		if c.Connected {
+			c.ws.Send(`{"type":6}` + recordSeparator)
+		}
+	}))
+	if err := wsSocket.SetInterval(ping, float64(keepAliveInterval/time.Millisecond)); err != nil {
+		return err
+	}
+
+	wsSocket.Send(`{"protocol":"json","version":1}` + recordSeparator)
+
+	return nil
+}
+
+func (c *Connection) sampleTags(target string) *stats.SampleTags {
+	tags := make(map[string]string, len(c.tags)+1)
+	for k, v := range c.tags {
+		tags[k] = v
+	}
+	tags["target"] = target
+
+	return stats.IntoSampleTags(&tags)
+}
+
+func (c *Connection) callHandlers(handlers []goja.Callable, args ...goja.Value) {
+	for _, handler := range handlers {
+		if _, err := handler(goja.Undefined(), args...); err != nil {
+			common.Throw(common.GetRuntime(c.ctx), err)
+		}
+	}
+}
+
+// On registers a handler for the hub method with the given name, which is
+// called with the arguments of every invocation of it by the server.
+func (c *Connection) On(method string, handler goja.Value) {
+	if handler, ok := goja.AssertFunction(handler); ok {
+		method = strings.ToLower(method)
+		c.handlers[method] = append(c.handlers[method], handler)
+	}
+}
+
+// OnOpen registers a handler that's called once the handshake completes.
+func (c *Connection) OnOpen(handler goja.Callable) {
+	c.openHandlers = append(c.openHandlers, handler)
+}
+
+// OnClose registers a handler that's called when the connection is closed,
+// with the error the server closed it with, if any.
+func (c *Connection) OnClose(handler goja.Callable) {
+	c.closeHandlers = append(c.closeHandlers, handler)
+}
+
+// OnError registers a handler for connection and protocol errors.
+func (c *Connection) OnError(handler goja.Callable) {
+	c.errorHandlers = append(c.errorHandlers, handler)
+}
+
+// Send invokes the hub method without waiting for its completion.
+func (c *Connection) Send(method string, args ...goja.Value) error {
+	return c.sendMessage(invocationMessage{
+		Type:      messageInvocation,
+		Target:    method,
+		Arguments: exportArgs(args),
+	})
+}
+
+// Invoke invokes the hub method with the given arguments. If the last argument
+// is a function, it's called with the error, if any, and the result once the
+// invocation completes.
+func (c *Connection) Invoke(method string, args ...goja.Value) error {
+	var callback goja.Callable
+	if len(args) > 0 {
+		if fn, ok := goja.AssertFunction(args[len(args)-1]); ok {
+			callback = fn
+			args = args[:len(args)-1]
+		}
+	}
+
+	id := c.nextInvocationID()
+	c.invocations[id] = &pendingInvocation{target: method, sent: time.Now(), callback: callback}
+
+	return c.sendMessage(invocationMessage{
+		Type:         messageInvocation,
+		InvocationID: id,
+		Target:       method,
+		Arguments:    exportArgs(args),
+	})
+}
+
+// Stream invokes the streaming hub method with the given arguments. The
+// subscriber's next function is called with every item and its complete or
+// error function once the stream ends.
+func (c *Connection) Stream(method string, args []interface{}, subscriber goja.Value) error {
+	var sub streamSubscriber
+	if !goja.IsUndefined(subscriber) && !goja.IsNull(subscriber) {
+		obj := subscriber.ToObject(common.GetRuntime(c.ctx))
+		sub.next, _ = goja.AssertFunction(obj.Get("next"))
+		sub.complete, _ = goja.AssertFunction(obj.Get("complete"))
+		sub.error, _ = goja.AssertFunction(obj.Get("error"))
+	}
+	if args == nil {
+		args = []interface{}{}
+	}
+
+	id := c.nextInvocationID()
+	c.invocations[id] = &pendingInvocation{target: method, sent: time.Now(), stream: &sub}
+
+	return c.sendMessage(invocationMessage{
+		Type:         messageStreamInvocation,
+		InvocationID: id,
+		Target:       method,
+		Arguments:    args,
+	})
+}
+
+// Close closes the connection.
+func (c *Connection) Close() {
+	if c.ws != nil {
+		c.ws.Close()
+	}
+}
+
+func (c *Connection) nextInvocationID() string {
+	id := strconv.FormatInt(c.invocationCounter, 10)
+	c.invocationCounter++
+	return id
+}
+
+func exportArgs(args []goja.Value) []interface{} {
+	exported := make([]interface{}, len(args))
+	for i, arg := range args {
+		exported[i] = arg.Export()
+	}
+	return exported
+}
+
+// sendMessage sends the message, or buffers it until the handshake completes
+func (c *Connection) sendMessage(msg interface{}) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("couldn't serialize the SignalR message: %w", err)
+	}
+	if !c.Connected {
+		c.sendBuffer = append(c.sendBuffer, string(data)+recordSeparator)
+		return nil
+	}
+	c.ws.Send(string(data) + recordSeparator)
+
+	return nil
+}
+
+// handleMessages handles a WebSocket message, which can hold several
+// messages of the hub protocol.
+func (c *Connection) handleMessages(data string) {
+	for _, record := range strings.Split(data, recordSeparator) {
+		if record == "" {
+			continue
+		}
+		if !c.handshakeDone {
+			c.handleHandshake(record)
+			continue
+		}
+		var msg hubMessage
+		if err := json.Unmarshal([]byte(record), &msg); err != nil {
+			c.callHandlers(c.errorHandlers, common.GetRuntime(c.ctx).ToValue(
+				fmt.Sprintf("invalid SignalR message: %s", err)))
+			continue
+		}
+		c.handleMessage(msg)
+	}
+}
+
+func (c *Connection) handleHandshake(record string) {
+	var res struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(record), &res); err != nil {
+		res.Error = fmt.Sprintf("invalid handshake response: %s", err)
+	}
+	if res.Error != "" {
+		c.callHandlers(c.errorHandlers, common.GetRuntime(c.ctx).ToValue("SignalR handshake failed: "+res.Error))
+		c.ws.Close()
+		return
+	}
+
+	c.handshakeDone = true
+	c.Connected = true
+	buffered := c.sendBuffer
+	c.sendBuffer = nil
+	for _, msg := range buffered {
+		c.ws.Send(msg)
+	}
+	c.callHandlers(c.openHandlers)
+}
+
+func (c *Connection) handleMessage(msg hubMessage) {
+	rt := common.GetRuntime(c.ctx)
+	switch msg.Type {
+	case messageInvocation:
+		args := make([]goja.Value, len(msg.Arguments))
+		for i, arg := range msg.Arguments {
+			args[i] = rt.ToValue(arg)
+		}
+		c.callHandlers(c.handlers[strings.ToLower(msg.Target)], args...)
+		if msg.InvocationID != "" {
+			// The server waits for a client result, which isn't supported
+			_ = c.sendMessage(struct {
+				Type         int    `json:"type"`
+				InvocationID string `json:"invocationId"`
+				Error        string `json:"error"`
+			}{messageCompletion, msg.InvocationID, "Client results are not supported."})
+		}
+
+	case messageStreamItem:
+		inv, ok := c.invocations[msg.InvocationID]
+		if !ok || inv.stream == nil {
+			return
+		}
+		stats.PushIfNotDone(c.ctx, c.state.Samples, stats.Sample{
+			Metric: metrics.SignalRStreamItems,
+			Time:   time.Now(),
+			Tags:   c.sampleTags(inv.target),
+			Value:  1,
+		})
+		if inv.stream.next != nil {
+			c.callHandlers([]goja.Callable{inv.stream.next}, rt.ToValue(msg.Item))
+		}
+
+	case messageCompletion:
+		c.handleCompletion(msg)
+
+	case messageClose:
+		c.closeError = msg.Error
+		c.ws.Close()
+
+	case messagePing:
+	}
+}
+
+func (c *Connection) handleCompletion(msg hubMessage) {
+	inv, ok := c.invocations[msg.InvocationID]
+	if !ok {
+		return
+	}
+	delete(c.invocations, msg.InvocationID)
+
+	now := time.Now()
+	stats.PushIfNotDone(c.ctx, c.state.Samples, stats.Sample{
+		Metric: metrics.SignalRInvocationDuration,
+		Time:   now,
+		Tags:   c.sampleTags(inv.target),
+		Value:  stats.D(now.Sub(inv.sent)),
+	})
+
+	rt := common.GetRuntime(c.ctx)
+	var result interface{}
+	if len(msg.Result) > 0 {
+		_ = json.Unmarshal(msg.Result, &result)
+	}
+	c.complete(inv, msg.Error, rt.ToValue(result))
+}
+
+// complete calls the callback or the stream subscriber of the invocation.
+func (c *Connection) complete(inv *pendingInvocation, errMsg string, result goja.Value) {
+	rt := common.GetRuntime(c.ctx)
+	errV := goja.Null()
+	if errMsg != "" {
+		errV = rt.ToValue(errMsg)
+	}
+
+	switch {
+	case inv.stream != nil && errMsg != "":
+		if inv.stream.error != nil {
+			c.callHandlers([]goja.Callable{inv.stream.error}, errV)
+		}
+	case inv.stream != nil:
+		if inv.stream.complete != nil {
+			c.callHandlers([]goja.Callable{inv.stream.complete})
+		}
+	case inv.callback != nil:
+		c.callHandlers([]goja.Callable{inv.callback}, errV, result)
+	}
+}
+
+func (c *Connection) handleClose() {
+	wasConnected := c.Connected
+	c.Connected = false
+
+	// The invocations that are still pending will never complete
+	invocations := c.invocations
+	c.invocations = make(map[string]*pendingInvocation)
+	for _, inv := range invocations {
+		c.complete(inv, "Invocation canceled due to the underlying connection being closed.", goja.Undefined())
+	}
+
+	if !wasConnected {
+		return
+	}
+	closeErr := goja.Undefined()
+	if c.closeError != "" {
+		closeErr = common.GetRuntime(c.ctx).ToValue(c.closeError)
+	}
+	c.callHandlers(c.closeHandlers, closeErr)
+}
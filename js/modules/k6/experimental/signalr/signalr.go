@@ -0,0 +1,315 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package signalr implements the k6/experimental/signalr module, an ASP.NET
+// Core SignalR client that uses the JSON hub protocol over k6/ws.
+package signalr
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/internal/modules"
+	"github.com/loadimpact/k6/js/modules/k6/ws"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+func init() {
+	modules.Register("k6/experimental/signalr", New())
+}
+
+var errConnectInInitContext = common.NewInitContextError("using SignalR in the init context is not supported")
+
+// maxNegotiateRedirects limits how many times the negotiation can redirect the
+// client to another server, e.g. from the app server to Azure SignalR Service.
+const maxNegotiateRedirects = 100
+
+// SignalR is the k6/experimental/signalr module.
+type SignalR struct {
+	ws *ws.WS
+}
+
+// New returns a new k6/experimental/signalr module.
+func New() *SignalR {
+	return &SignalR{ws: ws.New()}
+}
+
+type connectParams struct {
+	headers         map[string]string
+	accessToken     string
+	tags            map[string]string
+	skipNegotiation bool
+	timeout         time.Duration
+}
+
+func parseConnectParams(rt *goja.Runtime, paramsV goja.Value) (connectParams, error) {
+	params := connectParams{
+		headers: make(map[string]string),
+		tags:    make(map[string]string),
+		timeout: 60 * time.Second,
+	}
+	if goja.IsUndefined(paramsV) || goja.IsNull(paramsV) {
+		return params, nil
+	}
+
+	obj := paramsV.ToObject(rt)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		switch k {
+		case "headers":
+			headersObj := v.ToObject(rt)
+			for _, key := range headersObj.Keys() {
+				params.headers[key] = headersObj.Get(key).String()
+			}
+		case "tags":
+			tagsObj := v.ToObject(rt)
+			for _, key := range tagsObj.Keys() {
+				params.tags[key] = tagsObj.Get(key).String()
+			}
+		case "accessToken":
+			params.accessToken = v.String()
+		case "skipNegotiation":
+			params.skipNegotiation = v.ToBoolean()
+		case "timeout":
+			var err error
+			if params.timeout, err = types.GetDurationValue(v.Export()); err != nil {
+				return params, fmt.Errorf("invalid timeout: %w", err)
+			}
+		default:
+			return params, fmt.Errorf("unknown SignalR connect param: %q", k)
+		}
+	}
+
+	return params, nil
+}
+
+type negotiateResponse struct {
+	ConnectionID        string `json:"connectionId"`
+	ConnectionToken     string `json:"connectionToken"`
+	NegotiateVersion    int    `json:"negotiateVersion"`
+	URL                 string `json:"url"`
+	AccessToken         string `json:"accessToken"`
+	Error               string `json:"error"`
+	AvailableTransports []struct {
+		Transport string `json:"transport"`
+	} `json:"availableTransports"`
+}
+
+// negotiate asks the server for a connection token, following any redirects,
+// and returns the WebSocket URL to connect to along with the access token.
+func negotiate(ctx context.Context, state *lib.State, hubURL string, params connectParams) (string, string, error) {
+	accessToken := params.accessToken
+	for i := 0; i < maxNegotiateRedirects; i++ {
+		u, err := url.Parse(hubURL)
+		if err != nil {
+			return "", "", err
+		}
+		negotiateURL := *u
+		negotiateURL.Path = strings.TrimSuffix(negotiateURL.Path, "/") + "/negotiate"
+		query := negotiateURL.Query()
+		query.Set("negotiateVersion", "1")
+		negotiateURL.RawQuery = query.Encode()
+
+		res, err := postNegotiate(ctx, state, negotiateURL.String(), accessToken, params)
+		if err != nil {
+			return "", "", err
+		}
+		if res.Error != "" {
+			return "", "", fmt.Errorf("SignalR negotiation failed: %s", res.Error)
+		}
+		if res.URL != "" {
+			// The server redirected the client to another one
+			hubURL, accessToken = res.URL, res.AccessToken
+			continue
+		}
+
+		supported := false
+		for _, t := range res.AvailableTransports {
+			supported = supported || t.Transport == "WebSockets"
+		}
+		if !supported {
+			return "", "", errors.New("the SignalR server doesn't support the WebSockets transport")
+		}
+
+		token := res.ConnectionToken
+		if res.NegotiateVersion == 0 {
+			token = res.ConnectionID
+		}
+		query = u.Query()
+		query.Set("id", token)
+		u.RawQuery = query.Encode()
+
+		return u.String(), accessToken, nil
+	}
+
+	return "", "", errors.New("too many SignalR negotiation redirects")
+}
+
+func postNegotiate(
+	ctx context.Context, state *lib.State, negotiateURL, accessToken string, params connectParams,
+) (*negotiateResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, params.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, negotiateURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range params.headers {
+		req.Header.Set(k, v)
+	}
+	if accessToken != "" {
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+	}
+	if ua := state.Options.UserAgent; ua.Valid {
+		req.Header.Set("User-Agent", ua.String)
+	}
+
+	resp, err := (&http.Client{Transport: state.Transport}).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("SignalR negotiation failed: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("reading the SignalR negotiation response failed: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SignalR negotiation failed with status %d", resp.StatusCode)
+	}
+
+	var res negotiateResponse
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, fmt.Errorf("invalid SignalR negotiation response: %w", err)
+	}
+
+	return &res, nil
+}
+
+// websocketURL returns the URL of the WebSocket transport of the hub.
+func websocketURL(hubURL, accessToken string) (string, error) {
+	u, err := url.Parse(hubURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported SignalR URL scheme %q", u.Scheme)
+	}
+	if accessToken != "" {
+		// Browsers can't set headers on WebSocket requests, so the servers
+		// expect the token in the query string
+		query := u.Query()
+		query.Set("access_token", accessToken)
+		u.RawQuery = query.Encode()
+	}
+
+	return u.String(), nil
+}
+
+// Connect negotiates a connection to the hub at the given URL, connects to it
+// with the WebSockets transport and runs the set up function with the
+// connection. Invocations made before the handshake completes are buffered.
+// The call returns once the connection is closed.
+func (s *SignalR) Connect(ctx context.Context, hubURL string, args ...goja.Value) (*ws.WSHTTPResponse, error) {
+	rt := common.GetRuntime(ctx)
+	state := lib.GetState(ctx)
+	if state == nil {
+		return nil, errConnectInInitContext
+	}
+
+	var callableV, paramsV goja.Value
+	switch len(args) {
+	case 2:
+		paramsV, callableV = args[0], args[1]
+	case 1:
+		paramsV, callableV = goja.Undefined(), args[0]
+	default:
+		return nil, errors.New("invalid number of arguments to signalr.connect")
+	}
+	setupFn, isFunc := goja.AssertFunction(callableV)
+	if !isFunc {
+		return nil, errors.New("last argument to signalr.connect must be a function")
+	}
+
+	params, err := parseConnectParams(rt, paramsV)
+	if err != nil {
+		return nil, err
+	}
+
+	accessToken := params.accessToken
+	if !params.skipNegotiation {
+		if hubURL, accessToken, err = negotiate(ctx, state, hubURL, params); err != nil {
+			return nil, err
+		}
+	}
+	wsURL, err := websocketURL(hubURL, accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := state.CloneTags()
+	for k, v := range params.tags {
+		tags[k] = v
+	}
+	if state.Options.SystemTags.Has(stats.TagURL) {
+		// without the connection token and access token, which are unique
+		if u, err := url.Parse(wsURL); err == nil {
+			u.RawQuery = ""
+			tags["url"] = u.String()
+		}
+	}
+
+	conn := newConnection(ctx, state, tags)
+	if _, err = setupFn(goja.Undefined(), rt.ToValue(conn)); err != nil {
+		return nil, err
+	}
+
+	wsParams := rt.NewObject()
+	_ = wsParams.Set("headers", params.headers)
+	_ = wsParams.Set("tags", params.tags)
+
+	return s.ws.Connect(ctx, wsURL, wsParams, rt.ToValue(func(call goja.FunctionCall) goja.Value {
+		wsSocket, ok := call.Argument(0).Export().(*ws.Socket)
+		if !ok {
+			common.Throw(rt, errors.New("unexpected WebSocket value"))
+		}
+		if err := conn.attach(wsSocket); err != nil {
+			common.Throw(rt, err)
+		}
+		return goja.Undefined()
+	}))
+}
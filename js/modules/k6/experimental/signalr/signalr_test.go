@@ -0,0 +1,238 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package signalr
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// newTestHub returns a minimal SignalR server with a hub at /hub.
+func newTestHub(t *testing.T) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hub/negotiate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.Header.Get("Authorization") != "Bearer tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_, _ = w.Write([]byte(`{"connectionId":"c","connectionToken":"t","negotiateVersion":1,` +
+			`"availableTransports":[{"transport":"WebSockets","transferFormats":["Text","Binary"]}]}`))
+	})
+	mux.HandleFunc("/hub", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("id") != "t" || r.URL.Query().Get("access_token") != "tok" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+
+		send := func(msgs ...interface{}) {
+			var data string
+			for _, msg := range msgs {
+				b, err := json.Marshal(msg)
+				require.NoError(t, err)
+				data += string(b) + recordSeparator
+			}
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(data))
+		}
+
+		_, handshake, err := conn.ReadMessage()
+		if err != nil || string(handshake) != `{"protocol":"json","version":1}`+recordSeparator {
+			return
+		}
+		send(map[string]interface{}{})
+
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			for _, record := range strings.Split(string(data), recordSeparator) {
+				if record == "" {
+					continue
+				}
+				var msg hubMessage
+				require.NoError(t, json.Unmarshal([]byte(record), &msg))
+				id := msg.InvocationID
+				switch msg.Target {
+				case "Add":
+					send(map[string]interface{}{
+						"type": 3, "invocationId": id,
+						"result": msg.Arguments[0].(float64) + msg.Arguments[1].(float64),
+					})
+				case "Echo":
+					send(map[string]interface{}{"type": 1, "target": "receiveMessage", "arguments": msg.Arguments})
+				case "Counter":
+					items := []interface{}{}
+					for i := 0; i < int(msg.Arguments[0].(float64)); i++ {
+						items = append(items, map[string]interface{}{"type": 2, "invocationId": id, "item": i})
+					}
+					send(append(items, map[string]interface{}{"type": 3, "invocationId": id})...)
+				case "Fail":
+					send(map[string]interface{}{"type": 3, "invocationId": id, "error": "boom"})
+				case "Quit":
+					send(map[string]interface{}{"type": 7, "error": "bye"})
+				}
+			}
+		}
+	})
+
+	return httptest.NewServer(mux)
+}
+
+func newTestRuntime(t *testing.T) (*goja.Runtime, chan stats.SampleContainer) {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{
+		Group:     root,
+		Dialer:    &net.Dialer{},
+		Transport: http.DefaultTransport,
+		Options: lib.Options{
+			SystemTags: stats.NewSystemTagSet(stats.TagURL, stats.TagStatus),
+		},
+		Samples: samples,
+	}
+
+	ctx := lib.WithState(context.Background(), state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("signalr", common.Bind(rt, New(), &ctx))
+
+	return rt, samples
+}
+
+func TestWebsocketURL(t *testing.T) {
+	t.Parallel()
+
+	u, err := websocketURL("https://example.com/hub?id=t", "tok")
+	require.NoError(t, err)
+	assert.Equal(t, "wss://example.com/hub?access_token=tok&id=t", u)
+
+	u, err = websocketURL("http://example.com/hub", "")
+	require.NoError(t, err)
+	assert.Equal(t, "ws://example.com/hub", u)
+
+	_, err = websocketURL("ftp://example.com/hub", "")
+	assert.Error(t, err)
+}
+
+func TestSignalR(t *testing.T) {
+	t.Parallel()
+
+	srv := newTestHub(t)
+	defer srv.Close()
+
+	t.Run("hub", func(t *testing.T) {
+		rt, samples := newTestRuntime(t)
+		rt.Set("url", srv.URL)
+		_, err := rt.RunString(`
+		var events = [];
+		signalr.connect(url + "/hub", { accessToken: "tok" }, function(conn) {
+			conn.onOpen(function() {
+				events.push("open:" + conn.connected);
+			});
+			conn.onClose(function(err) {
+				events.push("close:" + err);
+			});
+			// invoked before the handshake completes, so it's buffered
+			conn.invoke("Add", 1, 2, function(err, result) {
+				events.push("add:" + err + ":" + result);
+				conn.send("Echo", "k6", "hi");
+			});
+			conn.on("ReceiveMessage", function(user, msg) {
+				events.push("msg:" + user + ":" + msg);
+				conn.stream("Counter", [3], {
+					next: function(item) {
+						events.push("item:" + item);
+					},
+					complete: function() {
+						events.push("complete");
+						conn.invoke("Fail", function(err) {
+							events.push("fail:" + err);
+							conn.invoke("Quit");
+						});
+					},
+				});
+			});
+		});
+		var expected = "open:true,add:null:3,msg:k6:hi,item:0,item:1,item:2,complete,fail:boom,close:bye";
+		if (events.join() !== expected) {
+			throw new Error("unexpected events: " + events.join());
+		}
+		`)
+		require.NoError(t, err)
+
+		targets := map[string]int{}
+		items := 0
+		for _, container := range stats.GetBufferedSamples(samples) {
+			for _, sample := range container.GetSamples() {
+				target, _ := sample.Tags.Get("target")
+				switch sample.Metric {
+				case metrics.SignalRInvocationDuration:
+					targets[target]++
+					surl, _ := sample.Tags.Get("url")
+					assert.Equal(t, "ws"+strings.TrimPrefix(srv.URL, "http")+"/hub", surl)
+				case metrics.SignalRStreamItems:
+					items++
+				}
+			}
+		}
+		assert.Equal(t, map[string]int{"Add": 1, "Counter": 1, "Fail": 1}, targets)
+		assert.Equal(t, 3, items)
+	})
+
+	t.Run("negotiation failure", func(t *testing.T) {
+		rt, _ := newTestRuntime(t)
+		rt.Set("url", srv.URL)
+		_, err := rt.RunString(`signalr.connect(url + "/hub", function(conn) {})`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "SignalR negotiation failed with status 401")
+	})
+
+	t.Run("unknown param", func(t *testing.T) {
+		rt, _ := newTestRuntime(t)
+		_, err := rt.RunString(`signalr.connect("http://localhost/hub", { foo: "bar" }, function() {})`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown SignalR connect param: "foo"`)
+	})
+}
@@ -0,0 +1,501 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/modules/k6/ws"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// Engine.IO packet types
+const (
+	engineOpen    = '0'
+	engineClose   = '1'
+	enginePing    = '2'
+	enginePong    = '3'
+	engineMessage = '4'
+)
+
+// Socket.IO packet types
+const (
+	packetConnect      = '0'
+	packetDisconnect   = '1'
+	packetEvent        = '2'
+	packetAck          = '3'
+	packetConnectError = '4'
+	packetBinaryEvent  = '5'
+	packetBinaryAck    = '6'
+)
+
+// The disconnect reasons, the same as the ones of the JavaScript client
+const (
+	reasonServerDisconnect = "io server disconnect"
+	reasonClientDisconnect = "io client disconnect"
+	reasonPingTimeout      = "ping timeout"
+	reasonTransportClose   = "transport close"
+
+	// not a reason of the JavaScript client, the server rejected the connection
+	reasonConnectError = "connect error"
+)
+
+type pendingAck struct {
+	event string
+	fn    goja.Callable
+	sent  time.Time
+}
+
+// Socket is a Socket.IO socket, connected to a single namespace. It outlives
+// the WebSocket connections it's reconnected with.
+type Socket struct {
+	ID        string `js:"id"`
+	Connected bool   `js:"connected"`
+
+	ctx    context.Context
+	state  *lib.State
+	params connectParams
+	tags   map[string]string
+
+	ws            *ws.Socket
+	eventHandlers map[string][]goja.Callable
+	sendBuffer    []string
+	pendingTimers []func(*ws.Socket) error
+	acks          map[int64]pendingAck
+	ackCounter    int64
+
+	closed       bool
+	closeReason  string
+	pingInterval time.Duration
+	pingTimeout  time.Duration
+	lastPing     time.Time
+}
+
+func newSocket(ctx context.Context, state *lib.State, params connectParams, tags map[string]string) *Socket {
+	return &Socket{
+		ctx:           ctx,
+		state:         state,
+		params:        params,
+		tags:          tags,
+		eventHandlers: make(map[string][]goja.Callable),
+		acks:          make(map[int64]pendingAck),
+	}
+}
+
+// attach starts using a newly established WebSocket connection, whose events
+// drive the Engine.IO protocol.
+func (s *Socket) attach(wsSocket *ws.Socket) error {
+	rt := common.GetRuntime(s.ctx)
+	s.ws = wsSocket
+	s.closeReason = ""
+
+	wsSocket.On("message", rt.ToValue(s.handleEnginePacket))
+	wsSocket.On("close", rt.ToValue(func(int) { s.handleClose() }))
+	wsSocket.On("error", rt.ToValue(func(err goja.Value) {
+		s.handleEvent("error", err)
+	}))
+
+	timers := s.pendingTimers
+	s.pendingTimers = nil
+	for _, timer := range timers {
+		if err := timer(wsSocket); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// shouldReconnect reports whether the connection was lost, as opposed to
+// being closed on purpose by the script or the server.
+func (s *Socket) shouldReconnect() bool {
+	if !s.params.reconnection || s.closed || s.ctx.Err() != nil {
+		return false
+	}
+	switch s.closeReason {
+	case reasonServerDisconnect, reasonClientDisconnect, reasonConnectError:
+		return false
+	default:
+		return true
+	}
+}
+
+func (s *Socket) sampleTags(event string) *stats.SampleTags {
+	tags := make(map[string]string, len(s.tags)+1)
+	for k, v := range s.tags {
+		tags[k] = v
+	}
+	if event != "" {
+		tags["event"] = event
+	}
+
+	return stats.IntoSampleTags(&tags)
+}
+
+// On registers a handler for the given event. Besides the events emitted by
+// the server, the socket emits connect, disconnect, connect_error, error and
+// reconnect_attempt.
+func (s *Socket) On(event string, handler goja.Value) {
+	if handler, ok := goja.AssertFunction(handler); ok {
+		s.eventHandlers[event] = append(s.eventHandlers[event], handler)
+	}
+}
+
+func (s *Socket) handleEvent(event string, args ...goja.Value) {
+	for _, handler := range s.eventHandlers[event] {
+		if _, err := handler(goja.Undefined(), args...); err != nil {
+			common.Throw(common.GetRuntime(s.ctx), err)
+		}
+	}
+}
+
+// Emit sends an event with the given arguments to the server. If the last
+// argument is a function, it's called with the arguments of the server's
+// acknowledgement.
+func (s *Socket) Emit(event string, args ...goja.Value) error {
+	var ack goja.Callable
+	if len(args) > 0 {
+		if fn, ok := goja.AssertFunction(args[len(args)-1]); ok {
+			ack = fn
+			args = args[:len(args)-1]
+		}
+	}
+
+	data := make([]interface{}, 0, len(args)+1)
+	data = append(data, event)
+	for _, arg := range args {
+		data = append(data, arg.Export())
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("couldn't serialize the arguments of event %q: %w", event, err)
+	}
+
+	var ackID string
+	if ack != nil {
+		id := s.ackCounter
+		s.ackCounter++
+		s.acks[id] = pendingAck{event: event, fn: ack, sent: time.Now()}
+		ackID = strconv.FormatInt(id, 10)
+	}
+
+	s.send(string(packetEvent) + s.namespacePrefix() + ackID + string(payload))
+	stats.PushIfNotDone(s.ctx, s.state.Samples, stats.Sample{
+		Metric: metrics.SocketIOEventsSent,
+		Time:   time.Now(),
+		Tags:   s.sampleTags(event),
+		Value:  1,
+	})
+
+	return nil
+}
+
+// SetTimeout calls the function after the timeout in ms, as with the
+// WebSockets of k6/ws. Timers are bound to the current connection; the ones
+// set before the socket is connected start when it connects.
+func (s *Socket) SetTimeout(fn goja.Callable, timeoutMs float64) error {
+	if timeoutMs <= 0 {
+		return fmt.Errorf("setTimeout requires a >0 timeout parameter, received %.2f", timeoutMs)
+	}
+	if s.ws == nil {
+		s.pendingTimers = append(s.pendingTimers, func(wsSocket *ws.Socket) error {
+			return wsSocket.SetTimeout(fn, timeoutMs)
+		})
+		return nil
+	}
+
+	return s.ws.SetTimeout(fn, timeoutMs)
+}
+
+// SetInterval calls the function every interval in ms, see SetTimeout.
+func (s *Socket) SetInterval(fn goja.Callable, intervalMs float64) error {
+	if intervalMs <= 0 {
+		return fmt.Errorf("setInterval requires a >0 timeout parameter, received %.2f", intervalMs)
+	}
+	if s.ws == nil {
+		s.pendingTimers = append(s.pendingTimers, func(wsSocket *ws.Socket) error {
+			return wsSocket.SetInterval(fn, intervalMs)
+		})
+		return nil
+	}
+
+	return s.ws.SetInterval(fn, intervalMs)
+}
+
+// Close disconnects the socket from the namespace and closes the connection,
+// without reconnecting.
+func (s *Socket) Close() {
+	if s.closed {
+		return
+	}
+	s.closed = true
+	s.closeReason = reasonClientDisconnect
+	if s.ws == nil {
+		return
+	}
+	if s.Connected {
+		s.ws.Send(string(engineMessage) + string(packetDisconnect) + s.namespacePrefix())
+	}
+	s.ws.Close()
+}
+
+func (s *Socket) namespacePrefix() string {
+	if s.params.namespace == "/" {
+		return ""
+	}
+	return s.params.namespace + ","
+}
+
+// send sends the Socket.IO packet, or buffers it until the socket is connected
+func (s *Socket) send(packet string) {
+	if !s.Connected {
+		s.sendBuffer = append(s.sendBuffer, packet)
+		return
+	}
+	s.ws.Send(string(engineMessage) + packet)
+}
+
+func (s *Socket) handleClose() {
+	if s.closeReason == "" {
+		s.closeReason = reasonTransportClose
+	}
+	if !s.Connected {
+		return
+	}
+	s.Connected = false
+	// The acknowledgements of the lost connection will never arrive
+	s.acks = make(map[int64]pendingAck)
+	s.handleEvent("disconnect", common.GetRuntime(s.ctx).ToValue(s.closeReason))
+}
+
+func (s *Socket) handleEnginePacket(msg string) {
+	if msg == "" {
+		return
+	}
+	switch msg[0] {
+	case engineOpen:
+		s.handleOpen(msg[1:])
+	case enginePing:
+		s.lastPing = time.Now()
+		s.ws.Send(string(enginePong))
+	case engineClose:
+		s.ws.Close()
+	case engineMessage:
+		s.handlePacket(msg[1:])
+	}
+}
+
+// handleOpen handles the Engine.IO handshake and connects to the namespace.
+func (s *Socket) handleOpen(data string) {
+	var handshake struct {
+		PingInterval int64 `json:"pingInterval"`
+		PingTimeout  int64 `json:"pingTimeout"`
+	}
+	if err := json.Unmarshal([]byte(data), &handshake); err != nil {
+		s.handleEvent("error", common.GetRuntime(s.ctx).ToValue(fmt.Sprintf("invalid Engine.IO handshake: %s", err)))
+		return
+	}
+	s.pingInterval = time.Duration(handshake.PingInterval) * time.Millisecond
+	s.pingTimeout = time.Duration(handshake.PingTimeout) * time.Millisecond
+	s.lastPing = time.Now()
+
+	if s.pingInterval > 0 {
+		rt := common.GetRuntime(s.ctx)
+		checkPing, _ := goja.AssertFunction(rt.ToValue(s.checkPing))
+		if err := s.ws.SetInterval(checkPing, float64(s.pingInterval/time.Millisecond)); err != nil {
+			common.Throw(rt, err)
+		}
+	}
+
+	packet := string(engineMessage) + string(packetConnect) + s.namespacePrefix()
+	if s.params.auth != nil {
+		auth, err := json.Marshal(s.params.auth)
+		if err != nil {
+			common.Throw(common.GetRuntime(s.ctx), fmt.Errorf("couldn't serialize the auth payload: %w", err))
+		}
+		packet += string(auth)
+	}
+	s.ws.Send(packet)
+}
+
+// checkPing closes the connection if the server stopped sending pings
+func (s *Socket) checkPing() {
+	if time.Since(s.lastPing) > s.pingInterval+s.pingTimeout {
+		s.closeReason = reasonPingTimeout
+		s.ws.Close()
+	}
+}
+
+// handlePacket handles a Socket.IO packet, which is formatted as
+// <type>[<namespace>,][<ack id>][<JSON data>]
+func (s *Socket) handlePacket(packet string) {
+	if packet == "" {
+		return
+	}
+	rt := common.GetRuntime(s.ctx)
+	packetType, rest := packet[0], packet[1:]
+
+	if packetType == packetBinaryEvent || packetType == packetBinaryAck {
+		s.handleEvent("error", rt.ToValue("binary Socket.IO packets are not supported"))
+		return
+	}
+
+	namespace := "/"
+	if strings.HasPrefix(rest, "/") {
+		i := strings.IndexByte(rest, ',')
+		if i < 0 {
+			namespace, rest = rest, ""
+		} else {
+			namespace, rest = rest[:i], rest[i+1:]
+		}
+	}
+	if namespace != s.params.namespace {
+		return
+	}
+
+	i := 0
+	for i < len(rest) && rest[i] >= '0' && rest[i] <= '9' {
+		i++
+	}
+	var ackID int64 = -1
+	if i > 0 {
+		ackID, _ = strconv.ParseInt(rest[:i], 10, 64)
+	}
+	data := rest[i:]
+
+	switch packetType {
+	case packetConnect:
+		s.handleConnect(data)
+	case packetDisconnect:
+		s.closeReason = reasonServerDisconnect
+		s.ws.Close()
+	case packetConnectError:
+		s.closeReason = reasonConnectError
+		var errData interface{}
+		_ = json.Unmarshal([]byte(data), &errData)
+		s.handleEvent("connect_error", rt.ToValue(errData))
+		s.ws.Close()
+	case packetEvent:
+		s.handleServerEvent(data, ackID)
+	case packetAck:
+		s.handleAck(data, ackID)
+	}
+}
+
+func (s *Socket) handleConnect(data string) {
+	var connect struct {
+		SID string `json:"sid"`
+	}
+	_ = json.Unmarshal([]byte(data), &connect)
+	s.ID = connect.SID
+	s.Connected = true
+
+	buffered := s.sendBuffer
+	s.sendBuffer = nil
+	for _, packet := range buffered {
+		s.ws.Send(string(engineMessage) + packet)
+	}
+
+	s.handleEvent("connect")
+}
+
+func (s *Socket) handleServerEvent(data string, ackID int64) {
+	rt := common.GetRuntime(s.ctx)
+	var eventData []interface{}
+	if err := json.Unmarshal([]byte(data), &eventData); err != nil || len(eventData) == 0 {
+		s.handleEvent("error", rt.ToValue(fmt.Sprintf("invalid Socket.IO event: %q", data)))
+		return
+	}
+	event, ok := eventData[0].(string)
+	if !ok {
+		s.handleEvent("error", rt.ToValue(fmt.Sprintf("invalid Socket.IO event name: %v", eventData[0])))
+		return
+	}
+
+	stats.PushIfNotDone(s.ctx, s.state.Samples, stats.Sample{
+		Metric: metrics.SocketIOEventsReceived,
+		Time:   time.Now(),
+		Tags:   s.sampleTags(event),
+		Value:  1,
+	})
+
+	args := make([]goja.Value, 0, len(eventData))
+	for _, arg := range eventData[1:] {
+		args = append(args, rt.ToValue(arg))
+	}
+	if ackID >= 0 {
+		args = append(args, rt.ToValue(func(call goja.FunctionCall) goja.Value {
+			ackData := make([]interface{}, 0, len(call.Arguments))
+			for _, arg := range call.Arguments {
+				ackData = append(ackData, arg.Export())
+			}
+			payload, err := json.Marshal(ackData)
+			if err != nil {
+				common.Throw(rt, fmt.Errorf("couldn't serialize the acknowledgement of event %q: %w", event, err))
+			}
+			s.send(string(packetAck) + s.namespacePrefix() + strconv.FormatInt(ackID, 10) + string(payload))
+			return goja.Undefined()
+		}))
+	}
+
+	s.handleEvent(event, args...)
+}
+
+func (s *Socket) handleAck(data string, ackID int64) {
+	ack, ok := s.acks[ackID]
+	if !ok {
+		return
+	}
+	delete(s.acks, ackID)
+
+	now := time.Now()
+	stats.PushIfNotDone(s.ctx, s.state.Samples, stats.Sample{
+		Metric: metrics.SocketIOAckDuration,
+		Time:   now,
+		Tags:   s.sampleTags(ack.event),
+		Value:  stats.D(now.Sub(ack.sent)),
+	})
+
+	rt := common.GetRuntime(s.ctx)
+	var ackData []interface{}
+	if err := json.Unmarshal([]byte(data), &ackData); err != nil {
+		s.handleEvent("error", rt.ToValue(errors.New("invalid Socket.IO acknowledgement")))
+		return
+	}
+	args := make([]goja.Value, len(ackData))
+	for i, arg := range ackData {
+		args[i] = rt.ToValue(arg)
+	}
+	if _, err := ack.fn(goja.Undefined(), args...); err != nil {
+		common.Throw(rt, err)
+	}
+}
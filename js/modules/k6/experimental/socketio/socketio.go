@@ -0,0 +1,262 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package socketio implements the k6/experimental/socketio module, a Socket.IO
+// client that runs the Engine.IO and Socket.IO protocols on top of k6/ws.
+package socketio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/internal/modules"
+	"github.com/loadimpact/k6/js/modules/k6/ws"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+func init() {
+	modules.Register("k6/experimental/socketio", New())
+}
+
+var errConnectInInitContext = common.NewInitContextError("using Socket.IO in the init context is not supported")
+
+// SocketIO is the k6/experimental/socketio module.
+type SocketIO struct {
+	ws *ws.WS
+}
+
+// New returns a new k6/experimental/socketio module.
+func New() *SocketIO {
+	return &SocketIO{ws: ws.New()}
+}
+
+type connectParams struct {
+	path                 string
+	namespace            string
+	query                map[string]string
+	auth                 interface{}
+	headers              goja.Value
+	tags                 map[string]string
+	reconnection         bool
+	reconnectionAttempts int64
+	reconnectionDelay    time.Duration
+}
+
+func parseConnectParams(rt *goja.Runtime, paramsV goja.Value) (connectParams, error) {
+	params := connectParams{
+		path:                 "/socket.io/",
+		namespace:            "/",
+		query:                make(map[string]string),
+		tags:                 make(map[string]string),
+		reconnection:         true,
+		reconnectionAttempts: 5,
+		reconnectionDelay:    time.Second,
+	}
+	if goja.IsUndefined(paramsV) || goja.IsNull(paramsV) {
+		return params, nil
+	}
+
+	obj := paramsV.ToObject(rt)
+	for _, k := range obj.Keys() {
+		v := obj.Get(k)
+		switch k {
+		case "path":
+			params.path = v.String()
+		case "namespace":
+			params.namespace = v.String()
+			if !strings.HasPrefix(params.namespace, "/") {
+				return params, fmt.Errorf("invalid namespace %q, it must start with /", params.namespace)
+			}
+		case "query":
+			queryObj := v.ToObject(rt)
+			for _, key := range queryObj.Keys() {
+				params.query[key] = queryObj.Get(key).String()
+			}
+		case "auth":
+			params.auth = v.Export()
+		case "headers":
+			params.headers = v
+		case "tags":
+			tagsObj := v.ToObject(rt)
+			for _, key := range tagsObj.Keys() {
+				params.tags[key] = tagsObj.Get(key).String()
+			}
+		case "reconnection":
+			params.reconnection = v.ToBoolean()
+		case "reconnectionAttempts":
+			params.reconnectionAttempts = v.ToInteger()
+			if params.reconnectionAttempts < 0 {
+				return params, errors.New("reconnectionAttempts can't be negative")
+			}
+		case "reconnectionDelay":
+			var err error
+			if params.reconnectionDelay, err = types.GetDurationValue(v.Export()); err != nil {
+				return params, fmt.Errorf("invalid reconnectionDelay: %w", err)
+			}
+		default:
+			return params, fmt.Errorf("unknown Socket.IO connect param: %q", k)
+		}
+	}
+
+	return params, nil
+}
+
+// engineURL returns the WebSocket URL of the Engine.IO endpoint of the server.
+func engineURL(rawURL string, params connectParams) (string, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+	switch u.Scheme {
+	case "http", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported Socket.IO URL scheme %q", u.Scheme)
+	}
+	u.Path = params.path
+
+	query := u.Query()
+	for k, v := range params.query {
+		query.Set(k, v)
+	}
+	query.Set("EIO", "4")
+	query.Set("transport", "websocket")
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+// Connect connects to the Socket.IO server at the given URL (e.g.
+// https://example.com) and runs the set up function with the socket, before
+// the connection is established. Any events emitted until then are buffered.
+// The call returns once the socket is closed; if the connection is lost, the
+// socket reconnects, unless the server or the script disconnected it.
+//nolint: funlen
+func (sio *SocketIO) Connect(ctx context.Context, rawURL string, args ...goja.Value) (*ws.WSHTTPResponse, error) {
+	rt := common.GetRuntime(ctx)
+	state := lib.GetState(ctx)
+	if state == nil {
+		return nil, errConnectInInitContext
+	}
+
+	var callableV, paramsV goja.Value
+	switch len(args) {
+	case 2:
+		paramsV, callableV = args[0], args[1]
+	case 1:
+		paramsV, callableV = goja.Undefined(), args[0]
+	default:
+		return nil, errors.New("invalid number of arguments to socketio.connect")
+	}
+	setupFn, isFunc := goja.AssertFunction(callableV)
+	if !isFunc {
+		return nil, errors.New("last argument to socketio.connect must be a function")
+	}
+
+	params, err := parseConnectParams(rt, paramsV)
+	if err != nil {
+		return nil, err
+	}
+	wsURL, err := engineURL(rawURL, params)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := state.CloneTags()
+	for k, v := range params.tags {
+		tags[k] = v
+	}
+	if state.Options.SystemTags.Has(stats.TagURL) {
+		tags["url"] = wsURL
+	}
+
+	socket := newSocket(ctx, state, params, tags)
+	if _, err = setupFn(goja.Undefined(), rt.ToValue(socket)); err != nil {
+		return nil, err
+	}
+
+	wsParams := rt.NewObject()
+	if params.headers != nil {
+		_ = wsParams.Set("headers", params.headers)
+	}
+	_ = wsParams.Set("tags", params.tags)
+
+	var res, lastRes *ws.WSHTTPResponse
+	for attempt := int64(1); ; attempt++ {
+		var connected bool
+		res, err = sio.ws.Connect(ctx, wsURL, wsParams, rt.ToValue(func(call goja.FunctionCall) goja.Value {
+			connected = true
+			wsSocket, ok := call.Argument(0).Export().(*ws.Socket)
+			if !ok {
+				common.Throw(rt, errors.New("unexpected WebSocket value"))
+			}
+			if err := socket.attach(wsSocket); err != nil {
+				common.Throw(rt, err)
+			}
+			return goja.Undefined()
+		}))
+		if res != nil {
+			lastRes = res
+		}
+		if err != nil {
+			if connected {
+				// The error came from the script, e.g. an event handler threw
+				return nil, err
+			}
+			socket.closeReason = "transport error"
+			socket.handleEvent("connect_error", rt.ToValue(err.Error()))
+		}
+
+		if !socket.shouldReconnect() || attempt > params.reconnectionAttempts {
+			break
+		}
+		select {
+		case <-time.After(params.reconnectionDelay):
+		case <-ctx.Done():
+			return lastRes, nil
+		}
+
+		stats.PushIfNotDone(ctx, state.Samples, stats.Sample{
+			Metric: metrics.SocketIOReconnects,
+			Time:   time.Now(),
+			Tags:   socket.sampleTags(""),
+			Value:  1,
+		})
+		socket.handleEvent("reconnect_attempt", rt.ToValue(attempt))
+	}
+
+	if lastRes == nil {
+		return nil, err
+	}
+
+	return lastRes, nil
+}
@@ -0,0 +1,293 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package socketio
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// newTestServer returns a minimal Socket.IO server with a /chat namespace.
+// The connections to it are counted, and the first one is dropped when the
+// client emits a "drop" event.
+func newTestServer(t *testing.T, connections *int64) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/socket.io/" || r.URL.Query().Get("EIO") != "4" || r.URL.Query().Get("token") != "abc" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		n := atomic.AddInt64(connections, 1)
+
+		send := func(msg string) { _ = conn.WriteMessage(websocket.TextMessage, []byte(msg)) }
+		send(`0{"sid":"engine","upgrades":[],"pingInterval":10000,"pingTimeout":5000,"maxPayload":100000}`)
+		send("2")
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			msg := string(data)
+			switch {
+			case msg == "3":
+			case strings.HasPrefix(msg, "40/chat,"):
+				if msg != `40/chat,{"user":"k6"}` {
+					send(`44/chat,{"message":"unauthorized"}`)
+					continue
+				}
+				send(`40/chat,{"sid":"socket` + string(rune('0'+n)) + `"}`)
+			case strings.HasPrefix(msg, "42/chat,"):
+				payload := strings.TrimPrefix(msg, "42/chat,")
+				i := strings.IndexByte(payload, '[')
+				ackID, payload := payload[:i], payload[i:]
+				var event []interface{}
+				require.NoError(t, json.Unmarshal([]byte(payload), &event))
+				switch event[0] {
+				case "drop":
+					if n == 1 {
+						return
+					}
+				case "bye":
+					send("41/chat,")
+				case "ask":
+					send(`42/chat,7["question","why?"]`)
+				default:
+					if ackID != "" {
+						args, _ := json.Marshal(event[1:])
+						send("43/chat," + ackID + string(args))
+					}
+					send(`42/chat,["echoed",` + string(mustMarshal(t, event[1])) + `]`)
+				}
+			case strings.HasPrefix(msg, "43/chat,7"):
+				send(`42/chat,["answered",` + strings.TrimPrefix(msg, "43/chat,7") + `]`)
+			case msg == "41/chat,":
+				return
+			}
+		}
+	}))
+}
+
+func mustMarshal(t *testing.T, v interface{}) []byte {
+	b, err := json.Marshal(v)
+	require.NoError(t, err)
+	return b
+}
+
+func newTestRuntime(t *testing.T) (*goja.Runtime, chan stats.SampleContainer) {
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{
+		Group:  root,
+		Dialer: &net.Dialer{},
+		Options: lib.Options{
+			SystemTags: stats.NewSystemTagSet(stats.TagURL, stats.TagStatus),
+		},
+		Samples: samples,
+	}
+
+	ctx := lib.WithState(context.Background(), state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("socketio", common.Bind(rt, New(), &ctx))
+
+	return rt, samples
+}
+
+func countSamples(containers []stats.SampleContainer, metric *stats.Metric, event string) int {
+	count := 0
+	for _, container := range containers {
+		for _, sample := range container.GetSamples() {
+			if e, _ := sample.Tags.Get("event"); sample.Metric == metric && e == event {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestEngineURL(t *testing.T) {
+	t.Parallel()
+
+	params := connectParams{path: "/socket.io/", query: map[string]string{"token": "abc"}}
+	u, err := engineURL("https://example.com/ignored?foo=bar", params)
+	require.NoError(t, err)
+	assert.Equal(t, "wss://example.com/socket.io/?EIO=4&foo=bar&token=abc&transport=websocket", u)
+
+	u, err = engineURL("ws://example.com", params)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(u, "ws://example.com/socket.io/?"))
+
+	_, err = engineURL("ftp://example.com", params)
+	assert.Error(t, err)
+}
+
+func TestSocketIO(t *testing.T) {
+	t.Parallel()
+
+	var connections int64
+	srv := newTestServer(t, &connections)
+	defer srv.Close()
+
+	t.Run("events and acks", func(t *testing.T) {
+		rt, samples := newTestRuntime(t)
+		rt.Set("url", srv.URL)
+		_, err := rt.RunString(`
+		var events = [];
+		socketio.connect(url, { namespace: "/chat", auth: { user: "k6" }, query: { token: "abc" } }, function(socket) {
+			// emitted before the socket is connected, so it's buffered
+			socket.emit("hello", "world", function(reply) {
+				events.push("ack:" + reply);
+			});
+			socket.on("connect", function() {
+				events.push("connect:" + socket.id + ":" + socket.connected);
+				socket.emit("ask");
+			});
+			socket.on("question", function(question, ack) {
+				ack("because");
+			});
+			socket.on("echoed", function(msg) {
+				events.push("echoed:" + msg);
+			});
+			socket.on("answered", function(answer) {
+				events.push("answered:" + answer);
+				socket.close();
+			});
+			socket.on("disconnect", function(reason) {
+				events.push("disconnect:" + reason);
+			});
+		});
+		if (events.join() !== "connect:socket1:true,ack:world,echoed:world,answered:because,disconnect:io client disconnect") {
+			throw new Error("unexpected events: " + events.join());
+		}
+		`)
+		require.NoError(t, err)
+
+		bufSamples := stats.GetBufferedSamples(samples)
+		assert.Equal(t, 1, countSamples(bufSamples, metrics.SocketIOEventsSent, "hello"))
+		assert.Equal(t, 1, countSamples(bufSamples, metrics.SocketIOEventsReceived, "echoed"))
+		assert.Equal(t, 1, countSamples(bufSamples, metrics.SocketIOAckDuration, "hello"))
+	})
+
+	t.Run("connect error", func(t *testing.T) {
+		rt, _ := newTestRuntime(t)
+		rt.Set("url", srv.URL)
+		_, err := rt.RunString(`
+		var errors = [];
+		socketio.connect(url, { namespace: "/chat", query: { token: "abc" } }, function(socket) {
+			socket.on("connect_error", function(err) {
+				errors.push(err.message);
+			});
+		});
+		if (errors.join() !== "unauthorized") {
+			throw new Error("unexpected errors: " + errors.join());
+		}
+		`)
+		require.NoError(t, err)
+	})
+
+	t.Run("server disconnect", func(t *testing.T) {
+		rt, _ := newTestRuntime(t)
+		rt.Set("url", srv.URL)
+		_, err := rt.RunString(`
+		var reasons = [];
+		socketio.connect(url, { namespace: "/chat", auth: { user: "k6" }, query: { token: "abc" } }, function(socket) {
+			socket.on("connect", function() {
+				socket.emit("bye");
+			});
+			socket.on("disconnect", function(reason) {
+				reasons.push(reason);
+			});
+		});
+		if (reasons.join() !== "io server disconnect") {
+			throw new Error("unexpected reasons: " + reasons.join());
+		}
+		`)
+		require.NoError(t, err)
+	})
+
+	t.Run("unknown param", func(t *testing.T) {
+		rt, _ := newTestRuntime(t)
+		_, err := rt.RunString(`socketio.connect("http://localhost", { foo: "bar" }, function() {})`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown Socket.IO connect param: "foo"`)
+	})
+}
+
+func TestSocketIOReconnect(t *testing.T) {
+	t.Parallel()
+
+	var connections int64
+	srv := newTestServer(t, &connections)
+	defer srv.Close()
+
+	rt, samples := newTestRuntime(t)
+	rt.Set("url", srv.URL)
+	_, err := rt.RunString(`
+	var events = [];
+	socketio.connect(url, {
+		namespace: "/chat", auth: { user: "k6" }, query: { token: "abc" }, reconnectionDelay: "10ms",
+	}, function(socket) {
+		socket.on("connect", function() {
+			events.push("connect:" + socket.id);
+			socket.emit("drop");
+			if (socket.id === "socket2") {
+				socket.close();
+			}
+		});
+		socket.on("disconnect", function(reason) {
+			events.push("disconnect:" + reason);
+		});
+		socket.on("reconnect_attempt", function(attempt) {
+			events.push("reconnect_attempt:" + attempt);
+		});
+	});
+	if (events.join() !== "connect:socket1,disconnect:transport close,reconnect_attempt:1,connect:socket2,disconnect:io client disconnect") {
+		throw new Error("unexpected events: " + events.join());
+	}
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), atomic.LoadInt64(&connections))
+	assert.Equal(t, 1, countSamples(stats.GetBufferedSamples(samples), metrics.SocketIOReconnects, ""))
+}
@@ -0,0 +1,154 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package vu implements the k6/experimental/vu module, with a key/value
+// storage that each VU keeps across its iterations and scenarios.
+package vu
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/dop251/goja"
+
+	"github.com/loadimpact/k6/js/internal/modules"
+)
+
+func init() {
+	modules.Register("k6/experimental/vu", new(RootModule))
+}
+
+// defaultStorageLimit is how many bytes of keys and JSON-serialized values a
+// VU can store, unless the script changes it with storage.setLimit().
+const defaultStorageLimit = 10 * 1024 * 1024
+
+// RootModule is the global k6/experimental/vu module, which gives every VU
+// its own instance.
+type RootModule struct{}
+
+var _ modules.HasModuleInstancePerVU = new(RootModule)
+
+// NewModuleInstancePerVU returns a VU instance with an empty storage.
+func (*RootModule) NewModuleInstancePerVU() interface{} {
+	return &VU{Storage: &Storage{values: make(map[string][]byte), limit: defaultStorageLimit}}
+}
+
+// VU is the k6/experimental/vu module instance of a VU.
+type VU struct {
+	Storage *Storage `js:"storage"`
+}
+
+// Storage is a key/value store that a VU keeps for its whole lifetime, so it
+// survives between iterations, even when the VU moves to another scenario.
+// Values are stored as JSON, so what's read is always a copy of what was
+// stored. Note that setup() and teardown() run in VUs of their own.
+type Storage struct {
+	values map[string][]byte
+	size   int
+	limit  int
+}
+
+// Set stores a copy of the value under the key.
+func (s *Storage) Set(key string, value goja.Value) error {
+	if value == nil || goja.IsUndefined(value) {
+		return fmt.Errorf("can't store undefined under %q", key)
+	}
+	data, err := json.Marshal(value.Export())
+	if err != nil {
+		return fmt.Errorf("can't store the value under %q: %w", key, err)
+	}
+
+	size := s.size + len(key) + len(data)
+	if old, ok := s.values[key]; ok {
+		size -= len(key) + len(old)
+	}
+	if size > s.limit {
+		return fmt.Errorf("storing %q would make the VU storage %d bytes, over its limit of %d bytes",
+			key, size, s.limit)
+	}
+	s.values[key], s.size = data, size
+	return nil
+}
+
+// Get returns a copy of the value stored under the key, or null if there is
+// none.
+func (s *Storage) Get(key string) (interface{}, error) {
+	data, ok := s.values[key]
+	if !ok {
+		return nil, nil
+	}
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// Has returns whether there is a value stored under the key.
+func (s *Storage) Has(key string) bool {
+	_, ok := s.values[key]
+	return ok
+}
+
+// Delete removes the value stored under the key and reports whether there was
+// one.
+func (s *Storage) Delete(key string) bool {
+	data, ok := s.values[key]
+	if ok {
+		s.size -= len(key) + len(data)
+		delete(s.values, key)
+	}
+	return ok
+}
+
+// Keys returns the sorted keys of the stored values.
+func (s *Storage) Keys() []string {
+	keys := make([]string, 0, len(s.values))
+	for k := range s.values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Clear removes all stored values.
+func (s *Storage) Clear() {
+	s.values, s.size = make(map[string][]byte), 0
+}
+
+// Size returns how many bytes the stored keys and values take.
+func (s *Storage) Size() int {
+	return s.size
+}
+
+// SetLimit changes how many bytes the storage can take. It can't be lower
+// than the current size.
+func (s *Storage) SetLimit(limit int) error {
+	if limit < 1 {
+		return errors.New("the VU storage limit must be positive")
+	}
+	if limit < s.size {
+		return fmt.Errorf("the VU storage already takes %d bytes, more than %d", s.size, limit)
+	}
+	s.limit = limit
+	return nil
+}
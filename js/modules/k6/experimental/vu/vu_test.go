@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package vu
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js/common"
+)
+
+func newRuntime(t *testing.T) *goja.Runtime {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctx := common.WithRuntime(context.Background(), rt)
+	rt.Set("vu", common.Bind(rt, new(RootModule).NewModuleInstancePerVU(), &ctx))
+	return rt
+}
+
+func TestStorage(t *testing.T) {
+	t.Parallel()
+	rt := newRuntime(t)
+
+	v, err := rt.RunString(`
+	vu.storage.set("token", { value: "abc", expires: 10 });
+	var token = vu.storage.get("token");
+	token.value = "changed";
+	[vu.storage.get("token").value, vu.storage.has("token"), vu.storage.get("missing"), vu.storage.size()].join(",");
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "abc,true,,33", v.String())
+
+	v, err = rt.RunString(`
+	vu.storage.set("a", 1);
+	vu.storage.set("token", "x");
+	vu.storage.keys().join(",") + ":" + vu.storage.size() + ":" + vu.storage.delete("a") + ":" + vu.storage.delete("a");
+	`)
+	require.NoError(t, err)
+	assert.Equal(t, "a,token:10:true:false", v.String())
+
+	_, err = rt.RunString(`vu.storage.set("u", undefined)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `can't store undefined under "u"`)
+
+	v, err = rt.RunString(`vu.storage.clear(); vu.storage.size()`)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), v.ToInteger())
+
+	other := newRuntime(t)
+	v, err = other.RunString(`vu.storage.has("token")`)
+	require.NoError(t, err)
+	assert.False(t, v.ToBoolean())
+}
+
+func TestStorageLimit(t *testing.T) {
+	t.Parallel()
+	rt := newRuntime(t)
+
+	_, err := rt.RunString(`vu.storage.setLimit(10); vu.storage.set("key", "value")`)
+	require.NoError(t, err)
+
+	_, err = rt.RunString(`vu.storage.set("other", 1)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `storing "other" would make the VU storage 16 bytes, over its limit of 10 bytes`)
+
+	_, err = rt.RunString(`vu.storage.set("key", "12345")`)
+	require.NoError(t, err)
+
+	_, err = rt.RunString(`vu.storage.setLimit(5)`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the VU storage already takes 10 bytes, more than 5")
+}
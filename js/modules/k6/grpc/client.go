@@ -67,8 +67,10 @@ var (
 
 // Client represents a gRPC client that can be used to make RPC requests
 type Client struct {
-	mds  map[string]protoreflect.MethodDescriptor
-	conn *grpc.ClientConn
+	mds          map[string]protoreflect.MethodDescriptor
+	conn         *grpc.ClientConn
+	web          *webConn
+	interceptors []goja.Callable
 }
 
 // XClient represents the Client constructor (e.g. `new grpc.Client()`) and
@@ -139,6 +141,12 @@ func (c *Client) Load(ctxPtr *context.Context, importPaths []string, filenames .
 		}),
 	}
 
+	return c.loadFiles(parser, filenames...)
+}
+
+// loadFiles parses the given files and registers the methods of all services
+// they describe, so they can be invoked later.
+func (c *Client) loadFiles(parser protoparse.Parser, filenames ...string) ([]MethodInfo, error) {
 	fds, err := parser.ParseFiles(filenames...)
 	if err != nil {
 		return nil, err
@@ -206,6 +214,8 @@ func (t transportCreds) ClientHandshake(ctx context.Context,
 }
 
 // Connect is a block dial to the gRPC server at the given address (host:port)
+// unless the grpc-web or grpc-web-text protocol is used, in which case every
+// invocation is sent as a separate HTTP request.
 // nolint: funlen
 func (c *Client) Connect(ctxPtr *context.Context, addr string, params map[string]interface{}) (bool, error) {
 	state := lib.GetState(*ctxPtr)
@@ -213,7 +223,7 @@ func (c *Client) Connect(ctxPtr *context.Context, addr string, params map[string
 		return false, errConnectInInitContext
 	}
 
-	isPlaintext, timeout := false, 60*time.Second
+	isPlaintext, timeout, protocol := false, 60*time.Second, protocolGRPC
 
 	for k, v := range params {
 		switch k {
@@ -225,11 +235,26 @@ func (c *Client) Connect(ctxPtr *context.Context, addr string, params map[string
 			if err != nil {
 				return false, fmt.Errorf("invalid timeout value: %w", err)
 			}
+		case "protocol":
+			protocol, _ = v.(string)
 		default:
 			return false, fmt.Errorf("unknown connect param: %q", k)
 		}
 	}
 
+	switch protocol {
+	case protocolGRPC:
+		c.web = nil
+	case protocolGRPCWeb, protocolGRPCWebText:
+		// (gRPC-Web) every call is a separate HTTP request made with the VU's
+		// transport, so there is no connection to establish up front
+		c.web = newWebConn(addr, isPlaintext, protocol == protocolGRPCWebText)
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown protocol %q, it should be one of %q, %q or %q",
+			protocol, protocolGRPC, protocolGRPCWeb, protocolGRPCWebText)
+	}
+
 	// (rogchap) Even with FailOnNonTempDialError, if there is a TLS error this will timeout
 	// rather than report the error, so we can't rely on WithBlock. By running in a goroutine
 	// we can then wait on the error channel instead, which could happen before the Dial
@@ -292,17 +317,14 @@ func (c *Client) Connect(ctxPtr *context.Context, addr string, params map[string
 }
 
 // Invoke creates and calls a unary RPC by fully qualified method name
-//nolint: funlen,gocognit,gocyclo
 func (c *Client) Invoke(ctxPtr *context.Context,
 	method string, req goja.Value, params map[string]interface{}) (*Response, error) {
 	ctx := *ctxPtr
-	rt := common.GetRuntime(ctx)
-	state := lib.GetState(ctx)
-	if state == nil {
+	if lib.GetState(ctx) == nil {
 		return nil, errInvokeRPCInInitContext
 	}
 
-	if c.conn == nil {
+	if c.conn == nil && c.web == nil {
 		return nil, errors.New("no gRPC connection, you must call connect first")
 	}
 
@@ -319,6 +341,76 @@ func (c *Client) Invoke(ctxPtr *context.Context,
 		return nil, fmt.Errorf("method %q not found in file descriptors", method)
 	}
 
+	if len(c.interceptors) > 0 {
+		return c.runInterceptors(ctx, 0, method, md, req, params)
+	}
+
+	return c.invoke(ctx, method, md, req, params)
+}
+
+// Intercept registers a function that wraps every unary RPC made with the
+// client, similar to the unary interceptors in grpc-go. The function is called
+// with the full method name, the request message, the invoke params and a next
+// function. Calling next(request, params) continues the chain and returns the
+// response, so the interceptor can alter the headers, retry or record its own
+// metrics. Interceptors are called in the order they were registered.
+func (c *Client) Intercept(fn goja.Callable) error {
+	if fn == nil {
+		return errors.New("interceptor must be a function")
+	}
+	c.interceptors = append(c.interceptors, fn)
+
+	return nil
+}
+
+// runInterceptors calls the interceptor at idx, handing it a next function that
+// continues with the following one; the last interceptor gets the actual RPC.
+func (c *Client) runInterceptors(ctx context.Context, idx int, method string,
+	md protoreflect.MethodDescriptor, req goja.Value, params map[string]interface{}) (*Response, error) {
+	if idx == len(c.interceptors) {
+		return c.invoke(ctx, method, md, req, params)
+	}
+
+	rt := common.GetRuntime(ctx)
+	if params == nil {
+		params = make(map[string]interface{})
+	}
+
+	next := func(nextReq, nextParams goja.Value) (*Response, error) {
+		if nextReq == nil || goja.IsUndefined(nextReq) || goja.IsNull(nextReq) {
+			nextReq = req
+		}
+		p := params
+		if nextParams != nil && !goja.IsUndefined(nextParams) && !goja.IsNull(nextParams) {
+			var ok bool
+			if p, ok = nextParams.Export().(map[string]interface{}); !ok {
+				return nil, errors.New("params passed to next must be an object with key-value pairs")
+			}
+		}
+
+		return c.runInterceptors(ctx, idx+1, method, md, nextReq, p)
+	}
+
+	v, err := c.interceptors[idx](goja.Undefined(), rt.ToValue(method), req, rt.ToValue(params), rt.ToValue(next))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, ok := v.Export().(*Response)
+	if !ok {
+		return nil, fmt.Errorf("interceptor for %q must return the response from next()", method)
+	}
+
+	return resp, nil
+}
+
+// invoke makes the actual unary RPC call, after the interceptors have run
+//nolint: funlen,gocognit,gocyclo
+func (c *Client) invoke(ctx context.Context, method string, md protoreflect.MethodDescriptor,
+	req goja.Value, params map[string]interface{}) (*Response, error) {
+	rt := common.GetRuntime(ctx)
+	state := lib.GetState(ctx)
+
 	tags := state.CloneTags()
 	timeout := 60 * time.Second
 
@@ -361,7 +453,7 @@ func (c *Client) Invoke(ctxPtr *context.Context,
 		}
 	}
 	if state.Options.SystemTags.Has(stats.TagURL) {
-		tags["url"] = fmt.Sprintf("%s%s", c.conn.Target(), method)
+		tags["url"] = fmt.Sprintf("%s%s", c.target(), method)
 	}
 
 	parts := strings.Split(method[1:], "/")
@@ -395,7 +487,12 @@ func (c *Client) Invoke(ctxPtr *context.Context,
 
 	resp := dynamicpb.NewMessage(md.Output())
 	header, trailer := metadata.New(nil), metadata.New(nil)
-	err := c.conn.Invoke(reqCtx, method, reqdm, resp, grpc.Header(&header), grpc.Trailer(&trailer))
+	var err error
+	if c.web != nil {
+		err = c.web.invoke(reqCtx, method, reqdm, resp, header, trailer)
+	} else {
+		err = c.conn.Invoke(reqCtx, method, reqdm, resp, grpc.Header(&header), grpc.Trailer(&trailer))
+	}
 
 	var response Response
 	response.Headers = header
@@ -445,7 +542,11 @@ func (c *Client) Invoke(ctxPtr *context.Context,
 
 // Close will close the client gRPC connection
 func (c *Client) Close() error {
-	if c == nil || c.conn == nil {
+	if c == nil {
+		return nil
+	}
+	c.web = nil
+	if c.conn == nil {
 		return nil
 	}
 	err := c.conn.Close()
@@ -454,6 +555,13 @@ func (c *Client) Close() error {
 	return err
 }
 
+func (c *Client) target() string {
+	if c.web != nil {
+		return c.web.target
+	}
+	return c.conn.Target()
+}
+
 // TagConn implements the stats.Handler interface
 func (*Client) TagConn(ctx context.Context, _ *grpcstats.ConnTagInfo) context.Context {
 	// noop
@@ -415,6 +415,80 @@ func TestClient(t *testing.T) {
 		assert.NoError(t, err)
 	})
 
+	t.Run("InterceptorNotFunction", func(t *testing.T) {
+		_, err := rt.RunString(`client.intercept("foo")`)
+		require.Error(t, err)
+	})
+
+	t.Run("InterceptorHeaders", func(t *testing.T) {
+		tb.GRPCStub.EmptyCallFunc = func(ctx context.Context, _ *grpc_testing.Empty) (*grpc_testing.Empty, error) {
+			md, ok := metadata.FromIncomingContext(ctx)
+			if !ok || len(md["authorization"]) == 0 || md["authorization"][0] != "Bearer token" {
+				return nil, status.Error(codes.Unauthenticated, "")
+			}
+
+			return &grpc_testing.Empty{}, nil
+		}
+		_, err := rt.RunString(`
+			var intercepted = [];
+			client.intercept(function(method, req, params, next) {
+				intercepted.push(method);
+				params.headers = params.headers || {};
+				params.headers["Authorization"] = "Bearer token";
+				return next(req, params);
+			});
+			var resp = client.invoke("grpc.testing.TestService/EmptyCall", {})
+			if (resp.status !== grpc.StatusOK) {
+				throw new Error("unexpected error status: " + resp.status)
+			}
+			if (intercepted.length !== 1 || intercepted[0] !== "/grpc.testing.TestService/EmptyCall") {
+				throw new Error("unexpected intercepted methods: " + JSON.stringify(intercepted))
+			}
+		`)
+		assert.NoError(t, err)
+	})
+
+	t.Run("InterceptorRetry", func(t *testing.T) {
+		calls := 0
+		tb.GRPCStub.EmptyCallFunc = func(context.Context, *grpc_testing.Empty) (*grpc_testing.Empty, error) {
+			calls++
+			if calls < 3 {
+				return nil, status.Error(codes.Unavailable, "")
+			}
+
+			return &grpc_testing.Empty{}, nil
+		}
+		_, err := rt.RunString(`
+			client.intercept(function(method, req, params, next) {
+				var resp;
+				for (var i = 0; i < 5; i++) {
+					resp = next();
+					if (resp.status !== grpc.StatusUnavailable) {
+						break;
+					}
+				}
+				return resp;
+			});
+			var resp = client.invoke("grpc.testing.TestService/EmptyCall", {})
+			if (resp.status !== grpc.StatusOK) {
+				throw new Error("unexpected error status: " + resp.status)
+			}
+		`)
+		assert.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("InterceptorNoResponse", func(t *testing.T) {
+		_, err := rt.RunString(`
+			client.intercept(function(method, req, params, next) {
+				next();
+			});
+			client.invoke("grpc.testing.TestService/EmptyCall", {})
+		`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "must return the response from next()")
+	})
+
 	t.Run("LoadNotInit", func(t *testing.T) {
 		_, err := rt.RunString("client.load()")
 		if !assert.Error(t, err) {
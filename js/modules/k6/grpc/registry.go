@@ -0,0 +1,287 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jhump/protoreflect/desc/protoparse"
+	"github.com/spf13/afero"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+)
+
+const (
+	// bufDownloadPath is the Connect endpoint of the Buf Schema Registry API
+	// that returns all the files of a module at a specific reference.
+	bufDownloadPath = "/buf.alpha.registry.v1alpha1.DownloadService/Download"
+
+	// bufDependenciesDir is the directory, relative to the module, in which
+	// the files of its dependencies are kept.
+	bufDependenciesDir = "_deps"
+)
+
+//nolint: gochecknoglobals
+var registryClient = &http.Client{Timeout: 60 * time.Second}
+
+type bufModuleRef struct {
+	Remote     string
+	Owner      string
+	Repository string
+	Reference  string
+}
+
+func parseBufModuleRef(module, reference string) (bufModuleRef, error) {
+	parts := strings.Split(module, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return bufModuleRef{}, fmt.Errorf("invalid module %q, it should be in the remote/owner/repository format", module)
+	}
+	if reference == "" {
+		reference = "main"
+	}
+	if strings.ContainsAny(reference, `/\`) || reference == "." || reference == ".." {
+		return bufModuleRef{}, fmt.Errorf("invalid module reference %q", reference)
+	}
+
+	return bufModuleRef{Remote: parts[0], Owner: parts[1], Repository: parts[2], Reference: reference}, nil
+}
+
+func (r bufModuleRef) String() string {
+	return fmt.Sprintf("%s/%s/%s:%s", r.Remote, r.Owner, r.Repository, r.Reference)
+}
+
+type bufDownloadRequest struct {
+	Owner      string `json:"owner"`
+	Repository string `json:"repository"`
+	Reference  string `json:"reference"`
+}
+
+type bufModuleFile struct {
+	Path    string `json:"path"`
+	Content []byte `json:"content"`
+}
+
+type bufModulePin struct {
+	Remote     string `json:"remote"`
+	Owner      string `json:"owner"`
+	Repository string `json:"repository"`
+	Commit     string `json:"commit"`
+}
+
+type bufModule struct {
+	Files        []bufModuleFile `json:"files"`
+	Dependencies []bufModulePin  `json:"dependencies"`
+}
+
+type bufDownloadResponse struct {
+	Module bufModule `json:"module"`
+}
+
+type bufError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// downloadBufModule fetches the module files from the registry it's hosted on.
+func downloadBufModule(ctx context.Context, ref bufModuleRef, token string) (*bufModule, error) {
+	body, err := json.Marshal(bufDownloadRequest{
+		Owner:      ref.Owner,
+		Repository: ref.Repository,
+		Reference:  ref.Reference,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+ref.Remote+bufDownloadPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := registryClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't download module %s: %w", ref, err)
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		var bufErr bufError
+		if jsonErr := json.Unmarshal(data, &bufErr); jsonErr != nil || bufErr.Message == "" {
+			return nil, fmt.Errorf("couldn't download module %s: wrong status code (%d)", ref, res.StatusCode)
+		}
+		return nil, fmt.Errorf("couldn't download module %s: %s (%s)", ref, bufErr.Message, bufErr.Code)
+	}
+
+	var dres bufDownloadResponse
+	if err := json.Unmarshal(data, &dres); err != nil {
+		return nil, fmt.Errorf("couldn't parse the files of module %s: %w", ref, err)
+	}
+
+	return &dres.Module, nil
+}
+
+func writeBufModuleFiles(fs afero.Fs, dir string, files []bufModuleFile) error {
+	for _, f := range files {
+		filename := filepath.Join(dir, filepath.FromSlash(path.Clean("/"+f.Path)))
+		if err := fs.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+			return err
+		}
+		if err := afero.WriteFile(fs, filename, f.Content, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// fetchBufModule downloads the module and all of its dependencies and stores
+// their files in the given directory.
+func fetchBufModule(ctx context.Context, fs afero.Fs, dir string, ref bufModuleRef, token string) error {
+	module, err := downloadBufModule(ctx, ref, token)
+	if err != nil {
+		return err
+	}
+	// The registry returns the whole dependency graph of the module, so there
+	// is no need to look at the dependencies of the dependencies.
+	depsDir := filepath.Join(dir, bufDependenciesDir)
+	for _, pin := range module.Dependencies {
+		dep, err := downloadBufModule(ctx, bufModuleRef{
+			Remote:     pin.Remote,
+			Owner:      pin.Owner,
+			Repository: pin.Repository,
+			Reference:  pin.Commit,
+		}, token)
+		if err != nil {
+			return err
+		}
+		if err := writeBufModuleFiles(fs, depsDir, dep.Files); err != nil {
+			return err
+		}
+	}
+
+	return writeBufModuleFiles(fs, dir, module.Files)
+}
+
+// LoadFromRegistry will fetch the proto files of a module hosted on a Buf Schema
+// Registry (e.g. buf.build/acme/payments) at the given reference and make their
+// file descriptors available to request. The files are stored with the remote
+// modules, so they are included in archives and only downloaded once.
+func (c *Client) LoadFromRegistry(
+	ctxPtr *context.Context, module, reference string, params map[string]interface{},
+) ([]MethodInfo, error) {
+	if lib.GetState(*ctxPtr) != nil {
+		return nil, errors.New("loadFromRegistry must be called in the init context")
+	}
+
+	initEnv := common.GetInitEnv(*ctxPtr)
+	if initEnv == nil {
+		return nil, errors.New("missing init environment")
+	}
+
+	var token string
+	for k, v := range params {
+		switch k {
+		case "token":
+			var ok bool
+			if token, ok = v.(string); !ok {
+				return nil, errors.New("token must be a string")
+			}
+		default:
+			return nil, fmt.Errorf("unknown loadFromRegistry param: %q", k)
+		}
+	}
+
+	ref, err := parseBufModuleRef(module, reference)
+	if err != nil {
+		return nil, err
+	}
+
+	fs := initEnv.FileSystems["https"]
+	dir := filepath.Join(afero.FilePathSeparator, ref.Remote, ref.Owner, ref.Repository, ref.Reference)
+	exists, err := afero.DirExists(fs, dir)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err = fetchBufModule(*ctxPtr, fs, dir, ref, token); err != nil {
+			return nil, err
+		}
+	}
+
+	var filenames []string
+	err = afero.Walk(fs, dir, func(filename string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == bufDependenciesDir && filepath.Dir(filename) == dir {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if filepath.Ext(filename) == ".proto" {
+			rel, err := filepath.Rel(dir, filename)
+			if err != nil {
+				return err
+			}
+			filenames = append(filenames, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(filenames) == 0 {
+		return nil, fmt.Errorf("module %s doesn't contain any proto files", ref)
+	}
+
+	parser := protoparse.Parser{
+		ImportPaths:      []string{dir, filepath.Join(dir, bufDependenciesDir)},
+		InferImportPaths: false,
+		Accessor: protoparse.FileAccessor(func(filename string) (io.ReadCloser, error) {
+			return fs.Open(filename)
+		}),
+	}
+
+	return c.loadFiles(parser, filenames...)
+}
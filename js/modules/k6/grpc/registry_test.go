@@ -0,0 +1,180 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js/common"
+)
+
+func TestParseBufModuleRef(t *testing.T) {
+	t.Parallel()
+
+	ref, err := parseBufModuleRef("buf.build/acme/payments", "")
+	require.NoError(t, err)
+	assert.Equal(t, bufModuleRef{Remote: "buf.build", Owner: "acme", Repository: "payments", Reference: "main"}, ref)
+	assert.Equal(t, "buf.build/acme/payments:main", ref.String())
+
+	ref, err = parseBufModuleRef("buf.build/acme/payments", "v1.2.3")
+	require.NoError(t, err)
+	assert.Equal(t, "v1.2.3", ref.Reference)
+
+	for _, module := range []string{"", "buf.build", "buf.build/acme", "buf.build//payments", "buf.build/acme/payments/v1"} {
+		_, err = parseBufModuleRef(module, "")
+		assert.Error(t, err, module)
+	}
+	for _, reference := range []string{"..", "v1/../..", `v1\v2`} {
+		_, err = parseBufModuleRef("buf.build/acme/payments", reference)
+		assert.Error(t, err, reference)
+	}
+}
+
+// Not parallel, as it replaces the package-level registry client
+func TestClientLoadFromRegistry(t *testing.T) {
+	modules := map[string]bufModule{
+		"acme/payments/v1.2.3": {
+			Files: []bufModuleFile{{
+				Path: "acme/payments/v1/payments.proto",
+				Content: []byte(`syntax = "proto3";
+package acme.payments.v1;
+import "acme/money/v1/money.proto";
+service PaymentService {
+	rpc Charge(acme.money.v1.Money) returns (acme.money.v1.Money);
+}`),
+			}},
+			Dependencies: []bufModulePin{{Owner: "acme", Repository: "money", Commit: "abcdef"}},
+		},
+		"acme/money/abcdef": {
+			Files: []bufModuleFile{{
+				Path: "acme/money/v1/money.proto",
+				Content: []byte(`syntax = "proto3";
+package acme.money.v1;
+message Money {
+	string currency = 1;
+	int64 units = 2;
+}`),
+			}},
+		},
+	}
+
+	var requests int64
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if r.URL.Path != bufDownloadPath || r.Header.Get("Authorization") != "Bearer secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"code":"unauthenticated","message":"invalid token"}`))
+			return
+		}
+		var req bufDownloadRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		module, ok := modules[req.Owner+"/"+req.Repository+"/"+req.Reference]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"code":"not_found","message":"module not found"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(bufDownloadResponse{Module: module})
+	}))
+	defer srv.Close()
+
+	remote := strings.TrimPrefix(srv.URL, "https://")
+	modules["acme/payments/v1.2.3"].Dependencies[0].Remote = remote
+
+	defaultClient := registryClient
+	registryClient = srv.Client()
+	defer func() { registryClient = defaultClient }()
+
+	fs := afero.NewMemMapFs()
+	newRuntime := func() *goja.Runtime {
+		rt := goja.New()
+		rt.SetFieldNameMapper(common.FieldNameMapper{})
+		ctx := common.WithRuntime(context.Background(), rt)
+		ctx = common.WithInitEnv(ctx, &common.InitEnvironment{
+			Logger:      logrus.New(),
+			CWD:         &url.URL{Path: "/"},
+			FileSystems: map[string]afero.Fs{"https": fs},
+		})
+		rt.Set("grpc", common.Bind(rt, New(), &ctx))
+		rt.Set("remote", remote)
+		_, err := rt.RunString("var client = new grpc.Client();")
+		require.NoError(t, err)
+		return rt
+	}
+
+	t.Run("Unauthenticated", func(t *testing.T) {
+		_, err := newRuntime().RunString(`client.loadFromRegistry(remote + "/acme/payments", "v1.2.3")`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid token (unauthenticated)")
+	})
+
+	t.Run("NotFound", func(t *testing.T) {
+		_, err := newRuntime().RunString(`client.loadFromRegistry(remote + "/acme/orders", "v1", { token: "secret" })`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "module not found (not_found)")
+	})
+
+	t.Run("UnknownParam", func(t *testing.T) {
+		_, err := newRuntime().RunString(`client.loadFromRegistry(remote + "/acme/payments", "v1.2.3", { foo: "bar" })`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `unknown loadFromRegistry param: "foo"`)
+	})
+
+	atomic.StoreInt64(&requests, 0)
+	t.Run("Load", func(t *testing.T) {
+		v, err := newRuntime().RunString(`client.loadFromRegistry(remote + "/acme/payments", "v1.2.3", { token: "secret" })`)
+		require.NoError(t, err)
+		methods, ok := v.Export().([]MethodInfo)
+		require.True(t, ok)
+		require.Len(t, methods, 1)
+		assert.Equal(t, "/acme.payments.v1.PaymentService/Charge", methods[0].FullMethod)
+		assert.Equal(t, int64(2), atomic.LoadInt64(&requests))
+
+		exists, err := afero.Exists(fs, "/"+remote+"/acme/payments/v1.2.3/_deps/acme/money/v1/money.proto")
+		require.NoError(t, err)
+		assert.True(t, exists)
+	})
+
+	t.Run("LoadCached", func(t *testing.T) {
+		v, err := newRuntime().RunString(`client.loadFromRegistry(remote + "/acme/payments", "v1.2.3")`)
+		require.NoError(t, err)
+		methods, ok := v.Export().([]MethodInfo)
+		require.True(t, ok)
+		require.Len(t, methods, 1)
+		assert.Equal(t, int64(2), atomic.LoadInt64(&requests))
+	})
+}
@@ -0,0 +1,316 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+const (
+	protocolGRPC        = "grpc"
+	protocolGRPCWeb     = "grpc-web"
+	protocolGRPCWebText = "grpc-web-text"
+
+	grpcWebContentType     = "application/grpc-web+proto"
+	grpcWebTextContentType = "application/grpc-web-text+proto"
+
+	// grpcWebTrailerFlag marks a frame that holds the trailers, instead of a message
+	grpcWebTrailerFlag byte = 0x80
+	// grpcWebCompressedFlag marks a frame with a compressed message
+	grpcWebCompressedFlag byte = 0x01
+)
+
+// webConn makes unary RPC calls with the gRPC-Web protocol, which carries
+// gRPC over plain HTTP requests and sends the trailers in the response body.
+type webConn struct {
+	target  string
+	baseURL string
+	text    bool
+}
+
+func newWebConn(addr string, isPlaintext, text bool) *webConn {
+	scheme := "https"
+	if isPlaintext {
+		scheme = "http"
+	}
+
+	return &webConn{
+		target:  addr,
+		baseURL: scheme + "://" + addr,
+		text:    text,
+	}
+}
+
+func (w *webConn) contentType() string {
+	if w.text {
+		return grpcWebTextContentType
+	}
+	return grpcWebContentType
+}
+
+// invoke sends the request message to the given method and fills in the
+// response message, headers and trailers. As with the gRPC transport, any
+// non-OK status is returned as an error.
+//nolint: funlen
+func (w *webConn) invoke(ctx context.Context, method string, req, resp proto.Message,
+	header, trailer metadata.MD) error {
+	state := lib.GetState(ctx)
+
+	payload, err := proto.Marshal(req)
+	if err != nil {
+		return status.Errorf(codes.Internal, "grpc-web: error while marshaling: %v", err)
+	}
+	body := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(body[1:5], uint32(len(payload)))
+	copy(body[5:], payload)
+	if w.text {
+		body = []byte(base64.StdEncoding.EncodeToString(body))
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, w.baseURL+method, bytes.NewReader(body))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		for k, vs := range md {
+			for _, v := range vs {
+				httpReq.Header.Add(k, v)
+			}
+		}
+	}
+	httpReq.Header.Set("Content-Type", w.contentType())
+	httpReq.Header.Set("Accept", w.contentType())
+	httpReq.Header.Set("X-Grpc-Web", "1")
+	if ua := state.Options.UserAgent; ua.Valid {
+		httpReq.Header.Set("User-Agent", ua.ValueOrZero())
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		httpReq.Header.Set("Grpc-Timeout", strconv.FormatInt(time.Until(deadline).Milliseconds(), 10)+"m")
+	}
+
+	var remoteAddr net.Addr
+	httpReq = httpReq.WithContext(httptrace.WithClientTrace(httpReq.Context(), &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			remoteAddr = info.Conn.RemoteAddr()
+		},
+	}))
+
+	startTime := time.Now()
+	err = w.roundTrip(state, httpReq, resp, header, trailer)
+	endTime := time.Now()
+
+	tags := getTags(ctx)
+	if state.Options.SystemTags.Has(stats.TagIP) && remoteAddr != nil {
+		if ip, _, splitErr := net.SplitHostPort(remoteAddr.String()); splitErr == nil {
+			tags["ip"] = ip
+		}
+	}
+	if state.Options.SystemTags.Has(stats.TagStatus) {
+		tags["status"] = strconv.Itoa(int(status.Code(err)))
+	}
+	mTags := map[string]string(tags)
+	stats.PushIfNotDone(ctx, state.Samples, stats.ConnectedSamples{
+		Samples: []stats.Sample{
+			{
+				Metric: metrics.GRPCReqDuration,
+				Tags:   stats.IntoSampleTags(&mTags),
+				Value:  stats.D(endTime.Sub(startTime)),
+				Time:   endTime,
+			},
+		},
+	})
+
+	return err
+}
+
+func (w *webConn) roundTrip(state *lib.State, httpReq *http.Request, resp proto.Message,
+	header, trailer metadata.MD) error {
+	res, err := (&http.Client{Transport: state.Transport}).Do(httpReq)
+	if err != nil {
+		if ctxErr := httpReq.Context().Err(); ctxErr != nil {
+			return status.FromContextError(ctxErr).Err()
+		}
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	defer func() { _ = res.Body.Close() }()
+
+	for k, vs := range res.Header {
+		header[strings.ToLower(k)] = append(header[strings.ToLower(k)], vs...)
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return status.Errorf(httpStatusToCode(res.StatusCode),
+			"grpc-web: unexpected HTTP status code %d (%s)", res.StatusCode, http.StatusText(res.StatusCode))
+	}
+
+	data, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if w.text {
+		if data, err = decodeGRPCWebText(data); err != nil {
+			return status.Errorf(codes.Internal, "grpc-web: malformed response body: %v", err)
+		}
+	}
+	if err := readGRPCWebFrames(data, resp, trailer); err != nil {
+		return err
+	}
+
+	// A response without a message can send the status in the headers
+	// (trailers-only), so fall back to them if there are no trailers
+	statusMD := trailer
+	if len(statusMD.Get("grpc-status")) == 0 {
+		statusMD = header
+	}
+
+	return grpcWebStatus(statusMD)
+}
+
+// readGRPCWebFrames reads the length-prefixed frames of a gRPC-Web response
+// body, unmarshaling the message into resp and parsing the trailers frame.
+func readGRPCWebFrames(data []byte, resp proto.Message, trailer metadata.MD) error {
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return status.Error(codes.Internal, "grpc-web: malformed frame header")
+		}
+		flag, size := data[0], binary.BigEndian.Uint32(data[1:5])
+		data = data[5:]
+		if uint64(len(data)) < uint64(size) {
+			return status.Error(codes.Internal, "grpc-web: unexpected end of frame")
+		}
+		frame := data[:size]
+		data = data[size:]
+
+		switch {
+		case flag&grpcWebTrailerFlag != 0:
+			parseGRPCWebTrailers(frame, trailer)
+		case flag&grpcWebCompressedFlag != 0:
+			return status.Error(codes.Internal, "grpc-web: compressed messages are not supported")
+		default:
+			if err := proto.Unmarshal(frame, resp); err != nil {
+				return status.Errorf(codes.Internal, "grpc-web: failed to unmarshal the response: %v", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseGRPCWebTrailers parses the trailers frame, which is formatted as HTTP/1
+// header lines.
+func parseGRPCWebTrailers(frame []byte, trailer metadata.MD) {
+	for _, line := range strings.Split(string(frame), "\r\n") {
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			continue
+		}
+		k := strings.ToLower(strings.TrimSpace(line[:i]))
+		trailer[k] = append(trailer[k], strings.TrimSpace(line[i+1:]))
+	}
+}
+
+// grpcWebStatus builds the status error from the grpc-status and grpc-message
+// values and removes them from the metadata, as they are not part of it with
+// the gRPC transport either.
+func grpcWebStatus(md metadata.MD) error {
+	rawStatus := md.Get("grpc-status")
+	if len(rawStatus) == 0 {
+		return status.Error(codes.Internal, "grpc-web: the response didn't contain a grpc-status")
+	}
+	code, err := strconv.Atoi(rawStatus[0])
+	if err != nil {
+		return status.Errorf(codes.Internal, "grpc-web: invalid grpc-status %q", rawStatus[0])
+	}
+
+	var msg string
+	if rawMsg := md.Get("grpc-message"); len(rawMsg) > 0 {
+		if msg, err = url.PathUnescape(rawMsg[0]); err != nil {
+			msg = rawMsg[0]
+		}
+	}
+	delete(md, "grpc-status")
+	delete(md, "grpc-message")
+
+	return status.Error(codes.Code(code), msg)
+}
+
+// decodeGRPCWebText decodes a grpc-web-text body. Servers may encode every
+// frame separately, so the body can consist of several padded base64 chunks;
+// decoding it in blocks of 4 characters handles both cases.
+func decodeGRPCWebText(data []byte) ([]byte, error) {
+	data = bytes.Join(bytes.Fields(data), nil)
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("invalid base64 length %d", len(data))
+	}
+
+	decoded := make([]byte, 0, base64.StdEncoding.DecodedLen(len(data)))
+	block := make([]byte, 3)
+	for i := 0; i < len(data); i += 4 {
+		n, err := base64.StdEncoding.Decode(block, data[i:i+4])
+		if err != nil {
+			return nil, err
+		}
+		decoded = append(decoded, block[:n]...)
+	}
+
+	return decoded, nil
+}
+
+// httpStatusToCode maps the HTTP status of a failed response to a gRPC code,
+// following the gRPC HTTP to gRPC status code mapping.
+func httpStatusToCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.Internal
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.Unimplemented
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return codes.Unavailable
+	default:
+		return codes.Unknown
+	}
+}
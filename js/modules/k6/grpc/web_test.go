@@ -0,0 +1,231 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package grpc
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/dop251/goja"
+	protoV1 "github.com/golang/protobuf/proto" //nolint: staticcheck
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/grpc_testing"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+func grpcWebFrame(flag byte, data []byte) []byte {
+	frame := make([]byte, 5+len(data))
+	frame[0] = flag
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	return frame
+}
+
+func grpcWebHandler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		text := r.Header.Get("Content-Type") == grpcWebTextContentType
+		if r.Header.Get("X-Grpc-Web") != "1" || (!text && r.Header.Get("Content-Type") != grpcWebContentType) {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		if text {
+			body, err = base64.StdEncoding.DecodeString(string(body))
+			require.NoError(t, err)
+		}
+
+		w.Header().Set("Content-Type", r.Header.Get("Content-Type"))
+		switch r.URL.Path {
+		case "/grpc.testing.TestService/EmptyCall":
+			// trailers-only response
+			w.Header().Set("Grpc-Status", "5")
+			w.Header().Set("Grpc-Message", "not%20here")
+		case "/grpc.testing.TestService/UnaryCall":
+			var req grpc_testing.SimpleRequest
+			require.NoError(t, protoV1.Unmarshal(body[5:], &req))
+			msg, err := protoV1.Marshal(&grpc_testing.SimpleResponse{
+				Username:   string(req.Payload.GetBody()),
+				OauthScope: r.Header.Get("X-Load-Tester"),
+			})
+			require.NoError(t, err)
+			w.Header().Set("Foo", "bar")
+			frames := [][]byte{
+				grpcWebFrame(0, msg),
+				grpcWebFrame(grpcWebTrailerFlag, []byte("grpc-status: 0\r\nx-trailer: baz\r\n")),
+			}
+			for _, frame := range frames {
+				if text {
+					frame = []byte(base64.StdEncoding.EncodeToString(frame))
+				}
+				_, _ = w.Write(frame)
+			}
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}
+}
+
+func TestClientGRPCWeb(t *testing.T) {
+	t.Parallel()
+
+	srv := httptest.NewServer(grpcWebHandler(t))
+	defer srv.Close()
+	addr := strings.TrimPrefix(srv.URL, "http://")
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	for _, protocol := range []string{protocolGRPCWeb, protocolGRPCWebText} {
+		rt := goja.New()
+		rt.SetFieldNameMapper(common.FieldNameMapper{})
+		ctx := common.WithRuntime(context.Background(), rt)
+		ctx = common.WithInitEnv(ctx, &common.InitEnvironment{
+			Logger:      logrus.New(),
+			CWD:         &url.URL{Path: cwd},
+			FileSystems: map[string]afero.Fs{"file": afero.NewOsFs()},
+		})
+		rt.Set("grpc", common.Bind(rt, New(), &ctx))
+		rt.Set("addr", addr)
+		rt.Set("protocol", protocol)
+
+		_, err = rt.RunString(`
+			var client = new grpc.Client();
+			client.load([], "../../../../vendor/google.golang.org/grpc/test/grpc_testing/test.proto");
+		`)
+		require.NoError(t, err)
+
+		samples := make(chan stats.SampleContainer, 100)
+		ctx = lib.WithState(ctx, &lib.State{
+			Group:     root,
+			Transport: http.DefaultTransport,
+			Samples:   samples,
+			Options: lib.Options{
+				SystemTags: stats.NewSystemTagSet(stats.TagURL, stats.TagStatus),
+			},
+		})
+
+		_, err = rt.RunString(`
+			client.connect(addr, { plaintext: true, protocol: protocol });
+			var resp = client.invoke("grpc.testing.TestService/UnaryCall",
+				{ payload: { body: "azY=" } }, { headers: { "X-Load-Tester": "k6" } });
+			if (resp.status !== grpc.StatusOK) {
+				throw new Error("unexpected error status: " + resp.status);
+			}
+			if (resp.message.username !== "k6" || resp.message.oauthScope !== "k6") {
+				throw new Error("unexpected response message: " + JSON.stringify(resp.message));
+			}
+			if (!resp.headers["foo"] || resp.headers["foo"][0] !== "bar") {
+				throw new Error("unexpected headers: " + JSON.stringify(resp.headers));
+			}
+			if (!resp.trailers["x-trailer"] || resp.trailers["x-trailer"][0] !== "baz" || resp.trailers["grpc-status"]) {
+				throw new Error("unexpected trailers: " + JSON.stringify(resp.trailers));
+			}
+
+			resp = client.invoke("grpc.testing.TestService/EmptyCall", {});
+			if (resp.status !== grpc.StatusNotFound || resp.error.message !== "not here") {
+				throw new Error("unexpected error: " + JSON.stringify(resp.error));
+			}
+		`)
+		require.NoError(t, err, protocol)
+
+		bufSamples := stats.GetBufferedSamples(samples)
+		require.Len(t, bufSamples, 2)
+		for i, status := range []string{"0", "5"} {
+			sample := bufSamples[i].GetSamples()[0]
+			assert.Equal(t, metrics.GRPCReqDuration, sample.Metric)
+			tag, _ := sample.Tags.Get("status")
+			assert.Equal(t, status, tag)
+		}
+		surl, _ := bufSamples[0].GetSamples()[0].Tags.Get("url")
+		assert.Equal(t, addr+"/grpc.testing.TestService/UnaryCall", surl)
+	}
+}
+
+func TestConnectUnknownProtocol(t *testing.T) {
+	t.Parallel()
+
+	rt := goja.New()
+	ctx := common.WithRuntime(context.Background(), rt)
+	ctx = lib.WithState(ctx, &lib.State{})
+	c := &Client{}
+
+	_, err := c.Connect(&ctx, "localhost:1234", map[string]interface{}{"protocol": "http"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown protocol "http"`)
+}
+
+func TestDecodeGRPCWebText(t *testing.T) {
+	t.Parallel()
+
+	first, second := grpcWebFrame(0, []byte("a")), grpcWebFrame(grpcWebTrailerFlag, []byte("grpc-status: 0"))
+	body := base64.StdEncoding.EncodeToString(first) + "\n" + base64.StdEncoding.EncodeToString(second)
+
+	decoded, err := decodeGRPCWebText([]byte(body))
+	require.NoError(t, err)
+	assert.Equal(t, append(first, second...), decoded)
+
+	_, err = decodeGRPCWebText([]byte("abc"))
+	assert.Error(t, err)
+}
+
+func TestReadGRPCWebFrames(t *testing.T) {
+	t.Parallel()
+
+	trailer := metadata.New(nil)
+	var resp grpc_testing.Empty
+	err := readGRPCWebFrames(grpcWebFrame(0, []byte("a"))[:4], protoV1.MessageV2(&resp), trailer)
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	err = readGRPCWebFrames(grpcWebFrame(grpcWebCompressedFlag, []byte("a")), protoV1.MessageV2(&resp), trailer)
+	assert.Equal(t, codes.Internal, status.Code(err))
+
+	err = readGRPCWebFrames(grpcWebFrame(grpcWebTrailerFlag, []byte("Grpc-Status: 7\r\ngrpc-message: no%20way\r\n")),
+		protoV1.MessageV2(&resp), trailer)
+	require.NoError(t, err)
+	err = grpcWebStatus(trailer)
+	assert.Equal(t, codes.PermissionDenied, status.Code(err))
+	assert.Equal(t, "no way", status.Convert(err).Message())
+	assert.Empty(t, trailer)
+
+	assert.Equal(t, codes.Internal, status.Code(grpcWebStatus(metadata.New(nil))))
+}
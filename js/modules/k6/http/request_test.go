@@ -54,6 +54,7 @@ import (
 	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/testutils"
 	"github.com/loadimpact/k6/lib/testutils/httpmultibin"
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -198,6 +199,24 @@ func newRuntime(
 	return tb, state, samples, rt, ctx
 }
 
+func TestRequestURLGrouping(t *testing.T) {
+	t.Parallel()
+	tb, state, samples, rt, _ := newRuntime(t)
+	defer tb.Cleanup()
+	sr := tb.Replacer.Replace
+
+	state.Options.URLGrouping = types.NullURLGrouping{Grouping: &types.URLGrouping{Enabled: true}, Valid: true}
+
+	_, err := rt.RunString(sr(`
+	http.get("HTTPBIN_URL/status/200");
+	http.get("HTTPBIN_URL/status/201", { tags: { name: "explicit" } });
+	`))
+	require.NoError(t, err)
+	bufSamples := stats.GetBufferedSamples(samples)
+	assertRequestMetricsEmitted(t, bufSamples, "GET", sr("HTTPBIN_URL/status/200"), sr("HTTPBIN_URL/status/{id}"), 200, "")
+	assertRequestMetricsEmitted(t, bufSamples, "GET", sr("HTTPBIN_URL/status/201"), "explicit", 201, "")
+}
+
 func TestRequestAndBatch(t *testing.T) {
 	t.Parallel()
 	tb, state, samples, rt, ctx := newRuntime(t)
@@ -1662,14 +1681,27 @@ func TestResponseTypes(t *testing.T) {
 		assert.True(t, bytes.Equal(binary, body))
 	}))
 
+	var gzipped bytes.Buffer
+	gw := gzip.NewWriter(&gzipped)
+	_, err := gw.Write([]byte(strings.Repeat(text, 10)))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	tb.Mux.HandleFunc("/get-gzip-text", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Encoding", "gzip")
+		_, err := w.Write(gzipped.Bytes())
+		assert.NoError(t, err)
+	}))
+
 	replace := func(s string) string {
 		return strings.NewReplacer(
+			"EXP_GZIP_SIZE", strconv.Itoa(gzipped.Len()),
+			"EXP_TEXT_SIZE", strconv.Itoa(len(text)),
 			"EXP_TEXT", text,
 			"EXP_BIN_LEN", strconv.Itoa(binaryLen),
 		).Replace(tb.Replacer.Replace(s))
 	}
 
-	_, err := rt.RunString(replace(`
+	_, err = rt.RunString(replace(`
 		var expText = "EXP_TEXT";
 		var expBinLength = EXP_BIN_LEN;
 
@@ -1681,10 +1713,14 @@ func TestResponseTypes(t *testing.T) {
 		http.post("HTTPBIN_URL/compare-text", respTextImplicit);
 
 		// Check discarding of responses
-		var respNone = http.get("HTTPBIN_URL/get-text", { responseType: "none" }).body;
+		var respNoneRes = http.get("HTTPBIN_URL/get-text", { responseType: "none" });
+		var respNone = respNoneRes.body;
 		if (respNone != null) {
 			throw new Error("none response body should be null but was " + respNone);
 		}
+		if (respNoneRes.body_size !== EXP_TEXT_SIZE) {
+			throw new Error("none response body size should be EXP_TEXT_SIZE but was " + respNoneRes.body_size);
+		}
 
 		// Check binary transmission of the text response as well
 		var respTextInBin = http.get("HTTPBIN_URL/get-text", { responseType: "binary" }).body;
@@ -1712,6 +1748,23 @@ func TestResponseTypes(t *testing.T) {
 			}
 		}
 		http.post("HTTPBIN_URL/compare-bin", respBin);
+
+		// Check that the size of compressed bodies is the received one; the
+		// header stops the test transport from transparently decompressing it
+		var gzipParams = { headers: { "Accept-Encoding": "gzip" } };
+		var respGzip = http.get("HTTPBIN_URL/get-gzip-text", gzipParams);
+		if (respGzip.body !== expText.repeat(10)) {
+			throw new Error("decompressed response body should be the repeated text but was '" + respGzip.body + "'");
+		}
+		if (respGzip.body_size !== EXP_GZIP_SIZE) {
+			throw new Error("compressed response body size should be EXP_GZIP_SIZE but was " + respGzip.body_size);
+		}
+		var respGzipNone = http.get("HTTPBIN_URL/get-gzip-text", {
+			headers: gzipParams.headers, responseType: "none",
+		});
+		if (respGzipNone.body_size !== EXP_GZIP_SIZE) {
+			throw new Error("none compressed response body size should be EXP_GZIP_SIZE but was " + respGzipNone.body_size);
+		}
 	`))
 	assert.NoError(t, err)
 
@@ -1728,7 +1781,11 @@ func TestResponseTypes(t *testing.T) {
 		}
 
 		// Check explicit text response
-		var respTextExplicit = http.get("HTTPBIN_URL/get-text", { responseType: "text" }).body;
+		var respTextExplicitRes = http.get("HTTPBIN_URL/get-text", { responseType: "text" });
+		if (respTextExplicitRes.body_size !== EXP_TEXT_SIZE) {
+			throw new Error("text response body size should be EXP_TEXT_SIZE but was " + respTextExplicitRes.body_size);
+		}
+		var respTextExplicit = respTextExplicitRes.body;
 		if (respTextExplicit !== expText) {
 			throw new Error("text response body should be '" + expText + "' but was '" + respTextExplicit + "'");
 		}
@@ -1979,7 +2036,7 @@ func TestRedirectMetricTags(t *testing.T) {
 
 	checkTags := func(sc stats.SampleContainer, expTags map[string]string) {
 		allSamples := sc.GetSamples()
-		assert.Len(t, allSamples, 9)
+		assert.Len(t, allSamples, 10)
 		for _, s := range allSamples {
 			assert.Equal(t, expTags, s.Tags.CloneTags())
 		}
@@ -117,6 +117,7 @@ func TestResponseCallbackInAction(t *testing.T) {
 	HTTPMetricsWithoutFailed := []*stats.Metric{
 		metrics.HTTPReqs,
 		metrics.HTTPReqBlocked,
+		metrics.HTTPReqDNSLookup,
 		metrics.HTTPReqConnecting,
 		metrics.HTTPReqDuration,
 		metrics.HTTPReqReceiving,
@@ -318,6 +319,7 @@ func TestResponseCallbackBatch(t *testing.T) {
 	HTTPMetricsWithoutFailed := []*stats.Metric{
 		metrics.HTTPReqs,
 		metrics.HTTPReqBlocked,
+		metrics.HTTPReqDNSLookup,
 		metrics.HTTPReqConnecting,
 		metrics.HTTPReqDuration,
 		metrics.HTTPReqReceiving,
@@ -433,6 +435,7 @@ func TestResponseCallbackInActionWithoutPassedTag(t *testing.T) {
 		metrics.HTTPReqs,
 		metrics.HTTPReqFailed,
 		metrics.HTTPReqBlocked,
+		metrics.HTTPReqDNSLookup,
 		metrics.HTTPReqConnecting,
 		metrics.HTTPReqDuration,
 		metrics.HTTPReqReceiving,
@@ -498,6 +501,7 @@ func TestDigestWithResponseCallback(t *testing.T) {
 		metrics.HTTPReqs,
 		metrics.HTTPReqFailed,
 		metrics.HTTPReqBlocked,
+		metrics.HTTPReqDNSLookup,
 		metrics.HTTPReqConnecting,
 		metrics.HTTPReqDuration,
 		metrics.HTTPReqReceiving,
@@ -54,7 +54,19 @@ type Metric struct {
 // ErrMetricsAddInInitContext is error returned when adding to metric is done in the init context
 var ErrMetricsAddInInitContext = common.NewInitContextError("Adding to metrics in the init context is not supported")
 
-func newMetric(ctxPtr *context.Context, name string, t stats.MetricType, isTime []bool) (interface{}, error) {
+// The value types implied by the units of custom metrics that aren't declared
+// as time metrics.
+var unitValueTypes = map[string]stats.ValueType{
+	"ms":    stats.Time,
+	"bytes": stats.Data,
+	"B":     stats.Data,
+}
+
+// newMetric creates a custom metric. The constructors accept an isTime boolean
+// and an object with the optional unit and description of the metric, e.g.
+// new Trend("name", true, {description: "..."}) or
+// new Counter("name", {unit: "bytes", description: "..."}).
+func newMetric(ctxPtr *context.Context, name string, t stats.MetricType, args []goja.Value) (interface{}, error) {
 	if lib.GetState(*ctxPtr) != nil {
 		return nil, errors.New("metrics must be declared in the init context")
 	}
@@ -65,12 +77,49 @@ func newMetric(ctxPtr *context.Context, name string, t stats.MetricType, isTime
 	}
 
 	valueType := stats.Default
-	if len(isTime) > 0 && isTime[0] {
-		valueType = stats.Time
+	var unit, description string
+	for i, arg := range args {
+		if goja.IsUndefined(arg) || goja.IsNull(arg) {
+			continue
+		}
+		switch v := arg.Export().(type) {
+		case bool:
+			if i > 0 {
+				return nil, fmt.Errorf("invalid argument %d of metric '%s', expected an object", i+2, name)
+			}
+			if v {
+				valueType = stats.Time
+			}
+		case map[string]interface{}:
+			for key, value := range v {
+				switch key {
+				case "unit":
+					unit = fmt.Sprint(value)
+				case "description":
+					description = fmt.Sprint(value)
+				default:
+					return nil, fmt.Errorf("unknown option '%s' of metric '%s'", key, name)
+				}
+			}
+		default:
+			return nil, fmt.Errorf("invalid argument %d of metric '%s', expected a boolean or an object", i+2, name)
+		}
 	}
 
+	if unit != "" {
+		impliedType, ok := unitValueTypes[unit]
+		switch {
+		case valueType == stats.Time && impliedType != stats.Time:
+			return nil, fmt.Errorf("the unit of the time metric '%s' should be 'ms', not '%s'", name, unit)
+		case ok:
+			valueType = impliedType
+		}
+	}
+
+	m := stats.New(name, t, valueType)
+	m.Unit, m.Description = unit, description
 	rt := common.GetRuntime(*ctxPtr)
-	return common.Bind(rt, Metric{stats.New(name, t, valueType)}, ctxPtr), nil
+	return common.Bind(rt, Metric{m}, ctxPtr), nil
 }
 
 func (m Metric) Add(ctx context.Context, v goja.Value, addTags ...map[string]string) (bool, error) {
@@ -102,18 +151,24 @@ func New() *Metrics {
 	return &Metrics{}
 }
 
-func (*Metrics) XCounter(ctx *context.Context, name string, isTime ...bool) (interface{}, error) {
-	return newMetric(ctx, name, stats.Counter, isTime)
+func (*Metrics) XCounter(ctx *context.Context, name string, args ...goja.Value) (interface{}, error) {
+	return newMetric(ctx, name, stats.Counter, args)
+}
+
+func (*Metrics) XGauge(ctx *context.Context, name string, args ...goja.Value) (interface{}, error) {
+	return newMetric(ctx, name, stats.Gauge, args)
 }
 
-func (*Metrics) XGauge(ctx *context.Context, name string, isTime ...bool) (interface{}, error) {
-	return newMetric(ctx, name, stats.Gauge, isTime)
+func (*Metrics) XTrend(ctx *context.Context, name string, args ...goja.Value) (interface{}, error) {
+	return newMetric(ctx, name, stats.Trend, args)
 }
 
-func (*Metrics) XTrend(ctx *context.Context, name string, isTime ...bool) (interface{}, error) {
-	return newMetric(ctx, name, stats.Trend, isTime)
+func (*Metrics) XRate(ctx *context.Context, name string, args ...goja.Value) (interface{}, error) {
+	return newMetric(ctx, name, stats.Rate, args)
 }
 
-func (*Metrics) XRate(ctx *context.Context, name string, isTime ...bool) (interface{}, error) {
-	return newMetric(ctx, name, stats.Rate, isTime)
+// XHistogram is the JS constructor of histogram metrics, which are like trends
+// but with a bounded memory usage and approximate percentiles.
+func (*Metrics) XHistogram(ctx *context.Context, name string, args ...goja.Value) (interface{}, error) {
+	return newMetric(ctx, name, stats.Histogram, args)
 }
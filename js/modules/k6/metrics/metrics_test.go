@@ -37,10 +37,11 @@ import (
 func TestMetrics(t *testing.T) {
 	t.Parallel()
 	types := map[string]stats.MetricType{
-		"Counter": stats.Counter,
-		"Gauge":   stats.Gauge,
-		"Trend":   stats.Trend,
-		"Rate":    stats.Rate,
+		"Counter":   stats.Counter,
+		"Gauge":     stats.Gauge,
+		"Trend":     stats.Trend,
+		"Rate":      stats.Rate,
+		"Histogram": stats.Histogram,
 	}
 	values := map[string]struct {
 		JS    string
@@ -171,3 +172,50 @@ func TestMetricNames(t *testing.T) {
 		})
 	}
 }
+
+func TestMetricMetadata(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		args, err   string
+		contains    stats.ValueType
+		unit, descr string
+	}{
+		{args: ``, contains: stats.Default},
+		{args: `, true, {description: "Time to checkout"}`, contains: stats.Time, descr: "Time to checkout"},
+		{args: `, {unit: "bytes", description: "Upload size"}`, contains: stats.Data, unit: "bytes", descr: "Upload size"},
+		{args: `, false, {unit: "ms"}`, contains: stats.Time, unit: "ms"},
+		{args: `, undefined, {unit: "req"}`, contains: stats.Default, unit: "req"},
+		{args: `, true, {unit: "bytes"}`, err: "the unit of the time metric 'my_metric' should be 'ms', not 'bytes'"},
+		{args: `, {units: "ms"}`, err: "unknown option 'units' of metric 'my_metric'"},
+		{args: `, "ms"`, err: "invalid argument 2 of metric 'my_metric', expected a boolean or an object"},
+		{args: `, {}, true`, err: "invalid argument 3 of metric 'my_metric', expected an object"},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(tc.args, func(t *testing.T) {
+			t.Parallel()
+			rt := goja.New()
+			rt.SetFieldNameMapper(common.FieldNameMapper{})
+			ctxPtr := new(context.Context)
+			*ctxPtr = common.WithRuntime(context.Background(), rt)
+			rt.Set("metrics", common.Bind(rt, New(), ctxPtr))
+
+			_, err := rt.RunString(fmt.Sprintf(`var m = new metrics.Counter("my_metric"%s)`, tc.args))
+			if tc.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			samples := make(chan stats.SampleContainer, 1)
+			*ctxPtr = lib.WithState(*ctxPtr, &lib.State{Samples: samples})
+			_, err = rt.RunString(`m.add(1)`)
+			require.NoError(t, err)
+			metric := (<-samples).(stats.Sample).Metric
+			assert.Equal(t, tc.contains, metric.Contains)
+			assert.Equal(t, tc.unit, metric.Unit)
+			assert.Equal(t, tc.descr, metric.Description)
+		})
+	}
+}
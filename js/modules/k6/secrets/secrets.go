@@ -0,0 +1,60 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package secrets implements the k6/secrets module, which allows scripts to get
+// secret values from the sources configured with the --secret-source option.
+package secrets
+
+import (
+	"context"
+	"errors"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/js/internal/modules"
+	"github.com/loadimpact/k6/lib"
+	libsecrets "github.com/loadimpact/k6/lib/secrets"
+)
+
+func init() {
+	modules.Register("k6/secrets", New())
+}
+
+// Secrets is the k6/secrets module.
+type Secrets struct{}
+
+// New returns a new k6/secrets module.
+func New() *Secrets {
+	return &Secrets{}
+}
+
+// Get returns the value of the secret with the given name. It can be called
+// both in the init context and while VU code is running.
+func (*Secrets) Get(ctx context.Context, name string) (string, error) {
+	var manager *libsecrets.Manager
+	if state := lib.GetState(ctx); state != nil {
+		manager = state.Secrets
+	} else if initEnv := common.GetInitEnv(ctx); initEnv != nil {
+		manager = initEnv.Secrets
+	}
+	if manager == nil {
+		return "", errors.New("secrets are not available in this context")
+	}
+	return manager.Get(ctx, name)
+}
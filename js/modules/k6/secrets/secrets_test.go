@@ -0,0 +1,90 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	libsecrets "github.com/loadimpact/k6/lib/secrets"
+)
+
+type mapSource map[string]string
+
+func (m mapSource) Description() string { return "map" }
+
+func (m mapSource) Get(_ context.Context, name string) (string, error) {
+	if v, ok := m[name]; ok {
+		return v, nil
+	}
+	return "", libsecrets.ErrNotFound
+}
+
+func TestSecretsGet(t *testing.T) {
+	t.Parallel()
+	manager := libsecrets.NewManager(mapSource{"token": "abc"})
+
+	t.Run("init context", func(t *testing.T) {
+		t.Parallel()
+		rt := goja.New()
+		rt.SetFieldNameMapper(common.FieldNameMapper{})
+		ctx := common.WithInitEnv(context.Background(), &common.InitEnvironment{Secrets: manager})
+		ctx = common.WithRuntime(ctx, rt)
+		rt.Set("secrets", common.Bind(rt, New(), &ctx))
+
+		v, err := rt.RunString(`secrets.get("token")`)
+		require.NoError(t, err)
+		assert.Equal(t, "abc", v.String())
+
+		_, err = rt.RunString(`secrets.get("missing")`)
+		assert.Contains(t, err.Error(), "secret 'missing' was not found")
+	})
+
+	t.Run("VU context", func(t *testing.T) {
+		t.Parallel()
+		rt := goja.New()
+		rt.SetFieldNameMapper(common.FieldNameMapper{})
+		ctx := lib.WithState(context.Background(), &lib.State{Secrets: manager})
+		ctx = common.WithRuntime(ctx, rt)
+		rt.Set("secrets", common.Bind(rt, New(), &ctx))
+
+		v, err := rt.RunString(`secrets.get("token")`)
+		require.NoError(t, err)
+		assert.Equal(t, "abc", v.String())
+	})
+
+	t.Run("unavailable", func(t *testing.T) {
+		t.Parallel()
+		rt := goja.New()
+		rt.SetFieldNameMapper(common.FieldNameMapper{})
+		ctx := common.WithRuntime(context.Background(), rt)
+		rt.Set("secrets", common.Bind(rt, New(), &ctx))
+
+		_, err := rt.RunString(`secrets.get("token")`)
+		assert.Contains(t, err.Error(), "secrets are not available")
+	})
+}
@@ -40,6 +40,7 @@ import (
 	"github.com/loadimpact/k6/js/internal/modules"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -50,7 +51,11 @@ func init() {
 // ErrWSInInitContext is returned when websockets are using in the init context
 var ErrWSInInitContext = common.NewInitContextError("using websockets in the init context is not supported")
 
-type WS struct{}
+// WS is the k6/ws module. It keeps the persistent connections of all VUs.
+type WS struct {
+	persistentMu    sync.Mutex
+	persistentConns map[*lib.State]map[string]*wsConn
+}
 
 type Socket struct {
 	ctx           context.Context
@@ -63,8 +68,108 @@ type Socket struct {
 	pingSendTimestamps map[string]time.Time
 	pingSendCounter    int
 
+	// Automatic pings, sent every autoPingInterval if it's set
+	autoPingInterval   time.Duration
+	autoPingTimeout    time.Duration
+	autoPingTimestamps map[string]time.Time
+	autoPingCounter    int
+
 	sampleTags    *stats.SampleTags
 	samplesOutput chan<- stats.SampleContainer
+
+	// The underlying connection, which outlives the socket if it's persistent
+	wsc        *wsConn
+	connClosed chan struct{}
+	persistent bool
+	released   bool
+	queued     [][]byte // received while the connection was released
+}
+
+// wsConn is a WebSocket connection with the channels its readPump feeds. A
+// persistent connection is kept open between the ws.connect() calls of a VU,
+// so every call uses a new Socket for the same wsConn.
+type wsConn struct {
+	conn     *websocket.Conn
+	start    time.Time
+	tags     map[string]string // the tags from the handshake, like ip and status
+	response *WSHTTPResponse
+
+	pingChan      chan string
+	pongChan      chan string
+	readDataChan  chan []byte
+	readErrChan   chan error
+	readCloseChan chan int
+
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// Set while the connection is released, see idle()
+	stopIdle chan struct{}
+	idleDone chan struct{}
+	queued   [][]byte
+}
+
+// release starts consuming the events of the connection, which isn't used by
+// any socket anymore, until the next acquire.
+func (c *wsConn) release() {
+	c.stopIdle, c.idleDone = make(chan struct{}), make(chan struct{})
+	go c.idle(c.stopIdle, c.idleDone)
+}
+
+// acquire stops consuming the events of a released connection and returns the
+// messages received in the meantime, so it can be used by a new socket.
+func (c *wsConn) acquire() [][]byte {
+	close(c.stopIdle)
+	<-c.idleDone
+	queued := c.queued
+	c.stopIdle, c.idleDone, c.queued = nil, nil, nil
+	return queued
+}
+
+// idle answers the pings of the server and queues the received messages while
+// the connection is released, so the server doesn't drop the connection and
+// the next socket gets the messages. Only the last maxQueuedMessages are kept.
+// Pongs and read errors are dropped, and the connection is closed if the
+// server closes it.
+func (c *wsConn) idle(stop, done chan struct{}) {
+	defer close(done)
+	for {
+		select {
+		case pingData := <-c.pingChan:
+			_ = c.conn.WriteControl(websocket.PongMessage, []byte(pingData), time.Now().Add(writeWait))
+		case <-c.pongChan:
+		case readData := <-c.readDataChan:
+			if len(c.queued) == maxQueuedMessages {
+				c.queued = c.queued[1:]
+			}
+			c.queued = append(c.queued, readData)
+		case <-c.readErrChan:
+		case <-c.readCloseChan:
+			c.close()
+			return
+		case <-c.closed:
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+func (c *wsConn) close() {
+	c.closeOnce.Do(func() {
+		_ = c.conn.Close()
+		close(c.closed)
+	})
+}
+
+// closeGoingAway closes a connection that isn't used by any socket, without
+// calling any event handlers.
+func (c *wsConn) closeGoingAway() {
+	_ = c.conn.WriteControl(websocket.CloseMessage,
+		websocket.FormatCloseMessage(websocket.CloseGoingAway, ""),
+		time.Now().Add(writeWait),
+	)
+	c.close()
 }
 
 type WSHTTPResponse struct {
@@ -75,13 +180,23 @@ type WSHTTPResponse struct {
 	Error   string            `json:"error"`
 }
 
-const writeWait = 10 * time.Second
+const (
+	writeWait = 10 * time.Second
+
+	// The payload prefix that distinguishes automatic pings from ones sent by
+	// socket.ping(), which use just the counter as a payload
+	autoPingPrefix = "k6-auto-"
+
+	// The maximum number of messages kept for the next socket while a
+	// persistent connection is released. Older messages are dropped.
+	maxQueuedMessages = 1000
+)
 
 func New() *WS {
-	return &WS{}
+	return &WS{persistentConns: make(map[*lib.State]map[string]*wsConn)}
 }
 
-func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTPResponse, error) {
+func (ws *WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTPResponse, error) {
 	rt := common.GetRuntime(ctx)
 	state := lib.GetState(ctx)
 	if state == nil {
@@ -111,6 +226,8 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 	var header http.Header
 
 	tags := state.CloneTags()
+	persistent := false
+	var autoPingInterval, autoPingTimeout time.Duration
 
 	// Parse the optional second argument (params)
 	if !goja.IsUndefined(paramsV) && !goja.IsNull(paramsV) {
@@ -142,15 +259,52 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 				for _, key := range tagObj.Keys() {
 					tags[key] = tagObj.Get(key).String()
 				}
+			case "persistent":
+				persistent = params.Get(k).ToBoolean()
+			case "pingInterval":
+				var err error
+				if autoPingInterval, err = types.GetDurationValue(params.Get(k).Export()); err != nil {
+					return nil, fmt.Errorf("invalid pingInterval: %w", err)
+				}
+			case "pingTimeout":
+				var err error
+				if autoPingTimeout, err = types.GetDurationValue(params.Get(k).Export()); err != nil {
+					return nil, fmt.Errorf("invalid pingTimeout: %w", err)
+				}
 			}
 		}
 
 	}
 
+	if autoPingInterval < 0 || autoPingTimeout < 0 {
+		return nil, errors.New("pingInterval and pingTimeout can't be negative")
+	}
+	if autoPingTimeout == 0 {
+		// By default, a pong is missed if it doesn't arrive before the next ping
+		autoPingTimeout = autoPingInterval
+	}
+
 	if state.Options.SystemTags.Has(stats.TagURL) {
 		tags["url"] = url
 	}
 
+	// Reuse the connection that a previous iteration has released, if any,
+	// unless the server has closed it in the meantime
+	if persistent {
+		if wsc := ws.takePersistentConn(state, url); wsc != nil {
+			if queued := wsc.acquire(); !isClosed(wsc.closed) {
+				for k, v := range wsc.tags {
+					tags[k] = v
+				}
+				socket := newSocket(ctx, wsc, state.Samples, stats.IntoSampleTags(&tags))
+				socket.persistent = true
+				socket.autoPingInterval, socket.autoPingTimeout = autoPingInterval, autoPingTimeout
+				socket.queued = queued
+				return ws.runSession(ctx, state, url, socket, setupFn)
+			}
+		}
+	}
+
 	// Overriding the NextProtos to avoid talking http2
 	var tlsConfig *tls.Config
 	if state.TLSConfig != nil {
@@ -158,12 +312,18 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 		tlsConfig.NextProtos = []string{"http/1.1"}
 	}
 
+	// use the proxies of the scenario, if it has its own
+	proxy := http.ProxyFromEnvironment
+	if t, ok := state.Transport.(*http.Transport); ok && t.Proxy != nil {
+		proxy = t.Proxy
+	}
+
 	wsd := websocket.Dialer{
 		HandshakeTimeout: time.Second * 60, // TODO configurable
 		// Pass a custom net.DialContext function to websocket.Dialer that will substitute
 		// the underlying net.Conn with our own tracked netext.Conn
 		NetDialContext:  state.Dialer.DialContext,
-		Proxy:           http.ProxyFromEnvironment,
+		Proxy:           proxy,
 		TLSClientConfig: tlsConfig,
 	}
 
@@ -172,32 +332,40 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 	connectionEnd := time.Now()
 	connectionDuration := stats.D(connectionEnd.Sub(start))
 
+	connTags := make(map[string]string)
 	if state.Options.SystemTags.Has(stats.TagIP) && conn.RemoteAddr() != nil {
 		if ip, _, err := net.SplitHostPort(conn.RemoteAddr().String()); err == nil {
-			tags["ip"] = ip
+			connTags["ip"] = ip
 		}
 	}
 
 	if httpResponse != nil {
 		if state.Options.SystemTags.Has(stats.TagStatus) {
-			tags["status"] = strconv.Itoa(httpResponse.StatusCode)
+			connTags["status"] = strconv.Itoa(httpResponse.StatusCode)
 		}
 
 		if state.Options.SystemTags.Has(stats.TagSubproto) {
-			tags["subproto"] = httpResponse.Header.Get("Sec-WebSocket-Protocol")
+			connTags["subproto"] = httpResponse.Header.Get("Sec-WebSocket-Protocol")
 		}
 	}
+	for k, v := range connTags {
+		tags[k] = v
+	}
 
-	socket := Socket{
-		ctx:                ctx,
-		conn:               conn,
-		eventHandlers:      make(map[string][]goja.Callable),
-		pingSendTimestamps: make(map[string]time.Time),
-		scheduled:          make(chan goja.Callable),
-		done:               make(chan struct{}),
-		samplesOutput:      state.Samples,
-		sampleTags:         stats.IntoSampleTags(&tags),
+	wsc := &wsConn{
+		conn:          conn,
+		start:         start,
+		tags:          connTags,
+		pingChan:      make(chan string),
+		pongChan:      make(chan string),
+		readDataChan:  make(chan []byte),
+		readErrChan:   make(chan error),
+		readCloseChan: make(chan int),
+		closed:        make(chan struct{}),
 	}
+	socket := newSocket(ctx, wsc, state.Samples, stats.IntoSampleTags(&tags))
+	socket.persistent = persistent
+	socket.autoPingInterval, socket.autoPingTimeout = autoPingInterval, autoPingTimeout
 
 	stats.PushIfNotDone(ctx, state.Samples, stats.ConnectedSamples{
 		Samples: []stats.Sample{
@@ -215,22 +383,13 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 		return nil, connErr
 	}
 
-	// Run the user-provided set up function
-	if _, err := setupFn(goja.Undefined(), rt.ToValue(&socket)); err != nil {
-		_ = socket.closeConnection(websocket.CloseGoingAway)
-		return nil, err
-	}
-
 	wsResponse, wsRespErr := wrapHTTPResponse(httpResponse)
 	if wsRespErr != nil {
+		_ = conn.Close()
 		return nil, wsRespErr
 	}
 	wsResponse.URL = url
-
-	defer func() { _ = conn.Close() }()
-
-	// The connection is now open, emit the event
-	socket.handleEvent("open")
+	wsc.response = wsResponse
 
 	// Make the default close handler a noop to avoid duplicate closes,
 	// since we use custom closing logic to call user's event
@@ -240,37 +399,127 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 	conn.SetCloseHandler(func(code int, text string) error { return nil })
 
 	// Pass ping/pong events through the main control loop
-	pingChan := make(chan string)
-	pongChan := make(chan string)
-	conn.SetPingHandler(func(msg string) error { pingChan <- msg; return nil })
-	conn.SetPongHandler(func(pingID string) error { pongChan <- pingID; return nil })
-
-	readDataChan := make(chan []byte)
-	readCloseChan := make(chan int)
-	readErrChan := make(chan error)
+	conn.SetPingHandler(func(msg string) error {
+		select {
+		case wsc.pingChan <- msg:
+		case <-wsc.closed:
+		}
+		return nil
+	})
+	conn.SetPongHandler(func(pingID string) error {
+		select {
+		case wsc.pongChan <- pingID:
+		case <-wsc.closed:
+		}
+		return nil
+	})
 
 	// Wraps a couple of channels around conn.ReadMessage
-	go socket.readPump(readDataChan, readErrChan, readCloseChan)
+	go socket.readPump(wsc.readDataChan, wsc.readErrChan, wsc.readCloseChan)
+
+	if persistent {
+		// Close the connection when the VU is done, even if it isn't in use
+		go func() {
+			select {
+			case <-ctx.Done():
+				if ws.removePersistentConn(state, url, wsc) {
+					wsc.closeGoingAway()
+				}
+			case <-wsc.closed:
+			}
+		}()
+	}
+
+	return ws.runSession(ctx, state, url, socket, setupFn)
+}
+
+func newSocket(
+	ctx context.Context, wsc *wsConn, samplesOutput chan<- stats.SampleContainer, sampleTags *stats.SampleTags,
+) *Socket {
+	return &Socket{
+		ctx:                ctx,
+		conn:               wsc.conn,
+		eventHandlers:      make(map[string][]goja.Callable),
+		pingSendTimestamps: make(map[string]time.Time),
+		autoPingTimestamps: make(map[string]time.Time),
+		scheduled:          make(chan goja.Callable),
+		done:               make(chan struct{}),
+		samplesOutput:      samplesOutput,
+		sampleTags:         sampleTags,
+		wsc:                wsc,
+		connClosed:         wsc.closed,
+	}
+}
+
+// runSession runs the user-provided set up function for the socket and then
+// its event loop, until the socket is closed or released.
+func (ws *WS) runSession(
+	ctx context.Context, state *lib.State, url string, socket *Socket, setupFn goja.Callable,
+) (*WSHTTPResponse, error) {
+	rt := common.GetRuntime(ctx)
+	wsc := socket.wsc
+
+	// Run the user-provided set up function
+	if _, err := setupFn(goja.Undefined(), rt.ToValue(socket)); err != nil {
+		_ = socket.closeConnection(websocket.CloseGoingAway)
+		return nil, err
+	}
+
+	// The connection is now open, emit the event
+	socket.handleEvent("open")
+
+	// Deliver the messages received while a persistent connection was released
+	for _, readData := range socket.queued {
+		if socket.released || isClosed(socket.done) {
+			break
+		}
+		socket.handleMessage(readData)
+	}
+	socket.queued = nil
 
 	// we do it here as below we can panic, which translates to an exception in js code
 	defer func() {
+		if socket.released {
+			// Keep the connection open for the next iterations of the VU,
+			// unless the VU is already done
+			if ctx.Err() == nil {
+				wsc.release()
+				ws.putPersistentConn(state, url, wsc)
+			} else {
+				wsc.closeGoingAway()
+			}
+			return
+		}
 		socket.Close() // just in case
 		end := time.Now()
-		sessionDuration := stats.D(end.Sub(start))
+		sessionDuration := stats.D(end.Sub(wsc.start))
 
 		stats.PushIfNotDone(ctx, state.Samples, stats.Sample{
 			Metric: metrics.WSSessionDuration,
 			Tags:   socket.sampleTags,
-			Time:   start,
+			Time:   wsc.start,
 			Value:  sessionDuration,
 		})
 	}()
 
+	var autoPingTick <-chan time.Time
+	if socket.autoPingInterval > 0 {
+		autoPingTicker := time.NewTicker(socket.autoPingInterval)
+		defer autoPingTicker.Stop()
+		autoPingTick = autoPingTicker.C
+	}
+
 	// This is the main control loop. All JS code (including error handlers)
 	// should only be executed by this thread to avoid race conditions
 	for {
+		// Don't consume any more events for a released socket, they are
+		// for the next session of the persistent connection
+		if socket.released {
+			return wsc.response, nil
+		}
+
 		select {
-		case pingData := <-pingChan:
+		case pingData := <-wsc.pingChan:
 			// Handle pings received from the server
 			// - trigger the `ping` event
 			// - reply with pong (needed when `SetPingHandler` is overwritten)
@@ -280,24 +529,25 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 			}
 			socket.handleEvent("ping")
 
-		case pingID := <-pongChan:
+		case pingID := <-wsc.pongChan:
 			// Handle pong responses to our pings
+			if strings.HasPrefix(pingID, autoPingPrefix) {
+				socket.trackAutoPong(pingID)
+				continue
+			}
 			socket.trackPong(pingID)
 			socket.handleEvent("pong")
 
-		case readData := <-readDataChan:
-			stats.PushIfNotDone(ctx, socket.samplesOutput, stats.Sample{
-				Metric: metrics.WSMessagesReceived,
-				Time:   time.Now(),
-				Tags:   socket.sampleTags,
-				Value:  1,
-			})
-			socket.handleEvent("message", rt.ToValue(string(readData)))
+		case <-autoPingTick:
+			socket.autoPing()
 
-		case readErr := <-readErrChan:
+		case readData := <-wsc.readDataChan:
+			socket.handleMessage(readData)
+
+		case readErr := <-wsc.readErrChan:
 			socket.handleEvent("error", rt.ToValue(readErr))
 
-		case code := <-readCloseChan:
+		case code := <-wsc.readCloseChan:
 			_ = socket.closeConnection(code)
 
 		case scheduledFn := <-socket.scheduled:
@@ -313,11 +563,78 @@ func (*WS) Connect(ctx context.Context, url string, args ...goja.Value) (*WSHTTP
 
 		case <-socket.done:
 			// This is the final exit point normally triggered by closeConnection
-			return wsResponse, nil
+			return wsc.response, nil
 		}
 	}
 }
 
+// takePersistentConn removes the released persistent connection to the URL
+// from the VU's connections and returns it, or nil if there's none.
+func (ws *WS) takePersistentConn(state *lib.State, url string) *wsConn {
+	ws.persistentMu.Lock()
+	defer ws.persistentMu.Unlock()
+	wsc := ws.persistentConns[state][url]
+	if wsc != nil {
+		ws.deletePersistentConn(state, url)
+	}
+	return wsc
+}
+
+// putPersistentConn keeps the released persistent connection for the next
+// iterations of the VU. Any other connection to the same URL that was
+// released in the meantime is closed.
+func (ws *WS) putPersistentConn(state *lib.State, url string, wsc *wsConn) {
+	ws.persistentMu.Lock()
+	defer ws.persistentMu.Unlock()
+	conns, ok := ws.persistentConns[state]
+	if !ok {
+		conns = make(map[string]*wsConn)
+		ws.persistentConns[state] = conns
+	}
+	if prev, ok := conns[url]; ok && prev != wsc {
+		prev.close()
+	}
+	conns[url] = wsc
+}
+
+// removePersistentConn removes the given persistent connection from the VU's
+// connections and reports whether it was there, i.e. not in use.
+func (ws *WS) removePersistentConn(state *lib.State, url string, wsc *wsConn) bool {
+	ws.persistentMu.Lock()
+	defer ws.persistentMu.Unlock()
+	if ws.persistentConns[state][url] != wsc {
+		return false
+	}
+	ws.deletePersistentConn(state, url)
+	return true
+}
+
+func (ws *WS) deletePersistentConn(state *lib.State, url string) {
+	delete(ws.persistentConns[state], url)
+	if len(ws.persistentConns[state]) == 0 {
+		delete(ws.persistentConns, state)
+	}
+}
+
+func isClosed(ch chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s *Socket) handleMessage(data []byte) {
+	stats.PushIfNotDone(s.ctx, s.samplesOutput, stats.Sample{
+		Metric: metrics.WSMessagesReceived,
+		Time:   time.Now(),
+		Tags:   s.sampleTags,
+		Value:  1,
+	})
+	s.handleEvent("message", common.GetRuntime(s.ctx).ToValue(string(data)))
+}
+
 func (s *Socket) On(event string, handler goja.Value) {
 	if handler, ok := goja.AssertFunction(handler); ok {
 		s.eventHandlers[event] = append(s.eventHandlers[event], handler)
@@ -386,6 +703,54 @@ func (s *Socket) trackPong(pingID string) {
 	})
 }
 
+// autoPing counts the automatic pings that weren't answered in time as missed
+// and sends a new one.
+func (s *Socket) autoPing() {
+	now := time.Now()
+	missed := 0
+	for pingID, sent := range s.autoPingTimestamps {
+		if now.Sub(sent) >= s.autoPingTimeout {
+			delete(s.autoPingTimestamps, pingID)
+			missed++
+		}
+	}
+	if missed > 0 {
+		stats.PushIfNotDone(s.ctx, s.samplesOutput, stats.Sample{
+			Metric: metrics.WSPongsMissed,
+			Time:   now,
+			Tags:   s.sampleTags,
+			Value:  float64(missed),
+		})
+	}
+
+	pingID := autoPingPrefix + strconv.Itoa(s.autoPingCounter)
+	s.autoPingCounter++
+	err := s.conn.WriteControl(websocket.PingMessage, []byte(pingID), now.Add(writeWait))
+	if err != nil {
+		s.handleEvent("error", common.GetRuntime(s.ctx).ToValue(err))
+		return
+	}
+	s.autoPingTimestamps[pingID] = now
+}
+
+// trackAutoPong emits the round-trip time of an automatic ping, unless its
+// pong arrived too late and the ping was already counted as missed.
+func (s *Socket) trackAutoPong(pingID string) {
+	pongTimestamp := time.Now()
+	pingTimestamp, ok := s.autoPingTimestamps[pingID]
+	if !ok {
+		return
+	}
+	delete(s.autoPingTimestamps, pingID)
+
+	stats.PushIfNotDone(s.ctx, s.samplesOutput, stats.Sample{
+		Metric: metrics.WSPingDuration,
+		Time:   pongTimestamp,
+		Tags:   s.sampleTags,
+		Value:  stats.D(pongTimestamp.Sub(pingTimestamp)),
+	})
+}
+
 // SetTimeout executes the provided function inside the socket's event loop after at least the provided
 // timeout, which is in ms, has elapsed
 func (s *Socket) SetTimeout(fn goja.Callable, timeoutMs float64) error {
@@ -458,6 +823,21 @@ func (s *Socket) Close(args ...goja.Value) {
 	_ = s.closeConnection(code)
 }
 
+// Release ends the ws.connect() call of a persistent socket without closing
+// its connection, so a later ws.connect() to the same URL in the same VU can
+// reuse it. While it's released, the pings of the server are answered and up
+// to maxQueuedMessages received messages are kept for the next session. The
+// connection is closed when the VU finishes its scenario.
+func (s *Socket) Release() {
+	if !s.persistent {
+		common.Throw(common.GetRuntime(s.ctx), errors.New("only persistent sockets can be released"))
+	}
+	s.shutdownOnce.Do(func() {
+		s.released = true
+		close(s.done)
+	})
+}
+
 // closeConnection cleanly closes the WebSocket connection.
 // Returns an error if sending the close control frame fails.
 func (s *Socket) closeConnection(code int) error {
@@ -467,7 +847,7 @@ func (s *Socket) closeConnection(code int) error {
 		// this is because handleEvent can panic ... on purpose so we just make sure we
 		// close the connection and the channel
 		defer func() {
-			_ = s.conn.Close()
+			s.wsc.close()
 
 			// Stop the main control loop
 			close(s.done)
@@ -500,7 +880,7 @@ func (s *Socket) readPump(readChan chan []byte, errorChan chan error, closeChan
 				// Report an unexpected closure
 				select {
 				case errorChan <- err:
-				case <-s.done:
+				case <-s.connClosed:
 					return
 				}
 			}
@@ -510,14 +890,14 @@ func (s *Socket) readPump(readChan chan []byte, errorChan chan error, closeChan
 			}
 			select {
 			case closeChan <- code:
-			case <-s.done:
+			case <-s.connClosed:
 			}
 			return
 		}
 
 		select {
 		case readChan <- message:
-		case <-s.done:
+		case <-s.connClosed:
 			return
 		}
 	}
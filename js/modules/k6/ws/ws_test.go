@@ -23,9 +23,11 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -347,6 +349,311 @@ func TestSession(t *testing.T) {
 	}
 }
 
+func countMetricSamples(sampleContainers []stats.SampleContainer, metric *stats.Metric) int {
+	count := 0
+	for _, sampleContainer := range sampleContainers {
+		for _, sample := range sampleContainer.GetSamples() {
+			if sample.Metric == metric {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestPersistentSession(t *testing.T) {
+	t.Parallel()
+	// Unlike the httpmultibin one, this server echoes every message
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, w.Header())
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		for {
+			messageType, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err = conn.WriteMessage(messageType, data); err != nil {
+				return
+			}
+		}
+	}))
+	defer srv.Close()
+	srvURL := "ws://" + srv.Listener.Addr().String()
+	sr := strings.NewReplacer("WSBIN_URL", srvURL).Replace
+
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	samples := make(chan stats.SampleContainer, 1000)
+	state := &lib.State{
+		Group:  root,
+		Dialer: &net.Dialer{},
+		Options: lib.Options{
+			SystemTags: stats.NewSystemTagSet(stats.TagURL, stats.TagStatus),
+		},
+		Samples: samples,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = lib.WithState(ctx, state)
+	ctx = common.WithRuntime(ctx, rt)
+
+	m := New()
+	rt.Set("ws", common.Bind(rt, m, &ctx))
+
+	_, err = rt.RunString(sr(`
+	function iteration(msg, release) {
+		var received = null;
+		var res = ws.connect("WSBIN_URL", { persistent: true }, function(socket){
+			socket.on("open", function() {
+				socket.send(msg);
+			});
+			socket.on("message", function(data) {
+				received = data;
+				if (release) {
+					socket.release();
+				} else {
+					socket.close();
+				}
+			});
+		});
+		if (res.status != 101) { throw new Error("unexpected status " + res.status); }
+		if (received !== msg) { throw new Error("unexpected message " + received); }
+	}
+	`))
+	require.NoError(t, err)
+
+	t.Run("reuse", func(t *testing.T) {
+		_, err := rt.RunString(`iteration("first", true); iteration("second", true);`)
+		require.NoError(t, err)
+
+		samplesBuf := stats.GetBufferedSamples(samples)
+		assert.Equal(t, 1, countMetricSamples(samplesBuf, metrics.WSSessions))
+		assert.Equal(t, 1, countMetricSamples(samplesBuf, metrics.WSConnecting))
+		assert.Equal(t, 0, countMetricSamples(samplesBuf, metrics.WSSessionDuration))
+		assert.Equal(t, 2, countMetricSamples(samplesBuf, metrics.WSMessagesSent))
+		assert.Equal(t, 2, countMetricSamples(samplesBuf, metrics.WSMessagesReceived))
+	})
+
+	t.Run("close", func(t *testing.T) {
+		_, err := rt.RunString(`iteration("third", false);`)
+		require.NoError(t, err)
+		m.persistentMu.Lock()
+		assert.Empty(t, m.persistentConns)
+		m.persistentMu.Unlock()
+
+		samplesBuf := stats.GetBufferedSamples(samples)
+		assert.Equal(t, 0, countMetricSamples(samplesBuf, metrics.WSSessions))
+		assert.Equal(t, 1, countMetricSamples(samplesBuf, metrics.WSSessionDuration))
+
+		_, err = rt.RunString(`iteration("fourth", false);`)
+		require.NoError(t, err)
+		assert.Equal(t, 1, countMetricSamples(stats.GetBufferedSamples(samples), metrics.WSSessions))
+	})
+
+	t.Run("release non-persistent", func(t *testing.T) {
+		_, err := rt.RunString(sr(`
+		ws.connect("WSBIN_URL/ws-echo", function(socket){
+			socket.on("open", function() {
+				socket.release();
+			});
+		});
+		`))
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "only persistent sockets can be released")
+	})
+
+	t.Run("closed when the VU is done", func(t *testing.T) {
+		_, err := rt.RunString(`iteration("fifth", true);`)
+		require.NoError(t, err)
+
+		m.persistentMu.Lock()
+		wsc := m.persistentConns[state][srvURL]
+		m.persistentMu.Unlock()
+		require.NotNil(t, wsc)
+
+		cancel()
+		select {
+		case <-wsc.closed:
+		case <-time.After(5 * time.Second):
+			t.Fatal("the persistent connection wasn't closed")
+		}
+		m.persistentMu.Lock()
+		assert.Empty(t, m.persistentConns)
+		m.persistentMu.Unlock()
+	})
+}
+
+func TestPersistentSessionReleased(t *testing.T) {
+	t.Parallel()
+	// On "burst", the server sends more messages than are kept for a released
+	// connection, then a ping, and reports whether it got the pong
+	ponged := make(chan bool, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, w.Header())
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		pong := make(chan struct{}, 1)
+		conn.SetPongHandler(func(string) error {
+			pong <- struct{}{}
+			return nil
+		})
+		go func() {
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}()
+		for i := 0; i < maxQueuedMessages+2; i++ {
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(strconv.Itoa(i))); err != nil {
+				return
+			}
+		}
+		if err := conn.WriteControl(websocket.PingMessage, []byte("keepalive"), time.Now().Add(time.Second)); err != nil {
+			return
+		}
+		select {
+		case <-pong:
+			ponged <- true
+		case <-time.After(2 * time.Second):
+			ponged <- false
+		}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+	sr := strings.NewReplacer("WSBIN_URL", "ws://"+srv.Listener.Addr().String()).Replace
+
+	root, err := lib.NewGroup("", nil)
+	require.NoError(t, err)
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	samples := make(chan stats.SampleContainer, 5000)
+	state := &lib.State{
+		Group:   root,
+		Dialer:  &net.Dialer{},
+		Options: lib.Options{SystemTags: stats.NewSystemTagSet(stats.TagURL)},
+		Samples: samples,
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ctx = lib.WithState(ctx, state)
+	ctx = common.WithRuntime(ctx, rt)
+	rt.Set("ws", common.Bind(rt, New(), &ctx))
+
+	_, err = rt.RunString(sr(`
+	ws.connect("WSBIN_URL", { persistent: true }, function(socket){
+		socket.on("open", function() {
+			socket.release();
+		});
+	});
+	`))
+	require.NoError(t, err)
+	require.True(t, <-ponged, "the ping of the server wasn't answered while the connection was released")
+
+	v, err := rt.RunString(sr(`
+	var received = [];
+	ws.connect("WSBIN_URL", { persistent: true }, function(socket){
+		socket.on("message", function(data) {
+			received.push(data);
+			if (data === "` + strconv.Itoa(maxQueuedMessages+1) + `") {
+				socket.close();
+			}
+		});
+	});
+	received;
+	`))
+	require.NoError(t, err)
+	var received []string
+	require.NoError(t, rt.ExportTo(v, &received))
+	require.Len(t, received, maxQueuedMessages)
+	assert.Equal(t, "2", received[0])
+	assert.Equal(t, maxQueuedMessages, countMetricSamples(stats.GetBufferedSamples(samples), metrics.WSMessagesReceived))
+}
+
+func TestAutoPing(t *testing.T) {
+	t.Parallel()
+	// The echoing server answers pings while it reads, the silent one never reads
+	newServer := func(answerPings bool) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			conn, err := (&websocket.Upgrader{}).Upgrade(w, r, w.Header())
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer func() { _ = conn.Close() }()
+			if !answerPings {
+				<-r.Context().Done()
+				return
+			}
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
+			}
+		}))
+	}
+	answering, silent := newServer(true), newServer(false)
+	defer answering.Close()
+	defer silent.Close()
+
+	runSession := func(t *testing.T, url string, params string) ([]stats.SampleContainer, error) {
+		rt := goja.New()
+		rt.SetFieldNameMapper(common.FieldNameMapper{})
+		samples := make(chan stats.SampleContainer, 1000)
+		root, err := lib.NewGroup("", nil)
+		require.NoError(t, err)
+		state := &lib.State{
+			Group:   root,
+			Dialer:  &net.Dialer{},
+			Options: lib.Options{SystemTags: stats.NewSystemTagSet(stats.TagURL)},
+			Samples: samples,
+		}
+		ctx := lib.WithState(context.Background(), state)
+		ctx = common.WithRuntime(ctx, rt)
+		rt.Set("ws", common.Bind(rt, New(), &ctx))
+
+		_, err = rt.RunString(fmt.Sprintf(`
+		var pongs = 0;
+		ws.connect("%s", %s, function(socket){
+			socket.on("pong", function() { pongs++; });
+			socket.setTimeout(function() { socket.close(); }, 300);
+		});
+		if (pongs > 0) { throw new Error("automatic pongs shouldn't fire the pong event"); }
+		`, url, params))
+		return stats.GetBufferedSamples(samples), err
+	}
+
+	t.Run("answered", func(t *testing.T) {
+		samplesBuf, err := runSession(t, "ws://"+answering.Listener.Addr().String(), `{ pingInterval: 50 }`)
+		require.NoError(t, err)
+		assert.True(t, countMetricSamples(samplesBuf, metrics.WSPingDuration) >= 3)
+		assert.Equal(t, 0, countMetricSamples(samplesBuf, metrics.WSPongsMissed))
+		assert.Equal(t, 0, countMetricSamples(samplesBuf, metrics.WSPing))
+	})
+
+	t.Run("missed", func(t *testing.T) {
+		samplesBuf, err := runSession(t, "ws://"+silent.Listener.Addr().String(),
+			`{ pingInterval: "50ms", pingTimeout: "20ms" }`)
+		require.NoError(t, err)
+		assert.Equal(t, 0, countMetricSamples(samplesBuf, metrics.WSPingDuration))
+		assert.True(t, countMetricSamples(samplesBuf, metrics.WSPongsMissed) >= 3)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		_, err := runSession(t, "ws://"+answering.Listener.Addr().String(), `{ pingInterval: "forever" }`)
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "invalid pingInterval")
+	})
+}
+
 func TestErrors(t *testing.T) {
 	t.Parallel()
 	tb := httpmultibin.NewHTTPMultiBin(t)
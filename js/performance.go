@@ -0,0 +1,267 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dop251/goja"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+// maxPerformanceEntries caps the marks and measures a VU keeps, since a VU
+// runs many iterations; the oldest entries are dropped first.
+const maxPerformanceEntries = 1000
+
+// performanceEntry is a mark or a measure, with times in ms relative to the
+// time origin of the VU.
+type performanceEntry struct {
+	Name      string  `js:"name"`
+	EntryType string  `js:"entryType"`
+	StartTime float64 `js:"startTime"`
+	Duration  float64 `js:"duration"`
+}
+
+// performance is the global performance object, a subset of the High
+// Resolution Time and User Timing APIs of browsers.
+type performance struct {
+	TimeOrigin float64 `js:"timeOrigin"`
+
+	origin  time.Time
+	entries []*performanceEntry
+	metrics map[string]*stats.Metric
+}
+
+func newPerformance() *performance {
+	origin := time.Now()
+	return &performance{
+		TimeOrigin: float64(origin.UnixNano()) / float64(time.Millisecond),
+		origin:     origin,
+		metrics:    make(map[string]*stats.Metric),
+	}
+}
+
+// Now returns the ms elapsed since the time origin, with µs precision.
+func (p *performance) Now() float64 {
+	return p.since(time.Now())
+}
+
+func (p *performance) since(t time.Time) float64 {
+	return float64(t.Sub(p.origin)/time.Microsecond) / 1000
+}
+
+func (p *performance) addEntry(entry *performanceEntry) {
+	if len(p.entries) >= maxPerformanceEntries {
+		p.entries = p.entries[1:]
+	}
+	p.entries = append(p.entries, entry)
+}
+
+// Mark records a named timestamp, which is the current time unless the
+// startTime option is set.
+func (p *performance) Mark(ctx context.Context, name string, options goja.Value) (*performanceEntry, error) {
+	entry := &performanceEntry{Name: name, EntryType: "mark", StartTime: p.Now()}
+	if options != nil && !goja.IsUndefined(options) && !goja.IsNull(options) {
+		startTime := options.ToObject(common.GetRuntime(ctx)).Get("startTime")
+		if startTime != nil && !goja.IsUndefined(startTime) {
+			entry.StartTime = startTime.ToFloat()
+			if entry.StartTime < 0 {
+				return nil, errors.New("the startTime of a mark can't be negative")
+			}
+		}
+	}
+	p.addEntry(entry)
+
+	return entry, nil
+}
+
+// resolve returns the time of the last mark with the given name, or the value
+// itself if it's a number.
+func (p *performance) resolve(v goja.Value) (float64, error) {
+	if name, ok := v.Export().(string); ok {
+		for i := len(p.entries) - 1; i >= 0; i-- {
+			if e := p.entries[i]; e.EntryType == "mark" && e.Name == name {
+				return e.StartTime, nil
+			}
+		}
+		return 0, fmt.Errorf("the mark '%s' does not exist", name)
+	}
+
+	return v.ToFloat(), nil
+}
+
+func isSet(v goja.Value) bool {
+	return v != nil && !goja.IsUndefined(v) && !goja.IsNull(v)
+}
+
+// Measure records the time between two marks. It's called either with the
+// names of the start and end marks, which default to the time origin and the
+// current time, or with an options object with start, end and duration. With
+// the metric option set to a name, or to true to use the name of the measure,
+// the duration is also added to a trend metric.
+//nolint: funlen,gocognit
+func (p *performance) Measure(
+	ctx context.Context, name string, startOrOptions, endMark goja.Value,
+) (*performanceEntry, error) {
+	rt := common.GetRuntime(ctx)
+	var start, end, duration goja.Value
+	var metricName string
+
+	if isSet(startOrOptions) {
+		if opts, ok := startOrOptions.Export().(map[string]interface{}); ok {
+			if isSet(endMark) {
+				return nil, errors.New("the end mark can't be used together with measure options")
+			}
+			obj := startOrOptions.ToObject(rt)
+			start, end, duration = obj.Get("start"), obj.Get("end"), obj.Get("duration")
+			switch metric := opts["metric"].(type) {
+			case nil:
+			case bool:
+				if metric {
+					metricName = name
+				}
+			case string:
+				metricName = metric
+			default:
+				return nil, errors.New("the metric option must be a metric name or a boolean")
+			}
+			if isSet(start) && isSet(end) && isSet(duration) {
+				return nil, errors.New("only two of start, end and duration can be set")
+			}
+		} else {
+			start = startOrOptions
+		}
+	}
+	if isSet(endMark) {
+		end = endMark
+	}
+
+	var startTime, endTime float64
+	var err error
+	switch {
+	case isSet(end):
+		if endTime, err = p.resolve(end); err != nil {
+			return nil, err
+		}
+	case isSet(start) && isSet(duration):
+		if startTime, err = p.resolve(start); err != nil {
+			return nil, err
+		}
+		endTime = startTime + duration.ToFloat()
+	default:
+		endTime = p.Now()
+	}
+	switch {
+	case isSet(start):
+		if startTime, err = p.resolve(start); err != nil {
+			return nil, err
+		}
+	case isSet(duration):
+		startTime = endTime - duration.ToFloat()
+	}
+
+	entry := &performanceEntry{Name: name, EntryType: "measure", StartTime: startTime, Duration: endTime - startTime}
+	p.addEntry(entry)
+
+	if metricName != "" {
+		if err := p.emit(ctx, metricName, entry.Duration); err != nil {
+			return nil, err
+		}
+	}
+
+	return entry, nil
+}
+
+func (p *performance) emit(ctx context.Context, metricName string, duration float64) error {
+	state := lib.GetState(ctx)
+	if state == nil {
+		return common.NewInitContextError("emitting measures as metrics in the init context is not supported")
+	}
+
+	metric, ok := p.metrics[metricName]
+	if !ok {
+		metric = stats.New(metricName, stats.Trend, stats.Time)
+		p.metrics[metricName] = metric
+	}
+	tags := state.CloneTags()
+	stats.PushIfNotDone(ctx, state.Samples, stats.Sample{
+		Metric: metric,
+		Time:   time.Now(),
+		Tags:   stats.IntoSampleTags(&tags),
+		Value:  duration,
+	})
+
+	return nil
+}
+
+// GetEntries returns all marks and measures in the order they were recorded.
+func (p *performance) GetEntries() []*performanceEntry {
+	return p.filterEntries(func(*performanceEntry) bool { return true })
+}
+
+// GetEntriesByName returns the entries with the given name and, optionally,
+// type.
+func (p *performance) GetEntriesByName(name string, entryType ...string) []*performanceEntry {
+	return p.filterEntries(func(e *performanceEntry) bool {
+		return e.Name == name && (len(entryType) == 0 || e.EntryType == entryType[0])
+	})
+}
+
+// GetEntriesByType returns the entries of the given type, mark or measure.
+func (p *performance) GetEntriesByType(entryType string) []*performanceEntry {
+	return p.filterEntries(func(e *performanceEntry) bool { return e.EntryType == entryType })
+}
+
+func (p *performance) filterEntries(keep func(*performanceEntry) bool) []*performanceEntry {
+	entries := make([]*performanceEntry, 0)
+	for _, e := range p.entries {
+		if keep(e) {
+			entries = append(entries, e)
+		}
+	}
+	return entries
+}
+
+// ClearMarks removes the marks with the given name, or all of them.
+func (p *performance) ClearMarks(name ...string) {
+	p.clear("mark", name)
+}
+
+// ClearMeasures removes the measures with the given name, or all of them.
+func (p *performance) ClearMeasures(name ...string) {
+	p.clear("measure", name)
+}
+
+func (p *performance) clear(entryType string, name []string) {
+	entries := p.entries[:0]
+	for _, e := range p.entries {
+		if e.EntryType != entryType || (len(name) > 0 && e.Name != name[0]) {
+			entries = append(entries, e)
+		}
+	}
+	p.entries = entries
+}
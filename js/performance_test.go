@@ -0,0 +1,150 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/js/common"
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+func newPerformanceRuntime(t *testing.T) (*goja.Runtime, *performance, *context.Context) {
+	rt := goja.New()
+	rt.SetFieldNameMapper(common.FieldNameMapper{})
+	ctxPtr := new(context.Context)
+	*ctxPtr = common.WithRuntime(context.Background(), rt)
+	p := newPerformance()
+	rt.Set("performance", common.Bind(rt, p, ctxPtr))
+	return rt, p, ctxPtr
+}
+
+func TestPerformanceNow(t *testing.T) {
+	t.Parallel()
+	rt, p, _ := newPerformanceRuntime(t)
+
+	time.Sleep(5 * time.Millisecond)
+	v, err := rt.RunString(`performance.now()`)
+	require.NoError(t, err)
+	assert.True(t, v.ToFloat() >= 5)
+	assert.True(t, v.ToFloat() <= p.Now())
+
+	v, err = rt.RunString(`performance.timeOrigin`)
+	require.NoError(t, err)
+	assert.InDelta(t, float64(p.origin.UnixNano())/1e6, v.ToFloat(), 0.001)
+}
+
+func TestPerformanceMarksAndMeasures(t *testing.T) {
+	t.Parallel()
+	rt, _, _ := newPerformanceRuntime(t)
+
+	_, err := rt.RunString(`
+	performance.mark("a", { startTime: 10 });
+	performance.mark("b", { startTime: 25 });
+	var m = performance.measure("a to b", "a", "b");
+	if (m.entryType !== "measure" || m.startTime !== 10 || m.duration !== 15) {
+		throw new Error("unexpected measure: " + JSON.stringify(m));
+	}
+	m = performance.measure("a plus 5", { start: "a", duration: 5 });
+	if (m.startTime !== 10 || m.duration !== 5) {
+		throw new Error("unexpected measure: " + JSON.stringify(m));
+	}
+	m = performance.measure("5 before b", { end: "b", duration: 5 });
+	if (m.startTime !== 20 || m.duration !== 5) {
+		throw new Error("unexpected measure: " + JSON.stringify(m));
+	}
+	var c = performance.mark("c");
+	m = performance.measure("since c", "c");
+	if (m.startTime !== c.startTime || m.duration < 0) {
+		throw new Error("unexpected measure: " + JSON.stringify(m));
+	}
+	if (performance.getEntries().length !== 7 || performance.getEntriesByType("mark").length !== 3 ||
+		performance.getEntriesByName("a to b", "measure").length !== 1) {
+		throw new Error("unexpected entries: " + JSON.stringify(performance.getEntries()));
+	}
+	performance.clearMarks("a");
+	performance.clearMeasures();
+	var names = performance.getEntries().map(function(e) { return e.name; });
+	if (names.join() !== "b,c") {
+		throw new Error("unexpected entries after clearing: " + names.join());
+	}
+	`)
+	require.NoError(t, err)
+
+	_, err = rt.RunString(`performance.measure("x", "missing")`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the mark 'missing' does not exist")
+
+	_, err = rt.RunString(`performance.measure("x", { start: 1, end: 2, duration: 1 })`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "only two of start, end and duration can be set")
+}
+
+func TestPerformanceMeasureMetric(t *testing.T) {
+	t.Parallel()
+	rt, _, ctxPtr := newPerformanceRuntime(t)
+
+	_, err := rt.RunString(`performance.measure("init", { start: 0, metric: true })`)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "in the init context is not supported")
+
+	samples := make(chan stats.SampleContainer, 10)
+	*ctxPtr = lib.WithState(*ctxPtr, &lib.State{
+		Samples: samples,
+		Tags:    map[string]string{"scenario": "default"},
+	})
+	_, err = rt.RunString(`
+	performance.measure("login", { start: 0, duration: 12, metric: "login_time" });
+	performance.measure("checkout", { start: 0, duration: 34, metric: true });
+	performance.measure("untracked", { start: 0, duration: 1 });
+	`)
+	require.NoError(t, err)
+
+	bufSamples := stats.GetBufferedSamples(samples)
+	require.Len(t, bufSamples, 2)
+	expected := map[string]float64{"login_time": 12, "checkout": 34}
+	for _, container := range bufSamples {
+		sample := container.GetSamples()[0]
+		assert.Equal(t, stats.Trend, sample.Metric.Type)
+		assert.Equal(t, stats.Time, sample.Metric.Contains)
+		assert.Equal(t, expected[sample.Metric.Name], sample.Value)
+		scenario, _ := sample.Tags.Get("scenario")
+		assert.Equal(t, "default", scenario)
+	}
+}
+
+func TestPerformanceEntriesCap(t *testing.T) {
+	t.Parallel()
+	p := newPerformance()
+	for i := 0; i < maxPerformanceEntries+10; i++ {
+		p.addEntry(&performanceEntry{Name: "m", EntryType: "mark", StartTime: float64(i)})
+	}
+	entries := p.GetEntries()
+	require.Len(t, entries, maxPerformanceEntries)
+	assert.Equal(t, float64(10), entries[0].StartTime)
+}
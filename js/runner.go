@@ -26,12 +26,16 @@ import (
 	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"net"
 	"net/http"
 	"net/http/cookiejar"
+	"net/url"
 	"runtime/debug"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/dop251/goja"
@@ -45,14 +49,20 @@ import (
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/consts"
+	"github.com/loadimpact/k6/lib/fips"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/lib/redact"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/loader"
 	"github.com/loadimpact/k6/stats"
 )
 
 // Ensure Runner implements the lib.Runner interface
-var _ lib.Runner = &Runner{}
+var (
+	_ lib.Runner              = &Runner{}
+	_ lib.ScenarioSetupRunner = &Runner{}
+)
 
 type Runner struct {
 	Bundle       *Bundle
@@ -67,8 +77,36 @@ type Runner struct {
 
 	console   *console
 	setupData []byte
+	// setupDataStore is shared by the VUs with the lazySetupData option
+	setupDataStore *setupDataStore
+	// Data returned by the setup functions of individual scenarios
+	scenarioSetupData   map[string]*setupDataStore
+	scenarioSetupDataMu sync.RWMutex
+
+	heap     *heapMonitor
+	redactor *redact.Redactor
+
+	// Used by all VUs when tlsSessionCache is set to "shared"
+	tlsSessionCache tls.ClientSessionCache
+
+	// All connections are tunneled through it when the socksProxy option is set
+	socksProxy *netext.SOCKSProxy
+
+	// Resolvers of the scenarios with their own DNS settings
+	scenarioResolvers map[string]scenarioResolver
+	// Local IP rotations of the scenarios picking them in a round-robin way
+	scenarioLocalIPs map[string]func() net.IP
+}
+
+type scenarioResolver struct {
+	resolver netext.Resolver
+	name     string
 }
 
+// dnsServerTimeout is how long a DNS server of a scenario can take to answer
+// before the next one is queried.
+const dnsServerTimeout = 5 * time.Second
+
 // New returns a new Runner for the provide source
 func New(
 	logger *logrus.Logger, src *loader.SourceData, filesystems map[string]afero.Fs, rtOpts lib.RuntimeOptions,
@@ -108,6 +146,7 @@ func newFromBundle(logger *logrus.Logger, b *Bundle) (*Runner, error) {
 			DualStack: true,
 		},
 		console: newConsole(logger),
+		heap:    newHeapMonitor(),
 		Resolver: netext.NewResolver(
 			net.LookupIP, 0, defDNS.Select.DNSSelect, defDNS.Policy.DNSPolicy),
 		ActualResolver: net.LookupIP,
@@ -139,64 +178,93 @@ func (r *Runner) newVU(id int64, samplesOut chan<- stats.SampleContainer) (*VU,
 		return nil, err
 	}
 
-	var cipherSuites []uint16
-	if r.Bundle.Options.TLSCipherSuites != nil {
-		cipherSuites = *r.Bundle.Options.TLSCipherSuites
-	}
-
-	var tlsVersions lib.TLSVersions
-	if r.Bundle.Options.TLSVersion != nil {
-		tlsVersions = *r.Bundle.Options.TLSVersion
-	}
-
-	tlsAuth := r.Bundle.Options.TLSAuth
-	certs := make([]tls.Certificate, len(tlsAuth))
-	nameToCert := make(map[string]*tls.Certificate)
-	for i, auth := range tlsAuth {
-		for _, name := range auth.Domains {
-			cert, err := auth.Certificate()
-			if err != nil {
-				return nil, err
-			}
-			certs[i] = *cert
-			nameToCert[name] = &certs[i]
-		}
-	}
-
 	dialer := &netext.Dialer{
 		Dialer:           r.BaseDialer,
 		Resolver:         r.Resolver,
 		Blacklist:        r.Bundle.Options.BlacklistIPs,
 		BlockedHostnames: r.Bundle.Options.BlockedHostnames.Trie,
 		Hosts:            r.Bundle.Options.Hosts,
+		SOCKSProxy:       r.socksProxy,
+	}
+	var ipIndex uint64
+	if id > 0 {
+		ipIndex = uint64(id - 1)
 	}
 	if r.Bundle.Options.LocalIPs.Valid {
-		var ipIndex uint64
-		if id > 0 {
-			ipIndex = uint64(id - 1)
-		}
 		dialer.Dialer.LocalAddr = &net.TCPAddr{IP: r.Bundle.Options.LocalIPs.Pool.GetIP(ipIndex)}
 	}
 
-	tlsConfig := &tls.Config{
-		InsecureSkipVerify: r.Bundle.Options.InsecureSkipTLSVerify.Bool, //nolint:gosec
-		CipherSuites:       cipherSuites,
-		MinVersion:         uint16(tlsVersions.Min),
-		MaxVersion:         uint16(tlsVersions.Max),
-		Certificates:       certs,
-		NameToCertificate:  nameToCert,
-		Renegotiation:      tls.RenegotiateFreelyAsClient,
+	tlsConfig, err := newTLSConfig(r.Bundle.Options.TLSFor(nil))
+	if err != nil {
+		return nil, err
 	}
-	transport := &http.Transport{
-		Proxy:               http.ProxyFromEnvironment,
-		TLSClientConfig:     tlsConfig,
-		DialContext:         dialer.DialContext,
-		DisableCompression:  true,
-		DisableKeepAlives:   r.Bundle.Options.NoConnectionReuse.Bool,
-		MaxIdleConns:        int(r.Bundle.Options.Batch.Int64),
-		MaxIdleConnsPerHost: int(r.Bundle.Options.BatchPerHost.Int64),
+	sessionCache := r.newTLSSessionCache()
+	r.setTLSSessionOptions(tlsConfig, sessionCache)
+	transport := r.newTransport(tlsConfig, dialer, http.ProxyFromEnvironment)
+
+	// Scenarios with their own TLS settings, network conditions, proxies, DNS
+	// settings or local IPs get a separate transport, so connections are never reused across them.
+	scenarioNet := make(map[string]vuScenarioNet)
+	for name, conf := range r.Bundle.Options.Scenarios {
+		if conf.GetTLS() == nil && conf.GetNetwork() == nil && conf.GetProxy() == nil &&
+			conf.GetDNS() == nil && conf.GetLocalIPs() == nil {
+			continue
+		}
+		snet := vuScenarioNet{tlsConfig: tlsConfig, netDialer: dialer}
+		if conf.GetDNS() != nil || conf.GetLocalIPs() != nil {
+			sdialer := *dialer
+			if sres, ok := r.scenarioResolvers[name]; ok {
+				sdialer.Resolver, sdialer.ResolverName = sres.resolver, sres.name
+			}
+			if slocal := conf.GetLocalIPs(); slocal != nil && slocal.Pool.Valid {
+				if next, ok := r.scenarioLocalIPs[name]; ok {
+					sdialer.NextLocalIP = next
+				} else {
+					sdialer.Dialer.LocalAddr = &net.TCPAddr{IP: slocal.Pool.Pool.GetIP(ipIndex)}
+				}
+			}
+			snet.netDialer = &sdialer
+		}
+		snet.dialer = snet.netDialer
+		if conf.GetTLS() != nil {
+			snet.tlsConfig, err = newTLSConfig(r.Bundle.Options.TLSFor(conf.GetTLS()))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid TLS settings for scenario '%s'", name)
+			}
+			r.setTLSSessionOptions(snet.tlsConfig, sessionCache)
+		}
+		proxy := http.ProxyFromEnvironment
+		if sproxy := conf.GetProxy(); sproxy != nil {
+			proxy, err = netext.NewProxyFunc(*sproxy)
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid proxy settings for scenario '%s'", name)
+			}
+			// The proxy of the scenario replaces the global SOCKS proxy
+			if snet.netDialer.SOCKSProxy != nil {
+				sdialer := *snet.netDialer
+				sdialer.SOCKSProxy = nil
+				snet.netDialer = &sdialer
+				snet.dialer = snet.netDialer
+			}
+			// SOCKS proxies tunnel all connections, not only the HTTP ones
+			if lib.IsSOCKSProxyURL(sproxy.URL.String) {
+				socksProxy, err := netext.ParseSOCKSProxy(sproxy.URL.String)
+				if err != nil {
+					return nil, errors.Wrapf(err, "invalid proxy settings for scenario '%s'", name)
+				}
+				snet.dialer = netext.NewSOCKSDialer(snet.netDialer, socksProxy, sproxy.NoProxy.Trie)
+			}
+		}
+		if conf.GetNetwork() != nil {
+			shaped := netext.NewShapedDialer(snet.dialer, *conf.GetNetwork())
+			if seed := r.Bundle.Options.Seed; seed.Valid {
+				shaped.Seed(lib.DeriveSeed(seed.Int64, id, int64(crc32.ChecksumIEEE([]byte(name)))))
+			}
+			snet.dialer = shaped
+		}
+		snet.transport = r.newTransport(snet.tlsConfig, snet.dialer, proxy)
+		scenarioNet[name] = snet
 	}
-	_ = http2.ConfigureTransport(transport)
 
 	cookieJar, err := cookiejar.New(nil)
 	if err != nil {
@@ -209,8 +277,10 @@ func (r *Runner) newVU(id int64, samplesOut chan<- stats.SampleContainer) (*VU,
 		Runner:         r,
 		Transport:      transport,
 		Dialer:         dialer,
+		netDialer:      dialer,
 		CookieJar:      cookieJar,
 		TLSConfig:      tlsConfig,
+		scenarioNet:    scenarioNet,
 		Console:        r.console,
 		BPool:          bpool.NewBufferPool(100),
 		Samples:        samplesOut,
@@ -230,6 +300,10 @@ func (r *Runner) newVU(id int64, samplesOut chan<- stats.SampleContainer) (*VU,
 		Iteration: vu.Iteration,
 		Tags:      vu.Runner.Bundle.Options.RunTags.CloneTags(),
 		Group:     r.defaultGroup,
+		Secrets:   vu.Runner.Bundle.secrets,
+		Redactor:  r.redactor,
+
+		InFlightRequests: lib.NewInFlightRequests(),
 	}
 	vu.Runtime.Set("console", common.Bind(vu.Runtime, vu.Console, vu.Context))
 
@@ -244,6 +318,83 @@ func (r *Runner) newVU(id int64, samplesOut chan<- stats.SampleContainer) (*VU,
 	return vu, nil
 }
 
+func newTLSConfig(conf lib.ScenarioTLS) (*tls.Config, error) {
+	var cipherSuites []uint16
+	if conf.TLSCipherSuites != nil {
+		cipherSuites = *conf.TLSCipherSuites
+	}
+
+	var tlsVersions lib.TLSVersions
+	if conf.TLSVersion != nil {
+		tlsVersions = *conf.TLSVersion
+	}
+
+	certs := make([]tls.Certificate, len(conf.TLSAuth))
+	nameToCert := make(map[string]*tls.Certificate)
+	for i, auth := range conf.TLSAuth {
+		for _, name := range auth.Domains {
+			cert, err := auth.Certificate()
+			if err != nil {
+				return nil, err
+			}
+			certs[i] = *cert
+			nameToCert[name] = &certs[i]
+		}
+	}
+
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: conf.InsecureSkipTLSVerify.Bool, //nolint:gosec
+		CipherSuites:       cipherSuites,
+		MinVersion:         uint16(tlsVersions.Min),
+		MaxVersion:         uint16(tlsVersions.Max),
+		Certificates:       certs,
+		NameToCertificate:  nameToCert,
+		Renegotiation:      tls.RenegotiateFreelyAsClient,
+		ServerName:         conf.TLSServerName.String,
+	}
+	if err := fips.RestrictTLS(tlsConfig); err != nil {
+		return nil, err
+	}
+	return tlsConfig, nil
+}
+
+// newTLSSessionCache returns the TLS session cache a new VU should use,
+// according to the tlsSessionCache option, or nil if sessions shouldn't be
+// resumed.
+func (r *Runner) newTLSSessionCache() tls.ClientSessionCache {
+	switch r.Bundle.Options.TLSSessionCache.String {
+	case lib.TLSSessionCacheShared:
+		return r.tlsSessionCache
+	case lib.TLSSessionCacheVU:
+		return tls.NewLRUClientSessionCache(0)
+	default:
+		return nil
+	}
+}
+
+func (r *Runner) setTLSSessionOptions(tlsConfig *tls.Config, cache tls.ClientSessionCache) {
+	tlsConfig.ClientSessionCache = cache
+	if r.Bundle.Options.TLSSessionTickets.Valid {
+		tlsConfig.SessionTicketsDisabled = !r.Bundle.Options.TLSSessionTickets.Bool
+	}
+}
+
+func (r *Runner) newTransport(
+	tlsConfig *tls.Config, dialer lib.DialContexter, proxy func(*http.Request) (*url.URL, error),
+) *http.Transport {
+	transport := &http.Transport{
+		Proxy:               proxy,
+		TLSClientConfig:     tlsConfig,
+		DialContext:         dialer.DialContext,
+		DisableCompression:  true,
+		DisableKeepAlives:   r.Bundle.Options.NoConnectionReuse.Bool,
+		MaxIdleConns:        int(r.Bundle.Options.Batch.Int64),
+		MaxIdleConnsPerHost: int(r.Bundle.Options.BatchPerHost.Int64),
+	}
+	_ = http2.ConfigureTransport(transport)
+	return transport
+}
+
 // Setup runs the setup function if there is one and sets the setupData to the returned value
 func (r *Runner) Setup(ctx context.Context, out chan<- stats.SampleContainer) error {
 	setupCtx, setupCancel := context.WithTimeout(ctx, r.getTimeoutFor(consts.SetupFn))
@@ -263,6 +414,7 @@ func (r *Runner) Setup(ctx context.Context, out chan<- stats.SampleContainer) er
 	if err != nil {
 		return errors.Wrap(err, consts.SetupFn)
 	}
+	r.setupDataStore = newSetupDataStore(r.setupData)
 	var tmp interface{}
 	return json.Unmarshal(r.setupData, &tmp)
 }
@@ -275,6 +427,57 @@ func (r *Runner) GetSetupData() []byte {
 // SetSetupData saves the externally supplied setup data as json in the runner, so it can be used in VUs
 func (r *Runner) SetSetupData(data []byte) {
 	r.setupData = data
+	r.setupDataStore = newSetupDataStore(data)
+}
+
+// ScenarioSetup runs the setup function of a scenario and keeps the data it
+// returns for the iterations of that scenario.
+func (r *Runner) ScenarioSetup(ctx context.Context, out chan<- stats.SampleContainer, scenario, fn string) error {
+	setupCtx, setupCancel := context.WithTimeout(ctx, r.getTimeoutFor(consts.SetupFn))
+	defer setupCancel()
+
+	v, err := r.runPart(setupCtx, out, fn, nil)
+	if err != nil {
+		return err
+	}
+	var data []byte // nil means undefined, like with setup()
+	if !goja.IsUndefined(v) {
+		if data, err = json.Marshal(v.Export()); err != nil {
+			return errors.Wrap(err, fn)
+		}
+	}
+
+	r.scenarioSetupDataMu.Lock()
+	defer r.scenarioSetupDataMu.Unlock()
+	if r.scenarioSetupData == nil {
+		r.scenarioSetupData = make(map[string]*setupDataStore)
+	}
+	r.scenarioSetupData[scenario] = newSetupDataStore(data)
+	return nil
+}
+
+// ScenarioTeardown runs the teardown function of a scenario with the data
+// returned by its setup function.
+func (r *Runner) ScenarioTeardown(ctx context.Context, out chan<- stats.SampleContainer, scenario, fn string) error {
+	teardownCtx, teardownCancel := context.WithTimeout(ctx, r.getTimeoutFor(consts.TeardownFn))
+	defer teardownCancel()
+
+	var data interface{} = goja.Undefined()
+	if store := r.getScenarioSetupData(scenario); store != nil && store.raw != nil {
+		if err := json.Unmarshal(store.raw, &data); err != nil {
+			return errors.Wrap(err, fn)
+		}
+	}
+	_, err := r.runPart(teardownCtx, out, fn, data)
+	return err
+}
+
+// getScenarioSetupData returns the data returned by the setup function of the
+// given scenario, or nil if it doesn't have one.
+func (r *Runner) getScenarioSetupData(scenario string) *setupDataStore {
+	r.scenarioSetupDataMu.RLock()
+	defer r.scenarioSetupDataMu.RUnlock()
+	return r.scenarioSetupData[scenario]
 }
 
 func (r *Runner) Teardown(ctx context.Context, out chan<- stats.SampleContainer) error {
@@ -358,6 +561,17 @@ func (r *Runner) HandleSummary(ctx context.Context, summary *lib.Summary) (map[s
 		vu.Runtime.ToValue(r.Bundle.RuntimeOptions.SummaryExport.String),
 		vu.Runtime.ToValue(summaryDataForJS),
 		vu.Runtime.ToValue(getOldTextSummaryFunc(summary, r.Bundle.Options)), // TODO: remove
+		vu.Runtime.ToValue(r.Bundle.RuntimeOptions.SummaryMarkdown.String),
+		vu.Runtime.ToValue(getMarkdownSummaryFunc(summary, r.Bundle.Options)),
+		vu.Runtime.ToValue(r.Bundle.RuntimeOptions.SummaryExportCSV.String),
+		vu.Runtime.ToValue(getCSVSummaryFunc(summary, r.Bundle.Options)),
+		vu.Runtime.ToValue(r.Bundle.RuntimeOptions.SummaryGitHubActions.Bool),
+		vu.Runtime.ToValue(r.Bundle.RuntimeOptions.GitHubStepSummary.String),
+		vu.Runtime.ToValue(getGitHubActionsSummaryFunc(summary, r.Bundle.Options)),
+		vu.Runtime.ToValue(r.Bundle.RuntimeOptions.ReportHTML.String),
+		vu.Runtime.ToValue(getHTMLSummaryFunc(summary, r.Bundle.Options)),
+		vu.Runtime.ToValue(r.Bundle.RuntimeOptions.ReportJUnit.String),
+		vu.Runtime.ToValue(getJUnitSummaryFunc(summary, r.Bundle.Options)),
 	}
 	rawResult, _, _, err := vu.runFn(ctx, false, handleSummaryWrapper, wrapperArgs...)
 
@@ -386,6 +600,29 @@ func (r *Runner) SetOptions(opts lib.Options) error {
 		r.RPSLimit = rate.NewLimiter(rate.Limit(rps.Int64), 1)
 	}
 
+	r.redactor = nil
+	if opts.Redact != nil {
+		redactor, err := redact.New(*opts.Redact)
+		if err != nil {
+			return err
+		}
+		r.redactor = redactor
+	}
+
+	r.tlsSessionCache = nil
+	if opts.TLSSessionCache.String == lib.TLSSessionCacheShared {
+		r.tlsSessionCache = tls.NewLRUClientSessionCache(0)
+	}
+
+	r.socksProxy = nil
+	if opts.SOCKSProxy.String != "" {
+		socksProxy, err := netext.ParseSOCKSProxy(opts.SOCKSProxy.String)
+		if err != nil {
+			return err
+		}
+		r.socksProxy = socksProxy
+	}
+
 	// TODO: validate that all exec values are either nil or valid exported methods (or HTTP requests in the future)
 
 	if opts.ConsoleOutput.Valid {
@@ -410,15 +647,65 @@ func (r *Runner) SetOptions(opts lib.Options) error {
 	if err := r.setResolver(opts.DNS); err != nil {
 		return err
 	}
+	if err := r.setScenarioResolvers(opts); err != nil {
+		return err
+	}
+	r.scenarioLocalIPs = make(map[string]func() net.IP)
+	for name, conf := range opts.Scenarios {
+		if slocal := conf.GetLocalIPs(); slocal != nil && slocal.Pool.Valid &&
+			slocal.Select.String == lib.LocalIPsSelectRoundRobin {
+			r.scenarioLocalIPs[name] = netext.NewRoundRobinLocalIPs(slocal.Pool.Pool)
+		}
+	}
 
 	return nil
 }
 
 func (r *Runner) setResolver(dns types.DNSConfig) error {
-	ttl, err := parseTTL(dns.TTL.String)
+	resolver, err := newResolver(r.ActualResolver, dns)
 	if err != nil {
 		return err
 	}
+	r.Resolver = resolver
+	return nil
+}
+
+// setScenarioResolvers creates the resolvers of the scenarios with their own
+// DNS settings, shared by all of their VUs like the global one.
+func (r *Runner) setScenarioResolvers(opts lib.Options) error {
+	r.scenarioResolvers = make(map[string]scenarioResolver)
+	for name, conf := range opts.Scenarios {
+		sdns := conf.GetDNS()
+		if sdns == nil {
+			continue
+		}
+		actual, resolverName := r.ActualResolver, "system"
+		if len(sdns.Servers) > 0 {
+			servers := make([]string, len(sdns.Servers))
+			for i, server := range sdns.Servers {
+				addr, err := lib.DNSServerAddr(server)
+				if err != nil {
+					return errors.Wrapf(err, "invalid DNS settings for scenario '%s'", name)
+				}
+				servers[i] = addr
+			}
+			actual = netext.NewServersResolver(servers, dnsServerTimeout)
+			resolverName = strings.Join(servers, ",")
+		}
+		resolver, err := newResolver(actual, opts.DNSFor(sdns))
+		if err != nil {
+			return errors.Wrapf(err, "invalid DNS settings for scenario '%s'", name)
+		}
+		r.scenarioResolvers[name] = scenarioResolver{resolver: resolver, name: resolverName}
+	}
+	return nil
+}
+
+func newResolver(actual netext.MultiResolver, dns types.DNSConfig) (netext.Resolver, error) {
+	ttl, err := parseTTL(dns.TTL.String)
+	if err != nil {
+		return nil, err
+	}
 
 	dnsSel := dns.Select
 	if !dnsSel.Valid {
@@ -428,10 +715,7 @@ func (r *Runner) setResolver(dns types.DNSConfig) error {
 	if !dnsPol.Valid {
 		dnsPol = types.DefaultDNSConfig().Policy
 	}
-	r.Resolver = netext.NewResolver(
-		r.ActualResolver, ttl, dnsSel.DNSSelect, dnsPol.DNSPolicy)
-
-	return nil
+	return netext.NewResolver(actual, ttl, dnsSel.DNSSelect, dnsPol.DNSPolicy), nil
 }
 
 func parseTTL(ttlS string) (time.Duration, error) {
@@ -537,14 +821,31 @@ type VU struct {
 	Samples chan<- stats.SampleContainer
 
 	setupData goja.Value
+	// The scenario that setupData was unmarshaled for
+	setupDataScenario string
+
+	// TLS configs, dialers and transports for scenarios that override the
+	// global TLS options, shape the network or use their own proxies, keyed by
+	// the scenario name.
+	scenarioNet   map[string]vuScenarioNet
+	netOverridden bool
+	netDialer     *netext.Dialer
 
 	state *lib.State
 }
 
+type vuScenarioNet struct {
+	tlsConfig *tls.Config
+	netDialer *netext.Dialer // counts the data sent and received
+	dialer    lib.DialContexter
+	transport *http.Transport
+}
+
 // Verify that interfaces are implemented
 var (
-	_ lib.ActiveVU      = &ActiveVU{}
-	_ lib.InitializedVU = &VU{}
+	_ lib.ActiveVU           = &ActiveVU{}
+	_ lib.InFlightRequestsVU = &ActiveVU{}
+	_ lib.InitializedVU      = &VU{}
 )
 
 // ActiveVU holds a VU and its activation parameters
@@ -577,6 +878,16 @@ func (u *VU) Activate(params *lib.VUActivationParams) lib.ActiveVU {
 	}
 	u.Runtime.Set("__ENV", env)
 
+	if snet, ok := u.scenarioNet[params.Scenario]; ok {
+		u.state.TLSConfig, u.state.Dialer, u.state.Transport = snet.tlsConfig, snet.dialer, snet.transport
+		u.netDialer = snet.netDialer
+		u.netOverridden = true
+	} else if u.netOverridden {
+		u.state.TLSConfig, u.state.Dialer, u.state.Transport = u.TLSConfig, u.Dialer, u.Transport
+		u.netDialer = u.Dialer
+		u.netOverridden = false
+	}
+
 	opts := u.Runner.Bundle.Options
 	// TODO: maybe we can cache the original tags only clone them and add (if any) new tags on top ?
 	u.state.Tags = opts.RunTags.CloneTags()
@@ -623,6 +934,27 @@ func (u *VU) Activate(params *lib.VUActivationParams) lib.ActiveVU {
 	return avu
 }
 
+// getSetupData returns the data passed to the iterations of the current
+// scenario, either the one returned by its own setup function, if it has one,
+// or the one returned by setup().
+func (u *ActiveVU) getSetupData() (goja.Value, error) {
+	raw, store := u.Runner.setupData, u.Runner.setupDataStore
+	if scenarioStore := u.Runner.getScenarioSetupData(u.Scenario); scenarioStore != nil {
+		raw, store = scenarioStore.raw, scenarioStore
+	}
+	if raw == nil {
+		return goja.Undefined(), nil
+	}
+	if u.Runner.Bundle.Options.LazySetupData.Bool {
+		return u.Runtime.ToValue(common.Bind(u.Runtime, &SetupData{store: store}, u.Context)), nil
+	}
+	var data interface{}
+	if err := json.Unmarshal(raw, &data); err != nil {
+		return nil, err
+	}
+	return u.Runtime.ToValue(data), nil
+}
+
 // RunOnce runs the configured Exec function once.
 func (u *ActiveVU) RunOnce() error {
 	select {
@@ -635,18 +967,14 @@ func (u *ActiveVU) RunOnce() error {
 		<-u.busy // unlock deactivation again
 	}()
 
-	// Unmarshall the setupData only the first time for each VU so that VUs are isolated but we
-	// still don't use too much CPU in the middle test
-	if u.setupData == nil {
-		if u.Runner.setupData != nil {
-			var data interface{}
-			if err := json.Unmarshal(u.Runner.setupData, &data); err != nil {
-				return errors.Wrap(err, "RunOnce")
-			}
-			u.setupData = u.Runtime.ToValue(data)
-		} else {
-			u.setupData = goja.Undefined()
+	// Unmarshall the setupData only the first time for each VU and scenario so
+	// that VUs are isolated but we still don't use too much CPU in the middle test
+	if u.setupData == nil || u.setupDataScenario != u.Scenario {
+		setupData, err := u.getSetupData()
+		if err != nil {
+			return errors.Wrap(err, "RunOnce")
 		}
+		u.setupData, u.setupDataScenario = setupData, u.Scenario
 	}
 
 	fn, ok := u.exports[u.Exec]
@@ -655,8 +983,19 @@ func (u *ActiveVU) RunOnce() error {
 		panic(fmt.Sprintf("function '%s' not found in exports", u.Exec))
 	}
 
-	// Call the exported function.
-	_, isFullIteration, totalTime, err := u.runFn(u.RunContext, true, fn, u.setupData)
+	isFullIteration, totalTime, err := u.runIteration(fn)
+	// Failed iterations are retried with the same iteration number, and thus
+	// the same data, as long as the VU isn't being stopped
+	for retry := int64(1); err != nil && retry <= u.Retries && u.RunContext.Err() == nil; retry++ {
+		u.state.Logger.WithError(err).Warnf("Retrying the failed iteration (%d/%d)", retry, u.Retries)
+		if !u.waitRetryBackoff(retry) {
+			break
+		}
+		u.state.Tags["retry"] = strconv.FormatInt(retry, 10)
+		u.Iteration--
+		isFullIteration, totalTime, err = u.runIteration(fn)
+	}
+	delete(u.state.Tags, "retry")
 
 	// If MinIterationDuration is specified and the iteration wasn't canceled
 	// and was less than it, sleep for the remainder
@@ -670,6 +1009,74 @@ func (u *ActiveVU) RunOnce() error {
 	return err
 }
 
+// runIteration runs the exported function once, interrupting it if it runs
+// longer than the iterationTimeout of the scenario.
+func (u *ActiveVU) runIteration(fn goja.Callable) (isFullIteration bool, totalTime time.Duration, err error) {
+	ctx := u.RunContext
+	var stopTimeoutWatch func() *iterationTimeoutError
+	if u.IterationTimeout > 0 {
+		ctx, stopTimeoutWatch = u.watchIterationTimeout(u.IterationTimeout)
+		*u.Context = ctx
+	}
+
+	// Call the exported function.
+	_, isFullIteration, totalTime, err = u.runFn(ctx, true, fn, u.setupData)
+
+	if stopTimeoutWatch != nil {
+		*u.Context = u.RunContext
+		if timeoutErr := stopTimeoutWatch(); timeoutErr != nil {
+			err = timeoutErr
+			// The interrupt could have been triggered after the function had
+			// already returned, so it has to be cleared for the next iteration
+			u.Runtime.ClearInterrupt()
+			u.state.Samples <- stats.Sample{
+				Time:   time.Now(),
+				Metric: metrics.IterationsTimedOut,
+				Value:  1,
+				Tags:   stats.NewSampleTags(u.state.Tags),
+			}
+		}
+	}
+
+	return isFullIteration, totalTime, err
+}
+
+// The longest the backoff between retries of failed iterations can be doubled
+// to; a longer configured retryBackoff is used as it is.
+const maxRetryBackoff = time.Minute
+
+// retryBackoff returns how long to wait before the given retry of a failed
+// iteration: twice as long as before the previous one, up to maxRetryBackoff.
+func retryBackoff(backoff time.Duration, retry int64) time.Duration {
+	for i := int64(1); i < retry && backoff < maxRetryBackoff; i++ {
+		if backoff *= 2; backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+	return backoff
+}
+
+// waitRetryBackoff waits before the given retry of a failed iteration and
+// returns false if the VU was stopped in the meantime.
+func (u *ActiveVU) waitRetryBackoff(retry int64) bool {
+	if u.RetryBackoff <= 0 {
+		return true
+	}
+	timer := time.NewTimer(retryBackoff(u.RetryBackoff, retry))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-u.RunContext.Done():
+		return false
+	}
+}
+
+// GetInFlightRequests returns the requests that the VU is currently waiting for.
+func (u *ActiveVU) GetInFlightRequests() []string {
+	return u.state.InFlightRequests.List()
+}
+
 func (u *VU) runFn(
 	ctx context.Context, isDefault bool, fn goja.Callable, args ...goja.Value,
 ) (v goja.Value, isFullIteration bool, t time.Duration, err error) {
@@ -689,6 +1096,11 @@ func (u *VU) runFn(
 	// also this means that teardown and setup have __ITER defined
 	// maybe move it to RunOnce ?
 	u.Runtime.Set("__ITER", u.Iteration)
+	if opts.Seed.Valid {
+		// every iteration gets its own sequence, regardless of how many
+		// random numbers the previous ones used
+		u.Runtime.SetRandSource(common.NewSeededRandSource(lib.DeriveSeed(opts.Seed.Int64, u.ID, u.Iteration)))
+	}
 	u.Iteration++
 
 	defer func() {
@@ -707,6 +1119,11 @@ func (u *VU) runFn(
 		}
 	}()
 
+	var stopHeapWatch func() *heapLimitError
+	if maxMemory := opts.MaxHeapMemory; maxMemory.Valid && maxMemory.Int64 > 0 {
+		stopHeapWatch = u.Runner.heap.watch(u.Runtime, uint64(maxMemory.Int64))
+	}
+
 	startTime := time.Now()
 	v, err = fn(goja.Undefined(), args...) // Actually run the JS script
 	endTime := time.Now()
@@ -718,11 +1135,26 @@ func (u *VU) runFn(
 		isFullIteration = true
 	}
 
+	if stopHeapWatch != nil {
+		if limitErr := stopHeapWatch(); limitErr != nil {
+			if _, ok := err.(*goja.InterruptedError); ok {
+				err = limitErr
+			}
+			// The interrupt could have been triggered after the function had
+			// already returned, so it has to be cleared for the next iteration
+			if isFullIteration {
+				u.Runtime.ClearInterrupt()
+			}
+		}
+	}
+
 	if u.Runner.Bundle.Options.NoVUConnectionReuse.Bool {
-		u.Transport.CloseIdleConnections()
+		if t, ok := u.state.Transport.(interface{ CloseIdleConnections() }); ok {
+			t.CloseIdleConnections()
+		}
 	}
 
-	u.state.Samples <- u.Dialer.GetTrail(startTime, endTime, isFullIteration, isDefault, stats.NewSampleTags(u.state.Tags))
+	u.state.Samples <- u.netDialer.GetTrail(startTime, endTime, isFullIteration, isDefault, stats.NewSampleTags(u.state.Tags))
 
 	return v, isFullIteration, endTime.Sub(startTime), err
 }
@@ -31,6 +31,7 @@ import (
 	stdlog "log"
 	"net"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"os"
 	"strings"
@@ -54,11 +55,13 @@ import (
 	k6metrics "github.com/loadimpact/k6/js/modules/k6/metrics"
 	"github.com/loadimpact/k6/js/modules/k6/ws"
 	"github.com/loadimpact/k6/lib"
-	_ "github.com/loadimpact/k6/lib/executor" // TODO: figure out something better
+	"github.com/loadimpact/k6/lib/executor"
 	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
 	"github.com/loadimpact/k6/lib/testutils"
 	"github.com/loadimpact/k6/lib/testutils/httpmultibin"
 	"github.com/loadimpact/k6/lib/testutils/mockoutput"
+	"github.com/loadimpact/k6/lib/testutils/mockresolver"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/loader"
 	"github.com/loadimpact/k6/output"
@@ -198,8 +201,11 @@ func TestOptionsPropagationToScript(t *testing.T) {
 			};`
 
 	expScriptOptions := lib.Options{SetupTimeout: types.NullDurationFrom(1 * time.Second)}
-	r1, err := getSimpleRunner(t, "/script.js", data,
-		lib.RuntimeOptions{Env: map[string]string{"expectedSetupTimeout": "1s"}})
+	// custom options are only kept around when unknown options aren't errors
+	r1, err := getSimpleRunner(t, "/script.js", data, lib.RuntimeOptions{
+		Env:             map[string]string{"expectedSetupTimeout": "1s"},
+		NoStrictOptions: null.BoolFrom(true),
+	})
 	require.NoError(t, err)
 	require.Equal(t, expScriptOptions, r1.GetOptions())
 
@@ -400,6 +406,54 @@ func TestSetupDataNoSetup(t *testing.T) {
 	};`)
 }
 
+func TestSetupDataLazy(t *testing.T) {
+	r, err := getSimpleRunner(t, "/script.js", `
+	exports.options = { setupTimeout: "1s", teardownTimeout: "1s", lazySetupData: true };
+	exports.setup = function() {
+		return { users: [{ name: "a" }, { name: "b" }, { name: "c" }], "the.host": "test.k6.io" };
+	}
+	exports.default = function(data) {
+		var check = function(name, got, want) {
+			if (JSON.stringify(got) !== JSON.stringify(want)) {
+				throw new Error(name + ": wrong data: " + JSON.stringify(got));
+			}
+		};
+		check("get", data.get("users.1"), { name: "b" });
+		check("get path array", data.get(["the.host"]), "test.k6.io");
+		check("keys", data.keys(), ["the.host", "users"]);
+		check("length", data.length("users"), 3);
+		check("slice", data.slice("users", -2), [{ name: "b" }, { name: "c" }]);
+		check("has", [data.has("users.2.name"), data.has("users.3")], [true, false]);
+
+		data.get("users")[0].name = "changed";
+		check("isolation", data.get("users.0.name"), "a");
+
+		try {
+			data.get("users.0.email");
+			throw new Error("missing key didn't throw");
+		} catch (e) {
+			check("missing key", e.message, 'setup data has no key "email" at "users.0"');
+		}
+	};
+
+	exports.teardown = function(data) {
+		if (data.users.length != 3) {
+			throw new Error("teardown: wrong data: " + JSON.stringify(data))
+		}
+	};`)
+	require.NoError(t, err)
+
+	samples := make(chan stats.SampleContainer, 100)
+	require.NoError(t, r.Setup(context.Background(), samples))
+	initVU, err := r.NewVU(1, samples)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	vu := initVU.Activate(&lib.VUActivationParams{RunContext: ctx})
+	assert.NoError(t, vu.RunOnce())
+	assert.NoError(t, r.Teardown(context.Background(), samples))
+}
+
 func TestConsoleInInitContext(t *testing.T) {
 	r1, err := getSimpleRunner(t, "/script.js", `
 			console.log("1");
@@ -586,6 +640,155 @@ func TestVURunInterrupt(t *testing.T) {
 	}
 }
 
+func TestHeapMemoryLimit(t *testing.T) {
+	t.Parallel()
+	r, err := getSimpleRunner(t, "/script.js", `
+		exports.default = function() { if (__ITER == 0) { while(true) {} } }
+		`)
+	require.NoError(t, err)
+	// Any real heap is bigger than a single byte
+	require.NoError(t, r.SetOptions(lib.Options{MaxHeapMemory: null.IntFrom(1)}))
+
+	samples := make(chan stats.SampleContainer, 100)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	// All of the running iterations are interrupted, by the same monitor
+	activeVUs := make([]lib.ActiveVU, 2)
+	for i := range activeVUs {
+		vu, err := r.newVU(int64(i+1), samples)
+		require.NoError(t, err)
+		activeVUs[i] = vu.Activate(&lib.VUActivationParams{RunContext: ctx})
+	}
+	errs := make(chan error, len(activeVUs))
+	for _, activeVU := range activeVUs {
+		go func(activeVU lib.ActiveVU) { errs <- activeVU.RunOnce() }(activeVU)
+	}
+	for range activeVUs {
+		err := <-errs
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "exceeded the maxHeapMemory limit of 1 B")
+	}
+
+	// The VUs should be usable again after the interrupted iterations
+	for _, activeVU := range activeVUs {
+		require.NoError(t, activeVU.RunOnce())
+	}
+}
+
+func TestVUIterationTimeout(t *testing.T) {
+	t.Parallel()
+	tb := httpmultibin.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+
+	r, err := getSimpleRunner(t, "/script.js", tb.Replacer.Replace(`
+		var http = require("k6/http");
+		exports.default = function() {
+			if (__ITER == 0) { while(true) {} }
+			if (__ITER == 1) { http.get("HTTPBIN_URL/delay/10"); }
+		}
+		`))
+	require.NoError(t, err)
+	require.NoError(t, r.SetOptions(lib.Options{Hosts: tb.Dialer.Hosts}))
+
+	samples := make(chan stats.SampleContainer, 100)
+	vu, err := r.newVU(1, samples)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	activeVU := vu.Activate(&lib.VUActivationParams{
+		RunContext:       ctx,
+		Scenario:         "hung",
+		IterationTimeout: 200 * time.Millisecond,
+	})
+
+	err = activeVU.RunOnce()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeded the iterationTimeout of 200ms")
+
+	// The pending request should be aborted as well
+	start := time.Now()
+	err = activeVU.RunOnce()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "exceeded the iterationTimeout of 200ms")
+	assert.True(t, time.Since(start) < 5*time.Second)
+
+	// The VU should be usable again after the interrupted iterations
+	require.NoError(t, activeVU.RunOnce())
+
+	var timedOut float64
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, s := range sc.GetSamples() {
+			if s.Metric == metrics.IterationsTimedOut {
+				timedOut += s.Value
+			}
+		}
+	}
+	assert.Equal(t, 2.0, timedOut)
+}
+
+func TestVUIterationRetries(t *testing.T) {
+	t.Parallel()
+	r, err := getSimpleRunner(t, "/script.js", `
+		var attempts = 0;
+		exports.default = function() {
+			attempts++;
+			if (__ITER != 0) { throw new Error("unexpected __ITER " + __ITER); }
+			if (attempts < 3) { throw new Error("flaky"); }
+		}
+		`)
+	require.NoError(t, err)
+
+	t.Run("succeeds", func(t *testing.T) {
+		t.Parallel()
+		samples := make(chan stats.SampleContainer, 100)
+		vu, err := r.newVU(1, samples)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		activeVU := vu.Activate(&lib.VUActivationParams{
+			RunContext:   ctx,
+			Retries:      3,
+			RetryBackoff: 10 * time.Millisecond,
+		})
+		require.NoError(t, activeVU.RunOnce())
+
+		var retryTags []string
+		for _, sc := range stats.GetBufferedSamples(samples) {
+			for _, s := range sc.GetSamples() {
+				if s.Metric == metrics.Iterations {
+					retry, _ := s.Tags.Get("retry")
+					retryTags = append(retryTags, retry)
+				}
+			}
+		}
+		assert.Equal(t, []string{"", "1", "2"}, retryTags)
+	})
+	t.Run("fails", func(t *testing.T) {
+		t.Parallel()
+		vu, err := r.newVU(2, make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		activeVU := vu.Activate(&lib.VUActivationParams{RunContext: ctx, Retries: 1})
+		err = activeVU.RunOnce()
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "flaky")
+	})
+}
+
+func TestRetryBackoff(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, time.Second, retryBackoff(time.Second, 1))
+	assert.Equal(t, 8*time.Second, retryBackoff(time.Second, 4))
+	assert.Equal(t, maxRetryBackoff, retryBackoff(time.Second, 7))
+	// The exponent would overflow without the cap
+	assert.Equal(t, maxRetryBackoff, retryBackoff(time.Second, 100))
+	assert.Equal(t, 2*time.Minute, retryBackoff(2*time.Minute, 5))
+}
+
 func TestVURunInterruptDoesntPanic(t *testing.T) {
 	r1, err := getSimpleRunner(t, "/script.js", `
 		exports.default = function() { while(true) {} }
@@ -804,6 +1007,122 @@ func TestVUIntegrationInsecureRequests(t *testing.T) {
 	}
 }
 
+func TestVUIntegrationScenarioTLS(t *testing.T) {
+	tb := httpmultibin.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+
+	r, err := getSimpleRunner(t, "/script.js", tb.Replacer.Replace(`
+			var http = require("k6/http");
+			exports.default = function() { http.get("HTTPSBIN_IP_URL/get"); }
+		`))
+	require.NoError(t, err)
+
+	lax := executor.NewPerVUIterationsConfig("lax")
+	lax.TLS = &lib.ScenarioTLS{
+		InsecureSkipTLSVerify: null.BoolFrom(true),
+		TLSServerName:         null.StringFrom("example.com"),
+	}
+	require.NoError(t, r.SetOptions(lib.Options{
+		Throw: null.BoolFrom(true),
+		Scenarios: lib.ScenarioConfigs{
+			"strict": executor.NewPerVUIterationsConfig("strict"),
+			"lax":    lax,
+		},
+	}))
+
+	initVU, err := r.NewVU(1, make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+
+	run := func(scenario string) (*lib.State, error) {
+		ctx, cancel := context.WithCancel(context.Background())
+		deactivated := make(chan struct{})
+		vu := initVU.Activate(&lib.VUActivationParams{
+			RunContext:         ctx,
+			Scenario:           scenario,
+			DeactivateCallback: func(lib.InitializedVU) { close(deactivated) },
+		})
+		err := vu.RunOnce()
+		cancel()
+		<-deactivated
+		return initVU.(*VU).state, err
+	}
+
+	state, err := run("strict")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "x509: certificate signed by unknown authority")
+	assert.Empty(t, state.TLSConfig.ServerName)
+
+	state, err = run("lax")
+	require.NoError(t, err)
+	assert.True(t, state.TLSConfig.InsecureSkipVerify)
+	assert.Equal(t, "example.com", state.TLSConfig.ServerName)
+
+	// Back to the global TLS settings for scenarios without overrides
+	state, err = run("strict")
+	require.Error(t, err)
+	assert.False(t, state.TLSConfig.InsecureSkipVerify)
+}
+
+func TestVUIntegrationTLSSessionResumption(t *testing.T) {
+	tb := httpmultibin.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+
+	r, err := getSimpleRunner(t, "/script.js", tb.Replacer.Replace(`
+			var http = require("k6/http");
+			exports.default = function() { http.get("HTTPSBIN_IP_URL/get"); http.get("HTTPSBIN_IP_URL/get"); }
+		`))
+	require.NoError(t, err)
+
+	getHandshakes := func(samples chan stats.SampleContainer) (res []string) {
+		close(samples)
+		for sc := range samples {
+			for _, s := range sc.GetSamples() {
+				if s.Metric == metrics.HTTPReqTLSHandshaking {
+					v, _ := s.Tags.Get("tls_handshake")
+					res = append(res, v)
+				}
+			}
+		}
+		return res
+	}
+
+	testCases := []struct {
+		cache   string
+		tickets null.Bool
+		exp     []string
+	}{
+		{"", null.Bool{}, []string{"full", "full", "full", "full"}},
+		{"none", null.Bool{}, []string{"full", "full", "full", "full"}},
+		{"vu", null.Bool{}, []string{"full", "resumed", "full", "resumed"}},
+		{"vu", null.BoolFrom(false), []string{"full", "full", "full", "full"}},
+		{"shared", null.Bool{}, []string{"full", "resumed", "resumed", "resumed"}},
+	}
+	for _, tc := range testCases {
+		tc := tc
+		t.Run(fmt.Sprintf("cache=%s,tickets=%v", tc.cache, tc.tickets.ValueOrZero() || !tc.tickets.Valid), func(t *testing.T) {
+			require.NoError(t, r.SetOptions(lib.Options{
+				Throw:                 null.BoolFrom(true),
+				InsecureSkipTLSVerify: null.BoolFrom(true),
+				NoConnectionReuse:     null.BoolFrom(true),
+				TLSSessionCache:       null.NewString(tc.cache, tc.cache != ""),
+				TLSSessionTickets:     tc.tickets,
+				SystemTags:            stats.ToSystemTagSet([]string{"tls_handshake"}),
+			}))
+
+			samples := make(chan stats.SampleContainer, 100)
+			for id := int64(1); id <= 2; id++ {
+				initVU, err := r.NewVU(id, samples)
+				require.NoError(t, err)
+				ctx, cancel := context.WithCancel(context.Background())
+				vu := initVU.Activate(&lib.VUActivationParams{RunContext: ctx})
+				require.NoError(t, vu.RunOnce())
+				cancel()
+			}
+			assert.Equal(t, tc.exp, getHandshakes(samples))
+		})
+	}
+}
+
 func TestVUIntegrationBlacklistOption(t *testing.T) {
 	r1, err := getSimpleRunner(t, "/script.js", `
 					var http = require("k6/http");;
@@ -1596,7 +1915,7 @@ func TestStuffNotPanicking(t *testing.T) {
 			var group = require("k6").group;
 			var parseHTML = require("k6/html").parseHTML;
 
-			exports.options = { iterations: 1, vus: 1, vusMax: 1 };
+			exports.options = { iterations: 1, vus: 1 };
 
 			exports.default = function() {
 				var doc = parseHTML(http.get("HTTPBIN_URL/html").body);
@@ -1657,7 +1976,7 @@ func TestPanicOnSimpleHTML(t *testing.T) {
 	r, err := getSimpleRunner(t, "/script.js", tb.Replacer.Replace(`
 			var parseHTML = require("k6/html").parseHTML;
 
-			exports.options = { iterations: 1, vus: 1, vusMax: 1 };
+			exports.options = { iterations: 1, vus: 1 };
 
 			exports.default = function() {
 				var doc = parseHTML("<html>");
@@ -1769,6 +2088,266 @@ func TestSystemTags(t *testing.T) {
 	}
 }
 
+func TestVUScenarioNetwork(t *testing.T) {
+	t.Parallel()
+	tb := httpmultibin.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+
+	r, err := getSimpleRunner(t, "/script.js", tb.Replacer.Replace(`
+		var http = require("k6/http");
+		exports.options = {
+			scenarios: {
+				mobile: {
+					executor: "shared-iterations",
+					network: { latency: "200ms", downloadKbps: 1600 },
+				},
+				fast: { executor: "shared-iterations" },
+				flaky: {
+					executor: "shared-iterations",
+					exec: "flaky",
+					network: { resetRate: 1 },
+				},
+			},
+		};
+		exports.default = function() {
+			http.get("HTTPBIN_IP_URL/get");
+		};
+		exports.flaky = function() {
+			var res = http.get("HTTPBIN_IP_URL/get");
+			if (res.error_code !== 1230) {
+				throw new Error("unexpected error code " + res.error_code + ": " + res.error);
+			}
+		};
+	`))
+	require.NoError(t, err)
+
+	vu, err := r.newVU(1, make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+
+	runIteration := func(scenario string) time.Duration {
+		ctx, cancel := context.WithCancel(context.Background())
+		deactivated := make(chan struct{})
+		activeVU := vu.Activate(&lib.VUActivationParams{
+			RunContext:         ctx,
+			Scenario:           scenario,
+			Exec:               r.GetOptions().Scenarios[scenario].GetExec(),
+			DeactivateCallback: func(lib.InitializedVU) { close(deactivated) },
+		})
+		start := time.Now()
+		require.NoError(t, activeVU.RunOnce())
+		duration := time.Since(start)
+		cancel()
+		<-deactivated
+		return duration
+	}
+
+	// the connection and the request-response round trip are both delayed
+	assert.True(t, runIteration("mobile") >= 350*time.Millisecond)
+	assert.IsType(t, &netext.ShapedDialer{}, vu.state.Dialer)
+	assert.True(t, runIteration("fast") < 200*time.Millisecond)
+	assert.Equal(t, vu.Dialer, vu.state.Dialer)
+	runIteration("flaky")
+}
+
+func TestVUScenarioProxy(t *testing.T) {
+	t.Parallel()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "proxied %s", r.URL.String())
+	}))
+	defer proxy.Close()
+
+	r, err := getSimpleRunner(t, "/script.js", fmt.Sprintf(`
+		var http = require("k6/http");
+		exports.options = {
+			scenarios: {
+				eu: {
+					executor: "shared-iterations",
+					proxy: { url: "%s", hosts: { "direct.k6.io": "direct" } },
+				},
+			},
+		};
+		exports.default = function() {
+			var res = http.get("http://test.k6.io/path");
+			if (res.body !== "proxied http://test.k6.io/path") {
+				throw new Error("unexpected response: " + res.body);
+			}
+			res = http.get("http://direct.k6.io/");
+			if (res.error_code === 0 || res.body) {
+				throw new Error("unexpected proxied response: " + res.body);
+			}
+		};
+	`, proxy.URL))
+	require.NoError(t, err)
+
+	vu, err := r.NewVU(1, make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	activeVU := vu.Activate(&lib.VUActivationParams{RunContext: ctx, Scenario: "eu"})
+	require.NoError(t, activeVU.RunOnce())
+}
+
+func TestVUScenarioProxyReplacesGlobalSOCKSProxy(t *testing.T) {
+	t.Parallel()
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprintf(w, "proxied %s", r.URL.String())
+	}))
+	defer proxy.Close()
+
+	// Nothing listens on the global SOCKS proxy, so only the connections
+	// that don't use it can succeed
+	r, err := getSimpleRunner(t, "/script.js", fmt.Sprintf(`
+		var http = require("k6/http");
+		exports.options = {
+			socksProxy: "socks5://127.0.0.1:1",
+			scenarios: {
+				eu: { executor: "shared-iterations", proxy: { url: "%s" } },
+			},
+		};
+		exports.default = function() {
+			var res = http.get("http://test.k6.io/path");
+			if (res.body !== "proxied http://test.k6.io/path") {
+				throw new Error("unexpected response: " + res.error);
+			}
+		};
+	`, proxy.URL))
+	require.NoError(t, err)
+
+	vu, err := r.NewVU(1, make(chan stats.SampleContainer, 100))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	activeVU := vu.Activate(&lib.VUActivationParams{RunContext: ctx, Scenario: "eu"})
+	require.NoError(t, activeVU.RunOnce())
+}
+
+func TestVUScenarioDNS(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = fmt.Fprint(w, "ok")
+	}))
+	defer srv.Close()
+	_, port, err := net.SplitHostPort(srv.Listener.Addr().String())
+	require.NoError(t, err)
+	dns := mockresolver.NewDNSServer(t, map[string][]net.IP{"app.k6.test": {net.ParseIP("127.0.0.1")}})
+
+	r, err := getSimpleRunner(t, "/script.js", fmt.Sprintf(`
+		var http = require("k6/http");
+		exports.options = {
+			scenarios: {
+				failover: {
+					executor: "shared-iterations",
+					dns: { servers: ["127.0.0.1:1", "%s"], ttl: "0", policy: "onlyIPv4" },
+				},
+			},
+		};
+		exports.default = function() {
+			var res = http.get("http://app.k6.test:%s/");
+			if (res.body !== "ok") {
+				throw new Error("unexpected response: " + res.error);
+			}
+		};
+	`, dns.Addr, port))
+	require.NoError(t, err)
+
+	samples := make(chan stats.SampleContainer, 100)
+	vu, err := r.NewVU(1, samples)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	activeVU := vu.Activate(&lib.VUActivationParams{RunContext: ctx, Scenario: "failover"})
+	require.NoError(t, activeVU.RunOnce())
+
+	var resolvers []string
+	var dataReceived float64
+	for _, sc := range stats.GetBufferedSamples(samples) {
+		for _, sample := range sc.GetSamples() {
+			switch sample.Metric {
+			case metrics.DNSLookupDuration:
+				resolver, _ := sample.Tags.Get("resolver")
+				resolvers = append(resolvers, resolver)
+			case metrics.DataReceived:
+				dataReceived += sample.Value
+			}
+		}
+	}
+	assert.Equal(t, []string{"127.0.0.1:1," + dns.Addr}, resolvers)
+	assert.True(t, dataReceived > 0)
+}
+
+func TestVUScenarioLocalIPs(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, _ := net.SplitHostPort(r.RemoteAddr)
+		_, _ = fmt.Fprint(w, host)
+	}))
+	defer srv.Close()
+
+	r, err := getSimpleRunner(t, "/script.js", fmt.Sprintf(`
+		var http = require("k6/http");
+		exports.options = {
+			scenarios: {
+				multiip: {
+					executor: "shared-iterations",
+					localIPs: { pool: "127.0.0.5-127.0.0.6" },
+				},
+			},
+		};
+		exports.default = function() {
+			var res = http.get("%s");
+			if (res.body !== __ENV.SOURCE_IP) {
+				throw new Error("unexpected source IP: " + res.body);
+			}
+		};
+	`, srv.URL))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	for id, ip := range map[int64]string{1: "127.0.0.5", 2: "127.0.0.6", 3: "127.0.0.5"} {
+		vu, err := r.NewVU(id, make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+		activeVU := vu.Activate(&lib.VUActivationParams{
+			RunContext: ctx, Scenario: "multiip", Env: map[string]string{"SOURCE_IP": ip},
+		})
+		require.NoError(t, activeVU.RunOnce())
+	}
+}
+
+func TestVUSeed(t *testing.T) {
+	t.Parallel()
+	r, err := getSimpleRunner(t, "/script.js", `
+		exports.options = { seed: 42 };
+		var initValue = Math.random();
+		var values = [];
+		exports.default = function() {
+			values.push([initValue, Math.random()]);
+		};
+	`)
+	require.NoError(t, err)
+
+	run := func(id int64, iterations int) [][]float64 {
+		vu, err := r.NewVU(id, make(chan stats.SampleContainer, 100))
+		require.NoError(t, err)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		activeVU := vu.Activate(&lib.VUActivationParams{RunContext: ctx})
+		for i := 0; i < iterations; i++ {
+			require.NoError(t, activeVU.RunOnce())
+		}
+		var values [][]float64
+		require.NoError(t, activeVU.(*ActiveVU).Runtime.ExportTo(activeVU.(*ActiveVU).Runtime.Get("values"), &values))
+		return values
+	}
+
+	vu1 := run(1, 3)
+	assert.Equal(t, vu1, run(1, 3))
+	assert.NotEqual(t, vu1[0][1], vu1[1][1])
+	vu2 := run(2, 3)
+	assert.NotEqual(t, vu1[0][0], vu2[0][0])
+	assert.NotEqual(t, vu1[0][1], vu2[0][1])
+}
+
 func TestVUPanic(t *testing.T) {
 	r1, err := getSimpleRunner(t, "/script.js", `
 			var group = require("k6").group;
@@ -0,0 +1,220 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package js
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/dop251/goja"
+)
+
+// setupDataStore holds the setup() data of an instance, parsed only once and
+// shared between all VUs. With the lazySetupData option, VUs get a handle to
+// it instead of their own copy of all of the data.
+type setupDataStore struct {
+	raw []byte
+
+	once sync.Once
+	data interface{}
+	err  error
+}
+
+func newSetupDataStore(raw []byte) *setupDataStore {
+	return &setupDataStore{raw: raw}
+}
+
+func (s *setupDataStore) get() (interface{}, error) {
+	s.once.Do(func() {
+		s.err = json.Unmarshal(s.raw, &s.data)
+	})
+	return s.data, s.err
+}
+
+// lookup returns the part of the data at the given path, either a string of
+// dot-separated keys and array indexes or an array of them.
+func (s *setupDataStore) lookup(path goja.Value) (interface{}, error) {
+	node, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+
+	var segments []string
+	if pathString(path) != "" {
+		switch p := path.Export().(type) {
+		case string:
+			if p != "" {
+				segments = strings.Split(p, ".")
+			}
+		case []interface{}:
+			for _, s := range p {
+				segments = append(segments, fmt.Sprint(s))
+			}
+		default:
+			return nil, fmt.Errorf("invalid setup data path %q", pathString(path))
+		}
+	}
+
+	for i, segment := range segments {
+		switch n := node.(type) {
+		case map[string]interface{}:
+			v, ok := n[segment]
+			if !ok {
+				return nil, fmt.Errorf("setup data has no key %q at %q", segment, strings.Join(segments[:i], "."))
+			}
+			node = v
+		case []interface{}:
+			idx, err := strconv.Atoi(segment)
+			if err != nil || idx < 0 || idx >= len(n) {
+				return nil, fmt.Errorf("setup data has no index %q at %q", segment, strings.Join(segments[:i], "."))
+			}
+			node = n[idx]
+		default:
+			return nil, fmt.Errorf("setup data at %q is neither an object nor an array", strings.Join(segments[:i], "."))
+		}
+	}
+	return node, nil
+}
+
+// copySetupData makes a deep copy of a part of the parsed setup data, so VUs
+// can't modify the data shared with the other VUs.
+func copySetupData(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			res[k] = copySetupData(e)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, e := range v {
+			res[i] = copySetupData(e)
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// SetupData is the handle to the setup() data that is passed to the VU
+// functions with the lazySetupData option, so they only copy the parts of the
+// data they need.
+type SetupData struct {
+	store *setupDataStore
+}
+
+// Get returns a copy of the data at the given path, or all of it.
+func (d *SetupData) Get(path goja.Value) (interface{}, error) {
+	v, err := d.store.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	return copySetupData(v), nil
+}
+
+// Has returns whether there is data at the given path.
+func (d *SetupData) Has(path goja.Value) bool {
+	_, err := d.store.lookup(path)
+	return err == nil
+}
+
+// Keys returns the sorted keys of the object at the given path.
+func (d *SetupData) Keys(path goja.Value) ([]string, error) {
+	v, err := d.store.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	obj, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("setup data at %q isn't an object", pathString(path))
+	}
+	keys := make([]string, 0, len(obj))
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Length returns the length of the array, object or string at the given path.
+func (d *SetupData) Length(path goja.Value) (int, error) {
+	v, err := d.store.lookup(path)
+	if err != nil {
+		return 0, err
+	}
+	switch v := v.(type) {
+	case []interface{}:
+		return len(v), nil
+	case map[string]interface{}:
+		return len(v), nil
+	case string:
+		return len(v), nil
+	default:
+		return 0, fmt.Errorf("setup data at %q has no length", pathString(path))
+	}
+}
+
+// Slice returns a copy of the elements of the array at the given path between
+// start and end, which work as with Array.prototype.slice().
+func (d *SetupData) Slice(path goja.Value, start, end goja.Value) ([]interface{}, error) {
+	v, err := d.store.lookup(path)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("setup data at %q isn't an array", pathString(path))
+	}
+	from, to := sliceIndex(start, len(arr), 0), sliceIndex(end, len(arr), len(arr))
+	if from >= to {
+		return []interface{}{}, nil
+	}
+	return copySetupData(arr[from:to]).([]interface{}), nil
+}
+
+func pathString(path goja.Value) string {
+	if path == nil || goja.IsUndefined(path) || goja.IsNull(path) {
+		return ""
+	}
+	return path.String()
+}
+
+func sliceIndex(v goja.Value, length, def int) int {
+	if v == nil || goja.IsUndefined(v) {
+		return def
+	}
+	idx := int(v.ToInteger())
+	if idx < 0 {
+		idx += length
+	}
+	if idx < 0 {
+		return 0
+	}
+	if idx > length {
+		return length
+	}
+	return idx
+}
@@ -22,13 +22,17 @@ package js
 
 import (
 	"bytes"
+	"encoding/csv"
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"time"
 
 	"github.com/dop251/goja"
 	"github.com/loadimpact/k6/js/common"
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/slo"
 	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/ui"
 )
@@ -92,7 +96,7 @@ const summaryWrapperLambdaCode = `
 
 	// TODO: bundle the text summary generation from jslib and get rid of oldCallback
 
-	return function(exportedSummaryCallback, jsonSummaryPath, data, oldCallback) {
+	return function(exportedSummaryCallback, jsonSummaryPath, data, oldCallback, markdownSummaryPath, markdownCallback, csvSummaryPath, csvCallback, githubActions, githubStepSummaryPath, githubCallback, htmlReportPath, htmlCallback, junitReportPath, junitCallback) {
 		var result = {};
 		if (exportedSummaryCallback) {
 			try {
@@ -111,6 +115,24 @@ const summaryWrapperLambdaCode = `
 		if (jsonSummaryPath != '') {
 			result[jsonSummaryPath] = oldJSONSummary(data);
 		}
+		if (markdownSummaryPath != '') {
+			result[markdownSummaryPath] = markdownCallback();
+		}
+		if (csvSummaryPath != '') {
+			result[csvSummaryPath] = csvCallback();
+		}
+		if (githubActions) {
+			result["stdout"] = (result["stdout"] || '') + githubCallback();
+			if (githubStepSummaryPath != '') {
+				result[githubStepSummaryPath] = markdownCallback();
+			}
+		}
+		if (htmlReportPath != '') {
+			result[htmlReportPath] = htmlCallback();
+		}
+		if (junitReportPath != '') {
+			result[junitReportPath] = junitCallback();
+		}
 
 		return result;
 	};
@@ -124,6 +146,10 @@ func metricValueGetter(summaryTrendStats []string) func(stats.Sink, time.Duratio
 	if err != nil {
 		panic(err.Error()) // this should have been validated already
 	}
+	histogramResolvers, err := stats.GetResolversForHistogramColumns(summaryTrendStats)
+	if err != nil {
+		panic(err.Error())
+	}
 
 	return func(sink stats.Sink, t time.Duration) (result map[string]float64) {
 		sink.Calc()
@@ -145,9 +171,20 @@ func metricValueGetter(summaryTrendStats []string) func(stats.Sink, time.Duratio
 			result["passes"] = float64(sink.Trues)
 			result["fails"] = float64(sink.Total - sink.Trues)
 		case *stats.TrendSink:
+			columns := stats.TrendColumns(summaryTrendStats, sink.Percentiles)
+			result = make(map[string]float64, len(columns))
+			for _, col := range columns {
+				if resolve, ok := trendResolvers[col]; ok {
+					result[col] = resolve(sink)
+					continue
+				}
+				percentile, _ := stats.ParsePercentile(col)
+				result[col] = sink.P(percentile / 100)
+			}
+		case *stats.HistogramSink:
 			result = make(map[string]float64, len(summaryTrendStats))
 			for _, col := range summaryTrendStats {
-				result[col] = trendResolvers[col](sink)
+				result[col] = histogramResolvers[col](sink)
 			}
 		}
 
@@ -175,6 +212,12 @@ func summarizeMetricsToObject(data *lib.Summary, options lib.Options) map[string
 			"contains": m.Contains.String(),
 			"values":   getMetricValues(m.Sink, data.TestRunDuration),
 		}
+		if m.Unit != "" {
+			metricData["unit"] = m.Unit
+		}
+		if m.Description != "" {
+			metricData["description"] = m.Description
+		}
 
 		if len(m.Thresholds.Thresholds) > 0 {
 			thresholds := make(map[string]interface{})
@@ -189,9 +232,77 @@ func summarizeMetricsToObject(data *lib.Summary, options lib.Options) map[string
 	}
 	m["metrics"] = metricsData
 
+	if data.RequestTimings != nil {
+		m["request_timings"] = exportRequestTimings(data.RequestTimings)
+	}
+
+	if len(data.SLOs) > 0 {
+		m["slos"] = exportSLOs(data.SLOs)
+	}
+
 	return m
 }
 
+// exportSLOs returns the results of the service level objectives, with the
+// same keys as their JSON form.
+func exportSLOs(results []slo.Result) []map[string]interface{} {
+	slos := make([]map[string]interface{}, len(results))
+	for i, result := range results {
+		slos[i] = map[string]interface{}{
+			"name":              result.Name,
+			"kind":              result.Kind,
+			"metric":            result.Metric,
+			"objective":         result.Objective,
+			"value":             result.Value,
+			"target":            result.Target,
+			"error_budget_used": result.ErrorBudgetUsed,
+			"met":               result.Met,
+			"no_data":           result.NoData,
+		}
+	}
+	return slos
+}
+
+// exportRequestTimings returns the average time the requests of each group
+// spent in each phase, in ms, with the totals of the groups.
+func exportRequestTimings(timings *lib.RequestTimings) []map[string]interface{} {
+	groups := timings.Groups()
+	result := make([]map[string]interface{}, len(groups))
+	for i, group := range groups {
+		groupPhases := make(map[string]interface{}, len(lib.RequestPhases))
+		groupTotals := make([]float64, len(lib.RequestPhases))
+		requests := make([]map[string]interface{}, len(group.Requests))
+		for j, request := range group.Requests {
+			phases := make(map[string]interface{}, len(lib.RequestPhases))
+			total := 0.0
+			for k, avg := range request.Avg() {
+				phases[lib.RequestPhases[k].Name] = avg
+				total += avg
+				groupTotals[k] += avg
+			}
+			requests[j] = map[string]interface{}{
+				"method": request.Method,
+				"name":   request.Name,
+				"count":  request.Count,
+				"phases": phases,
+				"total":  total,
+			}
+		}
+		total := 0.0
+		for k, v := range groupTotals {
+			groupPhases[lib.RequestPhases[k].Name] = v
+			total += v
+		}
+		result[i] = map[string]interface{}{
+			"group":    group.Path,
+			"requests": requests,
+			"phases":   groupPhases,
+			"total":    total,
+		}
+	}
+	return result
+}
+
 func exportGroup(group *lib.Group) map[string]interface{} {
 	subGroups := make([]map[string]interface{}, len(group.OrderedGroups))
 	for i, subGroup := range group.OrderedGroups {
@@ -247,6 +358,7 @@ func getOldTextSummaryFunc(summary *lib.Summary, options lib.Options) func() str
 		RootGroup: summary.RootGroup,
 		Time:      summary.TestRunDuration,
 		TimeUnit:  options.SummaryTimeUnit.String,
+		SLOs:      summary.SLOs,
 	}
 
 	return func() string {
@@ -261,3 +373,145 @@ func getOldTextSummaryFunc(summary *lib.Summary, options lib.Options) func() str
 		return buffer.String()
 	}
 }
+
+func getMarkdownSummaryFunc(summary *lib.Summary, options lib.Options) func() string {
+	data := ui.SummaryData{
+		Metrics:   summary.Metrics,
+		RootGroup: summary.RootGroup,
+		Time:      summary.TestRunDuration,
+		TimeUnit:  options.SummaryTimeUnit.String,
+	}
+
+	return func() string {
+		buffer := bytes.NewBuffer(nil)
+		ui.NewSummary(options.SummaryTrendStats).SummarizeMetricsMarkdown(buffer, data)
+		return buffer.String()
+	}
+}
+
+// getCSVSummaryFunc returns a function that writes the summary as CSV, with a
+// row for each metric and submetric and a column for each of the computed
+// values of any metric type. Values that don't apply to a metric are empty.
+func getCSVSummaryFunc(summary *lib.Summary, options lib.Options) func() string {
+	return func() string {
+		getMetricValues := metricValueGetter(options.SummaryTrendStats)
+
+		columns := append([]string{}, options.SummaryTrendStats...)
+		var percentiles []float64
+		for _, m := range summary.Metrics {
+			if trend, ok := m.Sink.(*stats.TrendSink); ok {
+				percentiles = append(percentiles, trend.Percentiles...)
+			}
+		}
+		sort.Float64s(percentiles)
+		extraColumns := make([]string, 0, len(percentiles)+7)
+		for _, percentile := range percentiles {
+			extraColumns = append(extraColumns, stats.PercentileColumn(percentile))
+		}
+		extraColumns = append(extraColumns, "count", "rate", "value", "min", "max", "passes", "fails")
+		for _, col := range extraColumns {
+			found := false
+			for _, existing := range columns {
+				found = found || existing == col
+			}
+			if !found {
+				columns = append(columns, col)
+			}
+		}
+
+		names := make([]string, 0, len(summary.Metrics))
+		for name := range summary.Metrics {
+			names = append(names, name)
+		}
+		// keep submetrics right after their parent metrics
+		sortKey := func(name string) string {
+			if parent := summary.Metrics[name].Sub.Parent; parent != "" {
+				return parent + "\x00" + name
+			}
+			return name
+		}
+		sort.Slice(names, func(i, j int) bool { return sortKey(names[i]) < sortKey(names[j]) })
+
+		buffer := bytes.NewBuffer(nil)
+		w := csv.NewWriter(buffer)
+		_ = w.Write(append([]string{"metric", "parent", "tags", "type", "contains", "thresholds"}, columns...))
+		for _, name := range names {
+			m := summary.Metrics[name]
+			thresholds := ""
+			if len(m.Thresholds.Thresholds) > 0 {
+				thresholds = "ok"
+				for _, threshold := range m.Thresholds.Thresholds {
+					if threshold.LastFailed {
+						thresholds = "failed"
+					}
+				}
+			}
+			row := []string{name, m.Sub.Parent, m.Sub.Suffix, m.Type.String(), m.Contains.String(), thresholds}
+
+			values := getMetricValues(m.Sink, summary.TestRunDuration)
+			for _, col := range columns {
+				if v, ok := values[col]; ok {
+					row = append(row, strconv.FormatFloat(v, 'f', -1, 64))
+				} else {
+					row = append(row, "")
+				}
+			}
+			_ = w.Write(row)
+		}
+		w.Flush()
+		return buffer.String()
+	}
+}
+
+// getHTMLSummaryFunc returns a function that renders the summary as a
+// standalone HTML report. An error is thrown as an exception in the JS wrapper.
+func getHTMLSummaryFunc(summary *lib.Summary, options lib.Options) func() (string, error) {
+	data := ui.SummaryData{
+		Metrics:   summary.Metrics,
+		RootGroup: summary.RootGroup,
+		Time:      summary.TestRunDuration,
+		TimeUnit:  options.SummaryTimeUnit.String,
+	}
+
+	return func() (string, error) {
+		buffer := bytes.NewBuffer(nil)
+		if err := ui.NewSummary(options.SummaryTrendStats).SummarizeMetricsHTML(buffer, data); err != nil {
+			return "", err
+		}
+		return buffer.String(), nil
+	}
+}
+
+// getJUnitSummaryFunc returns a function that writes the thresholds and
+// checks as JUnit XML. An error is thrown as an exception in the JS wrapper.
+func getJUnitSummaryFunc(summary *lib.Summary, options lib.Options) func() (string, error) {
+	data := ui.SummaryData{
+		Metrics:   summary.Metrics,
+		RootGroup: summary.RootGroup,
+		Time:      summary.TestRunDuration,
+		TimeUnit:  options.SummaryTimeUnit.String,
+	}
+
+	return func() (string, error) {
+		buffer := bytes.NewBuffer(nil)
+		if err := ui.NewSummary(options.SummaryTrendStats).SummarizeJUnit(buffer, data); err != nil {
+			return "", err
+		}
+		return buffer.String(), nil
+	}
+}
+
+func getGitHubActionsSummaryFunc(summary *lib.Summary, options lib.Options) func() string {
+	data := ui.SummaryData{
+		Metrics:   summary.Metrics,
+		RootGroup: summary.RootGroup,
+		Time:      summary.TestRunDuration,
+		TimeUnit:  options.SummaryTimeUnit.String,
+	}
+
+	return func() string {
+		buffer := bytes.NewBuffer(nil)
+		ui.NewSummary(options.SummaryTrendStats).SummarizeGitHubActions(buffer, data)
+		return buffer.String()
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
+	"strings"
 	"testing"
 	"time"
 
@@ -34,6 +35,8 @@ import (
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/slo"
 	"github.com/loadimpact/k6/lib/testutils"
 	"github.com/loadimpact/k6/stats"
 )
@@ -95,6 +98,36 @@ func TestTextSummary(t *testing.T) {
 	}
 }
 
+func TestTextSummaryTrendPercentiles(t *testing.T) {
+	t.Parallel()
+	summary := createTestSummary(t)
+	summary.Metrics["my_trend"].Sink.(*stats.TrendSink).Percentiles = []float64{75, 99.9}
+	runner, err := getSimpleRunner(
+		t, "/script.js",
+		`
+		exports.options = {summaryTrendStats: ["avg", "p(95)", "max"]};
+		exports.default = function() {/* we don't run this, metrics are mocked */};
+		`,
+		lib.RuntimeOptions{
+			CompatibilityMode: null.NewString("base", true),
+			SummaryExportCSV:  null.StringFrom("summary.csv"),
+		},
+	)
+	require.NoError(t, err)
+
+	result, err := runner.HandleSummary(context.Background(), summary)
+	require.NoError(t, err)
+
+	textSummary, err := ioutil.ReadAll(result["stdout"])
+	require.NoError(t, err)
+	assert.Contains(t, string(textSummary), "   ✗ my_trend....: avg=15ms max=20ms p(75)=17.5ms p(99.9)=19.99ms\n")
+
+	csvSummary, err := ioutil.ReadAll(result["summary.csv"])
+	require.NoError(t, err)
+	assert.Contains(t, string(csvSummary), "thresholds,avg,p(95),max,p(75),p(99.9),count,")
+	assert.Contains(t, string(csvSummary), "\nmy_trend,,,trend,time,failed,15,,20,17.5,19.990000000000002,")
+}
+
 func createTestMetrics(t *testing.T) (map[string]*stats.Metric, *lib.Group) {
 	metrics := make(map[string]*stats.Metric)
 	gaugeMetric := stats.New("vus", stats.Gauge)
@@ -274,6 +307,299 @@ func TestOldJSONExport(t *testing.T) {
 	assert.JSONEq(t, expectedOldJSONExportResult, string(jsonExport))
 }
 
+const expectedMarkdownSummary = "### ❌ k6: 1 of 2 thresholds failed\n\n" +
+	"Test run duration: 1s\n\n" +
+	"|  | Metric | Threshold |\n| --- | --- | --- |\n" +
+	"| ✅ | http_reqs | `rate<100` |\n" +
+	"| ❌ | my_trend | `my_trend<1000` |\n\n" +
+	"|  | Check | Passes | Fails |\n| --- | --- | --- | --- |\n" +
+	"| ✅ | child › check1 | 30 | 0 |\n" +
+	"| ❌ | child › check3 | 10 | 5 |\n" +
+	"| ❌ | child › check2 | 5 | 10 |\n\n" +
+	"| Metric | Value |\n| --- | --- |\n" +
+	"| checks | 75.00% (✓ 45 ✗ 15) |\n" +
+	"| http_reqs | 3 (3/s) |\n" +
+	"| my_trend | avg=15ms p(95)=19.5ms |\n" +
+	"| vus | 1 (min=1 max=1) |\n"
+
+func TestMarkdownSummary(t *testing.T) {
+	t.Parallel()
+	runner, err := getSimpleRunner(
+		t, "/script.js",
+		`
+		exports.options = {summaryTrendStats: ["avg", "p(95)"]};
+		exports.default = function() {/* we don't run this, metrics are mocked */};
+		`,
+		lib.RuntimeOptions{
+			CompatibilityMode: null.NewString("base", true),
+			SummaryMarkdown:   null.StringFrom("summary.md"),
+		},
+	)
+	require.NoError(t, err)
+
+	result, err := runner.HandleSummary(context.Background(), createTestSummary(t))
+	require.NoError(t, err)
+
+	require.Len(t, result, 2)
+	require.NotNil(t, result["stdout"])
+	require.NotNil(t, result["summary.md"])
+	markdown, err := ioutil.ReadAll(result["summary.md"])
+	require.NoError(t, err)
+	assert.Equal(t, expectedMarkdownSummary, string(markdown))
+}
+
+const expectedGitHubActionsSummary = "::error title=Threshold crossed::my_trend: my_trend<1000 (avg=15ms p(95)=19.5ms)\n" +
+	"::warning title=Check failed::child › check3: 5 of 15 failed\n" +
+	"::warning title=Check failed::child › check2: 10 of 15 failed\n" +
+	"::notice title=Thresholds::1 of 2 thresholds failed\n" +
+	"::notice title=Checks::45 of 60 checks passed (75.00%25)\n"
+
+func TestGitHubActionsSummary(t *testing.T) {
+	t.Parallel()
+	runner, err := getSimpleRunner(
+		t, "/script.js",
+		`
+		exports.options = {summaryTrendStats: ["avg", "p(95)"]};
+		exports.default = function() {/* we don't run this, metrics are mocked */};
+		`,
+		lib.RuntimeOptions{
+			CompatibilityMode:    null.NewString("base", true),
+			SummaryGitHubActions: null.BoolFrom(true),
+			GitHubStepSummary:    null.StringFrom("step_summary.md"),
+		},
+	)
+	require.NoError(t, err)
+
+	result, err := runner.HandleSummary(context.Background(), createTestSummary(t))
+	require.NoError(t, err)
+
+	require.Len(t, result, 2)
+	require.NotNil(t, result["stdout"])
+	stdout, err := ioutil.ReadAll(result["stdout"])
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(string(stdout), expectedGitHubActionsSummary), string(stdout))
+	require.NotNil(t, result["step_summary.md"])
+	markdown, err := ioutil.ReadAll(result["step_summary.md"])
+	require.NoError(t, err)
+	assert.Equal(t, expectedMarkdownSummary, string(markdown))
+}
+
+func TestHTMLReport(t *testing.T) {
+	t.Parallel()
+	runner, err := getSimpleRunner(
+		t, "/script.js",
+		`
+		exports.options = {summaryTrendStats: ["avg", "p(95)"]};
+		exports.default = function() {/* we don't run this, metrics are mocked */};
+		`,
+		lib.RuntimeOptions{
+			CompatibilityMode: null.NewString("base", true),
+			ReportHTML:        null.StringFrom("report.html"),
+		},
+	)
+	require.NoError(t, err)
+
+	result, err := runner.HandleSummary(context.Background(), createTestSummary(t))
+	require.NoError(t, err)
+
+	require.Len(t, result, 2)
+	require.NotNil(t, result["stdout"])
+	require.NotNil(t, result["report.html"])
+	report, err := ioutil.ReadAll(result["report.html"])
+	require.NoError(t, err)
+
+	html := string(report)
+	assert.True(t, strings.HasPrefix(html, "<!DOCTYPE html>"))
+	assert.Contains(t, html, "✗ 1 of 2 thresholds failed.")
+	assert.Contains(t, html, `<tr class="fail"><td><span class="fail">✗</span></td><td>my_trend</td><td><code>my_trend&lt;1000</code></td></tr>`)
+	assert.Contains(t, html, "<td>child › check2</td><td class=\"num\">5</td><td class=\"num\">10</td><td class=\"num\">33.33%</td>")
+	assert.Contains(t, html, "<td>my_trend</td><td>trend</td><td>avg=15ms p(95)=19.5ms</td>")
+	assert.Contains(t, html, "<h3>my_trend <small>(3 values)</small></h3>")
+	assert.Equal(t, 30, strings.Count(html, "<rect "))
+	assert.NotContains(t, html, "ZgotmplZ")
+}
+
+const expectedJUnitSummary = `<?xml version="1.0" encoding="UTF-8"?>
+<testsuites name="k6" tests="5" failures="3" time="1.000">
+  <testsuite name="thresholds" tests="2" failures="1" time="1.000">
+    <testcase name="http_reqs: rate&lt;100" classname="k6.thresholds.http_reqs"></testcase>
+    <testcase name="my_trend: my_trend&lt;1000" classname="k6.thresholds.my_trend">
+      <failure message="threshold my_trend&lt;1000 crossed (avg=15ms p(95)=19.5ms)" type="threshold">my_trend: my_trend&lt;1000&#xA;avg=15ms p(95)=19.5ms&#xA;</failure>
+    </testcase>
+  </testsuite>
+  <testsuite name="checks" tests="3" failures="2" time="1.000">
+    <testcase name="child › check1" classname="k6.checks"></testcase>
+    <testcase name="child › check3" classname="k6.checks">
+      <failure message="5 of 15 failed" type="check">child › check3: 10 passes, 5 fails&#xA;</failure>
+    </testcase>
+    <testcase name="child › check2" classname="k6.checks">
+      <failure message="10 of 15 failed" type="check">child › check2: 5 passes, 10 fails&#xA;</failure>
+    </testcase>
+  </testsuite>
+</testsuites>
+`
+
+func TestJUnitReport(t *testing.T) {
+	t.Parallel()
+	runner, err := getSimpleRunner(
+		t, "/script.js",
+		`
+		exports.options = {summaryTrendStats: ["avg", "p(95)"]};
+		exports.default = function() {/* we don't run this, metrics are mocked */};
+		`,
+		lib.RuntimeOptions{
+			CompatibilityMode: null.NewString("base", true),
+			ReportJUnit:       null.StringFrom("junit.xml"),
+		},
+	)
+	require.NoError(t, err)
+
+	result, err := runner.HandleSummary(context.Background(), createTestSummary(t))
+	require.NoError(t, err)
+
+	require.Len(t, result, 2)
+	require.NotNil(t, result["stdout"])
+	require.NotNil(t, result["junit.xml"])
+	junit, err := ioutil.ReadAll(result["junit.xml"])
+	require.NoError(t, err)
+	assert.Equal(t, expectedJUnitSummary, string(junit))
+}
+
+func TestCSVSummary(t *testing.T) {
+	t.Parallel()
+	runner, err := getSimpleRunner(
+		t, "/script.js",
+		`
+		exports.options = {summaryTrendStats: ["avg", "p(95)", "max"]};
+		exports.default = function() {/* we don't run this, metrics are mocked */};
+		`,
+		lib.RuntimeOptions{
+			CompatibilityMode: null.NewString("base", true),
+			SummaryExportCSV:  null.StringFrom("summary.csv"),
+		},
+	)
+	require.NoError(t, err)
+
+	summary := createTestSummary(t)
+	parent, sub := stats.NewSubmetric("my_trend{tag:a}")
+	sub.Metric = stats.New(sub.Name, stats.Trend, stats.Time)
+	sub.Metric.Sub = *sub
+	sub.Metric.Sink.Add(stats.Sample{Value: 10})
+	summary.Metrics[sub.Name] = sub.Metric
+	summary.Metrics["vus_max"] = stats.New("vus_max", stats.Gauge)
+	require.Equal(t, "my_trend", parent)
+
+	result, err := runner.HandleSummary(context.Background(), summary)
+	require.NoError(t, err)
+
+	require.Len(t, result, 2)
+	require.NotNil(t, result["stdout"])
+	require.NotNil(t, result["summary.csv"])
+	csvSummary, err := ioutil.ReadAll(result["summary.csv"])
+	require.NoError(t, err)
+	assert.Equal(t, expectedCSVSummary, string(csvSummary))
+}
+
+const expectedCSVSummary = `metric,parent,tags,type,contains,thresholds,avg,p(95),max,count,rate,value,min,passes,fails
+checks,,,rate,default,,,,,,0.75,,,45,15
+http_reqs,,,counter,default,ok,,,,3,3,,,,
+my_trend,,,trend,time,failed,15,19.5,20,,,,,,
+my_trend{tag:a},my_trend,tag:a,trend,time,,10,10,10,,,,,,
+vus,,,gauge,default,,,,1,,,1,1,,
+vus_max,,,gauge,default,,,,0,,,0,0,,
+`
+
+func TestRequestTimingsExport(t *testing.T) {
+	t.Parallel()
+	timings := lib.NewRequestTimings()
+	tags := stats.NewSampleTags(map[string]string{"group": "::login", "method": "POST", "url": "https://test.k6.io/"})
+	timings.Add([]stats.Sample{
+		{Metric: metrics.HTTPReqs, Value: 1, Tags: tags},
+		{Metric: metrics.HTTPReqBlocked, Value: 1, Tags: tags},
+		{Metric: metrics.HTTPReqWaiting, Value: 10, Tags: tags},
+	})
+
+	runner, err := getSimpleRunner(
+		t, "/script.js",
+		`exports.default = function() {/* we don't run this, metrics are mocked */};`,
+		lib.RuntimeOptions{
+			CompatibilityMode: null.NewString("base", true),
+			SummaryExport:     null.StringFrom("result.json"),
+		},
+	)
+	require.NoError(t, err)
+
+	summary := createTestSummary(t)
+	summary.RequestTimings = timings
+	result, err := runner.HandleSummary(context.Background(), summary)
+	require.NoError(t, err)
+
+	jsonExport, err := ioutil.ReadAll(result["result.json"])
+	require.NoError(t, err)
+	var exported struct {
+		RequestTimings json.RawMessage `json:"request_timings"`
+	}
+	require.NoError(t, json.Unmarshal(jsonExport, &exported))
+	assert.JSONEq(t, `[{
+		"group": "::login",
+		"phases": {"blocked": 1, "dns_lookup": 0, "connecting": 0, "tls_handshaking": 0, "sending": 0, "waiting": 10, "receiving": 0},
+		"total": 11,
+		"requests": [{
+			"method": "POST",
+			"name": "https://test.k6.io/",
+			"count": 1,
+			"phases": {"blocked": 1, "dns_lookup": 0, "connecting": 0, "tls_handshaking": 0, "sending": 0, "waiting": 10, "receiving": 0},
+			"total": 11
+		}]
+	}]`, string(exported.RequestTimings))
+}
+
+func TestSLOSummary(t *testing.T) {
+	t.Parallel()
+	runner, err := getSimpleRunner(
+		t, "/script.js",
+		`exports.default = function() {/* we don't run this, metrics are mocked */};`,
+		lib.RuntimeOptions{
+			CompatibilityMode: null.NewString("base", true),
+			SummaryExport:     null.StringFrom("result.json"),
+		},
+	)
+	require.NoError(t, err)
+
+	summary := createTestSummary(t)
+	summary.SLOs = []slo.Result{
+		{
+			Name: "availability", Kind: slo.KindAvailability, Metric: "http_req_failed",
+			Objective: "99.9% availability", Value: 99.95, Target: 99.9, ErrorBudgetUsed: 0.5, Met: true,
+		},
+		{
+			Name: "latency", Kind: slo.KindLatency, Metric: "http_req_duration",
+			Objective: "p(95) <= 300ms", Value: 450, Target: 300, ErrorBudgetUsed: 2, Met: false,
+		},
+		{
+			Name: "missing", Kind: slo.KindLatency, Metric: "other",
+			Objective: "p(95) <= 1s", Target: 1000, NoData: true,
+		},
+	}
+	result, err := runner.HandleSummary(context.Background(), summary)
+	require.NoError(t, err)
+
+	textSummary, err := ioutil.ReadAll(result["stdout"])
+	require.NoError(t, err)
+	assert.Contains(t, string(textSummary), "\n     service level objectives\n\n"+
+		"   ✓ availability...: 99.95% objective: 99.9% availability error budget used: 50.0%\n"+
+		"   ✗ latency........: 450ms objective: p(95) <= 300ms error budget used: 200.0%\n"+
+		"     missing........: no data objective: p(95) <= 1s\n")
+
+	jsonExport, err := ioutil.ReadAll(result["result.json"])
+	require.NoError(t, err)
+	var exported struct {
+		SLOs []slo.Result `json:"slos"`
+	}
+	require.NoError(t, json.Unmarshal(jsonExport, &exported))
+	assert.Equal(t, summary.SLOs, exported.SLOs)
+}
+
 const expectedHandleSummaryRawData = `
 {
     "root_group": {
@@ -475,3 +801,17 @@ func TestExceptionInHandleSummaryFallsBackToTextSummary(t *testing.T) {
 	require.NoError(t, err)
 	assert.Contains(t, errMsg, "intentional error")
 }
+
+func TestHistogramSummaryValues(t *testing.T) {
+	t.Parallel()
+	sink := &stats.HistogramSink{}
+	for _, v := range []float64{10, 15, 20} {
+		sink.Add(stats.Sample{Value: v})
+	}
+	values := metricValueGetter([]string{"avg", "min", "max", "count", "p(95)"})(sink, time.Second)
+	assert.Equal(t, 15.0, values["avg"])
+	assert.Equal(t, 10.0, values["min"])
+	assert.Equal(t, 20.0, values["max"])
+	assert.Equal(t, 3.0, values["count"])
+	assert.InDelta(t, 19.5, values["p(95)"], 0.5)
+}
@@ -0,0 +1,371 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package cardinality guards the metrics pipeline against tags with too many
+// distinct values, like unique URLs, which would otherwise create an unbounded
+// number of time series in the outputs.
+package cardinality
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// The actions that can be taken for the offending tag once a metric goes over
+// the time series limit.
+const (
+	ActionDrop  = "drop"
+	ActionHash  = "hash"
+	ActionAbort = "abort"
+)
+
+// The defaults for the unset Config fields.
+const (
+	DefaultMaxSeriesPerMetric = 10000
+	DefaultHashBuckets        = 100
+)
+
+// Config specifies the time series limit and what happens past it.
+type Config struct {
+	// The maximum number of distinct time series of every metric
+	MaxSeriesPerMetric int `json:"maxSeriesPerMetric"`
+	// One of "drop" (the default), "hash" or "abort"
+	Action string `json:"action"`
+	// How many distinct values the offending tags are hashed into
+	HashBuckets int `json:"hashBuckets"`
+}
+
+// Validate returns an error for every invalid field of the config.
+func (c Config) Validate() []error {
+	var errs []error
+	if c.MaxSeriesPerMetric < 0 {
+		errs = append(errs, fmt.Errorf("the time series limit can't be negative, but is %d", c.MaxSeriesPerMetric))
+	}
+	switch c.Action {
+	case "", ActionDrop, ActionHash, ActionAbort:
+	default:
+		errs = append(errs, fmt.Errorf("invalid cardinality limit action '%s', it should be one of '%s', '%s' or '%s'",
+			c.Action, ActionDrop, ActionHash, ActionAbort))
+	}
+	if c.HashBuckets < 0 {
+		errs = append(errs, fmt.Errorf("the number of hash buckets can't be negative, but is %d", c.HashBuckets))
+	}
+	return errs
+}
+
+// Limiter tracks the distinct time series of every metric. When a new time
+// series would put a metric over the limit, the tag with the most distinct
+// values is found and, depending on the action, either dropped or hashed from
+// then on in the samples of all metrics, or the test is aborted. It's safe for
+// concurrent use.
+type Limiter struct {
+	maxSeries   int
+	action      string
+	hashBuckets uint32
+	logger      logrus.FieldLogger
+
+	mu sync.Mutex
+	// The distinct time series and tag values of every metric
+	metrics map[string]*metricSeries
+	// The tags that are dropped or hashed
+	limitedTags map[string]bool
+	// The limited versions of the tag sets, only reset when a tag is limited
+	tagCache map[*stats.SampleTags]*stats.SampleTags
+	// The error that aborts the test, if the limit was reached with the abort
+	// action
+	abortErr error
+}
+
+type metricSeries struct {
+	// The tags of every time series by their keys
+	series map[string]map[string]string
+	// The distinct values of every tag in the time series
+	tagValues map[string]map[string]struct{}
+	// The (limited) tag sets of the already counted time series, so they
+	// don't need their keys built again; reset along with the series
+	known map[*stats.SampleTags]struct{}
+}
+
+func newMetricSeries() *metricSeries {
+	return &metricSeries{
+		series:    make(map[string]map[string]string),
+		tagValues: make(map[string]map[string]struct{}),
+		known:     make(map[*stats.SampleTags]struct{}),
+	}
+}
+
+// maxCachedTagSets limits how many limited tag sets are remembered, so the
+// cache itself doesn't grow unbounded.
+const maxCachedTagSets = 1 << 14
+
+// New validates the given config and returns a Limiter for it.
+func New(conf Config, logger logrus.FieldLogger) (*Limiter, error) {
+	if errs := conf.Validate(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	l := &Limiter{
+		maxSeries:   conf.MaxSeriesPerMetric,
+		action:      conf.Action,
+		hashBuckets: uint32(conf.HashBuckets),
+		logger:      logger,
+		metrics:     make(map[string]*metricSeries),
+		limitedTags: make(map[string]bool),
+		tagCache:    make(map[*stats.SampleTags]*stats.SampleTags),
+	}
+	if l.maxSeries == 0 {
+		l.maxSeries = DefaultMaxSeriesPerMetric
+	}
+	if l.action == "" {
+		l.action = ActionDrop
+	}
+	if l.hashBuckets == 0 {
+		l.hashBuckets = DefaultHashBuckets
+	}
+	return l, nil
+}
+
+// tagsSetter is implemented by sample containers that have their own tags,
+// besides the ones of their samples, and return their internal slice from
+// GetSamples(), so they can be changed in place.
+type tagsSetter interface {
+	stats.ConnectedSampleContainer
+	SetTags(*stats.SampleTags)
+}
+
+// Samples applies the limit to the given sample containers. Where possible,
+// their tags are changed in place, otherwise the container is replaced in the
+// slice with a changed copy. With the abort action, it returns an error when
+// a metric goes over the limit, but only once.
+func (l *Limiter) Samples(containers []stats.SampleContainer) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	aborted := l.abortErr != nil
+	for i, sc := range containers {
+		switch c := sc.(type) {
+		case stats.Sample:
+			c.Tags = l.limitSample(c.Metric.Name, c.Tags)
+			containers[i] = c
+		case stats.Samples:
+			l.limitSamples(c)
+		case stats.ConnectedSamples:
+			l.limitSamples(c.Samples)
+			c.Tags = l.limitTags(c.Tags)
+			containers[i] = c
+		case tagsSetter:
+			l.limitSamples(c.GetSamples())
+			c.SetTags(l.limitTags(c.GetTags()))
+		default:
+			// We can't know if GetSamples() returns a copy, so play it safe
+			samples := append(stats.Samples(nil), sc.GetSamples()...)
+			l.limitSamples(samples)
+			containers[i] = samples
+		}
+	}
+	if aborted {
+		return nil
+	}
+	return l.abortErr
+}
+
+func (l *Limiter) limitSamples(samples []stats.Sample) {
+	for i := range samples {
+		samples[i].Tags = l.limitSample(samples[i].Metric.Name, samples[i].Tags)
+	}
+}
+
+// limitSample returns the limited tags of a sample of the given metric, after
+// it has counted its time series.
+func (l *Limiter) limitSample(metric string, tags *stats.SampleTags) *stats.SampleTags {
+	ms, ok := l.metrics[metric]
+	if !ok {
+		ms = newMetricSeries()
+		l.metrics[metric] = ms
+	}
+
+	for {
+		tags = l.limitTags(tags)
+		if _, ok := ms.known[tags]; ok {
+			return tags
+		}
+		values := tags.CloneTags()
+		key := seriesKey(values)
+		if _, ok := ms.series[key]; ok {
+			ms.remember(tags)
+			return tags
+		}
+		if l.abortErr != nil {
+			// The test is being aborted, so there is no need to count anymore
+			return tags
+		}
+		if len(ms.series) < l.maxSeries {
+			ms.add(key, values)
+			ms.remember(tags)
+			return tags
+		}
+
+		tag, count := ms.offendingTag(values, l.limitedTags)
+		if tag == "" {
+			// There is nothing left to limit, so the series has to be kept
+			ms.add(key, values)
+			ms.remember(tags)
+			return tags
+		}
+		l.limit(metric, tag, count)
+	}
+}
+
+// limit starts dropping or hashing the given tag, or records the error that
+// aborts the test.
+func (l *Limiter) limit(metric, tag string, count int) {
+	details := fmt.Sprintf("metric '%s' reached the limit of %d time series and its tag '%s' has %d distinct values",
+		metric, l.maxSeries, tag, count)
+	switch l.action {
+	case ActionAbort:
+		l.abortErr = fmt.Errorf("the %s, aborting the test; avoid tagging samples with unique values, "+
+			"e.g. by grouping the URLs with the 'name' tag", details)
+		return
+	case ActionHash:
+		l.logger.Warnf("The %s, so from now on its values are hashed into %d buckets in all metrics",
+			details, l.hashBuckets)
+	default:
+		l.logger.Warnf("The %s, so from now on it's dropped from all metrics", details)
+	}
+	l.limitedTags[tag] = true
+	l.tagCache = make(map[*stats.SampleTags]*stats.SampleTags)
+
+	// The already counted time series are merged, as if the tag was limited
+	// from the start
+	for _, ms := range l.metrics {
+		merged := newMetricSeries()
+		for _, values := range ms.series {
+			if _, ok := values[tag]; ok {
+				l.limitValue(values, tag)
+			}
+			merged.add(seriesKey(values), values)
+		}
+		*ms = *merged
+	}
+}
+
+// limitTags returns the tags with the limited ones dropped or hashed. If none
+// of them is limited, the same tag set is returned.
+func (l *Limiter) limitTags(tags *stats.SampleTags) *stats.SampleTags {
+	if len(l.limitedTags) == 0 || tags.IsEmpty() {
+		return tags
+	}
+	if limited, ok := l.tagCache[tags]; ok {
+		return limited
+	}
+
+	limited := tags
+	if values := tags.CloneTags(); l.limitValues(values) {
+		limited = stats.IntoSampleTags(&values)
+	}
+
+	if len(l.tagCache) >= maxCachedTagSets {
+		l.tagCache = make(map[*stats.SampleTags]*stats.SampleTags)
+	}
+	l.tagCache[tags] = limited
+	return limited
+}
+
+// limitValues drops or hashes the limited tags in the given map and returns
+// whether there were any.
+func (l *Limiter) limitValues(values map[string]string) bool {
+	changed := false
+	for k := range values {
+		if l.limitedTags[k] {
+			l.limitValue(values, k)
+			changed = true
+		}
+	}
+	return changed
+}
+
+func (l *Limiter) limitValue(values map[string]string, tag string) {
+	if l.action != ActionHash {
+		delete(values, tag)
+		return
+	}
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(values[tag]))
+	values[tag] = fmt.Sprintf("hash-%d", h.Sum32()%l.hashBuckets)
+}
+
+func (ms *metricSeries) add(key string, tags map[string]string) {
+	ms.series[key] = tags
+	for k, v := range tags {
+		values, ok := ms.tagValues[k]
+		if !ok {
+			values = make(map[string]struct{})
+			ms.tagValues[k] = values
+		}
+		values[v] = struct{}{}
+	}
+}
+
+// remember marks the tag set as one of an already counted time series.
+func (ms *metricSeries) remember(tags *stats.SampleTags) {
+	if len(ms.known) >= maxCachedTagSets {
+		ms.known = make(map[*stats.SampleTags]struct{})
+	}
+	ms.known[tags] = struct{}{}
+}
+
+// offendingTag returns the tag of the given ones with the most distinct values
+// so far, which isn't limited yet, and the number of its values.
+func (ms *metricSeries) offendingTag(tags map[string]string, limited map[string]bool) (tag string, count int) {
+	for k := range tags {
+		if limited[k] {
+			continue
+		}
+		n := len(ms.tagValues[k])
+		if _, seen := ms.tagValues[k][tags[k]]; !seen {
+			n++
+		}
+		if n > count || (n == count && k < tag) {
+			tag, count = k, n
+		}
+	}
+	return tag, count
+}
+
+func seriesKey(tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, k := range keys {
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+		b.WriteByte(0)
+	}
+	return b.String()
+}
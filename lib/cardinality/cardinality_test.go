@@ -0,0 +1,182 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package cardinality
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+type trail struct {
+	tags    *stats.SampleTags
+	samples []stats.Sample
+}
+
+func (tr *trail) GetSamples() []stats.Sample     { return tr.samples }
+func (tr *trail) GetTags() *stats.SampleTags     { return tr.tags }
+func (tr *trail) GetTime() time.Time             { return time.Time{} }
+func (tr *trail) SetTags(tags *stats.SampleTags) { tr.tags = tags }
+
+func newTestLimiter(t *testing.T, conf Config) (*Limiter, *test.Hook) {
+	logger, hook := test.NewNullLogger()
+	l, err := New(conf, logger)
+	require.NoError(t, err)
+	return l, hook
+}
+
+func urlSamples(metric *stats.Metric, from, to int) []stats.SampleContainer {
+	var samples []stats.SampleContainer
+	for i := from; i < to; i++ {
+		tags := map[string]string{"url": fmt.Sprintf("http://example.com/%d", i), "method": "GET"}
+		samples = append(samples, stats.Sample{Metric: metric, Value: 1, Tags: stats.IntoSampleTags(&tags)})
+	}
+	return samples
+}
+
+func TestConfigValidate(t *testing.T) {
+	t.Parallel()
+	assert.Empty(t, Config{}.Validate())
+	assert.Empty(t, Config{MaxSeriesPerMetric: 10, Action: ActionHash, HashBuckets: 5}.Validate())
+	assert.Len(t, Config{MaxSeriesPerMetric: -1, Action: "ignore", HashBuckets: -1}.Validate(), 3)
+	_, err := New(Config{Action: "ignore"}, logrus.New())
+	assert.Error(t, err)
+}
+
+func TestLimiterDrop(t *testing.T) {
+	t.Parallel()
+	l, hook := newTestLimiter(t, Config{MaxSeriesPerMetric: 3})
+	metric := stats.New("http_reqs", stats.Counter)
+
+	samples := urlSamples(metric, 0, 3)
+	require.NoError(t, l.Samples(samples))
+	for i, sc := range samples {
+		url, _ := sc.(stats.Sample).Tags.Get("url")
+		assert.Equal(t, fmt.Sprintf("http://example.com/%d", i), url)
+	}
+	assert.Empty(t, hook.Entries)
+
+	samples = urlSamples(metric, 3, 10)
+	require.NoError(t, l.Samples(samples))
+	for _, sc := range samples {
+		assert.Equal(t, map[string]string{"method": "GET"}, sc.(stats.Sample).Tags.CloneTags())
+	}
+	require.Len(t, hook.Entries, 1)
+	assert.Equal(t, logrus.WarnLevel, hook.LastEntry().Level)
+	assert.Equal(t, "The metric 'http_reqs' reached the limit of 3 time series and its tag 'url' has 4 distinct "+
+		"values, so from now on it's dropped from all metrics", hook.LastEntry().Message)
+
+	// The tag is dropped from the samples of the other metrics too, including
+	// the ones of connected sample containers
+	other := stats.New("http_req_duration", stats.Trend)
+	tags := stats.IntoSampleTags(&map[string]string{"url": "http://example.com/1", "method": "GET"})
+	tr := &trail{tags: tags, samples: []stats.Sample{{Metric: other, Tags: tags}}}
+	require.NoError(t, l.Samples([]stats.SampleContainer{tr}))
+	assert.Equal(t, map[string]string{"method": "GET"}, tr.tags.CloneTags())
+	assert.Equal(t, map[string]string{"method": "GET"}, tr.samples[0].Tags.CloneTags())
+}
+
+func TestLimiterHash(t *testing.T) {
+	t.Parallel()
+	l, hook := newTestLimiter(t, Config{MaxSeriesPerMetric: 10, Action: ActionHash, HashBuckets: 4})
+	metric := stats.New("http_reqs", stats.Counter)
+
+	samples := urlSamples(metric, 0, 100)
+	require.NoError(t, l.Samples(samples))
+	require.Len(t, hook.Entries, 1)
+	assert.Contains(t, hook.LastEntry().Message, "its values are hashed into 4 buckets")
+
+	values := map[string]bool{}
+	for _, sc := range samples[10:] {
+		url, _ := sc.(stats.Sample).Tags.Get("url")
+		values[url] = true
+	}
+	assert.True(t, len(values) <= 4, values)
+	for value := range values {
+		assert.Regexp(t, `^hash-[0-3]$`, value)
+	}
+	assert.Len(t, l.metrics["http_reqs"].series, len(values))
+}
+
+func TestLimiterAbort(t *testing.T) {
+	t.Parallel()
+	l, _ := newTestLimiter(t, Config{MaxSeriesPerMetric: 5, Action: ActionAbort})
+	metric := stats.New("http_reqs", stats.Counter)
+
+	require.NoError(t, l.Samples(urlSamples(metric, 0, 5)))
+	samples := urlSamples(metric, 5, 7)
+	err := l.Samples(samples)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the metric 'http_reqs' reached the limit of 5 time series and its tag 'url' "+
+		"has 6 distinct values, aborting the test")
+	// The samples aren't changed and the error is returned only once
+	url, _ := samples[1].(stats.Sample).Tags.Get("url")
+	assert.Equal(t, "http://example.com/6", url)
+	assert.NoError(t, l.Samples(urlSamples(metric, 7, 8)))
+}
+
+func TestLimiterNothingToLimit(t *testing.T) {
+	t.Parallel()
+	l, hook := newTestLimiter(t, Config{MaxSeriesPerMetric: 1, Action: ActionHash, HashBuckets: 4})
+	metric := stats.New("vus", stats.Gauge)
+	var samples []stats.SampleContainer
+	for i := 0; i < 20; i++ {
+		tags := map[string]string{"a": fmt.Sprint(i)}
+		samples = append(samples, stats.Sample{Metric: metric, Value: 1, Tags: stats.IntoSampleTags(&tags)})
+	}
+	require.NoError(t, l.Samples(samples))
+	// Even the hashed values go over the limit, but there is nothing else to
+	// limit, so the time series are kept
+	assert.Len(t, hook.Entries, 1)
+	assert.Len(t, l.metrics["vus"].series, 4)
+}
+
+func TestLimiterRemembersTagSets(t *testing.T) {
+	t.Parallel()
+	l, _ := newTestLimiter(t, Config{MaxSeriesPerMetric: 2})
+	metric := stats.New("http_reqs", stats.Counter)
+
+	tags := stats.IntoSampleTags(&map[string]string{"url": "http://example.com/0", "method": "GET"})
+	samples := []stats.SampleContainer{
+		stats.Sample{Metric: metric, Tags: tags}, stats.Sample{Metric: metric, Tags: tags},
+	}
+	require.NoError(t, l.Samples(samples))
+	ms := l.metrics["http_reqs"]
+	assert.Len(t, ms.series, 1)
+	assert.Equal(t, map[*stats.SampleTags]struct{}{tags: {}}, ms.known)
+
+	// The remembered tag sets are forgotten once a tag is limited, since the
+	// time series are merged
+	require.NoError(t, l.Samples(urlSamples(metric, 1, 3)))
+	ms = l.metrics["http_reqs"]
+	assert.Len(t, ms.series, 1)
+	assert.NotContains(t, ms.known, tags)
+	samples = []stats.SampleContainer{stats.Sample{Metric: metric, Tags: tags}}
+	require.NoError(t, l.Samples(samples))
+	assert.Equal(t, map[string]string{"method": "GET"}, samples[0].(stats.Sample).Tags.CloneTags())
+}
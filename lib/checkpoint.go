@@ -0,0 +1,358 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/afero"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+// Checkpoint is a snapshot of the progress of a test run, periodically saved
+// to disk so that a crashed or intentionally restarted test run can be resumed
+// from where it stopped, instead of starting over.
+type Checkpoint struct {
+	// The duration of the test run, excluding any pauses, when the checkpoint
+	// was taken. It includes the durations of any earlier resumed test runs.
+	Elapsed types.Duration `json:"elapsed"`
+
+	FullIterations        uint64 `json:"fullIterations"`
+	InterruptedIterations uint64 `json:"interruptedIterations"`
+
+	// The number of full iterations that each scenario has completed.
+	Scenarios map[string]uint64 `json:"scenarios"`
+
+	// The cumulative values of all metrics and submetrics, by their name.
+	Metrics map[string]MetricCheckpoint `json:"metrics"`
+
+	// The data returned by setup(), so it doesn't have to run again.
+	SetupData json.RawMessage `json:"setupData,omitempty"`
+
+	// The execution segment of the test run, so that a resumed instance of a
+	// test split between several ones continues with the same part of it.
+	ExecutionSegment         *ExecutionSegment         `json:"executionSegment,omitempty"`
+	ExecutionSegmentSequence *ExecutionSegmentSequence `json:"executionSegmentSequence,omitempty"`
+}
+
+// MetricCheckpoint contains the type and the serialized sink of a metric.
+type MetricCheckpoint struct {
+	Type     stats.MetricType `json:"type"`
+	Contains stats.ValueType  `json:"contains"`
+	Sink     json.RawMessage  `json:"sink"`
+
+	Unit        string `json:"unit,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// The values of a trend metric, which are kept out of the serialized sink
+	// and saved in a separate values file. When saving, they are only the
+	// values added since the previous checkpoint saved by the same writer,
+	// which are appended to that file. When loading, they are all of them.
+	Values []float64 `json:"-"`
+}
+
+// valuesFilename returns the name of the file with the trend values of the
+// given checkpoint file.
+func valuesFilename(filename string) string {
+	return filename + ".values"
+}
+
+// LoadCheckpoint reads a checkpoint saved by SaveCheckpoint or by a
+// CheckpointWriter, together with the values of its trend metrics.
+func LoadCheckpoint(fs afero.Fs, filename string) (*Checkpoint, error) {
+	data, err := afero.ReadFile(fs, filename)
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint Checkpoint
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, fmt.Errorf("couldn't parse the checkpoint '%s': %w", filename, err)
+	}
+	if err := loadCheckpointValues(fs, valuesFilename(filename), &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// loadCheckpointValues reads the values file of a checkpoint and sets the
+// values of its trend metrics. The file may have more values than the
+// checkpoint, if it was appended to and the checkpoint itself wasn't saved
+// afterwards, so only as many values as the trend sinks counted are used.
+func loadCheckpointValues(fs afero.Fs, filename string, checkpoint *Checkpoint) error {
+	values := make(map[string][]float64)
+	f, err := fs.Open(filename)
+	switch {
+	case err == nil:
+		err = readCheckpointValues(bufio.NewReader(f), values)
+		_ = f.Close()
+		if err != nil {
+			return fmt.Errorf("couldn't read the checkpoint values '%s': %w", filename, err)
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	for name, mc := range checkpoint.Metrics {
+		if mc.Type != stats.Trend {
+			continue
+		}
+		var sink struct {
+			Count  uint64
+			Values []float64
+		}
+		if err := json.Unmarshal(mc.Sink, &sink); err != nil {
+			return fmt.Errorf("couldn't parse the checkpoint of metric '%s': %w", name, err)
+		}
+		if sink.Values != nil {
+			// Saved before the values were moved out of the sinks
+			continue
+		}
+		if uint64(len(values[name])) < sink.Count {
+			return fmt.Errorf(
+				"the checkpoint values '%s' have only %d of the %d values of metric '%s'",
+				filename, len(values[name]), sink.Count, name,
+			)
+		}
+		mc.Values = values[name][:sink.Count]
+		checkpoint.Metrics[name] = mc
+	}
+	return nil
+}
+
+// readCheckpointValues reads the records of a values file into the given map.
+// Each one has the length of the metric name, the name, the number of values
+// and the values. An incomplete last record, from a write that didn't finish,
+// is ignored.
+func readCheckpointValues(r io.Reader, values map[string][]float64) error {
+	var header [4]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return ignoreTruncated(err)
+		}
+		name := make([]byte, binary.LittleEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(r, name); err != nil {
+			return ignoreTruncated(err)
+		}
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return ignoreTruncated(err)
+		}
+		record := make([]byte, 8*int(binary.LittleEndian.Uint32(header[:])))
+		if _, err := io.ReadFull(r, record); err != nil {
+			return ignoreTruncated(err)
+		}
+		for i := 0; i < len(record); i += 8 {
+			values[string(name)] = append(values[string(name)],
+				math.Float64frombits(binary.LittleEndian.Uint64(record[i:])))
+		}
+	}
+}
+
+func ignoreTruncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return nil
+	}
+	return err
+}
+
+// CheckpointWriter periodically saves the checkpoints of a test run. The values
+// of trend metrics are written to a separate values file, next to the
+// checkpoint file, which is replaced by the first checkpoint and appended to by
+// the later ones, so that only the values added since the previous checkpoint
+// have to be written each time.
+type CheckpointWriter struct {
+	fs       afero.Fs
+	filename string
+
+	// The size of the values file after the last successful write, or -1 if
+	// it wasn't written yet
+	size int64
+	// The records that couldn't be written to the values file yet
+	pending []byte
+}
+
+// NewCheckpointWriter returns a writer of the checkpoints to the given file.
+func NewCheckpointWriter(fs afero.Fs, filename string) *CheckpointWriter {
+	return &CheckpointWriter{fs: fs, filename: filename, size: -1}
+}
+
+// Save writes the checkpoint to the checkpoint file. The trend values are
+// written first, so the checkpoint file never refers to values that aren't
+// in the values file.
+func (w *CheckpointWriter) Save(checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	if err := w.saveValues(checkpoint); err != nil {
+		return err
+	}
+	return writeFileAtomically(w.fs, w.filename, data)
+}
+
+func (w *CheckpointWriter) saveValues(checkpoint *Checkpoint) error {
+	names := make([]string, 0, len(checkpoint.Metrics))
+	for name, mc := range checkpoint.Metrics {
+		if len(mc.Values) > 0 {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	buf := bytes.NewBuffer(w.pending)
+	for _, name := range names {
+		values := checkpoint.Metrics[name].Values
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(name)))
+		buf.WriteString(name)
+		_ = binary.Write(buf, binary.LittleEndian, uint32(len(values)))
+		_ = binary.Write(buf, binary.LittleEndian, values)
+	}
+	// The values are kept until they are written, since they were already
+	// taken from the sinks
+	w.pending = buf.Bytes()
+
+	filename := valuesFilename(w.filename)
+	var err error
+	switch {
+	case w.size < 0 && len(w.pending) == 0:
+		// Don't leave behind the values of an earlier test run
+		if err = w.fs.Remove(filename); os.IsNotExist(err) {
+			err = nil
+		}
+	case w.size < 0:
+		err = writeFileAtomically(w.fs, filename, w.pending)
+	case len(w.pending) > 0:
+		err = w.appendValues(filename)
+	}
+	if err != nil {
+		return err
+	}
+	if w.size < 0 {
+		w.size = 0
+	}
+	w.size += int64(len(w.pending))
+	w.pending = nil
+	return nil
+}
+
+// appendValues writes the pending records after the ones that were written
+// successfully, dropping whatever a failed earlier write left behind.
+func (w *CheckpointWriter) appendValues(filename string) error {
+	f, err := w.fs.OpenFile(filename, os.O_WRONLY|os.O_CREATE, 0o644)
+	if err != nil {
+		return err
+	}
+	if err = f.Truncate(w.size); err == nil {
+		if _, err = f.WriteAt(w.pending, w.size); err == nil {
+			err = f.Sync()
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// SaveCheckpoint writes the checkpoint, with all of its trend values, to the
+// given file.
+func SaveCheckpoint(fs afero.Fs, filename string, checkpoint *Checkpoint) error {
+	return NewCheckpointWriter(fs, filename).Save(checkpoint)
+}
+
+// writeFileAtomically writes the data to a temporary file first and then
+// renames it, so a crash in the middle of writing it doesn't leave behind a
+// corrupted file.
+func writeFileAtomically(fs afero.Fs, filename string, data []byte) error {
+	tmp, err := afero.TempFile(fs, filepath.Dir(filename), filepath.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = fs.Rename(tmp.Name(), filename)
+	}
+	if err != nil {
+		_ = fs.Remove(tmp.Name())
+	}
+	return err
+}
+
+// ResumeExecutionSegment returns the options with the execution segment and
+// sequence of the checkpoint, unless they are already set. It returns an error
+// if they are set to different ones, since the resumed test run would then do
+// a different part of the work than the one that was interrupted.
+func (c *Checkpoint) ResumeExecutionSegment(opts Options) (Options, error) {
+	if opts.ExecutionSegment == nil {
+		opts.ExecutionSegment = c.ExecutionSegment
+	} else if !opts.ExecutionSegment.Equal(c.ExecutionSegment) {
+		return opts, fmt.Errorf(
+			"the checkpoint was taken with the execution segment '%s', but '%s' was specified",
+			c.ExecutionSegment, opts.ExecutionSegment,
+		)
+	}
+
+	if opts.ExecutionSegmentSequence == nil {
+		opts.ExecutionSegmentSequence = c.ExecutionSegmentSequence
+	} else if c.ExecutionSegmentSequence == nil ||
+		opts.ExecutionSegmentSequence.String() != c.ExecutionSegmentSequence.String() {
+		return opts, fmt.Errorf(
+			"the checkpoint was taken with a different execution segment sequence than '%s'",
+			opts.ExecutionSegmentSequence,
+		)
+	}
+	return opts, nil
+}
+
+// ResumeScenarios returns the configs for the work that the scenarios had left
+// when the checkpoint was taken. Scenarios that were already over are left out.
+func (c *Checkpoint) ResumeScenarios(scenarios ScenarioConfigs) (ScenarioConfigs, error) {
+	elapsed := time.Duration(c.Elapsed)
+	resumed := make(ScenarioConfigs, len(scenarios))
+	for name, conf := range scenarios {
+		resumable, ok := conf.(ResumableExecutorConfig)
+		if !ok {
+			return nil, fmt.Errorf("the %s executor of scenario '%s' can't be resumed", conf.GetType(), name)
+		}
+		if left := resumable.GetResumedConfig(elapsed, c.Scenarios[name]); left != nil {
+			resumed[name] = left
+		}
+	}
+	if len(resumed) == 0 {
+		return nil, fmt.Errorf("all scenarios had already finished when the checkpoint was taken")
+	}
+	return resumed, nil
+}
@@ -0,0 +1,151 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+func TestCheckpointSaveLoad(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	checkpoint := &Checkpoint{
+		Elapsed:        types.Duration(90 * time.Second),
+		FullIterations: 10,
+		Scenarios:      map[string]uint64{"default": 10},
+		Metrics: map[string]MetricCheckpoint{
+			"iterations": {Type: stats.Counter, Contains: stats.Default, Sink: json.RawMessage(`{"Value":10}`)},
+		},
+		SetupData: json.RawMessage(`{"token":"abc"}`),
+	}
+	require.NoError(t, SaveCheckpoint(fs, "/checkpoint.json", checkpoint))
+	require.NoError(t, SaveCheckpoint(fs, "/checkpoint.json", checkpoint))
+
+	loaded, err := LoadCheckpoint(fs, "/checkpoint.json")
+	require.NoError(t, err)
+	assert.Equal(t, checkpoint, loaded)
+
+	files, err := afero.ReadDir(fs, "/")
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	require.NoError(t, afero.WriteFile(fs, "/broken.json", []byte("{"), 0o644))
+	_, err = LoadCheckpoint(fs, "/broken.json")
+	assert.Error(t, err)
+}
+
+func TestCheckpointWriterValues(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	// Stale values of an earlier test run are replaced
+	require.NoError(t, afero.WriteFile(fs, "/checkpoint.json.values", []byte("stale"), 0o644))
+
+	trend := func(count int, values ...float64) MetricCheckpoint {
+		return MetricCheckpoint{
+			Type: stats.Trend, Contains: stats.Time, Values: values,
+			Sink: json.RawMessage(fmt.Sprintf(`{"Values":null,"Count":%d}`, count)),
+		}
+	}
+	w := NewCheckpointWriter(fs, "/checkpoint.json")
+	require.NoError(t, w.Save(&Checkpoint{Metrics: map[string]MetricCheckpoint{
+		"a": trend(2, 1, 2), "b": trend(1, 3),
+	}}))
+	require.NoError(t, w.Save(&Checkpoint{Metrics: map[string]MetricCheckpoint{
+		"a": trend(3, 4), "b": trend(1),
+	}}))
+	// Values appended without a new checkpoint are ignored
+	require.NoError(t, w.saveValues(&Checkpoint{Metrics: map[string]MetricCheckpoint{"b": trend(2, 5)}}))
+
+	loaded, err := LoadCheckpoint(fs, "/checkpoint.json")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 2, 4}, loaded.Metrics["a"].Values)
+	assert.Equal(t, []float64{3}, loaded.Metrics["b"].Values)
+
+	// An incomplete record at the end is ignored too
+	f, err := fs.OpenFile("/checkpoint.json.values", os.O_WRONLY|os.O_APPEND, 0o644)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{1, 0, 0, 0, 'a', 9})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+	loaded, err = LoadCheckpoint(fs, "/checkpoint.json")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 2, 4}, loaded.Metrics["a"].Values)
+
+	require.NoError(t, fs.Remove("/checkpoint.json.values"))
+	_, err = LoadCheckpoint(fs, "/checkpoint.json")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "the checkpoint values '/checkpoint.json.values' have only 0 of the")
+}
+
+func TestCheckpointResumeScenariosFinished(t *testing.T) {
+	t.Parallel()
+	_, err := (&Checkpoint{}).ResumeScenarios(ScenarioConfigs{})
+	assert.EqualError(t, err, "all scenarios had already finished when the checkpoint was taken")
+}
+
+func TestCheckpointResumeExecutionSegment(t *testing.T) {
+	t.Parallel()
+	segment, err := NewExecutionSegmentFromString("1/3:2/3")
+	require.NoError(t, err)
+	sequence, err := NewExecutionSegmentSequenceFromString("0,1/3,2/3,1")
+	require.NoError(t, err)
+	checkpoint := &Checkpoint{ExecutionSegment: segment, ExecutionSegmentSequence: &sequence}
+
+	data, err := json.Marshal(checkpoint)
+	require.NoError(t, err)
+	var loaded Checkpoint
+	require.NoError(t, json.Unmarshal(data, &loaded))
+
+	opts, err := loaded.ResumeExecutionSegment(Options{})
+	require.NoError(t, err)
+	assert.True(t, segment.Equal(opts.ExecutionSegment))
+	assert.Equal(t, sequence.String(), opts.ExecutionSegmentSequence.String())
+
+	opts, err = loaded.ResumeExecutionSegment(opts)
+	require.NoError(t, err)
+	assert.True(t, segment.Equal(opts.ExecutionSegment))
+
+	otherSegment, err := NewExecutionSegmentFromString("0:1/3")
+	require.NoError(t, err)
+	_, err = loaded.ResumeExecutionSegment(Options{ExecutionSegment: otherSegment})
+	assert.EqualError(t, err, "the checkpoint was taken with the execution segment '1/3:2/3', but '0:1/3' was specified")
+
+	otherSequence, err := NewExecutionSegmentSequenceFromString("0,1/3,1")
+	require.NoError(t, err)
+	_, err = loaded.ResumeExecutionSegment(Options{ExecutionSegmentSequence: &otherSequence})
+	assert.Error(t, err)
+
+	opts, err = (&Checkpoint{}).ResumeExecutionSegment(Options{})
+	require.NoError(t, err)
+	assert.Nil(t, opts.ExecutionSegment)
+	assert.Nil(t, opts.ExecutionSegmentSequence)
+}
@@ -0,0 +1,161 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package envfile parses files with environment variables for the --env-file
+// option, which can optionally be encrypted with AES-256-GCM.
+package envfile
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// KeySize is the size of the keys used for encrypting env files.
+const KeySize = 32
+
+// encryptedPrefix is at the start of every encrypted env file, followed by the
+// base64-encoded nonce and ciphertext.
+const encryptedPrefix = "$K6ENV$v1$"
+
+var varName = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// Parse parses the contents of an env file, with one `NAME=value` per line.
+// Empty lines and lines starting with # are ignored, a leading `export ` is
+// allowed, and values may be wrapped in single or double quotes. Only double
+// quoted values are unescaped.
+func Parse(data []byte) (map[string]string, error) {
+	env := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+
+		idx := strings.IndexRune(line, '=')
+		if idx == -1 {
+			return nil, fmt.Errorf("line %d: expected NAME=value", lineNum)
+		}
+		name, value := strings.TrimSpace(line[:idx]), strings.TrimSpace(line[idx+1:])
+		if !varName.MatchString(name) {
+			return nil, fmt.Errorf("line %d: invalid environment variable name '%s'", lineNum, name)
+		}
+
+		switch {
+		case len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"':
+			unquoted, err := strconv.Unquote(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid quoted value for '%s': %w", lineNum, name, err)
+			}
+			value = unquoted
+		case len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'':
+			value = value[1 : len(value)-1]
+		default:
+			// Strip trailing comments from unquoted values
+			if cidx := strings.Index(value, " #"); cidx != -1 {
+				value = strings.TrimSpace(value[:cidx])
+			}
+		}
+		env[name] = value
+	}
+	return env, scanner.Err()
+}
+
+// IsEncrypted returns whether the data is an encrypted env file.
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(encryptedPrefix))
+}
+
+// GenerateKey returns a new random key, encoded as base64.
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := io.ReadFull(rand.Reader, key); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a base64-encoded key.
+func ParseKey(s string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return nil, fmt.Errorf("the env file key isn't valid base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("the env file key should be %d bytes long, but is %d", KeySize, len(key))
+	}
+	return key, nil
+}
+
+// Encrypt encrypts the contents of an env file with the given key.
+func Encrypt(plaintext, key []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(nonce, nonce, plaintext, []byte(encryptedPrefix))
+	return []byte(encryptedPrefix + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// Decrypt decrypts an env file encrypted with Encrypt().
+func Decrypt(data, key []byte) ([]byte, error) {
+	if !IsEncrypted(data) {
+		return nil, errors.New("the env file isn't encrypted")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(data[len(encryptedPrefix):])))
+	if err != nil {
+		return nil, fmt.Errorf("the encrypted env file is corrupted: %w", err)
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < gcm.NonceSize() {
+		return nil, errors.New("the encrypted env file is corrupted")
+	}
+	plaintext, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(encryptedPrefix))
+	if err != nil {
+		return nil, errors.New("couldn't decrypt the env file, the key is wrong or the file was modified")
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
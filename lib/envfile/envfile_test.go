@@ -0,0 +1,100 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package envfile
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	env, err := Parse([]byte(`
+# a comment
+PLAIN=value
+export EXPORTED=1
+SPACED = some value # trailing comment
+DOUBLE="quoted # not a comment\n"
+SINGLE='raw\n'
+EMPTY=
+`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"PLAIN":    "value",
+		"EXPORTED": "1",
+		"SPACED":   "some value",
+		"DOUBLE":   "quoted # not a comment\n",
+		"SINGLE":   `raw\n`,
+		"EMPTY":    "",
+	}, env)
+
+	for data, expErr := range map[string]string{
+		"NOVALUE":       "line 1: expected NAME=value",
+		"\n1BAD=x":      "line 2: invalid environment variable name '1BAD'",
+		`Q="unclosed\"`: "line 1: invalid quoted value for 'Q'",
+	} {
+		_, err := Parse([]byte(data))
+		require.Error(t, err, data)
+		assert.Contains(t, err.Error(), expErr)
+	}
+}
+
+func TestEncryption(t *testing.T) {
+	t.Parallel()
+	encodedKey, err := GenerateKey()
+	require.NoError(t, err)
+	key, err := ParseKey(encodedKey)
+	require.NoError(t, err)
+
+	plaintext := []byte("TOKEN=abc\n")
+	encrypted, err := Encrypt(plaintext, key)
+	require.NoError(t, err)
+	assert.True(t, IsEncrypted(encrypted))
+	assert.False(t, IsEncrypted(plaintext))
+	assert.False(t, bytes.Contains(encrypted, []byte("abc")))
+
+	decrypted, err := Decrypt(encrypted, key)
+	require.NoError(t, err)
+	assert.Equal(t, plaintext, decrypted)
+
+	otherKey, err := GenerateKey()
+	require.NoError(t, err)
+	key2, err := ParseKey(otherKey)
+	require.NoError(t, err)
+	_, err = Decrypt(encrypted, key2)
+	assert.EqualError(t, err, "couldn't decrypt the env file, the key is wrong or the file was modified")
+
+	tampered := append([]byte{}, encrypted...)
+	tampered[len(encryptedPrefix)+20] ^= 1
+	_, err = Decrypt(tampered, key)
+	assert.Error(t, err)
+
+	_, err = Decrypt(plaintext, key)
+	assert.EqualError(t, err, "the env file isn't encrypted")
+
+	_, err = ParseKey("c2hvcnQ=")
+	assert.EqualError(t, err, "the env file key should be 32 bytes long, but is 5")
+	_, err = ParseKey("not base64!")
+	assert.Error(t, err)
+}
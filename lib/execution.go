@@ -222,6 +222,22 @@ type ExecutionState struct {
 	// API, etc.
 	interruptedIterationsCount *uint64
 
+	// The number of full iterations completed by each scenario, for the
+	// checkpoints of the test run. The map itself is never modified after the
+	// ExecutionState is created, only the counters in it.
+	scenarioIterationsCount map[string]*uint64
+
+	// Nanosecond UNIX timestamps of when each scenario actually started
+	// running its iterations, or 0 if it hasn't started yet. Like the map
+	// above, it's never modified after the ExecutionState is created.
+	scenarioStartTimes map[string]*int64
+
+	// Functions that are called with the metric samples processed by the
+	// engine, so executors can adjust the load they generate to the results.
+	sampleObservers     map[uint64]func([]stats.SampleContainer)
+	sampleObserverID    uint64
+	sampleObserversLock sync.RWMutex
+
 	// A machine-readable indicator in which the current state of the test
 	// execution is currently stored. Useful for the REST API and external
 	// observability of the k6 test run progress.
@@ -277,6 +293,13 @@ func NewExecutionState(options Options, et *ExecutionTuple, maxPlannedVUs, maxPo
 
 	maxUnplannedUninitializedVUs := int64(maxPossibleVUs - maxPlannedVUs)
 
+	scenarioIterationsCount := make(map[string]*uint64, len(options.Scenarios))
+	scenarioStartTimes := make(map[string]*int64, len(options.Scenarios))
+	for name := range options.Scenarios {
+		scenarioIterationsCount[name] = new(uint64)
+		scenarioStartTimes[name] = new(int64)
+	}
+
 	return &ExecutionState{
 		Options: options,
 		vus:     make(chan InitializedVU, maxPossibleVUs),
@@ -288,6 +311,9 @@ func NewExecutionState(options Options, et *ExecutionTuple, maxPlannedVUs, maxPo
 		activeVUs:                  new(int64),
 		fullIterationsCount:        new(uint64),
 		interruptedIterationsCount: new(uint64),
+		scenarioIterationsCount:    scenarioIterationsCount,
+		scenarioStartTimes:         scenarioStartTimes,
+		sampleObservers:            make(map[uint64]func([]stats.SampleContainer)),
 		startTime:                  new(int64),
 		endTime:                    new(int64),
 		currentPauseTime:           new(int64),
@@ -370,6 +396,83 @@ func (es *ExecutionState) AddInterruptedIterations(count uint64) uint64 {
 	return atomic.AddUint64(es.interruptedIterationsCount, count)
 }
 
+// GetScenarioFullIterationCount returns the number of full iterations that
+// the given scenario has completed so far.
+//
+// IMPORTANT: for UI/information purposes only, don't use for synchronization.
+func (es *ExecutionState) GetScenarioFullIterationCount(scenario string) uint64 {
+	count, ok := es.scenarioIterationsCount[scenario]
+	if !ok {
+		return 0
+	}
+	return atomic.LoadUint64(count)
+}
+
+// AddScenarioFullIterations increments the number of full iterations of the
+// given scenario by the provided amount. Unknown scenarios are ignored.
+func (es *ExecutionState) AddScenarioFullIterations(scenario string, count uint64) {
+	if c, ok := es.scenarioIterationsCount[scenario]; ok {
+		atomic.AddUint64(c, count)
+	}
+}
+
+// MarkScenarioStarted saves the current timestamp as the time when the given
+// scenario started running its iterations. Unknown scenarios are ignored.
+func (es *ExecutionState) MarkScenarioStarted(scenario string) {
+	if t, ok := es.scenarioStartTimes[scenario]; ok {
+		atomic.StoreInt64(t, time.Now().UnixNano())
+	}
+}
+
+// GetScenarioStartTime returns the time when the given scenario started
+// running its iterations, or the zero time if it hasn't started yet.
+func (es *ExecutionState) GetScenarioStartTime(scenario string) time.Time {
+	t, ok := es.scenarioStartTimes[scenario]
+	if !ok {
+		return time.Time{}
+	}
+	if startTime := atomic.LoadInt64(t); startTime != 0 {
+		return time.Unix(0, startTime)
+	}
+	return time.Time{}
+}
+
+// GetStartTime returns the time when the test run actually started, or the
+// zero time if it hasn't started yet.
+func (es *ExecutionState) GetStartTime() time.Time {
+	if startTime := atomic.LoadInt64(es.startTime); startTime != 0 {
+		return time.Unix(0, startTime)
+	}
+	return time.Time{}
+}
+
+// AddSampleObserver registers a function that is called with every batch of
+// metric samples that the engine processes, and returns a function that
+// removes it. Observers are called synchronously, so they should be quick and
+// they must not modify or keep the sample containers.
+func (es *ExecutionState) AddSampleObserver(observer func([]stats.SampleContainer)) (remove func()) {
+	es.sampleObserversLock.Lock()
+	defer es.sampleObserversLock.Unlock()
+	es.sampleObserverID++
+	id := es.sampleObserverID
+	es.sampleObservers[id] = observer
+	return func() {
+		es.sampleObserversLock.Lock()
+		defer es.sampleObserversLock.Unlock()
+		delete(es.sampleObservers, id)
+	}
+}
+
+// ObserveSamples passes the given batch of metric samples to all of the
+// registered sample observers.
+func (es *ExecutionState) ObserveSamples(sampleContainers []stats.SampleContainer) {
+	es.sampleObserversLock.RLock()
+	defer es.sampleObserversLock.RUnlock()
+	for _, observer := range es.sampleObservers {
+		observer(sampleContainers)
+	}
+}
+
 // SetExecutionStatus changes the current execution status to the supplied value
 // and returns the current value.
 func (es *ExecutionState) SetExecutionStatus(newStatus ExecutionStatus) (oldStatus ExecutionStatus) {
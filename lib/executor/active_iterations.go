@@ -0,0 +1,125 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+)
+
+// How often the iterations that are still running during the graceful stop of
+// an executor are reported.
+const drainReportInterval = 5 * time.Second
+
+// How many of the requests that the draining iterations are blocked on are
+// logged, starting with the most common ones.
+const maxReportedBlockingRequests = 5
+
+// activeIterations keeps track of the iterations that an executor is currently
+// running, so the ones that are still draining after the end of its regular
+// duration can be reported.
+type activeIterations struct {
+	mu     sync.Mutex
+	nextID uint64
+	vus    map[uint64]lib.ActiveVU
+}
+
+func newActiveIterations() *activeIterations {
+	return &activeIterations{vus: make(map[uint64]lib.ActiveVU)}
+}
+
+// start registers an iteration of the given VU and returns the function that
+// should be called when it's finished.
+func (ai *activeIterations) start(vu lib.ActiveVU) (done func()) {
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+	id := ai.nextID
+	ai.nextID++
+	ai.vus[id] = vu
+	return func() {
+		ai.mu.Lock()
+		delete(ai.vus, id)
+		ai.mu.Unlock()
+	}
+}
+
+// count returns the number of currently running iterations.
+func (ai *activeIterations) count() int {
+	ai.mu.Lock()
+	defer ai.mu.Unlock()
+	return len(ai.vus)
+}
+
+// blockedOn returns how many of the currently running iterations are waiting
+// for each request, for the VUs that keep track of their requests.
+func (ai *activeIterations) blockedOn() map[string]int {
+	ai.mu.Lock()
+	vus := make([]lib.ActiveVU, 0, len(ai.vus))
+	for _, vu := range ai.vus {
+		vus = append(vus, vu)
+	}
+	ai.mu.Unlock()
+
+	requests := make(map[string]int)
+	for _, vu := range vus {
+		if rvu, ok := vu.(lib.InFlightRequestsVU); ok {
+			for _, request := range rvu.GetInFlightRequests() {
+				requests[request]++
+			}
+		}
+	}
+	return requests
+}
+
+// formatBlockingRequests returns a human-readable list of the most common
+// requests that iterations are blocked on, like `3x GET https://test.k6.io/`.
+func formatBlockingRequests(requests map[string]int) string {
+	list := make([]string, 0, len(requests))
+	for request := range requests {
+		list = append(list, request)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if requests[list[i]] != requests[list[j]] {
+			return requests[list[i]] > requests[list[j]]
+		}
+		return list[i] < list[j]
+	})
+
+	more := 0
+	if len(list) > maxReportedBlockingRequests {
+		for _, request := range list[maxReportedBlockingRequests:] {
+			more += requests[request]
+		}
+		list = list[:maxReportedBlockingRequests]
+	}
+	for i, request := range list {
+		list[i] = fmt.Sprintf("%dx %s", requests[request], request)
+	}
+	if more > 0 {
+		list = append(list, fmt.Sprintf("%d more", more))
+	}
+	return strings.Join(list, ", ")
+}
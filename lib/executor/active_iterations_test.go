@@ -0,0 +1,106 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+type inFlightRequestsVU struct {
+	lib.ActiveVU
+	requests []string
+}
+
+func (vu inFlightRequestsVU) GetInFlightRequests() []string {
+	return vu.requests
+}
+
+func TestActiveIterations(t *testing.T) {
+	t.Parallel()
+	ai := newActiveIterations()
+	assert.Equal(t, 0, ai.count())
+	assert.Empty(t, ai.blockedOn())
+
+	done1 := ai.start(inFlightRequestsVU{requests: []string{"GET https://test.k6.io/"}})
+	done2 := ai.start(inFlightRequestsVU{requests: []string{"GET https://test.k6.io/", "POST https://test.k6.io/login"}})
+	done3 := ai.start(inFlightRequestsVU{})
+	assert.Equal(t, 3, ai.count())
+	assert.Equal(t, map[string]int{
+		"GET https://test.k6.io/":       2,
+		"POST https://test.k6.io/login": 1,
+	}, ai.blockedOn())
+
+	done2()
+	done3()
+	assert.Equal(t, 1, ai.count())
+	assert.Equal(t, map[string]int{"GET https://test.k6.io/": 1}, ai.blockedOn())
+	done1()
+	assert.Equal(t, 0, ai.count())
+}
+
+func TestFormatBlockingRequests(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "", formatBlockingRequests(map[string]int{}))
+	assert.Equal(t, "3x GET https://test.k6.io/, 1x GET https://test.k6.io/a, 1x GET https://test.k6.io/b",
+		formatBlockingRequests(map[string]int{
+			"GET https://test.k6.io/b": 1,
+			"GET https://test.k6.io/":  3,
+			"GET https://test.k6.io/a": 1,
+		}))
+	assert.Equal(t, "2x GET /1, 2x GET /2, 2x GET /3, 2x GET /4, 2x GET /5, 3 more",
+		formatBlockingRequests(map[string]int{
+			"GET /1": 2, "GET /2": 2, "GET /3": 2, "GET /4": 2, "GET /5": 2, "GET /6": 1, "GET /7": 2,
+		}))
+}
+
+func TestEmitIterationsInterrupted(t *testing.T) {
+	t.Parallel()
+	et, err := lib.NewExecutionTuple(nil, nil)
+	require.NoError(t, err)
+	es := lib.NewExecutionState(lib.Options{}, et, 2, 2)
+	ctx, cancel, executor, _ := setupExecutor(
+		t, ConstantVUsConfig{
+			BaseConfig: BaseConfig{GracefulStop: types.NullDurationFrom(0)},
+			VUs:        null.IntFrom(2),
+			Duration:   types.NullDurationFrom(100 * time.Millisecond),
+		}, es,
+		simpleRunner(func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		}),
+	)
+	defer cancel()
+	engineOut := make(chan stats.SampleContainer, 1000)
+	err = executor.Run(ctx, engineOut)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), es.GetPartialIterationCount())
+	assert.Equal(t, 2.0, sumMetricValues(engineOut, "iterations_interrupted"))
+}
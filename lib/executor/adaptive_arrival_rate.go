@@ -0,0 +1,473 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/loadimpact/k6/ui/pb"
+)
+
+const adaptiveArrivalRateType = "adaptive-arrival-rate"
+
+// The limits of how much the rate can change with a single adjustment, so a
+// noisy interval doesn't make the controller overshoot.
+const (
+	adaptiveMinRateFactor = 0.5
+	adaptiveMaxRateFactor = 1.2
+)
+
+func init() {
+	lib.RegisterExecutorConfigType(
+		adaptiveArrivalRateType,
+		func(name string, rawJSON []byte) (lib.ExecutorConfig, error) {
+			config := NewAdaptiveArrivalRateConfig(name)
+			err := lib.StrictJSONUnmarshal(rawJSON, &config)
+			return config, err
+		},
+	)
+}
+
+// AdaptiveArrivalRateConfig stores config for the adaptive arrival-rate executor
+type AdaptiveArrivalRateConfig struct {
+	BaseConfig
+	StartRate null.Int           `json:"startRate"`
+	MinRate   null.Int           `json:"minRate"`
+	MaxRate   null.Int           `json:"maxRate"`
+	TimeUnit  types.NullDuration `json:"timeUnit"`
+	Duration  types.NullDuration `json:"duration"`
+
+	// The targets the rate is adjusted to: a percentile of the http_req_duration
+	// values and the rate of http_req_failed of the scenario. At least one of
+	// them should be set, and all of the set ones have to be met.
+	TargetLatency     types.NullDuration `json:"targetLatency"`
+	LatencyPercentile null.Float         `json:"latencyPercentile"`
+	TargetErrorRate   null.Float         `json:"targetErrorRate"`
+
+	// How often the rate is adjusted, based on the results since the previous
+	// adjustment
+	AdjustmentInterval types.NullDuration `json:"adjustmentInterval"`
+
+	// Initialize `PreAllocatedVUs` number of VUs, and if more than that are needed,
+	// they will be dynamically allocated, until `MaxVUs` is reached, which is an
+	// absolutely hard limit on the number of VUs the executor will use
+	PreAllocatedVUs null.Int `json:"preAllocatedVUs"`
+	MaxVUs          null.Int `json:"maxVUs"`
+}
+
+// NewAdaptiveArrivalRateConfig returns an AdaptiveArrivalRateConfig with default values
+func NewAdaptiveArrivalRateConfig(name string) *AdaptiveArrivalRateConfig {
+	return &AdaptiveArrivalRateConfig{
+		BaseConfig:         NewBaseConfig(name, adaptiveArrivalRateType),
+		MinRate:            null.NewInt(1, false),
+		TimeUnit:           types.NewNullDuration(1*time.Second, false),
+		LatencyPercentile:  null.NewFloat(95, false),
+		AdjustmentInterval: types.NewNullDuration(10*time.Second, false),
+	}
+}
+
+// Make sure we implement the lib.ExecutorConfig interface
+var _ lib.ExecutorConfig = &AdaptiveArrivalRateConfig{}
+
+var _ lib.ResumableExecutorConfig = &AdaptiveArrivalRateConfig{}
+
+// GetPreAllocatedVUs is just a helper method that returns the scaled pre-allocated VUs.
+func (aarc AdaptiveArrivalRateConfig) GetPreAllocatedVUs(et *lib.ExecutionTuple) int64 {
+	return et.ScaleInt64(aarc.PreAllocatedVUs.Int64)
+}
+
+// GetMaxVUs is just a helper method that returns the scaled max VUs.
+func (aarc AdaptiveArrivalRateConfig) GetMaxVUs(et *lib.ExecutionTuple) int64 {
+	return et.ScaleInt64(aarc.MaxVUs.Int64)
+}
+
+// getStartRate returns the rate the executor starts with, which is the
+// minimum rate if it isn't specified.
+func (aarc AdaptiveArrivalRateConfig) getStartRate() int64 {
+	if aarc.StartRate.Valid {
+		return aarc.StartRate.Int64
+	}
+	return aarc.MinRate.Int64
+}
+
+// getTargets returns a human-readable description of the targets.
+func (aarc AdaptiveArrivalRateConfig) getTargets() string {
+	var targets []string
+	if aarc.TargetLatency.Valid {
+		targets = append(targets, fmt.Sprintf("p(%g)<=%s", aarc.LatencyPercentile.Float64, aarc.TargetLatency))
+	}
+	if aarc.TargetErrorRate.Valid {
+		targets = append(targets, fmt.Sprintf("error rate<=%g", aarc.TargetErrorRate.Float64))
+	}
+	return strings.Join(targets, ", ")
+}
+
+// GetDescription returns a human-readable description of the executor options
+func (aarc AdaptiveArrivalRateConfig) GetDescription(et *lib.ExecutionTuple) string {
+	preAllocatedVUs, maxVUs := aarc.GetPreAllocatedVUs(et), aarc.GetMaxVUs(et)
+	maxVUsRange := fmt.Sprintf("maxVUs: %d", preAllocatedVUs)
+	if maxVUs > preAllocatedVUs {
+		maxVUsRange += fmt.Sprintf("-%d", maxVUs)
+	}
+
+	perSec := et.Segment.FloatLength() * float64(time.Second) / float64(aarc.TimeUnit.Duration)
+	return fmt.Sprintf("%.2f-%.2f iterations/s for %s, adjusted to %s%s",
+		float64(aarc.MinRate.Int64)*perSec, float64(aarc.MaxRate.Int64)*perSec, aarc.Duration.Duration,
+		aarc.getTargets(), aarc.getBaseInfo(maxVUsRange))
+}
+
+// Validate makes sure all options are configured and valid
+//nolint:funlen,gocyclo
+func (aarc *AdaptiveArrivalRateConfig) Validate() []error {
+	errors := aarc.BaseConfig.Validate()
+	if aarc.MinRate.Int64 <= 0 {
+		errors = append(errors, fmt.Errorf("the minRate should be more than 0"))
+	}
+	if !aarc.MaxRate.Valid {
+		errors = append(errors, fmt.Errorf("the maxRate isn't specified"))
+	} else if aarc.MaxRate.Int64 < aarc.MinRate.Int64 {
+		errors = append(errors, fmt.Errorf("the maxRate shouldn't be less than the minRate"))
+	}
+	if aarc.StartRate.Valid &&
+		(aarc.StartRate.Int64 < aarc.MinRate.Int64 || aarc.StartRate.Int64 > aarc.MaxRate.Int64) {
+		errors = append(errors, fmt.Errorf("the startRate should be between the minRate and the maxRate"))
+	}
+
+	if time.Duration(aarc.TimeUnit.Duration) <= 0 {
+		errors = append(errors, fmt.Errorf("the timeUnit should be more than 0"))
+	}
+
+	if !aarc.Duration.Valid {
+		errors = append(errors, fmt.Errorf("the duration is unspecified"))
+	} else if time.Duration(aarc.Duration.Duration) < minDuration {
+		errors = append(errors, fmt.Errorf(
+			"the duration should be at least %s, but is %s", minDuration, aarc.Duration,
+		))
+	}
+
+	if !aarc.TargetLatency.Valid && !aarc.TargetErrorRate.Valid {
+		errors = append(errors, fmt.Errorf("either a targetLatency or a targetErrorRate should be specified"))
+	}
+	if aarc.TargetLatency.Valid && aarc.TargetLatency.Duration <= 0 {
+		errors = append(errors, fmt.Errorf("the targetLatency should be more than 0"))
+	}
+	if p := aarc.LatencyPercentile.Float64; p <= 0 || p > 100 {
+		errors = append(errors, fmt.Errorf("the latencyPercentile should be more than 0 and at most 100"))
+	}
+	if r := aarc.TargetErrorRate.Float64; aarc.TargetErrorRate.Valid && (r <= 0 || r >= 1) {
+		errors = append(errors, fmt.Errorf("the targetErrorRate should be more than 0 and less than 1"))
+	}
+
+	if aarc.AdjustmentInterval.Duration <= 0 {
+		errors = append(errors, fmt.Errorf("the adjustmentInterval should be more than 0"))
+	} else if aarc.Duration.Valid && aarc.AdjustmentInterval.Duration > aarc.Duration.Duration {
+		errors = append(errors, fmt.Errorf("the adjustmentInterval shouldn't be longer than the duration"))
+	}
+
+	if !aarc.PreAllocatedVUs.Valid {
+		errors = append(errors, fmt.Errorf("the number of preAllocatedVUs isn't specified"))
+	} else if aarc.PreAllocatedVUs.Int64 < 0 {
+		errors = append(errors, fmt.Errorf("the number of preAllocatedVUs shouldn't be negative"))
+	}
+
+	if !aarc.MaxVUs.Valid {
+		// TODO: don't change the config while validating
+		aarc.MaxVUs.Int64 = aarc.PreAllocatedVUs.Int64
+	} else if aarc.MaxVUs.Int64 < aarc.PreAllocatedVUs.Int64 {
+		errors = append(errors, fmt.Errorf("maxVUs shouldn't be less than preAllocatedVUs"))
+	}
+
+	return errors
+}
+
+// GetExecutionRequirements returns the number of required VUs to run the
+// executor for its whole duration (disregarding any startTime), including the
+// maximum waiting time for any iterations to gracefully stop. This is used by
+// the execution scheduler in its VU reservation calculations, so it knows how
+// many VUs to pre-initialize.
+func (aarc AdaptiveArrivalRateConfig) GetExecutionRequirements(et *lib.ExecutionTuple) []lib.ExecutionStep {
+	return []lib.ExecutionStep{
+		{
+			TimeOffset:      0,
+			PlannedVUs:      uint64(et.ScaleInt64(aarc.PreAllocatedVUs.Int64)),
+			MaxUnplannedVUs: uint64(et.ScaleInt64(aarc.MaxVUs.Int64) - et.ScaleInt64(aarc.PreAllocatedVUs.Int64)),
+		}, {
+			TimeOffset:      time.Duration(aarc.Duration.Duration + aarc.GracefulStop.Duration),
+			PlannedVUs:      0,
+			MaxUnplannedVUs: 0,
+		},
+	}
+}
+
+// NewExecutor creates a new AdaptiveArrivalRate executor. The results of the
+// iterations are told apart by their scenario tag, so it can't be disabled.
+func (aarc AdaptiveArrivalRateConfig) NewExecutor(
+	es *lib.ExecutionState, logger *logrus.Entry,
+) (lib.Executor, error) {
+	if !es.Options.SystemTags.Has(stats.TagScenario) {
+		return nil, fmt.Errorf(
+			"the %s executor of scenario '%s' needs the '%s' system tag, but it's disabled",
+			adaptiveArrivalRateType, aarc.Name, stats.TagScenario,
+		)
+	}
+	return &AdaptiveArrivalRate{
+		BaseExecutor: NewBaseExecutor(&aarc, es, logger),
+		config:       aarc,
+	}, nil
+}
+
+// HasWork reports whether there is any work to be done for the given execution segment.
+func (aarc AdaptiveArrivalRateConfig) HasWork(et *lib.ExecutionTuple) bool {
+	return aarc.GetMaxVUs(et) > 0
+}
+
+// GetResumedConfig returns the config for the rest of the duration, or nil if
+// the scenario was already over. The search for the capacity starts over.
+func (aarc AdaptiveArrivalRateConfig) GetResumedConfig(elapsed time.Duration, _ uint64) lib.ExecutorConfig {
+	var offset time.Duration
+	aarc.BaseConfig, offset = aarc.BaseConfig.getResumed(elapsed)
+	left := time.Duration(aarc.Duration.Duration) - offset
+	if left <= 0 {
+		return nil
+	}
+	aarc.Duration = types.NullDurationFrom(left)
+	if aarc.AdjustmentInterval.Duration > aarc.Duration.Duration {
+		aarc.AdjustmentInterval = aarc.Duration
+	}
+	return &aarc
+}
+
+// adaptiveController adjusts the arrival rate of a scenario to the results
+// of its iterations since the previous adjustment.
+type adaptiveController struct {
+	config AdaptiveArrivalRateConfig
+
+	mu        sync.Mutex
+	durations *stats.TrendSink
+	requests  uint64
+	failures  uint64
+	// The current rate and the highest one at which all of the targets were
+	// met, both per timeUnit and not scaled by the execution segment.
+	rate     float64
+	capacity float64
+}
+
+func newAdaptiveController(config AdaptiveArrivalRateConfig) *adaptiveController {
+	return &adaptiveController{
+		config:    config,
+		durations: &stats.TrendSink{},
+		rate:      float64(config.getStartRate()),
+	}
+}
+
+// observe collects the HTTP request results of the scenario.
+func (c *adaptiveController) observe(sampleContainers []stats.SampleContainer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, sc := range sampleContainers {
+		for _, sample := range sc.GetSamples() {
+			if scenario, _ := sample.Tags.Get("scenario"); scenario != c.config.Name {
+				continue
+			}
+			switch sample.Metric.Name {
+			case metrics.HTTPReqDuration.Name:
+				c.durations.Add(sample)
+			case metrics.HTTPReqFailed.Name:
+				c.requests++
+				if sample.Value != 0 {
+					c.failures++
+				}
+			}
+		}
+	}
+}
+
+// getRate returns the current rate.
+func (c *adaptiveController) getRate() float64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rate
+}
+
+// adjust changes the rate in proportion to how far the results since the
+// previous adjustment are from the targets, and returns the new rate and the
+// capacity found so far. Without any results, the rate isn't changed.
+func (c *adaptiveController) adjust() (rate, capacity float64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	ratio, observed := math.Inf(1), false
+	if c.config.TargetLatency.Valid && c.durations.Count > 0 {
+		c.durations.Calc()
+		target := stats.D(time.Duration(c.config.TargetLatency.Duration))
+		ratio = math.Min(ratio, target/c.durations.P(c.config.LatencyPercentile.Float64/100))
+		observed = true
+	}
+	if c.config.TargetErrorRate.Valid && c.requests > 0 {
+		errorRate := float64(c.failures) / float64(c.requests)
+		ratio = math.Min(ratio, c.config.TargetErrorRate.Float64/errorRate)
+		observed = true
+	}
+	c.durations = &stats.TrendSink{}
+	c.requests, c.failures = 0, 0
+
+	if !observed {
+		return c.rate, c.capacity
+	}
+	if ratio >= 1 && c.rate > c.capacity {
+		c.capacity = c.rate
+	}
+	factor := math.Max(adaptiveMinRateFactor, math.Min(adaptiveMaxRateFactor, ratio))
+	c.rate = math.Max(float64(c.config.MinRate.Int64), math.Min(float64(c.config.MaxRate.Int64), c.rate*factor))
+	return c.rate, c.capacity
+}
+
+// AdaptiveArrivalRate executes iterations at a rate that is adjusted by a
+// feedback controller, to find the highest throughput at which the latency
+// and the error rate targets are still met.
+type AdaptiveArrivalRate struct {
+	*BaseExecutor
+	config AdaptiveArrivalRateConfig
+	et     *lib.ExecutionTuple
+}
+
+// Make sure we implement the lib.Executor interface.
+var _ lib.Executor = &AdaptiveArrivalRate{}
+
+// Init values needed for the execution
+func (aar *AdaptiveArrivalRate) Init(ctx context.Context) error {
+	// err should always be nil, because Init() won't be called for executors
+	// with no work, as determined by their config's HasWork() method.
+	et, err := aar.BaseExecutor.executionState.ExecutionTuple.GetNewExecutionTupleFromValue(aar.config.MaxVUs.Int64)
+	aar.et = et
+	return err
+}
+
+// Run executes iterations at the adjusted rate. The found capacity, in
+// iterations per second, is emitted as the adaptive_capacity metric after
+// every adjustment at which the targets were met at least once.
+//nolint:funlen
+func (aar AdaptiveArrivalRate) Run(parentCtx context.Context, out chan<- stats.SampleContainer) (err error) {
+	gracefulStop := aar.config.GetGracefulStop()
+	duration := time.Duration(aar.config.Duration.Duration)
+	preAllocatedVUs := aar.config.GetPreAllocatedVUs(aar.executionState.ExecutionTuple)
+	maxVUs := aar.config.GetMaxVUs(aar.executionState.ExecutionTuple)
+	timeUnit := time.Duration(aar.config.TimeUnit.Duration)
+	segmentLength := aar.et.Segment.FloatLength()
+	// Converts the unscaled rates per timeUnit of the controller to
+	// iterations per second of this instance.
+	perSec := segmentLength * float64(time.Second) / float64(timeUnit)
+
+	aar.logger.WithFields(logrus.Fields{
+		"maxVUs": maxVUs, "preAllocatedVUs": preAllocatedVUs, "duration": duration,
+		"targets": aar.config.getTargets(), "type": aar.config.GetType(),
+	}).Debug("Starting executor run...")
+
+	controller := newAdaptiveController(aar.config)
+	removeObserver := aar.executionState.AddSampleObserver(controller.observe)
+	defer removeObserver()
+
+	startTime, maxDurationCtx, regDurationCtx, cancel := getDurationContexts(parentCtx, duration, gracefulStop)
+	vus, err := newArrivalRateVUs(
+		parentCtx, maxDurationCtx, out, aar.BaseExecutor, aar.config.BaseConfig, preAllocatedVUs, maxVUs)
+	defer vus.stop(cancel)
+	if err != nil {
+		return err
+	}
+
+	vusFmt := pb.GetFixedLengthIntFormat(maxVUs)
+	itersFmt := pb.GetFixedLengthFloatFormat(float64(aar.config.MaxRate.Int64)*perSec, 0) + " iters/s"
+	progressFn := func() (float64, []string) {
+		spent := time.Since(startTime)
+		busyVUs, activeVUs := vus.counts()
+		progVUs := fmt.Sprintf(vusFmt+"/"+vusFmt+" VUs", busyVUs, activeVUs)
+		progIters := fmt.Sprintf(itersFmt, controller.getRate()*perSec)
+
+		right := []string{progVUs, duration.String(), progIters}
+
+		if spent > duration {
+			return 1, right
+		}
+
+		spentDuration := pb.GetFixedLengthDuration(spent, duration)
+		progDur := fmt.Sprintf("%s/%s", spentDuration, duration)
+		right[1] = progDur
+
+		return math.Min(1, float64(spent)/float64(duration)), right
+	}
+	aar.progress.Modify(pb.WithProgress(progressFn))
+	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, &aar, progressFn, aar.iterations)
+
+	metricTags := aar.getMetricTags(nil)
+	adjusterDone := make(chan struct{})
+	defer func() { <-adjusterDone }()
+	go func() {
+		defer close(adjusterDone)
+		ticker := time.NewTicker(time.Duration(aar.config.AdjustmentInterval.Duration))
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				rate, capacity := controller.adjust()
+				aar.logger.WithFields(logrus.Fields{
+					"rate": rate, "capacity": capacity,
+				}).Debug("Adjusted the arrival rate")
+				if capacity > 0 {
+					stats.PushIfNotDone(parentCtx, out, stats.Sample{
+						Value: capacity * float64(time.Second) / float64(timeUnit), Metric: metrics.AdaptiveCapacity,
+						Tags: metricTags, Time: time.Now(),
+					})
+				}
+			case <-regDurationCtx.Done():
+				return
+			}
+		}
+	}()
+
+	timer := time.NewTimer(time.Hour * 24)
+	next := startTime
+	for {
+		timer.Reset(time.Until(next))
+		select {
+		case <-timer.C:
+			// The rate can change between iterations, so the time of the next
+			// one is based on the current rate and the time of this one.
+			next = next.Add(time.Duration(float64(timeUnit) / (controller.getRate() * segmentLength)))
+
+			vus.startIteration()
+
+		case <-regDurationCtx.Done():
+			return nil
+		}
+	}
+}
@@ -0,0 +1,154 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+func getTestAdaptiveArrivalRateConfig() *AdaptiveArrivalRateConfig {
+	config := NewAdaptiveArrivalRateConfig("adaptive")
+	config.GracefulStop = types.NullDurationFrom(0)
+	config.StartRate = null.IntFrom(20)
+	config.MaxRate = null.IntFrom(100)
+	config.Duration = types.NullDurationFrom(3 * time.Second)
+	config.TargetLatency = types.NullDurationFrom(100 * time.Millisecond)
+	config.TargetErrorRate = null.FloatFrom(0.1)
+	config.AdjustmentInterval = types.NullDurationFrom(time.Second)
+	config.PreAllocatedVUs = null.IntFrom(10)
+	config.MaxVUs = null.IntFrom(10)
+	return config
+}
+
+func getAdaptiveTestSamples(scenario string, duration float64, failed bool) []stats.SampleContainer {
+	tags := stats.IntoSampleTags(&map[string]string{"scenario": scenario})
+	failedValue := 0.0
+	if failed {
+		failedValue = 1
+	}
+	return []stats.SampleContainer{stats.Samples{
+		{Metric: metrics.HTTPReqDuration, Value: duration, Tags: tags, Time: time.Now()},
+		{Metric: metrics.HTTPReqFailed, Value: failedValue, Tags: tags, Time: time.Now()},
+	}}
+}
+
+func TestAdaptiveControllerAdjust(t *testing.T) {
+	t.Parallel()
+	config := getTestAdaptiveArrivalRateConfig()
+	require.Empty(t, config.Validate())
+	c := newAdaptiveController(*config)
+
+	// No results, no changes
+	rate, capacity := c.adjust()
+	assert.Equal(t, 20.0, rate)
+	assert.Equal(t, 0.0, capacity)
+
+	// The rate increases by at most 20% when the targets are met easily,
+	// and other scenarios are ignored
+	c.observe(getAdaptiveTestSamples("adaptive", 10, false))
+	c.observe(getAdaptiveTestSamples("other", 1000, true))
+	rate, capacity = c.adjust()
+	assert.Equal(t, 24.0, rate)
+	assert.Equal(t, 20.0, capacity)
+
+	// It decreases in proportion to how far the latency is from its target
+	c.observe(getAdaptiveTestSamples("adaptive", 125, false))
+	rate, capacity = c.adjust()
+	assert.InDelta(t, 19.2, rate, 0.0001)
+	assert.Equal(t, 20.0, capacity)
+
+	// And it's halved at most, down to the minimum rate
+	for i := 0; i < 5; i++ {
+		c.observe(getAdaptiveTestSamples("adaptive", 10, true))
+	}
+	rate, capacity = c.adjust()
+	assert.InDelta(t, 9.6, rate, 0.0001)
+	assert.Equal(t, 20.0, capacity)
+	for i := 0; i < 5; i++ {
+		c.observe(getAdaptiveTestSamples("adaptive", 10, true))
+		rate, _ = c.adjust()
+	}
+	assert.Equal(t, 1.0, rate)
+}
+
+func TestAdaptiveArrivalRateNeedsScenarioTag(t *testing.T) {
+	t.Parallel()
+	config := getTestAdaptiveArrivalRateConfig()
+	et, err := lib.NewExecutionTuple(nil, nil)
+	require.NoError(t, err)
+	tags := stats.DefaultSystemTagSet &^ stats.TagScenario
+	es := lib.NewExecutionState(lib.Options{SystemTags: &tags}, et, 10, 10)
+	_, err = config.NewExecutor(es, logrus.NewEntry(logrus.New()))
+	assert.EqualError(t, err,
+		"the adaptive-arrival-rate executor of scenario 'adaptive' needs the 'scenario' system tag, but it's disabled")
+}
+
+func TestAdaptiveArrivalRateRunCapacity(t *testing.T) {
+	t.Parallel()
+	config := getTestAdaptiveArrivalRateConfig()
+	require.Empty(t, config.Validate())
+	et, err := lib.NewExecutionTuple(nil, nil)
+	require.NoError(t, err)
+	es := lib.NewExecutionState(lib.Options{SystemTags: &stats.DefaultSystemTagSet}, et, 10, 10)
+	var count int64
+	ctx, cancel, executor, _ := setupExecutor(
+		t, config, es,
+		simpleRunner(func(ctx context.Context) error {
+			// The engine passes the samples to the observers, but there is
+			// no engine in this test.
+			atomic.AddInt64(&count, 1)
+			es.ObserveSamples(getAdaptiveTestSamples("adaptive", 10, false))
+			return nil
+		}),
+	)
+	defer cancel()
+	engineOut := make(chan stats.SampleContainer, 1000)
+	require.NoError(t, executor.Run(ctx, engineOut))
+	close(engineOut)
+
+	var capacities []float64
+	for sc := range engineOut {
+		for _, sample := range sc.GetSamples() {
+			if sample.Metric == metrics.AdaptiveCapacity {
+				capacities = append(capacities, sample.Value)
+			}
+		}
+	}
+	// The rate was 20/s in the first second and 24/s in the second one, and
+	// the third adjustment can race with the end of the duration.
+	require.True(t, len(capacities) >= 2, "capacities: %v", capacities)
+	assert.InDelta(t, 20, capacities[0], 0.0001)
+	assert.InDelta(t, 24, capacities[1], 0.0001)
+	assert.InDelta(t, 20+24+28.8, atomic.LoadInt64(&count), 4)
+}
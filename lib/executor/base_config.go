@@ -23,11 +23,13 @@ package executor
 import (
 	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
 	"gopkg.in/guregu/null.v3"
 
+	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/consts"
 	"github.com/loadimpact/k6/lib/types"
 )
@@ -42,17 +44,39 @@ const executorNameErr = "the executor name should contain only numbers, latin le
 
 // BaseConfig contains the common config fields for all executors
 type BaseConfig struct {
-	Name         string             `json:"-"` // set via the JS object key
-	Type         string             `json:"executor"`
-	StartTime    types.NullDuration `json:"startTime"`
-	GracefulStop types.NullDuration `json:"gracefulStop"`
-	Env          map[string]string  `json:"env"`
-	Exec         null.String        `json:"exec"` // function name, externally validated
-	Tags         map[string]string  `json:"tags"`
+	Name         string                `json:"-"` // set via the JS object key
+	Type         string                `json:"executor"`
+	StartTime    types.NullDuration    `json:"startTime"`
+	StartCron    null.String           `json:"startCron"`
+	Occurrences  null.Int              `json:"occurrences"`
+	StartAt      []time.Time           `json:"startAt"`
+	GracefulStop types.NullDuration    `json:"gracefulStop"`
+	Env          map[string]string     `json:"env"`
+	Exec         null.String           `json:"exec"` // function name, externally validated
+	Tags         map[string]string     `json:"tags"`
+	TLS          *lib.ScenarioTLS      `json:"tls"`
+	Network      *lib.ScenarioNetwork  `json:"network"`
+	Proxy        *lib.ScenarioProxy    `json:"proxy"`
+	DNS          *lib.ScenarioDNS      `json:"dns"`
+	LocalIPs     *lib.ScenarioLocalIPs `json:"localIPs"`
+	Setup        null.String           `json:"setup"`    // function name, externally validated
+	Teardown     null.String           `json:"teardown"` // function name, externally validated
+
+	IterationTimeout types.NullDuration `json:"iterationTimeout"`
+	// Failed iterations are retried up to MaxRetries times. Every attempt
+	// emits its own iterations and iteration_duration samples, with a retry
+	// tag on the retried ones, so they can be told apart from the first ones.
+	Retries      null.Int           `json:"retries"`
+	RetryBackoff types.NullDuration `json:"retryBackoff"`
+
+	DiscardMetricsFor types.NullDuration `json:"discardMetricsFor"`
 
 	// TODO: future extensions like distribution, others?
 }
 
+// MaxRetries is the maximum number of times a failed iteration can be retried.
+const MaxRetries = 10
+
 // NewBaseConfig returns a default base config with the default values
 func NewBaseConfig(name, configType string) BaseConfig {
 	return BaseConfig{
@@ -82,9 +106,30 @@ func (bc BaseConfig) Validate() (errors []error) {
 	if bc.StartTime.Duration < 0 {
 		errors = append(errors, fmt.Errorf("the startTime can't be negative"))
 	}
+	errors = append(errors, bc.validateSchedule()...)
 	if bc.GracefulStop.Duration < 0 {
 		errors = append(errors, fmt.Errorf("the gracefulStop timeout can't be negative"))
 	}
+	if bc.IterationTimeout.Duration < 0 {
+		errors = append(errors, fmt.Errorf("the iterationTimeout can't be negative"))
+	}
+	if bc.Retries.Int64 < 0 {
+		errors = append(errors, fmt.Errorf("the number of retries can't be negative"))
+	}
+	if bc.Retries.Int64 > MaxRetries {
+		errors = append(errors, fmt.Errorf("the number of retries can't be more than %d", MaxRetries))
+	}
+	if bc.RetryBackoff.Duration < 0 {
+		errors = append(errors, fmt.Errorf("the retryBackoff can't be negative"))
+	}
+	if bc.DiscardMetricsFor.Duration < 0 {
+		errors = append(errors, fmt.Errorf("the discardMetricsFor duration can't be negative"))
+	}
+	errors = append(errors, bc.TLS.Validate()...)
+	errors = append(errors, bc.Network.Validate()...)
+	errors = append(errors, bc.Proxy.Validate()...)
+	errors = append(errors, bc.DNS.Validate()...)
+	errors = append(errors, bc.LocalIPs.Validate()...)
 	return errors
 }
 
@@ -104,6 +149,65 @@ func (bc BaseConfig) GetStartTime() time.Duration {
 	return time.Duration(bc.StartTime.Duration)
 }
 
+// validateSchedule checks the options for starting the executor at specific
+// wall-clock times, instead of only once at its startTime.
+func (bc BaseConfig) validateSchedule() (errors []error) {
+	if bc.StartCron.Valid && len(bc.StartAt) > 0 {
+		errors = append(errors, fmt.Errorf("startCron and startAt can't be used at the same time"))
+	}
+	if bc.StartCron.Valid {
+		if _, err := parseCron(bc.StartCron.String); err != nil {
+			errors = append(errors, err)
+		}
+		if !bc.Occurrences.Valid {
+			errors = append(errors, fmt.Errorf("the number of occurrences should be specified with startCron"))
+		}
+	} else if bc.Occurrences.Valid {
+		errors = append(errors, fmt.Errorf("occurrences can only be used with startCron"))
+	}
+	if bc.Occurrences.Valid && bc.Occurrences.Int64 <= 0 {
+		errors = append(errors, fmt.Errorf("the number of occurrences should be more than 0"))
+	}
+	return errors
+}
+
+// GetStartTimes returns the times, relative to the given beginning of the
+// actual test, when this executor is supposed to be started. Unless startCron
+// or startAt are used, that's only its startTime. Otherwise, startTime is the
+// earliest moment any of the occurrences can start at, and the ones from
+// startAt that are already in the past are skipped.
+func (bc BaseConfig) GetStartTimes(testStart time.Time) []time.Duration {
+	startTime := bc.GetStartTime()
+	switch {
+	case bc.StartCron.Valid:
+		schedule, err := parseCron(bc.StartCron.String)
+		if err != nil {
+			return nil // shouldn't happen, it was validated
+		}
+		startTimes := make([]time.Duration, 0, bc.Occurrences.Int64)
+		next := testStart.Add(startTime)
+		for i := int64(0); i < bc.Occurrences.Int64; i++ {
+			if next = schedule.next(next); next.IsZero() {
+				break
+			}
+			startTimes = append(startTimes, next.Sub(testStart))
+			next = next.Add(time.Minute)
+		}
+		return startTimes
+	case len(bc.StartAt) > 0:
+		startTimes := make([]time.Duration, 0, len(bc.StartAt))
+		for _, t := range bc.StartAt {
+			if offset := t.Sub(testStart); offset >= startTime {
+				startTimes = append(startTimes, offset)
+			}
+		}
+		sort.Slice(startTimes, func(i, j int) bool { return startTimes[i] < startTimes[j] })
+		return startTimes
+	default:
+		return []time.Duration{startTime}
+	}
+}
+
 // GetGracefulStop returns how long k6 is supposed to wait for any still
 // running iterations to finish executing at the end of the normal executor
 // duration, before it actually kills them.
@@ -114,6 +218,22 @@ func (bc BaseConfig) GetGracefulStop() time.Duration {
 	return time.Duration(bc.GracefulStop.Duration)
 }
 
+// getResumed returns a copy of the base config for a test run resumed after
+// the given duration, and how far into its own duration the executor was.
+// Scheduled executors are instead started over at their next occurrence.
+func (bc BaseConfig) getResumed(elapsed time.Duration) (BaseConfig, time.Duration) {
+	if bc.StartCron.Valid || len(bc.StartAt) > 0 {
+		return bc, 0
+	}
+	startTime := bc.GetStartTime()
+	if elapsed < startTime {
+		bc.StartTime = types.NullDurationFrom(startTime - elapsed)
+		return bc, 0
+	}
+	bc.StartTime = types.NewNullDuration(0, false)
+	return bc, elapsed - startTime
+}
+
 // GetEnv returns any specific environment key=value pairs that
 // are configured for the executor.
 func (bc BaseConfig) GetEnv() map[string]string {
@@ -129,11 +249,52 @@ func (bc BaseConfig) GetExec() string {
 	return exec
 }
 
+// GetSetup returns the name of the setup function of the scenario, if any.
+func (bc BaseConfig) GetSetup() string {
+	return bc.Setup.ValueOrZero()
+}
+
+// GetTeardown returns the name of the teardown function of the scenario, if any.
+func (bc BaseConfig) GetTeardown() string {
+	return bc.Teardown.ValueOrZero()
+}
+
 // GetTags returns any custom tags configured for the executor.
 func (bc BaseConfig) GetTags() map[string]string {
 	return bc.Tags
 }
 
+// GetTLS returns the scenario-specific TLS settings, if any.
+func (bc BaseConfig) GetTLS() *lib.ScenarioTLS {
+	return bc.TLS
+}
+
+// GetNetwork returns the simulated network conditions of the scenario, if any.
+func (bc BaseConfig) GetNetwork() *lib.ScenarioNetwork {
+	return bc.Network
+}
+
+// GetProxy returns the HTTP proxy settings of the scenario, if any.
+func (bc BaseConfig) GetProxy() *lib.ScenarioProxy {
+	return bc.Proxy
+}
+
+// GetDNS returns the DNS resolution settings of the scenario, if any.
+func (bc BaseConfig) GetDNS() *lib.ScenarioDNS {
+	return bc.DNS
+}
+
+// GetLocalIPs returns the local IP pool of the scenario, if any.
+func (bc BaseConfig) GetLocalIPs() *lib.ScenarioLocalIPs {
+	return bc.LocalIPs
+}
+
+// GetDiscardMetricsFor returns the warm-up window of the scenario, during
+// which its metric samples are discarded.
+func (bc BaseConfig) GetDiscardMetricsFor() types.NullDuration {
+	return bc.DiscardMetricsFor
+}
+
 // IsDistributable returns true since by default all executors could be run in
 // a distributed manner.
 func (bc BaseConfig) IsDistributable() bool {
@@ -145,12 +306,33 @@ func (bc BaseConfig) getBaseInfo(facts ...string) string {
 	if bc.Exec.Valid {
 		facts = append(facts, fmt.Sprintf("exec: %s", bc.Exec.String))
 	}
+	if bc.Setup.Valid {
+		facts = append(facts, fmt.Sprintf("setup: %s", bc.Setup.String))
+	}
+	if bc.Teardown.Valid {
+		facts = append(facts, fmt.Sprintf("teardown: %s", bc.Teardown.String))
+	}
 	if bc.StartTime.Duration > 0 {
 		facts = append(facts, fmt.Sprintf("startTime: %s", bc.StartTime.Duration))
 	}
+	if bc.StartCron.Valid {
+		facts = append(facts, fmt.Sprintf("startCron: %s x%d", bc.StartCron.String, bc.Occurrences.Int64))
+	}
+	if len(bc.StartAt) > 0 {
+		facts = append(facts, fmt.Sprintf("startAt: %d times", len(bc.StartAt)))
+	}
 	if bc.GracefulStop.Duration > 0 {
 		facts = append(facts, fmt.Sprintf("gracefulStop: %s", bc.GracefulStop.Duration))
 	}
+	if bc.IterationTimeout.Duration > 0 {
+		facts = append(facts, fmt.Sprintf("iterationTimeout: %s", bc.IterationTimeout.Duration))
+	}
+	if bc.Retries.Int64 > 0 {
+		facts = append(facts, fmt.Sprintf("retries: %d", bc.Retries.Int64))
+	}
+	if bc.DiscardMetricsFor.Duration > 0 {
+		facts = append(facts, fmt.Sprintf("discardMetricsFor: %s", bc.DiscardMetricsFor.Duration))
+	}
 	if len(facts) == 0 {
 		return ""
 	}
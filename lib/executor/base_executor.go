@@ -22,7 +22,9 @@ package executor
 
 import (
 	"context"
+	"errors"
 	"strconv"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 
@@ -40,6 +42,15 @@ type BaseExecutor struct {
 	executionState *lib.ExecutionState
 	logger         *logrus.Entry
 	progress       *pb.ProgressBar
+	iterations     *activeIterations
+	pause          *scenarioPause
+}
+
+// scenarioPause is the pause state of a single scenario. It's a pointer in the
+// BaseExecutor, so it's shared between all of its copies.
+type scenarioPause struct {
+	lock   sync.RWMutex
+	resume chan struct{} // nil if the scenario isn't paused
 }
 
 // NewBaseExecutor returns an initialized BaseExecutor
@@ -52,6 +63,58 @@ func NewBaseExecutor(config lib.ExecutorConfig, es *lib.ExecutionState, logger *
 			pb.WithLeft(config.GetName),
 			pb.WithLogger(logger),
 		),
+		iterations: newActiveIterations(),
+		pause:      &scenarioPause{},
+	}
+}
+
+// SetScenarioPaused pauses or resumes only the scenario of this executor. While
+// it's paused, its VUs don't start new iterations and the arrival-rate
+// executors skip the iterations they would have started.
+func (bs BaseExecutor) SetScenarioPaused(paused bool) error {
+	bs.pause.lock.Lock()
+	defer bs.pause.lock.Unlock()
+
+	if paused {
+		if bs.pause.resume != nil {
+			return errors.New("the scenario was already paused")
+		}
+		bs.pause.resume = make(chan struct{})
+		bs.logger.Debug("Scenario paused")
+		return nil
+	}
+
+	if bs.pause.resume == nil {
+		return errors.New("the scenario wasn't paused")
+	}
+	close(bs.pause.resume)
+	bs.pause.resume = nil
+	bs.logger.Debug("Scenario resumed")
+	return nil
+}
+
+// IsScenarioPaused returns whether the scenario of this executor is paused.
+func (bs BaseExecutor) IsScenarioPaused() bool {
+	bs.pause.lock.RLock()
+	defer bs.pause.lock.RUnlock()
+	return bs.pause.resume != nil
+}
+
+// waitWhilePaused blocks while the scenario is paused. It returns false if the
+// context was done before the scenario was resumed.
+func (bs BaseExecutor) waitWhilePaused(ctx context.Context) bool {
+	bs.pause.lock.RLock()
+	resume := bs.pause.resume
+	bs.pause.lock.RUnlock()
+	if resume == nil {
+		return true
+	}
+
+	select {
+	case <-resume:
+		return true
+	case <-ctx.Done():
+		return false
 	}
 }
 
@@ -25,15 +25,12 @@ import (
 	"fmt"
 	"math"
 	"math/big"
-	"sync"
-	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/lib"
-	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/ui/pb"
@@ -77,6 +74,8 @@ func NewConstantArrivalRateConfig(name string) *ConstantArrivalRateConfig {
 // Make sure we implement the lib.ExecutorConfig interface
 var _ lib.ExecutorConfig = &ConstantArrivalRateConfig{}
 
+var _ lib.ResumableExecutorConfig = &ConstantArrivalRateConfig{}
+
 // GetPreAllocatedVUs is just a helper method that returns the scaled pre-allocated VUs.
 func (carc ConstantArrivalRateConfig) GetPreAllocatedVUs(et *lib.ExecutionTuple) int64 {
 	return et.ScaleInt64(carc.PreAllocatedVUs.Int64)
@@ -179,6 +178,19 @@ func (carc ConstantArrivalRateConfig) HasWork(et *lib.ExecutionTuple) bool {
 	return carc.GetMaxVUs(et) > 0
 }
 
+// GetResumedConfig returns the config for the rest of the duration, or nil if
+// the scenario was already over.
+func (carc ConstantArrivalRateConfig) GetResumedConfig(elapsed time.Duration, _ uint64) lib.ExecutorConfig {
+	var offset time.Duration
+	carc.BaseConfig, offset = carc.BaseConfig.getResumed(elapsed)
+	left := time.Duration(carc.Duration.Duration) - offset
+	if left <= 0 {
+		return nil
+	}
+	carc.Duration = types.NullDurationFrom(left)
+	return &carc
+}
+
 // ConstantArrivalRate tries to execute a specific number of iterations for a
 // specific period.
 type ConstantArrivalRate struct {
@@ -226,66 +238,12 @@ func (car ConstantArrivalRate) Run(parentCtx context.Context, out chan<- stats.S
 		"tickerPeriod": tickerPeriod, "type": car.config.GetType(),
 	}).Debug("Starting executor run...")
 
-	activeVUsWg := &sync.WaitGroup{}
-
-	returnedVUs := make(chan struct{})
 	startTime, maxDurationCtx, regDurationCtx, cancel := getDurationContexts(parentCtx, duration, gracefulStop)
-
-	defer func() {
-		// Make sure all VUs aren't executing iterations anymore, for the cancel()
-		// below to deactivate them.
-		<-returnedVUs
-		cancel()
-		activeVUsWg.Wait()
-	}()
-	activeVUs := make(chan lib.ActiveVU, maxVUs)
-	activeVUsCount := uint64(0)
-
-	activationParams := getVUActivationParams(maxDurationCtx, car.config.BaseConfig,
-		func(u lib.InitializedVU) {
-			car.executionState.ReturnVU(u, true)
-			activeVUsWg.Done()
-		})
-	activateVU := func(initVU lib.InitializedVU) lib.ActiveVU {
-		activeVUsWg.Add(1)
-		activeVU := initVU.Activate(activationParams)
-		car.executionState.ModCurrentlyActiveVUsCount(+1)
-		atomic.AddUint64(&activeVUsCount, 1)
-		return activeVU
-	}
-
-	remainingUnplannedVUs := maxVUs - preAllocatedVUs
-	makeUnplannedVUCh := make(chan struct{})
-	defer close(makeUnplannedVUCh)
-	go func() {
-		defer close(returnedVUs)
-		defer func() {
-			// this is done here as to not have an unplannedVU in the middle of initialization when
-			// starting to return activeVUs
-			for i := uint64(0); i < atomic.LoadUint64(&activeVUsCount); i++ {
-				<-activeVUs
-			}
-		}()
-		for range makeUnplannedVUCh {
-			car.logger.Debug("Starting initialization of an unplanned VU...")
-			initVU, err := car.executionState.GetUnplannedVU(maxDurationCtx, car.logger)
-			if err != nil {
-				// TODO figure out how to return it to the Run goroutine
-				car.logger.WithError(err).Error("Error while allocating unplanned VU")
-			} else {
-				car.logger.Debug("The unplanned VU finished initializing successfully!")
-				activeVUs <- activateVU(initVU)
-			}
-		}
-	}()
-
-	// Get the pre-allocated VUs in the local buffer
-	for i := int64(0); i < preAllocatedVUs; i++ {
-		initVU, err := car.executionState.GetPlannedVU(car.logger, false)
-		if err != nil {
-			return err
-		}
-		activeVUs <- activateVU(initVU)
+	vus, err := newArrivalRateVUs(
+		parentCtx, maxDurationCtx, out, car.BaseExecutor, car.config.BaseConfig, preAllocatedVUs, maxVUs)
+	defer vus.stop(cancel)
+	if err != nil {
+		return err
 	}
 
 	vusFmt := pb.GetFixedLengthIntFormat(maxVUs)
@@ -293,10 +251,8 @@ func (car ConstantArrivalRate) Run(parentCtx context.Context, out chan<- stats.S
 		pb.GetFixedLengthFloatFormat(arrivalRatePerSec, 0)+" iters/s", arrivalRatePerSec)
 	progressFn := func() (float64, []string) {
 		spent := time.Since(startTime)
-		currActiveVUs := atomic.LoadUint64(&activeVUsCount)
-		vusInBuffer := uint64(len(activeVUs))
-		progVUs := fmt.Sprintf(vusFmt+"/"+vusFmt+" VUs",
-			currActiveVUs-vusInBuffer, currActiveVUs)
+		busyVUs, activeVUs := vus.counts()
+		progVUs := fmt.Sprintf(vusFmt+"/"+vusFmt+" VUs", busyVUs, activeVUs)
 
 		right := []string{progVUs, duration.String(), progIters}
 
@@ -311,13 +267,7 @@ func (car ConstantArrivalRate) Run(parentCtx context.Context, out chan<- stats.S
 		return math.Min(1, float64(spent)/float64(duration)), right
 	}
 	car.progress.Modify(pb.WithProgress(progressFn))
-	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, &car, progressFn)
-
-	runIterationBasic := getIterationRunner(car.executionState, car.logger)
-	runIteration := func(vu lib.ActiveVU) {
-		runIterationBasic(maxDurationCtx, vu)
-		activeVUs <- vu
-	}
+	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, &car, progressFn, car.iterations)
 
 	start, offsets, _ := car.et.GetStripedOffsets()
 	timer := time.NewTimer(time.Hour * 24)
@@ -329,43 +279,12 @@ func (car ConstantArrivalRate) Run(parentCtx context.Context, out chan<- stats.S
 				int64(time.Duration(car.config.TimeUnit.Duration)),
 			)).Duration)
 
-	shownWarning := false
-	metricTags := car.getMetricTags(nil)
 	for li, gi := 0, start; ; li, gi = li+1, gi+offsets[li%len(offsets)] {
 		t := notScaledTickerPeriod*time.Duration(gi) - time.Since(startTime)
 		timer.Reset(t)
 		select {
 		case <-timer.C:
-			select {
-			case vu := <-activeVUs: // ideally, we get the VU from the buffer without any issues
-				go runIteration(vu) //TODO: refactor so we dont spin up a goroutine for each iteration
-				continue
-			default: // no free VUs currently available
-			}
-
-			// Since there aren't any free VUs available, consider this iteration
-			// dropped - we aren't going to try to recover it, but
-
-			stats.PushIfNotDone(parentCtx, out, stats.Sample{
-				Value: 1, Metric: metrics.DroppedIterations,
-				Tags: metricTags, Time: time.Now(),
-			})
-
-			// We'll try to start allocating another VU in the background,
-			// non-blockingly, if we have remainingUnplannedVUs...
-			if remainingUnplannedVUs == 0 {
-				if !shownWarning {
-					car.logger.Warningf("Insufficient VUs, reached %d active VUs and cannot initialize more", maxVUs)
-					shownWarning = true
-				}
-				continue
-			}
-
-			select {
-			case makeUnplannedVUCh <- struct{}{}: // great!
-				remainingUnplannedVUs--
-			default: // we're already allocating a new VU
-			}
+			vus.startIteration()
 
 		case <-regDurationCtx.Done():
 			return nil
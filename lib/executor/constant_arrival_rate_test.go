@@ -333,3 +333,33 @@ func TestConstantArrivalRateDroppedIterations(t *testing.T) {
 	assert.Equal(t, int64(5), count)
 	assert.Equal(t, float64(5), sumMetricValues(engineOut, metrics.DroppedIterations.Name))
 }
+
+func TestConstantArrivalRateRunPaused(t *testing.T) {
+	t.Parallel()
+	var count int64
+	et, err := lib.NewExecutionTuple(nil, nil)
+	require.NoError(t, err)
+	es := lib.NewExecutionState(lib.Options{}, et, 10, 50)
+	config := getTestConstantArrivalRateConfig()
+	config.Duration = types.NullDurationFrom(time.Second)
+	ctx, cancel, executor, _ := setupExecutor(
+		t, config, es,
+		simpleRunner(func(ctx context.Context) error {
+			atomic.AddInt64(&count, 1)
+			return nil
+		}),
+	)
+	defer cancel()
+	require.NoError(t, executor.(lib.ScenarioPausableExecutor).SetScenarioPaused(true))
+
+	engineOut := make(chan stats.SampleContainer, 1000)
+	require.NoError(t, executor.Run(ctx, engineOut))
+	close(engineOut)
+
+	assert.Equal(t, int64(0), atomic.LoadInt64(&count))
+	for sampleContainer := range engineOut {
+		for _, sample := range sampleContainer.GetSamples() {
+			assert.NotEqual(t, metrics.DroppedIterations, sample.Metric, "paused iterations were dropped")
+		}
+	}
+}
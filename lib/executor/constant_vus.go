@@ -70,6 +70,8 @@ func NewConstantVUsConfig(name string) ConstantVUsConfig {
 // Make sure we implement the lib.ExecutorConfig interface
 var _ lib.ExecutorConfig = &ConstantVUsConfig{}
 
+var _ lib.ResumableExecutorConfig = &ConstantVUsConfig{}
+
 // GetVUs returns the scaled VUs for the executor.
 func (clvc ConstantVUsConfig) GetVUs(et *lib.ExecutionTuple) int64 {
 	return et.Segment.Scale(clvc.VUs.Int64)
@@ -122,6 +124,19 @@ func (clvc ConstantVUsConfig) HasWork(et *lib.ExecutionTuple) bool {
 	return clvc.GetVUs(et) > 0
 }
 
+// GetResumedConfig returns the config for the rest of the duration, or nil if
+// the scenario was already over.
+func (clvc ConstantVUsConfig) GetResumedConfig(elapsed time.Duration, _ uint64) lib.ExecutorConfig {
+	var offset time.Duration
+	clvc.BaseConfig, offset = clvc.BaseConfig.getResumed(elapsed)
+	left := time.Duration(clvc.Duration.Duration) - offset
+	if left <= 0 {
+		return nil
+	}
+	clvc.Duration = types.NullDurationFrom(left)
+	return clvc
+}
+
 // NewExecutor creates a new ConstantVUs executor
 func (clvc ConstantVUsConfig) NewExecutor(es *lib.ExecutionState, logger *logrus.Entry) (lib.Executor, error) {
 	return ConstantVUs{
@@ -167,14 +182,14 @@ func (clv ConstantVUs) Run(parentCtx context.Context, out chan<- stats.SampleCon
 		return float64(spent) / float64(duration), right
 	}
 	clv.progress.Modify(pb.WithProgress(progressFn))
-	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, clv, progressFn)
+	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, clv, progressFn, clv.iterations)
 
 	// Actually schedule the VUs and iterations...
 	activeVUs := &sync.WaitGroup{}
 	defer activeVUs.Wait()
 
 	regDurationDone := regDurationCtx.Done()
-	runIteration := getIterationRunner(clv.executionState, clv.logger)
+	runIteration := clv.getIterationRunner(parentCtx, out)
 
 	activationParams := getVUActivationParams(maxDurationCtx, clv.config.BaseConfig,
 		func(u lib.InitializedVU) {
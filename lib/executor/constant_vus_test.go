@@ -32,6 +32,7 @@ import (
 
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
 )
 
 func getTestConstantVUsConfig() ConstantVUsConfig {
@@ -64,7 +65,8 @@ func TestConstantVUsRun(t *testing.T) {
 		}),
 	)
 	defer cancel()
-	err = executor.Run(ctx, nil)
+	engineOut := make(chan stats.SampleContainer, 1000)
+	err = executor.Run(ctx, engineOut)
 	require.NoError(t, err)
 
 	var totalIters uint64
@@ -76,3 +78,38 @@ func TestConstantVUsRun(t *testing.T) {
 	})
 	assert.Equal(t, uint64(50), totalIters)
 }
+
+func TestConstantVUsRunPaused(t *testing.T) {
+	t.Parallel()
+	var firstIteration sync.Once
+	var firstIterationTime time.Time
+	et, err := lib.NewExecutionTuple(nil, nil)
+	require.NoError(t, err)
+	es := lib.NewExecutionState(lib.Options{}, et, 10, 50)
+	ctx, cancel, executor, _ := setupExecutor(
+		t, getTestConstantVUsConfig(), es,
+		simpleRunner(func(ctx context.Context) error {
+			firstIteration.Do(func() { firstIterationTime = time.Now() })
+			time.Sleep(10 * time.Millisecond)
+			return nil
+		}),
+	)
+	defer cancel()
+
+	pausable, ok := executor.(lib.ScenarioPausableExecutor)
+	require.True(t, ok)
+	require.Error(t, pausable.SetScenarioPaused(false))
+	require.NoError(t, pausable.SetScenarioPaused(true))
+	require.Error(t, pausable.SetScenarioPaused(true))
+	assert.True(t, pausable.IsScenarioPaused())
+
+	startTime := time.Now()
+	time.AfterFunc(500*time.Millisecond, func() { assert.NoError(t, pausable.SetScenarioPaused(false)) })
+	engineOut := make(chan stats.SampleContainer, 1000)
+	require.NoError(t, executor.Run(ctx, engineOut))
+
+	assert.False(t, pausable.IsScenarioPaused())
+	require.False(t, firstIterationTime.IsZero())
+	assert.True(t, firstIterationTime.Sub(startTime) >= 500*time.Millisecond,
+		"an iteration was started while the scenario was paused")
+}
@@ -0,0 +1,158 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronField describes the allowed values of a single cron expression field.
+type cronField struct {
+	name     string
+	min, max int
+}
+
+//nolint:gochecknoglobals
+var cronFields = [...]cronField{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7}, // both 0 and 7 are Sunday
+}
+
+// cronSchedule is a parsed standard 5-field cron expression. Every field is
+// stored as a bitset of the values it matches.
+type cronSchedule struct {
+	minutes, hours, days, months, weekdays uint64
+	// If both the day of month and the day of week are restricted, a day
+	// matches if either of them matches, like in the classic cron.
+	anyDay, anyWeekday bool
+}
+
+// parseCron parses a cron expression with the minute, hour, day of month,
+// month and day of week fields. Each field can be a `*`, a single value, a
+// range like `1-5`, or a comma-separated list of those, and each of them can
+// have a `/step` suffix - `5/15` is the same as `5-59/15` for minutes.
+func parseCron(expr string) (*cronSchedule, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("the cron expression '%s' should have %d fields, but it has %d",
+			expr, len(cronFields), len(parts))
+	}
+
+	var bits [len(cronFields)]uint64
+	for i, part := range parts {
+		var err error
+		if bits[i], err = parseCronField(part, cronFields[i]); err != nil {
+			return nil, fmt.Errorf("invalid cron expression '%s': %w", expr, err)
+		}
+	}
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1 // normalize Sunday to 0, like time.Weekday
+	}
+
+	return &cronSchedule{
+		minutes: bits[0], hours: bits[1], days: bits[2], months: bits[3], weekdays: bits[4],
+		anyDay: parts[2] == "*", anyWeekday: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(value string, field cronField) (bits uint64, err error) {
+	for _, item := range strings.Split(value, ",") {
+		rangeStr, step := item, 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			rangeStr = item[:i]
+			if step, err = strconv.Atoi(item[i+1:]); err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in the %s field '%s'", field.name, item)
+			}
+		}
+
+		from, to := field.min, field.max
+		switch {
+		case rangeStr == "*":
+		case strings.Contains(rangeStr, "-"):
+			bounds := strings.SplitN(rangeStr, "-", 2)
+			if from, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid range in the %s field '%s'", field.name, item)
+			}
+			if to, err = strconv.Atoi(bounds[1]); err != nil {
+				return 0, fmt.Errorf("invalid range in the %s field '%s'", field.name, item)
+			}
+		default:
+			if from, err = strconv.Atoi(rangeStr); err != nil {
+				return 0, fmt.Errorf("invalid value in the %s field '%s'", field.name, item)
+			}
+			if rangeStr == item {
+				to = from
+			}
+		}
+		if from < field.min || to > field.max || from > to {
+			return 0, fmt.Errorf("the %s field '%s' should be between %d and %d",
+				field.name, item, field.min, field.max)
+		}
+
+		for v := from; v <= to; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (cs *cronSchedule) matchesDay(t time.Time) bool {
+	dayMatches := cs.days&(1<<uint(t.Day())) != 0
+	weekdayMatches := cs.weekdays&(1<<uint(t.Weekday())) != 0
+	if cs.anyDay || cs.anyWeekday {
+		return dayMatches && weekdayMatches
+	}
+	return dayMatches || weekdayMatches
+}
+
+// next returns the first time matching the schedule that isn't before t, in
+// the time zone of t. It returns the zero time if there is no such time in the
+// next few years, e.g. for `0 0 30 2 *`.
+func (cs *cronSchedule) next(t time.Time) time.Time {
+	if truncated := t.Truncate(time.Minute); truncated.Before(t) {
+		t = truncated.Add(time.Minute)
+	} else {
+		t = truncated
+	}
+
+	yearLimit := t.Year() + 5
+	for t.Year() <= yearLimit {
+		switch {
+		case cs.months&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !cs.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case cs.hours&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case cs.minutes&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
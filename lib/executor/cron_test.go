@@ -0,0 +1,109 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib/types"
+)
+
+func TestParseCron(t *testing.T) {
+	t.Parallel()
+
+	invalid := []string{
+		"", "* * * *", "* * * * * *", "60 * * * *", "* 24 * * *", "* * 0 * *",
+		"* * * 13 *", "* * * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *", "1-b * * * *",
+	}
+	for _, expr := range invalid {
+		_, err := parseCron(expr)
+		assert.Error(t, err, expr)
+	}
+
+	schedule, err := parseCron("*/15 9-17 * * 1-5")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1|1<<15|1<<30|1<<45), schedule.minutes)
+	assert.Equal(t, uint64(0x3fe00), schedule.hours)
+	assert.Equal(t, uint64(0x3e), schedule.weekdays)
+
+	schedule, err = parseCron("5/20,7 0 * * 7")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(1<<5|1<<7|1<<25|1<<45), schedule.minutes)
+	assert.Equal(t, uint64(1|1<<7), schedule.weekdays)
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	t.Parallel()
+
+	date := func(month time.Month, day, hour, min int) time.Time {
+		return time.Date(2021, month, day, hour, min, 0, 0, time.UTC)
+	}
+	testCases := []struct {
+		expr     string
+		from     time.Time
+		expected time.Time
+	}{
+		{"*/15 * * * *", date(1, 1, 10, 0), date(1, 1, 10, 0)},
+		{"*/15 * * * *", date(1, 1, 10, 0).Add(time.Second), date(1, 1, 10, 15)},
+		{"*/15 * * * *", date(1, 1, 23, 50), date(1, 2, 0, 0)},
+		{"30 9 * * 1-5", date(1, 1, 10, 0), date(1, 4, 9, 30)}, // Jan 1st 2021 is a Friday
+		{"0 0 1 * *", date(1, 15, 0, 0), date(2, 1, 0, 0)},
+		{"0 12 13 * 5", date(1, 2, 0, 0), date(1, 8, 12, 0)}, // either the 13th or a Friday
+		{"0 0 29 2 *", date(1, 1, 0, 0), time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", date(1, 1, 0, 0), time.Time{}},
+	}
+	for _, tc := range testCases {
+		schedule, err := parseCron(tc.expr)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, schedule.next(tc.from), tc.expr)
+	}
+}
+
+func TestBaseConfigGetStartTimes(t *testing.T) {
+	t.Parallel()
+
+	testStart := time.Date(2021, 1, 1, 10, 7, 0, 0, time.UTC)
+
+	config := NewBaseConfig("test", "constant-vus")
+	config.StartTime = types.NullDurationFrom(time.Minute)
+	assert.Equal(t, []time.Duration{time.Minute}, config.GetStartTimes(testStart))
+
+	config.StartCron = null.StringFrom("*/15 * * * *")
+	config.Occurrences = null.IntFrom(3)
+	assert.Empty(t, config.Validate())
+	assert.Equal(t,
+		[]time.Duration{8 * time.Minute, 23 * time.Minute, 38 * time.Minute},
+		config.GetStartTimes(testStart),
+	)
+
+	config.StartCron = null.NewString("", false)
+	config.Occurrences = null.NewInt(0, false)
+	config.StartAt = []time.Time{
+		testStart.Add(time.Hour), testStart.Add(-time.Hour), testStart.Add(30 * time.Second), testStart.Add(2 * time.Minute),
+	}
+	assert.Empty(t, config.Validate())
+	assert.Equal(t, []time.Duration{2 * time.Minute, time.Hour}, config.GetStartTimes(testStart))
+}
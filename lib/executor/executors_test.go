@@ -119,6 +119,30 @@ var configMapTestCases = []configMapTestCase{
 	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "startTime": "-10s"}}`, exp{validationError: true}},
 	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "exec": ""}}`, exp{validationError: true}},
 	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "gracefulStop": "-2s"}}`, exp{validationError: true}},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "retries": 10}}`, exp{}},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "retries": 11}}`, exp{validationError: true}},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "startCron": "*/15 * * * *", "occurrences": 4}}`,
+		exp{custom: func(t *testing.T, cm lib.ScenarioConfigs) {
+			assert.Empty(t, cm.Validate())
+			et, err := lib.NewExecutionTuple(nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "10 looping VUs for 10s (startCron: */15 * * * * x4, gracefulStop: 30s)", cm["aname"].GetDescription(et))
+			assert.Len(t, cm["aname"].GetStartTimes(time.Now()), 4)
+		}},
+	},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "startCron": "*/15 * * * *"}}`, exp{validationError: true}},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "startCron": "*/15 * * *", "occurrences": 4}}`, exp{validationError: true}},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "startCron": "* * * * *", "occurrences": 0}}`, exp{validationError: true}},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "occurrences": 2}}`, exp{validationError: true}},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "startAt": ["2021-03-01T10:00:00Z", "2021-03-01T11:00:00Z"]}}`,
+		exp{custom: func(t *testing.T, cm lib.ScenarioConfigs) {
+			startAt := time.Date(2021, 3, 1, 10, 0, 0, 0, time.UTC)
+			assert.Equal(t, []time.Duration{0, time.Hour}, cm["aname"].GetStartTimes(startAt))
+		}},
+	},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "startAt": ["10:00"]}}`, exp{parseError: true}},
+	{`{"aname": {"executor": "constant-vus", "vus": 10, "duration": "10s", "startAt": ["2021-03-01T10:00:00Z"], "startCron": "* * * * *", "occurrences": 1}}`, exp{validationError: true}},
+	{`{"aname": {"executor": "externally-controlled", "vus": 10, "duration": "10s", "startAt": ["2021-03-01T10:00:00Z"]}}`, exp{validationError: true}},
 	// ramping-vus
 	{`{"varloops": {"executor": "ramping-vus", "startVUs": 20, "gracefulStop": "15s", "gracefulRampDown": "10s",
 		    "startTime": "23s", "stages": [{"duration": "60s", "target": 30}, {"duration": "130s", "target": 10}]}}`,
@@ -410,6 +434,83 @@ var configMapTestCases = []configMapTestCase{
 	{`{"varrival": {"executor": "ramping-arrival-rate", "preAllocatedVUs": 20, "maxVUs": 50, "stages": []}}`, exp{validationError: true}},
 	{`{"varrival": {"executor": "ramping-arrival-rate", "preAllocatedVUs": 20, "maxVUs": 50, "stages": [{"duration": "5m", "target": 10}], "timeUnit": "-1s"}}`, exp{validationError: true}},
 	{`{"varrival": {"executor": "ramping-arrival-rate", "preAllocatedVUs": 30, "maxVUs": 20, "stages": [{"duration": "5m", "target": 10}]}}`, exp{validationError: true}},
+	{`{"varrival": {"executor": "ramping-arrival-rate", "preAllocatedVUs": 20, "stages": [{"duration": "1h", "target": 50,
+		"waveform": {"type": "sine", "period": "10m", "amplitude": 25}}]}}`,
+		exp{custom: func(t *testing.T, cm lib.ScenarioConfigs) {
+			assert.Empty(t, cm["varrival"].Validate())
+			et, err := lib.NewExecutionTuple(nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "Up to 69.00 iterations/s for 1h0m0s over 1 stages (maxVUs: 20, gracefulStop: 30s)",
+				cm["varrival"].GetDescription(et))
+		}},
+	},
+	{`{"varrival": {"executor": "ramping-arrival-rate", "preAllocatedVUs": 20, "stages": [{"duration": "1h", "target": 50,
+		"waveform": {"type": "sine", "period": "10m"}}]}}`, exp{validationError: true}},
+	// adaptive-arrival-rate
+	{`{"aarrival": {"executor": "adaptive-arrival-rate", "minRate": 10, "maxRate": 500, "duration": "10m",
+		"targetLatency": "300ms", "targetErrorRate": 0.01, "preAllocatedVUs": 20, "maxVUs": 100}}`,
+		exp{custom: func(t *testing.T, cm lib.ScenarioConfigs) {
+			sched := NewAdaptiveArrivalRateConfig("aarrival")
+			sched.MinRate = null.IntFrom(10)
+			sched.MaxRate = null.IntFrom(500)
+			sched.Duration = types.NullDurationFrom(10 * time.Minute)
+			sched.TargetLatency = types.NullDurationFrom(300 * time.Millisecond)
+			sched.TargetErrorRate = null.FloatFrom(0.01)
+			sched.PreAllocatedVUs = null.IntFrom(20)
+			sched.MaxVUs = null.IntFrom(100)
+			require.Equal(t, cm, lib.ScenarioConfigs{"aarrival": sched})
+
+			assert.Empty(t, cm["aarrival"].Validate())
+			assert.Empty(t, cm.Validate())
+
+			et, err := lib.NewExecutionTuple(nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "10.00-500.00 iterations/s for 10m0s, adjusted to p(95)<=300ms, error rate<=0.01 "+
+				"(maxVUs: 20-100, gracefulStop: 30s)", cm["aarrival"].GetDescription(et))
+
+			schedReqs := cm["aarrival"].GetExecutionRequirements(et)
+			endOffset, isFinal := lib.GetEndOffset(schedReqs)
+			assert.Equal(t, 630*time.Second, endOffset)
+			assert.Equal(t, true, isFinal)
+			assert.Equal(t, uint64(20), lib.GetMaxPlannedVUs(schedReqs))
+			assert.Equal(t, uint64(100), lib.GetMaxPossibleVUs(schedReqs))
+		}},
+	},
+	{`{"aarrival": {"executor": "adaptive-arrival-rate", "maxRate": 50, "duration": "10m", "targetErrorRate": 0.1, "preAllocatedVUs": 20}}`, exp{}},
+	{`{"aarrival": {"executor": "adaptive-arrival-rate", "duration": "10m", "targetErrorRate": 0.1, "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	{`{"aarrival": {"executor": "adaptive-arrival-rate", "maxRate": 50, "duration": "10m", "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	{`{"aarrival": {"executor": "adaptive-arrival-rate", "minRate": 60, "maxRate": 50, "duration": "10m", "targetErrorRate": 0.1, "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	{`{"aarrival": {"executor": "adaptive-arrival-rate", "startRate": 60, "maxRate": 50, "duration": "10m", "targetErrorRate": 0.1, "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	{`{"aarrival": {"executor": "adaptive-arrival-rate", "maxRate": 50, "duration": "10m", "targetErrorRate": 1.5, "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	{`{"aarrival": {"executor": "adaptive-arrival-rate", "maxRate": 50, "duration": "10m", "targetLatency": "1s", "latencyPercentile": 0, "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	{`{"aarrival": {"executor": "adaptive-arrival-rate", "maxRate": 50, "duration": "10m", "targetLatency": "1s", "adjustmentInterval": "11m", "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	// externally-driven-arrival-rate
+	{`{"driven": {"executor": "externally-driven-arrival-rate", "maxRate": 200, "duration": "1h",
+		"rateURL": "https://example.com/rps", "preAllocatedVUs": 20, "maxVUs": 50}}`,
+		exp{custom: func(t *testing.T, cm lib.ScenarioConfigs) {
+			sched := NewExternallyDrivenArrivalRateConfig("driven")
+			sched.MaxRate = null.IntFrom(200)
+			sched.Duration = types.NullDurationFrom(time.Hour)
+			sched.RateURL = null.StringFrom("https://example.com/rps")
+			sched.PreAllocatedVUs = null.IntFrom(20)
+			sched.MaxVUs = null.IntFrom(50)
+			require.Equal(t, cm, lib.ScenarioConfigs{"driven": sched})
+
+			assert.Empty(t, cm["driven"].Validate())
+			assert.Empty(t, cm.Validate())
+
+			et, err := lib.NewExecutionTuple(nil, nil)
+			require.NoError(t, err)
+			assert.Equal(t, "Up to 200.00 iterations/s for 1h0m0s, driven by https://example.com/rps "+
+				"(maxVUs: 20-50, gracefulStop: 30s)", cm["driven"].GetDescription(et))
+		}},
+	},
+	{`{"driven": {"executor": "externally-driven-arrival-rate", "rate": 10, "maxRate": 200, "duration": "1h", "preAllocatedVUs": 20}}`, exp{}},
+	{`{"driven": {"executor": "externally-driven-arrival-rate", "duration": "1h", "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	{`{"driven": {"executor": "externally-driven-arrival-rate", "rate": 300, "maxRate": 200, "duration": "1h", "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	{`{"driven": {"executor": "externally-driven-arrival-rate", "rate": -1, "maxRate": 200, "duration": "1h", "preAllocatedVUs": 20}}`, exp{validationError: true}},
+	{`{"driven": {"executor": "externally-driven-arrival-rate", "maxRate": 200, "duration": "1h", "preAllocatedVUs": 20, "rateURL": "file:///rps"}}`, exp{validationError: true}},
+	{`{"driven": {"executor": "externally-driven-arrival-rate", "maxRate": 200, "duration": "1h", "preAllocatedVUs": 20, "pollInterval": "0s"}}`, exp{validationError: true}},
 	//TODO: more tests of mixed executors and execution plans
 }
 
@@ -439,3 +540,96 @@ func TestConfigMapParsingAndValidation(t *testing.T) {
 		})
 	}
 }
+
+func TestConfigMapUnknownKeys(t *testing.T) {
+	t.Parallel()
+	var result lib.ScenarioConfigs
+	err := json.Unmarshal([]byte(`{"foo": {"executor": "constant-vus", "gracefullStop": "1s"}}`), &result)
+	assert.EqualError(t, err,
+		"scenario 'foo' has configuration errors: unknown option 'gracefullStop', did you mean 'gracefulStop'?")
+
+	err = json.Unmarshal([]byte(`{"foo": {"executor": "ramping-vus", "stages": [{"durration": "1s"}]}}`), &result)
+	assert.EqualError(t, err,
+		"scenario 'foo' has configuration errors: unknown option 'stages[0].durration', did you mean 'duration'?")
+
+	err = lib.FindUnknownKeys([]byte(`{"vus": 1, "scenarios": {
+		"foo": {"executor": "constant-vus", "gracefullStop": "1s"},
+		"bar": {"executor": "unknown-executor", "gracefullStop": "1s"}
+	}}`), &lib.Options{})
+	assert.EqualError(t, err,
+		"unknown option 'scenarios.foo.gracefullStop', did you mean 'gracefulStop'?")
+}
+
+func TestGetResumedConfig(t *testing.T) {
+	t.Parallel()
+
+	t.Run("before start time", func(t *testing.T) {
+		t.Parallel()
+		conf := NewConstantVUsConfig("test")
+		conf.StartTime = types.NullDurationFrom(time.Minute)
+		conf.Duration = types.NullDurationFrom(time.Minute)
+		resumed := conf.GetResumedConfig(20*time.Second, 0).(ConstantVUsConfig)
+		assert.Equal(t, 40*time.Second, resumed.GetStartTime())
+		assert.Equal(t, types.NullDurationFrom(time.Minute), resumed.Duration)
+	})
+
+	t.Run("constant duration", func(t *testing.T) {
+		t.Parallel()
+		conf := NewConstantVUsConfig("test")
+		conf.StartTime = types.NullDurationFrom(10 * time.Second)
+		conf.Duration = types.NullDurationFrom(time.Minute)
+		resumed := conf.GetResumedConfig(30*time.Second, 123).(ConstantVUsConfig)
+		assert.Equal(t, time.Duration(0), resumed.GetStartTime())
+		assert.Equal(t, types.NullDurationFrom(40*time.Second), resumed.Duration)
+		assert.Nil(t, conf.GetResumedConfig(70*time.Second, 123))
+	})
+
+	t.Run("scheduled", func(t *testing.T) {
+		t.Parallel()
+		conf := NewConstantVUsConfig("test")
+		conf.StartCron = null.StringFrom("0 * * * *")
+		conf.Occurrences = null.IntFrom(3)
+		conf.Duration = types.NullDurationFrom(time.Minute)
+		resumed := conf.GetResumedConfig(90*time.Minute, 123).(ConstantVUsConfig)
+		assert.Equal(t, conf, resumed)
+	})
+
+	t.Run("shared iterations", func(t *testing.T) {
+		t.Parallel()
+		conf := NewSharedIterationsConfig("test")
+		conf.VUs = null.IntFrom(10)
+		conf.Iterations = null.IntFrom(100)
+		resumed := conf.GetResumedConfig(time.Minute, 95).(SharedIterationsConfig)
+		assert.Equal(t, null.IntFrom(5), resumed.Iterations)
+		assert.Equal(t, null.IntFrom(5), resumed.VUs)
+		assert.Equal(t, types.NullDurationFrom(9*time.Minute), resumed.MaxDuration)
+		assert.Nil(t, conf.GetResumedConfig(time.Minute, 100))
+	})
+
+	t.Run("per VU iterations", func(t *testing.T) {
+		t.Parallel()
+		conf := NewPerVUIterationsConfig("test")
+		conf.VUs = null.IntFrom(10)
+		conf.Iterations = null.IntFrom(10)
+		resumed := conf.GetResumedConfig(time.Minute, 55).(PerVUIterationsConfig)
+		assert.Equal(t, null.IntFrom(5), resumed.Iterations)
+		assert.Nil(t, conf.GetResumedConfig(11*time.Minute, 55))
+	})
+
+	t.Run("stages", func(t *testing.T) {
+		t.Parallel()
+		conf := NewRampingArrivalRateConfig("test")
+		conf.StartRate = null.IntFrom(0)
+		conf.Stages = []Stage{
+			{Duration: types.NullDurationFrom(time.Minute), Target: null.IntFrom(100)},
+			{Duration: types.NullDurationFrom(time.Minute), Target: null.IntFrom(100)},
+		}
+		resumed := conf.GetResumedConfig(30*time.Second, 0).(*RampingArrivalRateConfig)
+		assert.Equal(t, null.IntFrom(50), resumed.StartRate)
+		assert.Equal(t, []Stage{
+			{Duration: types.NullDurationFrom(30 * time.Second), Target: null.IntFrom(100)},
+			{Duration: types.NullDurationFrom(time.Minute), Target: null.IntFrom(100)},
+		}, resumed.Stages)
+		assert.Nil(t, conf.GetResumedConfig(2*time.Minute, 0))
+	})
+}
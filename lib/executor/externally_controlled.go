@@ -100,6 +100,8 @@ type ExternallyControlledConfig struct {
 // Make sure we implement the lib.ExecutorConfig interface
 var _ lib.ExecutorConfig = &ExternallyControlledConfig{}
 
+var _ lib.ResumableExecutorConfig = &ExternallyControlledConfig{}
+
 // GetDescription returns a human-readable description of the executor options
 func (mec ExternallyControlledConfig) GetDescription(_ *lib.ExecutionTuple) string {
 	duration := "infinite"
@@ -120,6 +122,11 @@ func (mec ExternallyControlledConfig) Validate() []error {
 			"gracefulStop is not supported by the externally controlled executor",
 		))
 	}
+	if mec.StartCron.Valid || len(mec.StartAt) > 0 {
+		errors = append(errors, fmt.Errorf(
+			"startCron and startAt are not supported by the externally controlled executor",
+		))
+	}
 	return errors
 }
 
@@ -184,6 +191,23 @@ func (mec ExternallyControlledConfig) HasWork(_ *lib.ExecutionTuple) bool {
 	return true
 }
 
+// GetResumedConfig returns the config for the rest of the duration, or nil if
+// the scenario was already over. Scenarios with an infinite duration are
+// always resumed as they were.
+func (mec ExternallyControlledConfig) GetResumedConfig(elapsed time.Duration, _ uint64) lib.ExecutorConfig {
+	var offset time.Duration
+	mec.BaseConfig, offset = mec.BaseConfig.getResumed(elapsed)
+	if mec.Duration.Duration == 0 {
+		return mec
+	}
+	left := time.Duration(mec.Duration.Duration) - offset
+	if left <= 0 {
+		return nil
+	}
+	mec.Duration = types.NullDurationFrom(left)
+	return mec
+}
+
 type pauseEvent struct {
 	isPaused bool
 	err      chan error
@@ -529,7 +553,7 @@ func (mex *ExternallyControlled) Run(parentCtx context.Context, out chan<- stats
 		currentlyPaused: false,
 		activeVUsCount:  new(int64),
 		maxVUs:          new(int64),
-		runIteration:    getIterationRunner(mex.executionState, mex.logger),
+		runIteration:    mex.getIterationRunner(parentCtx, out),
 	}
 	*runState.maxVUs = startMaxVUs
 	if err = runState.retrieveStartMaxVUs(); err != nil {
@@ -537,7 +561,7 @@ func (mex *ExternallyControlled) Run(parentCtx context.Context, out chan<- stats
 	}
 
 	mex.progress.Modify(pb.WithProgress(runState.progressFn)) // Keep track of the progress
-	go trackProgress(parentCtx, ctx, ctx, mex, runState.progressFn)
+	go trackProgress(parentCtx, ctx, ctx, mex, runState.progressFn, mex.iterations)
 
 	err = runState.handleConfigChange( // Start by setting MaxVUs to the starting MaxVUs
 		ExternallyControlledConfigParams{MaxVUs: mex.config.MaxVUs}, currentControlConfig,
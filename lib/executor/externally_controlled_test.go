@@ -33,6 +33,7 @@ import (
 
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
 )
 
 func getTestExternallyControlledConfig() ExternallyControlledConfig {
@@ -69,10 +70,11 @@ func TestExternallyControlledRun(t *testing.T) {
 		doneCh = make(chan struct{})
 	)
 	wg.Add(1)
+	engineOut := make(chan stats.SampleContainer, 1000)
 	go func() {
 		defer wg.Done()
 		es.MarkStarted()
-		errCh <- executor.Run(ctx, nil)
+		errCh <- executor.Run(ctx, engineOut)
 		es.MarkEnded()
 		close(doneCh)
 	}()
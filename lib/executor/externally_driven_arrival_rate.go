@@ -0,0 +1,418 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/loadimpact/k6/ui/pb"
+)
+
+const externallyDrivenArrivalRateType = "externally-driven-arrival-rate"
+
+func init() {
+	lib.RegisterExecutorConfigType(
+		externallyDrivenArrivalRateType,
+		func(name string, rawJSON []byte) (lib.ExecutorConfig, error) {
+			config := NewExternallyDrivenArrivalRateConfig(name)
+			err := lib.StrictJSONUnmarshal(rawJSON, &config)
+			return config, err
+		},
+	)
+}
+
+// ExternallyDrivenArrivalRateConfig stores config for the externally-driven
+// arrival-rate executor
+type ExternallyDrivenArrivalRateConfig struct {
+	BaseConfig
+	// The rate until the first external update, which can be 0
+	Rate     null.Int           `json:"rate"`
+	MaxRate  null.Int           `json:"maxRate"`
+	TimeUnit types.NullDuration `json:"timeUnit"`
+	Duration types.NullDuration `json:"duration"`
+
+	// An optional URL that is polled for the rate every PollInterval. Its
+	// response should be a JSON number or an object with a `rate` key. The
+	// rate can also be changed through the REST API.
+	RateURL      null.String        `json:"rateURL"`
+	PollInterval types.NullDuration `json:"pollInterval"`
+
+	// Initialize `PreAllocatedVUs` number of VUs, and if more than that are needed,
+	// they will be dynamically allocated, until `MaxVUs` is reached, which is an
+	// absolutely hard limit on the number of VUs the executor will use
+	PreAllocatedVUs null.Int `json:"preAllocatedVUs"`
+	MaxVUs          null.Int `json:"maxVUs"`
+}
+
+// NewExternallyDrivenArrivalRateConfig returns an ExternallyDrivenArrivalRateConfig with default values
+func NewExternallyDrivenArrivalRateConfig(name string) *ExternallyDrivenArrivalRateConfig {
+	return &ExternallyDrivenArrivalRateConfig{
+		BaseConfig:   NewBaseConfig(name, externallyDrivenArrivalRateType),
+		TimeUnit:     types.NewNullDuration(1*time.Second, false),
+		PollInterval: types.NewNullDuration(5*time.Second, false),
+	}
+}
+
+// Make sure we implement the lib.ExecutorConfig interface
+var _ lib.ExecutorConfig = &ExternallyDrivenArrivalRateConfig{}
+
+var _ lib.ResumableExecutorConfig = &ExternallyDrivenArrivalRateConfig{}
+
+// GetPreAllocatedVUs is just a helper method that returns the scaled pre-allocated VUs.
+func (edarc ExternallyDrivenArrivalRateConfig) GetPreAllocatedVUs(et *lib.ExecutionTuple) int64 {
+	return et.ScaleInt64(edarc.PreAllocatedVUs.Int64)
+}
+
+// GetMaxVUs is just a helper method that returns the scaled max VUs.
+func (edarc ExternallyDrivenArrivalRateConfig) GetMaxVUs(et *lib.ExecutionTuple) int64 {
+	return et.ScaleInt64(edarc.MaxVUs.Int64)
+}
+
+// GetDescription returns a human-readable description of the executor options
+func (edarc ExternallyDrivenArrivalRateConfig) GetDescription(et *lib.ExecutionTuple) string {
+	preAllocatedVUs, maxVUs := edarc.GetPreAllocatedVUs(et), edarc.GetMaxVUs(et)
+	maxVUsRange := fmt.Sprintf("maxVUs: %d", preAllocatedVUs)
+	if maxVUs > preAllocatedVUs {
+		maxVUsRange += fmt.Sprintf("-%d", maxVUs)
+	}
+
+	source := "the REST API"
+	if edarc.RateURL.Valid {
+		source = edarc.RateURL.String
+	}
+	perSec := et.Segment.FloatLength() * float64(time.Second) / float64(edarc.TimeUnit.Duration)
+	return fmt.Sprintf("Up to %.2f iterations/s for %s, driven by %s%s",
+		float64(edarc.MaxRate.Int64)*perSec, edarc.Duration.Duration, source, edarc.getBaseInfo(maxVUsRange))
+}
+
+// Validate makes sure all options are configured and valid
+func (edarc *ExternallyDrivenArrivalRateConfig) Validate() []error {
+	errors := edarc.BaseConfig.Validate()
+	if !edarc.MaxRate.Valid {
+		errors = append(errors, fmt.Errorf("the maxRate isn't specified"))
+	} else if edarc.MaxRate.Int64 <= 0 {
+		errors = append(errors, fmt.Errorf("the maxRate should be more than 0"))
+	}
+	if edarc.Rate.Int64 < 0 {
+		errors = append(errors, fmt.Errorf("the iteration rate shouldn't be negative"))
+	} else if edarc.Rate.Int64 > edarc.MaxRate.Int64 {
+		errors = append(errors, fmt.Errorf("the iteration rate shouldn't be more than the maxRate"))
+	}
+
+	if time.Duration(edarc.TimeUnit.Duration) <= 0 {
+		errors = append(errors, fmt.Errorf("the timeUnit should be more than 0"))
+	}
+
+	if !edarc.Duration.Valid {
+		errors = append(errors, fmt.Errorf("the duration is unspecified"))
+	} else if time.Duration(edarc.Duration.Duration) < minDuration {
+		errors = append(errors, fmt.Errorf(
+			"the duration should be at least %s, but is %s", minDuration, edarc.Duration,
+		))
+	}
+
+	if edarc.RateURL.Valid {
+		if u, err := url.Parse(edarc.RateURL.String); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			errors = append(errors, fmt.Errorf("the rateURL should be an http or https URL"))
+		}
+	}
+	if edarc.PollInterval.Duration <= 0 {
+		errors = append(errors, fmt.Errorf("the pollInterval should be more than 0"))
+	}
+
+	if !edarc.PreAllocatedVUs.Valid {
+		errors = append(errors, fmt.Errorf("the number of preAllocatedVUs isn't specified"))
+	} else if edarc.PreAllocatedVUs.Int64 < 0 {
+		errors = append(errors, fmt.Errorf("the number of preAllocatedVUs shouldn't be negative"))
+	}
+
+	if !edarc.MaxVUs.Valid {
+		// TODO: don't change the config while validating
+		edarc.MaxVUs.Int64 = edarc.PreAllocatedVUs.Int64
+	} else if edarc.MaxVUs.Int64 < edarc.PreAllocatedVUs.Int64 {
+		errors = append(errors, fmt.Errorf("maxVUs shouldn't be less than preAllocatedVUs"))
+	}
+
+	return errors
+}
+
+// GetExecutionRequirements returns the number of required VUs to run the
+// executor for its whole duration (disregarding any startTime), including the
+// maximum waiting time for any iterations to gracefully stop. This is used by
+// the execution scheduler in its VU reservation calculations, so it knows how
+// many VUs to pre-initialize.
+func (edarc ExternallyDrivenArrivalRateConfig) GetExecutionRequirements(et *lib.ExecutionTuple) []lib.ExecutionStep {
+	return []lib.ExecutionStep{
+		{
+			TimeOffset:      0,
+			PlannedVUs:      uint64(et.ScaleInt64(edarc.PreAllocatedVUs.Int64)),
+			MaxUnplannedVUs: uint64(et.ScaleInt64(edarc.MaxVUs.Int64) - et.ScaleInt64(edarc.PreAllocatedVUs.Int64)),
+		}, {
+			TimeOffset:      time.Duration(edarc.Duration.Duration + edarc.GracefulStop.Duration),
+			PlannedVUs:      0,
+			MaxUnplannedVUs: 0,
+		},
+	}
+}
+
+// NewExecutor creates a new ExternallyDrivenArrivalRate executor
+func (edarc ExternallyDrivenArrivalRateConfig) NewExecutor(
+	es *lib.ExecutionState, logger *logrus.Entry,
+) (lib.Executor, error) {
+	rate := edarc.Rate.Int64
+	return &ExternallyDrivenArrivalRate{
+		BaseExecutor: NewBaseExecutor(&edarc, es, logger),
+		config:       edarc,
+		rate:         &rate,
+		rateChanged:  make(chan struct{}, 1),
+	}, nil
+}
+
+// HasWork reports whether there is any work to be done for the given execution segment.
+func (edarc ExternallyDrivenArrivalRateConfig) HasWork(et *lib.ExecutionTuple) bool {
+	return edarc.GetMaxVUs(et) > 0
+}
+
+// GetResumedConfig returns the config for the rest of the duration, or nil if
+// the scenario was already over.
+func (edarc ExternallyDrivenArrivalRateConfig) GetResumedConfig(elapsed time.Duration, _ uint64) lib.ExecutorConfig {
+	var offset time.Duration
+	edarc.BaseConfig, offset = edarc.BaseConfig.getResumed(elapsed)
+	left := time.Duration(edarc.Duration.Duration) - offset
+	if left <= 0 {
+		return nil
+	}
+	edarc.Duration = types.NullDurationFrom(left)
+	return &edarc
+}
+
+// ExternallyDrivenArrivalRate executes iterations at a rate that is changed
+// while the test is running, by polling an URL or through the REST API.
+type ExternallyDrivenArrivalRate struct {
+	*BaseExecutor
+	config ExternallyDrivenArrivalRateConfig
+	et     *lib.ExecutionTuple
+
+	// The current rate per timeUnit, not scaled by the execution segment,
+	// and a notification for the Run loop that it was changed.
+	rate        *int64
+	rateChanged chan struct{}
+}
+
+// Make sure we implement the lib.Executor interface.
+var _ lib.Executor = &ExternallyDrivenArrivalRate{}
+
+// Init values needed for the execution
+func (edar *ExternallyDrivenArrivalRate) Init(ctx context.Context) error {
+	// err should always be nil, because Init() won't be called for executors
+	// with no work, as determined by their config's HasWork() method.
+	et, err := edar.BaseExecutor.executionState.ExecutionTuple.GetNewExecutionTupleFromValue(edar.config.MaxVUs.Int64)
+	edar.et = et
+	return err
+}
+
+// GetRate returns the current rate, per timeUnit.
+func (edar ExternallyDrivenArrivalRate) GetRate() int64 {
+	return atomic.LoadInt64(edar.rate)
+}
+
+// SetRate changes the rate, per timeUnit, which takes effect immediately.
+func (edar ExternallyDrivenArrivalRate) SetRate(rate int64) error {
+	if rate < 0 || rate > edar.config.MaxRate.Int64 {
+		return fmt.Errorf("the rate should be between 0 and the maxRate of %d, but is %d", edar.config.MaxRate.Int64, rate)
+	}
+	if atomic.SwapInt64(edar.rate, rate) != rate {
+		select {
+		case edar.rateChanged <- struct{}{}:
+		default: // the Run loop already has a pending notification
+		}
+	}
+	return nil
+}
+
+// parseRate returns the rate in a response of the rate URL.
+func parseRate(body []byte) (int64, error) {
+	var value interface{}
+	if err := json.Unmarshal(body, &value); err != nil {
+		return 0, err
+	}
+	if obj, ok := value.(map[string]interface{}); ok {
+		value = obj["rate"]
+	}
+	rate, ok := value.(float64)
+	if !ok {
+		return 0, fmt.Errorf("expected a number or an object with a numeric rate, but got %s", body)
+	}
+	return int64(math.Round(rate)), nil
+}
+
+// pollRate gets the rate from the rate URL and sets it. Rates above the
+// maxRate are capped.
+func (edar ExternallyDrivenArrivalRate) pollRate(ctx context.Context, client *http.Client) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, edar.config.RateURL.String, nil)
+	if err != nil {
+		return err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = res.Body.Close() }()
+	body, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response status %d", res.StatusCode)
+	}
+	rate, err := parseRate(body)
+	if err != nil {
+		return err
+	}
+	if rate > edar.config.MaxRate.Int64 {
+		edar.logger.Warnf("The polled rate %d is capped to the maxRate of %d", rate, edar.config.MaxRate.Int64)
+		rate = edar.config.MaxRate.Int64
+	}
+	return edar.SetRate(rate)
+}
+
+// Run executes iterations at the current rate, until the end of the duration.
+//nolint:funlen,gocognit
+func (edar ExternallyDrivenArrivalRate) Run(parentCtx context.Context, out chan<- stats.SampleContainer) (err error) {
+	gracefulStop := edar.config.GetGracefulStop()
+	duration := time.Duration(edar.config.Duration.Duration)
+	preAllocatedVUs := edar.config.GetPreAllocatedVUs(edar.executionState.ExecutionTuple)
+	maxVUs := edar.config.GetMaxVUs(edar.executionState.ExecutionTuple)
+	timeUnit := time.Duration(edar.config.TimeUnit.Duration)
+	segmentLength := edar.et.Segment.FloatLength()
+	perSec := segmentLength * float64(time.Second) / float64(timeUnit)
+
+	edar.logger.WithFields(logrus.Fields{
+		"maxVUs": maxVUs, "preAllocatedVUs": preAllocatedVUs, "duration": duration,
+		"rateURL": edar.config.RateURL.String, "type": edar.config.GetType(),
+	}).Debug("Starting executor run...")
+
+	startTime, maxDurationCtx, regDurationCtx, cancel := getDurationContexts(parentCtx, duration, gracefulStop)
+	vus, err := newArrivalRateVUs(
+		parentCtx, maxDurationCtx, out, edar.BaseExecutor, edar.config.BaseConfig, preAllocatedVUs, maxVUs)
+	defer vus.stop(cancel)
+	if err != nil {
+		return err
+	}
+
+	vusFmt := pb.GetFixedLengthIntFormat(maxVUs)
+	itersFmt := pb.GetFixedLengthFloatFormat(float64(edar.config.MaxRate.Int64)*perSec, 0) + " iters/s"
+	progressFn := func() (float64, []string) {
+		spent := time.Since(startTime)
+		busyVUs, activeVUs := vus.counts()
+		progVUs := fmt.Sprintf(vusFmt+"/"+vusFmt+" VUs", busyVUs, activeVUs)
+		progIters := fmt.Sprintf(itersFmt, float64(edar.GetRate())*perSec)
+
+		right := []string{progVUs, duration.String(), progIters}
+
+		if spent > duration {
+			return 1, right
+		}
+
+		spentDuration := pb.GetFixedLengthDuration(spent, duration)
+		progDur := fmt.Sprintf("%s/%s", spentDuration, duration)
+		right[1] = progDur
+
+		return math.Min(1, float64(spent)/float64(duration)), right
+	}
+	edar.progress.Modify(pb.WithProgress(progressFn))
+	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, &edar, progressFn, edar.iterations)
+
+	if edar.config.RateURL.Valid {
+		pollerDone := make(chan struct{})
+		defer func() { <-pollerDone }()
+		go func() {
+			defer close(pollerDone)
+			pollInterval := time.Duration(edar.config.PollInterval.Duration)
+			client := &http.Client{Timeout: pollInterval}
+			ticker := time.NewTicker(pollInterval)
+			defer ticker.Stop()
+			for {
+				if err := edar.pollRate(regDurationCtx, client); err != nil && regDurationCtx.Err() == nil {
+					edar.logger.WithError(err).Warn("Couldn't get the iteration rate, keeping the current one")
+				}
+				select {
+				case <-ticker.C:
+				case <-regDurationCtx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	timer := time.NewTimer(time.Hour * 24)
+	var last time.Time // when the previous iteration was started, if there was one
+	for {
+		rate := edar.GetRate()
+		if rate == 0 {
+			// Wait for a rate, and start the first iteration immediately after
+			last = time.Time{}
+			select {
+			case <-edar.rateChanged:
+				continue
+			case <-regDurationCtx.Done():
+				return nil
+			}
+		}
+
+		next := time.Now()
+		if !last.IsZero() {
+			next = last.Add(time.Duration(float64(timeUnit) / (float64(rate) * segmentLength)))
+		}
+		timer.Reset(time.Until(next))
+		select {
+		case <-edar.rateChanged:
+			// The next iteration is rescheduled with the new rate
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
+				}
+			}
+			continue
+		case <-timer.C:
+			last = next
+			vus.startIteration()
+
+		case <-regDurationCtx.Done():
+			return nil
+		}
+	}
+}
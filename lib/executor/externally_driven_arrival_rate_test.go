@@ -0,0 +1,150 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+func getTestExternallyDrivenArrivalRateConfig() *ExternallyDrivenArrivalRateConfig {
+	config := NewExternallyDrivenArrivalRateConfig("driven")
+	config.GracefulStop = types.NullDurationFrom(0)
+	config.MaxRate = null.IntFrom(100)
+	config.Duration = types.NullDurationFrom(2 * time.Second)
+	config.PreAllocatedVUs = null.IntFrom(10)
+	config.MaxVUs = null.IntFrom(10)
+	return config
+}
+
+func TestParseRate(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		rate int64
+		err  bool
+	}{
+		`42`:             {rate: 42},
+		`41.6`:           {rate: 42},
+		`{"rate": 10}`:   {rate: 10},
+		`{"rate": "10"}`: {err: true},
+		`{"rps": 10}`:    {err: true},
+		`"10"`:           {err: true},
+		`ten`:            {err: true},
+	}
+	for body, tc := range testCases {
+		body, tc := body, tc
+		t.Run(body, func(t *testing.T) {
+			t.Parallel()
+			rate, err := parseRate([]byte(body))
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.rate, rate)
+		})
+	}
+}
+
+func TestExternallyDrivenArrivalRateSetRate(t *testing.T) {
+	t.Parallel()
+	et, err := lib.NewExecutionTuple(nil, nil)
+	require.NoError(t, err)
+	es := lib.NewExecutionState(lib.Options{}, et, 10, 10)
+	config := getTestExternallyDrivenArrivalRateConfig()
+	config.Rate = null.IntFrom(0)
+	require.Empty(t, config.Validate())
+
+	var count int64
+	ctx, cancel, executor, _ := setupExecutor(
+		t, config, es,
+		simpleRunner(func(ctx context.Context) error {
+			atomic.AddInt64(&count, 1)
+			return nil
+		}),
+	)
+	defer cancel()
+	edar := executor.(*ExternallyDrivenArrivalRate)
+	assert.Error(t, edar.SetRate(-1))
+	assert.Error(t, edar.SetRate(101))
+
+	go func() {
+		// Nothing runs until there is a rate
+		time.Sleep(time.Second)
+		assert.Equal(t, int64(0), atomic.LoadInt64(&count))
+		assert.NoError(t, edar.SetRate(50))
+	}()
+	engineOut := make(chan stats.SampleContainer, 1000)
+	require.NoError(t, executor.Run(ctx, engineOut))
+	assert.Equal(t, int64(50), edar.GetRate())
+	assert.InDelta(t, 50, atomic.LoadInt64(&count), 3)
+}
+
+func TestExternallyDrivenArrivalRatePolling(t *testing.T) {
+	t.Parallel()
+	var polls int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The rate is capped to the maxRate of 100
+		_, _ = fmt.Fprintf(w, `{"rate": %d}`, 25+atomic.AddInt64(&polls, 1)*1000)
+	}))
+	defer srv.Close()
+
+	et, err := lib.NewExecutionTuple(nil, nil)
+	require.NoError(t, err)
+	es := lib.NewExecutionState(lib.Options{}, et, 10, 10)
+	config := getTestExternallyDrivenArrivalRateConfig()
+	config.Rate = null.IntFrom(10)
+	config.RateURL = null.StringFrom(srv.URL)
+	config.PollInterval = types.NullDurationFrom(500 * time.Millisecond)
+	require.Empty(t, config.Validate())
+
+	var count int64
+	ctx, cancel, executor, logHook := setupExecutor(
+		t, config, es,
+		simpleRunner(func(ctx context.Context) error {
+			atomic.AddInt64(&count, 1)
+			return nil
+		}),
+	)
+	defer cancel()
+	engineOut := make(chan stats.SampleContainer, 1000)
+	require.NoError(t, executor.Run(ctx, engineOut))
+
+	assert.InDelta(t, 4, atomic.LoadInt64(&polls), 1)
+	assert.Equal(t, int64(100), executor.(*ExternallyDrivenArrivalRate).GetRate())
+	assert.InDelta(t, 200, atomic.LoadInt64(&count), 5)
+	entries := logHook.Drain()
+	require.NotEmpty(t, entries)
+	assert.Equal(t, "The polled rate 1025 is capped to the maxRate of 100", entries[0].Message)
+}
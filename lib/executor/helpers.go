@@ -24,12 +24,16 @@ import (
 	"context"
 	"fmt"
 	"math/big"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/sirupsen/logrus"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/ui/pb"
 )
 
@@ -70,20 +74,52 @@ func validateStages(stages []Stage) []error {
 		} else if s.Target.Int64 < 0 {
 			errors = append(errors, fmt.Errorf("the target for stage %d shouldn't be negative", stageNum))
 		}
+		if s.Waveform != nil {
+			for _, err := range s.Waveform.Validate(time.Duration(s.Duration.Duration)) {
+				errors = append(errors, fmt.Errorf("stage %d: %w", stageNum, err))
+			}
+		}
 	}
 	return errors
 }
 
-// getIterationRunner is a helper function that returns an iteration executor
-// closure. It takes care of updating the execution state statistics and
-// warning messages. And returns whether a full iteration was finished or not
+// getResumedStages returns the value that the given stages, starting from
+// startValue, have ramped to after the offset, and the stages that are left.
+func getResumedStages(startValue int64, stages []Stage, offset time.Duration) (int64, []Stage) {
+	value := startValue
+	for i, stage := range stages {
+		stageDuration := time.Duration(stage.Duration.Duration)
+		if offset < stageDuration {
+			value += int64(float64(stage.Target.Int64-value) * float64(offset) / float64(stageDuration))
+			left := make([]Stage, 0, len(stages)-i)
+			left = append(left, Stage{Duration: types.NullDurationFrom(stageDuration - offset), Target: stage.Target})
+			return value, append(left, stages[i+1:]...)
+		}
+		offset -= stageDuration
+		value = stage.Target.Int64
+	}
+	return value, nil
+}
+
+// getIterationRunner is a helper method that returns an iteration executor
+// closure. It takes care of waiting while the scenario is paused, updating the
+// execution state statistics, keeping track of the active iterations, emitting
+// the iterations_interrupted metric and warning messages. And returns whether
+// a full iteration was finished or not
 //
 // TODO: emit the end-of-test iteration metrics here (https://github.com/loadimpact/k6/issues/1250)
-func getIterationRunner(
-	executionState *lib.ExecutionState, logger *logrus.Entry,
+func (bs *BaseExecutor) getIterationRunner(
+	parentCtx context.Context, out chan<- stats.SampleContainer,
 ) func(context.Context, lib.ActiveVU) bool {
+	metricTags := bs.getMetricTags(nil)
 	return func(ctx context.Context, vu lib.ActiveVU) bool {
+		if !bs.waitWhilePaused(ctx) {
+			return false
+		}
+
+		iterationDone := bs.iterations.start(vu)
 		err := vu.RunOnce()
+		iterationDone()
 
 		// TODO: track (non-ramp-down) errors from script iterations as a metric,
 		// and have a default threshold that will abort the script when the error
@@ -91,23 +127,28 @@ func getIterationRunner(
 
 		select {
 		case <-ctx.Done():
-			// Don't log errors or emit iterations metrics from cancelled iterations
-			executionState.AddInterruptedIterations(1)
+			// Don't log errors or emit the regular iteration metrics from cancelled iterations
+			bs.executionState.AddInterruptedIterations(1)
+			stats.PushIfNotDone(parentCtx, out, stats.Sample{
+				Value: 1, Metric: metrics.IterationsInterrupted,
+				Tags: metricTags, Time: time.Now(),
+			})
 			return false
 		default:
 			if err != nil {
 				if s, ok := err.(fmt.Stringer); ok {
 					// TODO better detection for stack traces
 					// TODO don't count this as a full iteration?
-					logger.WithField("source", "stacktrace").Error(s.String())
+					bs.logger.WithField("source", "stacktrace").Error(s.String())
 				} else {
-					logger.Error(err.Error())
+					bs.logger.Error(err.Error())
 				}
 				// TODO: investigate context cancelled errors
 			}
 
 			// TODO: move emission of end-of-iteration metrics here?
-			executionState.AddFullIterations(1)
+			bs.executionState.AddFullIterations(1)
+			bs.executionState.AddScenarioFullIterations(bs.config.GetName(), 1)
 			return true
 		}
 	}
@@ -153,10 +194,11 @@ func getDurationContexts(parentCtx context.Context, regularDuration, gracefulSto
 }
 
 // trackProgress is a helper function that monitors certain end-events in an
-// executor and updates its progressbar accordingly.
+// executor and updates its progressbar accordingly. While the iterations are
+// gracefully stopping, it also reports how many of them are still draining.
 func trackProgress(
 	parentCtx, maxDurationCtx, regDurationCtx context.Context,
-	exec lib.Executor, snapshot func() (float64, []string),
+	exec lib.Executor, snapshot func() (float64, []string), iterations *activeIterations,
 ) {
 	progressBar := exec.GetProgress()
 	logger := exec.GetLogger()
@@ -170,8 +212,12 @@ func trackProgress(
 		)
 		progressBar.Modify(
 			pb.WithStatus(pb.Stopping),
-			pb.WithConstProgress(p, right...),
+			pb.WithProgress(func() (float64, []string) {
+				draining := fmt.Sprintf("%d draining", iterations.count())
+				return p, append(append(make([]string, 0, len(right)+1), right...), draining)
+			}),
 		)
+		go reportDraining(parentCtx, maxDurationCtx, logger, iterations)
 	}
 
 	<-maxDurationCtx.Done()
@@ -189,6 +235,39 @@ func trackProgress(
 	}
 }
 
+// reportDraining periodically logs how many iterations are still running
+// during the graceful stop of an executor and which requests they are blocked
+// on, and warns about the ones that didn't finish in time.
+func reportDraining(
+	parentCtx, maxDurationCtx context.Context, logger *logrus.Entry, iterations *activeIterations,
+) {
+	ticker := time.NewTicker(drainReportInterval)
+	defer ticker.Stop()
+
+	logDraining := func(level logrus.Level, msg string) {
+		count := iterations.count()
+		if count == 0 {
+			return
+		}
+		fields := logrus.Fields{"iterations": count}
+		if blocked := iterations.blockedOn(); len(blocked) > 0 {
+			fields["blockedOn"] = formatBlockingRequests(blocked)
+		}
+		logger.WithFields(fields).Logf(level, msg, count)
+	}
+	for {
+		select {
+		case <-ticker.C:
+			logDraining(logrus.InfoLevel, "Waiting for %d iterations to gracefully finish")
+		case <-maxDurationCtx.Done():
+			if parentCtx.Err() == nil {
+				logDraining(logrus.InfoLevel, "The graceful stop was too short for %d iterations, interrupting them")
+			}
+			return
+		}
+	}
+}
+
 // getScaledArrivalRate returns a rational number containing the scaled value of
 // the given rate over the given period. This should generally be the first
 // function that's called, before we do any calculations with the users-supplied
@@ -229,6 +308,163 @@ func getVUActivationParams(
 		Exec:               conf.GetExec(),
 		Env:                conf.GetEnv(),
 		Tags:               conf.GetTags(),
+		IterationTimeout:   time.Duration(conf.IterationTimeout.Duration),
+		Retries:            conf.Retries.Int64,
+		RetryBackoff:       time.Duration(conf.RetryBackoff.Duration),
 		DeactivateCallback: deactivateCallback,
 	}
 }
+
+// arrivalRateVUs is the pool of active VUs of an arrival-rate executor. Every
+// iteration started with it runs on a free VU, in its own goroutine, and the VU
+// is returned to the pool after it. If there's no free VU, the iteration is
+// dropped and a new unplanned VU is initialized in the background, until the
+// executor has maxVUs.
+type arrivalRateVUs struct {
+	executor       *BaseExecutor
+	maxDurationCtx context.Context
+	maxVUs         int64
+
+	activeVUs      chan lib.ActiveVU
+	activeVUsCount uint64
+	activeVUsWg    sync.WaitGroup
+
+	activationParams      *lib.VUActivationParams
+	remainingUnplannedVUs int64
+	makeUnplannedVUCh     chan struct{}
+	returnedVUs           chan struct{}
+	shownWarning          bool
+
+	parentCtx    context.Context
+	out          chan<- stats.SampleContainer
+	metricTags   *stats.SampleTags
+	runIteration func(context.Context, lib.ActiveVU) bool
+}
+
+// newArrivalRateVUs activates the pre-allocated VUs of the executor and starts
+// the initialization of unplanned VUs in the background. The returned pool has
+// to be stopped, even if there was an error.
+func newArrivalRateVUs(
+	parentCtx, maxDurationCtx context.Context, out chan<- stats.SampleContainer,
+	bs *BaseExecutor, conf BaseConfig, preAllocatedVUs, maxVUs int64,
+) (*arrivalRateVUs, error) {
+	vus := &arrivalRateVUs{
+		executor:              bs,
+		maxDurationCtx:        maxDurationCtx,
+		maxVUs:                maxVUs,
+		activeVUs:             make(chan lib.ActiveVU, maxVUs),
+		remainingUnplannedVUs: maxVUs - preAllocatedVUs,
+		makeUnplannedVUCh:     make(chan struct{}),
+		returnedVUs:           make(chan struct{}),
+		parentCtx:             parentCtx,
+		out:                   out,
+		metricTags:            bs.getMetricTags(nil),
+		runIteration:          bs.getIterationRunner(parentCtx, out),
+	}
+	vus.activationParams = getVUActivationParams(maxDurationCtx, conf,
+		func(u lib.InitializedVU) {
+			bs.executionState.ReturnVU(u, true)
+			vus.activeVUsWg.Done()
+		})
+
+	go vus.initUnplannedVUs()
+
+	// Get the pre-allocated VUs in the local buffer
+	for i := int64(0); i < preAllocatedVUs; i++ {
+		initVU, err := bs.executionState.GetPlannedVU(bs.logger, false)
+		if err != nil {
+			return vus, err
+		}
+		vus.activeVUs <- vus.activate(initVU)
+	}
+	return vus, nil
+}
+
+func (vus *arrivalRateVUs) activate(initVU lib.InitializedVU) lib.ActiveVU {
+	vus.activeVUsWg.Add(1)
+	activeVU := initVU.Activate(vus.activationParams)
+	vus.executor.executionState.ModCurrentlyActiveVUsCount(+1)
+	atomic.AddUint64(&vus.activeVUsCount, 1)
+	return activeVU
+}
+
+func (vus *arrivalRateVUs) initUnplannedVUs() {
+	defer close(vus.returnedVUs)
+	defer func() {
+		// this is done here as to not have an unplannedVU in the middle of initialization when
+		// starting to return activeVUs
+		for i := uint64(0); i < atomic.LoadUint64(&vus.activeVUsCount); i++ {
+			<-vus.activeVUs
+		}
+	}()
+	logger := vus.executor.logger
+	for range vus.makeUnplannedVUCh {
+		logger.Debug("Starting initialization of an unplanned VU...")
+		initVU, err := vus.executor.executionState.GetUnplannedVU(vus.maxDurationCtx, logger)
+		if err != nil {
+			// TODO figure out how to return it to the Run goroutine
+			logger.WithError(err).Error("Error while allocating unplanned VU")
+		} else {
+			logger.Debug("The unplanned VU finished initializing successfully!")
+			vus.activeVUs <- vus.activate(initVU)
+		}
+	}
+}
+
+// stop waits for all VUs to finish their iterations and to be returned to the
+// pool, and deactivates them with cancel, the cancel func of maxDurationCtx.
+func (vus *arrivalRateVUs) stop(cancel func()) {
+	close(vus.makeUnplannedVUCh)
+	// Make sure all VUs aren't executing iterations anymore, for the cancel()
+	// below to deactivate them.
+	<-vus.returnedVUs
+	cancel()
+	vus.activeVUsWg.Wait()
+}
+
+// counts returns the number of VUs running iterations and of all active VUs,
+// for the progress bars.
+func (vus *arrivalRateVUs) counts() (busy, active uint64) {
+	active = atomic.LoadUint64(&vus.activeVUsCount)
+	return active - uint64(len(vus.activeVUs)), active
+}
+
+// startIteration starts an iteration on a free VU, unless the scenario is
+// paused, in which case the iteration is skipped, not dropped.
+func (vus *arrivalRateVUs) startIteration() {
+	if vus.executor.IsScenarioPaused() {
+		return
+	}
+	select {
+	case vu := <-vus.activeVUs: // ideally, we get the VU from the buffer without any issues
+		go func() { //TODO: refactor so we dont spin up a goroutine for each iteration
+			vus.runIteration(vus.maxDurationCtx, vu)
+			vus.activeVUs <- vu
+		}()
+		return
+	default: // no free VUs currently available
+	}
+
+	// Since there aren't any free VUs available, consider this iteration
+	// dropped - we aren't going to try to recover it
+	stats.PushIfNotDone(vus.parentCtx, vus.out, stats.Sample{
+		Value: 1, Metric: metrics.DroppedIterations,
+		Tags: vus.metricTags, Time: time.Now(),
+	})
+
+	// We'll try to start allocating another VU in the background,
+	// non-blockingly, if we have remainingUnplannedVUs...
+	if vus.remainingUnplannedVUs == 0 {
+		if !vus.shownWarning {
+			vus.executor.logger.Warningf("Insufficient VUs, reached %d active VUs and cannot initialize more", vus.maxVUs)
+			vus.shownWarning = true
+		}
+		return
+	}
+
+	select {
+	case vus.makeUnplannedVUCh <- struct{}{}: // great!
+		vus.remainingUnplannedVUs--
+	default: // we're already allocating a new VU
+	}
+}
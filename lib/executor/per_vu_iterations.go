@@ -68,6 +68,8 @@ func NewPerVUIterationsConfig(name string) PerVUIterationsConfig {
 // Make sure we implement the lib.ExecutorConfig interface
 var _ lib.ExecutorConfig = &PerVUIterationsConfig{}
 
+var _ lib.ResumableExecutorConfig = &PerVUIterationsConfig{}
+
 // GetVUs returns the scaled VUs for the executor.
 func (pvic PerVUIterationsConfig) GetVUs(et *lib.ExecutionTuple) int64 {
 	return et.Segment.Scale(pvic.VUs.Int64)
@@ -141,6 +143,26 @@ func (pvic PerVUIterationsConfig) HasWork(et *lib.ExecutionTuple) bool {
 	return pvic.GetVUs(et) > 0 && pvic.GetIterations() > 0
 }
 
+// GetResumedConfig returns the config for the iterations that each VU has
+// left, or nil if the scenario was already over. Since the VUs don't finish
+// their iterations at the same pace, the completed ones are split evenly and
+// rounded down, so no iterations are skipped.
+func (pvic PerVUIterationsConfig) GetResumedConfig(elapsed time.Duration, iterations uint64) lib.ExecutorConfig {
+	var offset time.Duration
+	pvic.BaseConfig, offset = pvic.BaseConfig.getResumed(elapsed)
+	leftDuration := time.Duration(pvic.MaxDuration.Duration) - offset
+	leftIterations := pvic.Iterations.Int64
+	if pvic.VUs.Int64 > 0 {
+		leftIterations -= int64(iterations) / pvic.VUs.Int64
+	}
+	if leftDuration <= 0 || leftIterations <= 0 {
+		return nil
+	}
+	pvic.MaxDuration = types.NullDurationFrom(leftDuration)
+	pvic.Iterations = null.IntFrom(leftIterations)
+	return pvic
+}
+
 // PerVUIterations executes a specific number of iterations with each VU.
 type PerVUIterations struct {
 	*BaseExecutor
@@ -189,7 +211,7 @@ func (pvi PerVUIterations) Run(parentCtx context.Context, out chan<- stats.Sampl
 		return float64(currentDoneIters) / float64(totalIters), right
 	}
 	pvi.progress.Modify(pb.WithProgress(progressFn))
-	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, pvi, progressFn)
+	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, pvi, progressFn, pvi.iterations)
 
 	handleVUsWG := &sync.WaitGroup{}
 	defer handleVUsWG.Wait()
@@ -198,7 +220,7 @@ func (pvi PerVUIterations) Run(parentCtx context.Context, out chan<- stats.Sampl
 	defer activeVUs.Wait()
 
 	regDurationDone := regDurationCtx.Done()
-	runIteration := getIterationRunner(pvi.executionState, pvi.logger)
+	runIteration := pvi.getIterationRunner(parentCtx, out)
 
 	activationParams := getVUActivationParams(maxDurationCtx, pvi.config.BaseConfig,
 		func(u lib.InitializedVU) {
@@ -24,7 +24,6 @@ import (
 	"context"
 	"fmt"
 	"math"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -32,7 +31,6 @@ import (
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/lib"
-	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/ui/pb"
@@ -77,6 +75,8 @@ func NewRampingArrivalRateConfig(name string) *RampingArrivalRateConfig {
 // Make sure we implement the lib.ExecutorConfig interface
 var _ lib.ExecutorConfig = &RampingArrivalRateConfig{}
 
+var _ lib.ResumableExecutorConfig = &RampingArrivalRateConfig{}
+
 // GetPreAllocatedVUs is just a helper method that returns the scaled pre-allocated VUs.
 func (varc RampingArrivalRateConfig) GetPreAllocatedVUs(et *lib.ExecutionTuple) int64 {
 	return et.Segment.Scale(varc.PreAllocatedVUs.Int64)
@@ -94,7 +94,8 @@ func (varc RampingArrivalRateConfig) GetDescription(et *lib.ExecutionTuple) stri
 	if varc.MaxVUs.Int64 > varc.PreAllocatedVUs.Int64 {
 		maxVUsRange += fmt.Sprintf("-%d", et.Segment.Scale(varc.MaxVUs.Int64))
 	}
-	maxUnscaledRate := getStagesUnscaledMaxTarget(varc.StartRate.Int64, varc.Stages)
+	linearStages := getLinearStages(varc.StartRate.Int64, varc.Stages)
+	maxUnscaledRate := getStagesUnscaledMaxTarget(varc.StartRate.Int64, linearStages)
 	maxArrRatePerSec, _ := getArrivalRatePerSec(
 		getScaledArrivalRate(et.Segment, maxUnscaledRate, time.Duration(varc.TimeUnit.Duration)),
 	).Float64()
@@ -169,6 +170,22 @@ func (varc RampingArrivalRateConfig) HasWork(et *lib.ExecutionTuple) bool {
 	return varc.GetMaxVUs(et) > 0
 }
 
+// GetResumedConfig returns the config for the stages that were left, starting
+// with the rate that was ramped to, or nil if the scenario was already over.
+func (varc RampingArrivalRateConfig) GetResumedConfig(elapsed time.Duration, _ uint64) lib.ExecutorConfig {
+	var offset time.Duration
+	varc.BaseConfig, offset = varc.BaseConfig.getResumed(elapsed)
+	// The waveforms are resumed as the linear stages they are split into
+	linearStages := getLinearStages(varc.StartRate.Int64, varc.Stages)
+	startRate, stages := getResumedStages(varc.StartRate.Int64, linearStages, offset)
+	if len(stages) == 0 {
+		return nil
+	}
+	varc.StartRate = null.IntFrom(startRate)
+	varc.Stages = stages
+	return &varc
+}
+
 // RampingArrivalRate tries to execute a specific number of iterations for a
 // specific period.
 // TODO: combine with the ConstantArrivalRate?
@@ -256,7 +273,7 @@ func (varc RampingArrivalRateConfig) cal(et *lib.ExecutionTuple, ch chan<- time.
 		i = float64(start + 1)
 	)
 
-	for _, stage := range varc.Stages {
+	for _, stage := range getLinearStages(varc.StartRate.Int64, varc.Stages) {
 		to = float64(stage.Target.ValueOrZero()) / timeUnit
 		dur = float64(stage.Duration.Duration)
 		if from != to { // ramp up/down
@@ -301,7 +318,8 @@ func (varr RampingArrivalRate) Run(parentCtx context.Context, out chan<- stats.S
 	// TODO: refactor and simplify
 	timeUnit := time.Duration(varr.config.TimeUnit.Duration)
 	startArrivalRate := getScaledArrivalRate(segment, varr.config.StartRate.Int64, timeUnit)
-	maxUnscaledRate := getStagesUnscaledMaxTarget(varr.config.StartRate.Int64, varr.config.Stages)
+	maxUnscaledRate := getStagesUnscaledMaxTarget(
+		varr.config.StartRate.Int64, getLinearStages(varr.config.StartRate.Int64, varr.config.Stages))
 	maxArrivalRatePerSec, _ := getArrivalRatePerSec(getScaledArrivalRate(segment, maxUnscaledRate, timeUnit)).Float64()
 	startTickerPeriod := getTickerPeriod(startArrivalRate)
 
@@ -311,66 +329,12 @@ func (varr RampingArrivalRate) Run(parentCtx context.Context, out chan<- stats.S
 		"startTickerPeriod": startTickerPeriod.Duration, "type": varr.config.GetType(),
 	}).Debug("Starting executor run...")
 
-	activeVUsWg := &sync.WaitGroup{}
-
-	returnedVUs := make(chan struct{})
 	startTime, maxDurationCtx, regDurationCtx, cancel := getDurationContexts(parentCtx, duration, gracefulStop)
-
-	defer func() {
-		// Make sure all VUs aren't executing iterations anymore, for the cancel()
-		// below to deactivate them.
-		<-returnedVUs
-		cancel()
-		activeVUsWg.Wait()
-	}()
-	activeVUs := make(chan lib.ActiveVU, maxVUs)
-	activeVUsCount := uint64(0)
-
-	activationParams := getVUActivationParams(maxDurationCtx, varr.config.BaseConfig,
-		func(u lib.InitializedVU) {
-			varr.executionState.ReturnVU(u, true)
-			activeVUsWg.Done()
-		})
-	activateVU := func(initVU lib.InitializedVU) lib.ActiveVU {
-		activeVUsWg.Add(1)
-		activeVU := initVU.Activate(activationParams)
-		varr.executionState.ModCurrentlyActiveVUsCount(+1)
-		atomic.AddUint64(&activeVUsCount, 1)
-		return activeVU
-	}
-
-	remainingUnplannedVUs := maxVUs - preAllocatedVUs
-	makeUnplannedVUCh := make(chan struct{})
-	defer close(makeUnplannedVUCh)
-	go func() {
-		defer close(returnedVUs)
-		defer func() {
-			// this is done here as to not have an unplannedVU in the middle of initialization when
-			// starting to return activeVUs
-			for i := uint64(0); i < atomic.LoadUint64(&activeVUsCount); i++ {
-				<-activeVUs
-			}
-		}()
-		for range makeUnplannedVUCh {
-			varr.logger.Debug("Starting initialization of an unplanned VU...")
-			initVU, err := varr.executionState.GetUnplannedVU(maxDurationCtx, varr.logger)
-			if err != nil {
-				// TODO figure out how to return it to the Run goroutine
-				varr.logger.WithError(err).Error("Error while allocating unplanned VU")
-			} else {
-				varr.logger.Debug("The unplanned VU finished initializing successfully!")
-				activeVUs <- activateVU(initVU)
-			}
-		}
-	}()
-
-	// Get the pre-allocated VUs in the local buffer
-	for i := int64(0); i < preAllocatedVUs; i++ {
-		initVU, err := varr.executionState.GetPlannedVU(varr.logger, false)
-		if err != nil {
-			return err
-		}
-		activeVUs <- activateVU(initVU)
+	vus, err := newArrivalRateVUs(
+		parentCtx, maxDurationCtx, out, varr.BaseExecutor, varr.config.BaseConfig, preAllocatedVUs, maxVUs)
+	defer vus.stop(cancel)
+	if err != nil {
+		return err
 	}
 
 	tickerPeriod := int64(startTickerPeriod.Duration)
@@ -379,11 +343,9 @@ func (varr RampingArrivalRate) Run(parentCtx context.Context, out chan<- stats.S
 	itersFmt := pb.GetFixedLengthFloatFormat(maxArrivalRatePerSec, 0) + " iters/s"
 
 	progressFn := func() (float64, []string) {
-		currActiveVUs := atomic.LoadUint64(&activeVUsCount)
 		currentTickerPeriod := atomic.LoadInt64(&tickerPeriod)
-		vusInBuffer := uint64(len(activeVUs))
-		progVUs := fmt.Sprintf(vusFmt+"/"+vusFmt+" VUs",
-			currActiveVUs-vusInBuffer, currActiveVUs)
+		busyVUs, activeVUs := vus.counts()
+		progVUs := fmt.Sprintf(vusFmt+"/"+vusFmt+" VUs", busyVUs, activeVUs)
 
 		itersPerSec := 0.0
 		if currentTickerPeriod > 0 {
@@ -406,21 +368,13 @@ func (varr RampingArrivalRate) Run(parentCtx context.Context, out chan<- stats.S
 	}
 
 	varr.progress.Modify(pb.WithProgress(progressFn))
-	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, varr, progressFn)
+	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, varr, progressFn, varr.iterations)
 
 	regDurationDone := regDurationCtx.Done()
-	runIterationBasic := getIterationRunner(varr.executionState, varr.logger)
-	runIteration := func(vu lib.ActiveVU) {
-		runIterationBasic(maxDurationCtx, vu)
-		activeVUs <- vu
-	}
-
 	timer := time.NewTimer(time.Hour)
 	start := time.Now()
 	ch := make(chan time.Duration, 10) // buffer 10 iteration times ahead
 	var prevTime time.Duration
-	shownWarning := false
-	metricTags := varr.getMetricTags(nil)
 	go varr.config.cal(varr.executionState.ExecutionTuple, ch)
 	for nextTime := range ch {
 		select {
@@ -440,35 +394,7 @@ func (varr RampingArrivalRate) Run(parentCtx context.Context, out chan<- stats.S
 			}
 		}
 
-		select {
-		case vu := <-activeVUs: // ideally, we get the VU from the buffer without any issues
-			go runIteration(vu) //TODO: refactor so we dont spin up a goroutine for each iteration
-			continue
-		default: // no free VUs currently available
-		}
-		// Since there aren't any free VUs available, consider this iteration
-		// dropped - we aren't going to try to recover it, but
-
-		stats.PushIfNotDone(parentCtx, out, stats.Sample{
-			Value: 1, Metric: metrics.DroppedIterations,
-			Tags: metricTags, Time: time.Now(),
-		})
-
-		// We'll try to start allocating another VU in the background,
-		// non-blockingly, if we have remainingUnplannedVUs...
-		if remainingUnplannedVUs == 0 {
-			if !shownWarning {
-				varr.logger.Warningf("Insufficient VUs, reached %d active VUs and cannot initialize more", maxVUs)
-				shownWarning = true
-			}
-			continue
-		}
-
-		select {
-		case makeUnplannedVUCh <- struct{}{}: // great!
-			remainingUnplannedVUs--
-		default: // we're already allocating a new VU
-		}
+		vus.startIteration()
 	}
 	return nil
 }
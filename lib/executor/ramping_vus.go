@@ -53,7 +53,8 @@ func init() {
 type Stage struct {
 	Duration types.NullDuration `json:"duration"`
 	Target   null.Int           `json:"target"` // TODO: maybe rename this to endVUs? something else?
-	// TODO: add a progression function?
+	// An optional waveform around the linear ramp to the target
+	Waveform *Waveform `json:"waveform,omitempty"`
 }
 
 // RampingVUsConfig stores the configuration for the stages executor
@@ -76,6 +77,8 @@ func NewRampingVUsConfig(name string) RampingVUsConfig {
 // Make sure we implement the lib.ExecutorConfig interface
 var _ lib.ExecutorConfig = &RampingVUsConfig{}
 
+var _ lib.ResumableExecutorConfig = &RampingVUsConfig{}
+
 // GetStartVUs is just a helper method that returns the scaled starting VUs.
 func (vlvc RampingVUsConfig) GetStartVUs(et *lib.ExecutionTuple) int64 {
 	return et.ScaleInt64(vlvc.StartVUs.Int64)
@@ -89,7 +92,8 @@ func (vlvc RampingVUsConfig) GetGracefulRampDown() time.Duration {
 
 // GetDescription returns a human-readable description of the executor options
 func (vlvc RampingVUsConfig) GetDescription(et *lib.ExecutionTuple) string {
-	maxVUs := et.ScaleInt64(getStagesUnscaledMaxTarget(vlvc.StartVUs.Int64, vlvc.Stages))
+	linearStages := getLinearStages(vlvc.StartVUs.Int64, vlvc.Stages)
+	maxVUs := et.ScaleInt64(getStagesUnscaledMaxTarget(vlvc.StartVUs.Int64, linearStages))
 	return fmt.Sprintf("Up to %d looping VUs for %s over %d stages%s",
 		maxVUs, sumStagesDuration(vlvc.Stages), len(vlvc.Stages),
 		vlvc.getBaseInfo(fmt.Sprintf("gracefulRampDown: %s", vlvc.GetGracefulRampDown())))
@@ -198,7 +202,7 @@ func (vlvc RampingVUsConfig) getRawExecutionSteps(et *lib.ExecutionTuple, zeroEn
 		}
 	}
 
-	for _, stage := range vlvc.Stages {
+	for _, stage := range getLinearStages(vlvc.StartVUs.Int64, vlvc.Stages) {
 		stageEndVUs := stage.Target.Int64
 		stageDuration := time.Duration(stage.Duration.Duration)
 		timeTillEnd += stageDuration
@@ -325,7 +329,7 @@ func (vlvc RampingVUsConfig) precalculateTheRequiredSteps(et *lib.ExecutionTuple
 	if zeroEnd {
 		result++ // for the last one - this one can be more then needed
 	}
-	for _, stage := range vlvc.Stages {
+	for _, stage := range getLinearStages(vlvc.StartVUs.Int64, vlvc.Stages) {
 		stageEndVUs := et.ScaleInt64(stage.Target.Int64)
 		if stage.Duration.Duration == 0 {
 			result++
@@ -539,6 +543,23 @@ func (vlvc RampingVUsConfig) HasWork(et *lib.ExecutionTuple) bool {
 	return lib.GetMaxPlannedVUs(vlvc.GetExecutionRequirements(et)) > 0
 }
 
+// GetResumedConfig returns the config for the stages that were left, starting
+// with the number of VUs that were ramped to, or nil if the scenario was
+// already over.
+func (vlvc RampingVUsConfig) GetResumedConfig(elapsed time.Duration, _ uint64) lib.ExecutorConfig {
+	var offset time.Duration
+	vlvc.BaseConfig, offset = vlvc.BaseConfig.getResumed(elapsed)
+	// The waveforms are resumed as the linear stages they are split into
+	linearStages := getLinearStages(vlvc.StartVUs.Int64, vlvc.Stages)
+	startVUs, stages := getResumedStages(vlvc.StartVUs.Int64, linearStages, offset)
+	if len(stages) == 0 {
+		return nil
+	}
+	vlvc.StartVUs = null.IntFrom(startVUs)
+	vlvc.Stages = stages
+	return vlvc
+}
+
 // RampingVUs handles the old "stages" execution configuration - it loops
 // iterations with a variable number of VUs for the sum of all of the specified
 // stages' duration.
@@ -600,11 +621,11 @@ func (vlv RampingVUs) Run(parentCtx context.Context, out chan<- stats.SampleCont
 		return float64(spent) / float64(regularDuration), []string{progVUs, progDur}
 	}
 	vlv.progress.Modify(pb.WithProgress(progressFn))
-	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, vlv, progressFn)
+	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, vlv, progressFn, vlv.iterations)
 
 	// Actually schedule the VUs and iterations, likely the most complicated
 	// executor among all of them...
-	runIteration := getIterationRunner(vlv.executionState, vlv.logger)
+	runIteration := vlv.getIterationRunner(parentCtx, out)
 	getVU := func() (lib.InitializedVU, error) {
 		initVU, err := vlv.executionState.GetPlannedVU(vlv.logger, false)
 		if err != nil {
@@ -36,6 +36,7 @@ import (
 
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
 )
 
 func TestRampingVUsRun(t *testing.T) {
@@ -85,7 +86,8 @@ func TestRampingVUsRun(t *testing.T) {
 	}
 
 	errCh := make(chan error)
-	go func() { errCh <- executor.Run(ctx, nil) }()
+	engineOut := make(chan stats.SampleContainer, 1000)
+	go func() { errCh <- executor.Run(ctx, engineOut) }()
 
 	result := make([]int64, len(sampleTimes))
 	for i, d := range sampleTimes {
@@ -137,7 +139,8 @@ func TestRampingVUsGracefulStopWaits(t *testing.T) {
 	)
 	defer cancel()
 	errCh := make(chan error)
-	go func() { errCh <- executor.Run(ctx, nil) }()
+	engineOut := make(chan stats.SampleContainer, 1000)
+	go func() { errCh <- executor.Run(ctx, engineOut) }()
 
 	<-started
 	// 500 milliseconds more then the duration and 500 less then the gracefulStop
@@ -186,7 +189,8 @@ func TestRampingVUsGracefulStopStops(t *testing.T) {
 	)
 	defer cancel()
 	errCh := make(chan error)
-	go func() { errCh <- executor.Run(ctx, nil) }()
+	engineOut := make(chan stats.SampleContainer, 1000)
+	go func() { errCh <- executor.Run(ctx, engineOut) }()
 
 	<-started
 	// 500 milliseconds more then the gracefulStop + duration
@@ -244,7 +248,8 @@ func TestRampingVUsGracefulRampDown(t *testing.T) {
 	)
 	defer cancel()
 	errCh := make(chan error)
-	go func() { errCh <- executor.Run(ctx, nil) }()
+	engineOut := make(chan stats.SampleContainer, 1000)
+	go func() { errCh <- executor.Run(ctx, engineOut) }()
 
 	<-started
 	// 500 milliseconds more then the gracefulRampDown + duration
@@ -303,7 +308,8 @@ func TestRampingVUsRampDownNoWobble(t *testing.T) {
 	) / rampDownSampleTime)
 
 	errCh := make(chan error)
-	go func() { errCh <- executor.Run(ctx, nil) }()
+	engineOut := make(chan stats.SampleContainer, 1000)
+	go func() { errCh <- executor.Run(ctx, engineOut) }()
 
 	result := make([]int64, len(sampleTimes)+rampDownSamples)
 	for i, d := range sampleTimes {
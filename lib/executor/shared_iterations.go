@@ -71,6 +71,8 @@ func NewSharedIterationsConfig(name string) SharedIterationsConfig {
 // Make sure we implement the lib.ExecutorConfig interface
 var _ lib.ExecutorConfig = &SharedIterationsConfig{}
 
+var _ lib.ResumableExecutorConfig = &SharedIterationsConfig{}
+
 // GetVUs returns the scaled VUs for the executor.
 func (sic SharedIterationsConfig) GetVUs(et *lib.ExecutionTuple) int64 {
 	return et.ScaleInt64(sic.VUs.Int64)
@@ -170,6 +172,24 @@ func (sic SharedIterationsConfig) HasWork(et *lib.ExecutionTuple) bool {
 	return sic.GetVUs(et) > 0 && sic.GetIterations(et) > 0
 }
 
+// GetResumedConfig returns the config for the iterations that were left, or
+// nil if the scenario was already over.
+func (sic SharedIterationsConfig) GetResumedConfig(elapsed time.Duration, iterations uint64) lib.ExecutorConfig {
+	var offset time.Duration
+	sic.BaseConfig, offset = sic.BaseConfig.getResumed(elapsed)
+	leftDuration := time.Duration(sic.MaxDuration.Duration) - offset
+	leftIterations := sic.Iterations.Int64 - int64(iterations)
+	if leftDuration <= 0 || leftIterations <= 0 {
+		return nil
+	}
+	sic.MaxDuration = types.NullDurationFrom(leftDuration)
+	sic.Iterations = null.IntFrom(leftIterations)
+	if sic.VUs.Int64 > leftIterations {
+		sic.VUs = null.IntFrom(leftIterations)
+	}
+	return sic
+}
+
 // Init values needed for the execution
 func (si *SharedIterations) Init(ctx context.Context) error {
 	// err should always be nil, because Init() won't be called for executors
@@ -213,7 +233,7 @@ func (si SharedIterations) Run(parentCtx context.Context, out chan<- stats.Sampl
 		return float64(currentDoneIters) / float64(totalIters), right
 	}
 	si.progress.Modify(pb.WithProgress(progressFn))
-	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, &si, progressFn)
+	go trackProgress(parentCtx, maxDurationCtx, regDurationCtx, &si, progressFn, si.iterations)
 
 	var attemptedIters uint64
 
@@ -230,7 +250,7 @@ func (si SharedIterations) Run(parentCtx context.Context, out chan<- stats.Sampl
 	}()
 
 	regDurationDone := regDurationCtx.Done()
-	runIteration := getIterationRunner(si.executionState, si.logger)
+	runIteration := si.getIterationRunner(parentCtx, out)
 
 	activationParams := getVUActivationParams(maxDurationCtx, si.config.BaseConfig,
 		func(u lib.InitializedVU) {
@@ -0,0 +1,222 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// The supported waveform types.
+const (
+	waveformSine       = "sine"
+	waveformSawtooth   = "sawtooth"
+	waveformSquare     = "square"
+	waveformRandomWalk = "random-walk"
+)
+
+const (
+	// The number of linear stages a single period of a sine wave is split into.
+	sinePointsPerPeriod = 16
+	// The limit of the number of linear stages a waveform stage is split
+	// into, so a short period can't make a huge execution plan.
+	maxWaveformPoints = 100000
+)
+
+// Waveform makes the value of a stage oscillate around the linear ramp to
+// its target, so recurring patterns like diurnal traffic or bursts don't
+// have to be described with many short stages. A waveform stage ends at the
+// value of the waveform at its end, which is where the next stage starts.
+type Waveform struct {
+	Type      string             `json:"type"`
+	Period    types.NullDuration `json:"period"`
+	Amplitude null.Int           `json:"amplitude"`
+
+	// The bounds of the value of the stage. The lower one is 0 by default.
+	Min null.Int `json:"min"`
+	Max null.Int `json:"max"`
+
+	// The seed of the random-walk steps, so every instance of a distributed
+	// test takes the same ones.
+	Seed null.Int `json:"seed"`
+}
+
+// Validate makes sure the waveform is configured correctly.
+func (w Waveform) Validate(stageDuration time.Duration) []error {
+	var errors []error
+	switch w.Type {
+	case waveformSine, waveformSawtooth, waveformSquare, waveformRandomWalk:
+	default:
+		errors = append(errors, fmt.Errorf("unknown waveform type '%s', it should be one of %s, %s, %s or %s",
+			w.Type, waveformSine, waveformSawtooth, waveformSquare, waveformRandomWalk))
+	}
+	if !w.Period.Valid {
+		errors = append(errors, fmt.Errorf("the waveform period isn't specified"))
+	} else if time.Duration(w.Period.Duration) < minDuration {
+		errors = append(errors, fmt.Errorf("the waveform period should be at least %s", minDuration))
+	} else if stageDuration/time.Duration(w.Period.Duration)*sinePointsPerPeriod > maxWaveformPoints {
+		errors = append(errors, fmt.Errorf("the waveform period is too short for the stage duration"))
+	}
+	if !w.Amplitude.Valid {
+		errors = append(errors, fmt.Errorf("the waveform amplitude isn't specified"))
+	} else if w.Amplitude.Int64 < 0 {
+		errors = append(errors, fmt.Errorf("the waveform amplitude shouldn't be negative"))
+	}
+	if w.Min.Int64 < 0 {
+		errors = append(errors, fmt.Errorf("the waveform min shouldn't be negative"))
+	}
+	if w.Max.Valid && w.Max.Int64 < w.Min.Int64 {
+		errors = append(errors, fmt.Errorf("the waveform max shouldn't be less than its min"))
+	}
+	return errors
+}
+
+// waveformPoint is a point of a waveform, which is reached either with a
+// linear ramp from the previous point or immediately.
+type waveformPoint struct {
+	offset time.Duration
+	value  float64
+	jump   bool
+}
+
+// points returns the points of the waveform for a stage with the given
+// duration, which ramps from `from` to `to`.
+//nolint:funlen
+func (w Waveform) points(from, to int64, duration time.Duration) []waveformPoint {
+	period := time.Duration(w.Period.Duration)
+	amplitude := float64(w.Amplitude.Int64)
+	base := func(t time.Duration) float64 {
+		if duration == 0 {
+			return float64(to)
+		}
+		return float64(from) + float64(to-from)*float64(t)/float64(duration)
+	}
+
+	var points []waveformPoint
+	switch w.Type {
+	case waveformSine:
+		step := period / sinePointsPerPeriod
+		for t := step; ; t += step {
+			if t > duration {
+				t = duration
+			}
+			value := base(t) + amplitude*math.Sin(2*math.Pi*float64(t)/float64(period))
+			points = append(points, waveformPoint{offset: t, value: value})
+			if t == duration {
+				break
+			}
+		}
+	case waveformSawtooth:
+		for start := time.Duration(0); start < duration; start += period {
+			end := start + period
+			if end > duration {
+				end = duration
+			}
+			points = append(points,
+				waveformPoint{offset: start, value: base(start) - amplitude, jump: true},
+				waveformPoint{offset: end, value: base(end) - amplitude + 2*amplitude*float64(end-start)/float64(period)},
+			)
+		}
+	case waveformSquare:
+		sign := 1.0
+		for start := time.Duration(0); start < duration; start += period / 2 {
+			end := start + period/2
+			if end > duration {
+				end = duration
+			}
+			points = append(points,
+				waveformPoint{offset: start, value: base(start) + sign*amplitude, jump: true},
+				waveformPoint{offset: end, value: base(end) + sign*amplitude},
+			)
+			sign = -sign
+		}
+	case waveformRandomWalk:
+		random := rand.New(rand.NewSource(w.Seed.Int64)) //nolint:gosec
+		offset := 0.0
+		for t := period; ; t += period {
+			if t > duration {
+				t = duration
+			}
+			offset += (2*random.Float64() - 1) * amplitude
+			// The walk is reflected by the bounds, so it doesn't get stuck at them
+			value := w.bound(base(t) + offset)
+			offset = value - base(t)
+			points = append(points, waveformPoint{offset: t, value: value})
+			if t == duration {
+				break
+			}
+		}
+	}
+	return points
+}
+
+// bound returns the value within the bounds of the waveform.
+func (w Waveform) bound(value float64) float64 {
+	value = math.Max(value, float64(w.Min.Int64))
+	if w.Max.Valid {
+		value = math.Min(value, float64(w.Max.Int64))
+	}
+	return value
+}
+
+// getLinearStages returns the given stages, starting from startValue, with
+// the waveform stages split into the linear ones that the ramping executors
+// use for their execution plans.
+func getLinearStages(startValue int64, stages []Stage) []Stage {
+	hasWaveforms := false
+	for _, stage := range stages {
+		if stage.Waveform != nil {
+			hasWaveforms = true
+			break
+		}
+	}
+	if !hasWaveforms {
+		return stages
+	}
+
+	result := make([]Stage, 0, len(stages))
+	from := startValue
+	for _, stage := range stages {
+		if stage.Waveform == nil {
+			result = append(result, stage)
+			from = stage.Target.Int64
+			continue
+		}
+
+		var previous time.Duration
+		for _, point := range stage.Waveform.points(from, stage.Target.Int64, time.Duration(stage.Duration.Duration)) {
+			duration := point.offset - previous
+			if point.jump {
+				duration = 0
+			}
+			from = int64(math.Round(stage.Waveform.bound(point.value)))
+			result = append(result, Stage{Duration: types.NullDurationFrom(duration), Target: null.IntFrom(from)})
+			previous = point.offset
+		}
+	}
+	return result
+}
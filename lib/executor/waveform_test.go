@@ -0,0 +1,167 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package executor
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+)
+
+func newStage(duration time.Duration, target int64) Stage {
+	return Stage{Duration: types.NullDurationFrom(duration), Target: null.IntFrom(target)}
+}
+
+func newWaveformStage(duration time.Duration, target int64, waveform string) Stage {
+	stage := newStage(duration, target)
+	stage.Waveform = &Waveform{}
+	if err := json.Unmarshal([]byte(waveform), stage.Waveform); err != nil {
+		panic(err)
+	}
+	return stage
+}
+
+func TestGetLinearStages(t *testing.T) {
+	t.Parallel()
+
+	testCases := map[string]struct {
+		stages   []Stage
+		expected []Stage
+	}{
+		"linear": {
+			stages:   []Stage{newStage(time.Minute, 10), newStage(time.Minute, 0)},
+			expected: []Stage{newStage(time.Minute, 10), newStage(time.Minute, 0)},
+		},
+		"sine": {
+			stages: []Stage{
+				newStage(0, 10),
+				newWaveformStage(8*time.Second, 10, `{"type": "sine", "period": "16s", "amplitude": 10}`),
+			},
+			expected: []Stage{
+				newStage(0, 10),
+				newStage(time.Second, 14), newStage(time.Second, 17), newStage(time.Second, 19),
+				newStage(time.Second, 20), newStage(time.Second, 19), newStage(time.Second, 17),
+				newStage(time.Second, 14), newStage(time.Second, 10),
+			},
+		},
+		"sawtooth": {
+			stages: []Stage{
+				newStage(0, 10),
+				newWaveformStage(25*time.Second, 10, `{"type": "sawtooth", "period": "10s", "amplitude": 5}`),
+			},
+			expected: []Stage{
+				newStage(0, 10),
+				newStage(0, 5), newStage(10*time.Second, 15),
+				newStage(0, 5), newStage(10*time.Second, 15),
+				newStage(0, 5), newStage(5*time.Second, 10),
+			},
+		},
+		"square with a ramp and bounds": {
+			stages: []Stage{
+				newWaveformStage(20*time.Second, 40, `{"type": "square", "period": "10s", "amplitude": 20, "max": 50}`),
+			},
+			expected: []Stage{
+				newStage(0, 20), newStage(5*time.Second, 30),
+				newStage(0, 0), newStage(5*time.Second, 0),
+				newStage(0, 40), newStage(5*time.Second, 50),
+				newStage(0, 10), newStage(5*time.Second, 20),
+			},
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			assert.Equal(t, tc.expected, getLinearStages(0, tc.stages))
+		})
+	}
+}
+
+func TestGetLinearStagesRandomWalk(t *testing.T) {
+	t.Parallel()
+	stages := []Stage{
+		newWaveformStage(time.Hour, 50, `{"type": "random-walk", "period": "1m", "amplitude": 20, "min": 30, "max": 70}`),
+	}
+	linear := getLinearStages(50, stages)
+	require.Len(t, linear, 60)
+	for _, stage := range linear {
+		assert.Equal(t, time.Minute, time.Duration(stage.Duration.Duration))
+		assert.True(t, stage.Target.Int64 >= 30 && stage.Target.Int64 <= 70, stage.Target.Int64)
+	}
+	// The steps are the same every time, so distributed instances agree on them
+	assert.Equal(t, linear, getLinearStages(50, stages))
+	stages[0].Waveform.Seed = null.IntFrom(42)
+	assert.NotEqual(t, linear, getLinearStages(50, stages))
+}
+
+func TestWaveformValidate(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"unknown type":       `{"type": "triangle", "period": "1m", "amplitude": 1}`,
+		"no period":          `{"type": "sine", "amplitude": 1}`,
+		"short period":       `{"type": "sine", "period": "100ms", "amplitude": 1}`,
+		"too many points":    `{"type": "sine", "period": "1s", "amplitude": 1}`,
+		"no amplitude":       `{"type": "sine", "period": "1m"}`,
+		"negative amplitude": `{"type": "sine", "period": "1m", "amplitude": -1}`,
+		"negative min":       `{"type": "sine", "period": "1m", "amplitude": 1, "min": -1}`,
+		"max below min":      `{"type": "sine", "period": "1m", "amplitude": 1, "min": 10, "max": 5}`,
+	}
+	for name, data := range testCases {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			stage := newWaveformStage(24*time.Hour, 10, data)
+			assert.NotEmpty(t, validateStages([]Stage{stage}))
+		})
+	}
+
+	stage := newWaveformStage(24*time.Hour, 10, `{"type": "sine", "period": "1h", "amplitude": 5}`)
+	assert.Empty(t, validateStages([]Stage{stage}))
+}
+
+func TestRampingVUsWaveformExecutionRequirements(t *testing.T) {
+	t.Parallel()
+	config := NewRampingVUsConfig("waves")
+	config.StartVUs = null.IntFrom(10)
+	config.GracefulRampDown = types.NullDurationFrom(0)
+	config.GracefulStop = types.NullDurationFrom(0)
+	config.Stages = []Stage{
+		newWaveformStage(time.Minute, 10, `{"type": "sine", "period": "30s", "amplitude": 5}`),
+	}
+	require.Empty(t, config.Validate())
+
+	et, err := lib.NewExecutionTuple(nil, nil)
+	require.NoError(t, err)
+	steps := config.GetExecutionRequirements(et)
+	assert.Equal(t, uint64(15), lib.GetMaxPlannedVUs(steps))
+	endOffset, isFinal := lib.GetEndOffset(steps)
+	assert.Equal(t, time.Minute, endOffset)
+	assert.True(t, isFinal)
+	assert.Equal(t, "Up to 15 looping VUs for 1m0s over 1 stages (gracefulRampDown: 0s)",
+		config.GetDescription(et))
+}
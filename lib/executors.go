@@ -24,6 +24,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"reflect"
 	"sort"
 	"strings"
 	"sync"
@@ -31,6 +32,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/stats"
 	"github.com/loadimpact/k6/ui/pb"
 )
@@ -80,6 +82,10 @@ type ExecutorConfig interface {
 	GetName() string
 	GetType() string
 	GetStartTime() time.Duration
+	// Returns all of the times, relative to the given beginning of the test,
+	// when the executor should be started. There is more than one only when
+	// it's scheduled with startCron or startAt.
+	GetStartTimes(testStart time.Time) []time.Duration
 	GetGracefulStop() time.Duration
 
 	// This is used to validate whether a particular script can run in the cloud
@@ -93,7 +99,31 @@ type ExecutorConfig interface {
 	//
 	// TODO: use interface{} so plain http requests can be specified?
 	GetExec() string
+	// Returns the names of the functions that are run once before and after
+	// the executor, if any. The data returned by the setup function is passed
+	// to the iterations of the scenario instead of the global setup() data.
+	GetSetup() string
+	GetTeardown() string
 	GetTags() map[string]string
+	// Returns any TLS settings that override the global ones for this
+	// scenario, or nil if there are none.
+	GetTLS() *ScenarioTLS
+	// Returns the network conditions simulated for the VUs of this scenario,
+	// or nil if the network isn't shaped.
+	GetNetwork() *ScenarioNetwork
+	// Returns the HTTP proxy settings that override the ones from the
+	// environment for this scenario, or nil if there are none.
+	GetProxy() *ScenarioProxy
+	// Returns the DNS resolution settings that override the global ones for
+	// this scenario, or nil if there are none.
+	GetDNS() *ScenarioDNS
+	// Returns the pool of local IPs that the connections of this scenario
+	// are bound to instead of the global localIPs, or nil if there is none.
+	GetLocalIPs() *ScenarioLocalIPs
+	// Returns for how long after the start of the scenario its metric
+	// samples are discarded, so a warm-up doesn't affect the results. If
+	// it isn't set, the global discardMetricsFor option is used.
+	GetDiscardMetricsFor() types.NullDuration
 
 	// Calculates the VU requirements in different stages of the executor's
 	// execution, including any extensions caused by waiting for iterations to
@@ -130,6 +160,15 @@ type PausableExecutor interface {
 	SetPaused(bool) error
 }
 
+// ScenarioPausableExecutor should be implemented by the executors whose
+// scenario can be paused and resumed on its own, while the rest of the test
+// keeps running. Paused scenarios don't start new iterations, but their
+// duration keeps running.
+type ScenarioPausableExecutor interface {
+	SetScenarioPaused(bool) error
+	IsScenarioPaused() bool
+}
+
 // LiveUpdatableExecutor should be implemented for the executors whose
 // configuration can be modified in the middle of the test execution. Currently,
 // only the manual execution executor implements it.
@@ -137,6 +176,17 @@ type LiveUpdatableExecutor interface {
 	UpdateConfig(ctx context.Context, newConfig interface{}) error
 }
 
+// ResumableExecutorConfig should be implemented by the executor configs whose
+// scenarios can be resumed from a checkpoint of an earlier test run.
+type ResumableExecutorConfig interface {
+	ExecutorConfig
+
+	// Returns the config for the work that was left after the given duration
+	// of the earlier test run, in which the scenario completed the given
+	// number of full iterations. Returns nil if no work was left.
+	GetResumedConfig(elapsed time.Duration, iterations uint64) ExecutorConfig
+}
+
 // ExecutorConfigConstructor is a simple function that returns a concrete
 // Config instance with the specified name and all default values correctly
 // initialized
@@ -175,8 +225,9 @@ func (scs *ScenarioConfigs) UnmarshalJSON(data []byte) error {
 
 	// TODO: use a more sophisticated combination of dec.Token() and dec.More(),
 	// which would allow us to support both arrays and maps for this config?
+	// The unknown keys of each scenario are reported by its config constructor
 	var protoConfigs map[string]protoExecutorConfig
-	if err := StrictJSONUnmarshal(data, &protoConfigs); err != nil {
+	if err := json.Unmarshal(data, &protoConfigs); err != nil {
 		return err
 	}
 
@@ -187,6 +238,9 @@ func (scs *ScenarioConfigs) UnmarshalJSON(data []byte) error {
 		}
 		config, err := GetParsedExecutorConfig(k, v.executorType, v.rawJSON)
 		if err != nil {
+			if _, ok := err.(UnknownKeysError); ok {
+				return fmt.Errorf("scenario '%s' has configuration errors: %w", k, err)
+			}
 			return err
 		}
 		result[k] = config
@@ -197,6 +251,12 @@ func (scs *ScenarioConfigs) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// KnownKeysType implements KnownKeysTyper, so the keys of every scenario are
+// checked against the config of its executor type.
+func (scs *ScenarioConfigs) KnownKeysType([]byte) reflect.Type {
+	return reflect.TypeOf(map[string]protoExecutorConfig{})
+}
+
 // Validate checks if all of the specified executor options make sense
 func (scs ScenarioConfigs) Validate() (errors []error) {
 	for name, exec := range scs {
@@ -255,12 +315,16 @@ func (scs ScenarioConfigs) GetFullExecutionRequirements(et *ExecutionTuple) []Ex
 		configID int
 	}
 	trackedSteps := []trackedStep{}
+	testStart := time.Now()
 	for configID, config := range sortedConfigs { // orderly iteration over a slice
-		configStartTime := config.GetStartTime()
 		configSteps := config.GetExecutionRequirements(et)
-		for _, cs := range configSteps {
-			cs.TimeOffset += configStartTime // add the executor start time to the step time offset
-			trackedSteps = append(trackedSteps, trackedStep{cs, configID})
+		// Scheduled executors are planned once for every occurrence, relative
+		// to now, since that's the closest we can get to the actual test start.
+		for _, configStartTime := range config.GetStartTimes(testStart) {
+			for _, cs := range configSteps {
+				cs.TimeOffset += configStartTime // add the executor start time to the step time offset
+				trackedSteps = append(trackedSteps, trackedStep{cs, configID})
+			}
 		}
 	}
 	// Sort by (time offset, config id). It's important that we use stable
@@ -344,3 +408,23 @@ func (pc *protoExecutorConfig) UnmarshalJSON(b []byte) error {
 	*pc = protoExecutorConfig{tmp.ExecutorType, b}
 	return err
 }
+
+// KnownKeysType implements KnownKeysTyper, it returns the config type of the
+// executor, or nil if the executor type is unknown.
+func (pc *protoExecutorConfig) KnownKeysType(b []byte) reflect.Type {
+	if err := pc.UnmarshalJSON(b); err != nil {
+		return nil
+	}
+
+	executorConfigTypesMutex.RLock()
+	constructor, exists := executorConfigConstructors[pc.executorType]
+	executorConfigTypesMutex.RUnlock()
+	if !exists {
+		return nil
+	}
+	config, err := constructor("", []byte("{}"))
+	if err != nil {
+		return nil
+	}
+	return reflect.TypeOf(config)
+}
@@ -0,0 +1,118 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package fips implements the FIPS mode, which restricts TLS and the k6/crypto
+// module to FIPS 140-2 approved algorithms. It's enabled with --fips, or
+// always when k6 is built with the `fips` build tag.
+package fips
+
+import (
+	"crypto/tls"
+	"fmt"
+	"sync/atomic"
+)
+
+var enabled uint32 //nolint:gochecknoglobals
+
+// Enable turns on the FIPS mode for the whole process. It can't be disabled.
+func Enable() {
+	atomic.StoreUint32(&enabled, 1)
+}
+
+// Enabled returns whether the FIPS mode is on.
+func Enabled() bool {
+	return atomic.LoadUint32(&enabled) == 1
+}
+
+// approvedHashes are the k6/crypto hash algorithms allowed in FIPS mode.
+//nolint:gochecknoglobals
+var approvedHashes = map[string]bool{
+	"sha1":       true,
+	"sha256":     true,
+	"sha384":     true,
+	"sha512":     true,
+	"sha512_224": true,
+	"sha512_256": true,
+}
+
+// ApprovedCipherSuites are the TLS 1.2 cipher suites allowed in FIPS mode,
+// according to NIST SP 800-52 Rev. 2.
+//nolint:gochecknoglobals
+var ApprovedCipherSuites = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_RSA_WITH_AES_256_GCM_SHA384,
+}
+
+// CheckHash returns an error if the FIPS mode is on and the given k6/crypto
+// hash algorithm isn't approved.
+func CheckHash(algorithm string) error {
+	if Enabled() && !approvedHashes[algorithm] {
+		return fmt.Errorf("the %s hash algorithm isn't allowed in FIPS mode", algorithm)
+	}
+	return nil
+}
+
+// RestrictTLS checks that a TLS config only uses approved settings when the
+// FIPS mode is on, and restricts the defaults that aren't explicitly set to
+// approved ones. TLS 1.3 is disabled, since its cipher suites can't be
+// configured and include ones that aren't approved.
+func RestrictTLS(conf *tls.Config) error {
+	if !Enabled() {
+		return nil
+	}
+	if conf.InsecureSkipVerify {
+		return fmt.Errorf("insecureSkipTLSVerify isn't allowed in FIPS mode")
+	}
+
+	if conf.MinVersion == 0 {
+		conf.MinVersion = tls.VersionTLS12
+	}
+	if conf.MaxVersion == 0 {
+		conf.MaxVersion = tls.VersionTLS12
+	}
+	if conf.MinVersion < tls.VersionTLS12 || conf.MaxVersion != tls.VersionTLS12 {
+		return fmt.Errorf("only TLS 1.2 is allowed in FIPS mode")
+	}
+
+	if len(conf.CipherSuites) == 0 {
+		conf.CipherSuites = ApprovedCipherSuites
+	}
+	for _, id := range conf.CipherSuites {
+		if !isApprovedCipherSuite(id) {
+			return fmt.Errorf("the %s cipher suite isn't allowed in FIPS mode", tls.CipherSuiteName(id))
+		}
+	}
+
+	conf.CurvePreferences = []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521}
+	return nil
+}
+
+func isApprovedCipherSuite(id uint16) bool {
+	for _, approved := range ApprovedCipherSuites {
+		if id == approved {
+			return true
+		}
+	}
+	return false
+}
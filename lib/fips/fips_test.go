@@ -0,0 +1,104 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package fips
+
+import (
+	"crypto/tls"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// The tests change the global FIPS mode, so they can't run in parallel.
+
+func withFIPS(t *testing.T, on bool) {
+	prev := atomic.LoadUint32(&enabled)
+	if on {
+		atomic.StoreUint32(&enabled, 1)
+	} else {
+		atomic.StoreUint32(&enabled, 0)
+	}
+	t.Cleanup(func() { atomic.StoreUint32(&enabled, prev) })
+}
+
+func TestCheckHash(t *testing.T) {
+	withFIPS(t, false)
+	assert.NoError(t, CheckHash("md5"))
+
+	withFIPS(t, true)
+	assert.NoError(t, CheckHash("sha256"))
+	assert.NoError(t, CheckHash("sha512_256"))
+	for _, algo := range []string{"md4", "md5", "ripemd160"} {
+		assert.EqualError(t, CheckHash(algo), "the "+algo+" hash algorithm isn't allowed in FIPS mode")
+	}
+}
+
+func TestRestrictTLS(t *testing.T) {
+	t.Run("disabled", func(t *testing.T) {
+		withFIPS(t, false)
+		conf := &tls.Config{MinVersion: tls.VersionTLS10}
+		require.NoError(t, RestrictTLS(conf))
+		assert.Equal(t, &tls.Config{MinVersion: tls.VersionTLS10}, conf)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		withFIPS(t, true)
+		conf := &tls.Config{}
+		require.NoError(t, RestrictTLS(conf))
+		assert.Equal(t, uint16(tls.VersionTLS12), conf.MinVersion)
+		assert.Equal(t, uint16(tls.VersionTLS12), conf.MaxVersion)
+		assert.Equal(t, ApprovedCipherSuites, conf.CipherSuites)
+		assert.Equal(t, []tls.CurveID{tls.CurveP256, tls.CurveP384, tls.CurveP521}, conf.CurvePreferences)
+	})
+
+	testCases := map[string]struct {
+		conf   *tls.Config
+		expErr string
+	}{
+		"approved suite": {
+			&tls.Config{CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384}}, "",
+		},
+		"chacha": {
+			&tls.Config{CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305}},
+			"the TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256 cipher suite isn't allowed in FIPS mode",
+		},
+		"tls1.0": {&tls.Config{MinVersion: tls.VersionTLS10}, "only TLS 1.2 is allowed in FIPS mode"},
+		"tls1.3": {&tls.Config{MaxVersion: tls.VersionTLS13}, "only TLS 1.2 is allowed in FIPS mode"},
+		"insecure": {
+			&tls.Config{InsecureSkipVerify: true}, //nolint:gosec
+			"insecureSkipTLSVerify isn't allowed in FIPS mode",
+		},
+	}
+	for name, tc := range testCases {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			withFIPS(t, true)
+			err := RestrictTLS(tc.conf)
+			if tc.expErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, tc.expErr)
+			}
+		})
+	}
+}
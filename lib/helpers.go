@@ -29,8 +29,14 @@ import (
 )
 
 // StrictJSONUnmarshal decodes a JSON in a strict manner, emitting an error if there
-// are unknown fields or unexpected data
+// are unknown fields or unexpected data. Unknown fields of structs, including the
+// nested ones, are reported as an UnknownKeysError, with suggestions for the
+// likely typos.
 func StrictJSONUnmarshal(data []byte, v interface{}) error {
+	if err := FindUnknownKeys(data, v); err != nil {
+		return err
+	}
+
 	dec := json.NewDecoder(bytes.NewReader(data))
 	dec.DisallowUnknownFields()
 	dec.UseNumber()
@@ -0,0 +1,205 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package history keeps the end-of-test summaries of past test runs in a
+// local database, so the trends of their metrics can be followed across runs.
+//
+// The database is a file with a JSON object for each run per line, so runs
+// are only ever appended to it and it can be inspected and trimmed by hand.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/spf13/afero"
+)
+
+// Run is the summary of a single test run.
+type Run struct {
+	Test   string    `json:"test"`
+	Time   time.Time `json:"time"`
+	Passed bool      `json:"passed"`
+
+	// The values of each metric, e.g. avg, p(95), count, rate or value.
+	Metrics map[string]map[string]float64 `json:"metrics"`
+}
+
+// FromSummaryExport returns the run of the given test with the summary that
+// was exported with --summary-export. The run passed if no threshold failed.
+func FromSummaryExport(test string, t time.Time, data []byte) (*Run, error) {
+	var summary struct {
+		Metrics map[string]map[string]json.RawMessage `json:"metrics"`
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return nil, fmt.Errorf("invalid summary export: %w", err)
+	}
+	if summary.Metrics == nil {
+		return nil, fmt.Errorf("invalid summary export: no metrics")
+	}
+
+	run := &Run{Test: test, Time: t, Passed: true, Metrics: make(map[string]map[string]float64)}
+	for name, values := range summary.Metrics {
+		run.Metrics[name] = make(map[string]float64, len(values))
+		for stat, raw := range values {
+			if stat == "thresholds" {
+				var failed map[string]bool
+				if err := json.Unmarshal(raw, &failed); err != nil {
+					return nil, fmt.Errorf("invalid thresholds of metric %s: %w", name, err)
+				}
+				for _, f := range failed {
+					run.Passed = run.Passed && !f
+				}
+				continue
+			}
+			var v float64
+			if err := json.Unmarshal(raw, &v); err != nil {
+				return nil, fmt.Errorf("invalid %s value of metric %s: %w", stat, name, err)
+			}
+			run.Metrics[name][stat] = v
+		}
+	}
+	return run, nil
+}
+
+// DefaultStat returns the value of the metric that's most telling of its
+// trend, depending on its type, or "" if it has none of them.
+func DefaultStat(values map[string]float64) string {
+	for _, stat := range []string{"p(95)", "avg", "value", "rate", "count"} {
+		if _, ok := values[stat]; ok {
+			return stat
+		}
+	}
+	return ""
+}
+
+// DB is the history database in a file.
+type DB struct {
+	fs   afero.Fs
+	path string
+}
+
+// Open returns the database in the file at path, which is only created once
+// the first run is added.
+func Open(fs afero.Fs, path string) *DB {
+	return &DB{fs: fs, path: path}
+}
+
+// Add appends the run to the database.
+func (db *DB) Add(run *Run) error {
+	line, err := json.Marshal(run)
+	if err != nil {
+		return err
+	}
+	if err = db.fs.MkdirAll(filepath.Dir(db.path), 0o755); err != nil {
+		return err
+	}
+	f, err := db.fs.OpenFile(db.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(append(line, '\n')); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Runs returns the last runs of the test, oldest first, or all of them if
+// last isn't positive.
+func (db *DB) Runs(test string, last int) ([]*Run, error) {
+	all, err := db.all()
+	if err != nil {
+		return nil, err
+	}
+	var runs []*Run
+	for _, run := range all {
+		if run.Test == test {
+			runs = append(runs, run)
+		}
+	}
+	if last > 0 && len(runs) > last {
+		runs = runs[len(runs)-last:]
+	}
+	return runs, nil
+}
+
+// TestInfo is what the database knows about a test.
+type TestInfo struct {
+	Name    string
+	Runs    int
+	LastRun *Run
+}
+
+// Tests returns the tests that have runs in the database, sorted by name.
+func (db *DB) Tests() ([]TestInfo, error) {
+	all, err := db.all()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*TestInfo)
+	for _, run := range all {
+		info, ok := byName[run.Test]
+		if !ok {
+			info = &TestInfo{Name: run.Test}
+			byName[run.Test] = info
+		}
+		info.Runs++
+		info.LastRun = run
+	}
+
+	tests := make([]TestInfo, 0, len(byName))
+	for _, info := range byName {
+		tests = append(tests, *info)
+	}
+	sort.Slice(tests, func(i, j int) bool { return tests[i].Name < tests[j].Name })
+	return tests, nil
+}
+
+func (db *DB) all() ([]*Run, error) {
+	data, err := afero.ReadFile(db.fs, db.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var runs []*Run
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, len(data)+1)
+	for n := 1; scanner.Scan(); n++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		run := new(Run)
+		if err := json.Unmarshal(scanner.Bytes(), run); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid run: %w", db.path, n, err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, scanner.Err()
+}
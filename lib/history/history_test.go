@@ -0,0 +1,98 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package history
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const summaryExport = `{
+	"root_group": {"name": "", "groups": {}, "checks": {}},
+	"metrics": {
+		"http_req_duration": {"avg": 120.5, "p(95)": 200, "thresholds": {"p(95)<500": false}},
+		"http_reqs": {"count": 100, "rate": 10},
+		"checks": {"value": 0.9, "passes": 90, "fails": 10, "thresholds": {"rate>0.95": true}}
+	}
+}`
+
+func TestFromSummaryExport(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	run, err := FromSummaryExport("checkout", now, []byte(summaryExport))
+	require.NoError(t, err)
+
+	assert.Equal(t, "checkout", run.Test)
+	assert.False(t, run.Passed)
+	assert.Equal(t, map[string]float64{"avg": 120.5, "p(95)": 200}, run.Metrics["http_req_duration"])
+	assert.Equal(t, "p(95)", DefaultStat(run.Metrics["http_req_duration"]))
+	assert.Equal(t, "rate", DefaultStat(run.Metrics["http_reqs"]))
+	assert.Equal(t, "value", DefaultStat(run.Metrics["checks"]))
+
+	_, err = FromSummaryExport("checkout", now, []byte(`{"metrics": {"x": {"avg": "slow"}}}`))
+	assert.EqualError(t, err, "invalid avg value of metric x: json: cannot unmarshal string into Go value of type float64")
+	_, err = FromSummaryExport("checkout", now, []byte(`{}`))
+	assert.EqualError(t, err, "invalid summary export: no metrics")
+}
+
+func TestDB(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	db := Open(fs, "/home/k6/history.jsonl")
+
+	runs, err := db.Runs("checkout", 0)
+	require.NoError(t, err)
+	assert.Empty(t, runs)
+
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, db.Add(&Run{
+			Test:    "checkout",
+			Time:    start.Add(time.Duration(i) * time.Hour),
+			Passed:  i != 3,
+			Metrics: map[string]map[string]float64{"http_reqs": {"count": float64(i)}},
+		}))
+	}
+	require.NoError(t, db.Add(&Run{Test: "login", Time: start, Passed: true}))
+
+	runs, err = db.Runs("checkout", 2)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, 3.0, runs[0].Metrics["http_reqs"]["count"])
+	assert.False(t, runs[0].Passed)
+	assert.True(t, runs[1].Time.Equal(start.Add(4*time.Hour)))
+
+	tests, err := db.Tests()
+	require.NoError(t, err)
+	require.Len(t, tests, 2)
+	assert.Equal(t, "checkout", tests[0].Name)
+	assert.Equal(t, 5, tests[0].Runs)
+	assert.Equal(t, "login", tests[1].Name)
+	assert.Equal(t, 1, tests[1].Runs)
+
+	require.NoError(t, afero.WriteFile(fs, "/home/k6/history.jsonl", []byte("{}\nnot json\n"), 0o644))
+	_, err = db.Tests()
+	assert.Contains(t, err.Error(), "/home/k6/history.jsonl:2: invalid run")
+}
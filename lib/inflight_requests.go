@@ -0,0 +1,67 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"sort"
+	"sync"
+)
+
+// InFlightRequests keeps track of the requests that a VU is currently waiting
+// for, so they can be reported when its iteration takes too long to finish,
+// e.g. while it's being drained at the end of a scenario.
+type InFlightRequests struct {
+	mu       sync.Mutex
+	nextID   uint64
+	requests map[uint64]string
+}
+
+// NewInFlightRequests returns an empty InFlightRequests instance.
+func NewInFlightRequests() *InFlightRequests {
+	return &InFlightRequests{requests: make(map[uint64]string)}
+}
+
+// Add registers a request with the given description, e.g. its method and
+// URL, and returns the function that should be called when it's done.
+func (r *InFlightRequests) Add(description string) (done func()) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	id := r.nextID
+	r.nextID++
+	r.requests[id] = description
+	return func() {
+		r.mu.Lock()
+		delete(r.requests, id)
+		r.mu.Unlock()
+	}
+}
+
+// List returns the sorted descriptions of the requests that are in flight.
+func (r *InFlightRequests) List() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	list := make([]string, 0, len(r.requests))
+	for _, description := range r.requests {
+		list = append(list, description)
+	}
+	sort.Strings(list)
+	return list
+}
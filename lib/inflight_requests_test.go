@@ -0,0 +1,44 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInFlightRequests(t *testing.T) {
+	t.Parallel()
+	requests := NewInFlightRequests()
+	assert.Empty(t, requests.List())
+
+	doneGet := requests.Add("GET https://test.k6.io/")
+	donePost := requests.Add("POST https://test.k6.io/login")
+	requests.Add("GET https://test.k6.io/")
+	assert.Equal(t, []string{
+		"GET https://test.k6.io/", "GET https://test.k6.io/", "POST https://test.k6.io/login",
+	}, requests.List())
+
+	doneGet()
+	donePost()
+	assert.Equal(t, []string{"GET https://test.k6.io/"}, requests.List())
+}
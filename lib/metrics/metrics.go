@@ -36,6 +36,16 @@ var (
 	DroppedIterations = stats.New("dropped_iterations", stats.Counter)
 	Errors            = stats.New("errors", stats.Counter)
 
+	// Iterations cut off by the end of the graceful stop, a ramp-down or an abort.
+	IterationsInterrupted = stats.New("iterations_interrupted", stats.Counter)
+
+	// Iterations interrupted for exceeding the iterationTimeout of their scenario.
+	IterationsTimedOut = stats.New("iterations_timed_out", stats.Counter)
+
+	// The highest arrival rate, in iterations/s, at which the targets of an
+	// adaptive-arrival-rate scenario were met.
+	AdaptiveCapacity = stats.New("adaptive_capacity", stats.Gauge)
+
 	// Runner-emitted.
 	Checks        = stats.New("checks", stats.Rate)
 	GroupDuration = stats.New("group_duration", stats.Trend, stats.Time)
@@ -45,12 +55,19 @@ var (
 	HTTPReqFailed         = stats.New("http_req_failed", stats.Rate)
 	HTTPReqDuration       = stats.New("http_req_duration", stats.Trend, stats.Time)
 	HTTPReqBlocked        = stats.New("http_req_blocked", stats.Trend, stats.Time)
+	HTTPReqDNSLookup      = stats.New("http_req_dns_lookup", stats.Trend, stats.Time)
 	HTTPReqConnecting     = stats.New("http_req_connecting", stats.Trend, stats.Time)
 	HTTPReqTLSHandshaking = stats.New("http_req_tls_handshaking", stats.Trend, stats.Time)
 	HTTPReqSending        = stats.New("http_req_sending", stats.Trend, stats.Time)
 	HTTPReqWaiting        = stats.New("http_req_waiting", stats.Trend, stats.Time)
 	HTTPReqReceiving      = stats.New("http_req_receiving", stats.Trend, stats.Time)
 
+	// DNS lookups made by per-scenario resolvers, tagged with the resolver
+	DNSLookupDuration = stats.New("dns_lookup_duration", stats.Trend, stats.Time)
+
+	// Faults injected by the network conditions of scenarios, tagged with the fault
+	NetworkFaults = stats.New("network_faults", stats.Counter)
+
 	// Websocket-related
 	WSSessions         = stats.New("ws_sessions", stats.Counter)
 	WSMessagesSent     = stats.New("ws_msgs_sent", stats.Counter)
@@ -58,10 +75,28 @@ var (
 	WSPing             = stats.New("ws_ping", stats.Trend, stats.Time)
 	WSSessionDuration  = stats.New("ws_session_duration", stats.Trend, stats.Time)
 	WSConnecting       = stats.New("ws_connecting", stats.Trend, stats.Time)
+	WSPingDuration     = stats.New("ws_ping_duration", stats.Trend, stats.Time)
+	WSPongsMissed      = stats.New("ws_pongs_missed", stats.Counter)
+
+	// Socket.IO-related, on top of the ws_* metrics of the underlying WebSocket
+	SocketIOEventsSent     = stats.New("socketio_events_sent", stats.Counter)
+	SocketIOEventsReceived = stats.New("socketio_events_received", stats.Counter)
+	SocketIOAckDuration    = stats.New("socketio_ack_duration", stats.Trend, stats.Time)
+	SocketIOReconnects     = stats.New("socketio_reconnects", stats.Counter)
+
+	// SignalR-related, the time from a hub invocation to its completion
+	SignalRInvocationDuration = stats.New("signalr_invocation_duration", stats.Trend, stats.Time)
+	SignalRStreamItems        = stats.New("signalr_stream_items", stats.Counter)
 
 	// gRPC-related
 	GRPCReqDuration = stats.New("grpc_req_duration", stats.Trend, stats.Time)
 
+	// OAuth-related, kept apart from the http_req_* metrics
+	OAuthTokenDuration = stats.New("oauth_token_duration", stats.Trend, stats.Time)
+
+	// Cloud output-emitted, the bytes sent to the cloud ingest service.
+	CloudDataSent = stats.New("cloud_data_sent", stats.Counter, stats.Data)
+
 	// Network-related; used for future protocols as well.
 	DataSent     = stats.New("data_sent", stats.Counter, stats.Data)
 	DataReceived = stats.New("data_received", stats.Counter, stats.Data)
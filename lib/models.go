@@ -24,6 +24,7 @@ import (
 	"crypto/md5"
 	"encoding/hex"
 	"encoding/json"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
@@ -64,6 +65,11 @@ func (s *Stage) UnmarshalJSON(b []byte) error {
 	return nil
 }
 
+// KnownKeysType implements KnownKeysTyper, the keys are the ones of StageFields.
+func (s *Stage) KnownKeysType([]byte) reflect.Type {
+	return reflect.TypeOf(StageFields{})
+}
+
 func (s Stage) MarshalJSON() ([]byte, error) {
 	return json.Marshal(StageFields(s))
 }
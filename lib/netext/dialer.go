@@ -24,6 +24,7 @@ import (
 	"context"
 	"fmt"
 	"net"
+	"net/http/httptrace"
 	"strconv"
 	"sync/atomic"
 	"time"
@@ -44,6 +45,17 @@ type Dialer struct {
 	BlockedHostnames *types.HostnameTrie
 	Hosts            map[string]*lib.HostAddress
 
+	// Name of the per-scenario resolver, reported as the resolver tag of the
+	// dns_lookup_duration metric. No metric is emitted if empty.
+	ResolverName string
+
+	// Picks the local IP of every new connection instead of the LocalAddr of
+	// the net.Dialer, if set
+	NextLocalIP func() net.IP
+
+	// Tunnel all connections through this SOCKS5 proxy, if set
+	SOCKSProxy *SOCKSProxy
+
 	BytesRead    int64
 	BytesWritten int64
 }
@@ -78,11 +90,18 @@ func (b BlockedHostError) Error() string {
 
 // DialContext wraps the net.Dialer.DialContext and handles the k6 specifics
 func (d *Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
-	dialAddr, err := d.getDialAddr(addr)
+	if d.SOCKSProxy != nil {
+		return d.dialSOCKS(ctx, d.SOCKSProxy, proto, addr)
+	}
+	return d.dialDirect(ctx, proto, addr)
+}
+
+func (d *Dialer) dialDirect(ctx context.Context, proto, addr string) (net.Conn, error) {
+	dialAddr, err := d.getDialAddr(ctx, addr)
 	if err != nil {
 		return nil, err
 	}
-	conn, err := d.Dialer.DialContext(ctx, proto, dialAddr)
+	conn, err := d.netDialer().DialContext(ctx, proto, dialAddr)
 	if err != nil {
 		return nil, err
 	}
@@ -90,6 +109,26 @@ func (d *Dialer) DialContext(ctx context.Context, proto, addr string) (net.Conn,
 	return conn, err
 }
 
+// netDialer returns the net.Dialer for a new connection, bound to the next
+// local IP if they are picked per connection.
+func (d *Dialer) netDialer() *net.Dialer {
+	if d.NextLocalIP == nil {
+		return &d.Dialer
+	}
+	dialer := d.Dialer
+	dialer.LocalAddr = &net.TCPAddr{IP: d.NextLocalIP()}
+	return &dialer
+}
+
+// NewRoundRobinLocalIPs returns a NextLocalIP function rotating through the
+// IPs of the pool, safe for concurrent use by multiple dialers.
+func NewRoundRobinLocalIPs(pool *types.IPPool) func() net.IP {
+	var next uint64
+	return func() net.IP {
+		return pool.GetIP(atomic.AddUint64(&next, 1) - 1)
+	}
+}
+
 // GetTrail creates a new NetTrail instance with the Dialer
 // sent and received data metrics and the supplied times and tags.
 // TODO: Refactor this according to
@@ -141,8 +180,8 @@ func (d *Dialer) GetTrail(
 	}
 }
 
-func (d *Dialer) getDialAddr(addr string) (string, error) {
-	remote, err := d.findRemote(addr)
+func (d *Dialer) getDialAddr(ctx context.Context, addr string) (string, error) {
+	remote, err := d.findRemote(ctx, addr)
 	if err != nil {
 		return "", err
 	}
@@ -156,7 +195,7 @@ func (d *Dialer) getDialAddr(addr string) (string, error) {
 	return remote.String(), nil
 }
 
-func (d *Dialer) findRemote(addr string) (*lib.HostAddress, error) {
+func (d *Dialer) findRemote(ctx context.Context, addr string) (*lib.HostAddress, error) {
 	host, port, err := net.SplitHostPort(addr)
 	if err != nil {
 		return nil, err
@@ -178,7 +217,7 @@ func (d *Dialer) findRemote(addr string) (*lib.HostAddress, error) {
 		return lib.NewHostAddress(ip, port)
 	}
 
-	ip, err = d.Resolver.LookupIP(host)
+	ip, err = d.tracedLookupIP(ctx, host)
 	if err != nil {
 		return nil, err
 	}
@@ -190,6 +229,62 @@ func (d *Dialer) findRemote(addr string) (*lib.HostAddress, error) {
 	return lib.NewHostAddress(ip, port)
 }
 
+// tracedLookupIP calls the DNS hooks of the HTTP client trace in the context,
+// if there is one, around the lookup. The net.Dialer only calls them for its
+// own lookups, and it's only given IP addresses to connect to.
+func (d *Dialer) tracedLookupIP(ctx context.Context, host string) (net.IP, error) {
+	trace := httptrace.ContextClientTrace(ctx)
+	if trace != nil && trace.DNSStart != nil {
+		trace.DNSStart(httptrace.DNSStartInfo{Host: host})
+	}
+	ip, err := d.lookupIP(ctx, host)
+	if trace != nil && trace.DNSDone != nil {
+		info := httptrace.DNSDoneInfo{Err: err}
+		if ip != nil {
+			info.Addrs = []net.IPAddr{{IP: ip}}
+		}
+		trace.DNSDone(info)
+	}
+	return ip, err
+}
+
+// lookupIP resolves the host. With a per-scenario resolver, it also emits the
+// duration of the lookups that weren't answered from the DNS cache, tagged
+// only with the scenario and the resolver to keep the number of time series
+// low.
+func (d *Dialer) lookupIP(ctx context.Context, host string) (net.IP, error) {
+	if d.ResolverName == "" {
+		return d.Resolver.LookupIP(host)
+	}
+
+	var (
+		ip     net.IP
+		cached bool
+		err    error
+	)
+	start := time.Now()
+	if cr, ok := d.Resolver.(CachingResolver); ok {
+		ip, cached, err = cr.LookupIPCached(host)
+	} else {
+		ip, err = d.Resolver.LookupIP(host)
+	}
+	end := time.Now()
+
+	if state := lib.GetState(ctx); state != nil && !cached {
+		tags := map[string]string{"resolver": d.ResolverName}
+		if scenario, ok := state.Tags["scenario"]; ok {
+			tags["scenario"] = scenario
+		}
+		stats.PushIfNotDone(ctx, state.Samples, stats.Sample{
+			Time:   end,
+			Metric: metrics.DNSLookupDuration,
+			Tags:   stats.IntoSampleTags(&tags),
+			Value:  stats.D(end.Sub(start)),
+		})
+	}
+	return ip, err
+}
+
 func (d *Dialer) getConfiguredHost(addr, host, port string) (*lib.HostAddress, error) {
 	if remote, ok := d.Hosts[addr]; ok {
 		return remote, nil
@@ -239,6 +334,11 @@ func (ntr *NetTrail) GetTags() *stats.SampleTags {
 	return ntr.Tags
 }
 
+// SetTags replaces the tags of the trail, e.g. after they were redacted.
+func (ntr *NetTrail) SetTags(tags *stats.SampleTags) {
+	ntr.Tags = tags
+}
+
 // GetTime implements the stats.ConnectedSampleContainer interface.
 func (ntr *NetTrail) GetTime() time.Time {
 	return ntr.EndTime
@@ -21,14 +21,19 @@
 package netext
 
 import (
+	"context"
 	"net"
 	"testing"
+	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
 	"github.com/loadimpact/k6/lib/testutils/mockresolver"
 	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
 )
 
 func TestDialerAddr(t *testing.T) {
@@ -78,7 +83,7 @@ func TestDialerAddr(t *testing.T) {
 		tc := tc
 
 		t.Run(tc.address, func(t *testing.T) {
-			addr, err := dialer.getDialAddr(tc.address)
+			addr, err := dialer.getDialAddr(context.Background(), tc.address)
 
 			if tc.expErr != "" {
 				require.EqualError(t, err, tc.expErr)
@@ -113,7 +118,7 @@ func TestDialerAddrBlockHostnamesStar(t *testing.T) {
 		tc := tc
 
 		t.Run(tc.address, func(t *testing.T) {
-			addr, err := dialer.getDialAddr(tc.address)
+			addr, err := dialer.getDialAddr(context.Background(), tc.address)
 
 			if tc.expErr != "" {
 				require.EqualError(t, err, tc.expErr)
@@ -134,3 +139,75 @@ func newResolver() *mockresolver.MockResolver {
 		}, nil,
 	)
 }
+
+func TestDialerDNSLookupDuration(t *testing.T) {
+	samples := make(chan stats.SampleContainer, 10)
+	ctx := lib.WithState(context.Background(), &lib.State{
+		Samples: samples,
+		Tags:    map[string]string{"scenario": "failover", "vu": "1", "url": "http://example-resolver.com"},
+	})
+
+	// No metric without a per-scenario resolver
+	dialer := NewDialer(net.Dialer{}, newResolver())
+	addr, err := dialer.getDialAddr(ctx, "example-resolver.com:80")
+	require.NoError(t, err)
+	require.Equal(t, "1.2.3.4:80", addr)
+	_, err = dialer.getDialAddr(ctx, "1.2.3.4:80")
+	require.NoError(t, err)
+
+	dialer.ResolverName = "10.0.0.2:53"
+	_, err = dialer.getDialAddr(ctx, "unknown.com:80")
+	require.Error(t, err)
+
+	// Lookups answered from the DNS cache aren't measured
+	dialer.Resolver = NewResolver(newResolver().LookupIPAll, time.Minute, types.DNSfirst, types.DNSpreferIPv4)
+	dialer.ResolverName = "system"
+	for i := 0; i < 3; i++ {
+		_, err = dialer.getDialAddr(ctx, "example-resolver.com:80")
+		require.NoError(t, err)
+	}
+
+	close(samples)
+	var resolvers []string
+	for sc := range samples {
+		for _, sample := range sc.GetSamples() {
+			assert.Equal(t, metrics.DNSLookupDuration, sample.Metric)
+			tags := sample.Tags.CloneTags()
+			assert.Len(t, tags, 2)
+			assert.Equal(t, "failover", tags["scenario"])
+			resolvers = append(resolvers, tags["resolver"])
+		}
+	}
+	assert.Equal(t, []string{"10.0.0.2:53", "system"}, resolvers)
+}
+
+func TestDialerRoundRobinLocalIPs(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer func() { _ = l.Close() }()
+	sources := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			host, _, _ := net.SplitHostPort(conn.RemoteAddr().String())
+			sources <- host
+			_ = conn.Close()
+		}
+	}()
+
+	pool, err := types.NewIPPool("127.0.0.2-127.0.0.4")
+	require.NoError(t, err)
+	next := NewRoundRobinLocalIPs(pool)
+	dialers := []*Dialer{NewDialer(net.Dialer{}, nil), NewDialer(net.Dialer{}, nil)}
+	for i := 0; i < 4; i++ {
+		dialer := dialers[i%2]
+		dialer.NextLocalIP = next
+		conn, err := dialer.DialContext(context.Background(), "tcp", l.Addr().String())
+		require.NoError(t, err)
+		_ = conn.Close()
+		assert.Equal(t, []string{"127.0.0.2", "127.0.0.3", "127.0.0.4", "127.0.0.2"}[i], <-sources)
+	}
+}
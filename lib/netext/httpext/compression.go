@@ -135,31 +135,53 @@ func wrapDecompressionError(err error) error {
 	return err
 }
 
+// countingReader counts the bytes that are read through it.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+// readResponseBody reads the whole response body and returns it in the format
+// specified by respType, together with the size of the body in bytes. The size
+// is always the one of the body as it was received, i.e. before it was
+// decompressed, regardless of the respType. For ResponseTypeNone, the body is
+// never stored anywhere - it's drained through the pooled buffers of
+// ioutil.Discard and only its size is counted.
 func readResponseBody(
 	state *lib.State,
 	respType ResponseType,
 	resp *http.Response,
 	respErr error,
-) (interface{}, error) {
+) (interface{}, int64, error) {
 	if resp == nil || respErr != nil {
-		return nil, respErr
+		return nil, 0, respErr
 	}
 
 	if respType == ResponseTypeNone {
-		_, err := io.Copy(ioutil.Discard, resp.Body)
+		size, err := io.Copy(ioutil.Discard, resp.Body)
 		_ = resp.Body.Close()
 		if err != nil {
 			respErr = err
 		}
-		return nil, respErr
+		return nil, size, respErr
 	}
 
-	rc := &readCloser{resp.Body}
-	// Ensure that the entire response body is read and closed, e.g. in case of decoding errors
-	defer func(respBody io.ReadCloser) {
-		_, _ = io.Copy(ioutil.Discard, respBody)
-		_ = respBody.Close()
-	}(resp.Body)
+	received := &countingReader{Reader: resp.Body}
+	rc := &readCloser{received}
+	// Ensure that the entire response body is read and closed, e.g. in case of
+	// decoding errors. It's drained through the counting reader, so the size
+	// includes any data after the end of the compressed stream as well.
+	drain := func() int64 {
+		_, _ = io.Copy(ioutil.Discard, received)
+		_ = resp.Body.Close()
+		return received.n
+	}
 
 	contentEncodings := strings.Split(resp.Header.Get("Content-Encoding"), ",")
 	// Transparently decompress the body if it's has a content-encoding we
@@ -186,7 +208,7 @@ func readResponseBody(
 				)
 			}
 			if err != nil {
-				return nil, newDecompressionError(err)
+				return nil, drain(), newDecompressionError(err)
 			}
 			rc = &readCloser{decoder}
 		}
@@ -219,5 +241,5 @@ func readResponseBody(
 		respErr = fmt.Errorf("unknown responseType %s", respType)
 	}
 
-	return result, respErr
+	return result, drain(), respErr
 }
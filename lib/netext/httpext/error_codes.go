@@ -23,6 +23,7 @@ package httpext
 import (
 	"crypto/tls"
 	"crypto/x509"
+	stderrors "errors"
 	"fmt"
 	"net"
 	"net/url"
@@ -60,6 +61,7 @@ const (
 	tcpDialRefusedErrorCode  errCode = 1212
 	tcpDialUnknownErrnoCode  errCode = 1213
 	tcpResetByPeerErrorCode  errCode = 1220
+	injectedFaultErrorCode   errCode = 1230
 	// TLS errors
 	defaultTLSErrorCode           errCode = 1300
 	x509UnknownAuthorityErrorCode errCode = 1310
@@ -109,6 +111,13 @@ func http2ErrCodeOffset(code http2.ErrCode) errCode {
 
 // errorCodeForError returns the errorCode and a specific error message for given error.
 func errorCodeForError(err error) (errCode, string) {
+	// injected faults can surface wrapped by net/http, e.g. when the
+	// connection is reset while reading the response headers
+	var fault netext.InjectedFaultError
+	if stderrors.As(err, &fault) {
+		return injectedFaultErrorCode, fault.Error()
+	}
+
 	switch e := errors.Cause(err).(type) {
 	case K6Error:
 		return e.Code, e.Message
@@ -123,6 +132,8 @@ func errorCodeForError(err error) (errCode, string) {
 		return blackListedIPErrorCode, blackListedIPErrorCodeMsg
 	case netext.BlockedHostError:
 		return blockedHostnameErrorCode, blockedHostnameErrorMsg
+	case netext.InjectedFaultError:
+		return injectedFaultErrorCode, e.Error()
 	case *http2.GoAwayError:
 		return unknownHTTP2GoAwayErrorCode + http2ErrCodeOffset(e.ErrCode),
 			fmt.Sprintf(http2GoAwayErrorCodeMsg, e.ErrCode)
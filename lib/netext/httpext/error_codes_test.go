@@ -88,6 +88,19 @@ func TestBlackListedIPError(t *testing.T) {
 	require.Equal(t, blackListedIPErrorCode, errorCode)
 }
 
+func TestInjectedFaultError(t *testing.T) {
+	err := netext.InjectedFaultError{Fault: netext.FaultReset}
+	testErrorCode(t, injectedFaultErrorCode, err)
+	var errorCode, errorMsg = errorCodeForError(&url.Error{
+		Err: fmt.Errorf("net/http: Transport failed to read from server: %w", err),
+	})
+	require.Equal(t, injectedFaultErrorCode, errorCode)
+	require.Equal(t, "injected network fault: connection reset", errorMsg)
+	errorCode, errorMsg = errorCodeForError(err)
+	require.Equal(t, injectedFaultErrorCode, errorCode)
+	require.Equal(t, "injected network fault: connection reset", errorMsg)
+}
+
 type timeoutError bool
 
 func (t timeoutError) Timeout() bool {
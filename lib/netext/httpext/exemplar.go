@@ -0,0 +1,62 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package httpext
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// exemplarFromHeader returns an exemplar with the trace and span IDs of the
+// W3C Trace Context traceparent header of a request, so that its metric
+// samples can be linked to the trace. It returns nil if the request doesn't
+// carry a valid traceparent header.
+func exemplarFromHeader(header http.Header) *stats.Exemplar {
+	// version "-" trace-id "-" parent-id "-" trace-flags, e.g.
+	// 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+	parts := strings.Split(strings.TrimSpace(header.Get("traceparent")), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return nil
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isHexID(traceID, 16) || !isHexID(spanID, 8) || len(flags) != 2 || !isLowerHex(flags) {
+		return nil
+	}
+	return &stats.Exemplar{TraceID: traceID, SpanID: spanID}
+}
+
+// isHexID checks whether s is the lowercase hex encoding of a non-zero ID with
+// the given number of bytes.
+func isHexID(s string, size int) bool {
+	return len(s) == 2*size && isLowerHex(s) && strings.Trim(s, "0") != ""
+}
+
+func isLowerHex(s string) bool {
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
@@ -27,12 +27,15 @@ import (
 
 	uuid "github.com/nu7hatch/gouuid"
 	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/lib/redact"
 )
 
 type httpDebugTransport struct {
 	originalTransport http.RoundTripper
 	httpDebugOption   string
 	logger            logrus.FieldLogger
+	redactor          *redact.Redactor
 }
 
 // RoundTrip prints passing HTTP requests and received responses
@@ -54,6 +57,9 @@ func (t httpDebugTransport) debugRequest(req *http.Request, requestID string) {
 	if err != nil {
 		t.logger.Error(err)
 	}
+	if t.redactor != nil {
+		dump = t.redactor.HTTPDump(dump)
+	}
 	t.logger.WithField("request_id", requestID).Infof("Request:\n%s\n",
 		bytes.ReplaceAll(dump, []byte("\r\n"), []byte{'\n'}))
 }
@@ -64,6 +70,9 @@ func (t httpDebugTransport) debugResponse(res *http.Response, requestID string)
 		if err != nil {
 			t.logger.Error(err)
 		}
+		if t.redactor != nil {
+			dump = t.redactor.HTTPDump(dump)
+		}
 		t.logger.WithField("request_id", requestID).Infof("Response:\n%s\n",
 			bytes.ReplaceAll(dump, []byte("\r\n"), []byte{'\n'}))
 	}
@@ -163,6 +163,7 @@ func updateK6Response(k6Response *Response, finishedReq *finishedRequest) {
 	k6Response.Timings = ResponseTimings{
 		Duration:       stats.D(trail.Duration),
 		Blocked:        stats.D(trail.Blocked),
+		LookingUp:      stats.D(trail.DNSLookup),
 		Connecting:     stats.D(trail.Connecting),
 		TLSHandshaking: stats.D(trail.TLSHandshaking),
 		Sending:        stats.D(trail.Sending),
@@ -250,6 +251,10 @@ func MakeRequest(ctx context.Context, preq *ParsedHTTPRequest) (*Response, error
 		}
 	}
 
+	if state.InFlightRequests != nil {
+		defer state.InFlightRequests.Add(preq.Req.Method + " " + preq.URL.Clean())()
+	}
+
 	tracerTransport := newTransport(ctx, state, tags, preq.ResponseCallback)
 	var transport http.RoundTripper = tracerTransport
 
@@ -265,6 +270,7 @@ func MakeRequest(ctx context.Context, preq *ParsedHTTPRequest) (*Response, error
 		transport = httpDebugTransport{
 			originalTransport: transport,
 			httpDebugOption:   state.Options.HTTPDebug.String,
+			redactor:          state.Redactor,
 			logger:            state.Logger.WithFields(combinedLogFields),
 		}
 	}
@@ -338,7 +344,7 @@ func MakeRequest(ctx context.Context, preq *ParsedHTTPRequest) (*Response, error
 		return nil, fmt.Errorf("unsupported response status: %s", res.Status)
 	}
 
-	resp.Body, resErr = readResponseBody(state, preq.ResponseType, res, resErr)
+	resp.Body, resp.BodySize, resErr = readResponseBody(state, preq.ResponseType, res, resErr)
 	finishedReq := tracerTransport.processLastSavedRequest(wrapDecompressionError(resErr))
 	if finishedReq != nil {
 		updateK6Response(resp, finishedReq)
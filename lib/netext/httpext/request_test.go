@@ -22,6 +22,7 @@ package httpext
 
 import (
 	"bytes"
+	"compress/zlib"
 	"context"
 	"io"
 	"io/ioutil"
@@ -262,7 +263,7 @@ func TestMakeRequestTimeout(t *testing.T) {
 	assert.Len(t, samples, 1)
 	sampleCont := <-samples
 	allSamples := sampleCont.GetSamples()
-	require.Len(t, allSamples, 8)
+	require.Len(t, allSamples, 9)
 	expTags := map[string]string{
 		"error":      "context deadline exceeded",
 		"error_code": "1000",
@@ -349,3 +350,26 @@ func TestTrailFailed(t *testing.T) {
 		})
 	}
 }
+
+func TestReadResponseBodyCountsDrainedData(t *testing.T) {
+	t.Parallel()
+	var body bytes.Buffer
+	w := zlib.NewWriter(&body)
+	_, err := w.Write([]byte("hello"))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	compressedLen := body.Len()
+	// the data after the end of the compressed stream isn't read by the
+	// decoder, only when the body is drained
+	body.Write(make([]byte, 10000))
+
+	resp := &http.Response{
+		Header: http.Header{"Content-Encoding": {"deflate"}},
+		Body:   ioutil.NopCloser(&body),
+	}
+	state := &lib.State{BPool: bpool.NewBufferPool(1)}
+	result, size, err := readResponseBody(state, ResponseTypeText, resp, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", result)
+	assert.Equal(t, int64(compressedLen+10000), size)
+}
@@ -54,6 +54,7 @@ const (
 	// to null. This saves CPU and memory and is suitable for HTTP requests that we just
 	// want to  measure, but we don't care about their responses' contents. This is the
 	// default value for all requests if the global discardResponseBodies is enablled.
+	// Only the size of the received body is available, as the response body_size.
 	ResponseTypeNone
 )
 
@@ -101,6 +102,7 @@ type Response struct {
 	Headers        map[string]string        `json:"headers"`
 	Cookies        map[string][]*HTTPCookie `json:"cookies"`
 	Body           interface{}              `json:"body"`
+	BodySize       int64                    `json:"body_size"` // as received, before decompressing it
 	Timings        ResponseTimings          `json:"timings"`
 	TLSVersion     string                   `json:"tls_version"`
 	TLSCipherSuite string                   `json:"tls_cipher_suite"`
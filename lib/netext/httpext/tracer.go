@@ -44,6 +44,7 @@ type Trail struct {
 	Duration time.Duration
 
 	Blocked        time.Duration // Waiting to acquire a connection.
+	DNSLookup      time.Duration // Resolving the remote host.
 	Connecting     time.Duration // Connecting to remote host.
 	TLSHandshaking time.Duration // Executing TLS handshake.
 	Sending        time.Duration // Writing request.
@@ -54,7 +55,16 @@ type Trail struct {
 	ConnReused     bool
 	ConnRemoteAddr net.Addr
 
+	// Whether the TLS handshake was a "full" or a "resumed" one, empty if
+	// there was no handshake for this request.
+	TLSHandshake string
+
 	Failed null.Bool
+
+	// The trace the request belongs to, if it carried a traceparent header;
+	// it's attached to all samples as an exemplar.
+	Exemplar *stats.Exemplar
+
 	// Populated by SaveSamples()
 	Tags    *stats.SampleTags
 	Samples []stats.Sample
@@ -63,17 +73,27 @@ type Trail struct {
 // SaveSamples populates the Trail's sample slice so they're accesible via GetSamples()
 func (tr *Trail) SaveSamples(tags *stats.SampleTags) {
 	tr.Tags = tags
-	tr.Samples = make([]stats.Sample, 0, 9) // this is with 1 more for a possible HTTPReqFailed
-	tr.Samples = append(tr.Samples, []stats.Sample{
-		{Metric: metrics.HTTPReqs, Time: tr.EndTime, Tags: tags, Value: 1},
-		{Metric: metrics.HTTPReqDuration, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Duration)},
-		{Metric: metrics.HTTPReqBlocked, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Blocked)},
-		{Metric: metrics.HTTPReqConnecting, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Connecting)},
-		{Metric: metrics.HTTPReqTLSHandshaking, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.TLSHandshaking)},
-		{Metric: metrics.HTTPReqSending, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Sending)},
-		{Metric: metrics.HTTPReqWaiting, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Waiting)},
-		{Metric: metrics.HTTPReqReceiving, Time: tr.EndTime, Tags: tags, Value: stats.D(tr.Receiving)},
-	}...)
+	// The slice is allocated only once and filled in place, with 1 more slot
+	// of capacity for a possible HTTPReqFailed sample, to avoid a re-allocation.
+	tr.Samples = make([]stats.Sample, 9, 10)
+	for i, s := range [9]struct {
+		metric *stats.Metric
+		value  float64
+	}{
+		{metrics.HTTPReqs, 1},
+		{metrics.HTTPReqDuration, stats.D(tr.Duration)},
+		{metrics.HTTPReqBlocked, stats.D(tr.Blocked)},
+		{metrics.HTTPReqDNSLookup, stats.D(tr.DNSLookup)},
+		{metrics.HTTPReqConnecting, stats.D(tr.Connecting)},
+		{metrics.HTTPReqTLSHandshaking, stats.D(tr.TLSHandshaking)},
+		{metrics.HTTPReqSending, stats.D(tr.Sending)},
+		{metrics.HTTPReqWaiting, stats.D(tr.Waiting)},
+		{metrics.HTTPReqReceiving, stats.D(tr.Receiving)},
+	} {
+		tr.Samples[i] = stats.Sample{
+			Metric: s.metric, Time: tr.EndTime, Tags: tags, Value: s.value, Exemplar: tr.Exemplar,
+		}
+	}
 }
 
 // GetSamples implements the stats.SampleContainer interface.
@@ -86,6 +106,11 @@ func (tr *Trail) GetTags() *stats.SampleTags {
 	return tr.Tags
 }
 
+// SetTags replaces the tags of the trail, e.g. after they were redacted.
+func (tr *Trail) SetTags(tags *stats.SampleTags) {
+	tr.Tags = tags
+}
+
 // GetTime implements the stats.ConnectedSampleContainer interface.
 func (tr *Trail) GetTime() time.Time {
 	return tr.EndTime
@@ -101,6 +126,8 @@ var _ stats.ConnectedSampleContainer = &Trail{}
 // Cheers, love, the cavalry's here.
 type Tracer struct {
 	getConn              int64
+	dnsStart             int64
+	dnsDone              int64
 	connectStart         int64
 	connectDone          int64
 	tlsHandshakeStart    int64
@@ -108,6 +135,7 @@ type Tracer struct {
 	gotConn              int64
 	wroteRequest         int64
 	gotFirstResponseByte int64
+	tlsResumed           int32 // 0 if there was no handshake, 1 for a full one, 2 if resumed
 
 	connReused     bool
 	connRemoteAddr net.Addr
@@ -117,6 +145,8 @@ type Tracer struct {
 func (t *Tracer) Trace() *httptrace.ClientTrace {
 	return &httptrace.ClientTrace{
 		GetConn:              t.GetConn,
+		DNSStart:             t.DNSStart,
+		DNSDone:              t.DNSDone,
 		ConnectStart:         t.ConnectStart,
 		ConnectDone:          t.ConnectDone,
 		TLSHandshakeStart:    t.TLSHandshakeStart,
@@ -143,6 +173,20 @@ func (t *Tracer) GetConn(hostPort string) {
 	t.getConn = now()
 }
 
+// DNSStart is called when the k6 dialer starts to resolve the host of a new
+// connection. It isn't called for IP addresses, hosts from the hosts option
+// or reused connections.
+func (t *Tracer) DNSStart(info httptrace.DNSStartInfo) {
+	atomic.CompareAndSwapInt64(&t.dnsStart, 0, now())
+}
+
+// DNSDone is called when the lookup that DNSStart() was called for is done,
+// whether it was successful or not. If the connection isn't reused, it will
+// be called after GetConn() and before ConnectStart().
+func (t *Tracer) DNSDone(info httptrace.DNSDoneInfo) {
+	atomic.CompareAndSwapInt64(&t.dnsDone, 0, now())
+}
+
 // ConnectStart is called when a new connection's Dial begins.
 // If net.Dialer.DualStack (IPv6 "Happy Eyeballs") support is
 // enabled, this may be called multiple times.
@@ -197,6 +241,11 @@ func (t *Tracer) TLSHandshakeStart() {
 func (t *Tracer) TLSHandshakeDone(state tls.ConnectionState, err error) {
 	if err == nil {
 		atomic.CompareAndSwapInt64(&t.tlsHandshakeDone, 0, now())
+		resumed := int32(1)
+		if state.DidResume {
+			resumed = 2
+		}
+		atomic.CompareAndSwapInt32(&t.tlsResumed, 0, resumed)
 	}
 	// if there is an error it will be returned by the http call
 }
@@ -224,6 +273,8 @@ func (t *Tracer) GotConn(info httptrace.GotConnInfo) {
 	// put incorrect values in them (they use CompareAndSwap)
 	_, isConnTLS := info.Conn.(*tls.Conn)
 	if info.Reused {
+		atomic.SwapInt64(&t.dnsStart, now)
+		atomic.SwapInt64(&t.dnsDone, now)
 		atomic.SwapInt64(&t.connectStart, now)
 		atomic.SwapInt64(&t.connectDone, now)
 		if isConnTLS {
@@ -284,6 +335,8 @@ func (t *Tracer) Done() *Trail {
 	// already returned our result and we've called Done(). This happens
 	// mostly for cancelled requests, but we have to use atomics here as
 	// well (or use global Tracer locking) so we can avoid data races.
+	dnsStart := atomic.LoadInt64(&t.dnsStart)
+	dnsDone := atomic.LoadInt64(&t.dnsDone)
 	connectStart := atomic.LoadInt64(&t.connectStart)
 	connectDone := atomic.LoadInt64(&t.connectDone)
 	tlsHandshakeStart := atomic.LoadInt64(&t.tlsHandshakeStart)
@@ -292,12 +345,21 @@ func (t *Tracer) Done() *Trail {
 	wroteRequest := atomic.LoadInt64(&t.wroteRequest)
 	gotFirstResponseByte := atomic.LoadInt64(&t.gotFirstResponseByte)
 
+	if dnsDone != 0 && dnsStart != 0 {
+		trail.DNSLookup = time.Duration(dnsDone - dnsStart)
+	}
 	if connectDone != 0 && connectStart != 0 {
 		trail.Connecting = time.Duration(connectDone - connectStart)
 	}
 	if tlsHandshakeDone != 0 && tlsHandshakeStart != 0 {
 		trail.TLSHandshaking = time.Duration(tlsHandshakeDone - tlsHandshakeStart)
 	}
+	switch atomic.LoadInt32(&t.tlsResumed) {
+	case 1:
+		trail.TLSHandshake = "full"
+	case 2:
+		trail.TLSHandshake = "resumed"
+	}
 	if wroteRequest != 0 {
 		if tlsHandshakeDone != 0 {
 			// If the request was sent over TLS, we need to use
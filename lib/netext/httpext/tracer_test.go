@@ -61,6 +61,16 @@ func getTestTracer(t *testing.T) (*Tracer, *httptrace.ClientTrace) {
 		// So we force delays in the ClientTrace event handlers
 		// to hopefully reduce the chances of this happening.
 		ct = &httptrace.ClientTrace{
+			DNSStart: func(i httptrace.DNSStartInfo) {
+				t.Logf("called DNSStart at\t\t%v\n", now())
+				time.Sleep(traceDelay)
+				tracer.DNSStart(i)
+			},
+			DNSDone: func(i httptrace.DNSDoneInfo) {
+				t.Logf("called DNSDone at\t\t%v\n", now())
+				time.Sleep(traceDelay)
+				tracer.DNSDone(i)
+			},
 			ConnectStart: func(a, n string) {
 				t.Logf("called ConnectStart at\t\t%v\n", now())
 				time.Sleep(traceDelay)
@@ -114,10 +124,20 @@ func TestTracer(t *testing.T) {
 
 	transport, ok := srv.Client().Transport.(*http.Transport)
 	assert.True(t, ok)
+	// The certificate of the test server is valid for example.com, so it's
+	// used to trace the DNS lookup of the k6 dialer
+	lookup := func(host string) ([]net.IP, error) {
+		time.Sleep(time.Millisecond)
+		if host == "example.com" {
+			return []net.IP{net.ParseIP("127.0.0.1")}, nil
+		}
+		return net.LookupIP(host)
+	}
 	transport.DialContext = netext.NewDialer(
 		net.Dialer{},
-		netext.NewResolver(net.LookupIP, 0, types.DNSfirst, types.DNSpreferIPv4),
+		netext.NewResolver(lookup, 0, types.DNSfirst, types.DNSpreferIPv4),
 	).DialContext
+	srvURL := strings.Replace(srv.URL, "127.0.0.1", "example.com", 1)
 
 	var prev int64
 	assertLaterOrZero := func(t *testing.T, val int64, canBeZero bool) {
@@ -135,7 +155,7 @@ func TestTracer(t *testing.T) {
 	for tnum, isReuse := range []bool{false, true, true} {
 		t.Run(fmt.Sprintf("Test #%d", tnum), func(t *testing.T) {
 			// Do not enable parallel testing, test relies on sequential execution
-			req, err := http.NewRequest("GET", srv.URL+"/get", nil)
+			req, err := http.NewRequest("GET", srvURL+"/get", nil)
 			require.NoError(t, err)
 
 			tracer, ct := getTestTracer(t)
@@ -153,6 +173,8 @@ func TestTracer(t *testing.T) {
 			samples := trail.GetSamples()
 
 			assertLaterOrZero(t, tracer.getConn, isReuse)
+			assertLaterOrZero(t, tracer.dnsStart, isReuse)
+			assertLaterOrZero(t, tracer.dnsDone, isReuse)
 			assertLaterOrZero(t, tracer.connectStart, isReuse)
 			assertLaterOrZero(t, tracer.connectDone, isReuse)
 			assertLaterOrZero(t, tracer.tlsHandshakeStart, isReuse)
@@ -164,7 +186,7 @@ func TestTracer(t *testing.T) {
 
 			assert.Equal(t, strings.TrimPrefix(srv.URL, "https://"), trail.ConnRemoteAddr.String())
 
-			assert.Len(t, samples, 8)
+			assert.Len(t, samples, 9)
 			seenMetrics := map[*stats.Metric]bool{}
 			for i, s := range samples {
 				assert.NotContains(t, seenMetrics, s.Metric)
@@ -177,7 +199,7 @@ func TestTracer(t *testing.T) {
 				case metrics.HTTPReqs:
 					assert.Equal(t, 1.0, s.Value)
 					assert.Equal(t, 0, i, "`HTTPReqs` is reported before the other HTTP metrics")
-				case metrics.HTTPReqConnecting, metrics.HTTPReqTLSHandshaking:
+				case metrics.HTTPReqDNSLookup, metrics.HTTPReqConnecting, metrics.HTTPReqTLSHandshaking:
 					if isReuse {
 						assert.Equal(t, 0.0, s.Value)
 						break
@@ -95,7 +95,9 @@ func newTransport(
 func (t *transport) measureAndEmitMetrics(unfReq *unfinishedRequest) *finishedRequest {
 	trail := unfReq.tracer.Done()
 
-	tags := map[string]string{}
+	// Pre-size the map for the user tags and the most common system tags, so
+	// it doesn't have to be grown repeatedly while we fill it below.
+	tags := make(map[string]string, len(t.tags)+8)
 	for k, v := range t.tags {
 		tags[k] = v
 	}
@@ -117,7 +119,7 @@ func (t *transport) measureAndEmitMetrics(unfReq *unfinishedRequest) *finishedRe
 			tags["url"] = cleanURL
 		}
 		if setName {
-			tags["name"] = cleanURL
+			tags["name"] = t.state.Options.URLGrouping.Grouping.Group(cleanURL)
 		}
 	}
 
@@ -185,7 +187,19 @@ func (t *transport) measureAndEmitMetrics(unfReq *unfinishedRequest) *finishedRe
 	}
 
 	finalTags := stats.IntoSampleTags(&tags)
+	trail.Exemplar = exemplarFromHeader(unfReq.request.Header)
 	trail.SaveSamples(finalTags)
+	if enabledTags.Has(stats.TagTLSHandshake) && trail.TLSHandshake != "" {
+		// Only the handshake duration is tagged, so that the rest of the
+		// request metrics aren't split by an extra tag
+		handshakeTags := finalTags.CloneTags()
+		handshakeTags["tls_handshake"] = trail.TLSHandshake
+		for i := range trail.Samples {
+			if trail.Samples[i].Metric == metrics.HTTPReqTLSHandshaking {
+				trail.Samples[i].Tags = stats.IntoSampleTags(&handshakeTags)
+			}
+		}
+	}
 	if t.responseCallback != nil {
 		trail.Failed.Valid = true
 		if failed == 1 {
@@ -194,6 +208,7 @@ func (t *transport) measureAndEmitMetrics(unfReq *unfinishedRequest) *finishedRe
 		trail.Samples = append(trail.Samples,
 			stats.Sample{
 				Metric: metrics.HTTPReqFailed, Time: trail.EndTime, Tags: finalTags, Value: failed,
+				Exemplar: trail.Exemplar,
 			},
 		)
 	}
@@ -29,6 +29,8 @@ import (
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/stats"
 	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func BenchmarkMeasureAndEmitMetrics(b *testing.B) {
@@ -84,3 +86,62 @@ func BenchmarkMeasureAndEmitMetrics(b *testing.B) {
 		}
 	})
 }
+
+func TestExemplarFromHeader(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]*stats.Exemplar{
+		"": nil,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01": {
+			TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7",
+		},
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future": {
+			TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7",
+		},
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra": nil,
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01":       nil,
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01":       nil,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01":       nil,
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01":       nil,
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01":         nil,
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-0x":       nil,
+	}
+	for value, expected := range testCases {
+		value, expected := value, expected
+		t.Run(value, func(t *testing.T) {
+			t.Parallel()
+			header := http.Header{}
+			if value != "" {
+				header.Set("traceparent", value)
+			}
+			assert.Equal(t, expected, exemplarFromHeader(header))
+		})
+	}
+}
+
+func TestMeasureAndEmitMetricsExemplar(t *testing.T) {
+	t.Parallel()
+	samples := make(chan stats.SampleContainer, 1)
+	tr := transport{
+		ctx: context.Background(),
+		state: &lib.State{
+			Options: lib.Options{SystemTags: &stats.DefaultSystemTagSet},
+			Samples: samples,
+			Logger:  logrus.New(),
+		},
+		responseCallback: func(int) bool { return true },
+	}
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	tr.measureAndEmitMetrics(&unfinishedRequest{
+		tracer:   &Tracer{},
+		response: &http.Response{StatusCode: 200},
+		request:  &http.Request{URL: &url.URL{Host: "example.com", Scheme: "https"}, Header: header},
+	})
+
+	expected := &stats.Exemplar{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	emitted := (<-samples).GetSamples()
+	require.Len(t, emitted, 10)
+	for _, sample := range emitted {
+		assert.Equal(t, expected, sample.Exemplar, sample.Metric.Name)
+	}
+}
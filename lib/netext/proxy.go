@@ -0,0 +1,93 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+)
+
+type hostProxy struct {
+	trie  *types.HostnameTrie
+	proxy *url.URL // nil for direct connections
+}
+
+// NewProxyFunc returns a function choosing the proxy for each request, as
+// needed by http.Transport, according to the proxy settings of a scenario.
+// Requests that none of the settings apply to use the proxy from the
+// environment.
+func NewProxyFunc(conf lib.ScenarioProxy) (func(*http.Request) (*url.URL, error), error) {
+	var defaultProxy *url.URL
+	// connections are tunneled through SOCKS proxies by the dialer instead
+	direct := lib.IsSOCKSProxyURL(conf.URL.String)
+	if conf.URL.Valid && !direct {
+		u, err := url.Parse(conf.URL.String)
+		if err != nil {
+			return nil, err
+		}
+		defaultProxy = u
+	}
+
+	hosts := make([]hostProxy, 0, len(conf.Hosts))
+	for pattern, proxy := range conf.Hosts {
+		trie, err := types.NewHostnameTrie([]string{pattern})
+		if err != nil {
+			return nil, err
+		}
+		hp := hostProxy{trie: trie}
+		if proxy != lib.ScenarioProxyDirect {
+			if hp.proxy, err = url.Parse(proxy); err != nil {
+				return nil, err
+			}
+		}
+		hosts = append(hosts, hp)
+	}
+
+	return func(req *http.Request) (*url.URL, error) {
+		host := req.URL.Hostname()
+		if ip := net.ParseIP(host); ip == nil {
+			if conf.NoProxy.Valid {
+				if _, ok := conf.NoProxy.Trie.Contains(host); ok {
+					return nil, nil
+				}
+			}
+			// the most specific, i.e. longest, matching pattern wins
+			var match *hostProxy
+			longest := -1
+			for i, hp := range hosts {
+				if pattern, ok := hp.trie.Contains(host); ok && len(pattern) > longest {
+					match, longest = &hosts[i], len(pattern)
+				}
+			}
+			if match != nil {
+				return match.proxy, nil
+			}
+		}
+		if defaultProxy != nil || direct {
+			return defaultProxy, nil
+		}
+		return http.ProxyFromEnvironment(req)
+	}, nil
+}
@@ -0,0 +1,92 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+)
+
+func TestProxyFunc(t *testing.T) {
+	t.Parallel()
+	noProxy, err := types.NewNullHostnameTrie([]string{"*.internal", "localhost"})
+	require.NoError(t, err)
+	proxy, err := NewProxyFunc(lib.ScenarioProxy{
+		URL:     null.StringFrom("http://proxy.eu:3128"),
+		NoProxy: noProxy,
+		Hosts: map[string]string{
+			"*.example.com":   "http://proxy.us:3128",
+			"api.example.com": "socks5://proxy.asia:1080",
+			"cdn.example.com": lib.ScenarioProxyDirect,
+		},
+	})
+	require.NoError(t, err)
+
+	testCases := map[string]string{
+		"http://test.k6.io/":              "http://proxy.eu:3128",
+		"https://10.0.0.1/":               "http://proxy.eu:3128",
+		"http://db.internal:8080/":        "",
+		"http://localhost/":               "",
+		"https://www.example.com/":        "http://proxy.us:3128",
+		"https://api.example.com/v1":      "socks5://proxy.asia:1080",
+		"https://cdn.example.com/app.css": "",
+	}
+	for reqURL, expected := range testCases {
+		req, err := http.NewRequest(http.MethodGet, reqURL, nil)
+		require.NoError(t, err)
+		u, err := proxy(req)
+		require.NoError(t, err)
+		if expected == "" {
+			assert.Nil(t, u, reqURL)
+		} else if assert.NotNil(t, u, reqURL) {
+			assert.Equal(t, expected, u.String(), reqURL)
+		}
+	}
+}
+
+func TestProxyFuncEnvironmentFallback(t *testing.T) {
+	t.Parallel()
+	proxy, err := NewProxyFunc(lib.ScenarioProxy{
+		Hosts: map[string]string{"test.k6.io": "http://proxy.eu:3128"},
+	})
+	require.NoError(t, err)
+
+	req, err := http.NewRequest(http.MethodGet, "http://test.k6.io/", nil)
+	require.NoError(t, err)
+	u, err := proxy(req)
+	require.NoError(t, err)
+	assert.Equal(t, "http://proxy.eu:3128", u.String())
+
+	req, err = http.NewRequest(http.MethodGet, "http://other.k6.io/", nil)
+	require.NoError(t, err)
+	u, err = proxy(req)
+	require.NoError(t, err)
+	expected, err := http.ProxyFromEnvironment(req)
+	require.NoError(t, err)
+	assert.Equal(t, expected, u)
+}
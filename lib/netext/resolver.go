@@ -21,6 +21,7 @@
 package netext
 
 import (
+	"context"
 	"math/rand"
 	"net"
 	"sync"
@@ -32,11 +33,56 @@ import (
 // MultiResolver returns all IP addresses for the given host.
 type MultiResolver func(host string) ([]net.IP, error)
 
+// NewServersResolver returns a MultiResolver querying the given DNS servers,
+// as ip:port addresses, in order. The next server is only tried if the
+// previous one fails or doesn't answer within the timeout, so that DNS
+// failover can be tested. Hosts that don't exist aren't looked up again.
+func NewServersResolver(servers []string, timeout time.Duration) MultiResolver {
+	resolvers := make([]*net.Resolver, len(servers))
+	for i, server := range servers {
+		server := server
+		resolvers[i] = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return func(host string) ([]net.IP, error) {
+		var err error
+		for _, r := range resolvers {
+			var addrs []net.IPAddr
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			addrs, err = r.LookupIPAddr(ctx, host)
+			cancel()
+			if err == nil {
+				ips := make([]net.IP, len(addrs))
+				for i, addr := range addrs {
+					ips[i] = addr.IP
+				}
+				return ips, nil
+			}
+			if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+				return nil, err
+			}
+		}
+		return nil, err
+	}
+}
+
 // Resolver is an interface that returns DNS information about a given host.
 type Resolver interface {
 	LookupIP(host string) (net.IP, error)
 }
 
+// CachingResolver is a Resolver that can tell whether a lookup was answered
+// from its cache, without querying DNS.
+type CachingResolver interface {
+	Resolver
+	LookupIPCached(host string) (ip net.IP, cached bool, err error)
+}
+
 type resolver struct {
 	resolve     MultiResolver
 	selectIndex types.DNSSelect
@@ -87,13 +133,19 @@ func NewResolver(
 // LookupIP returns a single IP resolved for host, selected according to the
 // configured select and policy options.
 func (r *resolver) LookupIP(host string) (net.IP, error) {
+	ip, _, err := r.LookupIPCached(host)
+	return ip, err
+}
+
+// LookupIPCached is like LookupIP; lookups are never answered from a cache.
+func (r *resolver) LookupIPCached(host string) (net.IP, bool, error) {
 	ips, err := r.resolve(host)
 	if err != nil {
-		return nil, err
+		return nil, false, err
 	}
 
 	ips = r.applyPolicy(ips)
-	return r.selectOne(host, ips), nil
+	return r.selectOne(host, ips), false, nil
 }
 
 // LookupIP returns a single IP resolved for host, selected according to the
@@ -101,18 +153,27 @@ func (r *resolver) LookupIP(host string) (net.IP, error) {
 // refreshed if the last lookup time exceeds the configured TTL (not the TTL
 // returned in the DNS record).
 func (r *cacheResolver) LookupIP(host string) (net.IP, error) {
+	ip, _, err := r.LookupIPCached(host)
+	return ip, err
+}
+
+// LookupIPCached is like LookupIP, and also returns whether the IP was
+// answered from the cache.
+func (r *cacheResolver) LookupIPCached(host string) (net.IP, bool, error) {
 	r.cm.Lock()
 
 	var ips []net.IP
 	// TODO: Invalidate? When?
-	if cr, ok := r.cache[host]; ok && time.Now().Before(cr.lastLookup.Add(r.ttl)) {
+	cr, cached := r.cache[host]
+	cached = cached && time.Now().Before(cr.lastLookup.Add(r.ttl))
+	if cached {
 		ips = cr.ips
 	} else {
 		r.cm.Unlock() // The lookup could take some time, so unlock momentarily.
 		var err error
 		ips, err = r.resolve(host)
 		if err != nil {
-			return nil, err
+			return nil, false, err
 		}
 		ips = r.applyPolicy(ips)
 		r.cm.Lock()
@@ -121,7 +182,7 @@ func (r *cacheResolver) LookupIP(host string) (net.IP, error) {
 
 	r.cm.Unlock()
 
-	return r.selectOne(host, ips), nil
+	return r.selectOne(host, ips), cached, nil
 }
 
 func (r *resolver) selectOne(host string, ips []net.IP) net.IP {
@@ -114,3 +114,26 @@ func TestResolver(t *testing.T) {
 		}
 	})
 }
+
+func TestServersResolver(t *testing.T) {
+	t.Parallel()
+	dead := mockresolver.NewDNSServer(t, nil)
+	server := mockresolver.NewDNSServer(t, map[string][]net.IP{
+		"k6.test": {net.ParseIP("127.0.0.10"), net.ParseIP("2001:db8::10")},
+	})
+
+	// the first server is unreachable, so the next one answers
+	r := NewServersResolver([]string{"127.0.0.1:1", server.Addr}, time.Second)
+	ips, err := r("k6.test")
+	require.NoError(t, err)
+	require.Len(t, ips, 2)
+	assert.ElementsMatch(t, []string{"127.0.0.10", "2001:db8::10"}, []string{ips[0].String(), ips[1].String()})
+
+	// hosts that don't exist aren't looked up in the next server
+	r = NewServersResolver([]string{dead.Addr, server.Addr}, time.Second)
+	queries := server.Queries()
+	_, err = r("unknown.k6.test")
+	require.Error(t, err)
+	assert.True(t, dead.Queries() > 0)
+	assert.Equal(t, queries, server.Queries())
+}
@@ -0,0 +1,301 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// The network faults that can be injected, as tagged in the network_faults
+// metric.
+const (
+	FaultDrop  = "drop"
+	FaultReset = "reset"
+	FaultStall = "stall"
+)
+
+// defaultStallDuration is how long stalled connections stop receiving data, if
+// the stall duration isn't configured.
+const defaultStallDuration = 5 * time.Second
+
+// InjectedFaultError is returned for connections that were dropped or reset
+// by the network conditions of a scenario.
+type InjectedFaultError struct {
+	Fault string
+}
+
+func (e InjectedFaultError) Error() string {
+	if e.Fault == FaultDrop {
+		return "injected network fault: connection dropped"
+	}
+	return "injected network fault: connection reset"
+}
+
+// ShapedDialer wraps another dialer and simulates the given network
+// conditions on all connections it dials. The bandwidth limits are shared by
+// all of its connections.
+type ShapedDialer struct {
+	lib.DialContexter
+
+	download, upload *rate.Limiter
+	latency, jitter  time.Duration
+
+	dropRate, resetRate, stallRate float64
+	stallDuration                  time.Duration
+
+	randMu sync.Mutex
+	rand   *rand.Rand
+}
+
+// NewShapedDialer returns a dialer simulating the network conditions of a
+// scenario on top of the given dialer.
+func NewShapedDialer(dialer lib.DialContexter, conf lib.ScenarioNetwork) *ShapedDialer {
+	d := &ShapedDialer{
+		DialContexter: dialer,
+		download:      newBandwidthLimiter(conf.DownloadKbps.Int64),
+		upload:        newBandwidthLimiter(conf.UploadKbps.Int64),
+		latency:       time.Duration(conf.Latency.Duration),
+		jitter:        time.Duration(conf.Jitter.Duration),
+		dropRate:      conf.DropRate.Float64,
+		resetRate:     conf.ResetRate.Float64,
+		stallRate:     conf.StallRate.Float64,
+		stallDuration: time.Duration(conf.StallDuration.Duration),
+		rand:          rand.New(rand.NewSource(time.Now().UnixNano())), //nolint:gosec
+	}
+	if !conf.StallDuration.Valid {
+		d.stallDuration = defaultStallDuration
+	}
+	return d
+}
+
+// Seed makes the jitter and the injected faults reproducible.
+func (d *ShapedDialer) Seed(seed int64) {
+	d.randMu.Lock()
+	d.rand.Seed(seed)
+	d.randMu.Unlock()
+}
+
+func (d *ShapedDialer) randFloat64() float64 {
+	d.randMu.Lock()
+	defer d.randMu.Unlock()
+	return d.rand.Float64()
+}
+
+func (d *ShapedDialer) randInt63n(n int64) int64 {
+	d.randMu.Lock()
+	defer d.randMu.Unlock()
+	return d.rand.Int63n(n)
+}
+
+// newBandwidthLimiter returns a limiter of bytes for the given kilobits per
+// second, or nil if kbps isn't positive. The burst is 50ms worth of data, so
+// transfers are smooth instead of happening in bursts of a second.
+func newBandwidthLimiter(kbps int64) *rate.Limiter {
+	if kbps <= 0 {
+		return nil
+	}
+	bytesPerSecond := float64(kbps) * 1000 / 8
+	burst := int(bytesPerSecond / 20)
+	if burst < 1 {
+		burst = 1
+	}
+	return rate.NewLimiter(rate.Limit(bytesPerSecond), burst)
+}
+
+// DialContext dials a connection with the wrapped dialer, after the delay of
+// a round trip. The connection may be dropped or get a fault injected later,
+// according to the fault rates.
+func (d *ShapedDialer) DialContext(ctx context.Context, proto, addr string) (net.Conn, error) {
+	if err := d.delay(ctx); err != nil {
+		return nil, err
+	}
+	tags := faultTags(ctx)
+	if d.dropRate > 0 && d.randFloat64() < d.dropRate {
+		emitFault(ctx, tags, FaultDrop)
+		return nil, InjectedFaultError{Fault: FaultDrop}
+	}
+	conn, err := d.DialContexter.DialContext(ctx, proto, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &shapedConn{Conn: conn, dialer: d, ctx: ctx, tags: tags}
+	switch r := d.randFloat64(); {
+	case r < d.resetRate:
+		c.fault = FaultReset
+	case r < d.resetRate+d.stallRate:
+		c.fault = FaultStall
+	}
+	return c, nil
+}
+
+// faultTags returns the tags of the VU dialing, for the network_faults metric.
+func faultTags(ctx context.Context) map[string]string {
+	state := lib.GetState(ctx)
+	if state == nil {
+		return nil
+	}
+	tags := make(map[string]string, len(state.Tags)+1)
+	for k, v := range state.Tags {
+		tags[k] = v
+	}
+	return tags
+}
+
+func emitFault(ctx context.Context, tags map[string]string, fault string) {
+	state := lib.GetState(ctx)
+	if state == nil || tags == nil {
+		return
+	}
+	sampleTags := make(map[string]string, len(tags)+1)
+	for k, v := range tags {
+		sampleTags[k] = v
+	}
+	sampleTags["fault"] = fault
+	stats.PushIfNotDone(ctx, state.Samples, stats.Sample{
+		Time:   time.Now(),
+		Metric: metrics.NetworkFaults,
+		Tags:   stats.IntoSampleTags(&sampleTags),
+		Value:  1,
+	})
+}
+
+// delay waits for the latency, varied by the jitter.
+func (d *ShapedDialer) delay(ctx context.Context) error {
+	latency := d.latency
+	if d.jitter > 0 {
+		latency += time.Duration(d.randInt63n(int64(2*d.jitter)+1)) - d.jitter
+	}
+	if latency <= 0 {
+		return nil
+	}
+	t := time.NewTimer(latency)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shapedConn is a connection with limited bandwidth, which delays the data
+// received after a write by the latency, simulating a request-response round
+// trip. Its fault, if any, is injected after the first data is received.
+type shapedConn struct {
+	net.Conn
+	dialer *ShapedDialer
+
+	awaitingResponse int32
+
+	ctx           context.Context
+	tags          map[string]string
+	fault         string
+	faultInjected bool
+	stalled       bool
+	pending       []byte
+}
+
+func (c *shapedConn) Read(b []byte) (int, error) {
+	limiter := c.dialer.download
+	if limiter != nil && len(b) > limiter.Burst() {
+		b = b[:limiter.Burst()]
+	}
+	n, err := c.read(b)
+	if n > 0 {
+		// the read may have been waiting since before the write, as is the
+		// case for reused connections, so the delay is applied only now
+		if atomic.CompareAndSwapInt32(&c.awaitingResponse, 1, 0) {
+			_ = c.dialer.delay(context.Background())
+		}
+		if limiter != nil {
+			_ = limiter.WaitN(context.Background(), n)
+		}
+	}
+	return n, err
+}
+
+// read reads from the underlying connection, injecting the fault of the
+// connection by only returning half of the first data received and then
+// either failing or delaying the rest of it by the stall duration.
+func (c *shapedConn) read(b []byte) (int, error) {
+	if !c.faultInjected || c.fault == "" {
+		n, err := c.Conn.Read(b)
+		if c.fault == "" || n < 2 {
+			return n, err
+		}
+		c.faultInjected = true
+		emitFault(c.ctx, c.tags, c.fault)
+		if c.fault == FaultReset {
+			_ = c.Conn.Close()
+		} else {
+			c.pending = append([]byte{}, b[n/2:n]...)
+		}
+		return n / 2, nil
+	}
+
+	if c.fault == FaultReset {
+		return 0, InjectedFaultError{Fault: FaultReset}
+	}
+	if !c.stalled {
+		c.stalled = true
+		time.Sleep(c.dialer.stallDuration)
+	}
+	if len(c.pending) > 0 {
+		n := copy(b, c.pending)
+		c.pending = c.pending[n:]
+		return n, nil
+	}
+	return c.Conn.Read(b)
+}
+
+func (c *shapedConn) Write(b []byte) (int, error) {
+	atomic.StoreInt32(&c.awaitingResponse, 1)
+	limiter := c.dialer.upload
+	if limiter == nil {
+		return c.Conn.Write(b)
+	}
+	written := 0
+	for written < len(b) {
+		chunk := b[written:]
+		if len(chunk) > limiter.Burst() {
+			chunk = chunk[:limiter.Burst()]
+		}
+		_ = limiter.WaitN(context.Background(), len(chunk))
+		n, err := c.Conn.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
@@ -0,0 +1,243 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package netext
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+// newShapingTestServer returns the address of a server that reads a line and
+// then replies with size bytes.
+func newShapingTestServer(t *testing.T, size int) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer func() { _ = conn.Close() }()
+				buf := make([]byte, 1)
+				for buf[0] != '\n' {
+					if _, err := conn.Read(buf); err != nil {
+						return
+					}
+				}
+				_, _ = conn.Write(make([]byte, size))
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestShapedDialerLatency(t *testing.T) {
+	t.Parallel()
+	addr := newShapingTestServer(t, 10)
+	dialer := NewShapedDialer(&net.Dialer{}, lib.ScenarioNetwork{
+		Latency: types.NullDurationFrom(100 * time.Millisecond),
+		Jitter:  types.NullDurationFrom(10 * time.Millisecond),
+	})
+
+	start := time.Now()
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	start = time.Now()
+	_, err = conn.Write([]byte("hello\n"))
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Len(t, data, 10)
+	assert.True(t, time.Since(start) >= 90*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = dialer.DialContext(ctx, "tcp", addr)
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestShapedDialerBandwidth(t *testing.T) {
+	t.Parallel()
+	addr := newShapingTestServer(t, 3000)
+	// 10000 bytes/s in both directions, with bursts of 500 bytes
+	dialer := NewShapedDialer(&net.Dialer{}, lib.ScenarioNetwork{
+		DownloadKbps: null.IntFrom(80),
+		UploadKbps:   null.IntFrom(80),
+	})
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	start := time.Now()
+	request := make([]byte, 2501)
+	request[2500] = '\n'
+	n, err := conn.Write(request)
+	require.NoError(t, err)
+	assert.Equal(t, len(request), n)
+	assert.True(t, time.Since(start) >= 180*time.Millisecond)
+
+	start = time.Now()
+	data, err := ioutil.ReadAll(io.LimitReader(conn, 3000))
+	require.NoError(t, err)
+	assert.Len(t, data, 3000)
+	assert.True(t, time.Since(start) >= 230*time.Millisecond)
+}
+
+func TestShapedDialerUnlimited(t *testing.T) {
+	t.Parallel()
+	addr := newShapingTestServer(t, 100000)
+	dialer := NewShapedDialer(&net.Dialer{}, lib.ScenarioNetwork{})
+	conn, err := dialer.DialContext(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	defer func() { _ = conn.Close() }()
+
+	_, err = conn.Write([]byte("\n"))
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Len(t, data, 100000)
+}
+
+func TestShapedDialerFaults(t *testing.T) {
+	t.Parallel()
+	addr := newShapingTestServer(t, 1000)
+	newCtx := func() (context.Context, chan stats.SampleContainer) {
+		samples := make(chan stats.SampleContainer, 10)
+		state := &lib.State{Samples: samples, Tags: map[string]string{"scenario": "mobile"}}
+		return lib.WithState(context.Background(), state), samples
+	}
+	assertFaultSample := func(t *testing.T, samples chan stats.SampleContainer, fault string) {
+		bufSamples := stats.GetBufferedSamples(samples)
+		require.Len(t, bufSamples, 1)
+		sample := bufSamples[0].GetSamples()[0]
+		assert.Equal(t, metrics.NetworkFaults, sample.Metric)
+		assert.Equal(t, map[string]string{"scenario": "mobile", "fault": fault}, sample.Tags.CloneTags())
+	}
+
+	t.Run("drop", func(t *testing.T) {
+		t.Parallel()
+		ctx, samples := newCtx()
+		dialer := NewShapedDialer(&net.Dialer{}, lib.ScenarioNetwork{DropRate: null.FloatFrom(1)})
+		_, err := dialer.DialContext(ctx, "tcp", addr)
+		assert.Equal(t, InjectedFaultError{Fault: FaultDrop}, err)
+		assert.EqualError(t, err, "injected network fault: connection dropped")
+		assertFaultSample(t, samples, FaultDrop)
+	})
+
+	t.Run("reset", func(t *testing.T) {
+		t.Parallel()
+		ctx, samples := newCtx()
+		dialer := NewShapedDialer(&net.Dialer{}, lib.ScenarioNetwork{ResetRate: null.FloatFrom(1)})
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+
+		_, err = conn.Write([]byte("\n"))
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(conn)
+		assert.Equal(t, InjectedFaultError{Fault: FaultReset}, err)
+		assert.NotEmpty(t, data)
+		assert.True(t, len(data) < 1000)
+		assertFaultSample(t, samples, FaultReset)
+	})
+
+	t.Run("stall", func(t *testing.T) {
+		t.Parallel()
+		ctx, samples := newCtx()
+		dialer := NewShapedDialer(&net.Dialer{}, lib.ScenarioNetwork{
+			StallRate:     null.FloatFrom(1),
+			StallDuration: types.NullDurationFrom(200 * time.Millisecond),
+		})
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+
+		start := time.Now()
+		_, err = conn.Write([]byte("\n"))
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(conn)
+		require.NoError(t, err)
+		assert.Len(t, data, 1000)
+		assert.True(t, time.Since(start) >= 200*time.Millisecond)
+		assertFaultSample(t, samples, FaultStall)
+	})
+
+	t.Run("none", func(t *testing.T) {
+		t.Parallel()
+		ctx, samples := newCtx()
+		dialer := NewShapedDialer(&net.Dialer{}, lib.ScenarioNetwork{
+			DropRate: null.FloatFrom(0), ResetRate: null.FloatFrom(0), StallRate: null.FloatFrom(0),
+		})
+		conn, err := dialer.DialContext(ctx, "tcp", addr)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+
+		_, err = conn.Write([]byte("\n"))
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(conn)
+		require.NoError(t, err)
+		assert.Len(t, data, 1000)
+		assert.Empty(t, stats.GetBufferedSamples(samples))
+	})
+}
+
+func TestShapedDialerSeed(t *testing.T) {
+	t.Parallel()
+	drops := func(seed int64) []bool {
+		dialer := NewShapedDialer(failingDialer{}, lib.ScenarioNetwork{DropRate: null.FloatFrom(0.5)})
+		dialer.Seed(seed)
+		dropped := make([]bool, 20)
+		for i := range dropped {
+			_, err := dialer.DialContext(context.Background(), "tcp", "127.0.0.1:1")
+			dropped[i] = err == InjectedFaultError{Fault: FaultDrop}
+		}
+		return dropped
+	}
+	assert.Equal(t, drops(42), drops(42))
+	assert.NotEqual(t, drops(42), drops(43))
+}
+
+// failingDialer fails all dials, without touching the network.
+type failingDialer struct{}
+
+func (failingDialer) DialContext(context.Context, string, string) (net.Conn, error) {
+	return nil, errors.New("dial failed")
+}
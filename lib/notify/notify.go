@@ -0,0 +1,342 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package notify posts the end-of-test summary and the threshold events of
+// the test run to chat services and generic webhooks, so CI pipelines don't
+// need their own scripts around k6 for it.
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+// The supported kinds of notification targets.
+const (
+	KindSlack   = "slack"
+	KindTeams   = "teams"
+	KindWebhook = "webhook"
+)
+
+// DefaultTemplate is the text/template the message of the notifications is
+// rendered with, unless a custom one is configured.
+const DefaultTemplate = `{{if .Passed}}✓{{else}}✗{{end}} k6 test {{.Test}} {{.Status}} after {{.Duration}}
+{{range .Thresholds}}
+{{if .Passed}}✓{{else}}✗{{end}} {{.Metric}}: {{.Source}}{{end}}
+{{range .Metrics}}
+{{.Name}}: {{.Value}}{{end}}{{if .Link}}
+
+{{.Link}}{{end}}
+`
+
+// The metrics and their stats that are included in the summary, if present.
+//nolint:gochecknoglobals
+var keyMetrics = []struct {
+	name  string
+	stats []string
+}{
+	{"http_reqs", []string{"count", "rate"}},
+	{"http_req_duration", []string{"avg", "p(95)"}},
+	{"http_req_failed", []string{"rate"}},
+	{"checks", []string{"rate"}},
+	{"iterations", []string{"count"}},
+	{"vus_max", []string{"value"}},
+	{"data_received", []string{"count"}},
+}
+
+// Threshold is the result of a single threshold.
+type Threshold struct {
+	Metric string `json:"metric"`
+	Source string `json:"source"`
+	Passed bool   `json:"passed"`
+}
+
+// Metric is a human-readable stat of one of the key metrics of the test.
+type Metric struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// Summary is the data the notification template is executed with, and also
+// what's posted to generic webhooks along with the rendered text.
+type Summary struct {
+	Test       string        `json:"test"`
+	Passed     bool          `json:"passed"`
+	Status     string        `json:"status"`
+	Duration   time.Duration `json:"-"`
+	Thresholds []Threshold   `json:"thresholds"`
+	Metrics    []Metric      `json:"metrics"`
+	Link       string        `json:"link,omitempty"`
+}
+
+// NewSummary returns the summary of a finished test run with the given
+// metrics. The test passed if none of its thresholds failed.
+func NewSummary(test string, metrics map[string]*stats.Metric, duration time.Duration, link string) Summary {
+	s := Summary{Test: test, Passed: true, Duration: duration.Round(10 * time.Millisecond), Link: link}
+
+	names := make([]string, 0, len(metrics))
+	for name := range metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, th := range metrics[name].Thresholds.Thresholds {
+			s.Thresholds = append(s.Thresholds, Threshold{Metric: name, Source: th.Source, Passed: !th.LastFailed})
+			s.Passed = s.Passed && !th.LastFailed
+		}
+	}
+
+	for _, km := range keyMetrics {
+		m, ok := metrics[km.name]
+		if !ok || m.Sink == nil {
+			continue
+		}
+		values := m.Sink.Format(duration)
+		formatted := make([]string, 0, len(km.stats))
+		for _, stat := range km.stats {
+			v, ok := values[stat]
+			if !ok {
+				continue
+			}
+			value := m.HumanizeValue(v, "")
+			switch stat {
+			case "count", "value":
+				if m.Contains != stats.Data {
+					value = fmt.Sprintf("%.0f", v)
+				}
+			case "rate":
+				if m.Type == stats.Counter {
+					value = fmt.Sprintf("%.2f/s", v)
+				}
+			}
+			formatted = append(formatted, stat+"="+value)
+		}
+		if len(formatted) > 0 {
+			s.Metrics = append(s.Metrics, Metric{Name: km.name, Value: strings.Join(formatted, " ")})
+		}
+	}
+
+	s.Status = "passed"
+	if !s.Passed {
+		s.Status = "failed"
+	}
+	return s
+}
+
+// How many times a threshold event is posted before giving up, and how long
+// to wait before the first retry. The wait is doubled after every retry.
+const (
+	thresholdEventAttempts = 3
+	thresholdEventBackoff  = time.Second
+)
+
+// Notifier posts summaries to a single target.
+type Notifier struct {
+	Kind string
+	URL  string
+
+	tmpl         *template.Template
+	client       *http.Client
+	retryBackoff time.Duration
+}
+
+// New returns a notifier for a `kind=url` target, e.g.
+// `slack=https://hooks.slack.com/services/...`. The message is rendered with
+// the given text/template, or DefaultTemplate if it's empty.
+func New(target, tmpl string) (*Notifier, error) {
+	kv := strings.SplitN(target, "=", 2)
+	if len(kv) != 2 || kv[1] == "" {
+		return nil, fmt.Errorf("invalid notification target '%s', it should be in the kind=url format", target)
+	}
+	kind := strings.ToLower(kv[0])
+	switch kind {
+	case KindSlack, KindTeams, KindWebhook:
+	default:
+		return nil, fmt.Errorf("unknown notification kind '%s', it should be one of %s, %s or %s",
+			kv[0], KindSlack, KindTeams, KindWebhook)
+	}
+	u, err := url.Parse(kv[1])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("invalid %s notification URL '%s'", kind, kv[1])
+	}
+
+	if tmpl == "" {
+		tmpl = DefaultTemplate
+	}
+	t, err := template.New(kind).Parse(tmpl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification template: %w", err)
+	}
+	return &Notifier{
+		Kind:         kind,
+		URL:          u.String(),
+		tmpl:         t,
+		client:       &http.Client{Timeout: 10 * time.Second},
+		retryBackoff: thresholdEventBackoff,
+	}, nil
+}
+
+// Text renders the message of the notification for the given summary.
+func (n *Notifier) Text(s Summary) (string, error) {
+	var buf bytes.Buffer
+	if err := n.tmpl.Execute(&buf, s); err != nil {
+		return "", fmt.Errorf("error executing the notification template: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// Payload returns the JSON body posted to the target for the given summary.
+func (n *Notifier) Payload(s Summary) ([]byte, error) {
+	text, err := n.Text(s)
+	if err != nil {
+		return nil, err
+	}
+	switch n.Kind {
+	case KindSlack:
+		return json.Marshal(map[string]string{"text": text})
+	case KindTeams:
+		color := "2EB886"
+		if !s.Passed {
+			color = "D00000"
+		}
+		// Teams only breaks lines on paragraphs in message cards
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    fmt.Sprintf("k6 test %s %s", s.Test, s.Status),
+			"themeColor": color,
+			"text":       strings.ReplaceAll(text, "\n", "\n\n"),
+		})
+	default:
+		return json.Marshal(struct {
+			Summary
+			Text     string  `json:"text"`
+			Duration float64 `json:"duration"`
+		}{s, text, s.Duration.Seconds()})
+	}
+}
+
+// Send posts the summary to the target.
+func (n *Notifier) Send(ctx context.Context, s Summary) error {
+	body, err := n.Payload(s)
+	if err != nil {
+		return err
+	}
+	_, err = n.post(ctx, body)
+	return err
+}
+
+// ThresholdEventText returns the human-readable message about the event.
+func ThresholdEventText(test string, event lib.ThresholdEvent) string {
+	mark, what := "✗", "was breached"
+	switch event.Type {
+	case lib.ThresholdRecovered:
+		mark, what = "✓", "recovered"
+	case lib.ThresholdAborted:
+		what = "aborted the test"
+	}
+	return fmt.Sprintf("%s k6 test %s: the threshold %s of %s %s after %s",
+		mark, test, event.Threshold, event.Metric, what, time.Duration(event.Elapsed).Round(time.Second))
+}
+
+// ThresholdEventPayload returns the JSON body posted to the target for the
+// given threshold event. Chat services get only the message about it, while
+// generic webhooks get the whole event.
+func (n *Notifier) ThresholdEventPayload(test string, event lib.ThresholdEvent) ([]byte, error) {
+	text := ThresholdEventText(test, event)
+	switch n.Kind {
+	case KindSlack:
+		return json.Marshal(map[string]string{"text": text})
+	case KindTeams:
+		color := "D00000"
+		if event.Type == lib.ThresholdRecovered {
+			color = "2EB886"
+		}
+		return json.Marshal(map[string]string{
+			"@type":      "MessageCard",
+			"@context":   "https://schema.org/extensions",
+			"summary":    fmt.Sprintf("k6 test %s threshold %s", test, event.Type),
+			"themeColor": color,
+			"text":       text,
+		})
+	default:
+		return json.Marshal(struct {
+			lib.ThresholdEvent
+			Test string `json:"test"`
+			Text string `json:"text"`
+		}{event, test, text})
+	}
+}
+
+// SendThresholdEvent posts the threshold event to the target. Network errors,
+// rate limiting and server errors are retried a few times, with a backoff.
+func (n *Notifier) SendThresholdEvent(ctx context.Context, test string, event lib.ThresholdEvent) error {
+	body, err := n.ThresholdEventPayload(test, event)
+	if err != nil {
+		return err
+	}
+	backoff := n.retryBackoff
+	for attempt := 1; ; attempt++ {
+		retryable, err := n.post(ctx, body)
+		if err == nil || !retryable || attempt == thresholdEventAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// post sends the body to the target, and returns whether a failure is worth
+// retrying.
+func (n *Notifier) post(ctx context.Context, body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, fmt.Errorf("error sending the %s notification: %w", n.Kind, err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = ioutil.ReadAll(resp.Body)
+	if resp.StatusCode >= 300 {
+		retryable := resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retryable, fmt.Errorf("the %s notification was rejected with status %d", n.Kind, resp.StatusCode)
+	}
+	return false, nil
+}
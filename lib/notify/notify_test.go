@@ -0,0 +1,232 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+func testMetrics(t *testing.T, failed bool) map[string]*stats.Metric {
+	reqs := stats.New("http_reqs", stats.Counter)
+	reqs.Sink = &stats.CounterSink{Value: 100}
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	sink := &stats.TrendSink{}
+	for _, v := range []float64{100, 200, 300} {
+		sink.Add(stats.Sample{Value: v})
+	}
+	duration.Sink = sink
+	ths, err := stats.NewThresholds([]string{"p(95)<500"})
+	require.NoError(t, err)
+	ths.Thresholds[0].LastFailed = failed
+	duration.Thresholds = ths
+
+	return map[string]*stats.Metric{reqs.Name: reqs, duration.Name: duration}
+}
+
+func TestNewSummary(t *testing.T) {
+	t.Parallel()
+	s := NewSummary("script.js", testMetrics(t, false), 10*time.Second, "https://dashboards/run/1")
+	assert.True(t, s.Passed)
+	assert.Equal(t, "passed", s.Status)
+	assert.Equal(t, []Threshold{{Metric: "http_req_duration", Source: "p(95)<500", Passed: true}}, s.Thresholds)
+	assert.Equal(t, []Metric{
+		{Name: "http_reqs", Value: "count=100 rate=10.00/s"},
+		{Name: "http_req_duration", Value: "avg=200ms p(95)=290ms"},
+	}, s.Metrics)
+
+	s = NewSummary("script.js", testMetrics(t, true), 10*time.Second, "")
+	assert.False(t, s.Passed)
+	assert.Equal(t, "failed", s.Status)
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	for _, target := range []string{
+		"slack", "slack=", "irc=https://example.com", "slack=ftp://example.com", "webhook=:foo",
+	} {
+		_, err := New(target, "")
+		assert.Error(t, err, target)
+	}
+	_, err := New("webhook=https://example.com", "{{.Foo")
+	assert.Error(t, err)
+
+	n, err := New("Teams=https://example.com/hook", "")
+	require.NoError(t, err)
+	assert.Equal(t, KindTeams, n.Kind)
+}
+
+func TestPayload(t *testing.T) {
+	t.Parallel()
+	s := NewSummary("script.js", testMetrics(t, true), 10*time.Second, "https://dashboards/run/1")
+
+	slack, err := New("slack=https://example.com", "")
+	require.NoError(t, err)
+	text, err := slack.Text(s)
+	require.NoError(t, err)
+	assert.Equal(t, "✗ k6 test script.js failed after 10s\n\n"+
+		"✗ http_req_duration: p(95)<500\n\n"+
+		"http_reqs: count=100 rate=10.00/s\n"+
+		"http_req_duration: avg=200ms p(95)=290ms\n\n"+
+		"https://dashboards/run/1", text)
+	payload, err := slack.Payload(s)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text":`+jsonString(t, text)+`}`, string(payload))
+
+	teams, err := New("teams=https://example.com", "{{.Test}} {{.Status}}\n{{.Link}}")
+	require.NoError(t, err)
+	payload, err = teams.Payload(s)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"@type": "MessageCard", "@context": "https://schema.org/extensions",
+		"summary": "k6 test script.js failed", "themeColor": "D00000",
+		"text": "script.js failed\n\nhttps://dashboards/run/1"
+	}`, string(payload))
+
+	webhook, err := New("webhook=https://example.com", "{{.Status}}")
+	require.NoError(t, err)
+	payload, err = webhook.Payload(s)
+	require.NoError(t, err)
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(payload, &data))
+	assert.Equal(t, "failed", data["text"])
+	assert.Equal(t, false, data["passed"])
+	assert.Equal(t, 10.0, data["duration"])
+	assert.Len(t, data["thresholds"], 1)
+	assert.Len(t, data["metrics"], 2)
+}
+
+func TestSend(t *testing.T) {
+	t.Parallel()
+	var received []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		var err error
+		received, err = ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	s := NewSummary("script.js", testMetrics(t, false), 10*time.Second, "")
+	n, err := New("slack="+srv.URL+"/ok", "{{.Status}}")
+	require.NoError(t, err)
+	require.NoError(t, n.Send(context.Background(), s))
+	assert.JSONEq(t, `{"text":"passed"}`, string(received))
+
+	n, err = New("slack="+srv.URL+"/fail", "")
+	require.NoError(t, err)
+	assert.EqualError(t, n.Send(context.Background(), s), "the slack notification was rejected with status 400")
+}
+
+func testThresholdEvent(typ string) lib.ThresholdEvent {
+	return lib.ThresholdEvent{
+		Type:        typ,
+		Time:        time.Unix(1600000000, 0).UTC(),
+		Elapsed:     types.Duration(90 * time.Second),
+		Metric:      "http_req_duration",
+		Threshold:   "p(95)<500",
+		AbortOnFail: true,
+		Values:      map[string]float64{"p(95)": 600},
+	}
+}
+
+func TestThresholdEventPayload(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "✗ k6 test script.js: the threshold p(95)<500 of http_req_duration was breached after 1m30s",
+		ThresholdEventText("script.js", testThresholdEvent(lib.ThresholdBreached)))
+	assert.Equal(t, "✓ k6 test script.js: the threshold p(95)<500 of http_req_duration recovered after 1m30s",
+		ThresholdEventText("script.js", testThresholdEvent(lib.ThresholdRecovered)))
+
+	slack, err := New("slack=https://example.com", "")
+	require.NoError(t, err)
+	payload, err := slack.ThresholdEventPayload("script.js", testThresholdEvent(lib.ThresholdAborted))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"text":"✗ k6 test script.js: the threshold p(95)<500 of http_req_duration `+
+		`aborted the test after 1m30s"}`, string(payload))
+
+	webhook, err := New("webhook=https://example.com", "")
+	require.NoError(t, err)
+	payload, err = webhook.ThresholdEventPayload("script.js", testThresholdEvent(lib.ThresholdBreached))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{
+		"test": "script.js", "type": "breached", "time": "2020-09-13T12:26:40Z", "elapsed": "1m30s",
+		"metric": "http_req_duration", "threshold": "p(95)<500", "abortOnFail": true, "values": {"p(95)": 600},
+		"text": "✗ k6 test script.js: the threshold p(95)<500 of http_req_duration was breached after 1m30s"
+	}`, string(payload))
+}
+
+func TestSendThresholdEvent(t *testing.T) {
+	t.Parallel()
+	var mu sync.Mutex
+	attempts := map[string]int{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts[r.URL.Path]++
+		attempt := attempts[r.URL.Path]
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/flaky" && attempt < 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case r.URL.Path == "/down":
+			w.WriteHeader(http.StatusBadGateway)
+		case r.URL.Path == "/bad":
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+
+	send := func(path string) error {
+		n, err := New("webhook="+srv.URL+path, "")
+		require.NoError(t, err)
+		n.retryBackoff = time.Millisecond
+		return n.SendThresholdEvent(context.Background(), "script.js", testThresholdEvent(lib.ThresholdBreached))
+	}
+	assert.NoError(t, send("/flaky"))
+	assert.EqualError(t, send("/down"), "the webhook notification was rejected with status 502")
+	assert.EqualError(t, send("/bad"), "the webhook notification was rejected with status 400")
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, map[string]int{"/flaky": 3, "/down": 3, "/bad": 1}, attempts)
+}
+
+func jsonString(t *testing.T, s string) string {
+	data, err := json.Marshal(s)
+	require.NoError(t, err)
+	return string(data)
+}
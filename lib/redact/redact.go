@@ -0,0 +1,235 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package redact removes sensitive data, like authorization headers or PII in
+// URLs, from the metric samples and logs before they leave the k6 process.
+package redact
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/lib/secrets"
+	"github.com/loadimpact/k6/stats"
+)
+
+// maxCachedTagSets limits how many redacted tag sets are remembered, since
+// tests with unique URLs can have an unbounded number of them.
+const maxCachedTagSets = 1 << 14
+
+// Config specifies what should be redacted. All patterns are regular
+// expressions and the name patterns match case-insensitively.
+type Config struct {
+	// The values of HTTP headers with matching names are replaced
+	Headers []string `json:"headers"`
+	// The values of metric tags with matching names are replaced
+	Tags []string `json:"tags"`
+	// Matches in all tag values and log messages are replaced
+	Values []string `json:"values"`
+}
+
+// Validate returns an error for every invalid pattern in the config.
+func (c Config) Validate() []error {
+	var errs []error
+	for _, patterns := range [][]string{c.Headers, c.Tags, c.Values} {
+		for _, pattern := range patterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				errs = append(errs, fmt.Errorf("invalid redaction pattern '%s': %w", pattern, err))
+			}
+		}
+	}
+	return errs
+}
+
+// Redactor applies a redaction Config. Besides the configured patterns, it
+// also redacts all values that were resolved by the k6/secrets module. It's
+// safe for concurrent use.
+type Redactor struct {
+	headers []*regexp.Regexp
+	tags    []*regexp.Regexp
+	values  []*regexp.Regexp
+
+	mu       sync.Mutex
+	tagCache map[*stats.SampleTags]*stats.SampleTags
+}
+
+// New compiles the given config into a Redactor.
+func New(conf Config) (*Redactor, error) {
+	if errs := conf.Validate(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	compile := func(patterns []string, format string) []*regexp.Regexp {
+		res := make([]*regexp.Regexp, len(patterns))
+		for i, pattern := range patterns {
+			res[i] = regexp.MustCompile(fmt.Sprintf(format, pattern))
+		}
+		return res
+	}
+	// Names have to match completely, so `auth` doesn't match `x-oauth-scopes`
+	return &Redactor{
+		headers:  compile(conf.Headers, "(?i)^(?:%s)$"),
+		tags:     compile(conf.Tags, "(?i)^(?:%s)$"),
+		values:   compile(conf.Values, "%s"),
+		tagCache: make(map[*stats.SampleTags]*stats.SampleTags),
+	}, nil
+}
+
+func matchesAny(patterns []*regexp.Regexp, s string) bool {
+	for _, p := range patterns {
+		if p.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// String redacts all value patterns and secrets in the given string.
+func (r *Redactor) String(s string) string {
+	for _, p := range r.values {
+		s = p.ReplaceAllLiteralString(s, secrets.Redacted)
+	}
+	return secrets.Redact(s)
+}
+
+// Header reports whether the value of the HTTP header with the given name
+// should be redacted.
+func (r *Redactor) Header(name string) bool {
+	return matchesAny(r.headers, name)
+}
+
+// HTTPDump redacts a raw HTTP/1.x request or response dump, like the ones
+// produced by the net/http/httputil package.
+func (r *Redactor) HTTPDump(dump []byte) []byte {
+	if len(r.headers) > 0 {
+		end := bytes.Index(dump, []byte("\r\n\r\n"))
+		if end == -1 {
+			end = len(dump)
+		}
+		lines := bytes.Split(dump[:end], []byte("\r\n"))
+		for i, line := range lines[1:] { // skip the request or status line
+			colon := bytes.IndexByte(line, ':')
+			if colon != -1 && r.Header(string(line[:colon])) {
+				lines[i+1] = append(line[:colon:colon], ": "+secrets.Redacted...)
+			}
+		}
+		dump = append(bytes.Join(lines, []byte("\r\n")), dump[end:]...)
+	}
+	return []byte(r.String(string(dump)))
+}
+
+// Tags returns the redacted version of the given tag set. If nothing needed
+// to be redacted, the same tag set is returned.
+func (r *Redactor) Tags(tags *stats.SampleTags) *stats.SampleTags {
+	if tags.IsEmpty() {
+		return tags
+	}
+	r.mu.Lock()
+	redacted, ok := r.tagCache[tags]
+	r.mu.Unlock()
+	if ok {
+		return redacted
+	}
+
+	redacted = tags
+	changed := false
+	values := tags.CloneTags()
+	for k, v := range values {
+		newV := secrets.Redacted
+		if !matchesAny(r.tags, k) {
+			newV = r.String(v)
+		}
+		if newV != v {
+			values[k] = newV
+			changed = true
+		}
+	}
+	if changed {
+		redacted = stats.IntoSampleTags(&values)
+	}
+
+	r.mu.Lock()
+	if len(r.tagCache) >= maxCachedTagSets {
+		r.tagCache = make(map[*stats.SampleTags]*stats.SampleTags)
+	}
+	r.tagCache[tags] = redacted
+	r.mu.Unlock()
+	return redacted
+}
+
+// TagsSetter is implemented by sample containers that have their own tags,
+// besides the ones of their samples, and return their internal slice from
+// GetSamples(), so they can be redacted in place.
+type TagsSetter interface {
+	stats.ConnectedSampleContainer
+	SetTags(*stats.SampleTags)
+}
+
+// Samples redacts the tags of the given sample containers. Where possible,
+// that's done in place, otherwise the container is replaced in the slice with
+// a redacted copy.
+func (r *Redactor) Samples(containers []stats.SampleContainer) {
+	for i, sc := range containers {
+		switch c := sc.(type) {
+		case stats.Sample:
+			c.Tags = r.Tags(c.Tags)
+			containers[i] = c
+		case stats.Samples:
+			r.redactSamples(c)
+		case stats.ConnectedSamples:
+			r.redactSamples(c.Samples)
+			c.Tags = r.Tags(c.Tags)
+			containers[i] = c
+		case TagsSetter:
+			r.redactSamples(c.GetSamples())
+			c.SetTags(r.Tags(c.GetTags()))
+		default:
+			// We can't know if GetSamples() returns a copy, so play it safe
+			samples := append(stats.Samples(nil), sc.GetSamples()...)
+			r.redactSamples(samples)
+			containers[i] = samples
+		}
+	}
+}
+
+func (r *Redactor) redactSamples(samples []stats.Sample) {
+	for i := range samples {
+		samples[i].Tags = r.Tags(samples[i].Tags)
+	}
+}
+
+// Levels returns all log levels, so the Redactor can be used as a logrus hook.
+func (r *Redactor) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts the message and the string fields of the given log entry.
+func (r *Redactor) Fire(entry *logrus.Entry) error {
+	entry.Message = r.String(entry.Message)
+	for k, v := range entry.Data {
+		if s, ok := v.(string); ok {
+			entry.Data[k] = r.String(s)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package redact
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+type trail struct {
+	tags    *stats.SampleTags
+	samples []stats.Sample
+}
+
+func (tr *trail) GetSamples() []stats.Sample     { return tr.samples }
+func (tr *trail) GetTags() *stats.SampleTags     { return tr.tags }
+func (tr *trail) GetTime() time.Time             { return time.Time{} }
+func (tr *trail) SetTags(tags *stats.SampleTags) { tr.tags = tags }
+
+type opaque struct{ s stats.Sample }
+
+func (o opaque) GetSamples() []stats.Sample { return []stats.Sample{o.s} }
+
+func TestConfigValidate(t *testing.T) {
+	t.Parallel()
+	assert.Empty(t, Config{Headers: []string{"Authorization"}, Values: []string{`\d+`}}.Validate())
+	assert.Len(t, Config{Headers: []string{"("}, Tags: []string{"["}, Values: []string{"ok"}}.Validate(), 2)
+	_, err := New(Config{Values: []string{"("}})
+	assert.Error(t, err)
+}
+
+func TestRedactTags(t *testing.T) {
+	t.Parallel()
+	r, err := New(Config{Tags: []string{"auth.*"}, Values: []string{`[\w.]+@[\w.]+`}})
+	require.NoError(t, err)
+
+	assert.Nil(t, r.Tags(nil))
+	clean := stats.IntoSampleTags(&map[string]string{"url": "/home"})
+	assert.True(t, clean == r.Tags(clean))
+
+	dirty := stats.IntoSampleTags(&map[string]string{"Authorization": "Bearer x", "url": "/u/me@example.com"})
+	redacted := r.Tags(dirty)
+	assert.Equal(t, map[string]string{"Authorization": "***", "url": "/u/***"}, redacted.CloneTags())
+	assert.True(t, redacted == r.Tags(dirty), "the result should be cached")
+}
+
+func TestRedactSamples(t *testing.T) {
+	t.Parallel()
+	r, err := New(Config{Tags: []string{"secret"}})
+	require.NoError(t, err)
+	metric := stats.New("m", stats.Counter)
+	dirty := stats.IntoSampleTags(&map[string]string{"secret": "s", "a": "b"})
+	exp := map[string]string{"secret": "***", "a": "b"}
+	sample := stats.Sample{Metric: metric, Value: 1, Tags: dirty}
+
+	tr := &trail{tags: dirty, samples: []stats.Sample{sample}}
+	containers := []stats.SampleContainer{
+		sample,
+		stats.Samples{sample, sample},
+		stats.ConnectedSamples{Samples: []stats.Sample{sample}, Tags: dirty},
+		tr,
+		opaque{sample},
+	}
+	r.Samples(containers)
+
+	assert.Equal(t, tr, containers[3])
+	assert.Equal(t, exp, tr.GetTags().CloneTags())
+	assert.Equal(t, exp, containers[2].(stats.ConnectedSamples).Tags.CloneTags())
+	assert.IsType(t, stats.Samples{}, containers[4])
+	for _, sc := range containers {
+		for _, s := range sc.GetSamples() {
+			assert.Equal(t, exp, s.Tags.CloneTags())
+		}
+	}
+}
+
+func TestRedactHTTPDump(t *testing.T) {
+	t.Parallel()
+	r, err := New(Config{Headers: []string{"authorization", "x-api-.*"}, Values: []string{`token=\w+`}})
+	require.NoError(t, err)
+
+	dump := "GET /?token=abc HTTP/1.1\r\nHost: example.com\r\nAuthorization: Basic Zm9vOmJhcg==\r\n" +
+		"X-Api-Key: 123\r\n\r\nbody with X-Api-Key: 456"
+	assert.Equal(t,
+		"GET /?*** HTTP/1.1\r\nHost: example.com\r\nAuthorization: ***\r\nX-Api-Key: ***\r\n\r\nbody with X-Api-Key: 456",
+		string(r.HTTPDump([]byte(dump))),
+	)
+	assert.True(t, r.Header("AUTHORIZATION"))
+	assert.False(t, r.Header("X-Authorization"))
+}
+
+func TestRedactLogHook(t *testing.T) {
+	t.Parallel()
+	r, err := New(Config{Values: []string{`\d{4}-\d{4}`}})
+	require.NoError(t, err)
+
+	entry := logrus.NewEntry(logrus.New()).WithFields(logrus.Fields{
+		"card":  "1234-5678",
+		"count": 1234,
+		"error": errors.New("1234-5678"),
+	})
+	entry.Message = "paid with 1234-5678"
+	require.NoError(t, r.Fire(entry))
+	assert.Equal(t, "paid with ***", entry.Message)
+	assert.Equal(t, "***", entry.Data["card"])
+	assert.Equal(t, 1234, entry.Data["count"])
+	assert.Len(t, r.Levels(), len(logrus.AllLevels))
+}
@@ -0,0 +1,153 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"sync"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+// maxTimedRequests caps how many different requests RequestTimings keeps
+// track of, since requests without a name tag are keyed by their URL.
+const maxTimedRequests = 1000
+
+// RequestPhases are the phases of HTTP requests, in the order they happen,
+// with the metrics that they are measured with.
+//nolint:gochecknoglobals
+var RequestPhases = []struct {
+	Name   string
+	Metric *stats.Metric
+}{
+	{"blocked", metrics.HTTPReqBlocked},
+	{"dns_lookup", metrics.HTTPReqDNSLookup},
+	{"connecting", metrics.HTTPReqConnecting},
+	{"tls_handshaking", metrics.HTTPReqTLSHandshaking},
+	{"sending", metrics.HTTPReqSending},
+	{"waiting", metrics.HTTPReqWaiting},
+	{"receiving", metrics.HTTPReqReceiving},
+}
+
+// RequestTiming is the breakdown of the time that the requests with the same
+// method and name spent in each of their phases.
+type RequestTiming struct {
+	Method string
+	Name   string
+	Count  int64
+	// The total time of each of the RequestPhases, in ms.
+	Phases []float64
+}
+
+// Avg returns the average time, in ms, the requests spent in each phase.
+func (t *RequestTiming) Avg() []float64 {
+	avg := make([]float64, len(t.Phases))
+	if t.Count == 0 {
+		return avg
+	}
+	for i, total := range t.Phases {
+		avg[i] = total / float64(t.Count)
+	}
+	return avg
+}
+
+// GroupRequestTimings are the request timings of a group, in the order the
+// requests were first made.
+type GroupRequestTimings struct {
+	Path     string
+	Requests []*RequestTiming
+}
+
+type requestKey struct {
+	group, method, name string
+}
+
+// RequestTimings aggregates the phase timings of the HTTP requests by their
+// group, method and name, for the breakdown in the end-of-test summary.
+type RequestTimings struct {
+	mu       sync.Mutex
+	groups   []*GroupRequestTimings
+	byGroup  map[string]*GroupRequestTimings
+	requests map[requestKey]*RequestTiming
+	phases   map[string]int
+}
+
+// NewRequestTimings returns an empty RequestTimings.
+func NewRequestTimings() *RequestTimings {
+	phases := make(map[string]int, len(RequestPhases))
+	for i, p := range RequestPhases {
+		phases[p.Metric.Name] = i
+	}
+	return &RequestTimings{
+		byGroup:  make(map[string]*GroupRequestTimings),
+		requests: make(map[requestKey]*RequestTiming),
+		phases:   phases,
+	}
+}
+
+// Add adds the phase timings among the samples.
+func (rt *RequestTimings) Add(samples []stats.Sample) {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+
+	for _, s := range samples {
+		phase, isPhase := rt.phases[s.Metric.Name]
+		if !isPhase && s.Metric.Name != metrics.HTTPReqs.Name {
+			continue
+		}
+		key := requestKey{}
+		key.group, _ = s.Tags.Get("group")
+		key.method, _ = s.Tags.Get("method")
+		var ok bool
+		if key.name, ok = s.Tags.Get("name"); !ok {
+			key.name, _ = s.Tags.Get("url")
+		}
+
+		timing, ok := rt.requests[key]
+		if !ok {
+			if len(rt.requests) >= maxTimedRequests {
+				continue
+			}
+			timing = &RequestTiming{Method: key.method, Name: key.name, Phases: make([]float64, len(RequestPhases))}
+			rt.requests[key] = timing
+			group, ok := rt.byGroup[key.group]
+			if !ok {
+				group = &GroupRequestTimings{Path: key.group}
+				rt.byGroup[key.group] = group
+				rt.groups = append(rt.groups, group)
+			}
+			group.Requests = append(group.Requests, timing)
+		}
+		if isPhase {
+			timing.Phases[phase] += s.Value
+		} else {
+			timing.Count++
+		}
+	}
+}
+
+// Groups returns the request timings of each group, in the order the first
+// requests in them were made.
+func (rt *RequestTimings) Groups() []*GroupRequestTimings {
+	rt.mu.Lock()
+	defer rt.mu.Unlock()
+	return rt.groups
+}
@@ -0,0 +1,66 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/stats"
+)
+
+func requestSamples(tags map[string]string, waiting, receiving float64) []stats.Sample {
+	sampleTags := stats.NewSampleTags(tags)
+	return []stats.Sample{
+		{Metric: metrics.HTTPReqs, Value: 1, Tags: sampleTags},
+		{Metric: metrics.HTTPReqDuration, Value: waiting + receiving, Tags: sampleTags},
+		{Metric: metrics.HTTPReqWaiting, Value: waiting, Tags: sampleTags},
+		{Metric: metrics.HTTPReqReceiving, Value: receiving, Tags: sampleTags},
+	}
+}
+
+func TestRequestTimings(t *testing.T) {
+	t.Parallel()
+	rt := NewRequestTimings()
+
+	rt.Add(requestSamples(map[string]string{"group": "::login", "method": "POST", "url": "https://test.k6.io/login"}, 10, 2))
+	rt.Add(requestSamples(map[string]string{"group": "::login", "method": "POST", "url": "https://test.k6.io/login"}, 20, 4))
+	rt.Add(requestSamples(map[string]string{
+		"group": "", "method": "GET", "url": "https://test.k6.io/users/1", "name": "users",
+	}, 5, 1))
+	rt.Add([]stats.Sample{{Metric: metrics.Checks, Value: 1, Tags: stats.NewSampleTags(map[string]string{"group": "x"})}})
+
+	groups := rt.Groups()
+	require.Len(t, groups, 2)
+	assert.Equal(t, "::login", groups[0].Path)
+	require.Len(t, groups[0].Requests, 1)
+	login := groups[0].Requests[0]
+	assert.Equal(t, "POST", login.Method)
+	assert.Equal(t, "https://test.k6.io/login", login.Name)
+	assert.Equal(t, int64(2), login.Count)
+	assert.Equal(t, []float64{0, 0, 0, 0, 0, 15, 3}, login.Avg())
+
+	assert.Equal(t, "", groups[1].Path)
+	assert.Equal(t, "users", groups[1].Requests[0].Name)
+}
@@ -25,6 +25,7 @@ import (
 	"io"
 	"time"
 
+	"github.com/loadimpact/k6/lib/slo"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -55,6 +56,33 @@ type VUActivationParams struct {
 	DeactivateCallback func(InitializedVU)
 	Env, Tags          map[string]string
 	Exec, Scenario     string
+	// Iterations running longer than this are interrupted, if it's set
+	IterationTimeout time.Duration
+	// How many times failed iterations are retried, and how long to wait
+	// before the first retry, doubled for every next one up to a minute
+	Retries      int64
+	RetryBackoff time.Duration
+}
+
+// InFlightRequestsVU can be implemented by active VUs that keep track of the
+// requests they are waiting for, so executors can report what the iterations
+// that don't finish in time are blocked on.
+type InFlightRequestsVU interface {
+	ActiveVU
+	GetInFlightRequests() []string
+}
+
+// ScenarioSetupRunner can be implemented by runners that support setup and
+// teardown functions for individual scenarios, whose data is passed only to
+// the iterations of their scenario.
+type ScenarioSetupRunner interface {
+	Runner
+
+	// Runs the given setup function of the scenario and keeps the data it returns
+	ScenarioSetup(ctx context.Context, out chan<- stats.SampleContainer, scenario, fn string) error
+
+	// Runs the given teardown function of the scenario with its setup data
+	ScenarioTeardown(ctx context.Context, out chan<- stats.SampleContainer, scenario, fn string) error
 }
 
 // A Runner is a factory for VUs. It should precompute as much as possible upon
@@ -108,4 +136,6 @@ type Summary struct {
 	Metrics         map[string]*stats.Metric
 	RootGroup       *Group
 	TestRunDuration time.Duration // TODO: use lib.ExecutionState-based interface instead?
+	RequestTimings  *RequestTimings
+	SLOs            []slo.Result
 }
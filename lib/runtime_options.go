@@ -25,6 +25,8 @@ import (
 	"strings"
 
 	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib/types"
 )
 
 // CompatibilityMode specifies the JS compatibility mode
@@ -55,9 +57,85 @@ type RuntimeOptions struct {
 	// Environment variables passed onto the runner
 	Env map[string]string `json:"env"`
 
+	// Environment variables loaded from env files, which override the ones in
+	// Env. They can be decrypted secrets, so unlike Env they are never written
+	// to archives and they aren't sent to the cloud or to distributed agents.
+	FileEnv map[string]string `json:"-"`
+
 	NoThresholds  null.Bool   `json:"noThresholds"`
 	NoSummary     null.Bool   `json:"noSummary"`
 	SummaryExport null.String `json:"summaryExport"`
+
+	// File the end-of-test summary is also written to as CSV, with a row for
+	// each metric and submetric, to be loaded into spreadsheets
+	SummaryExportCSV null.String `json:"summaryExportCSV"`
+
+	// File the end-of-test summary is also written to as a Markdown table,
+	// e.g. to be posted as a pull request comment by CI
+	SummaryMarkdown null.String `json:"summaryMarkdown"`
+
+	// Print GitHub Actions workflow commands for the failed thresholds and
+	// checks after the summary, and write the Markdown summary to the step
+	// summary file of the job, if there is one
+	SummaryGitHubActions null.Bool   `json:"summaryGitHubActions"`
+	GitHubStepSummary    null.String `json:"githubStepSummary"`
+
+	// File the end-of-test summary is also written to as a standalone HTML
+	// report, with charts of the latency distributions
+	ReportHTML null.String `json:"reportHTML"`
+
+	// File the thresholds and checks are written to as JUnit XML test cases,
+	// so that CI systems show k6 failures like those of any other test suite
+	ReportJUnit null.String `json:"reportJUnit"`
+
+	// File with service level objectives, which are compiled into thresholds
+	// and reported in their own section of the end-of-test summary
+	SLO null.String `json:"slo"`
+
+	// Targets the end-of-test summary is posted to, in the `kind=url` format,
+	// with an optional text/template file for the message and a dashboard link
+	Notify         []string    `json:"notify"`
+	NotifyTemplate null.String `json:"notifyTemplate"`
+	NotifyLink     null.String `json:"notifyLink"`
+
+	// Targets the threshold events are posted to as they happen, in the same
+	// `kind=url` format
+	NotifyThresholds []string `json:"notifyThresholds"`
+
+	// Directory for memory-mapped files with the raw values of trend metrics,
+	// used instead of the Go heap for long-running high-RPS tests
+	TrendSpillDir null.String `json:"trendSpillDir"`
+
+	// File the progress of the test run is periodically saved to, and how
+	// often, so it can be resumed from there with Resume
+	CheckpointFile     null.String        `json:"checkpointFile"`
+	CheckpointInterval types.NullDuration `json:"checkpointInterval"`
+
+	// Checkpoint file of an earlier test run, which is resumed from where it
+	// stopped instead of starting over
+	Resume null.String `json:"resume"`
+
+	// Sources that secrets are resolved from, in the `type=argument` format
+	SecretSources []string `json:"secretSources"`
+
+	// Restrict TLS and k6/crypto to FIPS-approved algorithms
+	FIPSMode null.Bool `json:"fipsMode"`
+
+	// Only warn about unknown keys in the script options, instead of failing
+	NoStrictOptions null.Bool `json:"noStrictOptions"`
+}
+
+// VUEnv returns a new map with the environment variables that the VUs see, i.e.
+// Env with the values from FileEnv applied over it.
+func (o RuntimeOptions) VUEnv() map[string]string {
+	env := make(map[string]string, len(o.Env)+len(o.FileEnv))
+	for k, v := range o.Env {
+		env[k] = v
+	}
+	for k, v := range o.FileEnv {
+		env[k] = v
+	}
+	return env
 }
 
 // ValidateCompatibilityMode checks if the provided val is a valid compatibility mode
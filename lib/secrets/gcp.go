@@ -0,0 +1,111 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const gcpEndpoint = "https://secretmanager.googleapis.com"
+
+// gcpSource reads the latest versions of secrets from the Google Cloud Secret
+// Manager of the configured project, e.g. `gcp=my-project`. It authenticates
+// with an OAuth2 access token from the GOOGLE_OAUTH_ACCESS_TOKEN environment
+// variable, like the one returned by `gcloud auth print-access-token`. Secret
+// names can have a `name@version` suffix to pin a specific version.
+type gcpSource struct {
+	endpoint string
+	project  string
+	token    string
+	client   *http.Client
+}
+
+func newGCPSource(project string) (*gcpSource, error) {
+	if project == "" {
+		project = os.Getenv("GOOGLE_CLOUD_PROJECT")
+	}
+	if project == "" {
+		return nil, errors.New("the gcp secret source requires a project ID, e.g. gcp=my-project")
+	}
+	token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN")
+	if token == "" {
+		return nil, errors.New("the gcp secret source requires the GOOGLE_OAUTH_ACCESS_TOKEN environment variable")
+	}
+	return &gcpSource{endpoint: gcpEndpoint, project: project, token: token, client: http.DefaultClient}, nil
+}
+
+func (s *gcpSource) Description() string {
+	return fmt.Sprintf("gcp (%s)", s.project)
+}
+
+func (s *gcpSource) Get(ctx context.Context, name string) (string, error) {
+	version := "latest"
+	if idx := strings.LastIndexByte(name, '@'); idx != -1 {
+		name, version = name[:idx], name[idx+1:]
+	}
+	u := fmt.Sprintf("%s/v1/projects/%s/secrets/%s/versions/%s:access", s.endpoint, s.project, name, version)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.token)
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrNotFound
+	default:
+		return "", fmt.Errorf("unexpected response status %d: %s", resp.StatusCode, body)
+	}
+
+	var envelope struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return "", fmt.Errorf("couldn't parse the response: %w", err)
+	}
+	value, err := base64.StdEncoding.DecodeString(envelope.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("couldn't decode the secret payload: %w", err)
+	}
+	return string(value), nil
+}
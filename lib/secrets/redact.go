@@ -0,0 +1,132 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Redacted is what secret values are replaced with.
+const Redacted = "***"
+
+//nolint:gochecknoglobals
+var redactor = struct {
+	sync.RWMutex
+	values   map[string]int // how many times every value was added
+	replacer *strings.Replacer
+}{values: make(map[string]int)}
+
+// AddRedacted registers the given value as a secret, so it's replaced by
+// Redact() from now on. Empty values are ignored.
+func AddRedacted(value string) {
+	if value == "" {
+		return
+	}
+	redactor.Lock()
+	defer redactor.Unlock()
+	redactor.values[value]++
+	if redactor.values[value] == 1 {
+		rebuildReplacer()
+	}
+}
+
+// RemoveRedacted unregisters a value that was registered with AddRedacted(),
+// for short-lived secrets that aren't valid anymore, like expired tokens. The
+// value is only removed when it was removed as many times as it was added.
+func RemoveRedacted(value string) {
+	if value == "" {
+		return
+	}
+	redactor.Lock()
+	defer redactor.Unlock()
+	count, ok := redactor.values[value]
+	if !ok {
+		return
+	}
+	if count > 1 {
+		redactor.values[value] = count - 1
+		return
+	}
+	delete(redactor.values, value)
+	rebuildReplacer()
+}
+
+// rebuildReplacer should be called with the redactor lock held.
+func rebuildReplacer() {
+	if len(redactor.values) == 0 {
+		redactor.replacer = nil
+		return
+	}
+
+	// Longer values go first, so a secret that contains another one is
+	// completely redacted.
+	values := make([]string, 0, len(redactor.values))
+	for v := range redactor.values {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	oldnew := make([]string, 0, 2*len(values))
+	for _, v := range values {
+		oldnew = append(oldnew, v, Redacted)
+	}
+	redactor.replacer = strings.NewReplacer(oldnew...)
+}
+
+// Redact replaces all known secret values in the given string.
+func Redact(s string) string {
+	redactor.RLock()
+	replacer := redactor.replacer
+	redactor.RUnlock()
+	if replacer == nil {
+		return s
+	}
+	return replacer.Replace(s)
+}
+
+// RedactionHook is a logrus hook that redacts all known secret values from
+// the log messages and their string fields.
+type RedactionHook struct{}
+
+// Levels returns all log levels, since secrets should be redacted from all of
+// them.
+func (RedactionHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire redacts the given log entry in place.
+func (RedactionHook) Fire(entry *logrus.Entry) error {
+	entry.Message = Redact(entry.Message)
+	for k, v := range entry.Data {
+		switch val := v.(type) {
+		case string:
+			entry.Data[k] = Redact(val)
+		case error:
+			if redacted := Redact(val.Error()); redacted != val.Error() {
+				entry.Data[k] = redacted
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,179 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package secrets resolves secret values, like passwords and API tokens, from
+// external sources at runtime, so they don't have to be part of test scripts,
+// archives or environment variables passed with --env. All resolved values are
+// remembered and redacted from the k6 logs.
+package secrets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// ErrNotFound should be returned by sources that don't have the requested
+// secret, so that the next configured source can be tried.
+var ErrNotFound = errors.New("secret not found")
+
+// Source is a backend that secrets can be retrieved from.
+type Source interface {
+	// Description returns a human-readable description of the source.
+	Description() string
+
+	// Get returns the value of the secret with the given name or ErrNotFound
+	// if the source doesn't have it.
+	Get(ctx context.Context, name string) (string, error)
+}
+
+// Manager resolves secrets from one or more sources, tried in order, and
+// caches the results, so every secret is requested at most once per test run.
+// It's safe for concurrent use.
+type Manager struct {
+	sources []Source
+
+	mu       sync.Mutex
+	cache    map[string]string
+	fetching map[string]*fetch
+}
+
+// fetch is a secret that's being fetched from the sources. Concurrent requests
+// for the same secret wait for it, instead of hitting the sources again.
+type fetch struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+// NewManager returns a manager for the given sources.
+func NewManager(sources ...Source) *Manager {
+	return &Manager{
+		sources:  sources,
+		cache:    make(map[string]string),
+		fetching: make(map[string]*fetch),
+	}
+}
+
+// NewManagerFromConfig parses the given source configurations, each of which
+// is in the `type=argument` form used by the --secret-source CLI flag, and
+// returns a manager for them.
+func NewManagerFromConfig(configs []string) (*Manager, error) {
+	sources := make([]Source, 0, len(configs))
+	for _, config := range configs {
+		source, err := parseSource(config)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, source)
+	}
+	return NewManager(sources...), nil
+}
+
+func parseSource(config string) (Source, error) {
+	sourceType, arg := config, ""
+	if idx := strings.IndexRune(config, '='); idx != -1 {
+		sourceType, arg = config[:idx], config[idx+1:]
+	}
+
+	switch sourceType {
+	case "env":
+		return newEnvSource(arg), nil
+	case "file":
+		return newFileSource(arg)
+	case "vault":
+		return newVaultSource(arg)
+	case "aws":
+		return newAWSSource(arg)
+	case "gcp":
+		return newGCPSource(arg)
+	default:
+		return nil, fmt.Errorf("invalid secret source type '%s'", sourceType)
+	}
+}
+
+// Description returns a comma-separated list of the descriptions of all
+// configured sources.
+func (m *Manager) Description() string {
+	descriptions := make([]string, len(m.sources))
+	for i, source := range m.sources {
+		descriptions[i] = source.Description()
+	}
+	return strings.Join(descriptions, ", ")
+}
+
+// Get returns the value of the secret with the given name from the first
+// source that has it. The value is cached and registered for redaction.
+func (m *Manager) Get(ctx context.Context, name string) (string, error) {
+	if name == "" {
+		return "", errors.New("secret name must not be empty")
+	}
+	if len(m.sources) == 0 {
+		return "", errors.New("no secret sources are configured, use the --secret-source option")
+	}
+
+	m.mu.Lock()
+	if value, ok := m.cache[name]; ok {
+		m.mu.Unlock()
+		return value, nil
+	}
+	if f, ok := m.fetching[name]; ok {
+		m.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.value, f.err
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+	}
+	f := &fetch{done: make(chan struct{})}
+	m.fetching[name] = f
+	m.mu.Unlock()
+
+	// The lock isn't held while the sources are queried, so slow remote
+	// backends only block the requests for the same secret.
+	f.value, f.err = m.fetch(ctx, name)
+
+	m.mu.Lock()
+	delete(m.fetching, name)
+	if f.err == nil {
+		m.cache[name] = f.value
+	}
+	m.mu.Unlock()
+	close(f.done)
+	return f.value, f.err
+}
+
+func (m *Manager) fetch(ctx context.Context, name string) (string, error) {
+	for _, source := range m.sources {
+		value, err := source.Get(ctx, name)
+		if errors.Is(err, ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("couldn't get secret '%s' from %s: %w", name, source.Description(), err)
+		}
+		AddRedacted(value)
+		return value, nil
+	}
+	return "", fmt.Errorf("secret '%s' was not found in any of the configured sources", name)
+}
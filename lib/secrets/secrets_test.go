@@ -0,0 +1,380 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type mapSource map[string]string
+
+func (m mapSource) Description() string { return "map" }
+
+func (m mapSource) Get(_ context.Context, name string) (string, error) {
+	if v, ok := m[name]; ok {
+		return v, nil
+	}
+	return "", ErrNotFound
+}
+
+type errSource struct{ calls int }
+
+func (e *errSource) Description() string { return "err" }
+
+func (e *errSource) Get(context.Context, string) (string, error) {
+	e.calls++
+	return "", errors.New("boom")
+}
+
+func TestManager(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+
+	_, err := NewManager().Get(ctx, "a")
+	assert.Contains(t, err.Error(), "no secret sources")
+
+	es := &errSource{}
+	m := NewManager(mapSource{"a": "secret-a-value"}, mapSource{"a": "other", "b": "secret-b-value"}, es)
+	assert.Equal(t, "map, map, err", m.Description())
+
+	v, err := m.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-a-value", v)
+	v, err = m.Get(ctx, "b")
+	require.NoError(t, err)
+	assert.Equal(t, "secret-b-value", v)
+
+	_, err = m.Get(ctx, "c")
+	assert.EqualError(t, err, "couldn't get secret 'c' from err: boom")
+	_, err = m.Get(ctx, "")
+	assert.Error(t, err)
+
+	// cached values don't hit the sources again
+	_, err = m.Get(ctx, "a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, es.calls)
+
+	assert.Equal(t, "x *** y ***", Redact("x secret-a-value y secret-b-value"))
+}
+
+// blockingSource counts the requests for every secret and blocks the ones for
+// "slow" until it's released.
+type blockingSource struct {
+	mu      sync.Mutex
+	calls   map[string]int
+	release chan struct{}
+}
+
+func (b *blockingSource) Description() string { return "blocking" }
+
+func (b *blockingSource) Get(_ context.Context, name string) (string, error) {
+	b.mu.Lock()
+	b.calls[name]++
+	b.mu.Unlock()
+	if name == "slow" {
+		<-b.release
+	}
+	return name + "-secret-value", nil
+}
+
+func TestManagerConcurrentGet(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	bs := &blockingSource{calls: make(map[string]int), release: make(chan struct{})}
+	m := NewManager(bs)
+
+	const waiters = 5
+	results := make(chan string, waiters)
+	for i := 0; i < waiters; i++ {
+		go func() {
+			v, err := m.Get(ctx, "slow")
+			assert.NoError(t, err)
+			results <- v
+		}()
+	}
+
+	// other secrets aren't blocked by the one that's being fetched
+	v, err := m.Get(ctx, "fast")
+	require.NoError(t, err)
+	assert.Equal(t, "fast-secret-value", v)
+
+	// a waiter gives up when its context is done
+	cancelCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	for {
+		m.mu.Lock()
+		_, fetching := m.fetching["slow"]
+		m.mu.Unlock()
+		if fetching {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	_, err = m.Get(cancelCtx, "slow")
+	assert.Equal(t, context.Canceled, err)
+
+	close(bs.release)
+	for i := 0; i < waiters; i++ {
+		assert.Equal(t, "slow-secret-value", <-results)
+	}
+	assert.Equal(t, map[string]int{"slow": 1, "fast": 1}, bs.calls)
+}
+
+func TestRedaction(t *testing.T) {
+	t.Parallel()
+	AddRedacted("")
+	AddRedacted("hunter2")
+	AddRedacted("hunter2hunter2")
+	assert.Equal(t, "pass=*** ***", Redact("pass=hunter2hunter2 hunter2"))
+	assert.Equal(t, "nothing", Redact("nothing"))
+
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	logger.AddHook(RedactionHook{})
+	var entry *logrus.Entry
+	logger.AddHook(&captureHook{entry: &entry})
+	logger.WithField("token", "hunter2").WithError(errors.New("bad hunter2")).Info("got hunter2")
+	require.NotNil(t, entry)
+	assert.Equal(t, "got ***", entry.Message)
+	assert.Equal(t, "***", entry.Data["token"])
+	assert.Equal(t, "bad ***", entry.Data[logrus.ErrorKey])
+}
+
+func TestRemoveRedacted(t *testing.T) {
+	t.Parallel()
+	AddRedacted("old-token")
+	AddRedacted("shared-token")
+	AddRedacted("shared-token")
+	assert.Equal(t, "*** ***", Redact("old-token shared-token"))
+
+	RemoveRedacted("old-token")
+	RemoveRedacted("never-added")
+	RemoveRedacted("")
+	assert.Equal(t, "old-token ***", Redact("old-token shared-token"))
+
+	// values added more than once are only removed by the last removal
+	RemoveRedacted("shared-token")
+	assert.Equal(t, "***", Redact("shared-token"))
+	RemoveRedacted("shared-token")
+	assert.Equal(t, "shared-token", Redact("shared-token"))
+}
+
+type captureHook struct{ entry **logrus.Entry }
+
+func (c *captureHook) Levels() []logrus.Level { return logrus.AllLevels }
+
+func (c *captureHook) Fire(e *logrus.Entry) error {
+	*c.entry = e
+	return nil
+}
+
+func TestParseSources(t *testing.T) {
+	dir, err := ioutil.TempDir("", "k6-secrets")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	file := filepath.Join(dir, "secrets.json")
+	require.NoError(t, ioutil.WriteFile(file, []byte(`{"db":"pa55"}`), 0o600))
+	badFile := filepath.Join(dir, "bad.json")
+	require.NoError(t, ioutil.WriteFile(badFile, []byte(`[1]`), 0o600))
+
+	require.NoError(t, os.Setenv("K6_SECRET_TEST_PARSE", "from-env"))
+	defer func() { _ = os.Unsetenv("K6_SECRET_TEST_PARSE") }()
+
+	m, err := NewManagerFromConfig([]string{"env", "file=" + file})
+	require.NoError(t, err)
+	v, err := m.Get(context.Background(), "TEST_PARSE")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", v)
+	v, err = m.Get(context.Background(), "db")
+	require.NoError(t, err)
+	assert.Equal(t, "pa55", v)
+
+	for _, config := range []string{"bogus", "file", "file=" + badFile, "file=" + filepath.Join(dir, "nope")} {
+		_, err := NewManagerFromConfig([]string{config})
+		assert.Error(t, err, config)
+	}
+}
+
+func TestVaultSource(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "token", r.Header.Get("X-Vault-Token"))
+		switch r.URL.Path {
+		case "/v1/kv/data/app/db":
+			_, _ = w.Write([]byte(`{"data":{"data":{"user":"admin","password":"s3cr3t"}}}`))
+		case "/v1/kv/data/single":
+			_, _ = w.Write([]byte(`{"data":{"data":{"value":"only"}}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	addr, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+	s := &vaultSource{addr: addr, mount: "kv", token: "token", client: srv.Client()}
+	ctx := context.Background()
+
+	v, err := s.Get(ctx, "app/db#password")
+	require.NoError(t, err)
+	assert.Equal(t, "s3cr3t", v)
+	v, err = s.Get(ctx, "single")
+	require.NoError(t, err)
+	assert.Equal(t, "only", v)
+	_, err = s.Get(ctx, "app/db")
+	assert.Contains(t, err.Error(), "specify one")
+	_, err = s.Get(ctx, "app/db#missing")
+	assert.Equal(t, ErrNotFound, err)
+	_, err = s.Get(ctx, "missing")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestGCPSource(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		switch r.URL.Path {
+		case "/v1/projects/proj/secrets/api-key/versions/latest:access",
+			"/v1/projects/proj/secrets/api-key/versions/3:access":
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{
+				"payload": map[string]string{"data": base64.StdEncoding.EncodeToString([]byte("key-" + strings.TrimPrefix(r.URL.Path, "/v1/projects/proj/secrets/api-key/versions/")))},
+			})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	s := &gcpSource{endpoint: srv.URL, project: "proj", token: "token", client: srv.Client()}
+	v, err := s.Get(context.Background(), "api-key")
+	require.NoError(t, err)
+	assert.Equal(t, "key-latest:access", v)
+	v, err = s.Get(context.Background(), "api-key@3")
+	require.NoError(t, err)
+	assert.Equal(t, "key-3:access", v)
+	_, err = s.Get(context.Background(), "missing")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestAWSSource(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=AKID/20210301/eu-west-1/secretsmanager/aws4_request, "+
+				"SignedHeaders=content-type;host;x-amz-date;x-amz-target, Signature="))
+
+		var input struct{ SecretId string } //nolint:golint,stylecheck
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		switch input.SecretId {
+		case "plain":
+			_, _ = w.Write([]byte(`{"SecretString":"plain-value"}`))
+		case "json":
+			_, _ = w.Write([]byte(`{"SecretString":"{\"user\":\"u\",\"pass\":\"p\"}"}`))
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"ResourceNotFoundException","message":"nope"}`))
+		}
+	}))
+	defer srv.Close()
+
+	s := &awsSource{
+		endpoint: srv.URL,
+		region:   "eu-west-1",
+		creds:    awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"},
+		client:   srv.Client(),
+		now:      func() time.Time { return time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC) },
+	}
+	ctx := context.Background()
+	v, err := s.Get(ctx, "plain")
+	require.NoError(t, err)
+	assert.Equal(t, "plain-value", v)
+	v, err = s.Get(ctx, "json#pass")
+	require.NoError(t, err)
+	assert.Equal(t, "p", v)
+	_, err = s.Get(ctx, "plain#pass")
+	assert.Error(t, err)
+	_, err = s.Get(ctx, "missing")
+	assert.Equal(t, ErrNotFound, err)
+}
+
+func TestDecryptAWSKMS(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "TrentService.Decrypt", r.Header.Get("X-Amz-Target"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=AKID/20210301/eu-west-1/kms/aws4_request, "))
+
+		var input struct{ CiphertextBlob []byte }
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&input))
+		if string(input.CiphertextBlob) != "blob" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"__type":"InvalidCiphertextException"}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"KeyId":"k","Plaintext":"cGxhaW4="}`))
+	}))
+	defer srv.Close()
+
+	creds := awsCredentials{AccessKeyID: "AKID", SecretAccessKey: "secret"}
+	now := time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC)
+	plaintext, err := decryptAWSKMS(context.Background(), srv.Client(), srv.URL, "eu-west-1", creds, []byte("blob"), now)
+	require.NoError(t, err)
+	assert.Equal(t, "plain", string(plaintext))
+
+	_, err = decryptAWSKMS(context.Background(), srv.Client(), srv.URL, "eu-west-1", creds, []byte("bad"), now)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "InvalidCiphertextException")
+}
+
+func TestSignAWSRequestV4(t *testing.T) {
+	t.Parallel()
+	// The example from the AWS General Reference documentation
+	req, err := http.NewRequest(http.MethodGet, "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08", nil)
+	require.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	creds := awsCredentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"}
+	signAWSRequestV4(req, nil, creds, "us-east-1", "iam", time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC))
+
+	assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+	assert.Equal(t,
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, "+
+			"SignedHeaders=content-type;host;x-amz-date, "+
+			"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		req.Header.Get("Authorization"))
+}
@@ -0,0 +1,117 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+)
+
+const defaultEnvPrefix = "K6_SECRET_"
+
+// envSource reads secrets from the environment variables of the k6 process.
+// Unlike the variables passed with --env, they aren't saved in archives.
+type envSource struct {
+	prefix string
+}
+
+func newEnvSource(prefix string) *envSource {
+	if prefix == "" {
+		prefix = defaultEnvPrefix
+	}
+	return &envSource{prefix: prefix}
+}
+
+func (s *envSource) Description() string {
+	return fmt.Sprintf("env (%s*)", s.prefix)
+}
+
+func (s *envSource) Get(_ context.Context, name string) (string, error) {
+	if value, ok := os.LookupEnv(s.prefix + name); ok {
+		return value, nil
+	}
+	return "", ErrNotFound
+}
+
+// fileSource reads secrets from a local JSON file with a single object, whose
+// keys are the secret names and values are the secrets. The file is read once
+// when the source is created and it's never included in archives.
+type fileSource struct {
+	path    string
+	secrets map[string]string
+}
+
+func newFileSource(path string) (*fileSource, error) {
+	if path == "" {
+		return nil, fmt.Errorf("the file secret source requires a path, e.g. file=secrets.json")
+	}
+	data, err := ioutil.ReadFile(path) //nolint:gosec
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read the secrets file: %w", err)
+	}
+	secrets := make(map[string]string)
+	if err := json.Unmarshal(data, &secrets); err != nil {
+		return nil, fmt.Errorf("the secrets file '%s' should contain a JSON object with string values: %w", path, err)
+	}
+	return &fileSource{path: path, secrets: secrets}, nil
+}
+
+func (s *fileSource) Description() string {
+	return fmt.Sprintf("file (%s)", s.path)
+}
+
+func (s *fileSource) Get(_ context.Context, name string) (string, error) {
+	if value, ok := s.secrets[name]; ok {
+		return value, nil
+	}
+	return "", ErrNotFound
+}
+
+// splitField splits secret names like `path/to/secret#field` for backends that
+// store multiple values per secret.
+func splitField(name string) (string, string) {
+	if idx := strings.LastIndexByte(name, '#'); idx != -1 {
+		return name[:idx], name[idx+1:]
+	}
+	return name, ""
+}
+
+// pickField returns the requested field from a secret with multiple values. If
+// no field was requested, the secret must have exactly one value.
+func pickField(values map[string]interface{}, field string) (string, error) {
+	if field == "" {
+		if len(values) != 1 {
+			return "", fmt.Errorf("the secret has %d fields, specify one with `name#field`", len(values))
+		}
+		for _, v := range values {
+			return fmt.Sprint(v), nil
+		}
+	}
+	v, ok := values[field]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return fmt.Sprint(v), nil
+}
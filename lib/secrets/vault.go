@@ -0,0 +1,121 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// vaultSource reads secrets from the KV version 2 secrets engine of a
+// HashiCorp Vault server. It's configured with the URL of the engine mount,
+// e.g. `vault=https://vault.example.com:8200/secret`, and uses the standard
+// VAULT_TOKEN and (optionally) VAULT_NAMESPACE environment variables.
+// Secret names have the `path/to/secret#field` form.
+type vaultSource struct {
+	addr      *url.URL
+	mount     string
+	token     string
+	namespace string
+	client    *http.Client
+}
+
+func newVaultSource(arg string) (*vaultSource, error) {
+	if arg == "" {
+		arg = os.Getenv("VAULT_ADDR") + "/secret"
+	}
+	u, err := url.Parse(arg)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("the vault secret source requires the URL of a KV mount, e.g. " +
+			"vault=https://vault.example.com:8200/secret")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		return nil, errors.New("the vault secret source requires the VAULT_TOKEN environment variable")
+	}
+	mount := strings.Trim(u.Path, "/")
+	if mount == "" {
+		mount = "secret"
+	}
+	u.Path = ""
+
+	return &vaultSource{
+		addr:      u,
+		mount:     mount,
+		token:     token,
+		namespace: os.Getenv("VAULT_NAMESPACE"),
+		client:    http.DefaultClient,
+	}, nil
+}
+
+func (s *vaultSource) Description() string {
+	return fmt.Sprintf("vault (%s/%s)", s.addr, s.mount)
+}
+
+func (s *vaultSource) Get(ctx context.Context, name string) (string, error) {
+	path, field := splitField(name)
+	u := *s.addr
+	u.Path = "/v1/" + s.mount + "/data/" + strings.TrimLeft(path, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", s.token)
+	if s.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", s.namespace)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrNotFound
+	default:
+		return "", fmt.Errorf("unexpected response status %d: %s", resp.StatusCode, body)
+	}
+
+	var envelope struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return "", fmt.Errorf("couldn't parse the response: %w", err)
+	}
+	return pickField(envelope.Data.Data, field)
+}
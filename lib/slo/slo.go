@@ -0,0 +1,312 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package slo compiles service level objectives into thresholds, and reports
+// how well the test run met them and how much of their error budgets it used.
+package slo
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+// The kinds of objectives.
+const (
+	KindAvailability = "availability"
+	KindLatency      = "latency"
+)
+
+// The metrics and the percentile that are used when an objective doesn't
+// specify them.
+const (
+	DefaultAvailabilityMetric = "http_req_failed"
+	DefaultLatencyMetric      = "http_req_duration"
+	DefaultPercentile         = 95
+)
+
+// Config is the content of an SLO file, in YAML or JSON.
+type Config struct {
+	Objectives []*Objective `yaml:"objectives"`
+}
+
+// Objective is a single service level objective, either an availability or
+// a latency one.
+type Objective struct {
+	Name string `yaml:"name"`
+	// Availability objectives need a rate metric of failures, and latency
+	// ones a trend metric in milliseconds. Submetrics like
+	// `http_req_duration{scenario:api}` can be used as well.
+	Metric string `yaml:"metric"`
+	// The minimum percentage of successful events, e.g. 99.9
+	Availability float64 `yaml:"availability"`
+	// The maximum duration of the percentile of the events, e.g. 300ms
+	Latency    string  `yaml:"latency"`
+	Percentile float64 `yaml:"percentile"`
+	// Only for availability objectives
+	BurnRate *BurnRate `yaml:"burnRate"`
+
+	kind    string
+	latency time.Duration
+	window  time.Duration
+}
+
+// BurnRate alerts when the error budget of an availability objective is
+// used too quickly, i.e. when the error rate over the window is more than
+// Max times the whole error budget.
+type BurnRate struct {
+	Window      string  `yaml:"window"`
+	Max         float64 `yaml:"max"`
+	AbortOnFail bool    `yaml:"abortOnFail"`
+}
+
+// Load parses and validates an SLO file.
+func Load(data []byte) (*Config, error) {
+	conf := &Config{}
+	if err := yaml.UnmarshalStrict(data, conf); err != nil {
+		return nil, fmt.Errorf("invalid SLO file: %w", err)
+	}
+	if len(conf.Objectives) == 0 {
+		return nil, fmt.Errorf("the SLO file doesn't have any objectives")
+	}
+	names := make(map[string]bool, len(conf.Objectives))
+	for i, o := range conf.Objectives {
+		if o.Name == "" {
+			return nil, fmt.Errorf("the objective %d doesn't have a name", i)
+		}
+		if names[o.Name] {
+			return nil, fmt.Errorf("there is more than one '%s' objective", o.Name)
+		}
+		names[o.Name] = true
+		if err := o.init(); err != nil {
+			return nil, fmt.Errorf("invalid '%s' objective: %w", o.Name, err)
+		}
+	}
+	return conf, nil
+}
+
+// init validates the objective and sets its defaults.
+func (o *Objective) init() error {
+	switch {
+	case o.Availability != 0 && o.Latency != "":
+		return fmt.Errorf("it can't have both an availability and a latency")
+	case o.Availability != 0:
+		o.kind = KindAvailability
+		if o.Availability <= 0 || o.Availability >= 100 {
+			return fmt.Errorf("the availability should be between 0 and 100, but is %g", o.Availability)
+		}
+		if o.Metric == "" {
+			o.Metric = DefaultAvailabilityMetric
+		}
+	case o.Latency != "":
+		o.kind = KindLatency
+		latency, err := types.ParseExtendedDuration(o.Latency)
+		if err != nil || latency <= 0 {
+			return fmt.Errorf("the latency should be a positive duration, but is '%s'", o.Latency)
+		}
+		o.latency = latency
+		if o.Percentile == 0 {
+			o.Percentile = DefaultPercentile
+		}
+		if o.Percentile <= 0 || o.Percentile >= 100 {
+			return fmt.Errorf("the percentile should be between 0 and 100, but is %g", o.Percentile)
+		}
+		if o.Metric == "" {
+			o.Metric = DefaultLatencyMetric
+		}
+	default:
+		return fmt.Errorf("it should have either an availability or a latency")
+	}
+	if o.Percentile != 0 && o.kind != KindLatency {
+		return fmt.Errorf("only latency objectives have a percentile")
+	}
+
+	if o.BurnRate != nil {
+		if o.kind != KindAvailability {
+			return fmt.Errorf("only availability objectives have a burn rate")
+		}
+		window, err := types.ParseExtendedDuration(o.BurnRate.Window)
+		if err != nil || window <= 0 {
+			return fmt.Errorf("the burn rate window should be a positive duration, but is '%s'", o.BurnRate.Window)
+		}
+		o.window = window
+		if o.BurnRate.Max <= 0 {
+			return fmt.Errorf("the maximum burn rate should be positive, but is %g", o.BurnRate.Max)
+		}
+	}
+	return nil
+}
+
+// errorBudget returns the ratio of the events that can fail, or be slower
+// than the latency, without breaking the objective.
+func (o *Objective) errorBudget() float64 {
+	if o.kind == KindAvailability {
+		return (100 - o.Availability) / 100
+	}
+	return (100 - o.Percentile) / 100
+}
+
+// latencyMs returns the latency target in milliseconds, the unit of the trend
+// metrics of durations.
+func (o *Objective) latencyMs() float64 {
+	return float64(o.latency) / float64(time.Millisecond)
+}
+
+// String returns a human-readable description of the objective.
+func (o *Objective) String() string {
+	if o.kind == KindAvailability {
+		return formatFloat(o.Availability) + "% availability"
+	}
+	return fmt.Sprintf("p(%s) <= %s", formatFloat(o.Percentile), o.latency)
+}
+
+// thresholds returns the threshold configs the objective is compiled into.
+func (o *Objective) thresholds() []map[string]interface{} {
+	if o.kind == KindLatency {
+		src := fmt.Sprintf("p(%s)<=%s", formatFloat(o.Percentile), formatFloat(o.latencyMs()))
+		return []map[string]interface{}{{"threshold": src}}
+	}
+
+	budget := o.errorBudget()
+	configs := []map[string]interface{}{{"threshold": "rate<=" + formatFloat(budget)}}
+	if o.BurnRate != nil {
+		src := fmt.Sprintf("rate_over(%s)<=%s", o.window, formatFloat(budget*o.BurnRate.Max))
+		configs = append(configs, map[string]interface{}{"threshold": src, "abortOnFail": o.BurnRate.AbortOnFail})
+	}
+	return configs
+}
+
+// AddThresholds returns the given thresholds together with the ones that the
+// objectives are compiled into.
+func (c *Config) AddThresholds(thresholds map[string]stats.Thresholds) (map[string]stats.Thresholds, error) {
+	configs := make(map[string][]interface{})
+	for _, o := range c.Objectives {
+		for _, th := range o.thresholds() {
+			configs[o.Metric] = append(configs[o.Metric], th)
+		}
+	}
+
+	result := make(map[string]stats.Thresholds, len(thresholds)+len(configs))
+	for name, ths := range thresholds {
+		result[name] = ths
+	}
+	for name, newConfigs := range configs {
+		// The thresholds of a metric share a JS runtime, so the existing ones
+		// have to be recreated together with the new ones.
+		var all []interface{}
+		if existing, ok := result[name]; ok {
+			data, err := json.Marshal(existing)
+			if err != nil {
+				return nil, err
+			}
+			if err = json.Unmarshal(data, &all); err != nil {
+				return nil, err
+			}
+		}
+		data, err := json.Marshal(append(all, newConfigs...))
+		if err != nil {
+			return nil, err
+		}
+		var ths stats.Thresholds
+		if err := json.Unmarshal(data, &ths); err != nil {
+			return nil, fmt.Errorf("invalid thresholds of the '%s' metric: %w", name, err)
+		}
+		result[name] = ths
+	}
+	return result, nil
+}
+
+// Result is how well the test run met a single objective.
+type Result struct {
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Metric    string `json:"metric"`
+	Objective string `json:"objective"`
+	// The availability percentage, or the latency percentile in milliseconds
+	Value  float64 `json:"value"`
+	Target float64 `json:"target"`
+	// The ratio of the error budget that was used, above 1 if it was exceeded
+	ErrorBudgetUsed float64 `json:"error_budget_used"`
+	Met             bool    `json:"met"`
+	// The metric didn't have any samples, so the objective couldn't be checked
+	NoData bool `json:"no_data,omitempty"`
+}
+
+// Evaluate returns the results of all objectives with the given final metrics
+// of the test run, in the order of the objectives.
+func (c *Config) Evaluate(metrics map[string]*stats.Metric) []Result {
+	results := make([]Result, len(c.Objectives))
+	for i, o := range c.Objectives {
+		results[i] = o.evaluate(metrics[o.Metric])
+	}
+	return results
+}
+
+func (o *Objective) evaluate(m *stats.Metric) Result {
+	r := Result{Name: o.Name, Kind: o.kind, Metric: o.Metric, Objective: o.String(), NoData: true}
+	budget := o.errorBudget()
+	if o.kind == KindAvailability {
+		r.Target = o.Availability
+		sink, ok := metricSink(m).(*stats.RateSink)
+		if !ok || sink.Total == 0 {
+			return r
+		}
+		failed := float64(sink.Trues) / float64(sink.Total)
+		r.Value = 100 * (1 - failed)
+		r.ErrorBudgetUsed = failed / budget
+	} else {
+		r.Target = o.latencyMs()
+		sink, ok := metricSink(m).(*stats.TrendSink)
+		if !ok || sink.Count == 0 {
+			return r
+		}
+		sink.Calc()
+		r.Value = sink.P(o.Percentile / 100)
+		slow := len(sink.Values) - sort.Search(len(sink.Values), func(i int) bool {
+			return sink.Values[i] > r.Target
+		})
+		r.ErrorBudgetUsed = float64(slow) / float64(len(sink.Values)) / budget
+	}
+	r.NoData = false
+	r.ErrorBudgetUsed = math.Round(r.ErrorBudgetUsed*1e9) / 1e9
+	r.Met = r.ErrorBudgetUsed <= 1
+	return r
+}
+
+func metricSink(m *stats.Metric) stats.Sink {
+	if m == nil {
+		return nil
+	}
+	return m.Sink
+}
+
+// formatFloat formats the number without the noise of the float arithmetic,
+// e.g. 0.001 instead of 0.0010000000000000009.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(math.Round(v*1e9)/1e9, 'f', -1, 64)
+}
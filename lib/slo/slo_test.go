@@ -0,0 +1,166 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package slo
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+
+	t.Run("defaults", func(t *testing.T) {
+		t.Parallel()
+		conf, err := Load([]byte(`
+objectives:
+  - name: availability
+    availability: 99.9
+  - name: latency
+    latency: 300ms
+`))
+		require.NoError(t, err)
+		require.Len(t, conf.Objectives, 2)
+		assert.Equal(t, DefaultAvailabilityMetric, conf.Objectives[0].Metric)
+		assert.Equal(t, KindAvailability, conf.Objectives[0].kind)
+		assert.Equal(t, DefaultLatencyMetric, conf.Objectives[1].Metric)
+		assert.Equal(t, float64(DefaultPercentile), conf.Objectives[1].Percentile)
+		assert.Equal(t, "p(95) <= 300ms", conf.Objectives[1].String())
+	})
+
+	testCases := map[string]string{
+		"empty":             `objectives: []`,
+		"unknown field":     `{objectives: [{name: a, availability: 99, foo: 1}]}`,
+		"no name":           `{objectives: [{availability: 99}]}`,
+		"duplicate name":    `{objectives: [{name: a, availability: 99}, {name: a, latency: 1s}]}`,
+		"no kind":           `{objectives: [{name: a}]}`,
+		"both kinds":        `{objectives: [{name: a, availability: 99, latency: 1s}]}`,
+		"availability 100":  `{objectives: [{name: a, availability: 100}]}`,
+		"invalid latency":   `{objectives: [{name: a, latency: fast}]}`,
+		"latency burn rate": `{objectives: [{name: a, latency: 1s, burnRate: {window: 1m, max: 2}}]}`,
+		"percentile":        `{objectives: [{name: a, availability: 99, percentile: 90}]}`,
+		"no window":         `{objectives: [{name: a, availability: 99, burnRate: {max: 2}}]}`,
+	}
+	for name, data := range testCases {
+		data := data
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			_, err := Load([]byte(data))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestAddThresholds(t *testing.T) {
+	t.Parallel()
+	conf, err := Load([]byte(`
+objectives:
+  - name: availability
+    availability: 99.9
+    burnRate: {window: 5m, max: 14.4, abortOnFail: true}
+  - name: latency
+    latency: 1.5s
+    percentile: 99
+`))
+	require.NoError(t, err)
+
+	existing, err := stats.NewThresholds([]string{"p(95)<200"})
+	require.NoError(t, err)
+	thresholds, err := conf.AddThresholds(map[string]stats.Thresholds{
+		"http_req_duration": existing,
+		"checks":            {},
+	})
+	require.NoError(t, err)
+	require.Len(t, thresholds, 3)
+
+	sources := func(ths stats.Thresholds) (result []string) {
+		for _, th := range ths.Thresholds {
+			result = append(result, th.Source)
+		}
+		return result
+	}
+	assert.Equal(t, []string{"rate<=0.001", "rate_over(5m0s)<=0.0144"}, sources(thresholds["http_req_failed"]))
+	assert.True(t, thresholds["http_req_failed"].Thresholds[1].AbortOnFail)
+	assert.Equal(t, []string{"p(95)<200", "p(99)<=1500"}, sources(thresholds["http_req_duration"]))
+	assert.Empty(t, sources(thresholds["checks"]))
+}
+
+func TestEvaluate(t *testing.T) {
+	t.Parallel()
+	conf, err := Load([]byte(`
+objectives:
+  - name: availability
+    availability: 99
+  - name: latency
+    latency: 100ms
+    percentile: 90
+  - name: missing
+    metric: other
+    latency: 1s
+`))
+	require.NoError(t, err)
+
+	failed := stats.New("http_req_failed", stats.Rate)
+	for i := 0; i < 1000; i++ {
+		failed.Sink.Add(stats.Sample{Value: float64(boolToInt(i < 5))})
+	}
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	for i := 1; i <= 100; i++ {
+		duration.Sink.Add(stats.Sample{Value: float64(i * 2)})
+	}
+
+	results := conf.Evaluate(map[string]*stats.Metric{
+		"http_req_failed":   failed,
+		"http_req_duration": duration,
+	})
+	require.Len(t, results, 3)
+
+	assert.Equal(t, Result{
+		Name:            "availability",
+		Kind:            KindAvailability,
+		Metric:          "http_req_failed",
+		Objective:       "99% availability",
+		Value:           99.5,
+		Target:          99,
+		ErrorBudgetUsed: 0.5,
+		Met:             true,
+	}, results[0])
+
+	assert.Equal(t, KindLatency, results[1].Kind)
+	assert.Equal(t, float64(100), results[1].Target)
+	assert.InDelta(t, 180.2, results[1].Value, 0.01)
+	assert.Equal(t, float64(5), results[1].ErrorBudgetUsed)
+	assert.False(t, results[1].Met)
+
+	assert.True(t, results[2].NoData)
+	assert.False(t, results[2].Met)
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -31,6 +31,8 @@ import (
 	"github.com/sirupsen/logrus"
 	"golang.org/x/time/rate"
 
+	"github.com/loadimpact/k6/lib/redact"
+	"github.com/loadimpact/k6/lib/secrets"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -69,6 +71,16 @@ type State struct {
 
 	Vu, Iteration int64
 	Tags          map[string]string
+
+	// Secrets resolves the values for the k6/secrets module.
+	Secrets *secrets.Manager
+
+	// Redactor removes sensitive data from the HTTP debug output, nil if
+	// redaction isn't configured.
+	Redactor *redact.Redactor
+
+	// The requests that the VU is currently waiting for, if they're tracked.
+	InFlightRequests *InFlightRequests
 }
 
 // CloneTags makes a copy of the tags map and returns it.
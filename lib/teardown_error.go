@@ -0,0 +1,43 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+// TeardownError wraps the errors returned by teardown(), so they can be told
+// apart from the errors of the test run itself. The error isn't exposed via
+// Cause(), so that errors.Cause() stops at it.
+type TeardownError struct {
+	err error
+}
+
+// NewTeardownError returns a new TeardownError wrapping the given error.
+func NewTeardownError(err error) TeardownError {
+	return TeardownError{err: err}
+}
+
+// Error implements error interface.
+func (t TeardownError) Error() string {
+	return t.err.Error()
+}
+
+// Unwrap returns the error returned by teardown().
+func (t TeardownError) Unwrap() error {
+	return t.err
+}
@@ -0,0 +1,120 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package mockresolver
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// DNSServer is a minimal UDP DNS server answering the A and AAAA queries for
+// a fixed set of hosts, for testing the resolution through real DNS servers.
+type DNSServer struct {
+	Addr    string
+	hosts   map[string][]net.IP
+	queries int64
+}
+
+// NewDNSServer starts a DNS server on a random local port, which is stopped
+// at the end of the test.
+func NewDNSServer(tb testing.TB, hosts map[string][]net.IP) *DNSServer {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { _ = conn.Close() })
+
+	s := &DNSServer{Addr: conn.LocalAddr().String(), hosts: hosts}
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			atomic.AddInt64(&s.queries, 1)
+			if resp := s.answer(buf[:n]); resp != nil {
+				_, _ = conn.WriteTo(resp, addr)
+			}
+		}
+	}()
+	return s
+}
+
+// Queries returns the number of queries the server received.
+func (s *DNSServer) Queries() int {
+	return int(atomic.LoadInt64(&s.queries))
+}
+
+func (s *DNSServer) answer(query []byte) []byte {
+	if len(query) < 12 || binary.BigEndian.Uint16(query[4:6]) != 1 {
+		return nil
+	}
+	var labels []string
+	i := 12
+	for i < len(query) && query[i] != 0 {
+		l := int(query[i])
+		if i+1+l > len(query) {
+			return nil
+		}
+		labels = append(labels, string(query[i+1:i+1+l]))
+		i += 1 + l
+	}
+	if i+5 > len(query) {
+		return nil
+	}
+	qtype := binary.BigEndian.Uint16(query[i+1 : i+3])
+	question := query[12 : i+5]
+
+	ips, ok := s.hosts[strings.ToLower(strings.Join(labels, "."))]
+	var answers [][]byte
+	for _, ip := range ips {
+		var data []byte
+		switch {
+		case qtype == 1 && ip.To4() != nil:
+			data = ip.To4()
+		case qtype == 28 && ip.To4() == nil:
+			data = ip.To16()
+		default:
+			continue
+		}
+		rr := []byte{0xc0, 12, 0, byte(qtype), 0, 1, 0, 0, 0, 60, 0, byte(len(data))}
+		answers = append(answers, append(rr, data...))
+	}
+
+	flags := uint16(0x8180) // a response, with recursion desired and available
+	if !ok {
+		flags |= 3 // NXDOMAIN
+	}
+	resp := make([]byte, 12, 12+len(question)+16*len(answers))
+	copy(resp[0:2], query[0:2])
+	binary.BigEndian.PutUint16(resp[2:4], flags)
+	binary.BigEndian.PutUint16(resp[4:6], 1)
+	binary.BigEndian.PutUint16(resp[6:8], uint16(len(answers)))
+	resp = append(resp, question...)
+	for _, rr := range answers {
+		resp = append(resp, rr...)
+	}
+	return resp
+}
@@ -0,0 +1,46 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// The types of threshold events.
+const (
+	ThresholdBreached  = "breached"
+	ThresholdRecovered = "recovered"
+	ThresholdAborted   = "aborted"
+)
+
+// ThresholdEvent is emitted when a threshold starts or stops failing during
+// the test run, and when its failure aborts the test run.
+type ThresholdEvent struct {
+	Type        string             `json:"type"`
+	Time        time.Time          `json:"time"`
+	Elapsed     types.Duration     `json:"elapsed"`
+	Metric      string             `json:"metric"`
+	Threshold   string             `json:"threshold"`
+	AbortOnFail bool               `json:"abortOnFail"`
+	Values      map[string]float64 `json:"values"`
+}
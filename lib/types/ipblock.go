@@ -167,6 +167,24 @@ func (pool *IPPool) GetIP(index uint64) net.IP {
 	return pool.GetIPBig(new(big.Int).SetUint64(index))
 }
 
+// String returns the IP ranges of the pool, in the format accepted by
+// NewIPPool.
+func (pool *IPPool) String() string {
+	ranges := make([]string, len(pool.list))
+	end := pool.count
+	// the list is reversed, see NewIPPool
+	for i, b := range pool.list {
+		last := new(big.Int).Sub(end, b.startIndex)
+		last.Sub(last, big.NewInt(1))
+		ranges[len(ranges)-1-i] = b.getIP(big.NewInt(0)).String()
+		if last.Sign() > 0 {
+			ranges[len(ranges)-1-i] += "-" + b.getIP(last).String()
+		}
+		end = b.startIndex
+	}
+	return strings.Join(ranges, ",")
+}
+
 // GetIPBig returns an IP from the pool with the provided index that is big.Int
 func (pool *IPPool) GetIPBig(index *big.Int) net.IP {
 	index = new(big.Int).Rem(index, pool.count)
@@ -198,3 +216,12 @@ func (n *NullIPPool) UnmarshalText(data []byte) error {
 	n.Valid = true
 	return nil
 }
+
+// MarshalText returns the text representation of the pool, the empty string
+// if it isn't valid.
+func (n NullIPPool) MarshalText() ([]byte, error) {
+	if !n.Valid {
+		return []byte{}, nil
+	}
+	return []byte(n.Pool.String()), nil
+}
@@ -21,6 +21,7 @@
 package types
 
 import (
+	"encoding/json"
 	"math/big"
 	"net"
 	"testing"
@@ -133,6 +134,30 @@ func TestIPPool(t *testing.T) {
 	}
 }
 
+func TestNullIPPoolJSON(t *testing.T) {
+	t.Parallel()
+	var pool NullIPPool
+	require.NoError(t, json.Unmarshal([]byte(`"10.0.0.1-10.0.0.5,10.0.1.0/24"`), &pool))
+	assert.True(t, pool.Valid)
+	assert.Equal(t, net.ParseIP("10.0.0.2").To16(), pool.Pool.GetIP(1).To16())
+
+	data, err := json.Marshal(pool)
+	require.NoError(t, err)
+	assert.Equal(t, `"10.0.0.1-10.0.0.5,10.0.1.1-10.0.1.254"`, string(data))
+
+	data, err = json.Marshal(NullIPPool{})
+	require.NoError(t, err)
+	assert.Equal(t, `""`, string(data))
+	require.NoError(t, json.Unmarshal(data, &pool))
+	assert.False(t, pool.Valid)
+
+	assert.Error(t, json.Unmarshal([]byte(`"10.0.0.5-10.0.0.1"`), &pool))
+
+	p, err := NewIPPool("192.168.0.101,fd00::2/112")
+	require.NoError(t, err)
+	assert.Equal(t, "192.168.0.101,fd00::-fd00::ffff", p.String())
+}
+
 func TestIpBlockError(t *testing.T) {
 	testdata := map[string]string{
 		"whatever":                       "not a valid IP",
@@ -0,0 +1,240 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// URLGroupingPlaceholder is what the heuristic URL grouping replaces
+// ID-like path segments and query values with.
+const URLGroupingPlaceholder = "{id}"
+
+//nolint:gochecknoglobals
+var (
+	urlGroupingUUID  = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	urlGroupingHex   = regexp.MustCompile(`^[0-9a-fA-F]{12,}$`)
+	urlGroupingToken = regexp.MustCompile(`^[0-9A-Za-z_\-]{20,}$`)
+	urlGroupingParam = regexp.MustCompile(`^\{[^/{}]*\}$`)
+)
+
+// NullURLGrouping is a nullable URLGrouping, in the same vein as the nullable
+// types provided by package gopkg.in/guregu/null.v3
+type NullURLGrouping struct {
+	Grouping *URLGrouping
+	Valid    bool
+}
+
+// URLGrouping derives the name tag of requests that don't have one set
+// explicitly, so that URLs like /users/123 and /users/456 end up in the same
+// group instead of creating a metric series each.
+//
+// The explicitly configured patterns, e.g. "/users/{userId}/orders/{orderId}",
+// are tried first; URLs that don't match any of them have their ID-like path
+// segments and query values replaced by URLGroupingPlaceholder.
+type URLGrouping struct {
+	Enabled  bool
+	patterns []urlGroupingPattern
+	source   []string
+}
+
+type urlGroupingPattern struct {
+	source   string
+	segments []string
+}
+
+// NewURLGrouping returns an enabled URLGrouping with the given patterns or an
+// error if any of them is invalid.
+func NewURLGrouping(patterns []string) (*URLGrouping, error) {
+	g := &URLGrouping{Enabled: true, source: patterns}
+	for _, p := range patterns {
+		if !strings.HasPrefix(p, "/") {
+			return nil, fmt.Errorf("invalid URL grouping pattern '%s', it should start with '/'", p)
+		}
+		g.patterns = append(g.patterns, urlGroupingPattern{
+			source:   p,
+			segments: strings.Split(strings.Trim(p, "/"), "/"),
+		})
+	}
+	return g, nil
+}
+
+// Group returns the grouped name for the given URL. Disabled or nil
+// groupings, as well as unparsable URLs, return it unchanged.
+func (g *URLGrouping) Group(rawURL string) string {
+	if g == nil || !g.Enabled {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	segments := strings.Split(strings.Trim(u.EscapedPath(), "/"), "/")
+	path := ""
+	for _, p := range g.patterns {
+		if p.matches(segments) {
+			path = p.source
+			break
+		}
+	}
+	if path == "" {
+		for i, s := range segments {
+			if isIDLike(s) {
+				segments[i] = URLGroupingPlaceholder
+			}
+		}
+		path = "/" + strings.Join(segments, "/")
+		if u.Path == "" {
+			path = ""
+		} else if strings.HasSuffix(u.Path, "/") && len(path) > 1 {
+			path += "/"
+		}
+	}
+
+	var b strings.Builder
+	if u.Scheme != "" {
+		b.WriteString(u.Scheme + "://")
+	}
+	b.WriteString(u.Host)
+	b.WriteString(path)
+	if u.RawQuery != "" {
+		b.WriteString("?" + groupQuery(u.RawQuery))
+	}
+	return b.String()
+}
+
+func (p urlGroupingPattern) matches(segments []string) bool {
+	if len(p.segments) != len(segments) {
+		return false
+	}
+	for i, s := range p.segments {
+		if s != segments[i] && !urlGroupingParam.MatchString(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// groupQuery keeps the order and the keys of the query parameters, but
+// replaces their ID-like values.
+func groupQuery(rawQuery string) string {
+	params := strings.Split(rawQuery, "&")
+	for i, param := range params {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) == 2 && isIDLike(kv[1]) {
+			params[i] = kv[0] + "=" + URLGroupingPlaceholder
+		}
+	}
+	return strings.Join(params, "&")
+}
+
+func isIDLike(s string) bool {
+	if s == "" {
+		return false
+	}
+	if isDigits(s) || urlGroupingUUID.MatchString(s) {
+		return true
+	}
+	if urlGroupingHex.MatchString(s) && strings.IndexAny(s, "0123456789") >= 0 {
+		return true
+	}
+	// long random-looking tokens, mixing letters and digits
+	return urlGroupingToken.MatchString(s) &&
+		strings.IndexAny(s, "0123456789") >= 0 &&
+		strings.IndexFunc(s, unicode.IsLetter) >= 0
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// UnmarshalText converts text data to a valid NullURLGrouping. It accepts
+// "true" and "false" to toggle the heuristic grouping, or a comma-separated
+// list of patterns, which also enables it.
+func (d *NullURLGrouping) UnmarshalText(data []byte) error {
+	s := strings.TrimSpace(string(data))
+	switch s {
+	case "":
+		*d = NullURLGrouping{}
+		return nil
+	case "false":
+		*d = NullURLGrouping{Grouping: &URLGrouping{}, Valid: true}
+		return nil
+	case "true":
+		*d = NullURLGrouping{Grouping: &URLGrouping{Enabled: true}, Valid: true}
+		return nil
+	}
+	g, err := NewURLGrouping(strings.Split(s, ","))
+	if err != nil {
+		return err
+	}
+	*d = NullURLGrouping{Grouping: g, Valid: true}
+	return nil
+}
+
+// UnmarshalJSON converts JSON data to a valid NullURLGrouping. It accepts a
+// boolean or an array of patterns.
+func (d *NullURLGrouping) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(data, []byte(`null`)) {
+		*d = NullURLGrouping{}
+		return nil
+	}
+
+	var enabled bool
+	if err := json.Unmarshal(data, &enabled); err == nil {
+		*d = NullURLGrouping{Grouping: &URLGrouping{Enabled: enabled}, Valid: true}
+		return nil
+	}
+
+	var patterns []string
+	if err := json.Unmarshal(data, &patterns); err != nil {
+		return fmt.Errorf("urlGrouping should be a boolean or an array of patterns: %w", err)
+	}
+	g, err := NewURLGrouping(patterns)
+	if err != nil {
+		return err
+	}
+	*d = NullURLGrouping{Grouping: g, Valid: true}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler interface
+func (d NullURLGrouping) MarshalJSON() ([]byte, error) {
+	if !d.Valid {
+		return []byte(`null`), nil
+	}
+	if len(d.Grouping.source) > 0 {
+		return json.Marshal(d.Grouping.source)
+	}
+	return json.Marshal(d.Grouping.Enabled)
+}
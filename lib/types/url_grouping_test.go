@@ -0,0 +1,101 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package types
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestURLGroupingHeuristic(t *testing.T) {
+	t.Parallel()
+	g := &URLGrouping{Enabled: true}
+	testCases := map[string]string{
+		"https://test.k6.io/users/123/orders/456":             "https://test.k6.io/users/{id}/orders/{id}",
+		"https://test.k6.io/users/123/":                       "https://test.k6.io/users/{id}/",
+		"https://test.k6.io/":                                 "https://test.k6.io/",
+		"https://test.k6.io":                                  "https://test.k6.io",
+		"https://test.k6.io/contacts.php":                     "https://test.k6.io/contacts.php",
+		"https://test.k6.io/api/v2/items":                     "https://test.k6.io/api/v2/items",
+		"http://k6.io/o/5f3a2b1c9d8e7f6a5b4c3d2e":             "http://k6.io/o/{id}",
+		"http://k6.io/o/deadbeefcafe":                         "http://k6.io/o/deadbeefcafe",
+		"http://k6.io/s/123e4567-e89b-12d3-a456-426614174000": "http://k6.io/s/{id}",
+		"http://k6.io/t/aZ3kP9qLm2Xv7Bn4Rt6Yw1":               "http://k6.io/t/{id}",
+		"http://k6.io/search?q=k6&page=2&session=abc":         "http://k6.io/search?q=k6&page={id}&session=abc",
+	}
+	for in, expected := range testCases {
+		assert.Equal(t, expected, g.Group(in), in)
+	}
+}
+
+func TestURLGroupingPatterns(t *testing.T) {
+	t.Parallel()
+	g, err := NewURLGrouping([]string{"/users/{userId}/orders/{orderId}", "/files/{name}"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "https://test.k6.io/users/{userId}/orders/{orderId}",
+		g.Group("https://test.k6.io/users/alice/orders/456"))
+	assert.Equal(t, "https://test.k6.io/files/{name}", g.Group("https://test.k6.io/files/report.pdf"))
+	// not matching any pattern falls back to the heuristic
+	assert.Equal(t, "https://test.k6.io/users/{id}", g.Group("https://test.k6.io/users/42"))
+
+	_, err = NewURLGrouping([]string{"users/{id}"})
+	assert.Error(t, err)
+}
+
+func TestURLGroupingDisabled(t *testing.T) {
+	t.Parallel()
+	u := "https://test.k6.io/users/123"
+	var g *URLGrouping
+	assert.Equal(t, u, g.Group(u))
+	assert.Equal(t, u, (&URLGrouping{}).Group(u))
+}
+
+func TestNullURLGroupingUnmarshal(t *testing.T) {
+	t.Parallel()
+	var d NullURLGrouping
+	require.NoError(t, json.Unmarshal([]byte(`true`), &d))
+	assert.True(t, d.Valid)
+	assert.True(t, d.Grouping.Enabled)
+
+	require.NoError(t, json.Unmarshal([]byte(`false`), &d))
+	assert.True(t, d.Valid)
+	assert.False(t, d.Grouping.Enabled)
+
+	require.NoError(t, json.Unmarshal([]byte(`["/users/{id}"]`), &d))
+	assert.True(t, d.Grouping.Enabled)
+	data, err := json.Marshal(d)
+	require.NoError(t, err)
+	assert.JSONEq(t, `["/users/{id}"]`, string(data))
+
+	require.NoError(t, json.Unmarshal([]byte(`null`), &d))
+	assert.False(t, d.Valid)
+	assert.Error(t, json.Unmarshal([]byte(`{"foo": 1}`), &d))
+	assert.Error(t, json.Unmarshal([]byte(`["users"]`), &d))
+
+	require.NoError(t, d.UnmarshalText([]byte("/users/{id},/files/{name}")))
+	assert.Equal(t, "http://k6.io/files/{name}", d.Grouping.Group("http://k6.io/files/a.txt"))
+	require.NoError(t, d.UnmarshalText([]byte("true")))
+	assert.True(t, d.Grouping.Enabled)
+}
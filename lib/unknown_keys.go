@@ -0,0 +1,246 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// The maximum edit distance between an unknown key and a known one, for the
+// known one to be suggested as what was probably meant.
+const maxKeySuggestionDistance = 2
+
+// UnknownKeysError is returned when a JSON object has keys that don't
+// correspond to any field of the struct it's decoded into, which is usually
+// the result of a typo.
+type UnknownKeysError struct {
+	Keys []string
+	// The known keys that were most likely meant, if there are any
+	Suggestions map[string]string
+}
+
+// Error returns a message listing all unknown keys with their suggestions.
+func (e UnknownKeysError) Error() string {
+	msgs := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		msgs[i] = fmt.Sprintf("unknown option '%s'", key)
+		if suggestion, ok := e.Suggestions[key]; ok {
+			msgs[i] += fmt.Sprintf(", did you mean '%s'?", suggestion)
+		}
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// KnownKeysTyper is implemented by the types with a custom UnmarshalJSON that
+// still decode JSON objects into struct fields, so FindUnknownKeys can check
+// their keys too. KnownKeysType returns the type that the given JSON is
+// actually decoded into, or nil if its keys shouldn't be checked.
+type KnownKeysTyper interface {
+	KnownKeysType(data []byte) reflect.Type
+}
+
+// FindUnknownKeys checks whether the given JSON object has any keys that don't
+// correspond to the JSON fields of the struct that v points to, including the
+// ones of nested structs, e.g. in slices and map values, and returns an
+// UnknownKeysError with suggestions for them if it does. The unknown keys are
+// reported with their full path, like "scenarios.foo.gracefullStop". Anything
+// else, like JSON that doesn't match the shape of v, is left for the actual
+// unmarshaling to deal with.
+func FindUnknownKeys(data []byte, v interface{}) error {
+	t := reflect.TypeOf(v)
+	if t == nil {
+		return nil
+	}
+
+	result := UnknownKeysError{Suggestions: make(map[string]string)}
+	findUnknownKeys(data, t, "", &result)
+	if len(result.Keys) == 0 {
+		return nil
+	}
+	sort.Strings(result.Keys)
+	return result
+}
+
+//nolint:gochecknoglobals
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	knownKeysTyperType  = reflect.TypeOf((*KnownKeysTyper)(nil)).Elem()
+)
+
+// findUnknownKeys adds the unknown keys in the given JSON, which is decoded
+// into a value of type t, to the result.
+func findUnknownKeys(data []byte, t reflect.Type, path string, result *UnknownKeysError) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(knownKeysTyperType) {
+		if t = reflect.New(t).Interface().(KnownKeysTyper).KnownKeysType(data); t == nil {
+			return
+		}
+		for t.Kind() == reflect.Ptr {
+			t = t.Elem()
+		}
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(data, &fields); err != nil {
+			return
+		}
+		known := jsonFields(t)
+		for key, value := range fields {
+			field, ok := findField(key, known)
+			if !ok {
+				result.Keys = append(result.Keys, path+key)
+				if suggestion := suggestKey(key, known); suggestion != "" {
+					result.Suggestions[path+key] = suggestion
+				}
+				continue
+			}
+			findUnknownKeys(value, field.typ, path+key+".", result)
+		}
+	case reflect.Map:
+		var values map[string]json.RawMessage
+		if err := json.Unmarshal(data, &values); err != nil {
+			return
+		}
+		for key, value := range values {
+			findUnknownKeys(value, t.Elem(), path+key+".", result)
+		}
+	case reflect.Slice, reflect.Array:
+		var values []json.RawMessage
+		if err := json.Unmarshal(data, &values); err != nil {
+			return
+		}
+		base := strings.TrimSuffix(path, ".")
+		for i, value := range values {
+			findUnknownKeys(value, t.Elem(), fmt.Sprintf("%s[%d].", base, i), result)
+		}
+	}
+}
+
+type jsonField struct {
+	name string
+	typ  reflect.Type
+}
+
+// jsonFields returns the fields that encoding/json would decode the keys of an
+// object into, for the given struct type, including the ones of embedded
+// structs.
+func jsonFields(t reflect.Type) []jsonField {
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				fields = append(fields, jsonFields(ft)...)
+				continue
+			}
+		}
+		if field.PkgPath != "" { // unexported
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields = append(fields, jsonField{name: name, typ: field.Type})
+	}
+	return fields
+}
+
+// findField mirrors encoding/json, which prefers an exact match of the key,
+// but otherwise matches it case-insensitively.
+func findField(key string, fields []jsonField) (jsonField, bool) {
+	for _, field := range fields {
+		if field.name == key {
+			return field, true
+		}
+	}
+	for _, field := range fields {
+		if strings.EqualFold(key, field.name) {
+			return field, true
+		}
+	}
+	return jsonField{}, false
+}
+
+// suggestKey returns the known key closest to the given one, if it's close
+// enough to have probably been a typo, or an empty string otherwise.
+func suggestKey(key string, known []jsonField) string {
+	suggestion, bestDistance := "", maxKeySuggestionDistance+1
+	for _, field := range known {
+		if d := editDistance(strings.ToLower(key), strings.ToLower(field.name)); d < bestDistance {
+			suggestion, bestDistance = field.name, d
+		}
+	}
+	return suggestion
+}
+
+// editDistance returns the Levenshtein distance between two strings.
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = minInt(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
+
+func minInt(values ...int) int {
+	result := values[0]
+	for _, v := range values[1:] {
+		if v < result {
+			result = v
+		}
+	}
+	return result
+}
@@ -0,0 +1,96 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package lib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindUnknownKeys(t *testing.T) {
+	t.Parallel()
+
+	type embedded struct {
+		GracefulStop string `json:"gracefulStop"`
+	}
+	type config struct {
+		embedded
+		VUs      int    `json:"vus"`
+		Duration string `json:"duration,omitempty"`
+		Ignored  string `json:"-"`
+		NoTag    string
+	}
+
+	t.Run("known keys", func(t *testing.T) {
+		t.Parallel()
+		data := []byte(`{"gracefulStop": "1s", "VUS": 1, "duration": "1m", "NoTag": ""}`)
+		assert.NoError(t, FindUnknownKeys(data, &config{}))
+	})
+	t.Run("unknown keys", func(t *testing.T) {
+		t.Parallel()
+		data := []byte(`{"gracefullStop": "1s", "vus": 1, "foo": 2, "Ignored": "", "durration": "1m"}`)
+		err := FindUnknownKeys(data, &config{})
+		require.Error(t, err)
+		assert.Equal(t, UnknownKeysError{
+			Keys:        []string{"Ignored", "durration", "foo", "gracefullStop"},
+			Suggestions: map[string]string{"durration": "duration", "gracefullStop": "gracefulStop"},
+		}, err)
+		assert.EqualError(t, err, "unknown option 'Ignored'; "+
+			"unknown option 'durration', did you mean 'duration'?; "+
+			"unknown option 'foo'; "+
+			"unknown option 'gracefullStop', did you mean 'gracefulStop'?")
+	})
+	t.Run("not a struct or an object", func(t *testing.T) {
+		t.Parallel()
+		assert.NoError(t, FindUnknownKeys([]byte(`{"foo": 1}`), &map[string]int{}))
+		assert.NoError(t, FindUnknownKeys([]byte(`[1, 2]`), &config{}))
+	})
+	t.Run("options", func(t *testing.T) {
+		t.Parallel()
+		err := FindUnknownKeys([]byte(`{"vus": 1, "iteration": 10, "thresholds": {}}`), &Options{})
+		assert.EqualError(t, err, "unknown option 'iteration', did you mean 'iterations'?")
+	})
+	t.Run("nested options", func(t *testing.T) {
+		t.Parallel()
+		data := []byte(`{
+			"stages": ["1s:10", {"duration": "1s", "targett": 10}],
+			"thresholds": {
+				"http_req_duration": ["p(95)<100", {"threshold": "p(99)<200", "abortOnFial": true}],
+				"checks": ["rate>0.9"]
+			},
+			"tlsAuth": [{"domains": ["example.com"], "cert": "", "kye": ""}],
+			"hosts": {"test.k6.io": "1.2.3.4"},
+			"ext": {"loadimpact": {"foo": 1}}
+		}`)
+		err := FindUnknownKeys(data, &Options{})
+		require.Error(t, err)
+		assert.Equal(t, UnknownKeysError{
+			Keys: []string{"stages[1].targett", "thresholds.http_req_duration[1].abortOnFial", "tlsAuth[0].kye"},
+			Suggestions: map[string]string{
+				"stages[1].targett":                           "target",
+				"thresholds.http_req_duration[1].abortOnFial": "abortOnFail",
+				"tlsAuth[0].kye":                              "key",
+			},
+		}, err)
+	})
+}
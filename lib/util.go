@@ -66,3 +66,22 @@ func Min(a, b int64) int64 {
 	}
 	return b
 }
+
+// DeriveSeed returns a seed derived from the given one and the ids, e.g. of a
+// VU and its iteration, so that every combination of them gets its own
+// reproducible sequence of random numbers.
+func DeriveSeed(seed int64, ids ...int64) int64 {
+	h := splitMix64(uint64(seed))
+	for _, id := range ids {
+		h = splitMix64(h ^ splitMix64(uint64(id)))
+	}
+	return int64(h)
+}
+
+// splitMix64 is the finalizer of the SplitMix64 generator, mixing all bits of x.
+func splitMix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
@@ -166,3 +166,14 @@ func TestMax(t *testing.T) {
 	assert.Equal(t, int64(100), Max(10, 100))
 	assert.Equal(t, int64(100), Max(100, 10))
 }
+
+func TestDeriveSeed(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, DeriveSeed(42, 1, 7), DeriveSeed(42, 1, 7))
+	seeds := map[int64]bool{}
+	for _, ids := range [][]int64{{}, {0}, {1}, {1, 0}, {0, 1}, {1, 7}, {7, 1}} {
+		seeds[DeriveSeed(42, ids...)] = true
+	}
+	seeds[DeriveSeed(43, 1, 7)] = true
+	assert.Len(t, seeds, 8)
+}
@@ -0,0 +1,302 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package azuredevops implements an output that publishes the thresholds and
+// checks of the test as the results of an Azure DevOps test run, with the
+// end-of-test summary attached, so they are shown in the native test UI of
+// Azure Pipelines.
+package azuredevops
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+	"github.com/loadimpact/k6/ui"
+)
+
+const flushPeriod = 1 * time.Second
+
+// Config is the configuration of the output. Inside of Azure Pipelines, it's
+// taken from the predefined variables, but it can also be set explicitly.
+type Config struct {
+	CollectionURL string // K6_AZURE_DEVOPS_URL or SYSTEM_COLLECTIONURI
+	Project       string // K6_AZURE_DEVOPS_PROJECT or SYSTEM_TEAMPROJECT
+	Token         string // K6_AZURE_DEVOPS_TOKEN or SYSTEM_ACCESSTOKEN
+	BuildID       string // BUILD_BUILDID
+	RunName       string // the output argument, e.g. --out azuredevops=name
+}
+
+func getConfig(params output.Params) (Config, error) {
+	env := func(names ...string) string {
+		for _, name := range names {
+			if v := params.Environment[name]; v != "" {
+				return v
+			}
+		}
+		return ""
+	}
+	conf := Config{
+		CollectionURL: env("K6_AZURE_DEVOPS_URL", "SYSTEM_COLLECTIONURI"),
+		Project:       env("K6_AZURE_DEVOPS_PROJECT", "SYSTEM_TEAMPROJECT"),
+		Token:         env("K6_AZURE_DEVOPS_TOKEN", "SYSTEM_ACCESSTOKEN"),
+		BuildID:       env("BUILD_BUILDID"),
+		RunName:       params.ConfigArgument,
+	}
+	switch {
+	case conf.CollectionURL == "":
+		return conf, errors.New("the Azure DevOps collection URL isn't set, set K6_AZURE_DEVOPS_URL or SYSTEM_COLLECTIONURI")
+	case conf.Project == "":
+		return conf, errors.New("the Azure DevOps project isn't set, set K6_AZURE_DEVOPS_PROJECT or SYSTEM_TEAMPROJECT")
+	case conf.Token == "":
+		return conf, errors.New("the Azure DevOps access token isn't set, set K6_AZURE_DEVOPS_TOKEN or " +
+			"map the System.AccessToken variable to SYSTEM_ACCESSTOKEN")
+	}
+	if conf.RunName == "" {
+		conf.RunName = "k6"
+		if params.ScriptPath != nil {
+			conf.RunName += ": " + params.ScriptPath.String()
+		}
+	}
+	return conf, nil
+}
+
+type check struct {
+	passes, fails int64
+}
+
+// Output creates an Azure DevOps test run when the test starts, and adds the
+// thresholds and checks to it as test results when the test ends.
+type Output struct {
+	output.SampleBuffer
+
+	params     output.Params
+	config     Config
+	logger     logrus.FieldLogger
+	client     *client
+	runID      int64
+	flusher    *output.PeriodicFlusher
+	startTime  time.Time
+	thresholds map[string]stats.Thresholds
+
+	mu      sync.Mutex
+	metrics map[string]*stats.Metric
+	checks  map[string]*check
+}
+
+// New returns a new Azure DevOps output.
+func New(params output.Params) (output.Output, error) {
+	conf, err := getConfig(params)
+	if err != nil {
+		return nil, err
+	}
+	return &Output{
+		params:  params,
+		config:  conf,
+		logger:  params.Logger.WithField("output", "azuredevops"),
+		client:  newClient(conf.CollectionURL, conf.Project, conf.Token),
+		metrics: make(map[string]*stats.Metric),
+		checks:  make(map[string]*check),
+	}, nil
+}
+
+// Description returns a human-readable description of the output.
+func (o *Output) Description() string {
+	return fmt.Sprintf("azuredevops (%s)", o.config.RunName)
+}
+
+// SetThresholds receives the thresholds before the output is Start()-ed. They
+// are the same ones the Engine evaluates, so their state at the end of the
+// test is the final one.
+func (o *Output) SetThresholds(thresholds map[string]stats.Thresholds) {
+	o.thresholds = thresholds
+}
+
+// Start creates the test run and starts the goroutine that aggregates the
+// buffered samples.
+func (o *Output) Start() error {
+	o.logger.Debug("Starting...")
+	run := testRun{Name: o.config.RunName, Automated: true, State: "InProgress"}
+	if o.config.BuildID != "" {
+		run.Build = &buildRef{ID: o.config.BuildID}
+	}
+	runID, err := o.client.createRun(run)
+	if err != nil {
+		return fmt.Errorf("couldn't create the Azure DevOps test run: %w", err)
+	}
+	o.runID = runID
+	o.logger = o.logger.WithField("runID", runID)
+	o.startTime = time.Now()
+
+	pf, err := output.NewPeriodicFlusher(flushPeriod, o.flushMetrics)
+	if err != nil {
+		return err
+	}
+	o.flusher = pf
+	o.logger.Debug("Started!")
+	return nil
+}
+
+// Stop publishes the thresholds and checks as the results of the test run,
+// attaches the summary to it and completes it.
+func (o *Output) Stop() error {
+	o.logger.Debug("Stopping...")
+	defer o.logger.Debug("Stopped!")
+	o.flusher.Stop()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	duration := time.Since(o.startTime)
+	if results := o.results(duration); len(results) > 0 {
+		if err := o.client.addResults(o.runID, results); err != nil {
+			return fmt.Errorf("couldn't publish the results to the Azure DevOps test run: %w", err)
+		}
+	}
+	err := o.client.addAttachment(o.runID, attachment{
+		Stream:         o.summary(duration),
+		FileName:       "k6-summary.md",
+		Comment:        "k6 end-of-test summary",
+		AttachmentType: "GeneralAttachment",
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't attach the summary to the Azure DevOps test run: %w", err)
+	}
+	if err := o.client.completeRun(o.runID); err != nil {
+		return fmt.Errorf("couldn't complete the Azure DevOps test run: %w", err)
+	}
+	return nil
+}
+
+// checkName returns the name of a check, prefixed with the path of its group.
+func checkName(tags *stats.SampleTags) string {
+	name, _ := tags.Get("check")
+	group, _ := tags.Get("group")
+	if group = strings.TrimPrefix(group, lib.GroupSeparator); group != "" {
+		return strings.ReplaceAll(group, lib.GroupSeparator, " › ") + " › " + name
+	}
+	return name
+}
+
+func (o *Output) flushMetrics() {
+	samples := o.GetBufferedSamples()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, sc := range samples {
+		for _, sample := range sc.GetSamples() {
+			m, ok := o.metrics[sample.Metric.Name]
+			if !ok {
+				m = stats.New(sample.Metric.Name, sample.Metric.Type, sample.Metric.Contains)
+				o.metrics[m.Name] = m
+			}
+			m.Sink.Add(sample)
+
+			if sample.Metric.Name != metrics.Checks.Name {
+				continue
+			}
+			name := checkName(sample.Tags)
+			c, ok := o.checks[name]
+			if !ok {
+				c = &check{}
+				o.checks[name] = c
+			}
+			if sample.Value == 0 {
+				c.fails++
+			} else {
+				c.passes++
+			}
+		}
+	}
+	o.ReleaseBufferedSamples(samples)
+}
+
+// results returns a test result for every threshold and check, which have the
+// duration of the whole test, since they apply to all of it.
+func (o *Output) results(duration time.Duration) []testResult {
+	durationInMs := float64(duration.Milliseconds())
+	newResult := func(title, storage string, failed bool, msg string) testResult {
+		r := testResult{
+			TestCaseTitle:        title,
+			AutomatedTestName:    storage + "." + title,
+			AutomatedTestStorage: storage,
+			AutomatedTestType:    "k6",
+			Outcome:              "Passed",
+			State:                "Completed",
+			DurationInMs:         durationInMs,
+		}
+		if failed {
+			r.Outcome, r.ErrorMessage = "Failed", msg
+		}
+		return r
+	}
+
+	var results []testResult
+	if !o.params.RuntimeOptions.NoThresholds.Bool {
+		names := make([]string, 0, len(o.thresholds))
+		for name := range o.thresholds {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			for _, th := range o.thresholds[name].Thresholds {
+				results = append(results, newResult(name+": "+th.Source, "thresholds", th.LastFailed,
+					fmt.Sprintf("The threshold %s on %s was crossed", th.Source, name)))
+			}
+		}
+	}
+	checkNames := make([]string, 0, len(o.checks))
+	for name := range o.checks {
+		checkNames = append(checkNames, name)
+	}
+	sort.Strings(checkNames)
+	for _, name := range checkNames {
+		c := o.checks[name]
+		results = append(results, newResult(name, "checks", c.fails > 0,
+			fmt.Sprintf("%d of %d checks failed", c.fails, c.passes+c.fails)))
+	}
+	return results
+}
+
+// summary returns the Markdown summary of the metrics and thresholds.
+func (o *Output) summary(duration time.Duration) []byte {
+	summaryMetrics := make(map[string]*stats.Metric, len(o.metrics))
+	for name, m := range o.metrics {
+		if !o.params.RuntimeOptions.NoThresholds.Bool {
+			m.Thresholds = o.thresholds[name]
+		}
+		summaryMetrics[name] = m
+	}
+	var b bytes.Buffer
+	ui.NewSummary(o.params.ScriptOptions.SummaryTrendStats).SummarizeMetricsMarkdown(&b, ui.SummaryData{
+		Metrics:  summaryMetrics,
+		Time:     duration,
+		TimeUnit: o.params.ScriptOptions.SummaryTimeUnit.String,
+	})
+	return b.Bytes()
+}
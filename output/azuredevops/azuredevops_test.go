@@ -0,0 +1,171 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package azuredevops
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+func TestGetConfig(t *testing.T) {
+	t.Parallel()
+	_, err := getConfig(output.Params{Environment: map[string]string{}})
+	assert.EqualError(t, err, "the Azure DevOps collection URL isn't set, set K6_AZURE_DEVOPS_URL or SYSTEM_COLLECTIONURI")
+
+	conf, err := getConfig(output.Params{Environment: map[string]string{
+		"SYSTEM_COLLECTIONURI":    "https://dev.azure.com/org/",
+		"SYSTEM_TEAMPROJECT":      "shop",
+		"K6_AZURE_DEVOPS_PROJECT": "other",
+		"SYSTEM_ACCESSTOKEN":      "secret",
+		"BUILD_BUILDID":           "42",
+	}})
+	require.NoError(t, err)
+	assert.Equal(t, Config{
+		CollectionURL: "https://dev.azure.com/org/",
+		Project:       "other",
+		Token:         "secret",
+		BuildID:       "42",
+		RunName:       "k6",
+	}, conf)
+}
+
+type request struct {
+	method, path string
+	body         map[string]interface{}
+	list         []map[string]interface{}
+}
+
+func TestOutput(t *testing.T) {
+	t.Parallel()
+	var (
+		mu       sync.Mutex
+		requests []request
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, ok := r.BasicAuth()
+		assert.True(t, ok && user == "" && pass == "secret")
+		assert.Equal(t, apiVersion, r.URL.Query().Get("api-version"))
+		data, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := request{method: r.Method, path: r.URL.Path}
+		if data[0] == '[' {
+			require.NoError(t, json.Unmarshal(data, &req.list))
+		} else {
+			require.NoError(t, json.Unmarshal(data, &req.body))
+		}
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"id": 7}`))
+	}))
+	defer srv.Close()
+
+	out, err := New(output.Params{
+		Logger:         testutils.NewLogger(t),
+		ConfigArgument: "smoke test",
+		Environment: map[string]string{
+			"K6_AZURE_DEVOPS_URL":     srv.URL,
+			"K6_AZURE_DEVOPS_PROJECT": "shop",
+			"K6_AZURE_DEVOPS_TOKEN":   "secret",
+			"BUILD_BUILDID":           "42",
+		},
+		ScriptOptions: lib.Options{SummaryTrendStats: lib.DefaultSummaryTrendStats},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "azuredevops (smoke test)", out.Description())
+
+	thresholds, err := stats.NewThresholds([]string{"count<10", "rate<1"})
+	require.NoError(t, err)
+	thresholds.Thresholds[1].LastFailed = true
+	o := out.(*Output)
+	o.SetThresholds(map[string]stats.Thresholds{metrics.HTTPReqs.Name: thresholds})
+	require.NoError(t, o.Start())
+
+	now := time.Now()
+	o.AddMetricSamples([]stats.SampleContainer{
+		stats.Sample{Time: now, Metric: metrics.HTTPReqs, Value: 1, Tags: stats.NewSampleTags(nil)},
+		stats.Sample{
+			Time: now, Metric: metrics.Checks, Value: 0,
+			Tags: stats.NewSampleTags(map[string]string{"group": "::login", "check": "has token"}),
+		},
+	})
+	require.NoError(t, o.Stop())
+
+	require.Len(t, requests, 4)
+	assert.Equal(t, request{method: "POST", path: "/shop/_apis/test/runs", body: map[string]interface{}{
+		"name": "smoke test", "automated": true, "state": "InProgress", "build": map[string]interface{}{"id": "42"},
+	}}, requests[0])
+
+	assert.Equal(t, "/shop/_apis/test/runs/7/results", requests[1].path)
+	require.Len(t, requests[1].list, 3)
+	outcomes := map[string]interface{}{}
+	for _, r := range requests[1].list {
+		outcomes[r["automatedTestName"].(string)] = r["outcome"]
+	}
+	assert.Equal(t, map[string]interface{}{
+		"thresholds.http_reqs: count<10": "Passed",
+		"thresholds.http_reqs: rate<1":   "Failed",
+		"checks.login › has token":       "Failed",
+	}, outcomes)
+	assert.Equal(t, "1 of 1 checks failed", requests[1].list[2]["errorMessage"])
+
+	assert.Equal(t, "/shop/_apis/test/runs/7/attachments", requests[2].path)
+	assert.Equal(t, "k6-summary.md", requests[2].body["fileName"])
+	assert.NotEmpty(t, requests[2].body["stream"])
+
+	assert.Equal(t, request{
+		method: "PATCH", path: "/shop/_apis/test/runs/7", body: map[string]interface{}{"state": "Completed"},
+	}, requests[3])
+}
+
+func TestOutputStartError(t *testing.T) {
+	t.Parallel()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusUnauthorized)
+	}))
+	defer srv.Close()
+
+	out, err := New(output.Params{
+		Logger: testutils.NewLogger(t),
+		Environment: map[string]string{
+			"K6_AZURE_DEVOPS_URL": srv.URL, "K6_AZURE_DEVOPS_PROJECT": "shop", "K6_AZURE_DEVOPS_TOKEN": "bad",
+		},
+	})
+	require.NoError(t, err)
+	err = out.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "couldn't create the Azure DevOps test run: POST ")
+	assert.Contains(t, err.Error(), "failed with status 401: nope")
+}
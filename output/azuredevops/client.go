@@ -0,0 +1,129 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package azuredevops
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const apiVersion = "6.0"
+
+// client is a minimal client of the test runs REST API of Azure DevOps.
+type client struct {
+	baseURL string
+	token   string
+	client  *http.Client
+}
+
+// testRun is a test run, as it's created and updated.
+type testRun struct {
+	ID        int64     `json:"id,omitempty"`
+	Name      string    `json:"name,omitempty"`
+	Automated bool      `json:"automated,omitempty"`
+	State     string    `json:"state"`
+	Build     *buildRef `json:"build,omitempty"`
+}
+
+type buildRef struct {
+	ID string `json:"id"`
+}
+
+// testResult is the result of a single test of a test run.
+type testResult struct {
+	TestCaseTitle        string  `json:"testCaseTitle"`
+	AutomatedTestName    string  `json:"automatedTestName"`
+	AutomatedTestStorage string  `json:"automatedTestStorage"`
+	AutomatedTestType    string  `json:"automatedTestType"`
+	Outcome              string  `json:"outcome"`
+	State                string  `json:"state"`
+	ErrorMessage         string  `json:"errorMessage,omitempty"`
+	DurationInMs         float64 `json:"durationInMs"`
+}
+
+type attachment struct {
+	Stream         []byte `json:"stream"` // encoded as base64 by encoding/json
+	FileName       string `json:"fileName"`
+	Comment        string `json:"comment"`
+	AttachmentType string `json:"attachmentType"`
+}
+
+func newClient(collectionURL, project, token string) *client {
+	return &client{
+		baseURL: strings.TrimSuffix(collectionURL, "/") + "/" + project + "/_apis/test/runs",
+		token:   token,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (c *client) do(method, path string, body, result interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	url := c.baseURL + path + "?api-version=" + apiVersion
+	req, err := http.NewRequest(method, url, bytes.NewReader(data)) //nolint:noctx
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.SetBasicAuth("", c.token)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s %s failed with status %d: %s", method, url, resp.StatusCode, bytes.TrimSpace(msg))
+	}
+	if result == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(result)
+}
+
+func (c *client) createRun(run testRun) (int64, error) {
+	var created testRun
+	if err := c.do(http.MethodPost, "", run, &created); err != nil {
+		return 0, err
+	}
+	return created.ID, nil
+}
+
+func (c *client) addResults(runID int64, results []testResult) error {
+	return c.do(http.MethodPost, fmt.Sprintf("/%d/results", runID), results, nil)
+}
+
+func (c *client) addAttachment(runID int64, a attachment) error {
+	return c.do(http.MethodPost, fmt.Sprintf("/%d/attachments", runID), a, nil)
+}
+
+func (c *client) completeRun(runID int64) error {
+	return c.do(http.MethodPatch, fmt.Sprintf("/%d", runID), testRun{State: "Completed"}, nil)
+}
@@ -0,0 +1,288 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package clickhouse implements an output that writes the metric samples to
+// ClickHouse tables with batched inserts over its HTTP interface.
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+const timestampFormat = "2006-01-02 15:04:05.000000"
+
+// The percentiles that are written for the aggregated trends, by column name
+var trendPercentiles = []struct { //nolint:gochecknoglobals
+	column string
+	pct    float64
+}{{"med", 0.5}, {"p90", 0.9}, {"p95", 0.95}, {"p99", 0.99}}
+
+// Output writes the samples to a ClickHouse table, with a row for every
+// sample, except for the trend samples, if they are aggregated.
+type Output struct {
+	*output.Batcher
+
+	config Config
+	logger logrus.FieldLogger
+	client *client
+}
+
+// New returns a new ClickHouse output.
+func New(params output.Params) (output.Output, error) {
+	conf, err := GetConsolidatedConfig(params.JSONConfig, params.Environment, params.ConfigArgument)
+	if err != nil {
+		return nil, err
+	}
+	return newOutput(params, conf)
+}
+
+func newOutput(params output.Params, conf Config) (*Output, error) {
+	c, err := newClient(conf.URL.String)
+	if err != nil {
+		return nil, err
+	}
+	batcher, err := output.NewBatcher(output.BatchConfig{
+		MaxSamples: int(conf.BatchSize.Int64),
+		MaxLatency: time.Duration(conf.PushInterval.Duration),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Output{
+		Batcher: batcher,
+		config:  conf,
+		logger:  params.Logger.WithFields(logrus.Fields{"output": "clickhouse", "table": conf.Table.String}),
+		client:  c,
+	}, nil
+}
+
+// Description returns a human-readable description of the output.
+func (o *Output) Description() string {
+	return fmt.Sprintf("clickhouse (%s.%s)", o.client.database, o.config.Table.String)
+}
+
+// Start creates the tables, if that's enabled, and starts the goroutine that
+// inserts the batches of samples.
+func (o *Output) Start() error {
+	o.logger.Debug("Starting...")
+	if o.config.CreateTable.Bool {
+		if err := o.createTables(); err != nil {
+			return err
+		}
+	}
+	o.Batcher.Start(o.flushMetrics)
+	o.logger.Debug("Started!")
+	return nil
+}
+
+// Stop inserts the remaining samples.
+func (o *Output) Stop() error {
+	o.logger.Debug("Stopping...")
+	defer o.logger.Debug("Stopped!")
+	o.Batcher.Stop()
+	return nil
+}
+
+func (o *Output) trendsTable() string {
+	return o.config.Table.String + "_trends"
+}
+
+func (o *Output) createTables() error {
+	var tagColumns strings.Builder
+	for _, column := range o.config.TagColumns {
+		fmt.Fprintf(&tagColumns, "`%s` LowCardinality(String), ", column)
+	}
+
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"timestamp DateTime64(6, 'UTC'), metric LowCardinality(String), metric_type LowCardinality(String), "+
+		"value Float64, %stags Map(String, String)"+
+		") ENGINE = MergeTree ORDER BY (metric, timestamp)", o.config.Table.String, tagColumns.String())
+	if err := o.client.exec(context.Background(), query, nil); err != nil {
+		return fmt.Errorf("couldn't create the ClickHouse table: %w", err)
+	}
+	if !o.config.AggregateTrends.Bool {
+		return nil
+	}
+
+	var valueColumns strings.Builder
+	for _, p := range trendPercentiles {
+		fmt.Fprintf(&valueColumns, "%s Float64, ", p.column)
+	}
+	query = fmt.Sprintf("CREATE TABLE IF NOT EXISTS `%s` ("+
+		"timestamp DateTime64(6, 'UTC'), metric LowCardinality(String), "+
+		"count UInt64, sum Float64, min Float64, max Float64, avg Float64, %s%stags Map(String, String)"+
+		") ENGINE = MergeTree ORDER BY (metric, timestamp)", o.trendsTable(), valueColumns.String(), tagColumns.String())
+	if err := o.client.exec(context.Background(), query, nil); err != nil {
+		return fmt.Errorf("couldn't create the ClickHouse trends table: %w", err)
+	}
+	return nil
+}
+
+// trendBucket holds the aggregated samples of a trend metric with the same
+// tags in a batch.
+type trendBucket struct {
+	metric *stats.Metric
+	tags   map[string]string
+	sink   *stats.TrendSink
+	last   time.Time
+}
+
+func (o *Output) flushMetrics() {
+	samples := o.GetBufferedSamples()
+	if len(samples) == 0 {
+		return
+	}
+	start := time.Now()
+
+	var rows bytes.Buffer
+	encoder := json.NewEncoder(&rows)
+	count := 0
+	trends := make(map[string]*trendBucket)
+	for _, sc := range samples {
+		for _, sample := range sc.GetSamples() {
+			var tags map[string]string
+			if sample.Tags != nil {
+				tags = sample.Tags.CloneTags()
+			}
+			if o.config.AggregateTrends.Bool && sample.Metric.Type == stats.Trend {
+				addToTrendBucket(trends, sample, tags)
+				continue
+			}
+
+			row := o.newRow(sample.Time, sample.Metric.Name, tags)
+			row["metric_type"] = sample.Metric.Type.String()
+			row["value"] = sample.Value
+			if err := encoder.Encode(row); err != nil {
+				o.logger.WithError(err).Error("Couldn't encode a sample")
+				continue
+			}
+			count++
+		}
+	}
+
+	if count > 0 {
+		o.insert(o.config.Table.String, &rows, count)
+	}
+	if len(trends) > 0 {
+		rows.Reset()
+		for _, bucket := range sortedTrendBuckets(trends) {
+			if err := encoder.Encode(o.newTrendRow(bucket)); err != nil {
+				o.logger.WithError(err).Error("Couldn't encode an aggregated trend")
+			}
+		}
+		o.insert(o.trendsTable(), &rows, len(trends))
+	}
+	o.logger.WithField("t", time.Since(start)).Debug("Inserted the samples")
+}
+
+func (o *Output) insert(table string, rows *bytes.Buffer, count int) {
+	query := fmt.Sprintf("INSERT INTO `%s` FORMAT JSONEachRow", table)
+	if err := o.client.exec(context.Background(), query, rows); err != nil {
+		o.logger.WithError(err).WithField("rows", count).Warn("Couldn't insert the samples into ClickHouse")
+	}
+}
+
+// newRow returns a row with the given timestamp, metric name and tags, where
+// the tags with their own columns are taken out of the tags map.
+func (o *Output) newRow(t time.Time, metric string, tags map[string]string) map[string]interface{} {
+	row := map[string]interface{}{
+		"timestamp": t.UTC().Format(timestampFormat),
+		"metric":    metric,
+	}
+	rest := make(map[string]string, len(tags))
+	for k, v := range tags {
+		rest[k] = v
+	}
+	for _, column := range o.config.TagColumns {
+		row[column] = rest[column]
+		delete(rest, column)
+	}
+	row["tags"] = rest
+	return row
+}
+
+func (o *Output) newTrendRow(bucket *trendBucket) map[string]interface{} {
+	sink := bucket.sink
+	sink.Calc()
+	row := o.newRow(bucket.last, bucket.metric.Name, bucket.tags)
+	row["count"] = sink.Count
+	row["sum"] = sink.Sum
+	row["min"] = sink.Min
+	row["max"] = sink.Max
+	row["avg"] = sink.Avg
+	for _, p := range trendPercentiles {
+		row[p.column] = sink.P(p.pct)
+	}
+	return row
+}
+
+func addToTrendBucket(buckets map[string]*trendBucket, sample stats.Sample, tags map[string]string) {
+	key := bucketKey(sample.Metric.Name, tags)
+	bucket, ok := buckets[key]
+	if !ok {
+		bucket = &trendBucket{metric: sample.Metric, tags: tags, sink: &stats.TrendSink{}}
+		buckets[key] = bucket
+	}
+	bucket.sink.Add(sample)
+	if sample.Time.After(bucket.last) {
+		bucket.last = sample.Time
+	}
+}
+
+func sortedTrendBuckets(buckets map[string]*trendBucket) []*trendBucket {
+	keys := make([]string, 0, len(buckets))
+	for key := range buckets {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]*trendBucket, len(keys))
+	for i, key := range keys {
+		result[i] = buckets[key]
+	}
+	return result
+}
+
+func bucketKey(name string, tags map[string]string) string {
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+	}
+	return b.String()
+}
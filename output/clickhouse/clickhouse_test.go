@@ -0,0 +1,150 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package clickhouse
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+type query struct {
+	sql  string
+	rows []map[string]interface{}
+}
+
+func newTestServer(t *testing.T) (*httptest.Server, func() []query) {
+	var mu sync.Mutex
+	var queries []query
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "k6", r.URL.Query().Get("database"))
+		assert.Equal(t, "1", r.URL.Query().Get("async_insert"))
+		assert.Equal(t, "user", r.Header.Get("X-ClickHouse-User"))
+		assert.Equal(t, "pass", r.Header.Get("X-ClickHouse-Key"))
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		q := query{sql: r.URL.Query().Get("query")}
+		scanner := bufio.NewScanner(bytes.NewReader(body))
+		for scanner.Scan() {
+			row := map[string]interface{}{}
+			assert.NoError(t, json.Unmarshal(scanner.Bytes(), &row))
+			q.rows = append(q.rows, row)
+		}
+		mu.Lock()
+		queries = append(queries, q)
+		mu.Unlock()
+	}))
+	return srv, func() []query {
+		mu.Lock()
+		defer mu.Unlock()
+		return queries
+	}
+}
+
+func TestOutput(t *testing.T) {
+	t.Parallel()
+	srv, getQueries := newTestServer(t)
+	defer srv.Close()
+
+	out, err := New(output.Params{
+		Logger: testutils.NewLogger(t),
+		ConfigArgument: strings.Replace(srv.URL, "http://", "clickhouse://user:pass@", 1) +
+			"/k6?table=results&tagColumns=scenario&aggregateTrends=true&async_insert=1",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "clickhouse (k6.results)", out.Description())
+	require.NoError(t, out.Start())
+
+	now := time.Date(2021, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	reqs := stats.New("http_reqs", stats.Counter)
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	tags := stats.NewSampleTags(map[string]string{"scenario": "default", "status": "200"})
+	samples := []stats.SampleContainer{stats.Sample{Time: now, Metric: reqs, Tags: tags, Value: 1}}
+	for i := 1; i <= 100; i++ {
+		samples = append(samples, stats.Sample{Time: now, Metric: duration, Tags: tags, Value: float64(i)})
+	}
+	out.AddMetricSamples(samples)
+	require.NoError(t, out.Stop())
+
+	queries := getQueries()
+	require.Len(t, queries, 4)
+	assert.Contains(t, queries[0].sql, "CREATE TABLE IF NOT EXISTS `results` (")
+	assert.Contains(t, queries[0].sql, "`scenario` LowCardinality(String), tags Map(String, String)")
+	assert.Contains(t, queries[1].sql, "CREATE TABLE IF NOT EXISTS `results_trends` (")
+
+	assert.Equal(t, "INSERT INTO `results` FORMAT JSONEachRow", queries[2].sql)
+	assert.Equal(t, []map[string]interface{}{{
+		"timestamp":   "2021-01-02 03:04:05.123456",
+		"metric":      "http_reqs",
+		"metric_type": "counter",
+		"value":       1.0,
+		"scenario":    "default",
+		"tags":        map[string]interface{}{"status": "200"},
+	}}, queries[2].rows)
+
+	assert.Equal(t, "INSERT INTO `results_trends` FORMAT JSONEachRow", queries[3].sql)
+	require.Len(t, queries[3].rows, 1)
+	trend := queries[3].rows[0]
+	assert.Equal(t, "http_req_duration", trend["metric"])
+	assert.Equal(t, 100.0, trend["count"])
+	assert.Equal(t, 5050.0, trend["sum"])
+	assert.Equal(t, 1.0, trend["min"])
+	assert.Equal(t, 100.0, trend["max"])
+	assert.Equal(t, "default", trend["scenario"])
+	assert.InDelta(t, 95.05, trend["p95"], 0.01)
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	conf, err := GetConsolidatedConfig(
+		json.RawMessage(`{"table": "from_json", "batchSize": 5}`), nil,
+		"clickhouse://localhost:8123/db?table=from_arg&pushInterval=5s&createTable=false",
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "from_arg", conf.Table.String)
+	assert.Equal(t, int64(5), conf.BatchSize.Int64)
+	assert.Equal(t, 5*time.Second, time.Duration(conf.PushInterval.Duration))
+	assert.False(t, conf.CreateTable.Bool)
+	assert.Equal(t, "clickhouse://localhost:8123/db", conf.URL.String)
+
+	_, err = GetConsolidatedConfig(nil, nil, "clickhouse://localhost/?table=a-b")
+	assert.EqualError(t, err, "invalid ClickHouse table name 'a-b'")
+	_, err = GetConsolidatedConfig(nil, nil, "clickhouse://localhost/?tagColumns=metric")
+	assert.EqualError(t, err, "the ClickHouse tag column name 'metric' is used by a built-in column")
+	_, err = New(output.Params{Logger: testutils.NewLogger(t), ConfigArgument: "tcp://localhost:9000"})
+	assert.EqualError(t, err, "invalid ClickHouse URL scheme 'tcp', it should be clickhouse or clickhouses")
+}
@@ -0,0 +1,109 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package clickhouse
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const requestTimeout = 30 * time.Second
+
+// client runs queries with the ClickHouse HTTP interface.
+type client struct {
+	client   *http.Client
+	baseURL  string
+	database string
+	user     string
+	password string
+	// Any other query parameters of the URL are passed as ClickHouse settings
+	settings url.Values
+}
+
+func newClient(rawURL string) (*client, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ClickHouse URL: %w", err)
+	}
+	switch u.Scheme {
+	case "clickhouse", "http":
+		u.Scheme = "http"
+	case "clickhouses", "https":
+		u.Scheme = "https"
+	default:
+		return nil, fmt.Errorf("invalid ClickHouse URL scheme '%s', it should be clickhouse or clickhouses", u.Scheme)
+	}
+
+	c := &client{
+		client:   &http.Client{Timeout: requestTimeout},
+		database: strings.Trim(u.Path, "/"),
+		settings: u.Query(),
+	}
+	if c.database == "" {
+		c.database = "default"
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	u.User, u.Path, u.RawQuery = nil, "/", ""
+	c.baseURL = u.String()
+	return c, nil
+}
+
+// exec runs the given query, with the given body as its data, if it's not nil.
+func (c *client) exec(ctx context.Context, query string, body io.Reader) error {
+	params := url.Values{}
+	for k, v := range c.settings {
+		params[k] = v
+	}
+	params.Set("database", c.database)
+	params.Set("query", query)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.baseURL+"?"+params.Encode(), body)
+	if err != nil {
+		return err
+	}
+	if c.user != "" {
+		req.Header.Set("X-ClickHouse-User", c.user)
+		req.Header.Set("X-ClickHouse-Key", c.password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("ClickHouse responded with %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
@@ -28,22 +28,40 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
+	"path/filepath"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/loadimpact/k6/cloudapi"
 	easyjson "github.com/mailru/easyjson"
 	"github.com/sirupsen/logrus"
+	"github.com/spf13/afero"
+	"golang.org/x/time/rate"
 )
 
 // MetricsClient is a wrapper around the cloudapi.Client that is also capable of pushing
 type MetricsClient struct {
+	bytesSent   uint64 // accessed atomically, keep it first for 64-bit alignment
+	dumpedCount uint64 // accessed atomically
+
 	*cloudapi.Client
 	logger     logrus.FieldLogger
 	host       string
 	noCompress bool
 
+	// Limits the bandwidth used for pushing metrics, nil if unlimited
+	bandwidthLimiter *rate.Limiter
+
+	// The retry policy of the pushes, nil for the default one of the client
+	retryPolicy *cloudapi.RetryPolicy
+
+	// Where the payloads are also written to, dumpFS is nil if they aren't
+	dumpFS   afero.Fs
+	dumpDir  string
+	dumpOnly bool
+
 	pushBufferPool sync.Pool
 }
 
@@ -62,6 +80,70 @@ func NewMetricsClient(client *cloudapi.Client, logger logrus.FieldLogger, host s
 	}
 }
 
+// SetBandwidthLimit limits the bytes per second used for pushing metrics. A
+// limit of 0 or less removes the limit. It shouldn't be called concurrently
+// with PushMetric().
+func (mc *MetricsClient) SetBandwidthLimit(bytesPerSecond int64) {
+	if bytesPerSecond <= 0 {
+		mc.bandwidthLimiter = nil
+		return
+	}
+	mc.bandwidthLimiter = rate.NewLimiter(rate.Limit(bytesPerSecond), int(bytesPerSecond))
+}
+
+// SetRetryPolicy sets the retry policy used for pushing metrics. It shouldn't be
+// called concurrently with PushMetric().
+func (mc *MetricsClient) SetRetryPolicy(policy cloudapi.RetryPolicy) {
+	mc.retryPolicy = &policy
+}
+
+// SetPayloadDump makes every pushed payload also be written to a file in the
+// given directory, exactly as it would be sent. If only is true, the payloads
+// are just written and nothing is sent. It shouldn't be called concurrently
+// with PushMetric().
+func (mc *MetricsClient) SetPayloadDump(fs afero.Fs, dir string, only bool) {
+	mc.dumpFS = fs
+	mc.dumpDir = dir
+	mc.dumpOnly = only
+}
+
+// dumpPayload writes the given payload to a new file in the dump directory.
+// The files are numbered in the order they are written and gzipped payloads
+// get a .json.gz extension.
+func (mc *MetricsClient) dumpPayload(referenceID string, b []byte) error {
+	n := atomic.AddUint64(&mc.dumpedCount, 1)
+	name := fmt.Sprintf("%s-%06d.json", referenceID, n)
+	if !mc.noCompress {
+		name += ".gz"
+	}
+	return afero.WriteFile(mc.dumpFS, filepath.Join(mc.dumpDir, name), b, 0o644)
+}
+
+// BytesSent returns the total size of all metric payloads pushed so far.
+func (mc *MetricsClient) BytesSent() uint64 {
+	return atomic.LoadUint64(&mc.bytesSent)
+}
+
+// waitForBandwidth blocks until the payload of the given size can be sent
+// without going over the bandwidth limit.
+func (mc *MetricsClient) waitForBandwidth(ctx context.Context, size int) error {
+	if mc.bandwidthLimiter == nil {
+		return nil
+	}
+	burst := mc.bandwidthLimiter.Burst()
+	for size > 0 {
+		n := size
+		if n > burst {
+			n = burst
+		}
+		if err := mc.bandwidthLimiter.WaitN(ctx, n); err != nil {
+			return err
+		}
+		size -= n
+	}
+	return nil
+}
+
 // PushMetric pushes the provided metric samples for the given referenceID
 func (mc *MetricsClient) PushMetric(referenceID string, s []*Sample) error {
 	start := time.Now()
@@ -113,13 +195,35 @@ func (mc *MetricsClient) PushMetric(referenceID string, s []*Sample) error {
 		b = buf.Bytes()
 	}
 
+	if mc.dumpFS != nil {
+		if err = mc.dumpPayload(referenceID, b); err != nil {
+			return err
+		}
+		if mc.dumpOnly {
+			mc.logger.WithFields(logrus.Fields{
+				"t":         time.Since(start),
+				"part_size": len(s),
+			}).WithFields(additionalFields).Debug("Dumped part without pushing it to cloud")
+			return nil
+		}
+	}
+
+	if err = mc.waitForBandwidth(req.Context(), len(b)); err != nil {
+		return err
+	}
+
 	req.Header.Set("Content-Length", strconv.Itoa(len(b)))
 	req.Body = ioutil.NopCloser(bytes.NewReader(b))
 	req.GetBody = func() (io.ReadCloser, error) {
 		return ioutil.NopCloser(bytes.NewReader(b)), nil
 	}
 
-	err = mc.Client.Do(req, nil)
+	if mc.retryPolicy != nil {
+		err = mc.Client.DoWithRetries(req, nil, *mc.retryPolicy)
+	} else {
+		err = mc.Client.Do(req, nil)
+	}
+	atomic.AddUint64(&mc.bytesSent, uint64(len(b)))
 
 	mc.logger.WithFields(logrus.Fields{
 		"t":         time.Since(start),
@@ -26,6 +26,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/errors"
@@ -46,6 +47,17 @@ import (
 // TestName is the default Load Impact Cloud test name
 const TestName = "k6 test"
 
+const (
+	// When the used bandwidth goes over this fraction of MaxBandwidth, HTTP
+	// trails are aggregated more coarsely, until it drops below the second one.
+	bandwidthCoarsenRatio = 0.8
+	bandwidthRestoreRatio = 0.5
+
+	// The reference ID used in the names of the dumped payload files when
+	// there's no test run, because of PayloadDumpOnly.
+	payloadDumpRefID = "local"
+)
+
 // Output sends result data to the Load Impact cloud service.
 type Output struct {
 	config      cloudapi.Config
@@ -56,14 +68,19 @@ type Output struct {
 	thresholds    map[string][]*stats.Threshold
 	client        *MetricsClient
 
-	runStatus lib.RunStatus
+	runStatus    lib.RunStatus
+	testStopFunc func(error)
 
 	bufferMutex      sync.Mutex
 	bufferHTTPTrails []*httpext.Trail
 	bufferSamples    []*Sample
+	// How many samples were dropped because of MaxBufferedSamples since
+	// the last warning about it, guarded by bufferMutex.
+	droppedSamples int
 
-	logger logrus.FieldLogger
-	opts   lib.Options
+	logger   logrus.FieldLogger
+	opts     lib.Options
+	metadata map[string]string
 
 	// TODO: optimize this
 	//
@@ -75,6 +92,15 @@ type Output struct {
 	// don't fit in the chosen ring buffer size, we could just send them along to the buffer unaggregated
 	aggrBuckets map[int64]map[[3]string]aggregationBucket
 
+	// Set to 1 when getting close to the bandwidth limit, accessed atomically
+	coarseAggregation int32
+	lastPushTime      time.Time
+
+	// The consecutive failed pushes and when the circuit breaker was opened
+	// because of them, zero if it's closed. Only used by pushMetrics().
+	failedPushes    int64
+	circuitOpenedAt time.Time
+
 	stopSendingMetrics chan struct{}
 	stopAggregation    chan struct{}
 	aggregationDone    *sync.WaitGroup
@@ -86,6 +112,7 @@ type Output struct {
 var _ interface {
 	output.WithRunStatusUpdates
 	output.WithThresholds
+	output.WithTestRunStop
 } = &Output{}
 
 // New creates a new cloud output.
@@ -143,19 +170,68 @@ func newOutput(params output.Params) (*Output, error) {
 			conf.MetricPushConcurrency.Int64)
 	}
 
+	if conf.AbortOnRemoteFailure.Bool && !(conf.RemoteStatusPollInterval.Duration > 0) {
+		return nil, errors.Errorf("remote status poll interval must be a positive duration but is %s",
+			conf.RemoteStatusPollInterval.Duration)
+	}
+
+	if !(conf.MetricPushAttempts.Int64 > 0) {
+		return nil, errors.Errorf("metric push attempts must be a positive number but is %d",
+			conf.MetricPushAttempts.Int64)
+	}
+
+	if jitter := conf.MetricPushRetryJitter.Float64; jitter < 0 || jitter > 1 {
+		return nil, errors.Errorf("metric push retry jitter must be between 0 and 1 but is %g", jitter)
+	}
+
+	if conf.MetricPushCircuitBreakerThreshold.Int64 < 0 {
+		return nil, errors.Errorf("metric push circuit breaker threshold can't be negative but is %d",
+			conf.MetricPushCircuitBreakerThreshold.Int64)
+	}
+
+	if conf.MaxBufferedSamples.Int64 < 0 {
+		return nil, errors.Errorf("max buffered samples can't be negative but is %d", conf.MaxBufferedSamples.Int64)
+	}
+
+	if conf.MaxBandwidth.Int64 < 0 {
+		return nil, errors.Errorf("max bandwidth can't be negative but is %d", conf.MaxBandwidth.Int64)
+	}
+
 	if !(conf.MaxMetricSamplesPerPackage.Int64 > 0) {
 		return nil, errors.Errorf("metric samples per package must be a positive number but is %d",
 			conf.MaxMetricSamplesPerPackage.Int64)
 	}
 
+	if conf.PayloadDumpOnly.Bool && conf.PayloadDumpDir.String == "" {
+		return nil, errors.New("payload dump only mode needs a payload dump directory, please specify K6_CLOUD_PAYLOAD_DUMP")
+	}
+
 	apiClient := cloudapi.NewClient(logger, conf.Token.String, conf.Host.String, consts.Version)
+	if err := apiClient.ConfigureTransport(conf); err != nil {
+		return nil, err
+	}
+
+	client := NewMetricsClient(apiClient, logger, conf.Host.String, conf.NoCompress.Bool)
+	client.SetRetryPolicy(cloudapi.RetryPolicy{
+		Attempts:    int(conf.MetricPushAttempts.Int64),
+		Interval:    time.Duration(conf.MetricPushRetryInterval.Duration),
+		MaxInterval: time.Duration(conf.MetricPushRetryMaxInterval.Duration),
+		Jitter:      conf.MetricPushRetryJitter.Float64,
+	})
+	if dir := conf.PayloadDumpDir.String; dir != "" {
+		if err := params.FS.MkdirAll(dir, 0o755); err != nil {
+			return nil, errors.Wrap(err, "couldn't create the payload dump directory")
+		}
+		client.SetPayloadDump(params.FS, dir, conf.PayloadDumpOnly.Bool)
+	}
 
 	return &Output{
 		config:        conf,
-		client:        NewMetricsClient(apiClient, logger, conf.Host.String, conf.NoCompress.Bool),
+		client:        client,
 		executionPlan: params.ExecutionPlan,
 		duration:      int64(duration / time.Second),
 		opts:          params.ScriptOptions,
+		metadata:      conf.TestRunMetadata(params.Environment),
 		aggrBuckets:   map[int64]map[[3]string]aggregationBucket{},
 		logger:        logger,
 
@@ -188,6 +264,16 @@ func validateRequiredSystemTags(scriptTags *stats.SystemTagSet) error {
 // Start calls the k6 Cloud API to initialize the test run, and then starts the
 // goroutine that would listen for metric samples and send them to the cloud.
 func (out *Output) Start() error {
+	if out.config.PayloadDumpOnly.Bool {
+		out.referenceID = payloadDumpRefID
+		if out.config.PushRefID.Valid {
+			out.referenceID = out.config.PushRefID.String
+		}
+		out.logger.WithField("dir", out.config.PayloadDumpDir.String).Debug("only dumping metric payloads without init")
+		out.startBackgroundProcesses()
+		return nil
+	}
+
 	if out.config.PushRefID.Valid {
 		out.referenceID = out.config.PushRefID.String
 		out.logger.WithField("referenceId", out.referenceID).Debug("directly pushing metrics without init")
@@ -210,6 +296,7 @@ func (out *Output) Start() error {
 		VUsMax:     int64(maxVUs),
 		Thresholds: thresholds,
 		Duration:   out.duration,
+		Metadata:   out.metadata,
 	}
 
 	response, err := out.client.CreateTestRun(testRun)
@@ -237,6 +324,9 @@ func (out *Output) Start() error {
 }
 
 func (out *Output) startBackgroundProcesses() {
+	out.client.SetBandwidthLimit(out.config.MaxBandwidth.Int64)
+	out.lastPushTime = time.Now()
+
 	aggregationPeriod := time.Duration(out.config.AggregationPeriod.Duration)
 	// If enabled, start periodically aggregating the collected HTTP trails
 	if aggregationPeriod > 0 {
@@ -262,6 +352,28 @@ func (out *Output) startBackgroundProcesses() {
 		}()
 	}
 
+	// If enabled, periodically check if the cloud has marked the test run as failed
+	if out.config.AbortOnRemoteFailure.Bool && !out.config.PayloadDumpOnly.Bool && out.testStopFunc != nil {
+		out.outputDone.Add(1)
+		go func() {
+			defer out.outputDone.Done()
+			statusTicker := time.NewTicker(time.Duration(out.config.RemoteStatusPollInterval.Duration))
+			defer statusTicker.Stop()
+			for {
+				select {
+				case <-out.stopSendingMetrics:
+					return
+				case <-out.stopOutput:
+					return
+				case <-statusTicker.C:
+					if out.checkRemoteStatus() {
+						return
+					}
+				}
+			}
+		}()
+	}
+
 	out.outputDone.Add(1)
 	go func() {
 		defer out.outputDone.Done()
@@ -294,6 +406,7 @@ func (out *Output) Stop() error {
 	close(out.stopOutput)
 	out.outputDone.Wait()
 	out.logger.Debug("Metric emission stopped, calling cloud API...")
+	out.logger.WithField("bytes", out.client.BytesSent()).Debug("Total metric data sent to the cloud")
 	err := out.testFinished()
 	if err != nil {
 		out.logger.WithFields(logrus.Fields{"error": err}).Warn("Failed to send test finished to the cloud")
@@ -313,6 +426,32 @@ func (out *Output) SetRunStatus(status lib.RunStatus) {
 	out.runStatus = status
 }
 
+// SetTestRunStopCallback receives the function that stops the test run.
+func (out *Output) SetTestRunStopCallback(stopFunc func(error)) {
+	out.testStopFunc = stopFunc
+}
+
+// checkRemoteStatus asks the cloud for the status of the test run and stops
+// the test run if the cloud has marked it as failed. It returns true if the
+// test run was stopped.
+func (out *Output) checkRemoteStatus() bool {
+	progress, err := out.client.GetTestProgress(out.referenceID)
+	if err != nil {
+		out.logger.WithError(err).Debug("Failed to get the test run status from the cloud")
+		return false
+	}
+	if progress.ResultStatus != cloudapi.ResultStatusFailed {
+		return false
+	}
+
+	reason := "the test run was marked as failed by the cloud"
+	if progress.RunStatusText != "" {
+		reason += " (" + progress.RunStatusText + ")"
+	}
+	out.testStopFunc(errors.New(reason))
+	return true
+}
+
 // SetThresholds receives the thresholds before the output is Start()-ed.
 func (out *Output) SetThresholds(scriptThresholds map[string]stats.Thresholds) {
 	thresholds := make(map[string][]*stats.Threshold)
@@ -408,6 +547,7 @@ func (out *Output) AddMetricSamples(sampleContainers []stats.SampleContainer) {
 		out.bufferMutex.Lock()
 		out.bufferSamples = append(out.bufferSamples, newSamples...)
 		out.bufferHTTPTrails = append(out.bufferHTTPTrails, newHTTPTrails...)
+		out.dropExcessSamples()
 		out.bufferMutex.Unlock()
 	}
 }
@@ -462,6 +602,8 @@ func (out *Output) aggregateHTTPTrails(waitPeriod time.Duration) {
 
 	// Which buckets are still new and we'll wait for trails to accumulate before aggregating
 	bucketCutoffID := time.Now().Add(-waitPeriod).UnixNano() / aggrPeriod
+	skipOutlierDetection := out.config.AggregationSkipOutlierDetection.Bool ||
+		atomic.LoadInt32(&out.coarseAggregation) == 1
 	iqrRadius := out.config.AggregationOutlierIqrRadius.Float64
 	iqrLowerCoef := out.config.AggregationOutlierIqrCoefLower.Float64
 	iqrUpperCoef := out.config.AggregationOutlierIqrCoefUpper.Float64
@@ -490,7 +632,7 @@ func (out *Output) aggregateHTTPTrails(waitPeriod time.Duration) {
 					Tags: tags,
 				}
 
-				if out.config.AggregationSkipOutlierDetection.Bool {
+				if skipOutlierDetection {
 					// Simply add up all HTTP trails, no outlier detection
 					for _, trail := range httpTrails {
 						aggrData.Add(trail)
@@ -552,6 +694,7 @@ func (out *Output) aggregateHTTPTrails(waitPeriod time.Duration) {
 	if len(newSamples) > 0 {
 		out.bufferMutex.Lock()
 		out.bufferSamples = append(out.bufferSamples, newSamples...)
+		out.dropExcessSamples()
 		out.bufferMutex.Unlock()
 	}
 }
@@ -577,6 +720,7 @@ func (out *Output) flushHTTPTrails() {
 	out.bufferHTTPTrails = nil
 	out.aggrBuckets = map[int64]map[[3]string]aggregationBucket{}
 	out.bufferSamples = append(out.bufferSamples, newSamples...)
+	out.dropExcessSamples()
 }
 
 func (out *Output) shouldStopSendingMetrics(err error) bool {
@@ -606,6 +750,19 @@ func ceilDiv(a, b int) int {
 }
 
 func (out *Output) pushMetrics() {
+	breaker := out.config.MetricPushCircuitBreakerThreshold.Int64 > 0
+	final := false
+	select {
+	case <-out.stopOutput:
+		final = true
+	default:
+	}
+	out.warnDroppedSamples()
+	// The last push is always attempted, even if the circuit is open
+	if breaker && !final && out.isCircuitOpen() {
+		return
+	}
+
 	out.bufferMutex.Lock()
 	if len(out.bufferSamples) == 0 {
 		out.bufferMutex.Unlock()
@@ -620,6 +777,7 @@ func (out *Output) pushMetrics() {
 		"samples": count,
 	}).Debug("Pushing metrics to cloud")
 	start := time.Now()
+	sentBefore := out.client.BytesSent()
 
 	numberOfPackages := ceilDiv(len(buffer), int(out.config.MaxMetricSamplesPerPackage.Int64))
 	numberOfWorkers := int(out.config.MetricPushConcurrency.Int64)
@@ -655,25 +813,152 @@ func (out *Output) pushMetrics() {
 
 	close(ch)
 
+	var failed []*Sample
 	for _, job := range jobs {
 		err := <-job.done
 		if err != nil {
 			if out.shouldStopSendingMetrics(err) {
 				out.logger.WithError(err).Warn("Stopped sending metrics to cloud due to an error")
 				close(out.stopSendingMetrics)
+				breaker = false
 				break
 			}
 			out.logger.WithError(err).Warn("Failed to send metrics to cloud")
+			failed = append(failed, job.samples...)
 		}
 	}
+	if breaker {
+		out.updateCircuitBreaker(failed, final)
+	}
+	sent := out.client.BytesSent() - sentBefore
 	out.logger.WithFields(logrus.Fields{
 		"samples": count,
+		"bytes":   sent,
 		"t":       time.Since(start),
 	}).Debug("Pushing metrics to cloud finished")
+	out.trackBandwidth(sent)
+}
+
+// isCircuitOpen returns whether the pushes are paused by the circuit breaker.
+// After the cooldown, the circuit is half-open and the next push is attempted.
+func (out *Output) isCircuitOpen() bool {
+	if out.circuitOpenedAt.IsZero() {
+		return false
+	}
+	cooldown := time.Duration(out.config.MetricPushCircuitBreakerCooldown.Duration)
+	return time.Since(out.circuitOpenedAt) < cooldown
+}
+
+// updateCircuitBreaker puts the samples of the failed pushes back in the
+// buffer, so they are sent with the next push, and opens the circuit after
+// too many consecutive failures. It closes it again after a successful push.
+func (out *Output) updateCircuitBreaker(failed []*Sample, final bool) {
+	if len(failed) == 0 {
+		if !out.circuitOpenedAt.IsZero() {
+			out.logger.Info("Sending metrics to cloud succeeded again, resuming the pushes")
+		}
+		out.failedPushes = 0
+		out.circuitOpenedAt = time.Time{}
+		return
+	}
+
+	if final {
+		out.logger.WithField("samples", len(failed)).Warn("Dropping the metric samples that couldn't be sent to cloud")
+		return
+	}
+
+	out.bufferMutex.Lock()
+	out.bufferSamples = append(failed, out.bufferSamples...)
+	out.dropExcessSamples()
+	out.bufferMutex.Unlock()
+	out.warnDroppedSamples()
+
+	out.failedPushes++
+	if !out.circuitOpenedAt.IsZero() || out.failedPushes >= out.config.MetricPushCircuitBreakerThreshold.Int64 {
+		if out.circuitOpenedAt.IsZero() {
+			out.logger.WithFields(logrus.Fields{
+				"failures": out.failedPushes,
+				"cooldown": out.config.MetricPushCircuitBreakerCooldown.Duration,
+			}).Warn("Too many failed pushes of metrics to cloud, pausing them and buffering the samples")
+		}
+		out.circuitOpenedAt = time.Now()
+	}
+}
+
+// dropExcessSamples removes the oldest samples from the buffer when it holds
+// more than MaxBufferedSamples, so it can't grow without bound while the
+// pushes are failing or falling behind. It has to be called with the
+// bufferMutex locked.
+func (out *Output) dropExcessSamples() {
+	limit := int(out.config.MaxBufferedSamples.Int64)
+	excess := len(out.bufferSamples) - limit
+	if limit <= 0 || excess <= 0 {
+		return
+	}
+	out.bufferSamples = append(out.bufferSamples[:0:0], out.bufferSamples[excess:]...)
+	out.droppedSamples += excess
+}
+
+// warnDroppedSamples logs how many samples were dropped by dropExcessSamples
+// since the last time it was called, if any.
+func (out *Output) warnDroppedSamples() {
+	out.bufferMutex.Lock()
+	dropped := out.droppedSamples
+	out.droppedSamples = 0
+	out.bufferMutex.Unlock()
+	if dropped > 0 {
+		out.logger.WithFields(logrus.Fields{
+			"samples": dropped,
+			"limit":   out.config.MaxBufferedSamples.Int64,
+		}).Warn("Too many buffered metric samples, dropping the oldest ones")
+	}
+}
+
+// trackBandwidth records the bytes sent by a metrics push as a metric sample
+// and switches to coarser HTTP trail aggregation when the pushes get close to
+// the configured bandwidth limit. It's a no-op when there's no limit.
+func (out *Output) trackBandwidth(sent uint64) {
+	now := time.Now()
+	elapsed := now.Sub(out.lastPushTime)
+	out.lastPushTime = now
+
+	limit := out.config.MaxBandwidth.Int64
+	if limit <= 0 {
+		return
+	}
+
+	out.bufferMutex.Lock()
+	out.bufferSamples = append(out.bufferSamples, &Sample{
+		Type:   DataTypeSingle,
+		Metric: metrics.CloudDataSent.Name,
+		Data: &SampleDataSingle{
+			Type:  metrics.CloudDataSent.Type,
+			Time:  toMicroSecond(now),
+			Tags:  out.opts.RunTags,
+			Value: float64(sent),
+		},
+	})
+	out.dropExcessSamples()
+	out.bufferMutex.Unlock()
+
+	if elapsed <= 0 {
+		return
+	}
+	usage := float64(sent) / elapsed.Seconds() / float64(limit)
+	switch {
+	case usage >= bandwidthCoarsenRatio && atomic.CompareAndSwapInt32(&out.coarseAggregation, 0, 1):
+		if out.config.AggregationPeriod.Duration > 0 {
+			out.logger.Warn("Getting close to the cloud bandwidth limit, aggregating HTTP metrics more coarsely")
+		} else {
+			out.logger.Warn("Getting close to the cloud bandwidth limit, consider enabling the aggregation of HTTP metrics")
+		}
+	case usage < bandwidthRestoreRatio && atomic.CompareAndSwapInt32(&out.coarseAggregation, 1, 0):
+		out.logger.Debug("The cloud bandwidth usage has dropped, restoring the normal HTTP metrics aggregation")
+	}
 }
 
 func (out *Output) testFinished() error {
-	if out.referenceID == "" || out.config.PushRefID.Valid {
+	if out.referenceID == "" || out.config.PushRefID.Valid || out.config.PayloadDumpOnly.Bool {
 		return nil
 	}
 
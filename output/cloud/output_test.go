@@ -33,9 +33,11 @@ import (
 	"sort"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
@@ -643,6 +645,95 @@ func TestCloudOutputPushRefID(t *testing.T) {
 	require.NoError(t, out.Stop())
 }
 
+func TestCloudOutputMetadata(t *testing.T) {
+	t.Parallel()
+
+	tb := httpmultibin.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+	var testRun cloudapi.TestRun
+	tb.Mux.HandleFunc("/v1/tests", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&testRun))
+		_, err := fmt.Fprint(w, `{"reference_id": "123"}`)
+		assert.NoError(t, err)
+	}))
+	tb.Mux.HandleFunc("/v1/tests/123", func(_ http.ResponseWriter, _ *http.Request) {})
+
+	out, err := newOutput(output.Params{
+		Logger: testutils.NewLogger(t),
+		JSONConfig: json.RawMessage(fmt.Sprintf(`{
+			"host": "%s", "noCompress": true,
+			"metadata": {"team": "qa"}
+		}`, tb.ServerHTTP.URL)),
+		Environment: map[string]string{"GIT_COMMIT": "abc123"},
+		ScriptOptions: lib.Options{
+			Duration:   types.NullDurationFrom(1 * time.Second),
+			SystemTags: &stats.DefaultSystemTagSet,
+			External: map[string]json.RawMessage{
+				"loadimpact": json.RawMessage(`{"metadata": {"service": "api"}}`),
+			},
+		},
+		ScriptPath: &url.URL{Path: "/script.js"},
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, out.Start())
+	require.NoError(t, out.Stop())
+	assert.Equal(t, map[string]string{
+		"team":                     "qa",
+		"service":                  "api",
+		cloudapi.MetadataGitCommit: "abc123",
+	}, testRun.Metadata)
+}
+
+func TestCloudOutputAbortOnRemoteFailure(t *testing.T) {
+	t.Parallel()
+
+	tb := httpmultibin.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+	tb.Mux.HandleFunc("/v1/tests", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := fmt.Fprint(w, `{"reference_id": "123"}`)
+		assert.NoError(t, err)
+	}))
+	tb.Mux.HandleFunc("/v1/tests/123", func(_ http.ResponseWriter, _ *http.Request) {})
+	var progressCalls int32
+	tb.Mux.HandleFunc("/v1/test-progress/123", func(w http.ResponseWriter, _ *http.Request) {
+		resultStatus := cloudapi.ResultStatusPassed
+		if atomic.AddInt32(&progressCalls, 1) > 1 {
+			resultStatus = cloudapi.ResultStatusFailed
+		}
+		_, err := fmt.Fprintf(w, `{"result_status": %d, "run_status_text": "Thresholds failed"}`, resultStatus)
+		assert.NoError(t, err)
+	})
+
+	out, err := newOutput(output.Params{
+		Logger: testutils.NewLogger(t),
+		JSONConfig: json.RawMessage(fmt.Sprintf(`{
+			"host": "%s", "noCompress": true,
+			"abortOnRemoteFailure": true,
+			"remoteStatusPollInterval": "10ms"
+		}`, tb.ServerHTTP.URL)),
+		ScriptOptions: lib.Options{
+			Duration:   types.NullDurationFrom(1 * time.Second),
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		ScriptPath: &url.URL{Path: "/script.js"},
+	})
+	require.NoError(t, err)
+
+	stopErr := make(chan error, 1)
+	out.SetTestRunStopCallback(func(err error) { stopErr <- err })
+	require.NoError(t, out.Start())
+
+	select {
+	case err := <-stopErr:
+		assert.EqualError(t, err, "the test run was marked as failed by the cloud (Thresholds failed)")
+	case <-time.After(5 * time.Second):
+		t.Error("the test run wasn't stopped")
+	}
+	require.NoError(t, out.Stop())
+	assert.Equal(t, int32(2), atomic.LoadInt32(&progressCalls))
+}
+
 func TestCloudOutputRecvIterLIAllIterations(t *testing.T) {
 	t.Parallel()
 	tb := httpmultibin.NewHTTPMultiBin(t)
@@ -836,3 +927,307 @@ func TestPublishMetric(t *testing.T) {
 
 	assert.Nil(t, err)
 }
+
+func TestPushMetricBandwidthLimit(t *testing.T) {
+	t.Parallel()
+
+	var received int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		atomic.AddInt64(&received, int64(len(body)))
+	}))
+	defer server.Close()
+
+	out, err := newOutput(output.Params{
+		Logger:     testutils.NewLogger(t),
+		JSONConfig: json.RawMessage(fmt.Sprintf(`{"host": "%s", "noCompress": true}`, server.URL)),
+		ScriptOptions: lib.Options{
+			Duration:   types.NullDurationFrom(1 * time.Second),
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		ScriptPath: &url.URL{Path: "script.js"},
+	})
+	require.NoError(t, err)
+
+	samples := []*Sample{{
+		Type:   DataTypeSingle,
+		Metric: "metric",
+		Data:   &SampleDataSingle{Type: stats.Counter, Time: toMicroSecond(time.Now()), Value: 1},
+	}}
+	require.NoError(t, out.client.PushMetric("1", samples))
+	size := out.client.BytesSent()
+	assert.Equal(t, uint64(atomic.LoadInt64(&received)), size)
+
+	// The burst is a second's worth of bytes, so the first push fits in it
+	// and the next one has to wait for half a second.
+	out.client.SetBandwidthLimit(int64(size) * 2)
+	start := time.Now()
+	require.NoError(t, out.client.PushMetric("1", samples))
+	require.NoError(t, out.client.PushMetric("1", samples))
+	require.NoError(t, out.client.PushMetric("1", samples))
+	assert.True(t, time.Since(start) >= 400*time.Millisecond)
+	assert.Equal(t, 4*size, out.client.BytesSent())
+}
+
+func TestCloudOutputTrackBandwidth(t *testing.T) {
+	t.Parallel()
+
+	out, err := newOutput(output.Params{
+		Logger:     testutils.NewLogger(t),
+		JSONConfig: json.RawMessage(`{"host": "https://cloud.invalid", "maxBandwidth": 100}`),
+		ScriptOptions: lib.Options{
+			Duration:   types.NullDurationFrom(1 * time.Second),
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		ScriptPath: &url.URL{Path: "script.js"},
+	})
+	require.NoError(t, err)
+
+	out.lastPushTime = time.Now().Add(-1 * time.Second)
+	out.trackBandwidth(90)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&out.coarseAggregation))
+	require.Len(t, out.bufferSamples, 1)
+	assert.Equal(t, metrics.CloudDataSent.Name, out.bufferSamples[0].Metric)
+	assert.Equal(t, 90.0, out.bufferSamples[0].Data.(*SampleDataSingle).Value)
+
+	out.lastPushTime = time.Now().Add(-1 * time.Second)
+	out.trackBandwidth(60)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&out.coarseAggregation))
+
+	out.lastPushTime = time.Now().Add(-1 * time.Second)
+	out.trackBandwidth(10)
+	assert.Equal(t, int32(0), atomic.LoadInt32(&out.coarseAggregation))
+	assert.Len(t, out.bufferSamples, 3)
+}
+
+func TestCloudOutputPayloadDump(t *testing.T) {
+	t.Parallel()
+
+	tb := httpmultibin.NewHTTPMultiBin(t)
+	defer tb.Cleanup()
+	tb.Mux.HandleFunc("/v1/", func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("%s should not have been called at all", r.RequestURI)
+	})
+
+	fs := afero.NewMemMapFs()
+	out, err := newOutput(output.Params{
+		Logger: testutils.NewLogger(t),
+		JSONConfig: json.RawMessage(fmt.Sprintf(`{
+			"host": "%s", "noCompress": true,
+			"metricPushInterval": "10ms",
+			"payloadDumpDir": "dump/",
+			"payloadDumpOnly": true,
+			"abortOnRemoteFailure": true
+		}`, tb.ServerHTTP.URL)),
+		ScriptOptions: lib.Options{
+			Duration:   types.NullDurationFrom(1 * time.Second),
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		ScriptPath: &url.URL{Path: "/script.js"},
+		FS:         fs,
+	})
+	require.NoError(t, err)
+	require.NoError(t, out.Start())
+	assert.Equal(t, "local", out.referenceID)
+
+	now := time.Now()
+	tags := stats.IntoSampleTags(&map[string]string{"test": "mest"})
+	out.AddMetricSamples([]stats.SampleContainer{stats.Sample{
+		Time:   now,
+		Metric: metrics.VUs,
+		Tags:   tags,
+		Value:  1,
+	}})
+	require.NoError(t, out.Stop())
+
+	data, err := afero.ReadFile(fs, "dump/local-000001.json")
+	require.NoError(t, err)
+	var receivedSamples []Sample
+	require.NoError(t, json.Unmarshal(data, &receivedSamples))
+	require.Len(t, receivedSamples, 1)
+	assert.Equal(t, metrics.VUs.Name, receivedSamples[0].Metric)
+	assert.Equal(t, uint64(0), out.client.BytesSent())
+
+	_, err = newOutput(output.Params{
+		Logger:     testutils.NewLogger(t),
+		JSONConfig: json.RawMessage(`{"payloadDumpOnly": true}`),
+		ScriptOptions: lib.Options{
+			Duration:   types.NullDurationFrom(1 * time.Second),
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		ScriptPath: &url.URL{Path: "/script.js"},
+		FS:         fs,
+	})
+	require.EqualError(t, err, "payload dump only mode needs a payload dump directory, please specify K6_CLOUD_PAYLOAD_DUMP")
+}
+
+func TestPushMetricPayloadDump(t *testing.T) {
+	t.Parallel()
+
+	var requests int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+	}))
+	defer server.Close()
+
+	fs := afero.NewMemMapFs()
+	out, err := newOutput(output.Params{
+		Logger:     testutils.NewLogger(t),
+		JSONConfig: json.RawMessage(fmt.Sprintf(`{"host": "%s", "payloadDumpDir": "dump"}`, server.URL)),
+		ScriptOptions: lib.Options{
+			Duration:   types.NullDurationFrom(1 * time.Second),
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		ScriptPath: &url.URL{Path: "script.js"},
+		FS:         fs,
+	})
+	require.NoError(t, err)
+
+	samples := []*Sample{{
+		Type:   DataTypeSingle,
+		Metric: "metric",
+		Data:   &SampleDataSingle{Type: stats.Counter, Time: toMicroSecond(time.Now()), Value: 1},
+	}}
+	require.NoError(t, out.client.PushMetric("123", samples))
+	require.NoError(t, out.client.PushMetric("123", samples))
+	assert.Equal(t, int64(2), atomic.LoadInt64(&requests))
+
+	for _, name := range []string{"dump/123-000001.json.gz", "dump/123-000002.json.gz"} {
+		data, err := afero.ReadFile(fs, name)
+		require.NoError(t, err)
+		g, err := gzip.NewReader(bytes.NewReader(data))
+		require.NoError(t, err)
+		var dumped []Sample
+		require.NoError(t, json.NewDecoder(g).Decode(&dumped))
+		require.Len(t, dumped, 1)
+		assert.Equal(t, "metric", dumped[0].Metric)
+	}
+}
+
+func TestCloudOutputCircuitBreaker(t *testing.T) {
+	t.Parallel()
+
+	var failing int32 = 1
+	var requests, received int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		var samples []Sample
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&samples))
+		atomic.AddInt64(&received, int64(len(samples)))
+	}))
+	defer server.Close()
+
+	out, err := newOutput(output.Params{
+		Logger: testutils.NewLogger(t),
+		JSONConfig: json.RawMessage(fmt.Sprintf(`{
+			"host": "%s", "noCompress": true,
+			"metricPushAttempts": 1,
+			"metricPushCircuitBreakerThreshold": 2,
+			"metricPushCircuitBreakerCooldown": "1h"
+		}`, server.URL)),
+		ScriptOptions: lib.Options{
+			Duration:   types.NullDurationFrom(1 * time.Second),
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		ScriptPath: &url.URL{Path: "/script.js"},
+	})
+	require.NoError(t, err)
+	out.referenceID = "123"
+
+	addSample := func() {
+		out.AddMetricSamples([]stats.SampleContainer{stats.Sample{
+			Time:   time.Now(),
+			Metric: metrics.VUs,
+			Tags:   stats.IntoSampleTags(&map[string]string{}),
+			Value:  1,
+		}})
+	}
+
+	// The samples of the failed pushes are kept for the next ones
+	addSample()
+	out.pushMetrics()
+	addSample()
+	out.pushMetrics()
+	assert.Equal(t, int64(2), atomic.LoadInt64(&requests))
+	assert.Len(t, out.bufferSamples, 2)
+
+	// The circuit is open, so nothing is pushed until the cooldown is over
+	assert.True(t, out.isCircuitOpen())
+	addSample()
+	out.pushMetrics()
+	assert.Equal(t, int64(2), atomic.LoadInt64(&requests))
+	assert.Len(t, out.bufferSamples, 3)
+
+	atomic.StoreInt32(&failing, 0)
+	out.circuitOpenedAt = time.Now().Add(-2 * time.Hour)
+	out.pushMetrics()
+	assert.Equal(t, int64(3), atomic.LoadInt64(&requests))
+	assert.Equal(t, int64(3), atomic.LoadInt64(&received))
+	assert.Empty(t, out.bufferSamples)
+	assert.False(t, out.isCircuitOpen())
+	assert.True(t, out.circuitOpenedAt.IsZero())
+}
+
+func TestCloudOutputMaxBufferedSamples(t *testing.T) {
+	t.Parallel()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	out, err := newOutput(output.Params{
+		Logger: testutils.NewLogger(t),
+		JSONConfig: json.RawMessage(fmt.Sprintf(`{
+			"host": "%s", "noCompress": true,
+			"metricPushAttempts": 1,
+			"metricPushCircuitBreakerThreshold": 1,
+			"metricPushCircuitBreakerCooldown": "1h",
+			"maxBufferedSamples": 2
+		}`, server.URL)),
+		ScriptOptions: lib.Options{
+			Duration:   types.NullDurationFrom(1 * time.Second),
+			SystemTags: &stats.DefaultSystemTagSet,
+		},
+		ScriptPath: &url.URL{Path: "/script.js"},
+	})
+	require.NoError(t, err)
+	out.referenceID = "123"
+
+	for i := 1; i <= 3; i++ {
+		out.AddMetricSamples([]stats.SampleContainer{stats.Sample{
+			Time:   time.Now(),
+			Metric: metrics.VUs,
+			Tags:   stats.IntoSampleTags(&map[string]string{}),
+			Value:  float64(i),
+		}})
+	}
+	out.pushMetrics()
+
+	// Only the newest samples of the failed push are kept
+	require.Len(t, out.bufferSamples, 2)
+	assert.Equal(t, 2.0, out.bufferSamples[0].Data.(*SampleDataSingle).Value)
+	assert.Equal(t, 3.0, out.bufferSamples[1].Data.(*SampleDataSingle).Value)
+
+	// The buffer is bounded while the circuit is open too
+	require.True(t, out.isCircuitOpen())
+	for i := 4; i <= 6; i++ {
+		out.AddMetricSamples([]stats.SampleContainer{stats.Sample{
+			Time:   time.Now(),
+			Metric: metrics.VUs,
+			Tags:   stats.IntoSampleTags(&map[string]string{}),
+			Value:  float64(i),
+		}})
+	}
+	require.Len(t, out.bufferSamples, 2)
+	assert.Equal(t, 5.0, out.bufferSamples[0].Data.(*SampleDataSingle).Value)
+	assert.Equal(t, 6.0, out.bufferSamples[1].Data.(*SampleDataSingle).Value)
+	assert.Equal(t, 3, out.droppedSamples)
+	out.warnDroppedSamples()
+	assert.Zero(t, out.droppedSamples)
+}
@@ -0,0 +1,206 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package output
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/afero"
+)
+
+// FileWriterConfig controls when a FileWriter starts a new file. Zero values
+// disable the respective kind of rotation.
+type FileWriterConfig struct {
+	// MaxSize is the number of bytes written to the disk after which the
+	// file is rotated. For compressed files it's approximate, since the
+	// compressors buffer some of the data.
+	MaxSize int64
+	// MaxAge is how long a file is written to before it's rotated.
+	MaxAge time.Duration
+}
+
+// FileWriter writes to a file that is transparently compressed with gzip or
+// zstd, based on its .gz or .zst extension, and that can be rotated after it
+// reaches a maximum size or age. The rotated files are named by inserting an
+// increasing index before the extensions of the original file name, e.g.
+// results.csv.gz, results.1.csv.gz, results.2.csv.gz, etc.
+//
+// Rotation only happens in Rotate(), so outputs can make sure that a file
+// always ends on a complete record. The next file is created on the first
+// write after that, so there are no empty files at the end of the test.
+type FileWriter struct {
+	fs       afero.Fs
+	filename string
+	conf     FileWriterConfig
+	now      func() time.Time
+
+	file     afero.File
+	counter  *countingWriter
+	w        io.WriteCloser
+	index    int
+	openedAt time.Time
+}
+
+// NewFileWriter creates the given file and returns a FileWriter for it.
+func NewFileWriter(fs afero.Fs, filename string, conf FileWriterConfig) (*FileWriter, error) {
+	fw := &FileWriter{fs: fs, filename: filename, conf: conf, now: time.Now}
+	if err := fw.open(); err != nil {
+		return nil, err
+	}
+	return fw, nil
+}
+
+// Write writes the (uncompressed) data to the current file.
+func (fw *FileWriter) Write(p []byte) (int, error) {
+	if fw.w == nil {
+		if err := fw.open(); err != nil {
+			return 0, err
+		}
+	}
+	return fw.w.Write(p)
+}
+
+// Rotate closes the current file if it's over its size or age limit, so the
+// next write goes to a new file. It returns whether that happened, so the
+// callers know when they have to write any headers again.
+func (fw *FileWriter) Rotate() (bool, error) {
+	if fw.w == nil || !fw.shouldRotate() {
+		return false, nil
+	}
+	fw.index++
+	return true, fw.closeFile()
+}
+
+// Close flushes any compressed data and closes the current file.
+func (fw *FileWriter) Close() error {
+	if fw.w == nil {
+		return nil
+	}
+	return fw.closeFile()
+}
+
+// Name returns the name of the file that is currently (or will next be)
+// written to.
+func (fw *FileWriter) Name() string {
+	return rotatedFileName(fw.filename, fw.index)
+}
+
+func (fw *FileWriter) shouldRotate() bool {
+	if fw.conf.MaxSize > 0 && fw.counter.n >= fw.conf.MaxSize {
+		return true
+	}
+	return fw.conf.MaxAge > 0 && fw.now().Sub(fw.openedAt) >= fw.conf.MaxAge
+}
+
+func (fw *FileWriter) open() error {
+	file, err := fw.fs.Create(fw.Name())
+	if err != nil {
+		return err
+	}
+	fw.file = file
+	fw.counter = &countingWriter{w: file}
+	fw.openedAt = fw.now()
+
+	switch {
+	case strings.HasSuffix(fw.filename, ".gz"):
+		fw.w = gzip.NewWriter(fw.counter)
+	case strings.HasSuffix(fw.filename, ".zst"), strings.HasSuffix(fw.filename, ".zstd"):
+		fw.w, err = zstd.NewWriter(fw.counter)
+		if err != nil {
+			_ = file.Close()
+			return err
+		}
+	default:
+		fw.w = nopWriteCloser{fw.counter}
+	}
+	return nil
+}
+
+func (fw *FileWriter) closeFile() error {
+	err := fw.w.Close()
+	if cerr := fw.file.Close(); err == nil {
+		err = cerr
+	}
+	fw.w, fw.file = nil, nil
+	return err
+}
+
+// rotatedFileName inserts the index before the extensions of the file name,
+// so that the rotated files keep the same extensions as the original one.
+func rotatedFileName(filename string, index int) string {
+	if index == 0 {
+		return filename
+	}
+	dir, base := filepath.Split(filename)
+	name, ext := base, ""
+	if i := strings.IndexByte(base, '.'); i > 0 {
+		name, ext = base[:i], base[i:]
+	}
+	return fmt.Sprintf("%s%s.%d%s", dir, name, index, ext)
+}
+
+// ParseSize parses human-readable sizes like 500MB or 2GB into bytes. The
+// units are powers of 1024 and a number without a unit is in bytes.
+func ParseSize(s string) (int64, error) {
+	units := []struct {
+		suffix string
+		mult   int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+	}
+	str := strings.ToUpper(strings.TrimSpace(s))
+	mult := int64(1)
+	for _, u := range units {
+		if strings.HasSuffix(str, u.suffix) {
+			str, mult = strings.TrimSpace(strings.TrimSuffix(str, u.suffix)), u.mult
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size '%s'", s)
+	}
+	return int64(n * float64(mult)), nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,157 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package output
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readFile(t *testing.T, fs afero.Fs, name string) string {
+	data, err := afero.ReadFile(fs, name)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestFileWriterRotateSize(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	fw, err := NewFileWriter(fs, "/out/results.csv", FileWriterConfig{MaxSize: 10})
+	require.NoError(t, err)
+
+	for _, line := range []string{"aaaaa\n", "bbbbb\n", "ccccc\n", "ddddd\n", "eee\n"} {
+		_, err = fw.Write([]byte(line))
+		require.NoError(t, err)
+		_, err = fw.Rotate()
+		require.NoError(t, err)
+	}
+	assert.Equal(t, "/out/results.2.csv", fw.Name())
+	require.NoError(t, fw.Close())
+
+	assert.Equal(t, "aaaaa\nbbbbb\n", readFile(t, fs, "/out/results.csv"))
+	assert.Equal(t, "ccccc\nddddd\n", readFile(t, fs, "/out/results.1.csv"))
+	assert.Equal(t, "eee\n", readFile(t, fs, "/out/results.2.csv"))
+	exists, err := afero.Exists(fs, "/out/results.3.csv")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestFileWriterRotateAge(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	now := time.Now()
+	fw, err := NewFileWriter(fs, "results.json", FileWriterConfig{MaxAge: time.Minute})
+	require.NoError(t, err)
+	fw.now = func() time.Time { return now }
+	fw.openedAt = now
+
+	_, err = fw.Write([]byte("a"))
+	require.NoError(t, err)
+	rotated, err := fw.Rotate()
+	require.NoError(t, err)
+	assert.False(t, rotated)
+
+	now = now.Add(time.Minute)
+	rotated, err = fw.Rotate()
+	require.NoError(t, err)
+	assert.True(t, rotated)
+
+	_, err = fw.Write([]byte("b"))
+	require.NoError(t, err)
+	require.NoError(t, fw.Close())
+	assert.Equal(t, "a", readFile(t, fs, "results.json"))
+	assert.Equal(t, "b", readFile(t, fs, "results.1.json"))
+}
+
+func TestFileWriterCompression(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	for _, name := range []string{"results.json.gz", "results.json.zst"} {
+		fw, err := NewFileWriter(fs, name, FileWriterConfig{})
+		require.NoError(t, err)
+		_, err = fw.Write([]byte("some data"))
+		require.NoError(t, err)
+		require.NoError(t, fw.Close())
+	}
+
+	file, err := fs.Open("results.json.gz")
+	require.NoError(t, err)
+	gzReader, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(gzReader)
+	require.NoError(t, err)
+	assert.Equal(t, "some data", string(data))
+
+	file, err = fs.Open("results.json.zst")
+	require.NoError(t, err)
+	zstdReader, err := zstd.NewReader(file)
+	require.NoError(t, err)
+	defer zstdReader.Close()
+	data, err = ioutil.ReadAll(zstdReader)
+	require.NoError(t, err)
+	assert.Equal(t, "some data", string(data))
+}
+
+func TestRotatedFileName(t *testing.T) {
+	t.Parallel()
+	testCases := []struct {
+		filename string
+		index    int
+		expected string
+	}{
+		{"results.csv", 0, "results.csv"},
+		{"results.csv", 1, "results.1.csv"},
+		{"/tmp/out.json.gz", 12, "/tmp/out.12.json.gz"},
+		{"/tmp/my.dir/results", 2, "/tmp/my.dir/results.2"},
+		{".results", 3, ".results.3"},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, rotatedFileName(tc.filename, tc.index))
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]int64{
+		"100":    100,
+		"100B":   100,
+		"2KB":    2048,
+		"500MB":  500 << 20,
+		"1.5gb":  3 << 29,
+		" 1 TB ": 1 << 40,
+	}
+	for s, expected := range testCases {
+		n, err := ParseSize(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, n, s)
+	}
+	for _, s := range []string{"", "MB", "-1MB", "1PB", "abc"} {
+		_, err := ParseSize(s)
+		assert.Error(t, err, s)
+	}
+}
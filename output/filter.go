@@ -0,0 +1,304 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package output
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/lib/netext/httpext"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+)
+
+// FilterConfig specifies which metric samples an output receives and how
+// their tags are changed before that.
+type FilterConfig struct {
+	// Regular expressions for the names of the kept metrics, all metrics are
+	// kept if it's empty.
+	Metrics []string `json:"metrics"`
+	// Regular expressions for the names of the dropped metrics, they are
+	// dropped even if they are matched by Metrics.
+	DropMetrics []string `json:"dropMetrics"`
+
+	DropTags   []string          `json:"dropTags"`
+	RenameTags map[string]string `json:"renameTags"`
+
+	// The minimum time between the samples of the same time series of the
+	// given metrics, the samples in between are dropped.
+	Downsample map[string]types.Duration `json:"downsample"`
+}
+
+// A Filter drops and changes metric samples according to a FilterConfig.
+type Filter struct {
+	metrics     []*regexp.Regexp
+	dropMetrics []*regexp.Regexp
+	dropTags    map[string]bool
+	renameTags  map[string]string
+	downsample  map[string]time.Duration
+
+	// The times of the last kept samples of the downsampled time series
+	lastSampleTimes map[string]time.Time
+	// Caches whether the metrics with the given names are kept
+	keptMetrics map[string]bool
+}
+
+// NewFilter validates the given config and returns a new Filter for it.
+func NewFilter(conf FilterConfig) (*Filter, error) {
+	f := &Filter{
+		dropTags:        make(map[string]bool, len(conf.DropTags)),
+		renameTags:      conf.RenameTags,
+		downsample:      make(map[string]time.Duration, len(conf.Downsample)),
+		lastSampleTimes: make(map[string]time.Time),
+		keptMetrics:     make(map[string]bool),
+	}
+
+	var err error
+	if f.metrics, err = compileMetricPatterns(conf.Metrics); err != nil {
+		return nil, err
+	}
+	if f.dropMetrics, err = compileMetricPatterns(conf.DropMetrics); err != nil {
+		return nil, err
+	}
+	for _, tag := range conf.DropTags {
+		f.dropTags[tag] = true
+	}
+	for name, interval := range conf.Downsample {
+		if interval <= 0 {
+			return nil, fmt.Errorf("the downsample interval of '%s' must be positive but is %s", name, interval)
+		}
+		f.downsample[name] = time.Duration(interval)
+	}
+
+	return f, nil
+}
+
+func compileMetricPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	result := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid metric name pattern '%s': %w", pattern, err)
+		}
+		result = append(result, re)
+	}
+	return result, nil
+}
+
+// Apply returns the given sample containers without the dropped samples and
+// with the changed tags. Sample containers that are kept whole and unchanged
+// are returned as they are, the others are rebuilt with the kept samples,
+// keeping their type for HTTP and network trails and the other connected
+// containers, since outputs like the cloud one depend on it.
+//
+// It isn't safe for concurrent use, like Output.AddMetricSamples().
+func (f *Filter) Apply(containers []stats.SampleContainer) []stats.SampleContainer {
+	result := make([]stats.SampleContainer, 0, len(containers))
+	for _, container := range containers {
+		samples := container.GetSamples()
+		kept := make(stats.Samples, 0, len(samples))
+		changed := false
+		for _, sample := range samples {
+			if !f.keepsMetric(sample.Metric.Name) {
+				changed = true
+				continue
+			}
+			if tags, ok := f.changeTags(sample.Tags); ok {
+				sample.Tags = tags
+				changed = true
+			}
+			if !f.keepsSampleTime(sample) {
+				changed = true
+				continue
+			}
+			kept = append(kept, sample)
+		}
+
+		switch {
+		case !changed:
+			result = append(result, container)
+		case len(kept) > 0:
+			result = append(result, f.rebuild(container, kept))
+		}
+	}
+	return result
+}
+
+// rebuild returns a copy of the given changed sample container with only the
+// kept samples. The original container is never modified, since it's shared
+// with the other outputs. Outputs that read the fields of the trails instead
+// of their samples, like the cloud one, only see the changed tags.
+func (f *Filter) rebuild(container stats.SampleContainer, kept stats.Samples) stats.SampleContainer {
+	switch c := container.(type) {
+	case *httpext.Trail:
+		trail := *c
+		trail.Tags, _ = f.changeTags(c.Tags)
+		trail.Samples = kept
+		return &trail
+	case *netext.NetTrail:
+		trail := *c
+		trail.Tags, _ = f.changeTags(c.Tags)
+		trail.Samples = kept
+		return &trail
+	case stats.Sample:
+		return kept[0]
+	case stats.ConnectedSampleContainer:
+		tags, _ := f.changeTags(c.GetTags())
+		return stats.ConnectedSamples{Samples: kept, Tags: tags, Time: c.GetTime()}
+	default:
+		return kept
+	}
+}
+
+func (f *Filter) keepsMetric(name string) bool {
+	if kept, ok := f.keptMetrics[name]; ok {
+		return kept
+	}
+	kept := len(f.metrics) == 0
+	for _, re := range f.metrics {
+		if re.MatchString(name) {
+			kept = true
+			break
+		}
+	}
+	for _, re := range f.dropMetrics {
+		if re.MatchString(name) {
+			kept = false
+			break
+		}
+	}
+	f.keptMetrics[name] = kept
+	return kept
+}
+
+// changeTags returns the tags with the dropped and renamed ones, and whether
+// there was anything to change.
+func (f *Filter) changeTags(tags *stats.SampleTags) (*stats.SampleTags, bool) {
+	if tags == nil || (len(f.dropTags) == 0 && len(f.renameTags) == 0) {
+		return tags, false
+	}
+	original := tags.CloneTags()
+	changedTags := make(map[string]string, len(original))
+	changed := false
+	for k, v := range original {
+		if f.dropTags[k] {
+			changed = true
+			continue
+		}
+		if newKey, ok := f.renameTags[k]; ok {
+			k = newKey
+			changed = true
+		}
+		changedTags[k] = v
+	}
+	if !changed {
+		return tags, false
+	}
+	return stats.IntoSampleTags(&changedTags), true
+}
+
+// keepsSampleTime returns whether enough time has passed since the last kept
+// sample of the same time series, if its metric is downsampled.
+func (f *Filter) keepsSampleTime(sample stats.Sample) bool {
+	interval, ok := f.downsample[sample.Metric.Name]
+	if !ok {
+		return true
+	}
+	key := timeSeriesKey(sample)
+	if last, ok := f.lastSampleTimes[key]; ok && sample.Time.Sub(last) < interval {
+		return false
+	}
+	f.lastSampleTimes[key] = sample.Time
+	return true
+}
+
+func timeSeriesKey(sample stats.Sample) string {
+	var b strings.Builder
+	b.WriteString(sample.Metric.Name)
+	if sample.Tags == nil {
+		return b.String()
+	}
+	tags := sample.Tags.CloneTags()
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		b.WriteByte(0)
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+	}
+	return b.String()
+}
+
+// WithFilter wraps the given output, so it only receives the metric samples
+// that are kept by a Filter for the given config. The wrapper passes through
+// the thresholds, the run status and the test run stop callback, if the
+// output wants them.
+func WithFilter(out Output, conf FilterConfig) (Output, error) {
+	filter, err := NewFilter(conf)
+	if err != nil {
+		return nil, err
+	}
+	return &filteredOutput{Output: out, filter: filter}, nil
+}
+
+type filteredOutput struct {
+	Output
+	filter *Filter
+}
+
+var _ interface {
+	WithThresholds
+	WithTestRunStop
+	WithRunStatusUpdates
+} = &filteredOutput{}
+
+func (fo *filteredOutput) AddMetricSamples(containers []stats.SampleContainer) {
+	if filtered := fo.filter.Apply(containers); len(filtered) > 0 {
+		fo.Output.AddMetricSamples(filtered)
+	}
+}
+
+func (fo *filteredOutput) SetThresholds(thresholds map[string]stats.Thresholds) {
+	if out, ok := fo.Output.(WithThresholds); ok {
+		out.SetThresholds(thresholds)
+	}
+}
+
+func (fo *filteredOutput) SetTestRunStopCallback(callback func(error)) {
+	if out, ok := fo.Output.(WithTestRunStop); ok {
+		out.SetTestRunStopCallback(callback)
+	}
+}
+
+func (fo *filteredOutput) SetRunStatus(latestStatus lib.RunStatus) {
+	if out, ok := fo.Output.(WithRunStatusUpdates); ok {
+		out.SetRunStatus(latestStatus)
+	}
+}
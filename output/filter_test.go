@@ -0,0 +1,210 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package output
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/netext"
+	"github.com/loadimpact/k6/lib/netext/httpext"
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/stats"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterMetrics(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	tags := stats.NewSampleTags(map[string]string{"url": "http://test"})
+	newSample := func(metric *stats.Metric) stats.Sample {
+		return stats.Sample{Time: now, Metric: metric, Value: 1, Tags: tags}
+	}
+	duration := newSample(stats.New("http_req_duration", stats.Trend, stats.Time))
+	waiting := newSample(stats.New("http_req_waiting", stats.Trend, stats.Time))
+	checks := newSample(stats.New("checks", stats.Rate))
+	vus := newSample(stats.New("vus", stats.Gauge))
+
+	filter, err := NewFilter(FilterConfig{
+		Metrics:     []string{"http_req_.*", "checks"},
+		DropMetrics: []string{"http_req_waiting"},
+	})
+	require.NoError(t, err)
+
+	connected := stats.ConnectedSamples{Samples: []stats.Sample{duration, waiting}, Time: now}
+	unchanged := stats.ConnectedSamples{Samples: []stats.Sample{duration, checks}, Time: now}
+	assert.Equal(t,
+		[]stats.SampleContainer{
+			checks, stats.ConnectedSamples{Samples: []stats.Sample{duration}, Time: now}, unchanged,
+		},
+		filter.Apply([]stats.SampleContainer{checks, vus, connected, unchanged, waiting}),
+	)
+}
+
+func TestFilterTags(t *testing.T) {
+	t.Parallel()
+	metric := stats.New("my_metric", stats.Counter)
+	sample := stats.Sample{
+		Time:   time.Now(),
+		Metric: metric,
+		Value:  1,
+		Tags:   stats.NewSampleTags(map[string]string{"url": "http://test", "name": "test", "vu": "1"}),
+	}
+
+	filter, err := NewFilter(FilterConfig{
+		DropTags:   []string{"vu"},
+		RenameTags: map[string]string{"name": "endpoint"},
+	})
+	require.NoError(t, err)
+
+	result := filter.Apply([]stats.SampleContainer{sample})
+	require.Len(t, result, 1)
+	samples := result[0].GetSamples()
+	require.Len(t, samples, 1)
+	assert.Equal(t, map[string]string{"url": "http://test", "endpoint": "test"}, samples[0].Tags.CloneTags())
+	assert.Equal(t, map[string]string{"url": "http://test", "name": "test", "vu": "1"}, sample.Tags.CloneTags())
+}
+
+func TestFilterKeepsContainerTypes(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	tags := stats.NewSampleTags(map[string]string{"url": "http://test", "vu": "1"})
+	trail := &httpext.Trail{EndTime: now, Duration: time.Second}
+	trail.SaveSamples(tags)
+	netTrail := &netext.NetTrail{EndTime: now, Tags: tags, Samples: []stats.Sample{
+		{Time: now, Metric: metrics.DataSent, Value: 1, Tags: tags},
+		{Time: now, Metric: metrics.DataReceived, Value: 2, Tags: tags},
+	}}
+	connected := stats.ConnectedSamples{Time: now, Tags: tags, Samples: []stats.Sample{
+		{Time: now, Metric: metrics.Iterations, Value: 1, Tags: tags},
+		{Time: now, Metric: metrics.IterationDuration, Value: 2, Tags: tags},
+	}}
+
+	filter, err := NewFilter(FilterConfig{
+		DropMetrics: []string{"http_req_blocked", "data_sent", "iteration_duration"},
+		DropTags:    []string{"vu"},
+	})
+	require.NoError(t, err)
+
+	result := filter.Apply([]stats.SampleContainer{trail, netTrail, connected})
+	require.Len(t, result, 3)
+	expTags := map[string]string{"url": "http://test"}
+
+	filteredTrail, ok := result[0].(*httpext.Trail)
+	require.True(t, ok)
+	assert.False(t, trail == filteredTrail)
+	assert.Equal(t, time.Second, filteredTrail.Duration)
+	assert.Equal(t, expTags, filteredTrail.Tags.CloneTags())
+	assert.Len(t, filteredTrail.Samples, len(trail.Samples)-1)
+	for _, sample := range filteredTrail.Samples {
+		assert.NotEqual(t, "http_req_blocked", sample.Metric.Name)
+		assert.Equal(t, expTags, sample.Tags.CloneTags())
+	}
+	assert.Len(t, trail.Samples, 9)
+	assert.Equal(t, tags, trail.Tags)
+
+	filteredNetTrail, ok := result[1].(*netext.NetTrail)
+	require.True(t, ok)
+	assert.Equal(t, expTags, filteredNetTrail.Tags.CloneTags())
+	require.Len(t, filteredNetTrail.Samples, 1)
+	assert.Equal(t, "data_received", filteredNetTrail.Samples[0].Metric.Name)
+	assert.Len(t, netTrail.Samples, 2)
+
+	filteredConnected, ok := result[2].(stats.ConnectedSamples)
+	require.True(t, ok)
+	assert.Equal(t, now, filteredConnected.Time)
+	assert.Equal(t, expTags, filteredConnected.Tags.CloneTags())
+	require.Len(t, filteredConnected.Samples, 1)
+	assert.Equal(t, "iterations", filteredConnected.Samples[0].Metric.Name)
+}
+
+func TestFilterDownsample(t *testing.T) {
+	t.Parallel()
+	var conf FilterConfig
+	require.NoError(t, json.Unmarshal([]byte(`{"downsample": {"vus": "1s"}}`), &conf))
+	filter, err := NewFilter(conf)
+	require.NoError(t, err)
+
+	vus := stats.New("vus", stats.Gauge)
+	iterations := stats.New("iterations", stats.Counter)
+	start := time.Now()
+	newSample := func(metric *stats.Metric, offset time.Duration, scenario string) stats.Sample {
+		return stats.Sample{
+			Time:   start.Add(offset),
+			Metric: metric,
+			Value:  1,
+			Tags:   stats.NewSampleTags(map[string]string{"scenario": scenario}),
+		}
+	}
+
+	containers := []stats.SampleContainer{
+		newSample(vus, 0, "a"),
+		newSample(vus, 100*time.Millisecond, "b"),
+		newSample(vus, 500*time.Millisecond, "a"),
+		newSample(iterations, 500*time.Millisecond, "a"),
+		newSample(vus, 1000*time.Millisecond, "a"),
+		newSample(vus, 1000*time.Millisecond, "b"),
+		newSample(vus, 1200*time.Millisecond, "b"),
+	}
+	expected := []stats.SampleContainer{containers[0], containers[1], containers[3], containers[4], containers[6]}
+	assert.Equal(t, expected, filter.Apply(containers))
+
+	_, err = NewFilter(FilterConfig{Downsample: map[string]types.Duration{"vus": 0}})
+	assert.EqualError(t, err, "the downsample interval of 'vus' must be positive but is 0s")
+	_, err = NewFilter(FilterConfig{Metrics: []string{"http_req_("}})
+	assert.Error(t, err)
+}
+
+type thresholdsOutput struct {
+	SampleBuffer
+	thresholds map[string]stats.Thresholds
+}
+
+func (o *thresholdsOutput) Description() string { return "test" }
+func (o *thresholdsOutput) Start() error        { return nil }
+func (o *thresholdsOutput) Stop() error         { return nil }
+func (o *thresholdsOutput) SetThresholds(thresholds map[string]stats.Thresholds) {
+	o.thresholds = thresholds
+}
+
+func TestWithFilter(t *testing.T) {
+	t.Parallel()
+	inner := &thresholdsOutput{}
+	out, err := WithFilter(inner, FilterConfig{Metrics: []string{"checks"}})
+	require.NoError(t, err)
+
+	thresholds := map[string]stats.Thresholds{"checks": {}}
+	out.(WithThresholds).SetThresholds(thresholds)
+	assert.Equal(t, thresholds, inner.thresholds)
+	// The inner output doesn't want these, so they are just ignored
+	out.(WithRunStatusUpdates).SetRunStatus(lib.RunStatusRunning)
+	out.(WithTestRunStop).SetTestRunStopCallback(func(error) {})
+
+	checks := stats.Sample{Time: time.Now(), Metric: stats.New("checks", stats.Rate), Value: 1}
+	vus := stats.Sample{Time: time.Now(), Metric: stats.New("vus", stats.Gauge), Value: 1}
+	out.AddMetricSamples([]stats.SampleContainer{vus})
+	out.AddMetricSamples([]stats.SampleContainer{checks, vus})
+	assert.Equal(t, []stats.SampleContainer{checks}, inner.GetBufferedSamples())
+}
@@ -23,6 +23,7 @@ package output
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/loadimpact/k6/stats"
@@ -35,6 +36,8 @@ import (
 type SampleBuffer struct {
 	sync.Mutex
 	buffer []stats.SampleContainer
+	// A released buffer, whose backing array can be reused
+	spare  []stats.SampleContainer
 	maxLen int
 }
 
@@ -64,11 +67,40 @@ func (sc *SampleBuffer) GetBufferedSamples() []stats.SampleContainer {
 	}
 	// Make the new buffer halfway between the previously allocated size and the
 	// maximum buffer size we've seen so far, to hopefully reduce copying a bit.
-	sc.buffer = make([]stats.SampleContainer, 0, (bufferedLen+sc.maxLen)/2)
+	// If a previously released buffer is big enough, reuse it instead.
+	newCap := (bufferedLen + sc.maxLen) / 2
+	if cap(sc.spare) >= newCap {
+		sc.buffer, sc.spare = sc.spare, nil
+	} else {
+		sc.buffer = make([]stats.SampleContainer, 0, newCap)
+	}
 
 	return buffered
 }
 
+// ReleaseBufferedSamples can optionally be called by outputs once they have
+// completely finished processing a slice returned by GetBufferedSamples(). It
+// allows the backing array of the slice to be reused for the next buffer, which
+// saves growing a new one for outputs that are flushed very frequently. Only
+// the slice is reused: the sample containers, the samples and their tags are
+// not pooled and are still allocated by the code that emits them. The
+// released slice and its elements must not be accessed after this call.
+func (sc *SampleBuffer) ReleaseBufferedSamples(buffered []stats.SampleContainer) {
+	if cap(buffered) == 0 {
+		return
+	}
+	// Clear the references, so the sample containers can be garbage collected
+	for i := range buffered {
+		buffered[i] = nil
+	}
+
+	sc.Lock()
+	if cap(buffered) > cap(sc.spare) {
+		sc.spare = buffered[:0]
+	}
+	sc.Unlock()
+}
+
 // PeriodicFlusher is a small helper for asynchronously flushing buffered metric
 // samples on regular intervals. The biggest benefit is having a Stop() method
 // that waits for one last flush before it returns.
@@ -123,3 +155,161 @@ func NewPeriodicFlusher(period time.Duration, flushCallback func()) (*PeriodicFl
 
 	return pf, nil
 }
+
+// BatchConfig describes when a Batcher should flush its buffered samples. A
+// flush is triggered as soon as any of the limits is reached. MaxLatency is
+// mandatory, since it guarantees that samples don't stay in the buffer
+// indefinitely, while zero values for MaxSamples and MaxBytes disable them.
+type BatchConfig struct {
+	MaxSamples int
+	MaxBytes   int
+	MaxLatency time.Duration
+
+	// SampleSize should return the approximate number of bytes the given
+	// sample will occupy once it's encoded by the output. If it's nil and
+	// MaxBytes is set, DefaultSampleSize is used.
+	SampleSize func(stats.Sample) int
+}
+
+// DefaultSampleSize is a rough estimate of the encoded size of a sample, used
+// by outputs that don't have a better way to calculate it.
+func DefaultSampleSize(s stats.Sample) int {
+	const overhead = 64 // for the value, the timestamp and the separators
+	return overhead + len(s.Metric.Name) + s.Tags.ByteLen()
+}
+
+// Batcher is a SampleBuffer that asynchronously flushes the buffered samples
+// when either of the limits in its BatchConfig is reached. It allows users to
+// tune the throughput vs freshness trade-off of every output that uses it.
+type Batcher struct {
+	SampleBuffer
+
+	config        BatchConfig
+	samples       int64
+	bytes         int64
+	flushCallback func()
+	full          chan struct{}
+	stop          chan struct{}
+	stopped       chan struct{}
+	once          *sync.Once
+
+	startedMu sync.Mutex
+	started   bool
+}
+
+// NewBatcher validates the given config and returns a new Batcher. Samples
+// can be added to it straight away, but they will not be flushed until
+// Start() is called.
+func NewBatcher(conf BatchConfig) (*Batcher, error) {
+	if conf.MaxLatency <= 0 {
+		return nil, fmt.Errorf("metric batch max latency should be positive but was %s", conf.MaxLatency)
+	}
+	if conf.MaxSamples < 0 {
+		return nil, fmt.Errorf("metric batch max samples should not be negative but was %d", conf.MaxSamples)
+	}
+	if conf.MaxBytes < 0 {
+		return nil, fmt.Errorf("metric batch max bytes should not be negative but was %d", conf.MaxBytes)
+	}
+	if conf.MaxBytes > 0 && conf.SampleSize == nil {
+		conf.SampleSize = DefaultSampleSize
+	}
+
+	return &Batcher{
+		config:  conf,
+		full:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		stopped: make(chan struct{}),
+		once:    &sync.Once{},
+	}, nil
+}
+
+// AddMetricSamples adds the given metric samples to the internal buffer and
+// notifies the flushing goroutine if that made the batch full.
+func (b *Batcher) AddMetricSamples(samples []stats.SampleContainer) {
+	if len(samples) == 0 {
+		return
+	}
+	b.SampleBuffer.AddMetricSamples(samples)
+
+	if b.config.MaxSamples == 0 && b.config.MaxBytes == 0 {
+		return
+	}
+	var count, size int
+	for _, sc := range samples {
+		samples := sc.GetSamples()
+		count += len(samples)
+		if b.config.MaxBytes > 0 {
+			for _, s := range samples {
+				size += b.config.SampleSize(s)
+			}
+		}
+	}
+	count64 := atomic.AddInt64(&b.samples, int64(count))
+	size64 := atomic.AddInt64(&b.bytes, int64(size))
+	if (b.config.MaxSamples > 0 && count64 >= int64(b.config.MaxSamples)) ||
+		(b.config.MaxBytes > 0 && size64 >= int64(b.config.MaxBytes)) {
+		select {
+		case b.full <- struct{}{}:
+		default: // a flush is already pending
+		}
+	}
+}
+
+// GetBufferedSamples returns the currently buffered metric samples and resets
+// the batch limit counters.
+func (b *Batcher) GetBufferedSamples() []stats.SampleContainer {
+	atomic.StoreInt64(&b.samples, 0)
+	atomic.StoreInt64(&b.bytes, 0)
+	return b.SampleBuffer.GetBufferedSamples()
+}
+
+func (b *Batcher) run() {
+	ticker := time.NewTicker(b.config.MaxLatency)
+	defer func() {
+		// The ticker is replaced after early flushes
+		ticker.Stop()
+	}()
+	for {
+		select {
+		case <-ticker.C:
+			b.flushCallback()
+		case <-b.full:
+			b.flushCallback()
+			// The batch was flushed early, so give the next one the full
+			// latency budget.
+			ticker.Stop()
+			ticker = time.NewTicker(b.config.MaxLatency)
+		case <-b.stop:
+			b.flushCallback()
+			close(b.stopped)
+			return
+		}
+	}
+}
+
+// Start starts the goroutine that calls the given function every time a batch
+// should be flushed. The function is never called concurrently and it should
+// use GetBufferedSamples() to get the batch.
+func (b *Batcher) Start(flushCallback func()) {
+	b.startedMu.Lock()
+	defer b.startedMu.Unlock()
+	b.flushCallback = flushCallback
+	b.started = true
+	go b.run()
+}
+
+// Stop waits for the batcher to flush one last time and exit. Just like with
+// the PeriodicFlusher, it's safe to call Stop() multiple times, but it can't
+// be called from the flushing function. If the batcher was never started, it
+// just returns, without flushing the buffered samples.
+func (b *Batcher) Stop() {
+	b.once.Do(func() {
+		close(b.stop)
+	})
+	b.startedMu.Lock()
+	started := b.started
+	b.startedMu.Unlock()
+	if started {
+		<-b.stopped
+	}
+}
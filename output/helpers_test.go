@@ -62,6 +62,37 @@ func TestSampleBufferBasics(t *testing.T) {
 	assert.Empty(t, buffer.GetBufferedSamples())
 }
 
+func TestSampleBufferRelease(t *testing.T) {
+	t.Parallel()
+	single := stats.Sample{
+		Time:   time.Now(),
+		Metric: stats.New("my_metric", stats.Counter),
+		Value:  float64(1),
+	}
+	buffer := SampleBuffer{}
+
+	buffer.AddMetricSamples([]stats.SampleContainer{single, single, single, single})
+	first := buffer.GetBufferedSamples()
+	require.Len(t, first, 4)
+	firstCap := cap(first)
+
+	buffer.ReleaseBufferedSamples(first)
+	for _, sc := range first[:cap(first)] {
+		assert.Nil(t, sc)
+	}
+
+	// The current buffer has a smaller capacity than the released one, so the
+	// released slice should be reused on the next call.
+	buffer.AddMetricSamples([]stats.SampleContainer{single})
+	second := buffer.GetBufferedSamples()
+	assert.Equal(t, []stats.SampleContainer{single}, second)
+	assert.Equal(t, firstCap, cap(buffer.buffer))
+	assert.Nil(t, buffer.spare)
+
+	buffer.ReleaseBufferedSamples(nil)
+	assert.Nil(t, buffer.spare)
+}
+
 func TestSampleBufferConcurrently(t *testing.T) {
 	t.Parallel()
 
@@ -181,3 +212,121 @@ func TestPeriodicFlusherConcurrency(t *testing.T) {
 	stopWG.Wait()
 	assert.True(t, count >= 101) // due to the short intervals, we might not get exactly 101
 }
+
+func TestBatcher(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewBatcher(BatchConfig{})
+	assert.Error(t, err)
+	_, err = NewBatcher(BatchConfig{MaxLatency: time.Second, MaxSamples: -1})
+	assert.Error(t, err)
+	_, err = NewBatcher(BatchConfig{MaxLatency: time.Second, MaxBytes: -1})
+	assert.Error(t, err)
+
+	single := stats.Sample{
+		Time:   time.Now(),
+		Metric: stats.New("my_metric", stats.Counter),
+		Value:  float64(1),
+		Tags:   stats.NewSampleTags(map[string]string{"tag1": "val1"}),
+	}
+	connected := stats.ConnectedSamples{Samples: []stats.Sample{single, single}, Time: single.Time}
+
+	t.Run("MaxSamples", func(t *testing.T) {
+		t.Parallel()
+		b, err := NewBatcher(BatchConfig{MaxLatency: time.Hour, MaxSamples: 3})
+		require.NoError(t, err)
+		flushed := make(chan []stats.SampleContainer, 10)
+		b.Start(func() {
+			if samples := b.GetBufferedSamples(); len(samples) > 0 {
+				flushed <- samples
+			}
+		})
+
+		b.AddMetricSamples([]stats.SampleContainer{single})
+		b.AddMetricSamples([]stats.SampleContainer{connected})
+		select {
+		case samples := <-flushed:
+			assert.Equal(t, []stats.SampleContainer{single, connected}, samples)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the batch wasn't flushed")
+		}
+
+		b.AddMetricSamples([]stats.SampleContainer{single})
+		b.Stop()
+		require.Len(t, flushed, 1)
+		assert.Equal(t, []stats.SampleContainer{single}, <-flushed)
+	})
+
+	t.Run("MaxBytes", func(t *testing.T) {
+		t.Parallel()
+		b, err := NewBatcher(BatchConfig{
+			MaxLatency: time.Hour,
+			MaxBytes:   100,
+			SampleSize: func(stats.Sample) int { return 50 },
+		})
+		require.NoError(t, err)
+		flushed := make(chan []stats.SampleContainer, 10)
+		b.Start(func() {
+			if samples := b.GetBufferedSamples(); len(samples) > 0 {
+				flushed <- samples
+			}
+		})
+		defer b.Stop()
+
+		b.AddMetricSamples([]stats.SampleContainer{single, single})
+		select {
+		case samples := <-flushed:
+			assert.Equal(t, []stats.SampleContainer{single, single}, samples)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the batch wasn't flushed")
+		}
+	})
+
+	t.Run("MaxLatency", func(t *testing.T) {
+		t.Parallel()
+		b, err := NewBatcher(BatchConfig{MaxLatency: 10 * time.Millisecond, MaxSamples: 1000})
+		require.NoError(t, err)
+		flushed := make(chan []stats.SampleContainer, 10)
+		b.Start(func() {
+			if samples := b.GetBufferedSamples(); len(samples) > 0 {
+				flushed <- samples
+			}
+		})
+		defer b.Stop()
+
+		b.AddMetricSamples([]stats.SampleContainer{single})
+		select {
+		case samples := <-flushed:
+			assert.Equal(t, []stats.SampleContainer{single}, samples)
+		case <-time.After(5 * time.Second):
+			t.Fatal("the batch wasn't flushed")
+		}
+	})
+
+	t.Run("StopWithoutStart", func(t *testing.T) {
+		t.Parallel()
+		b, err := NewBatcher(BatchConfig{MaxLatency: time.Hour})
+		require.NoError(t, err)
+		b.AddMetricSamples([]stats.SampleContainer{single})
+
+		stopped := make(chan struct{})
+		go func() {
+			b.Stop()
+			b.Stop()
+			close(stopped)
+		}()
+		select {
+		case <-stopped:
+		case <-time.After(5 * time.Second):
+			t.Fatal("Stop() blocked")
+		}
+	})
+}
+
+func TestDefaultSampleSize(t *testing.T) {
+	t.Parallel()
+	s := stats.Sample{Metric: stats.New("abc", stats.Counter)}
+	assert.Equal(t, 67, DefaultSampleSize(s))
+	s.Tags = stats.NewSampleTags(map[string]string{"key": "value"})
+	assert.Equal(t, 75, DefaultSampleSize(s))
+}
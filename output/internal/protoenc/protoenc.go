@@ -0,0 +1,155 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package protoenc has the helpers for encoding and decoding protobuf messages
+// directly with protowire, which the outputs use so that they don't need any
+// generated code.
+package protoenc
+
+import (
+	"math"
+	"sort"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// The Append functions always encode the field, even if it has its default
+// value, since that's required for oneof and optional fields.
+
+// AppendMessage appends an embedded message field with the given encoded message.
+func AppendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
+
+// AppendBytes appends a bytes field.
+func AppendBytes(b []byte, num protowire.Number, v []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, v)
+}
+
+// AppendString appends a string field.
+func AppendString(b []byte, num protowire.Number, s string) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, s)
+}
+
+// AppendVarint appends a varint field, e.g. an uint64 or an enum.
+func AppendVarint(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, v)
+}
+
+// AppendSint appends a zigzag encoded varint field, i.e. a sint32 or a sint64.
+func AppendSint(b []byte, num protowire.Number, v int64) []byte {
+	return AppendVarint(b, num, protowire.EncodeZigZag(v))
+}
+
+// AppendFixed64 appends a fixed64 field.
+func AppendFixed64(b []byte, num protowire.Number, v uint64) []byte {
+	b = protowire.AppendTag(b, num, protowire.Fixed64Type)
+	return protowire.AppendFixed64(b, v)
+}
+
+// AppendDouble appends a double field.
+func AppendDouble(b []byte, num protowire.Number, v float64) []byte {
+	return AppendFixed64(b, num, math.Float64bits(v))
+}
+
+// AppendMap appends a map<string, string> field, with the keys sorted so that
+// the output is stable.
+func AppendMap(b []byte, num protowire.Number, m map[string]string) []byte {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var entry []byte
+	for _, k := range keys {
+		entry = AppendString(entry[:0], 1, k)
+		entry = AppendString(entry, 2, m[k])
+		b = AppendMessage(b, num, entry)
+	}
+	return b
+}
+
+// DecodeMapEntry decodes an entry of a map<string, string> field into m, which
+// is created if it's nil, and returns it.
+func DecodeMapEntry(m map[string]string, b []byte) (map[string]string, error) {
+	var key, value string
+	err := DecodeFields(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			key = string(v)
+		case 2:
+			value = string(v)
+		}
+		return nil
+	})
+	if m == nil {
+		m = make(map[string]string)
+	}
+	m[key] = value
+	return m, err
+}
+
+// DecodeFields calls fn with the number and the raw value of every field in
+// the message. Varint and fixed64 values are passed in their encoded form.
+func DecodeFields(b []byte, fn func(protowire.Number, []byte) error) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		var v []byte
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		default:
+			n = protowire.ConsumeFieldValue(num, typ, b)
+			if n >= 0 {
+				v = b[:n]
+			}
+		}
+		if n < 0 {
+			return protowire.ParseError(n)
+		}
+		b = b[n:]
+
+		if err := fn(num, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DecodeVarint decodes the raw value of a varint field.
+func DecodeVarint(b []byte) uint64 {
+	v, _ := protowire.ConsumeVarint(b)
+	return v
+}
+
+// DecodeFixed64 decodes the raw value of a fixed64 field.
+func DecodeFixed64(b []byte) uint64 {
+	v, _ := protowire.ConsumeFixed64(b)
+	return v
+}
@@ -21,29 +21,31 @@
 package json
 
 import (
-	"compress/gzip"
 	stdlibjson "encoding/json"
 	"fmt"
-	"strings"
+	"strconv"
 	"time"
 
+	"github.com/loadimpact/k6/lib/types"
 	"github.com/loadimpact/k6/output"
 	"github.com/loadimpact/k6/stats"
 	"github.com/sirupsen/logrus"
 )
 
 // TODO: add option for emitting proper JSON files (https://github.com/loadimpact/k6/issues/737)
-const flushPeriod = 200 * time.Millisecond // TODO: make this configurable
+const defaultFlushPeriod = 200 * time.Millisecond
 
-// Output funnels all passed metrics to an (optionally gzipped) JSON file.
+// Output funnels all passed metrics to an (optionally compressed and rotated)
+// JSON file.
 type Output struct {
-	output.SampleBuffer
+	*output.Batcher
 
-	params          output.Params
-	periodicFlusher *output.PeriodicFlusher
+	params output.Params
 
 	logger      logrus.FieldLogger
 	filename    string
+	fileConf    output.FileWriterConfig
+	file        *output.FileWriter
 	encoder     *stdlibjson.Encoder
 	closeFn     func() error
 	seenMetrics map[string]struct{}
@@ -52,9 +54,23 @@ type Output struct {
 
 // New returns a new JSON output.
 func New(params output.Params) (output.Output, error) {
+	batchConf, err := getBatchConfig(params.Environment)
+	if err != nil {
+		return nil, err
+	}
+	fileConf, err := getFileWriterConfig(params.Environment)
+	if err != nil {
+		return nil, err
+	}
+	batcher, err := output.NewBatcher(batchConf)
+	if err != nil {
+		return nil, err
+	}
 	return &Output{
+		Batcher:  batcher,
 		params:   params,
 		filename: params.ConfigArgument,
+		fileConf: fileConf,
 		logger: params.Logger.WithFields(logrus.Fields{
 			"output":   "json",
 			"filename": params.ConfigArgument,
@@ -63,6 +79,55 @@ func New(params output.Params) (output.Output, error) {
 	}, nil
 }
 
+// getBatchConfig reads the K6_JSON_BATCH_* environment variables, which
+// control how often the buffered samples are written to the file.
+func getBatchConfig(env map[string]string) (output.BatchConfig, error) {
+	conf := output.BatchConfig{MaxLatency: defaultFlushPeriod}
+	if v, ok := env["K6_JSON_BATCH_MAX_SAMPLES"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return conf, fmt.Errorf("invalid K6_JSON_BATCH_MAX_SAMPLES value '%s': %w", v, err)
+		}
+		conf.MaxSamples = n
+	}
+	if v, ok := env["K6_JSON_BATCH_MAX_BYTES"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return conf, fmt.Errorf("invalid K6_JSON_BATCH_MAX_BYTES value '%s': %w", v, err)
+		}
+		conf.MaxBytes = n
+	}
+	if v, ok := env["K6_JSON_BATCH_MAX_LATENCY"]; ok {
+		d, err := types.ParseExtendedDuration(v)
+		if err != nil {
+			return conf, fmt.Errorf("invalid K6_JSON_BATCH_MAX_LATENCY value '%s': %w", v, err)
+		}
+		conf.MaxLatency = d
+	}
+	return conf, nil
+}
+
+// getFileWriterConfig reads the K6_JSON_ROTATE_* environment variables, which
+// control when a new JSON file is started.
+func getFileWriterConfig(env map[string]string) (output.FileWriterConfig, error) {
+	conf := output.FileWriterConfig{}
+	if v, ok := env["K6_JSON_ROTATE_SIZE"]; ok {
+		n, err := output.ParseSize(v)
+		if err != nil {
+			return conf, fmt.Errorf("invalid K6_JSON_ROTATE_SIZE value '%s': %w", v, err)
+		}
+		conf.MaxSize = n
+	}
+	if v, ok := env["K6_JSON_ROTATE_INTERVAL"]; ok {
+		d, err := types.ParseExtendedDuration(v)
+		if err != nil {
+			return conf, fmt.Errorf("invalid K6_JSON_ROTATE_INTERVAL value '%s': %w", v, err)
+		}
+		conf.MaxAge = d
+	}
+	return conf, nil
+}
+
 // Description returns a human-readable description of the output.
 func (o *Output) Description() string {
 	if o.filename == "" || o.filename == "-" {
@@ -72,7 +137,8 @@ func (o *Output) Description() string {
 }
 
 // Start tries to open the specified JSON file and starts the goroutine for
-// metric flushing. If gzip encoding is specified, it also handles that.
+// metric flushing. If the file has a .gz or .zst extension, it's compressed
+// with gzip or zstd respectively.
 func (o *Output) Start() error {
 	o.logger.Debug("Starting...")
 
@@ -82,31 +148,17 @@ func (o *Output) Start() error {
 			return nil
 		}
 	} else {
-		logfile, err := o.params.FS.Create(o.filename)
+		file, err := output.NewFileWriter(o.params.FS, o.filename, o.fileConf)
 		if err != nil {
 			return err
 		}
-
-		if strings.HasSuffix(o.filename, ".gz") {
-			outfile := gzip.NewWriter(logfile)
-
-			o.closeFn = func() error {
-				_ = outfile.Close()
-				return logfile.Close()
-			}
-			o.encoder = stdlibjson.NewEncoder(outfile)
-		} else {
-			o.closeFn = logfile.Close
-			o.encoder = stdlibjson.NewEncoder(logfile)
-		}
+		o.file = file
+		o.closeFn = file.Close
+		o.encoder = stdlibjson.NewEncoder(file)
 	}
 
-	pf, err := output.NewPeriodicFlusher(flushPeriod, o.flushMetrics)
-	if err != nil {
-		return err
-	}
+	o.Batcher.Start(o.flushMetrics)
 	o.logger.Debug("Started!")
-	o.periodicFlusher = pf
 
 	return nil
 }
@@ -115,7 +167,7 @@ func (o *Output) Start() error {
 func (o *Output) Stop() error {
 	o.logger.Debug("Stopping...")
 	defer o.logger.Debug("Stopped!")
-	o.periodicFlusher.Stop()
+	o.Batcher.Stop()
 	return o.closeFn()
 }
 
@@ -148,6 +200,25 @@ func (o *Output) flushMetrics() {
 	}
 	if count > 0 {
 		o.logger.WithField("t", time.Since(start)).WithField("count", count).Debug("Wrote metrics to JSON")
+		o.rotate()
+	}
+	o.ReleaseBufferedSamples(samples)
+}
+
+// rotate starts a new file if the current one is too big or too old. Every
+// file gets its own metric definitions, so each one can be parsed by itself.
+func (o *Output) rotate() {
+	if o.file == nil {
+		return
+	}
+	rotated, err := o.file.Rotate()
+	if err != nil {
+		o.logger.WithError(err).Error("Couldn't rotate the JSON file")
+		return
+	}
+	if rotated {
+		o.logger.WithField("filename", o.file.Name()).Debug("Rotated the JSON file")
+		o.seenMetrics = make(map[string]struct{})
 	}
 }
 
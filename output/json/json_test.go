@@ -24,6 +24,7 @@ import (
 	"bufio"
 	"bytes"
 	"compress/gzip"
+	stdlibjson "encoding/json"
 	"io"
 	"testing"
 	"time"
@@ -55,6 +56,11 @@ func getValidator(t *testing.T, expected []string) func(io.Reader) {
 }
 
 func generateTestMetricSamples(t *testing.T) ([]stats.SampleContainer, func(io.Reader)) {
+	samples, expected := getTestMetricSamples()
+	return samples, getValidator(t, expected)
+}
+
+func getTestMetricSamples() ([]stats.SampleContainer, []string) {
 	metric1 := stats.New("my_metric1", stats.Gauge)
 	metric2 := stats.New("my_metric2", stats.Counter, stats.Data)
 	time1 := time.Date(2021, time.February, 24, 13, 37, 10, 0, time.UTC)
@@ -81,7 +87,7 @@ func generateTestMetricSamples(t *testing.T) ([]stats.SampleContainer, func(io.R
 		`{"type":"Point","data":{"time":"2021-02-24T13:37:30Z","value":5,"tags":{"tag3":"val3"}},"metric":"my_metric2"}`,
 	}
 
-	return samples, getValidator(t, expected)
+	return samples, expected
 }
 
 func TestJsonOutputStdout(t *testing.T) {
@@ -177,6 +183,53 @@ func TestJsonOutputFileGzipped(t *testing.T) {
 	assert.NoError(t, file.Close())
 }
 
+func TestJsonOutputFileRotated(t *testing.T) {
+	t.Parallel()
+
+	fs := afero.NewMemMapFs()
+	out, err := New(output.Params{
+		Logger:         testutils.NewLogger(t),
+		FS:             fs,
+		ConfigArgument: "/json-output.json",
+		Environment: map[string]string{
+			"K6_JSON_BATCH_MAX_SAMPLES": "2",
+			"K6_JSON_BATCH_MAX_LATENCY": "1h",
+			"K6_JSON_ROTATE_SIZE":       "1B",
+		},
+	})
+	require.NoError(t, err)
+
+	setThresholds(t, out)
+	require.NoError(t, out.Start())
+
+	samples, expected := getTestMetricSamples()
+	out.AddMetricSamples(samples[:2])
+	for i := 0; ; i++ {
+		require.True(t, i < 500, "the first file wasn't rotated")
+		info, err := fs.Stat("/json-output.json")
+		require.NoError(t, err)
+		if info.Size() > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	out.AddMetricSamples(samples[2:])
+	require.NoError(t, out.Stop())
+
+	validateFile := func(name string, expected []string) {
+		file, err := fs.Open(name)
+		require.NoError(t, err)
+		getValidator(t, expected)(file)
+		assert.NoError(t, file.Close())
+	}
+	validateFile("/json-output.json", expected[:3])
+	// The metric definitions are repeated in every file
+	validateFile("/json-output.1.json", []string{expected[3], expected[4], expected[0], expected[5], expected[6]})
+	exists, err := afero.Exists(fs, "/json-output.2.json")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
 func TestWrapSampleWithSamplePointer(t *testing.T) {
 	t.Parallel()
 	out := WrapSample(stats.Sample{
@@ -191,6 +244,15 @@ func TestWrapMetricWithMetricPointer(t *testing.T) {
 	assert.NotEqual(t, out, (*Envelope)(nil))
 }
 
+func TestWrapMetricMetadata(t *testing.T) {
+	t.Parallel()
+	metric := stats.New("upload_size", stats.Trend, stats.Data)
+	metric.Unit, metric.Description = "bytes", "The size of the uploaded files"
+	data, err := stdlibjson.Marshal(wrapMetric(metric))
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"unit":"bytes","description":"The size of the uploaded files"`)
+}
+
 func setThresholds(t *testing.T, out output.Output) {
 	t.Helper()
 
@@ -36,16 +36,18 @@ type Envelope struct {
 
 // Sample is the data format for metric sample data in the JSON file.
 type Sample struct {
-	Time  time.Time         `json:"time"`
-	Value float64           `json:"value"`
-	Tags  *stats.SampleTags `json:"tags"`
+	Time     time.Time         `json:"time"`
+	Value    float64           `json:"value"`
+	Tags     *stats.SampleTags `json:"tags"`
+	Exemplar *stats.Exemplar   `json:"exemplar,omitempty"`
 }
 
 func newJSONSample(sample stats.Sample) Sample {
 	return Sample{
-		Time:  sample.Time,
-		Value: sample.Value,
-		Tags:  sample.Tags,
+		Time:     sample.Time,
+		Value:    sample.Value,
+		Tags:     sample.Tags,
+		Exemplar: sample.Exemplar,
 	}
 }
 
@@ -0,0 +1,186 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package otlp
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/guregu/null.v3"
+
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// The supported values of Config.Protocol
+const (
+	protocolHTTP = "http/protobuf"
+	protocolGRPC = "grpc"
+)
+
+// The supported values of Config.Temporality
+const (
+	temporalityNameCumulative = "cumulative"
+	temporalityNameDelta      = "delta"
+)
+
+// Config is the config for the OTLP output.
+type Config struct {
+	// An URL like http://localhost:4318 for http/protobuf, where /v1/metrics
+	// is added if it has no path, or a host:port address for grpc.
+	Endpoint null.String `json:"endpoint" envconfig:"K6_OTLP_ENDPOINT"`
+	Protocol null.String `json:"protocol" envconfig:"K6_OTLP_PROTOCOL"`
+	// Whether grpc connections are made without TLS.
+	Insecure null.Bool          `json:"insecure" envconfig:"K6_OTLP_INSECURE"`
+	Headers  map[string]string  `json:"headers" envconfig:"K6_OTLP_HEADERS"`
+	Timeout  types.NullDuration `json:"timeout" envconfig:"K6_OTLP_TIMEOUT"`
+
+	ServiceName        null.String       `json:"serviceName" envconfig:"K6_OTLP_SERVICE_NAME"`
+	ResourceAttributes map[string]string `json:"resourceAttributes" envconfig:"K6_OTLP_RESOURCE_ATTRIBUTES"`
+	MetricPrefix       null.String       `json:"metricPrefix" envconfig:"K6_OTLP_METRIC_PREFIX"`
+
+	// Either cumulative or delta, for the sums and histograms.
+	Temporality null.String `json:"temporality" envconfig:"K6_OTLP_TEMPORALITY"`
+	// The explicit bucket bounds of the histograms of trend metrics.
+	HistogramBounds []float64 `json:"histogramBounds" envconfig:"K6_OTLP_HISTOGRAM_BOUNDS"`
+
+	PushInterval types.NullDuration `json:"pushInterval" envconfig:"K6_OTLP_PUSH_INTERVAL"`
+	// The maximum number of data points sent in a single export request.
+	MaxBatchSize null.Int `json:"maxBatchSize" envconfig:"K6_OTLP_MAX_BATCH_SIZE"`
+}
+
+// NewConfig creates a new Config instance with default values for some fields.
+func NewConfig() Config {
+	return Config{
+		Protocol:        null.NewString(protocolHTTP, false),
+		Timeout:         types.NewNullDuration(10*time.Second, false),
+		ServiceName:     null.NewString("k6", false),
+		MetricPrefix:    null.NewString("k6.", false),
+		Temporality:     null.NewString(temporalityNameCumulative, false),
+		HistogramBounds: []float64{0, 5, 10, 25, 50, 75, 100, 250, 500, 750, 1000, 2500, 5000, 7500, 10000},
+		PushInterval:    types.NewNullDuration(10*time.Second, false),
+		MaxBatchSize:    null.NewInt(1000, false),
+	}
+}
+
+// Apply saves the non-zero config values from the passed config in the receiver.
+func (c Config) Apply(cfg Config) Config {
+	if cfg.Endpoint.Valid {
+		c.Endpoint = cfg.Endpoint
+	}
+	if cfg.Protocol.Valid {
+		c.Protocol = cfg.Protocol
+	}
+	if cfg.Insecure.Valid {
+		c.Insecure = cfg.Insecure
+	}
+	if len(cfg.Headers) > 0 {
+		c.Headers = cfg.Headers
+	}
+	if cfg.Timeout.Valid {
+		c.Timeout = cfg.Timeout
+	}
+	if cfg.ServiceName.Valid {
+		c.ServiceName = cfg.ServiceName
+	}
+	if len(cfg.ResourceAttributes) > 0 {
+		c.ResourceAttributes = cfg.ResourceAttributes
+	}
+	if cfg.MetricPrefix.Valid {
+		c.MetricPrefix = cfg.MetricPrefix
+	}
+	if cfg.Temporality.Valid {
+		c.Temporality = cfg.Temporality
+	}
+	if len(cfg.HistogramBounds) > 0 {
+		c.HistogramBounds = cfg.HistogramBounds
+	}
+	if cfg.PushInterval.Valid {
+		c.PushInterval = cfg.PushInterval
+	}
+	if cfg.MaxBatchSize.Valid {
+		c.MaxBatchSize = cfg.MaxBatchSize
+	}
+	return c
+}
+
+// Validate checks the config values and fills in the default endpoint of the
+// protocol, if there isn't one.
+func (c *Config) Validate() error {
+	switch c.Protocol.String {
+	case protocolHTTP:
+		if c.Endpoint.String == "" {
+			c.Endpoint = null.NewString("http://localhost:4318", false)
+		}
+	case protocolGRPC:
+		if c.Endpoint.String == "" {
+			c.Endpoint = null.NewString("localhost:4317", false)
+		}
+	default:
+		return fmt.Errorf("invalid OTLP protocol '%s', it should be %s or %s", c.Protocol.String, protocolHTTP, protocolGRPC)
+	}
+
+	if t := c.Temporality.String; t != temporalityNameCumulative && t != temporalityNameDelta {
+		return fmt.Errorf("invalid OTLP temporality '%s', it should be %s or %s",
+			t, temporalityNameCumulative, temporalityNameDelta)
+	}
+	for i := 1; i < len(c.HistogramBounds); i++ {
+		if c.HistogramBounds[i] <= c.HistogramBounds[i-1] {
+			return fmt.Errorf("the OTLP histogram bounds should be increasing, but %g comes after %g",
+				c.HistogramBounds[i], c.HistogramBounds[i-1])
+		}
+	}
+	if !(c.PushInterval.Duration > 0) {
+		return fmt.Errorf("the OTLP push interval should be positive but is %s", c.PushInterval.Duration)
+	}
+	if !(c.MaxBatchSize.Int64 > 0) {
+		return fmt.Errorf("the OTLP max batch size should be positive but is %d", c.MaxBatchSize.Int64)
+	}
+	return nil
+}
+
+// GetConsolidatedConfig combines {default config values + JSON config +
+// environment vars + arg config values}, and returns the final result. The
+// arg is the endpoint, e.g. --out otlp=http://collector:4318.
+func GetConsolidatedConfig(jsonRawConf json.RawMessage, env map[string]string, arg string) (Config, error) {
+	result := NewConfig()
+	if jsonRawConf != nil {
+		jsonConf := Config{}
+		if err := json.Unmarshal(jsonRawConf, &jsonConf); err != nil {
+			return result, err
+		}
+		result = result.Apply(jsonConf)
+	}
+
+	envConfig := Config{}
+	if err := envconfig.Process("", &envConfig); err != nil {
+		// TODO: get rid of envconfig and actually use the env parameter...
+		return result, err
+	}
+	result = result.Apply(envConfig)
+
+	if arg != "" {
+		result.Endpoint = null.StringFrom(arg)
+	}
+
+	return result, result.Validate()
+}
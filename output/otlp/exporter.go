@@ -0,0 +1,165 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+const grpcExportMethod = "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export"
+
+// An exporter sends encoded ExportMetricsServiceRequest messages.
+type exporter interface {
+	export(ctx context.Context, request []byte) error
+	io.Closer
+}
+
+func newExporter(conf Config) (exporter, error) {
+	if conf.Protocol.String == protocolGRPC {
+		return newGRPCExporter(conf)
+	}
+	return newHTTPExporter(conf)
+}
+
+type httpExporter struct {
+	client  *http.Client
+	url     string
+	headers map[string]string
+}
+
+func newHTTPExporter(conf Config) (*httpExporter, error) {
+	u, err := url.Parse(conf.Endpoint.String)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("the OTLP endpoint should be an http or https URL, but is '%s'", conf.Endpoint.String)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/v1/metrics"
+	}
+	return &httpExporter{
+		client:  &http.Client{Timeout: time.Duration(conf.Timeout.Duration)},
+		url:     u.String(),
+		headers: conf.Headers,
+	}, nil
+}
+
+func (e *httpExporter) export(ctx context.Context, request []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.url, bytes.NewReader(request))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("the OTLP endpoint responded with %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+	return nil
+}
+
+func (e *httpExporter) Close() error {
+	e.client.CloseIdleConnections()
+	return nil
+}
+
+// rawCodec sends and receives already encoded protobuf messages. It's named
+// proto, so that the requests have the standard application/grpc+proto
+// content type.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+type grpcExporter struct {
+	conn    *grpc.ClientConn
+	timeout time.Duration
+	md      metadata.MD
+}
+
+func newGRPCExporter(conf Config) (*grpcExporter, error) {
+	creds := grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})) //nolint:gosec
+	if conf.Insecure.Bool {
+		creds = grpc.WithInsecure()
+	}
+	// This doesn't block, the connection is made with the first request
+	conn, err := grpc.Dial(conf.Endpoint.String, creds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	return &grpcExporter{
+		conn:    conn,
+		timeout: time.Duration(conf.Timeout.Duration),
+		md:      metadata.New(conf.Headers),
+	}, nil
+}
+
+func (e *grpcExporter) export(ctx context.Context, request []byte) error {
+	ctx, cancel := context.WithTimeout(metadata.NewOutgoingContext(ctx, e.md), e.timeout)
+	defer cancel()
+	var response []byte
+	return e.conn.Invoke(ctx, grpcExportMethod, &request, &response, grpc.ForceCodec(rawCodec{}))
+}
+
+func (e *grpcExporter) Close() error {
+	return e.conn.Close()
+}
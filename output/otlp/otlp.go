@@ -0,0 +1,398 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package otlp implements an output that sends the k6 metrics to an
+// OpenTelemetry collector, or anything else that accepts OTLP metrics, over
+// HTTP or gRPC.
+package otlp
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/lib/consts"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+// series holds the aggregated values of the samples of a metric with the
+// same tags since the start of the test or since the last export.
+type series struct {
+	metric     *stats.Metric
+	attributes []keyValue
+	start      time.Time
+	updated    bool
+
+	// The sum of counters and the last value of gauges
+	value float64
+
+	// The non-zero and all samples of rates
+	trues, total int64
+
+	// The histograms of trends
+	count        uint64
+	sum          float64
+	min, max     float64
+	bucketCounts []uint64
+
+	// The samples of histograms
+	histogram *stats.HistogramSink
+
+	// The exemplar of the sample with the largest value since the last
+	// export, if any of them was linked to a trace
+	exemplar *exemplar
+}
+
+// Output aggregates the metric samples on every push interval and sends them
+// as OTLP metrics. Counters are sent as monotonic sums, gauges and rates as
+// gauges, trends as histograms and histograms as exponential histograms.
+type Output struct {
+	output.SampleBuffer
+
+	config     Config
+	logger     logrus.FieldLogger
+	exporter   exporter
+	flusher    *output.PeriodicFlusher
+	resource   []keyValue
+	lastExport time.Time
+
+	// Only used by the flushing goroutine
+	series map[string]*series
+}
+
+// New returns a new OTLP output.
+func New(params output.Params) (output.Output, error) {
+	conf, err := GetConsolidatedConfig(params.JSONConfig, params.Environment, params.ConfigArgument)
+	if err != nil {
+		return nil, err
+	}
+	return newOutput(params, conf)
+}
+
+func newOutput(params output.Params, conf Config) (*Output, error) {
+	exporter, err := newExporter(conf)
+	if err != nil {
+		return nil, err
+	}
+
+	attributes := map[string]string{"service.name": conf.ServiceName.String}
+	for k, v := range conf.ResourceAttributes {
+		attributes[k] = v
+	}
+
+	return &Output{
+		config:   conf,
+		logger:   params.Logger.WithFields(logrus.Fields{"output": "otlp", "endpoint": conf.Endpoint.String}),
+		exporter: exporter,
+		resource: sortedKeyValues(attributes),
+		series:   make(map[string]*series),
+	}, nil
+}
+
+// Description returns a human-readable description of the output.
+func (o *Output) Description() string {
+	return fmt.Sprintf("otlp (%s)", o.config.Endpoint.String)
+}
+
+// Start starts the goroutine that periodically aggregates the buffered
+// samples and exports them.
+func (o *Output) Start() error {
+	o.logger.Debug("Starting...")
+	o.lastExport = time.Now()
+	pf, err := output.NewPeriodicFlusher(time.Duration(o.config.PushInterval.Duration), o.flushMetrics)
+	if err != nil {
+		return err
+	}
+	o.flusher = pf
+	o.logger.Debug("Started!")
+	return nil
+}
+
+// Stop exports the remaining samples and closes the connection.
+func (o *Output) Stop() error {
+	o.logger.Debug("Stopping...")
+	defer o.logger.Debug("Stopped!")
+	o.flusher.Stop()
+	return o.exporter.Close()
+}
+
+func (o *Output) flushMetrics() {
+	for _, sc := range o.GetBufferedSamples() {
+		for _, sample := range sc.GetSamples() {
+			o.addSample(sample)
+		}
+	}
+
+	now := time.Now()
+	metrics := o.collect(now)
+	o.lastExport = now
+
+	for _, batch := range splitBatches(metrics, int(o.config.MaxBatchSize.Int64)) {
+		request := encodeRequest(o.resource, "k6", consts.Version, batch)
+		if err := o.exporter.export(context.Background(), request); err != nil {
+			o.logger.WithError(err).Warn("Failed to export the metrics")
+			continue
+		}
+		o.logger.WithField("bytes", len(request)).Debug("Exported metrics")
+	}
+}
+
+func (o *Output) addSample(sample stats.Sample) {
+	var tags map[string]string
+	if sample.Tags != nil {
+		tags = sample.Tags.CloneTags()
+	}
+	attributes := sortedKeyValues(tags)
+	key := seriesKey(sample.Metric.Name, attributes)
+
+	s, ok := o.series[key]
+	if !ok {
+		s = &series{metric: sample.Metric, attributes: attributes, start: sample.Time}
+		if o.config.Temporality.String == temporalityNameDelta {
+			s.start = o.lastExport
+		}
+		switch sample.Metric.Type {
+		case stats.Trend:
+			s.bucketCounts = make([]uint64, len(o.config.HistogramBounds)+1)
+		case stats.Histogram:
+			s.histogram = &stats.HistogramSink{}
+		}
+		o.series[key] = s
+	}
+	s.updated = true
+
+	v := sample.Value
+	switch sample.Metric.Type {
+	case stats.Counter:
+		s.value += v
+	case stats.Gauge:
+		s.value = v
+	case stats.Rate:
+		if v != 0 {
+			s.trues++
+		}
+		s.total++
+	case stats.Trend:
+		if s.count == 0 || v < s.min {
+			s.min = v
+		}
+		if s.count == 0 || v > s.max {
+			s.max = v
+		}
+		s.count++
+		s.sum += v
+		s.bucketCounts[sort.SearchFloat64s(o.config.HistogramBounds, v)]++
+	case stats.Histogram:
+		s.histogram.Add(sample)
+	}
+
+	if sample.Exemplar != nil && (s.exemplar == nil || v >= s.exemplar.value) {
+		if e, ok := newExemplar(sample); ok {
+			s.exemplar = &e
+		}
+	}
+}
+
+// newExemplar returns the OTLP exemplar of a sample, if its trace and span IDs
+// are valid.
+func newExemplar(sample stats.Sample) (exemplar, bool) {
+	traceID, err := hex.DecodeString(sample.Exemplar.TraceID)
+	if err != nil || len(traceID) != 16 {
+		return exemplar{}, false
+	}
+	spanID, err := hex.DecodeString(sample.Exemplar.SpanID)
+	if err != nil || (len(spanID) != 0 && len(spanID) != 8) {
+		return exemplar{}, false
+	}
+	return exemplar{time: sample.Time, value: sample.Value, traceID: traceID, spanID: spanID}, true
+}
+
+// collect returns the current values of all series as OTLP metrics. With the
+// delta temporality, only the series updated since the last export are
+// returned and their values are reset.
+func (o *Output) collect(now time.Time) []metric {
+	delta := o.config.Temporality.String == temporalityNameDelta
+	temporality := temporalityCumulative
+	if delta {
+		temporality = temporalityDelta
+	}
+
+	keys := make([]string, 0, len(o.series))
+	for key, s := range o.series {
+		if delta && !s.updated {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var metrics []metric
+	indexes := make(map[string]int)
+	for _, key := range keys {
+		s := o.series[key]
+		i, ok := indexes[s.metric.Name]
+		if !ok {
+			i = len(metrics)
+			indexes[s.metric.Name] = i
+			metrics = append(metrics, o.newMetric(s.metric, temporality))
+		}
+
+		p := dataPoint{attributes: s.attributes, start: s.start, time: now}
+		switch s.metric.Type {
+		case stats.Counter, stats.Gauge:
+			p.value = s.value
+		case stats.Rate:
+			p.value = float64(s.trues) / float64(s.total)
+		case stats.Trend:
+			p.count, p.sum, p.min, p.max = s.count, s.sum, s.min, s.max
+			p.bucketCounts = append([]uint64(nil), s.bucketCounts...)
+			p.bounds = o.config.HistogramBounds
+		case stats.Histogram:
+			h := s.histogram
+			p.count, p.sum, p.min, p.max = h.Count, h.Sum, h.Min, h.Max
+			p.scale, p.zeroCount = h.Scale, h.ZeroCount
+			p.positive.offset, p.positive.counts = h.DenseBuckets(false)
+			p.negative.offset, p.negative.counts = h.DenseBuckets(true)
+		}
+		if s.exemplar != nil {
+			p.exemplars = []exemplar{*s.exemplar}
+		}
+		metrics[i].points = append(metrics[i].points, p)
+
+		s.updated = false
+		s.exemplar = nil
+		if delta {
+			s.start = now
+			if s.metric.Type != stats.Gauge {
+				s.value = 0
+			}
+			s.trues, s.total = 0, 0
+			s.count, s.sum, s.min, s.max = 0, 0, 0, 0
+			for j := range s.bucketCounts {
+				s.bucketCounts[j] = 0
+			}
+			if s.histogram != nil {
+				s.histogram = &stats.HistogramSink{}
+			}
+		}
+	}
+	return metrics
+}
+
+func (o *Output) newMetric(m *stats.Metric, temporality int) metric {
+	result := metric{
+		name:        o.config.MetricPrefix.String + m.Name,
+		description: m.Description,
+		temporality: temporality,
+	}
+	switch m.Type {
+	case stats.Counter:
+		result.kind, result.monotonic = kindSum, true
+	case stats.Gauge, stats.Rate:
+		result.kind = kindGauge
+	case stats.Trend:
+		result.kind = kindHistogram
+	case stats.Histogram:
+		result.kind = kindExponentialHistogram
+	}
+	switch {
+	case m.Unit != "":
+		result.unit = otlpUnit(m.Unit)
+	case m.Type == stats.Rate:
+		result.unit = "1"
+	case m.Contains == stats.Time:
+		result.unit = "ms"
+	case m.Contains == stats.Data:
+		result.unit = "By"
+	}
+	return result
+}
+
+// otlpUnit returns the UCUM unit that OTLP expects for the common units of
+// custom metrics, or the unit as it is.
+func otlpUnit(unit string) string {
+	switch unit {
+	case "bytes", "B":
+		return "By"
+	case "ratio":
+		return "1"
+	case "percent":
+		return "%"
+	default:
+		return unit
+	}
+}
+
+// splitBatches splits the data points of the given metrics into batches of
+// at most size data points each.
+func splitBatches(metrics []metric, size int) [][]metric {
+	var batches [][]metric
+	var batch []metric
+	n := 0
+	for _, m := range metrics {
+		points := m.points
+		for len(points) > 0 {
+			take := size - n
+			if take > len(points) {
+				take = len(points)
+			}
+			part := m
+			part.points = points[:take]
+			batch = append(batch, part)
+			points = points[take:]
+			n += take
+			if n == size {
+				batches = append(batches, batch)
+				batch, n = nil, 0
+			}
+		}
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+func sortedKeyValues(m map[string]string) []keyValue {
+	result := make([]keyValue, 0, len(m))
+	for k, v := range m {
+		result = append(result, keyValue{key: k, value: v})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].key < result[j].key })
+	return result
+}
+
+func seriesKey(name string, attributes []keyValue) string {
+	var b strings.Builder
+	b.WriteString(name)
+	for _, kv := range attributes {
+		b.WriteByte(0)
+		b.WriteString(kv.key)
+		b.WriteByte('=')
+		b.WriteString(kv.value)
+	}
+	return b.String()
+}
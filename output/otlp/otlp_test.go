@@ -0,0 +1,442 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package otlp
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+// pbMessage is a decoded protobuf message, with the raw values of its fields:
+// []byte for the length-delimited ones and uint64 for the rest.
+type pbMessage map[protowire.Number][]interface{}
+
+func decodeMessage(t *testing.T, b []byte) pbMessage {
+	m := pbMessage{}
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		require.True(t, n > 0)
+		b = b[n:]
+		var v interface{}
+		switch typ {
+		case protowire.BytesType:
+			v, n = protowire.ConsumeBytes(b)
+		case protowire.VarintType:
+			v, n = protowire.ConsumeVarint(b)
+		case protowire.Fixed64Type:
+			v, n = protowire.ConsumeFixed64(b)
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+		require.True(t, n > 0)
+		b = b[n:]
+		m[num] = append(m[num], v)
+	}
+	return m
+}
+
+func (m pbMessage) messages(t *testing.T, num protowire.Number) []pbMessage {
+	result := make([]pbMessage, len(m[num]))
+	for i, v := range m[num] {
+		result[i] = decodeMessage(t, v.([]byte))
+	}
+	return result
+}
+
+func (m pbMessage) str(num protowire.Number) string {
+	return string(m[num][0].([]byte))
+}
+
+func (m pbMessage) double(num protowire.Number) float64 {
+	return math.Float64frombits(m[num][0].(uint64))
+}
+
+// attributes returns the KeyValue attributes with string values as a map.
+func (m pbMessage) attributes(t *testing.T, num protowire.Number) map[string]string {
+	result := map[string]string{}
+	for _, kv := range m.messages(t, num) {
+		result[kv.str(1)] = kv.messages(t, 2)[0].str(1)
+	}
+	return result
+}
+
+// decodeMetrics returns the metrics in the given ExportMetricsServiceRequest
+// by their names, and its resource attributes.
+func decodeMetrics(t *testing.T, request []byte) (map[string]pbMessage, map[string]string) {
+	resourceMetrics := decodeMessage(t, request).messages(t, 1)
+	require.Len(t, resourceMetrics, 1)
+	resource := resourceMetrics[0].messages(t, 1)[0].attributes(t, 1)
+	scopeMetrics := resourceMetrics[0].messages(t, 2)
+	require.Len(t, scopeMetrics, 1)
+	assert.Equal(t, "k6", scopeMetrics[0].messages(t, 1)[0].str(1))
+
+	metrics := map[string]pbMessage{}
+	for _, m := range scopeMetrics[0].messages(t, 2) {
+		metrics[m.str(1)] = m
+	}
+	return metrics, resource
+}
+
+func getTestParams(t *testing.T) output.Params {
+	return output.Params{Logger: testutils.NewLogger(t)}
+}
+
+func TestOutputHTTP(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var requests [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/metrics", r.URL.Path)
+		assert.Equal(t, "application/x-protobuf", r.Header.Get("Content-Type"))
+		assert.Equal(t, "secret", r.Header.Get("X-Api-Key"))
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		mu.Lock()
+		requests = append(requests, body)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	params := getTestParams(t)
+	params.ConfigArgument = srv.URL
+	params.JSONConfig = json.RawMessage(`{
+		"headers": {"X-Api-Key": "secret"},
+		"resourceAttributes": {"deployment.environment": "staging"},
+		"histogramBounds": [10, 100],
+		"pushInterval": "1h"
+	}`)
+	out, err := New(params)
+	require.NoError(t, err)
+	assert.Equal(t, "otlp ("+srv.URL+")", out.Description())
+	require.NoError(t, out.Start())
+
+	now := time.Now()
+	tags := stats.NewSampleTags(map[string]string{"status": "200"})
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	reqs := stats.New("http_reqs", stats.Counter)
+	checks := stats.New("checks", stats.Rate)
+	vus := stats.New("vus", stats.Gauge)
+	out.AddMetricSamples([]stats.SampleContainer{
+		stats.Sample{Time: now, Metric: duration, Tags: tags, Value: 5},
+		stats.Sample{Time: now, Metric: duration, Tags: tags, Value: 50},
+		stats.Sample{Time: now, Metric: duration, Tags: tags, Value: 100},
+		stats.Sample{Time: now, Metric: duration, Tags: tags, Value: 500},
+		stats.Sample{Time: now, Metric: reqs, Tags: tags, Value: 1},
+		stats.Sample{Time: now, Metric: reqs, Tags: tags, Value: 1},
+		stats.Sample{Time: now, Metric: checks, Value: 1},
+		stats.Sample{Time: now, Metric: checks, Value: 0},
+		stats.Sample{Time: now, Metric: vus, Value: 3},
+		stats.Sample{Time: now, Metric: vus, Value: 7},
+	})
+	require.NoError(t, out.Stop())
+
+	require.Len(t, requests, 1)
+	metrics, resource := decodeMetrics(t, requests[0])
+	assert.Equal(t, map[string]string{"service.name": "k6", "deployment.environment": "staging"}, resource)
+	require.Len(t, metrics, 4)
+
+	histogram := metrics["k6.http_req_duration"]
+	assert.Equal(t, "ms", histogram.str(3))
+	histogramData := histogram.messages(t, 9)[0]
+	assert.Equal(t, uint64(temporalityCumulative), histogramData[2][0])
+	point := histogramData.messages(t, 1)[0]
+	assert.Equal(t, map[string]string{"status": "200"}, point.attributes(t, 9))
+	assert.Equal(t, uint64(4), point[4][0])
+	assert.Equal(t, 655.0, point.double(5))
+	assert.Equal(t, 5.0, point.double(11))
+	assert.Equal(t, 500.0, point.double(12))
+	counts := point[6][0].([]byte)
+	require.Len(t, counts, 3*8)
+	for i, expected := range []uint64{1, 2, 1} {
+		count, _ := protowire.ConsumeFixed64(counts[i*8:])
+		assert.Equal(t, expected, count)
+	}
+
+	sum := metrics["k6.http_reqs"].messages(t, 7)[0]
+	assert.Equal(t, uint64(temporalityCumulative), sum[2][0])
+	assert.Equal(t, uint64(1), sum[3][0])
+	assert.Equal(t, 2.0, sum.messages(t, 1)[0].double(4))
+
+	assert.Equal(t, 0.5, metrics["k6.checks"].messages(t, 5)[0].messages(t, 1)[0].double(4))
+	assert.Equal(t, "1", metrics["k6.checks"].str(3))
+	assert.Equal(t, 7.0, metrics["k6.vus"].messages(t, 5)[0].messages(t, 1)[0].double(4))
+}
+
+func TestOutputExponentialHistogram(t *testing.T) {
+	t.Parallel()
+
+	var requests [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests = append(requests, body)
+	}))
+	defer srv.Close()
+
+	params := getTestParams(t)
+	params.ConfigArgument = srv.URL
+	params.JSONConfig = json.RawMessage(`{"pushInterval": "1h"}`)
+	out, err := New(params)
+	require.NoError(t, err)
+	require.NoError(t, out.Start())
+
+	now := time.Now()
+	metric := stats.New("my_histogram", stats.Histogram)
+	var samples []stats.SampleContainer
+	for _, v := range []float64{1, 2, 4, 0, -1} {
+		samples = append(samples, stats.Sample{Time: now, Metric: metric, Value: v})
+	}
+	out.AddMetricSamples(samples)
+	require.NoError(t, out.Stop())
+
+	require.Len(t, requests, 1)
+	metrics, _ := decodeMetrics(t, requests[0])
+	data := metrics["k6.my_histogram"].messages(t, 10)[0]
+	assert.Equal(t, uint64(temporalityCumulative), data[2][0])
+	point := data.messages(t, 1)[0]
+	assert.Equal(t, uint64(5), point[4][0])
+	assert.Equal(t, 6.0, point.double(5))
+	// The buckets from 1 to 4 don't fit in 160 buckets with the scales 8 and 7
+	assert.Equal(t, int64(6), protowire.DecodeZigZag(point[6][0].(uint64)))
+	assert.Equal(t, uint64(1), point[7][0])
+	assert.Equal(t, -1.0, point.double(12))
+	assert.Equal(t, 4.0, point.double(13))
+
+	decodeBuckets := func(buckets pbMessage) (int64, []uint64) {
+		var counts []uint64
+		for b := buckets[2][0].([]byte); len(b) > 0; {
+			c, n := protowire.ConsumeVarint(b)
+			require.True(t, n > 0)
+			counts = append(counts, c)
+			b = b[n:]
+		}
+		return protowire.DecodeZigZag(buckets[1][0].(uint64)), counts
+	}
+	offset, counts := decodeBuckets(point.messages(t, 8)[0])
+	assert.Equal(t, int64(-1), offset)
+	require.Len(t, counts, 129)
+	assert.Equal(t, uint64(1), counts[0])
+	assert.Equal(t, uint64(1), counts[64])
+	assert.Equal(t, uint64(1), counts[128])
+	offset, counts = decodeBuckets(point.messages(t, 9)[0])
+	assert.Equal(t, int64(-1), offset)
+	assert.Equal(t, []uint64{1}, counts)
+}
+
+func TestOutputExemplars(t *testing.T) {
+	t.Parallel()
+
+	var requests [][]byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NoError(t, err)
+		requests = append(requests, body)
+	}))
+	defer srv.Close()
+
+	params := getTestParams(t)
+	params.ConfigArgument = srv.URL
+	params.JSONConfig = json.RawMessage(`{"pushInterval": "1h"}`)
+	out, err := New(params)
+	require.NoError(t, err)
+	require.NoError(t, out.Start())
+
+	now := time.Now()
+	duration := stats.New("http_req_duration", stats.Trend, stats.Time)
+	reqs := stats.New("http_reqs", stats.Counter)
+	slow := &stats.Exemplar{TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7"}
+	fast := &stats.Exemplar{TraceID: "0af7651916cd43dd8448eb211c80319c"}
+	out.AddMetricSamples([]stats.SampleContainer{
+		stats.Sample{Time: now, Metric: duration, Value: 5, Exemplar: fast},
+		stats.Sample{Time: now, Metric: duration, Value: 500, Exemplar: slow},
+		stats.Sample{Time: now, Metric: duration, Value: 900},
+		stats.Sample{Time: now, Metric: duration, Value: 50, Exemplar: &stats.Exemplar{TraceID: "invalid"}},
+		stats.Sample{Time: now, Metric: reqs, Value: 1},
+	})
+	require.NoError(t, out.Stop())
+
+	require.Len(t, requests, 1)
+	metrics, _ := decodeMetrics(t, requests[0])
+	point := metrics["k6.http_req_duration"].messages(t, 9)[0].messages(t, 1)[0]
+	exemplars := point.messages(t, 8)
+	require.Len(t, exemplars, 1)
+	assert.Equal(t, uint64(now.UnixNano()), exemplars[0][2][0])
+	assert.Equal(t, 500.0, exemplars[0].double(3))
+	assert.Equal(t, slow.SpanID, hex.EncodeToString(exemplars[0][4][0].([]byte)))
+	assert.Equal(t, slow.TraceID, hex.EncodeToString(exemplars[0][5][0].([]byte)))
+
+	point = metrics["k6.http_reqs"].messages(t, 7)[0].messages(t, 1)[0]
+	assert.Empty(t, point[5])
+}
+
+func TestOutputMetricMetadata(t *testing.T) {
+	t.Parallel()
+	o := &Output{config: NewConfig()}
+
+	upload := stats.New("upload_size", stats.Trend, stats.Data)
+	upload.Unit, upload.Description = "bytes", "The size of the uploaded files"
+	m := o.newMetric(upload, temporalityCumulative)
+	assert.Equal(t, "By", m.unit)
+	assert.Equal(t, "The size of the uploaded files", m.description)
+
+	queue := stats.New("queue_length", stats.Gauge)
+	queue.Unit = "{jobs}"
+	assert.Equal(t, "{jobs}", o.newMetric(queue, temporalityCumulative).unit)
+
+	decoded := decodeMessage(t, encodeMetric(o.newMetric(upload, temporalityCumulative)))
+	assert.Equal(t, "The size of the uploaded files", decoded.str(2))
+	assert.Equal(t, "By", decoded.str(3))
+}
+
+func TestOutputTemporalityAndBatches(t *testing.T) {
+	t.Parallel()
+
+	conf := NewConfig()
+	conf.Temporality.String = temporalityNameDelta
+	conf.MaxBatchSize.Int64 = 2
+	conf.Endpoint.String = "http://localhost"
+	require.NoError(t, conf.Validate())
+	out, err := newOutput(getTestParams(t), conf)
+	require.NoError(t, err)
+
+	reqs := stats.New("http_reqs", stats.Counter)
+	newSample := func(name string) stats.Sample {
+		tags := stats.NewSampleTags(map[string]string{"name": name})
+		return stats.Sample{Time: time.Now(), Metric: reqs, Tags: tags, Value: 1}
+	}
+	for _, name := range []string{"a", "b", "c", "a"} {
+		out.addSample(newSample(name))
+	}
+
+	metrics := out.collect(time.Now())
+	require.Len(t, metrics, 1)
+	assert.Equal(t, temporalityDelta, metrics[0].temporality)
+	values := make([]float64, 0, 3)
+	for _, p := range metrics[0].points {
+		values = append(values, p.value)
+	}
+	assert.Equal(t, []float64{2, 1, 1}, values)
+
+	batches := splitBatches(metrics, 2)
+	require.Len(t, batches, 2)
+	assert.Len(t, batches[0][0].points, 2)
+	assert.Len(t, batches[1][0].points, 1)
+
+	// Only the updated series are sent with the delta temporality
+	out.addSample(newSample("b"))
+	metrics = out.collect(time.Now())
+	require.Len(t, metrics, 1)
+	require.Len(t, metrics[0].points, 1)
+	assert.Equal(t, 1.0, metrics[0].points[0].value)
+	assert.Empty(t, out.collect(time.Now()))
+}
+
+// serverCodec makes the test server receive the raw requests.
+type serverCodec struct {
+	rawCodec
+}
+
+func (serverCodec) String() string {
+	return "proto"
+}
+
+func TestOutputGRPC(t *testing.T) {
+	t.Parallel()
+
+	received := make(chan []byte, 1)
+	srv := grpc.NewServer(
+		grpc.CustomCodec(serverCodec{}), //nolint:staticcheck
+		grpc.UnknownServiceHandler(func(_ interface{}, stream grpc.ServerStream) error {
+			method, _ := grpc.MethodFromServerStream(stream)
+			assert.Equal(t, grpcExportMethod, method)
+			md, _ := metadata.FromIncomingContext(stream.Context())
+			assert.Equal(t, []string{"secret"}, md.Get("x-api-key"))
+			var request []byte
+			if err := stream.RecvMsg(&request); err != nil {
+				return err
+			}
+			received <- request
+			response := []byte{}
+			return stream.SendMsg(&response)
+		}),
+	)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = srv.Serve(listener) }()
+	defer srv.Stop()
+
+	conf := NewConfig()
+	conf.Protocol.String = protocolGRPC
+	conf.Endpoint.String = listener.Addr().String()
+	conf.Insecure.Bool = true
+	conf.Headers = map[string]string{"x-api-key": "secret"}
+	require.NoError(t, conf.Validate())
+	exp, err := newExporter(conf)
+	require.NoError(t, err)
+	defer func() { assert.NoError(t, exp.Close()) }()
+
+	request := encodeRequest(nil, "k6", "test", []metric{{
+		name: "k6.vus", kind: kindGauge, points: []dataPoint{{time: time.Now(), value: 1}},
+	}})
+	require.NoError(t, exp.export(context.Background(), request))
+	assert.Equal(t, request, <-received)
+}
+
+func TestConfig(t *testing.T) {
+	t.Parallel()
+
+	conf, err := GetConsolidatedConfig(json.RawMessage(`{"protocol": "grpc"}`), nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:4317", conf.Endpoint.String)
+
+	conf, err = GetConsolidatedConfig(nil, nil, "")
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:4318", conf.Endpoint.String)
+
+	_, err = GetConsolidatedConfig(json.RawMessage(`{"protocol": "http/json"}`), nil, "")
+	assert.EqualError(t, err, "invalid OTLP protocol 'http/json', it should be http/protobuf or grpc")
+	_, err = GetConsolidatedConfig(json.RawMessage(`{"temporality": "sometimes"}`), nil, "")
+	assert.EqualError(t, err, "invalid OTLP temporality 'sometimes', it should be cumulative or delta")
+	_, err = GetConsolidatedConfig(json.RawMessage(`{"histogramBounds": [10, 5]}`), nil, "")
+	assert.EqualError(t, err, "the OTLP histogram bounds should be increasing, but 5 comes after 10")
+	_, err = New(output.Params{ConfigArgument: "localhost:4318", Logger: testutils.NewLogger(t)})
+	assert.EqualError(t, err, "the OTLP endpoint should be an http or https URL, but is 'localhost:4318'")
+}
@@ -0,0 +1,261 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package otlp
+
+import (
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/loadimpact/k6/output/internal/protoenc"
+)
+
+// The OTLP metrics messages are encoded directly with protowire, so that we
+// don't need the generated code for the whole OpenTelemetry proto package.
+// The field numbers are the ones from opentelemetry/proto/metrics/v1/metrics.proto
+// and opentelemetry/proto/collector/metrics/v1/metrics_service.proto.
+
+type metricKind int
+
+const (
+	kindGauge metricKind = iota
+	kindSum
+	kindHistogram
+	kindExponentialHistogram
+)
+
+// The values of the AggregationTemporality enum
+const (
+	temporalityDelta      = 1
+	temporalityCumulative = 2
+)
+
+type keyValue struct {
+	key, value string
+}
+
+type dataPoint struct {
+	attributes  []keyValue
+	start, time time.Time
+
+	// For gauges and sums
+	value float64
+
+	// For histograms
+	count        uint64
+	sum          float64
+	min, max     float64
+	bucketCounts []uint64
+	bounds       []float64
+
+	// For exponential histograms, together with count, sum, min and max
+	scale              int32
+	zeroCount          uint64
+	positive, negative expBuckets
+
+	exemplars []exemplar
+}
+
+// exemplar links a data point to one of the traces of its samples.
+type exemplar struct {
+	time            time.Time
+	value           float64
+	traceID, spanID []byte
+}
+
+type expBuckets struct {
+	offset int32
+	counts []uint64
+}
+
+type metric struct {
+	name, unit  string
+	description string
+	kind        metricKind
+	temporality int
+	monotonic   bool
+	points      []dataPoint
+}
+
+// encodeRequest returns an encoded ExportMetricsServiceRequest with a single
+// ResourceMetrics and ScopeMetrics containing the given metrics.
+func encodeRequest(resource []keyValue, scopeName, scopeVersion string, metrics []metric) []byte {
+	var res []byte
+	for _, kv := range resource {
+		res = appendKeyValue(res, 1, kv)
+	}
+
+	var scope []byte
+	scope = protoenc.AppendString(scope, 1, scopeName)
+	scope = protoenc.AppendString(scope, 2, scopeVersion)
+
+	var scopeMetrics []byte
+	scopeMetrics = protoenc.AppendMessage(scopeMetrics, 1, scope)
+	for _, m := range metrics {
+		scopeMetrics = protoenc.AppendMessage(scopeMetrics, 2, encodeMetric(m))
+	}
+
+	var resourceMetrics []byte
+	resourceMetrics = protoenc.AppendMessage(resourceMetrics, 1, res)
+	resourceMetrics = protoenc.AppendMessage(resourceMetrics, 2, scopeMetrics)
+
+	return protoenc.AppendMessage(nil, 1, resourceMetrics)
+}
+
+func encodeMetric(m metric) []byte {
+	var b []byte
+	b = protoenc.AppendString(b, 1, m.name)
+	if m.description != "" {
+		b = protoenc.AppendString(b, 2, m.description)
+	}
+	if m.unit != "" {
+		b = protoenc.AppendString(b, 3, m.unit)
+	}
+
+	var data []byte
+	switch m.kind {
+	case kindGauge:
+		for _, p := range m.points {
+			data = protoenc.AppendMessage(data, 1, encodeNumberDataPoint(p))
+		}
+		return protoenc.AppendMessage(b, 5, data)
+	case kindSum:
+		for _, p := range m.points {
+			data = protoenc.AppendMessage(data, 1, encodeNumberDataPoint(p))
+		}
+		data = protoenc.AppendVarint(data, 2, uint64(m.temporality))
+		if m.monotonic {
+			data = protoenc.AppendVarint(data, 3, 1)
+		}
+		return protoenc.AppendMessage(b, 7, data)
+	case kindExponentialHistogram:
+		for _, p := range m.points {
+			data = protoenc.AppendMessage(data, 1, encodeExponentialHistogramDataPoint(p))
+		}
+		data = protoenc.AppendVarint(data, 2, uint64(m.temporality))
+		return protoenc.AppendMessage(b, 10, data)
+	default:
+		for _, p := range m.points {
+			data = protoenc.AppendMessage(data, 1, encodeHistogramDataPoint(p))
+		}
+		data = protoenc.AppendVarint(data, 2, uint64(m.temporality))
+		return protoenc.AppendMessage(b, 9, data)
+	}
+}
+
+func encodeNumberDataPoint(p dataPoint) []byte {
+	var b []byte
+	b = protoenc.AppendFixed64(b, 2, uint64(p.start.UnixNano()))
+	b = protoenc.AppendFixed64(b, 3, uint64(p.time.UnixNano()))
+	b = protoenc.AppendDouble(b, 4, p.value)
+	b = appendExemplars(b, 5, p.exemplars)
+	for _, kv := range p.attributes {
+		b = appendKeyValue(b, 7, kv)
+	}
+	return b
+}
+
+func encodeHistogramDataPoint(p dataPoint) []byte {
+	var b []byte
+	b = protoenc.AppendFixed64(b, 2, uint64(p.start.UnixNano()))
+	b = protoenc.AppendFixed64(b, 3, uint64(p.time.UnixNano()))
+	b = protoenc.AppendFixed64(b, 4, p.count)
+	b = protoenc.AppendDouble(b, 5, p.sum)
+
+	var counts, bounds []byte
+	for _, c := range p.bucketCounts {
+		counts = protowire.AppendFixed64(counts, c)
+	}
+	for _, bound := range p.bounds {
+		bounds = protowire.AppendFixed64(bounds, math.Float64bits(bound))
+	}
+	b = protoenc.AppendMessage(b, 6, counts)
+	b = protoenc.AppendMessage(b, 7, bounds)
+	b = appendExemplars(b, 8, p.exemplars)
+
+	for _, kv := range p.attributes {
+		b = appendKeyValue(b, 9, kv)
+	}
+	if p.count > 0 {
+		b = protoenc.AppendDouble(b, 11, p.min)
+		b = protoenc.AppendDouble(b, 12, p.max)
+	}
+	return b
+}
+
+func encodeExponentialHistogramDataPoint(p dataPoint) []byte {
+	var b []byte
+	for _, kv := range p.attributes {
+		b = appendKeyValue(b, 1, kv)
+	}
+	b = protoenc.AppendFixed64(b, 2, uint64(p.start.UnixNano()))
+	b = protoenc.AppendFixed64(b, 3, uint64(p.time.UnixNano()))
+	b = protoenc.AppendFixed64(b, 4, p.count)
+	b = protoenc.AppendDouble(b, 5, p.sum)
+	b = protoenc.AppendSint(b, 6, int64(p.scale))
+	b = protoenc.AppendFixed64(b, 7, p.zeroCount)
+	b = protoenc.AppendMessage(b, 8, encodeExpBuckets(p.positive))
+	b = protoenc.AppendMessage(b, 9, encodeExpBuckets(p.negative))
+	b = appendExemplars(b, 11, p.exemplars)
+	if p.count > 0 {
+		b = protoenc.AppendDouble(b, 12, p.min)
+		b = protoenc.AppendDouble(b, 13, p.max)
+	}
+	return b
+}
+
+func encodeExpBuckets(buckets expBuckets) []byte {
+	var b, counts []byte
+	b = protoenc.AppendSint(b, 1, int64(buckets.offset))
+	for _, c := range buckets.counts {
+		counts = protowire.AppendVarint(counts, c)
+	}
+	return protoenc.AppendMessage(b, 2, counts)
+}
+
+func appendExemplars(b []byte, num protowire.Number, exemplars []exemplar) []byte {
+	for _, e := range exemplars {
+		var m []byte
+		m = protoenc.AppendFixed64(m, 2, uint64(e.time.UnixNano()))
+		m = protoenc.AppendDouble(m, 3, e.value)
+		if len(e.spanID) > 0 {
+			m = protoenc.AppendBytes(m, 4, e.spanID)
+		}
+		m = protoenc.AppendBytes(m, 5, e.traceID)
+		b = protoenc.AppendMessage(b, num, m)
+	}
+	return b
+}
+
+// appendKeyValue appends a KeyValue with a string AnyValue.
+func appendKeyValue(b []byte, num protowire.Number, kv keyValue) []byte {
+	var value []byte
+	value = protoenc.AppendString(value, 1, kv.value)
+
+	var m []byte
+	m = protoenc.AppendString(m, 1, kv.key)
+	m = protoenc.AppendMessage(m, 2, value)
+	return protoenc.AppendMessage(b, num, m)
+}
+
+// appendMessage appends an embedded message, a string or a packed repeated
+// field, since they are all encoded in the same way.
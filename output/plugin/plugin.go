@@ -0,0 +1,393 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package plugin implements an output that sends the metric samples to a
+// separate output plugin executable over gRPC, and the helpers for writing
+// such plugins in Go. The protocol is described in output.proto.
+package plugin
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"google.golang.org/grpc"
+
+	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/output"
+)
+
+const (
+	// MagicCookieKey and MagicCookieValue are set in the environment of the
+	// plugins, so they can tell when they aren't started by k6.
+	MagicCookieKey   = "K6_OUTPUT_PLUGIN_MAGIC_COOKIE"
+	MagicCookieValue = "0b1d1f5e4b6e4f4c"
+
+	// ProtocolVersion is the version of the plugin protocol, it's the first
+	// part of the handshake line.
+	ProtocolVersion = 1
+
+	defaultTimeout         = 10 * time.Second
+	defaultBatchMaxSamples = 10000
+	defaultBatchMaxLatency = 1 * time.Second
+
+	// The plugins accept bigger messages than the gRPC default of 4MB, since a
+	// batch can get larger than its MaxSamples while it's being sent.
+	maxMessageSize = 64 << 20
+)
+
+// Output starts an output plugin executable and sends it the batched metric
+// samples.
+type Output struct {
+	*output.Batcher
+
+	params      output.Params
+	logger      logrus.FieldLogger
+	path        string
+	args        []string
+	env         []string
+	configArg   string
+	timeout     time.Duration
+	maxSamples  int
+	description string
+
+	cmd  *exec.Cmd
+	logs sync.WaitGroup
+	conn *grpc.ClientConn
+}
+
+// New returns a new plugin output. The config argument is the path of the
+// plugin executable, optionally followed by a comma and an argument for the
+// plugin itself, e.g. --out plugin=./my-output,some-config
+func New(params output.Params) (output.Output, error) {
+	path, configArg := params.ConfigArgument, ""
+	if i := strings.IndexByte(path, ','); i >= 0 {
+		path, configArg = path[:i], path[i+1:]
+	}
+	if path == "" {
+		return nil, fmt.Errorf("the plugin output needs the path of the plugin executable, e.g. --out plugin=./my-output")
+	}
+
+	batchConf := output.BatchConfig{MaxSamples: defaultBatchMaxSamples, MaxLatency: defaultBatchMaxLatency}
+	timeout := defaultTimeout
+	if v, ok := params.Environment["K6_PLUGIN_BATCH_MAX_SAMPLES"]; ok {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid K6_PLUGIN_BATCH_MAX_SAMPLES value '%s': %w", v, err)
+		}
+		batchConf.MaxSamples = n
+	}
+	if v, ok := params.Environment["K6_PLUGIN_BATCH_MAX_LATENCY"]; ok {
+		d, err := types.ParseExtendedDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid K6_PLUGIN_BATCH_MAX_LATENCY value '%s': %w", v, err)
+		}
+		batchConf.MaxLatency = d
+	}
+	if v, ok := params.Environment["K6_PLUGIN_TIMEOUT"]; ok {
+		d, err := types.ParseExtendedDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid K6_PLUGIN_TIMEOUT value '%s': %w", v, err)
+		}
+		timeout = d
+	}
+	batcher, err := output.NewBatcher(batchConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Output{
+		Batcher:    batcher,
+		params:     params,
+		logger:     params.Logger.WithFields(logrus.Fields{"output": "plugin", "plugin": filepath.Base(path)}),
+		path:       path,
+		configArg:  configArg,
+		timeout:    timeout,
+		maxSamples: batchConf.MaxSamples,
+	}, nil
+}
+
+// Description returns the description that the plugin returned when it was
+// started, or just its path before that.
+func (o *Output) Description() string {
+	if o.description != "" {
+		return o.description
+	}
+	return fmt.Sprintf("plugin (%s)", o.path)
+}
+
+// Start starts the plugin process, connects to it and starts the goroutine
+// that sends the batched samples.
+func (o *Output) Start() error {
+	o.logger.Debug("Starting...")
+	if err := o.startProcess(); err != nil {
+		return err
+	}
+
+	req := StartRequest{
+		ConfigArgument: o.configArg,
+		JSONConfig:     o.params.JSONConfig,
+		Environment:    o.params.Environment,
+	}
+	if o.params.ScriptPath != nil {
+		req.ScriptPath = o.params.ScriptPath.String()
+	}
+	resp, err := o.call(methodStart, encodeStartRequest(req))
+	if err == nil {
+		o.description, err = decodeStartResponse(resp)
+	}
+	if err != nil {
+		o.stopProcess()
+		return fmt.Errorf("the output plugin %s couldn't start: %w", o.path, err)
+	}
+
+	o.Batcher.Start(o.flushMetrics)
+	o.logger.Debug("Started!")
+	return nil
+}
+
+// Stop sends the remaining samples and stops the plugin.
+func (o *Output) Stop() error {
+	o.logger.Debug("Stopping...")
+	defer o.logger.Debug("Stopped!")
+	o.Batcher.Stop()
+
+	_, err := o.call(methodStop, nil)
+	if err != nil {
+		err = fmt.Errorf("the output plugin %s couldn't stop: %w", o.path, err)
+	}
+	o.stopProcess()
+	return err
+}
+
+func (o *Output) flushMetrics() {
+	containers := o.GetBufferedSamples()
+	if len(containers) == 0 {
+		return
+	}
+	start := time.Now()
+	var samples []Sample
+	for _, sc := range containers {
+		for _, s := range sc.GetSamples() {
+			samples = append(samples, newSample(s))
+		}
+	}
+	o.ReleaseBufferedSamples(containers)
+
+	for len(samples) > 0 {
+		batch := samples
+		if o.maxSamples > 0 && len(batch) > o.maxSamples {
+			batch = batch[:o.maxSamples]
+		}
+		samples = samples[len(batch):]
+		if _, err := o.call(methodAddMetricSamples, encodeSampleBatch(batch)); err != nil {
+			o.logger.WithError(err).WithField("samples", len(batch)).Error("Couldn't send the samples to the plugin")
+		}
+	}
+	o.logger.WithField("t", time.Since(start)).Debug("Sent the samples to the plugin")
+}
+
+func (o *Output) call(method string, req []byte) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+	var resp []byte
+	err := o.conn.Invoke(ctx, method, &req, &resp)
+	return resp, err
+}
+
+// startProcess starts the plugin, reads its handshake line and connects to it.
+func (o *Output) startProcess() error {
+	cmd := exec.Command(o.path, o.args...) //nolint:gosec
+	cmd.Env = append(append(os.Environ(), MagicCookieKey+"="+MagicCookieValue), o.env...)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return err
+	}
+	if err = cmd.Start(); err != nil {
+		return fmt.Errorf("couldn't start the output plugin %s: %w", o.path, err)
+	}
+	o.cmd = cmd
+
+	// The stdout is forwarded after the handshake line is read
+	o.logs.Add(2)
+	go o.forwardLogs(bufio.NewReader(stderr))
+
+	network, addr, err := o.readHandshake(bufio.NewReader(stdout))
+	if err == nil {
+		err = o.connect(network, addr)
+	}
+	if err != nil {
+		o.stopProcess()
+		return fmt.Errorf("couldn't connect to the output plugin %s: %w", o.path, err)
+	}
+	return nil
+}
+
+func (o *Output) readHandshake(stdout *bufio.Reader) (network, addr string, err error) {
+	type result struct {
+		line string
+		err  error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		line, err := stdout.ReadString('\n')
+		ch <- result{line, err}
+		if err == nil {
+			o.forwardLogs(stdout)
+		} else {
+			o.logs.Done()
+		}
+	}()
+
+	var res result
+	select {
+	case res = <-ch:
+	case <-time.After(o.timeout):
+		return "", "", fmt.Errorf("no handshake after %s", o.timeout)
+	}
+	if res.err != nil {
+		return "", "", fmt.Errorf("couldn't read the handshake: %w", res.err)
+	}
+	return parseHandshake(res.line)
+}
+
+// parseHandshake parses the version|network|address|protocol line.
+func parseHandshake(line string) (network, addr string, err error) {
+	parts := strings.Split(strings.TrimSpace(line), "|")
+	if len(parts) != 4 {
+		return "", "", fmt.Errorf("invalid handshake '%s'", strings.TrimSpace(line))
+	}
+	if parts[0] != strconv.Itoa(ProtocolVersion) {
+		return "", "", fmt.Errorf("unsupported plugin protocol version %s, k6 supports version %d",
+			parts[0], ProtocolVersion)
+	}
+	if parts[1] != "unix" && parts[1] != "tcp" {
+		return "", "", fmt.Errorf("unsupported plugin network '%s'", parts[1])
+	}
+	if parts[3] != "grpc" {
+		return "", "", fmt.Errorf("unsupported plugin protocol '%s'", parts[3])
+	}
+	return parts[1], parts[2], nil
+}
+
+func (o *Output) connect(network, addr string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), o.timeout)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, addr,
+		grpc.WithInsecure(),
+		grpc.WithBlock(),
+		grpc.WithContextDialer(func(ctx context.Context, addr string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		}),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(rawCodec{}), grpc.MaxCallRecvMsgSize(maxMessageSize)),
+	)
+	if err != nil {
+		return err
+	}
+	o.conn = conn
+	return nil
+}
+
+// stopProcess closes the connection and waits for the plugin to exit, killing
+// it if it doesn't do that in time.
+func (o *Output) stopProcess() {
+	if o.conn != nil {
+		_ = o.conn.Close()
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		o.logs.Wait()
+		done <- o.cmd.Wait()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(o.timeout):
+		o.logger.Warn("The plugin didn't exit in time, killing it")
+		_ = o.cmd.Process.Kill()
+		err = <-done
+	}
+	if err != nil {
+		o.logger.WithError(err).Warn("The plugin exited with an error")
+	}
+}
+
+// forwardLogs shows everything the plugin writes to its stdout and stderr in
+// the k6 logs.
+func (o *Output) forwardLogs(r *bufio.Reader) {
+	defer o.logs.Done()
+	for {
+		line, err := r.ReadString('\n')
+		if line = strings.TrimRight(line, "\r\n"); line != "" {
+			o.logger.Info(line)
+		}
+		if err != nil {
+			if err != io.EOF {
+				o.logger.WithError(err).Debug("Couldn't read the plugin output")
+			}
+			return
+		}
+	}
+}
+
+// rawCodec sends and receives already encoded protobuf messages.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("unexpected message type %T", v)
+	}
+	return *b, nil
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("unexpected message type %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
+
+// String makes rawCodec usable as a server codec as well.
+func (rawCodec) String() string {
+	return "proto"
+}
@@ -0,0 +1,205 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+// recordingPlugin writes everything it gets to the file from its config
+// argument, so the test can check it after the plugin exits.
+type recordingPlugin struct {
+	events []string
+	file   string
+}
+
+func (p *recordingPlugin) Start(req StartRequest) (string, error) {
+	p.file = req.ConfigArgument
+	p.events = append(p.events, fmt.Sprintf("start %s %s %s", req.JSONConfig, req.Environment["K6_SOME_VAR"], req.ScriptPath))
+	fmt.Fprintln(os.Stderr, "the test plugin started") //nolint:errcheck
+	return "test plugin", nil
+}
+
+func (p *recordingPlugin) AddMetricSamples(samples []Sample) error {
+	for _, s := range samples {
+		tags, _ := json.Marshal(s.Tags)
+		p.events = append(p.events, fmt.Sprintf("sample %s %s %s %d %g %s",
+			s.Metric, s.Type, s.Contains, s.Time.UnixNano(), s.Value, tags))
+	}
+	return nil
+}
+
+func (p *recordingPlugin) Stop() error {
+	p.events = append(p.events, "stop")
+	data, _ := json.Marshal(p.events)
+	return ioutil.WriteFile(p.file, data, 0o644)
+}
+
+// TestHelperPlugin isn't a real test, it's the plugin process that is started
+// by TestPluginOutput.
+func TestHelperPlugin(t *testing.T) {
+	if os.Getenv("K6_OUTPUT_PLUGIN_TEST_HELPER") != "1" {
+		return
+	}
+	if err := Serve(&recordingPlugin{}); err != nil {
+		fmt.Fprintln(os.Stderr, err) //nolint:errcheck
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func TestPluginOutput(t *testing.T) {
+	t.Parallel()
+	dir, err := ioutil.TempDir("", "k6-plugin-test-")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+	eventsFile := filepath.Join(dir, "events.json")
+
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	logHook := &testutils.SimpleLogrusHook{HookedLevels: []logrus.Level{logrus.InfoLevel}}
+	logger.AddHook(logHook)
+
+	out, err := New(output.Params{
+		Logger:         logger,
+		ConfigArgument: os.Args[0] + "," + eventsFile,
+		JSONConfig:     json.RawMessage(`{"a":1}`),
+		Environment:    map[string]string{"K6_SOME_VAR": "val", "K6_PLUGIN_BATCH_MAX_SAMPLES": "2"},
+		ScriptPath:     &url.URL{Scheme: "file", Path: "/script.js"},
+	})
+	require.NoError(t, err)
+	o, ok := out.(*Output)
+	require.True(t, ok)
+	o.args = []string{"-test.run=^TestHelperPlugin$"}
+	o.env = []string{"K6_OUTPUT_PLUGIN_TEST_HELPER=1"}
+	assert.Equal(t, "plugin ("+os.Args[0]+")", o.Description())
+
+	require.NoError(t, o.Start())
+	assert.Equal(t, "test plugin", o.Description())
+
+	metric := stats.New("my_metric", stats.Trend, stats.Time)
+	now := time.Unix(10, 5)
+	o.AddMetricSamples([]stats.SampleContainer{
+		stats.Sample{Metric: metric, Time: now, Value: 1.5, Tags: stats.IntoSampleTags(&map[string]string{"a": "1"})},
+		stats.Sample{Metric: metric, Time: now, Value: 0},
+		stats.Sample{Metric: metric, Time: now, Value: 3, Tags: stats.IntoSampleTags(&map[string]string{"b": "2"})},
+	})
+	require.NoError(t, o.Stop())
+
+	data, err := ioutil.ReadFile(eventsFile) //nolint:gosec
+	require.NoError(t, err)
+	var events []string
+	require.NoError(t, json.Unmarshal(data, &events))
+	assert.Equal(t, []string{
+		`start {"a":1} val file:///script.js`,
+		`sample my_metric trend time 10000000005 1.5 {"a":"1"}`,
+		`sample my_metric trend time 10000000005 0 null`,
+		`sample my_metric trend time 10000000005 3 {"b":"2"}`,
+		`stop`,
+	}, events)
+
+	var logs []string
+	for _, e := range logHook.Drain() {
+		logs = append(logs, e.Message)
+	}
+	assert.Contains(t, logs, "the test plugin started")
+}
+
+func TestPluginOutputHandshakeErrors(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]string{
+		"1|unix|/tmp/plugin.sock":      "invalid handshake '1|unix|/tmp/plugin.sock'",
+		"2|unix|/tmp/plugin.sock|grpc": "unsupported plugin protocol version 2, k6 supports version 1",
+		"1|udp|127.0.0.1:1234|grpc":    "unsupported plugin network 'udp'",
+		"1|tcp|127.0.0.1:1234|netrpc":  "unsupported plugin protocol 'netrpc'",
+	}
+	for line, expErr := range testCases {
+		_, _, err := parseHandshake(line + "\n")
+		assert.EqualError(t, err, expErr)
+	}
+
+	network, addr, err := parseHandshake("1|unix|/tmp/plugin.sock|grpc\n")
+	require.NoError(t, err)
+	assert.Equal(t, "unix", network)
+	assert.Equal(t, "/tmp/plugin.sock", addr)
+}
+
+func TestPluginOutputNotStarting(t *testing.T) {
+	t.Parallel()
+	out, err := New(output.Params{Logger: testutils.NewLogger(t), ConfigArgument: os.Args[0]})
+	require.NoError(t, err)
+	o, ok := out.(*Output)
+	require.True(t, ok)
+	// Without the helper environment variable, the test binary just runs the
+	// test and prints PASS
+	o.args = []string{"-test.run=^TestHelperPlugin$"}
+	err = o.Start()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid handshake 'PASS'")
+
+	_, err = New(output.Params{Logger: testutils.NewLogger(t), ConfigArgument: ",arg"})
+	assert.Error(t, err)
+}
+
+func TestServeNotStartedByK6(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, ErrNotStartedByK6, Serve(&recordingPlugin{}))
+}
+
+func TestSampleBatchEncoding(t *testing.T) {
+	t.Parallel()
+	samples := []Sample{
+		{
+			Metric: "http_reqs", Type: stats.Counter, Contains: stats.Default,
+			Time: time.Unix(1, 2), Value: 1, Tags: map[string]string{"status": "200", "url": "http://x"},
+			TraceID: "4bf92f3577b34da6a3ce929d0e0e4736", SpanID: "00f067aa0ba902b7",
+		},
+		{Metric: "vus", Type: stats.Gauge, Time: time.Unix(0, 0)},
+		{Metric: "data_sent", Type: stats.Counter, Contains: stats.Data, Time: time.Unix(3, 0), Value: -2.5},
+	}
+	decoded, err := decodeSampleBatch(encodeSampleBatch(samples))
+	require.NoError(t, err)
+	assert.Equal(t, samples, decoded)
+
+	req := StartRequest{ConfigArgument: "arg", JSONConfig: []byte(`{}`), Environment: map[string]string{"A": ""}}
+	decodedReq, err := decodeStartRequest(encodeStartRequest(req))
+	require.NoError(t, err)
+	assert.Equal(t, req, decodedReq)
+
+	_, err = decodeSampleBatch(bytes.Repeat([]byte{0xff}, 3))
+	assert.Error(t, err)
+}
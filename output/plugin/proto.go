@@ -0,0 +1,188 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package plugin
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	"github.com/loadimpact/k6/output/internal/protoenc"
+	"github.com/loadimpact/k6/stats"
+)
+
+// The messages from output.proto are encoded directly with protowire, so that
+// neither k6 nor the Go plugins need any generated code.
+
+const (
+	methodStart            = "/k6.output.v1.Output/Start"
+	methodAddMetricSamples = "/k6.output.v1.Output/AddMetricSamples"
+	methodStop             = "/k6.output.v1.Output/Stop"
+)
+
+// StartRequest is what a plugin gets when the test starts.
+type StartRequest struct {
+	// ConfigArgument is whatever came after the plugin path in
+	// --out plugin=./my-output,args
+	ConfigArgument string
+	// JSONConfig is the "plugin" key from the "collectors" JSON config.
+	JSONConfig  []byte
+	Environment map[string]string
+	ScriptPath  string
+}
+
+// Sample is a single metric sample that k6 sends to a plugin.
+type Sample struct {
+	Metric   string
+	Type     stats.MetricType
+	Contains stats.ValueType
+	Time     time.Time
+	Value    float64
+	Tags     map[string]string
+	TraceID  string
+	SpanID   string
+}
+
+func newSample(s stats.Sample) Sample {
+	var tags map[string]string
+	if s.Tags != nil {
+		tags = s.Tags.CloneTags()
+	}
+	sample := Sample{
+		Metric:   s.Metric.Name,
+		Type:     s.Metric.Type,
+		Contains: s.Metric.Contains,
+		Time:     s.Time,
+		Value:    s.Value,
+		Tags:     tags,
+	}
+	if s.Exemplar != nil {
+		sample.TraceID, sample.SpanID = s.Exemplar.TraceID, s.Exemplar.SpanID
+	}
+	return sample
+}
+
+func encodeStartRequest(req StartRequest) []byte {
+	var b []byte
+	b = protoenc.AppendString(b, 1, req.ConfigArgument)
+	if len(req.JSONConfig) > 0 {
+		b = protoenc.AppendBytes(b, 2, req.JSONConfig)
+	}
+	b = protoenc.AppendMap(b, 3, req.Environment)
+	b = protoenc.AppendString(b, 4, req.ScriptPath)
+	return b
+}
+
+func decodeStartRequest(b []byte) (req StartRequest, err error) {
+	err = protoenc.DecodeFields(b, func(num protowire.Number, v []byte) error {
+		switch num {
+		case 1:
+			req.ConfigArgument = string(v)
+		case 2:
+			req.JSONConfig = append([]byte(nil), v...)
+		case 3:
+			req.Environment, err = protoenc.DecodeMapEntry(req.Environment, v)
+		case 4:
+			req.ScriptPath = string(v)
+		}
+		return err
+	})
+	return req, invalidMessage(err)
+}
+
+func encodeStartResponse(description string) []byte {
+	return protoenc.AppendString(nil, 1, description)
+}
+
+func decodeStartResponse(b []byte) (description string, err error) {
+	err = protoenc.DecodeFields(b, func(num protowire.Number, v []byte) error {
+		if num == 1 {
+			description = string(v)
+		}
+		return nil
+	})
+	return description, invalidMessage(err)
+}
+
+func encodeSampleBatch(samples []Sample) []byte {
+	var b, s []byte
+	for _, sample := range samples {
+		s = protoenc.AppendString(s[:0], 1, sample.Metric)
+		s = protoenc.AppendVarint(s, 2, uint64(sample.Type))
+		s = protoenc.AppendVarint(s, 3, uint64(sample.Contains))
+		s = protoenc.AppendVarint(s, 4, uint64(sample.Time.UnixNano()))
+		if sample.Value != 0 {
+			s = protoenc.AppendDouble(s, 5, sample.Value)
+		}
+		s = protoenc.AppendMap(s, 6, sample.Tags)
+		if sample.TraceID != "" {
+			s = protoenc.AppendString(s, 7, sample.TraceID)
+			s = protoenc.AppendString(s, 8, sample.SpanID)
+		}
+
+		b = protoenc.AppendMessage(b, 1, s)
+	}
+	return b
+}
+
+func decodeSampleBatch(b []byte) ([]Sample, error) {
+	var samples []Sample
+	err := protoenc.DecodeFields(b, func(num protowire.Number, v []byte) error {
+		if num != 1 {
+			return nil
+		}
+		sample := Sample{Time: time.Unix(0, 0)}
+		var err error
+		err = protoenc.DecodeFields(v, func(num protowire.Number, v []byte) error {
+			switch num {
+			case 1:
+				sample.Metric = string(v)
+			case 2:
+				sample.Type = stats.MetricType(protoenc.DecodeVarint(v))
+			case 3:
+				sample.Contains = stats.ValueType(protoenc.DecodeVarint(v))
+			case 4:
+				sample.Time = time.Unix(0, int64(protoenc.DecodeVarint(v)))
+			case 5:
+				sample.Value = math.Float64frombits(protoenc.DecodeFixed64(v))
+			case 6:
+				sample.Tags, err = protoenc.DecodeMapEntry(sample.Tags, v)
+			case 7:
+				sample.TraceID = string(v)
+			case 8:
+				sample.SpanID = string(v)
+			}
+			return err
+		})
+		samples = append(samples, sample)
+		return err
+	})
+	return samples, invalidMessage(err)
+}
+
+func invalidMessage(err error) error {
+	if err == nil {
+		return nil
+	}
+	return fmt.Errorf("invalid plugin message: %w", err)
+}
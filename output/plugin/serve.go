@@ -0,0 +1,143 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Plugin is implemented by the output plugins written in Go, which are then
+// run with Serve(). Its methods are never called concurrently.
+type Plugin interface {
+	// Start is called once at the start of the test. The returned
+	// description is shown in the k6 output section.
+	Start(StartRequest) (description string, err error)
+	// AddMetricSamples is called with every batch of metric samples.
+	AddMetricSamples([]Sample) error
+	// Stop is called once at the end of the test, after the last batch.
+	Stop() error
+}
+
+// ErrNotStartedByK6 is returned by Serve() when the executable is started by
+// something other than k6, e.g. when someone runs it directly.
+var ErrNotStartedByK6 = errors.New("this is a k6 output plugin, it should be run with `k6 run --out plugin=<path>`")
+
+// Serve runs the given plugin until k6 stops it. It should be called from
+// the main() function of the plugin executable, which should exit when Serve
+// returns.
+func Serve(p Plugin) error {
+	if os.Getenv(MagicCookieKey) != MagicCookieValue {
+		return ErrNotStartedByK6
+	}
+	return serve(p, os.Stdout)
+}
+
+func serve(p Plugin, stdout io.Writer) error {
+	network, addr := "tcp", "127.0.0.1:0"
+	if runtime.GOOS != "windows" {
+		dir, err := ioutil.TempDir("", "k6-output-plugin-")
+		if err != nil {
+			return err
+		}
+		defer func() { _ = os.RemoveAll(dir) }()
+		network, addr = "unix", filepath.Join(dir, "plugin.sock")
+	}
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+
+	s := &server{plugin: p}
+	s.grpcServer = grpc.NewServer(
+		grpc.CustomCodec(rawCodec{}), //nolint:staticcheck
+		grpc.MaxRecvMsgSize(maxMessageSize),
+		grpc.UnknownServiceHandler(s.handle),
+	)
+
+	if _, err = fmt.Fprintf(stdout, "%d|%s|%s|grpc\n", ProtocolVersion, network, listener.Addr().String()); err != nil {
+		_ = listener.Close()
+		return err
+	}
+	return s.grpcServer.Serve(listener)
+}
+
+type server struct {
+	plugin     Plugin
+	grpcServer *grpc.Server
+	mu         sync.Mutex
+}
+
+// handle dispatches the calls to the plugin, since there is no generated
+// service code.
+func (s *server) handle(_ interface{}, stream grpc.ServerStream) error {
+	method, _ := grpc.MethodFromServerStream(stream)
+	var req []byte
+	if err := stream.RecvMsg(&req); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var resp []byte
+	switch method {
+	case methodStart:
+		startReq, err := decodeStartRequest(req)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		description, err := s.plugin.Start(startReq)
+		if err != nil {
+			return err
+		}
+		resp = encodeStartResponse(description)
+	case methodAddMetricSamples:
+		samples, err := decodeSampleBatch(req)
+		if err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+		if err = s.plugin.AddMetricSamples(samples); err != nil {
+			return err
+		}
+	case methodStop:
+		err := s.plugin.Stop()
+		// Stop serving once the response is sent, which makes Serve() return
+		go s.grpcServer.GracefulStop()
+		if err != nil {
+			return err
+		}
+	default:
+		return status.Errorf(codes.Unimplemented, "unknown method %s", method)
+	}
+	return stream.SendMsg(&resp)
+}
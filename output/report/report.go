@@ -0,0 +1,208 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package report implements the report output, which writes an HTML report
+// of the HTTP request latencies of each endpoint at the end of the test, with
+// their distribution charts and how many of the requests met the SLA.
+package report
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+const flushPeriod = 200 * time.Millisecond
+
+// defaultSLA are the request durations, in milliseconds, that the SLA
+// attainment table shows, unless they are set with K6_REPORT_SLA.
+var defaultSLA = []float64{100, 250, 500, 1000} //nolint:gochecknoglobals
+
+// Output collects the durations of the HTTP requests by endpoint and writes
+// the report to a file, or to stdout, when it's stopped.
+type Output struct {
+	output.SampleBuffer
+
+	params      output.Params
+	logger      logrus.FieldLogger
+	filename    string
+	sla         []float64
+	flusher     *output.PeriodicFlusher
+	startTime   time.Time
+	mu          sync.Mutex
+	endpoints   map[string]*stats.TrendSink
+	allRequests *stats.TrendSink
+	timings     *lib.RequestTimings
+}
+
+// New returns a new report output.
+func New(params output.Params) (output.Output, error) {
+	sla, err := parseSLA(params.Environment["K6_REPORT_SLA"])
+	if err != nil {
+		return nil, err
+	}
+	return &Output{
+		params:   params,
+		filename: params.ConfigArgument,
+		logger: params.Logger.WithFields(logrus.Fields{
+			"output":   "report",
+			"filename": params.ConfigArgument,
+		}),
+		sla:         sla,
+		endpoints:   make(map[string]*stats.TrendSink),
+		allRequests: &stats.TrendSink{},
+		timings:     lib.NewRequestTimings(),
+	}, nil
+}
+
+func parseSLA(value string) ([]float64, error) {
+	if value == "" {
+		return defaultSLA, nil
+	}
+	parts := strings.Split(value, ",")
+	sla := make([]float64, len(parts))
+	for i, part := range parts {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || v <= 0 {
+			return nil, fmt.Errorf("invalid K6_REPORT_SLA value '%s', it should be request durations in ms, "+
+				"separated by commas", value)
+		}
+		sla[i] = v
+	}
+	sort.Float64s(sla)
+	return sla, nil
+}
+
+// Description returns a human-readable description of the output.
+func (o *Output) Description() string {
+	if o.filename == "" || o.filename == "-" {
+		return "report(stdout)"
+	}
+	return fmt.Sprintf("report (%s)", o.filename)
+}
+
+// Start starts the goroutine that collects the buffered samples.
+func (o *Output) Start() error {
+	o.logger.Debug("Starting...")
+	o.startTime = time.Now()
+	pf, err := output.NewPeriodicFlusher(flushPeriod, o.flushMetrics)
+	if err != nil {
+		return err
+	}
+	o.flusher = pf
+	o.logger.Debug("Started!")
+	return nil
+}
+
+// Stop collects any remaining samples and writes the report.
+func (o *Output) Stop() error {
+	o.logger.Debug("Stopping...")
+	defer o.logger.Debug("Stopped!")
+	o.flusher.Stop()
+
+	if o.filename == "" || o.filename == "-" {
+		return o.writeReport(o.params.StdOut)
+	}
+	f, err := o.params.FS.Create(o.filename)
+	if err != nil {
+		return err
+	}
+	if err = o.writeReport(f); err != nil {
+		_ = f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// endpointName returns the name of the endpoint a request was made to, by
+// its method and its name tag, which is the URL unless it was overridden.
+func endpointName(tags *stats.SampleTags) string {
+	method, _ := tags.Get("method")
+	name, ok := tags.Get("name")
+	if !ok {
+		name, _ = tags.Get("url")
+	}
+	return strings.TrimSpace(method + " " + name)
+}
+
+func (o *Output) flushMetrics() {
+	samples := o.GetBufferedSamples()
+	o.mu.Lock()
+	for _, sc := range samples {
+		o.timings.Add(sc.GetSamples())
+		for _, sample := range sc.GetSamples() {
+			if sample.Metric.Name != metrics.HTTPReqDuration.Name {
+				continue
+			}
+			name := endpointName(sample.Tags)
+			sink, ok := o.endpoints[name]
+			if !ok {
+				sink = &stats.TrendSink{}
+				o.endpoints[name] = sink
+			}
+			sink.Add(sample)
+			o.allRequests.Add(sample)
+		}
+	}
+	o.mu.Unlock()
+	o.ReleaseBufferedSamples(samples)
+}
+
+func (o *Output) writeReport(w io.Writer) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	data := reportData{
+		Title:    "k6 latency report",
+		Date:     o.startTime.Format(time.RFC1123),
+		Duration: time.Since(o.startTime).Round(time.Second).String(),
+		SLA:      o.sla,
+		Phases:   phases(),
+	}
+	if o.params.ScriptPath != nil {
+		data.Title += ": " + o.params.ScriptPath.String()
+	}
+	names := make([]string, 0, len(o.endpoints))
+	for name := range o.endpoints {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if len(names) > 1 {
+		data.Endpoints = append(data.Endpoints, newEndpointData("All requests", o.allRequests, o.sla))
+	}
+	for _, name := range names {
+		data.Endpoints = append(data.Endpoints, newEndpointData(name, o.endpoints[name], o.sla))
+	}
+	for _, group := range o.timings.Groups() {
+		data.Groups = append(data.Groups, newGroupTimingsData(group))
+	}
+	return reportTemplate.Execute(w, data)
+}
@@ -0,0 +1,120 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+func TestParseSLA(t *testing.T) {
+	t.Parallel()
+	sla, err := parseSLA("")
+	require.NoError(t, err)
+	assert.Equal(t, defaultSLA, sla)
+
+	sla, err = parseSLA("500, 200")
+	require.NoError(t, err)
+	assert.Equal(t, []float64{200, 500}, sla)
+
+	_, err = parseSLA("200,fast")
+	assert.EqualError(t, err, "invalid K6_REPORT_SLA value '200,fast', it should be request durations in ms, "+
+		"separated by commas")
+}
+
+func TestEndpointData(t *testing.T) {
+	t.Parallel()
+	sink := &stats.TrendSink{}
+	for i := 1; i <= 100; i++ {
+		sink.Add(stats.Sample{Value: float64(i)})
+	}
+	e := newEndpointData("GET /", sink, []float64{50, 95.5, 200})
+
+	assert.Equal(t, uint64(100), e.Count)
+	assert.Equal(t, []float64{49, 95, 100}, e.SLAAttainment)
+	require.Len(t, e.Histogram, histogramBins)
+	total := 0.0
+	for _, b := range e.Histogram {
+		total += b.Height
+	}
+	assert.True(t, total > 0)
+	assert.Equal(t, "≥ 95.74 ms: 5 requests", e.Histogram[histogramBins-1].Label)
+
+	empty := newEndpointData("GET /empty", &stats.TrendSink{}, []float64{50})
+	assert.Empty(t, empty.Histogram)
+	assert.Empty(t, empty.SLAAttainment)
+}
+
+func TestReportOutput(t *testing.T) {
+	t.Parallel()
+	fs := afero.NewMemMapFs()
+	out, err := New(output.Params{
+		Logger:         testutils.NewLogger(t),
+		FS:             fs,
+		ConfigArgument: "report.html",
+		Environment:    map[string]string{"K6_REPORT_SLA": "100"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "report (report.html)", out.Description())
+	require.NoError(t, out.Start())
+
+	now := time.Now()
+	tags := func(method, url, name string) *stats.SampleTags {
+		t := map[string]string{"method": method, "url": url}
+		if name != "" {
+			t["name"] = name
+		}
+		return stats.NewSampleTags(t)
+	}
+	out.AddMetricSamples([]stats.SampleContainer{
+		stats.Sample{Time: now, Metric: metrics.HTTPReqDuration, Value: 50, Tags: tags("GET", "https://test.k6.io/", "")},
+		stats.Sample{Time: now, Metric: metrics.HTTPReqDuration, Value: 150, Tags: tags("GET", "https://test.k6.io/", "")},
+		stats.Sample{
+			Time: now, Metric: metrics.HTTPReqDuration, Value: 20,
+			Tags: tags("POST", "https://test.k6.io/users/1", "https://test.k6.io/users/${id}"),
+		},
+		stats.Sample{Time: now, Metric: metrics.HTTPReqs, Value: 1, Tags: tags("GET", "https://test.k6.io/", "")},
+		stats.Sample{Time: now, Metric: metrics.HTTPReqWaiting, Value: 40, Tags: tags("GET", "https://test.k6.io/", "")},
+	})
+	require.NoError(t, out.Stop())
+
+	report, err := afero.ReadFile(fs, "report.html")
+	require.NoError(t, err)
+	html := string(report)
+	assert.Contains(t, html, "<th>&lt; 100.00 ms</th>")
+	assert.Contains(t, html, `<tr><td>All requests</td><td>3</td><td class="bad">66.67%</td></tr>`)
+	assert.Contains(t, html, `<tr><td>GET https://test.k6.io/</td><td>2</td><td class="bad">50.00%</td></tr>`)
+	assert.Contains(t, html, `<tr><td>POST https://test.k6.io/users/${id}</td><td>1</td><td class="good">100.00%</td></tr>`)
+	assert.Contains(t, html, "<h3>GET https://test.k6.io/</h3>")
+	assert.Contains(t, html, "<h2>Request timings</h2>")
+	assert.Contains(t, html, "<h3>(root group)</h3>")
+	assert.Contains(t, html, `style="fill: #59cd90"`)
+	assert.NotContains(t, html, "ZgotmplZ")
+}
@@ -0,0 +1,288 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package report
+
+import (
+	"fmt"
+	"html/template"
+	"math"
+	"sort"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+const (
+	histogramBins   = 30
+	histogramWidth  = 600
+	histogramHeight = 120
+)
+
+type reportData struct {
+	Title     string
+	Date      string
+	Duration  string
+	SLA       []float64
+	Endpoints []endpointData
+	Groups    []groupTimingsData
+	Phases    []phaseData
+}
+
+type percentile struct {
+	Name  string
+	Value float64
+}
+
+type bar struct {
+	X, Y, Width, Height float64
+	Label               string
+}
+
+type endpointData struct {
+	Name        string
+	Count       uint64
+	Percentiles []percentile
+	// The percentage of the requests that took less than each SLA duration.
+	SLAAttainment []float64
+	Histogram     []bar
+	HistogramMin  float64
+	HistogramMax  float64
+}
+
+func newEndpointData(name string, sink *stats.TrendSink, sla []float64) endpointData {
+	sink.Calc()
+	e := endpointData{
+		Name:  name,
+		Count: sink.Count,
+		Percentiles: []percentile{
+			{"avg", sink.Avg}, {"min", sink.Min}, {"p(50)", sink.P(0.5)}, {"p(90)", sink.P(0.9)},
+			{"p(95)", sink.P(0.95)}, {"p(99)", sink.P(0.99)}, {"max", sink.Max},
+		},
+	}
+	if sink.Count == 0 {
+		return e
+	}
+
+	// The values are sorted by Calc(), so searching for the first one that's
+	// not under the SLA gives the number of those that are.
+	for _, ms := range sla {
+		under := sort.SearchFloat64s(sink.Values, ms)
+		e.SLAAttainment = append(e.SLAAttainment, 100*float64(under)/float64(sink.Count))
+	}
+
+	// The histogram goes up to p(99), with the slowest 1% in the last bin, so
+	// a few outliers don't squash all the other bins into one.
+	e.HistogramMin, e.HistogramMax = sink.Min, sink.P(0.99)
+	if e.HistogramMax <= sink.Min {
+		e.HistogramMax = sink.Max
+	}
+	counts := make([]int, histogramBins)
+	binWidth := (e.HistogramMax - sink.Min) / histogramBins
+	for _, v := range sink.Values {
+		bin := histogramBins - 1
+		if binWidth > 0 && v < e.HistogramMax {
+			bin = int((v - sink.Min) / binWidth)
+		}
+		counts[bin]++
+	}
+	maxCount := 0
+	for _, c := range counts {
+		if c > maxCount {
+			maxCount = c
+		}
+	}
+	barWidth := float64(histogramWidth) / histogramBins
+	for i, c := range counts {
+		h := math.Round(float64(c) / float64(maxCount) * histogramHeight)
+		from := sink.Min + float64(i)*binWidth
+		label := fmt.Sprintf("%s–%s ms: %d requests", formatMs(from), formatMs(from+binWidth), c)
+		if i == histogramBins-1 {
+			label = fmt.Sprintf("≥ %s ms: %d requests", formatMs(from), c)
+		}
+		e.Histogram = append(e.Histogram, bar{
+			X: float64(i) * barWidth, Y: histogramHeight - h, Width: barWidth - 1, Height: h, Label: label,
+		})
+	}
+	return e
+}
+
+const (
+	timingsLabelWidth = 300
+	timingsBarWidth   = 500
+	timingsRowHeight  = 20
+)
+
+// phaseColors are the colors of the RequestPhases in the timing charts.
+var phaseColors = []string{"#b0b0b0", "#e5d352", "#f2a93b", "#b36ae2", "#3fa7d6", "#59cd90", "#ee6352"} //nolint:gochecknoglobals
+
+type phaseData struct {
+	Name, Color string
+}
+
+func phases() []phaseData {
+	result := make([]phaseData, len(lib.RequestPhases))
+	for i, p := range lib.RequestPhases {
+		result[i] = phaseData{Name: p.Name, Color: phaseColors[i]}
+	}
+	return result
+}
+
+type segment struct {
+	X, Width float64
+	Color    string
+	Label    string
+}
+
+type timingRow struct {
+	Y        float64
+	Label    string
+	Total    float64
+	Segments []segment
+}
+
+// groupTimingsData is a stacked bar chart of the average phase timings of
+// each request in a group, in the order they were first made.
+type groupTimingsData struct {
+	Name   string
+	Height float64
+	Rows   []timingRow
+}
+
+func newGroupTimingsData(group *lib.GroupRequestTimings) groupTimingsData {
+	name := group.Path
+	if name == "" {
+		name = "(root group)"
+	}
+	g := groupTimingsData{Name: name, Height: float64(len(group.Requests) * timingsRowHeight)}
+
+	avgs := make([][]float64, len(group.Requests))
+	maxTotal := 0.0
+	for i, request := range group.Requests {
+		avgs[i] = request.Avg()
+		total := 0.0
+		for _, v := range avgs[i] {
+			total += v
+		}
+		maxTotal = math.Max(maxTotal, total)
+	}
+
+	for i, request := range group.Requests {
+		row := timingRow{
+			Y:     float64(i * timingsRowHeight),
+			Label: fmt.Sprintf("%s %s (%d)", request.Method, request.Name, request.Count),
+		}
+		x := float64(timingsLabelWidth)
+		for j, v := range avgs[i] {
+			row.Total += v
+			if v <= 0 || maxTotal <= 0 {
+				continue
+			}
+			w := v / maxTotal * timingsBarWidth
+			row.Segments = append(row.Segments, segment{
+				X: x, Width: w, Color: phaseColors[j],
+				Label: fmt.Sprintf("%s: %s ms", lib.RequestPhases[j].Name, formatMs(v)),
+			})
+			x += w
+		}
+		g.Rows = append(g.Rows, row)
+	}
+	return g
+}
+
+func formatMs(v float64) string {
+	return fmt.Sprintf("%.2f", v)
+}
+
+func attainmentClass(pct float64) string {
+	switch {
+	case pct >= 99:
+		return "good"
+	case pct >= 95:
+		return "warn"
+	default:
+		return "bad"
+	}
+}
+
+//nolint:gochecknoglobals
+var reportTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"ms":    formatMs,
+	"class": attainmentClass,
+	"pct":   func(v float64) string { return fmt.Sprintf("%.2f%%", v) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.7em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+td.good { background: #d4f7d4; }
+td.warn { background: #fcf3c4; }
+td.bad { background: #f9d0d0; }
+rect { fill: #7d64ff; }
+section { page-break-inside: avoid; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<p>Test started on {{.Date}} and ran for {{.Duration}}.</p>
+
+<h2>SLA attainment</h2>
+<table>
+<tr><th>Endpoint</th><th>Requests</th>{{range .SLA}}<th>&lt; {{ms .}} ms</th>{{end}}</tr>
+{{range .Endpoints}}<tr><td>{{.Name}}</td><td>{{.Count}}</td>{{range .SLAAttainment}}<td class="{{class .}}">{{pct .}}</td>{{end}}</tr>
+{{end}}</table>
+
+<h2>Latency distribution</h2>
+{{range .Endpoints}}<section>
+<h3>{{.Name}}</h3>
+<table>
+<tr>{{range .Percentiles}}<th>{{.Name}}</th>{{end}}</tr>
+<tr>{{range .Percentiles}}<td>{{ms .Value}} ms</td>{{end}}</tr>
+</table>
+{{if .Histogram}}<svg width="600" height="140" viewBox="0 0 600 140">
+{{range .Histogram}}<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Label}}</title></rect>
+{{end}}<text x="0" y="135" font-size="11">{{ms .HistogramMin}} ms</text>
+<text x="600" y="135" font-size="11" text-anchor="end">{{ms .HistogramMax}} ms</text>
+</svg>{{end}}
+</section>
+{{end}}
+{{if .Groups}}<h2>Request timings</h2>
+<p>The average time the requests of each group spent in each phase.</p>
+<p>{{range .Phases}}<span style="color: {{.Color}}">■</span> {{.Name}} {{end}}</p>
+{{range .Groups}}<section>
+<h3>{{.Name}}</h3>
+<svg width="900" height="{{.Height}}" viewBox="0 0 900 {{.Height}}">
+{{range .Rows}}<g transform="translate(0, {{.Y}})">
+<text x="0" y="14" font-size="12">{{.Label}}</text>
+{{range .Segments}}<rect x="{{.X}}" y="2" width="{{.Width}}" height="16" style="fill: {{.Color}}"><title>{{.Label}}</title></rect>
+{{end}}<text x="810" y="14" font-size="12">{{ms .Total}} ms</text>
+</g>
+{{end}}</svg>
+</section>
+{{end}}{{end}}
+</body>
+</html>
+`))
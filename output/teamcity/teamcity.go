@@ -0,0 +1,325 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+// Package teamcity implements an output that prints TeamCity service messages,
+// so that the progress of the test, its thresholds and checks, and the values
+// of its metrics are shown natively on the TeamCity build pages.
+package teamcity
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+const (
+	flushPeriod      = 1 * time.Second
+	progressInterval = 10 * time.Second
+)
+
+//nolint:gochecknoglobals
+var messageEscaper = strings.NewReplacer(
+	"|", "||", "'", "|'", "\n", "|n", "\r", "|r", "[", "|[", "]", "|]",
+	"\u0085", "|x", "\u2028", "|l", "\u2029", "|p",
+)
+
+type check struct {
+	passes, fails int64
+}
+
+// Output aggregates the metric samples and prints TeamCity service messages
+// with the progress of the test while it's running, and with the thresholds
+// and checks as tests and the metric values as build statistics at the end.
+type Output struct {
+	output.SampleBuffer
+
+	params           output.Params
+	logger           logrus.FieldLogger
+	filename         string
+	w                io.Writer
+	closeFn          func() error
+	flusher          *output.PeriodicFlusher
+	progressInterval time.Duration
+	startTime        time.Time
+	lastProgress     time.Time
+	thresholds       map[string]stats.Thresholds
+
+	mu      sync.Mutex
+	metrics map[string]*stats.Metric
+	checks  map[string]*check
+}
+
+// New returns a new TeamCity output.
+func New(params output.Params) (output.Output, error) {
+	return &Output{
+		params:   params,
+		filename: params.ConfigArgument,
+		logger: params.Logger.WithFields(logrus.Fields{
+			"output":   "teamcity",
+			"filename": params.ConfigArgument,
+		}),
+		progressInterval: progressInterval,
+		metrics:          make(map[string]*stats.Metric),
+		checks:           make(map[string]*check),
+	}, nil
+}
+
+// Description returns a human-readable description of the output.
+func (o *Output) Description() string {
+	if o.filename == "" || o.filename == "-" {
+		return "teamcity(stdout)"
+	}
+	return fmt.Sprintf("teamcity (%s)", o.filename)
+}
+
+// SetThresholds receives the thresholds before the output is Start()-ed. They
+// are the same ones the Engine evaluates, so their state at the end of the
+// test is the final one.
+func (o *Output) SetThresholds(thresholds map[string]stats.Thresholds) {
+	o.thresholds = thresholds
+}
+
+// Start opens the file, if there is one, and starts the goroutine that
+// aggregates the buffered samples.
+func (o *Output) Start() error {
+	o.logger.Debug("Starting...")
+	if o.filename == "" || o.filename == "-" {
+		o.w = o.params.StdOut
+		o.closeFn = func() error { return nil }
+	} else {
+		f, err := o.params.FS.Create(o.filename)
+		if err != nil {
+			return err
+		}
+		o.w, o.closeFn = f, f.Close
+	}
+	o.startTime = time.Now()
+	o.lastProgress = o.startTime
+	o.message("testSuiteStarted", "name", "k6")
+
+	pf, err := output.NewPeriodicFlusher(flushPeriod, o.flushMetrics)
+	if err != nil {
+		return err
+	}
+	o.flusher = pf
+	o.logger.Debug("Started!")
+	return nil
+}
+
+// Stop aggregates any remaining samples and prints the thresholds and checks
+// as tests, and the values of the metrics as build statistics.
+func (o *Output) Stop() error {
+	o.logger.Debug("Stopping...")
+	defer o.logger.Debug("Stopped!")
+	o.flusher.Stop()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.params.RuntimeOptions.NoThresholds.Bool {
+		o.reportThresholds()
+	}
+	o.reportChecks()
+	o.message("testSuiteFinished", "name", "k6")
+	o.reportStatistics()
+	return o.closeFn()
+}
+
+// message prints a service message with the given attributes, which are
+// alternating names and values, or with a single value, like progressMessage.
+func (o *Output) message(name string, attrs ...string) {
+	var b strings.Builder
+	b.WriteString("##teamcity[")
+	b.WriteString(name)
+	if len(attrs) == 1 {
+		b.WriteString(" '" + messageEscaper.Replace(attrs[0]) + "'")
+	}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		b.WriteString(" " + attrs[i] + "='" + messageEscaper.Replace(attrs[i+1]) + "'")
+	}
+	b.WriteString("]\n")
+	_, _ = io.WriteString(o.w, b.String())
+}
+
+// checkName returns the name of a check, prefixed with the path of its group.
+func checkName(tags *stats.SampleTags) string {
+	name, _ := tags.Get("check")
+	group, _ := tags.Get("group")
+	if group = strings.TrimPrefix(group, lib.GroupSeparator); group != "" {
+		return strings.ReplaceAll(group, lib.GroupSeparator, " › ") + " › " + name
+	}
+	return name
+}
+
+func (o *Output) flushMetrics() {
+	samples := o.GetBufferedSamples()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, sc := range samples {
+		for _, sample := range sc.GetSamples() {
+			m, ok := o.metrics[sample.Metric.Name]
+			if !ok {
+				m = stats.New(sample.Metric.Name, sample.Metric.Type, sample.Metric.Contains)
+				o.metrics[m.Name] = m
+			}
+			m.Sink.Add(sample)
+
+			if sample.Metric.Name != metrics.Checks.Name {
+				continue
+			}
+			name := checkName(sample.Tags)
+			c, ok := o.checks[name]
+			if !ok {
+				c = &check{}
+				o.checks[name] = c
+			}
+			if sample.Value == 0 {
+				c.fails++
+			} else {
+				c.passes++
+			}
+		}
+	}
+	o.ReleaseBufferedSamples(samples)
+
+	if now := time.Now(); now.Sub(o.lastProgress) >= o.progressInterval {
+		o.lastProgress = now
+		o.message("progressMessage", o.progressText(now.Sub(o.startTime)))
+	}
+}
+
+func (o *Output) counterValue(name string) int64 {
+	if m, ok := o.metrics[name]; ok {
+		if sink, ok := m.Sink.(*stats.CounterSink); ok {
+			return int64(sink.Value)
+		}
+	}
+	return 0
+}
+
+func (o *Output) progressText(elapsed time.Duration) string {
+	var checkFails int64
+	for _, c := range o.checks {
+		checkFails += c.fails
+	}
+	return fmt.Sprintf("k6: %s elapsed, %d complete iterations, %d HTTP requests, %d failed checks",
+		elapsed.Round(time.Second), o.counterValue(metrics.Iterations.Name),
+		o.counterValue(metrics.HTTPReqs.Name), checkFails)
+}
+
+func (o *Output) reportThresholds() {
+	names := make([]string, 0, len(o.thresholds))
+	for name := range o.thresholds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	o.message("testSuiteStarted", "name", "thresholds")
+	for _, name := range names {
+		for _, th := range o.thresholds[name].Thresholds {
+			testName := name + ": " + th.Source
+			o.message("testStarted", "name", testName)
+			if th.LastFailed {
+				o.message("testFailed", "name", testName, "message", "threshold crossed",
+					"details", o.metricDetails(name))
+			}
+			o.message("testFinished", "name", testName)
+		}
+	}
+	o.message("testSuiteFinished", "name", "thresholds")
+}
+
+// metricDetails returns the values of a metric, to show why a threshold on
+// it failed.
+func (o *Output) metricDetails(name string) string {
+	m, ok := o.metrics[name]
+	if !ok {
+		return "no samples"
+	}
+	values := m.Sink.Format(time.Since(o.startTime))
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, k := range keys {
+		parts[i] = k + "=" + strconv.FormatFloat(values[k], 'f', -1, 64)
+	}
+	return strings.Join(parts, " ")
+}
+
+func (o *Output) reportChecks() {
+	if len(o.checks) == 0 {
+		return
+	}
+	names := make([]string, 0, len(o.checks))
+	for name := range o.checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	o.message("testSuiteStarted", "name", "checks")
+	for _, name := range names {
+		c := o.checks[name]
+		o.message("testStarted", "name", name)
+		if c.fails > 0 {
+			o.message("testFailed", "name", name, "message",
+				fmt.Sprintf("%d of %d failed", c.fails, c.passes+c.fails))
+		}
+		o.message("testFinished", "name", name)
+	}
+	o.message("testSuiteFinished", "name", "checks")
+}
+
+// reportStatistics prints the values of the metrics as build statistics,
+// with keys like k6.http_req_duration.p(95), so they can be charted across
+// builds in TeamCity.
+func (o *Output) reportStatistics() {
+	names := make([]string, 0, len(o.metrics))
+	for name := range o.metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	elapsed := time.Since(o.startTime)
+	for _, name := range names {
+		values := o.metrics[name].Sink.Format(elapsed)
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			o.message("buildStatisticValue", "key", "k6."+name+"."+k,
+				"value", strconv.FormatFloat(values[k], 'f', -1, 64))
+		}
+	}
+}
@@ -0,0 +1,94 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package teamcity
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/loadimpact/k6/lib/metrics"
+	"github.com/loadimpact/k6/lib/testutils"
+	"github.com/loadimpact/k6/output"
+	"github.com/loadimpact/k6/stats"
+)
+
+func TestMessageEscaping(t *testing.T) {
+	t.Parallel()
+	var buf bytes.Buffer
+	o := &Output{w: &buf}
+	o.message("testFailed", "name", "it's [1|2]", "details", "a\nb")
+	assert.Equal(t, "##teamcity[testFailed name='it|'s |[1||2|]' details='a|nb']\n", buf.String())
+}
+
+func TestTeamCityOutput(t *testing.T) {
+	t.Parallel()
+	var stdout bytes.Buffer
+	out, err := New(output.Params{
+		Logger: testutils.NewLogger(t),
+		StdOut: &stdout,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "teamcity(stdout)", out.Description())
+
+	thresholds, err := stats.NewThresholds([]string{"count<10", "rate<1"})
+	require.NoError(t, err)
+	thresholds.Thresholds[1].LastFailed = true
+	o := out.(*Output)
+	o.SetThresholds(map[string]stats.Thresholds{metrics.HTTPReqs.Name: thresholds})
+	o.progressInterval = 0
+	require.NoError(t, o.Start())
+
+	now := time.Now()
+	checkTags := func(group, check string) *stats.SampleTags {
+		return stats.NewSampleTags(map[string]string{"group": group, "check": check})
+	}
+	o.AddMetricSamples([]stats.SampleContainer{
+		stats.Sample{Time: now, Metric: metrics.HTTPReqs, Value: 1, Tags: stats.NewSampleTags(nil)},
+		stats.Sample{Time: now, Metric: metrics.HTTPReqs, Value: 1, Tags: stats.NewSampleTags(nil)},
+		stats.Sample{Time: now, Metric: metrics.Iterations, Value: 1, Tags: stats.NewSampleTags(nil)},
+		stats.Sample{Time: now, Metric: metrics.Checks, Value: 1, Tags: checkTags("", "status is 200")},
+		stats.Sample{Time: now, Metric: metrics.Checks, Value: 0, Tags: checkTags("::login", "has token")},
+		stats.Sample{Time: now, Metric: metrics.Checks, Value: 1, Tags: checkTags("::login", "has token")},
+	})
+	require.NoError(t, o.Stop())
+
+	messages := stdout.String()
+	assert.Contains(t, messages, "##teamcity[testSuiteStarted name='k6']\n")
+	assert.Contains(t, messages, "##teamcity[progressMessage 'k6: ")
+	assert.Contains(t, messages, "1 complete iterations, 2 HTTP requests, 1 failed checks']\n")
+	assert.Contains(t, messages, "##teamcity[testStarted name='http_reqs: count<10']\n"+
+		"##teamcity[testFinished name='http_reqs: count<10']\n"+
+		"##teamcity[testStarted name='http_reqs: rate<1']\n"+
+		"##teamcity[testFailed name='http_reqs: rate<1' message='threshold crossed' details='count=2 rate=")
+	assert.Contains(t, messages, "##teamcity[testStarted name='login › has token']\n"+
+		"##teamcity[testFailed name='login › has token' message='1 of 2 failed']\n"+
+		"##teamcity[testFinished name='login › has token']\n"+
+		"##teamcity[testStarted name='status is 200']\n"+
+		"##teamcity[testFinished name='status is 200']\n"+
+		"##teamcity[testSuiteFinished name='checks']\n"+
+		"##teamcity[testSuiteFinished name='k6']\n")
+	assert.Contains(t, messages, "##teamcity[buildStatisticValue key='k6.http_reqs.count' value='2']\n")
+	assert.Contains(t, messages, "##teamcity[buildStatisticValue key='k6.checks.rate' value='0.6666666666666666']\n")
+}
@@ -80,8 +80,13 @@ type WithThresholds interface {
 	SetThresholds(map[string]stats.Thresholds)
 }
 
-// TODO: add some way for outputs to report mid-test errors and potentially
-// abort the whole test run
+// WithTestRunStop is an output that can stop the whole test run mid-test,
+// e.g. because a remote service decided that the test has failed. The Engine
+// gives it a callback that should be called with the reason for the stop.
+type WithTestRunStop interface {
+	Output
+	SetTestRunStopCallback(func(error))
+}
 
 // WithRunStatusUpdates means the output can receive test run status updates.
 type WithRunStatusUpdates interface {
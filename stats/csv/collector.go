@@ -22,13 +22,11 @@ package csv
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/csv"
 	"fmt"
 	"os"
 	"sort"
-	"strings"
 	"sync"
 	"time"
 
@@ -36,6 +34,7 @@ import (
 	"github.com/spf13/afero"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/output"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -43,6 +42,8 @@ import (
 type Collector struct {
 	closeFn      func() error
 	fname        string
+	file         *output.FileWriter
+	needsHeader  bool
 	resTags      []string
 	ignoredTags  []string
 	csvWriter    *csv.Writer
@@ -88,46 +89,47 @@ func New(logger logrus.FieldLogger, fs afero.Fs, tags stats.TagSet, config Confi
 		}, nil
 	}
 
-	logFile, err := fs.Create(fname)
+	fileConf := output.FileWriterConfig{MaxAge: time.Duration(config.RotateInterval.Duration)}
+	if config.Rotate.String != "" {
+		maxSize, err := output.ParseSize(config.Rotate.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv rotate value: %w", err)
+		}
+		fileConf.MaxSize = maxSize
+	}
+
+	// The file is compressed with gzip or zstd if it has a .gz or .zst extension
+	file, err := output.NewFileWriter(fs, fname, fileConf)
 	if err != nil {
 		return nil, err
 	}
 
-	c := Collector{
+	return &Collector{
 		fname:        fname,
+		file:         file,
 		resTags:      resTags,
 		ignoredTags:  ignoredTags,
+		csvWriter:    csv.NewWriter(file),
 		row:          make([]string, 3+len(resTags)+1),
 		saveInterval: saveInterval,
+		closeFn:      file.Close,
 		logger:       logger,
-	}
-
-	if strings.HasSuffix(fname, ".gz") {
-		outfile := gzip.NewWriter(logFile)
-		csvWriter := csv.NewWriter(outfile)
-		c.csvWriter = csvWriter
-		c.closeFn = func() error {
-			_ = outfile.Close()
-			return logFile.Close()
-		}
-	} else {
-		csvWriter := csv.NewWriter(logFile)
-		c.csvWriter = csvWriter
-		c.closeFn = logFile.Close
-	}
-
-	return &c, nil
+	}, nil
 }
 
 // Init writes column names to csv file
 func (c *Collector) Init() error {
+	c.writeHeader()
+	return nil
+}
+
+func (c *Collector) writeHeader() {
 	header := MakeHeader(c.resTags)
 	err := c.csvWriter.Write(header)
 	if err != nil {
 		c.logger.WithField("filename", c.fname).Error("CSV: Error writing column names to file")
 	}
 	c.csvWriter.Flush()
-	return nil
 }
 
 // Run just blocks until the context is done
@@ -170,6 +172,10 @@ func (c *Collector) writeToFile() {
 	if len(samples) > 0 {
 		c.csvLock.Lock()
 		defer c.csvLock.Unlock()
+		if c.needsHeader {
+			c.writeHeader()
+			c.needsHeader = false
+		}
 		for _, sc := range samples {
 			for _, sample := range sc.GetSamples() {
 				sample := sample
@@ -181,6 +187,24 @@ func (c *Collector) writeToFile() {
 			}
 		}
 		c.csvWriter.Flush()
+		c.rotate()
+	}
+}
+
+// rotate closes the current file if it's too big or too old, so the next
+// samples are written to a new one, with its own column names.
+func (c *Collector) rotate() {
+	if c.file == nil {
+		return
+	}
+	rotated, err := c.file.Rotate()
+	if err != nil {
+		c.logger.WithField("filename", c.fname).WithError(err).Error("CSV: Error rotating the file")
+		return
+	}
+	if rotated {
+		c.logger.WithField("filename", c.file.Name()).Debug("CSV: Rotated the file")
+		c.needsHeader = true
 	}
 }
 
@@ -32,6 +32,7 @@ import (
 
 	"github.com/spf13/afero"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/lib/testutils"
@@ -473,3 +474,42 @@ func TestLink(t *testing.T) {
 	assert.NotNil(t, collector)
 	assert.Equal(t, "path", collector.Link())
 }
+
+func TestRunRotate(t *testing.T) {
+	mem := afero.NewMemMapFs()
+	collector, err := New(
+		testutils.NewLogger(t),
+		mem,
+		stats.TagSet{"tag1": true},
+		Config{FileName: null.StringFrom("test.csv"), Rotate: null.StringFrom("1B")},
+	)
+	require.NoError(t, err)
+	require.NoError(t, collector.Init())
+
+	metric := stats.New("my_metric", stats.Gauge)
+	tags := stats.NewSampleTags(map[string]string{"tag1": "val1"})
+	collector.Collect([]stats.SampleContainer{stats.Sample{Time: time.Unix(1562324643, 0), Metric: metric, Value: 1, Tags: tags}})
+	collector.writeToFile()
+	collector.Collect([]stats.SampleContainer{stats.Sample{Time: time.Unix(1562324644, 0), Metric: metric, Value: 2, Tags: tags}})
+	collector.writeToFile()
+	collector.writeToFile()
+	require.NoError(t, collector.closeFn())
+
+	assert.Equal(t, "metric_name,timestamp,metric_value,tag1,extra_tags\n"+"my_metric,1562324643,1.000000,val1,\n",
+		readUnCompressedFile("test.csv", mem))
+	assert.Equal(t, "metric_name,timestamp,metric_value,tag1,extra_tags\n"+"my_metric,1562324644,2.000000,val1,\n",
+		readUnCompressedFile("test.1.csv", mem))
+	exists, err := afero.Exists(mem, "test.2.csv")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestNewInvalidRotate(t *testing.T) {
+	_, err := New(
+		testutils.NewLogger(t),
+		afero.NewMemMapFs(),
+		stats.TagSet{"tag1": true},
+		Config{FileName: null.StringFrom("test.csv"), Rotate: null.StringFrom("lots")},
+	)
+	assert.EqualError(t, err, "invalid csv rotate value: invalid size 'lots'")
+}
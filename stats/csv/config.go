@@ -37,6 +37,10 @@ type Config struct {
 	// Samples.
 	FileName     null.String        `json:"file_name" envconfig:"K6_CSV_FILENAME"`
 	SaveInterval types.NullDuration `json:"save_interval" envconfig:"K6_CSV_SAVE_INTERVAL"`
+
+	// File rotation.
+	Rotate         null.String        `json:"rotate" envconfig:"K6_CSV_ROTATE"`
+	RotateInterval types.NullDuration `json:"rotate_interval" envconfig:"K6_CSV_ROTATE_INTERVAL"`
 }
 
 // NewConfig creates a new Config instance with default values for some fields.
@@ -55,6 +59,12 @@ func (c Config) Apply(cfg Config) Config {
 	if cfg.SaveInterval.Valid {
 		c.SaveInterval = cfg.SaveInterval
 	}
+	if cfg.Rotate.Valid {
+		c.Rotate = cfg.Rotate
+	}
+	if cfg.RotateInterval.Valid {
+		c.RotateInterval = cfg.RotateInterval
+	}
 	return c
 }
 
@@ -69,8 +79,13 @@ func ParseArg(arg string) (Config, error) {
 	}
 
 	pairs := strings.Split(arg, ",")
-	for _, pair := range pairs {
+	for i, pair := range pairs {
 		r := strings.SplitN(pair, "=", 2)
+		if len(r) == 1 && i == 0 {
+			// results.csv,rotate=500MB
+			c.FileName = null.StringFrom(r[0])
+			continue
+		}
 		if len(r) != 2 {
 			return c, fmt.Errorf("couldn't parse %q as argument for csv output", arg)
 		}
@@ -82,6 +97,13 @@ func ParseArg(arg string) (Config, error) {
 			}
 		case "file_name":
 			c.FileName = null.StringFrom(r[1])
+		case "rotate":
+			c.Rotate = null.StringFrom(r[1])
+		case "rotate_interval":
+			err := c.RotateInterval.UnmarshalText([]byte(r[1]))
+			if err != nil {
+				return c, err
+			}
 		default:
 			return c, fmt.Errorf("unknown key %q as argument for csv output", r[0])
 		}
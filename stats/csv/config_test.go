@@ -99,6 +99,19 @@ func TestParseArg(t *testing.T) {
 		"filename=test.csv,save_interval=5s": {
 			expectedErr: true,
 		},
+		"results.csv.gz,rotate=500MB,rotate_interval=1h": {
+			config: Config{
+				FileName:       null.StringFrom("results.csv.gz"),
+				Rotate:         null.StringFrom("500MB"),
+				RotateInterval: types.NullDurationFrom(1 * time.Hour),
+			},
+		},
+		"results.csv,rotate_interval=1x": {
+			config: Config{
+				FileName: null.StringFrom("results.csv"),
+			},
+			expectedErr: true,
+		},
 	}
 
 	for arg, testCase := range cases {
@@ -115,6 +128,8 @@ func TestParseArg(t *testing.T) {
 			}
 			assert.Equal(t, testCase.config.FileName.String, config.FileName.String)
 			assert.Equal(t, testCase.config.SaveInterval.String(), config.SaveInterval.String())
+			assert.Equal(t, testCase.config.Rotate, config.Rotate)
+			assert.Equal(t, testCase.config.RotateInterval, config.RotateInterval)
 		})
 	}
 }
@@ -47,11 +47,13 @@ func (t tagHandler) processTags(tags map[string]string) []string {
 
 // Config defines the Datadog configuration.
 type Config struct {
-	Addr         null.String        `json:"addr,omitempty" envconfig:"K6_DATADOG_ADDR"`
-	BufferSize   null.Int           `json:"bufferSize,omitempty" envconfig:"K6_DATADOG_BUFFER_SIZE"`
-	Namespace    null.String        `json:"namespace,omitempty" envconfig:"K6_DATADOG_NAMESPACE"`
-	PushInterval types.NullDuration `json:"pushInterval,omitempty" envconfig:"K6_DATADOG_PUSH_INTERVAL"`
-	TagBlacklist stats.TagSet       `json:"tagBlacklist,omitempty" envconfig:"K6_DATADOG_TAG_BLACKLIST"`
+	Addr            null.String        `json:"addr,omitempty" envconfig:"K6_DATADOG_ADDR"`
+	BufferSize      null.Int           `json:"bufferSize,omitempty" envconfig:"K6_DATADOG_BUFFER_SIZE"`
+	Namespace       null.String        `json:"namespace,omitempty" envconfig:"K6_DATADOG_NAMESPACE"`
+	PushInterval    types.NullDuration `json:"pushInterval,omitempty" envconfig:"K6_DATADOG_PUSH_INTERVAL"`
+	BatchMaxSamples null.Int           `json:"batchMaxSamples,omitempty" envconfig:"K6_DATADOG_BATCH_MAX_SAMPLES"`
+	BatchMaxBytes   null.Int           `json:"batchMaxBytes,omitempty" envconfig:"K6_DATADOG_BATCH_MAX_BYTES"`
+	TagBlacklist    stats.TagSet       `json:"tagBlacklist,omitempty" envconfig:"K6_DATADOG_TAG_BLACKLIST"`
 }
 
 // GetAddr returns the address of the DogStatsD service.
@@ -74,6 +76,16 @@ func (c Config) GetPushInterval() types.NullDuration {
 	return c.PushInterval
 }
 
+// GetBatchMaxSamples returns the number of samples that triggers a push.
+func (c Config) GetBatchMaxSamples() null.Int {
+	return c.BatchMaxSamples
+}
+
+// GetBatchMaxBytes returns the approximate batch size that triggers a push.
+func (c Config) GetBatchMaxBytes() null.Int {
+	return c.BatchMaxBytes
+}
+
 var _ common.Config = &Config{}
 
 // Apply saves config non-zero config values from the passed config in the receiver.
@@ -90,6 +102,12 @@ func (c Config) Apply(cfg Config) Config {
 	if cfg.PushInterval.Valid {
 		c.PushInterval = cfg.PushInterval
 	}
+	if cfg.BatchMaxSamples.Valid {
+		c.BatchMaxSamples = cfg.BatchMaxSamples
+	}
+	if cfg.BatchMaxBytes.Valid {
+		c.BatchMaxBytes = cfg.BatchMaxBytes
+	}
 	if cfg.TagBlacklist != nil {
 		c.TagBlacklist = cfg.TagBlacklist
 	}
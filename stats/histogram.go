@@ -0,0 +1,302 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	// DefaultHistogramScale is the initial scale of the histogram sinks. The
+	// bucket boundaries grow by a factor of 2^(2^-scale), so about 0.27% for
+	// 8, which is also the highest Prometheus native histogram schema.
+	DefaultHistogramScale = 8
+	// MaxHistogramBuckets is the maximum number of buckets between the
+	// lowest and the highest one, for each sign. When the samples span more
+	// than that, the scale of the histogram is reduced.
+	MaxHistogramBuckets = 160
+	// MinHistogramScale is the lowest scale a histogram is reduced to.
+	MinHistogramScale = -10
+)
+
+var _ Sink = &HistogramSink{}
+
+// HistogramSink is a sparse histogram with exponential buckets, in the same
+// format as the OpenTelemetry exponential histograms and the Prometheus
+// native histograms. Unlike the TrendSink, it uses a bounded amount of memory
+// and can be merged with other histograms, at the cost of the percentiles
+// being approximate.
+//
+// The bucket with index i contains the values in (base^i, base^(i+1)], where
+// base is 2^(2^-Scale). The negative values are in the Negative buckets by
+// their absolute value, and the zeroes are counted separately.
+type HistogramSink struct {
+	Scale     int32            `json:"scale"`
+	Count     uint64           `json:"count"`
+	Sum       float64          `json:"sum"`
+	Min       float64          `json:"min"`
+	Max       float64          `json:"max"`
+	ZeroCount uint64           `json:"zeroCount"`
+	Positive  map[int32]uint64 `json:"positive,omitempty"`
+	Negative  map[int32]uint64 `json:"negative,omitempty"`
+}
+
+// Add adds a sample to the histogram.
+func (h *HistogramSink) Add(s Sample) {
+	v := s.Value
+	if h.Count == 0 {
+		h.Scale = DefaultHistogramScale
+		h.Min, h.Max = v, v
+	}
+	h.Count++
+	h.Sum += v
+	if v < h.Min {
+		h.Min = v
+	}
+	if v > h.Max {
+		h.Max = v
+	}
+
+	switch {
+	case v > 0:
+		h.addToBucket(&h.Positive, histogramIndex(v, h.Scale), 1)
+	case v < 0:
+		h.addToBucket(&h.Negative, histogramIndex(-v, h.Scale), 1)
+	default:
+		h.ZeroCount++
+	}
+}
+
+// Merge adds the samples of the other histogram to this one. The result has
+// the lower of the two scales.
+func (h *HistogramSink) Merge(other *HistogramSink) {
+	if other.Count == 0 {
+		return
+	}
+	if h.Count == 0 {
+		h.Scale, h.Min, h.Max = other.Scale, other.Min, other.Max
+	}
+	if other.Scale < h.Scale {
+		h.downscale(h.Scale - other.Scale)
+	}
+
+	h.Count += other.Count
+	h.Sum += other.Sum
+	h.ZeroCount += other.ZeroCount
+	h.Min = math.Min(h.Min, other.Min)
+	h.Max = math.Max(h.Max, other.Max)
+	// The scale can get lower while the buckets are added
+	for i, c := range other.Positive {
+		h.addToBucket(&h.Positive, i>>(other.Scale-h.Scale), c)
+	}
+	for i, c := range other.Negative {
+		h.addToBucket(&h.Negative, i>>(other.Scale-h.Scale), c)
+	}
+}
+
+// addToBucket adds the count to the bucket with the given index and reduces
+// the scale if the buckets then span too many indexes.
+func (h *HistogramSink) addToBucket(buckets *map[int32]uint64, index int32, count uint64) {
+	if *buckets == nil {
+		*buckets = make(map[int32]uint64)
+	}
+	_, exists := (*buckets)[index]
+	(*buckets)[index] += count
+	for !exists && h.Scale > MinHistogramScale && bucketSpan(*buckets) > MaxHistogramBuckets {
+		h.downscale(1)
+	}
+}
+
+// downscale reduces the scale by the given amount, which merges every 2^by
+// neighbouring buckets into one.
+func (h *HistogramSink) downscale(by int32) {
+	if by <= 0 {
+		return
+	}
+	merge := func(buckets map[int32]uint64) map[int32]uint64 {
+		if buckets == nil {
+			return nil
+		}
+		result := make(map[int32]uint64, len(buckets))
+		for i, c := range buckets {
+			result[i>>by] += c
+		}
+		return result
+	}
+	h.Positive, h.Negative = merge(h.Positive), merge(h.Negative)
+	h.Scale -= by
+}
+
+// Calc does nothing, the histogram is always up to date.
+func (h *HistogramSink) Calc() {}
+
+// P returns an estimate of the given percentile, interpolated linearly in the
+// bucket that contains it. Like with the TrendSink, the percentile is at the
+// pct*(count-1) index of the sorted values.
+func (h *HistogramSink) P(pct float64) float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	if pct <= 0 {
+		return h.Min
+	}
+	rank := pct*float64(h.Count-1) + 1
+
+	var seen float64
+	var result float64
+	found := false
+	h.forEachBucket(func(lower, upper float64, count uint64) bool {
+		if seen+float64(count) < rank {
+			seen += float64(count)
+			return true
+		}
+		result = lower + (upper-lower)*(rank-seen)/float64(count)
+		found = true
+		return false
+	})
+	if !found {
+		return h.Max
+	}
+	return math.Max(h.Min, math.Min(h.Max, result))
+}
+
+// forEachBucket calls fn with the bounds and counts of the non-empty buckets,
+// from the lowest values to the highest ones, until it returns false.
+func (h *HistogramSink) forEachBucket(fn func(lower, upper float64, count uint64) bool) {
+	for _, i := range sortedBucketIndexes(h.Negative, true) {
+		if !fn(-HistogramBucketBound(i+1, h.Scale), -HistogramBucketBound(i, h.Scale), h.Negative[i]) {
+			return
+		}
+	}
+	if h.ZeroCount > 0 && !fn(0, 0, h.ZeroCount) {
+		return
+	}
+	for _, i := range sortedBucketIndexes(h.Positive, false) {
+		if !fn(HistogramBucketBound(i, h.Scale), HistogramBucketBound(i+1, h.Scale), h.Positive[i]) {
+			return
+		}
+	}
+}
+
+// Avg returns the average of the added values.
+func (h *HistogramSink) Avg() float64 {
+	if h.Count == 0 {
+		return 0
+	}
+	return h.Sum / float64(h.Count)
+}
+
+// Format returns the same values as a TrendSink, for thresholds.
+func (h *HistogramSink) Format(t time.Duration) map[string]float64 {
+	return map[string]float64{
+		"min":   h.Min,
+		"max":   h.Max,
+		"avg":   h.Avg(),
+		"med":   h.P(0.5),
+		"p(90)": h.P(0.90),
+		"p(95)": h.P(0.95),
+	}
+}
+
+// DenseBuckets returns the index of the first bucket and the counts of all
+// buckets from it to the last non-empty one, which is how both the OTLP
+// exponential histograms and the Prometheus native histogram spans expect
+// them.
+func (h *HistogramSink) DenseBuckets(negative bool) (offset int32, counts []uint64) {
+	buckets := h.Positive
+	if negative {
+		buckets = h.Negative
+	}
+	indexes := sortedBucketIndexes(buckets, false)
+	if len(indexes) == 0 {
+		return 0, nil
+	}
+	offset = indexes[0]
+	counts = make([]uint64, indexes[len(indexes)-1]-offset+1)
+	for _, i := range indexes {
+		counts[i-offset] = buckets[i]
+	}
+	return offset, counts
+}
+
+// HistogramBucketBound returns the lower bound of the bucket with the given
+// index, which is also the upper bound of the previous bucket.
+func HistogramBucketBound(index, scale int32) float64 {
+	return math.Exp2(math.Ldexp(float64(index), -int(scale)))
+}
+
+// histogramIndex returns the index of the bucket for the positive value.
+func histogramIndex(v float64, scale int32) int32 {
+	frac, exp := math.Frexp(v) // v = frac * 2^exp, with frac in [0.5, 1)
+	if scale <= 0 {
+		// The buckets contain whole powers of two, so the exponent is enough.
+		// Exact powers of two are the upper bounds of their buckets.
+		if frac == 0.5 {
+			return int32(exp-2) >> -scale
+		}
+		return int32(exp-1) >> -scale
+	}
+	if frac == 0.5 {
+		return int32(exp-1)<<scale - 1
+	}
+	index := int32(math.Ceil(math.Ldexp(math.Log2(v), int(scale)))) - 1
+	// Correct any floating point errors near the bucket bounds
+	if v <= HistogramBucketBound(index, scale) {
+		index--
+	} else if v > HistogramBucketBound(index+1, scale) {
+		index++
+	}
+	return index
+}
+
+func bucketSpan(buckets map[int32]uint64) int32 {
+	first := true
+	var min, max int32
+	for i := range buckets {
+		if first || i < min {
+			min = i
+		}
+		if first || i > max {
+			max = i
+		}
+		first = false
+	}
+	if first {
+		return 0
+	}
+	return max - min + 1
+}
+
+func sortedBucketIndexes(buckets map[int32]uint64, descending bool) []int32 {
+	indexes := make([]int32, 0, len(buckets))
+	for i := range buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Slice(indexes, func(a, b int) bool {
+		if descending {
+			return indexes[a] > indexes[b]
+		}
+		return indexes[a] < indexes[b]
+	})
+	return indexes
+}
@@ -0,0 +1,208 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHistogramIndex(t *testing.T) {
+	t.Parallel()
+	for _, scale := range []int32{-3, -1, 0, 1, 3, 8} {
+		for _, v := range []float64{1e-9, 0.001, 0.5, 1, 1.5, 2, 3, 4, 100, 1024, 1e9} {
+			i := histogramIndex(v, scale)
+			assert.Truef(t, v > HistogramBucketBound(i, scale), "%g at scale %d in bucket %d", v, scale, i)
+			assert.Truef(t, v <= HistogramBucketBound(i+1, scale), "%g at scale %d in bucket %d", v, scale, i)
+		}
+	}
+	assert.Equal(t, int32(-1), histogramIndex(1, 8))
+	assert.Equal(t, int32(255), histogramIndex(2, 8))
+	assert.Equal(t, int32(1), histogramIndex(3, 0))
+	assert.Equal(t, int32(0), histogramIndex(16, -2))
+	assert.Equal(t, int32(1), histogramIndex(17, -2))
+}
+
+func TestHistogramSink(t *testing.T) {
+	t.Parallel()
+
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+		sink := HistogramSink{}
+		assert.Equal(t, 0.0, sink.P(0.5))
+		assert.Equal(t, 0.0, sink.Avg())
+		offset, counts := sink.DenseBuckets(false)
+		assert.Equal(t, int32(0), offset)
+		assert.Nil(t, counts)
+	})
+
+	t.Run("values", func(t *testing.T) {
+		t.Parallel()
+		sink := HistogramSink{}
+		for _, v := range []float64{-2, 0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 100} {
+			sink.Add(Sample{Value: v})
+		}
+		// 1 to 100 don't fit in 160 buckets until scale 4
+		assert.Equal(t, int32(4), sink.Scale)
+		assert.Equal(t, uint64(12), sink.Count)
+		assert.Equal(t, 143.0, sink.Sum)
+		assert.Equal(t, -2.0, sink.Min)
+		assert.Equal(t, 100.0, sink.Max)
+		assert.Equal(t, uint64(1), sink.ZeroCount)
+		assert.Equal(t, map[int32]uint64{15: 1}, sink.Negative)
+		assert.Len(t, sink.Positive, 10)
+
+		format := sink.Format(0)
+		assert.InDelta(t, 143.0/12, format["avg"], 0.0001)
+		assert.Equal(t, -2.0, format["min"])
+		assert.Equal(t, 100.0, format["max"])
+		// The percentiles are interpolated in their buckets, not between the
+		// neighbouring values like with trends
+		assert.InDelta(t, 5, format["med"], 0.1)
+		assert.InDelta(t, 9, format["p(90)"], 0.1)
+		assert.Equal(t, 100.0, sink.P(1))
+		assert.Equal(t, -2.0, sink.P(0))
+	})
+
+	t.Run("downscale", func(t *testing.T) {
+		t.Parallel()
+		sink := HistogramSink{}
+		for v := 1.0; v < 1e12; v *= 1.5 {
+			sink.Add(Sample{Value: v})
+		}
+		assert.True(t, sink.Scale < DefaultHistogramScale)
+		assert.True(t, bucketSpan(sink.Positive) <= MaxHistogramBuckets)
+		offset, counts := sink.DenseBuckets(false)
+		assert.Equal(t, int32(len(counts)), bucketSpan(sink.Positive))
+		assert.Equal(t, histogramIndex(1, sink.Scale), offset)
+		var total uint64
+		for _, c := range counts {
+			total += c
+		}
+		assert.Equal(t, sink.Count, total)
+	})
+
+	t.Run("percentiles", func(t *testing.T) {
+		t.Parallel()
+		r := rand.New(rand.NewSource(1)) //nolint:gosec
+		sink := HistogramSink{}
+		values := make([]float64, 10000)
+		for i := range values {
+			values[i] = r.ExpFloat64() * 100
+			sink.Add(Sample{Value: values[i]})
+		}
+		sort.Float64s(values)
+		for _, pct := range []float64{0.5, 0.9, 0.95, 0.99} {
+			exact := values[int(pct*float64(len(values)))]
+			assert.InEpsilon(t, exact, sink.P(pct), 0.02, pct)
+		}
+	})
+}
+
+func TestHistogramSinkMerge(t *testing.T) {
+	t.Parallel()
+	all, first, second := HistogramSink{}, HistogramSink{}, HistogramSink{}
+	for i := 0; i < 200; i++ {
+		v := math.Pow(1.1, float64(i)) - 10
+		all.Add(Sample{Value: v})
+		if i%3 == 0 {
+			first.Add(Sample{Value: v})
+		} else {
+			second.Add(Sample{Value: v})
+		}
+	}
+	// Reduce the scale of one of the sinks, the result should have the
+	// lower scale
+	first.downscale(2)
+
+	merged := HistogramSink{}
+	merged.Merge(&first)
+	merged.Merge(&HistogramSink{})
+	merged.Merge(&second)
+	all.downscale(all.Scale - merged.Scale)
+	assert.Equal(t, all.Scale, merged.Scale)
+	assert.Equal(t, all.Count, merged.Count)
+	assert.InDelta(t, all.Sum, merged.Sum, 1e-6)
+	assert.Equal(t, all.Min, merged.Min)
+	assert.Equal(t, all.Max, merged.Max)
+	assert.Equal(t, all.ZeroCount, merged.ZeroCount)
+	assert.Equal(t, all.Positive, merged.Positive)
+	assert.Equal(t, all.Negative, merged.Negative)
+}
+
+func TestHistogramSinkJSON(t *testing.T) {
+	t.Parallel()
+	sink := HistogramSink{}
+	for _, v := range []float64{-1, 0, 0.5, 2} {
+		sink.Add(Sample{Value: v, Time: time.Now()})
+	}
+	data, err := json.Marshal(&sink)
+	require.NoError(t, err)
+	var decoded HistogramSink
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, sink, decoded)
+}
+
+func TestHistogramSinkThresholds(t *testing.T) {
+	t.Parallel()
+	sink := &HistogramSink{}
+	for i := 1; i <= 1000; i++ {
+		sink.Add(Sample{Value: float64(i)})
+	}
+	// Both the precompiled and the JS thresholds use the percentiles
+	ts, err := NewThresholds([]string{`p(99)<=1000`, `p(99.9)>990`, `(p(50)>490 && med<510)`, `avg==500.5`})
+	require.NoError(t, err)
+	b, err := ts.Run(sink, time.Second)
+	require.NoError(t, err)
+	assert.True(t, b)
+
+	ts, err = NewThresholds([]string{`p(95)<900`})
+	require.NoError(t, err)
+	b, err = ts.Run(sink, time.Second)
+	require.NoError(t, err)
+	assert.False(t, b)
+}
+
+func TestResolversForHistogramColumns(t *testing.T) {
+	t.Parallel()
+	sink := &HistogramSink{}
+	for _, v := range []float64{1, 2, 3} {
+		sink.Add(Sample{Value: v})
+	}
+	res, err := GetResolversForHistogramColumns([]string{"avg", "min", "med", "max", "count", "p(99.9)"})
+	require.NoError(t, err)
+	assert.Equal(t, 2.0, res["avg"](sink))
+	assert.Equal(t, 1.0, res["min"](sink))
+	assert.InDelta(t, 2.0, res["med"](sink), 0.01)
+	assert.Equal(t, 3.0, res["max"](sink))
+	assert.Equal(t, 3.0, res["count"](sink))
+	assert.InDelta(t, 3.0, res["p(99.9)"](sink), 0.01)
+
+	_, err = GetResolversForHistogramColumns([]string{"p(101)"})
+	assert.Error(t, err)
+}
@@ -31,6 +31,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/output"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -57,8 +58,7 @@ type Collector struct {
 	BatchConf client.BatchPointsConfig
 
 	logger      logrus.FieldLogger
-	buffer      []stats.Sample
-	bufferLock  sync.Mutex
+	batcher     *output.Batcher
 	wg          sync.WaitGroup
 	semaphoreCh chan struct{}
 	fieldKinds  map[string]FieldKind
@@ -86,9 +86,15 @@ func New(logger logrus.FieldLogger, conf Config) (*Collector, error) {
 }
 
 func (c *Collector) Init() error {
+	batcher, err := output.NewBatcher(c.Config.BatchConfig())
+	if err != nil {
+		return err
+	}
+	c.batcher = batcher
+
 	// Try to create the database if it doesn't exist. Failure to do so is USUALLY harmless; it
 	// usually means we're either a non-admin user to an existing DB or connecting over UDP.
-	_, err := c.Client.Query(client.NewQuery("CREATE DATABASE "+c.BatchConf.Database, "", ""))
+	_, err = c.Client.Query(client.NewQuery("CREATE DATABASE "+c.BatchConf.Database, "", ""))
 	if err != nil {
 		c.logger.WithError(err).Debug("InfluxDB: Couldn't create database; most likely harmless")
 	}
@@ -98,39 +104,33 @@ func (c *Collector) Init() error {
 
 func (c *Collector) Run(ctx context.Context) {
 	c.logger.Debug("InfluxDB: Running!")
-	ticker := time.NewTicker(time.Duration(c.Config.PushInterval.Duration))
-	for {
-		select {
-		case <-ticker.C:
-			c.wg.Add(1)
-			go c.commit()
-		case <-ctx.Done():
-			c.wg.Add(1)
-			go c.commit()
-			c.wg.Wait()
+	c.batcher.Start(func() {
+		containers := c.batcher.GetBufferedSamples()
+		if len(containers) == 0 {
 			return
 		}
-	}
+		var samples []stats.Sample
+		for _, sc := range containers {
+			samples = append(samples, sc.GetSamples()...)
+		}
+		c.wg.Add(1)
+		go c.commit(samples)
+	})
+	<-ctx.Done()
+	c.batcher.Stop()
+	c.wg.Wait()
 }
 
 func (c *Collector) Collect(scs []stats.SampleContainer) {
-	c.bufferLock.Lock()
-	defer c.bufferLock.Unlock()
-	for _, sc := range scs {
-		c.buffer = append(c.buffer, sc.GetSamples()...)
-	}
+	c.batcher.AddMetricSamples(scs)
 }
 
 func (c *Collector) Link() string {
 	return c.Config.Addr.String
 }
 
-func (c *Collector) commit() {
+func (c *Collector) commit(samples []stats.Sample) {
 	defer c.wg.Done()
-	c.bufferLock.Lock()
-	samples := c.buffer
-	c.buffer = nil
-	c.bufferLock.Unlock()
 	// let first get the data and then wait our turn
 	c.semaphoreCh <- struct{}{}
 	defer func() {
@@ -34,6 +34,7 @@ import (
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/output"
 )
 
 type Config struct {
@@ -44,6 +45,8 @@ type Config struct {
 	Insecure         null.Bool          `json:"insecure,omitempty" envconfig:"K6_INFLUXDB_INSECURE"`
 	PayloadSize      null.Int           `json:"payloadSize,omitempty" envconfig:"K6_INFLUXDB_PAYLOAD_SIZE"`
 	PushInterval     types.NullDuration `json:"pushInterval,omitempty" envconfig:"K6_INFLUXDB_PUSH_INTERVAL"`
+	BatchMaxSamples  null.Int           `json:"batchMaxSamples,omitempty" envconfig:"K6_INFLUXDB_BATCH_MAX_SAMPLES"`
+	BatchMaxBytes    null.Int           `json:"batchMaxBytes,omitempty" envconfig:"K6_INFLUXDB_BATCH_MAX_BYTES"`
 	ConcurrentWrites null.Int           `json:"concurrentWrites,omitempty" envconfig:"K6_INFLUXDB_CONCURRENT_WRITES"`
 
 	// Samples.
@@ -100,6 +103,12 @@ func (c Config) Apply(cfg Config) Config {
 	if cfg.PushInterval.Valid {
 		c.PushInterval = cfg.PushInterval
 	}
+	if cfg.BatchMaxSamples.Valid {
+		c.BatchMaxSamples = cfg.BatchMaxSamples
+	}
+	if cfg.BatchMaxBytes.Valid {
+		c.BatchMaxBytes = cfg.BatchMaxBytes
+	}
 
 	if cfg.ConcurrentWrites.Valid {
 		c.ConcurrentWrites = cfg.ConcurrentWrites
@@ -107,6 +116,16 @@ func (c Config) Apply(cfg Config) Config {
 	return c
 }
 
+// BatchConfig returns the limits for the batches of samples that are written
+// to InfluxDB. The push interval is the maximum time a sample can be buffered.
+func (c Config) BatchConfig() output.BatchConfig {
+	return output.BatchConfig{
+		MaxSamples: int(c.BatchMaxSamples.Int64),
+		MaxBytes:   int(c.BatchMaxBytes.Int64),
+		MaxLatency: time.Duration(c.PushInterval.Duration),
+	}
+}
+
 // ParseArg parses an argument string into a Config
 func ParseArg(arg string) (Config, error) {
 	c := Config{}
@@ -194,6 +213,20 @@ func ParseURL(text string) (Config, error) {
 			if err != nil {
 				return c, err
 			}
+		case "batchMaxSamples":
+			var samples int
+			samples, err = strconv.Atoi(vs[0])
+			if err != nil {
+				return c, err
+			}
+			c.BatchMaxSamples = null.IntFrom(int64(samples))
+		case "batchMaxBytes":
+			var size int
+			size, err = strconv.Atoi(vs[0])
+			if err != nil {
+				return c, err
+			}
+			c.BatchMaxBytes = null.IntFrom(int64(size))
 		case "concurrentWrites":
 			var writes int
 			writes, err = strconv.Atoi(vs[0])
@@ -59,12 +59,14 @@ func TestParseURL(t *testing.T) {
 		Config Config
 		Err    string
 	}{
-		"?":                {Config{}, ""},
-		"?insecure=false":  {Config{Insecure: null.BoolFrom(false)}, ""},
-		"?insecure=true":   {Config{Insecure: null.BoolFrom(true)}, ""},
-		"?insecure=ture":   {Config{}, "insecure must be true or false, not ture"},
-		"?payload_size=69": {Config{PayloadSize: null.IntFrom(69)}, ""},
-		"?payload_size=a":  {Config{}, "strconv.Atoi: parsing \"a\": invalid syntax"},
+		"?":                     {Config{}, ""},
+		"?insecure=false":       {Config{Insecure: null.BoolFrom(false)}, ""},
+		"?insecure=true":        {Config{Insecure: null.BoolFrom(true)}, ""},
+		"?insecure=ture":        {Config{}, "insecure must be true or false, not ture"},
+		"?payload_size=69":      {Config{PayloadSize: null.IntFrom(69)}, ""},
+		"?payload_size=a":       {Config{}, "strconv.Atoi: parsing \"a\": invalid syntax"},
+		"?batchMaxSamples=1000": {Config{BatchMaxSamples: null.IntFrom(1000)}, ""},
+		"?batchMaxBytes=65536":  {Config{BatchMaxBytes: null.IntFrom(65536)}, ""},
 	}
 	for str, data := range testdata {
 		t.Run(str, func(t *testing.T) {
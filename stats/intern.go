@@ -0,0 +1,84 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// Strings longer than this are very likely to be unique (e.g. URLs with
+	// IDs or tokens in them), so they are not worth interning.
+	maxInternedStringLen = 512
+	// An upper bound on the interned strings, so that tags with an unbounded
+	// cardinality can't make the interning table itself grow without limit.
+	maxInternedStrings = 1 << 17
+)
+
+// stringInterner deduplicates strings, so that the same tag keys and values,
+// which are referenced by potentially millions of samples, share the same
+// underlying memory. Comparing interned strings is also cheaper, since the Go
+// runtime short-circuits the comparison of strings with the same data pointer.
+//
+// A sync.Map is used, since after the first few iterations of a test run the
+// interner is almost exclusively read from, concurrently by all VUs.
+type stringInterner struct {
+	strings sync.Map
+	size    int64
+	maxSize int64
+}
+
+func newStringInterner(maxSize int64) *stringInterner {
+	return &stringInterner{maxSize: maxSize}
+}
+
+// intern returns the canonical copy of the given string. If the string is too
+// long or the interner is already full, the string is returned unmodified.
+func (si *stringInterner) intern(s string) string {
+	if len(s) > maxInternedStringLen {
+		return s
+	}
+	if is, ok := si.strings.Load(s); ok {
+		return is.(string)
+	}
+	if atomic.LoadInt64(&si.size) >= si.maxSize {
+		return s
+	}
+	is, loaded := si.strings.LoadOrStore(s, s)
+	if !loaded {
+		atomic.AddInt64(&si.size, 1)
+	}
+	return is.(string)
+}
+
+//nolint:gochecknoglobals
+var tagInterner = newStringInterner(maxInternedStrings)
+
+// internTags replaces, in-place, all keys and values of the given tag map with
+// their interned versions.
+func internTags(tags map[string]string) {
+	for k, v := range tags {
+		// Assigning to an existing key replaces the stored key as well, so
+		// this doesn't change the map's size and is safe during iteration.
+		tags[tagInterner.intern(k)] = tagInterner.intern(v)
+	}
+}
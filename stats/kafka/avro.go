@@ -0,0 +1,92 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2016 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package kafka
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+// AvroSchema is the Avro schema of the samples sent with the avro format.
+// The messages are just the binary encoded records, without any header, so
+// consumers need to be configured with this schema.
+const AvroSchema = `{
+  "type": "record",
+  "name": "Sample",
+  "namespace": "io.k6",
+  "fields": [
+    {"name": "metric", "type": "string"},
+    {"name": "type", "type": "string"},
+    {"name": "time", "type": {"type": "long", "logicalType": "timestamp-micros"}},
+    {"name": "value", "type": "double"},
+    {"name": "tags", "type": {"type": "map", "values": "string"}}
+  ]
+}`
+
+// encodeAvroSample returns the given sample as a binary encoded Avro record
+// with the AvroSchema.
+func encodeAvroSample(sample stats.Sample) []byte {
+	var tags map[string]string
+	if sample.Tags != nil {
+		tags = sample.Tags.CloneTags()
+	}
+
+	b := make([]byte, 0, 64+len(sample.Metric.Name))
+	b = appendAvroString(b, sample.Metric.Name)
+	b = appendAvroString(b, sample.Metric.Type.String())
+	b = appendAvroLong(b, sample.Time.UnixNano()/1000)
+	b = appendAvroDouble(b, sample.Value)
+
+	// A map is a block with its number of entries, followed by an empty one
+	if len(tags) > 0 {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b = appendAvroLong(b, int64(len(keys)))
+		for _, k := range keys {
+			b = appendAvroString(b, k)
+			b = appendAvroString(b, tags[k])
+		}
+	}
+	return appendAvroLong(b, 0)
+}
+
+func appendAvroLong(b []byte, v int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	n := binary.PutVarint(buf[:], v) // zig-zag encoded, like Avro longs
+	return append(b, buf[:n]...)
+}
+
+func appendAvroString(b []byte, s string) []byte {
+	b = appendAvroLong(b, int64(len(s)))
+	return append(b, s...)
+}
+
+func appendAvroDouble(b []byte, v float64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
@@ -22,7 +22,13 @@ package kafka
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -40,13 +46,25 @@ type Collector struct {
 	Config   Config
 
 	Samples []stats.Sample
+	dropped int
 	logger  logrus.FieldLogger
 	lock    sync.Mutex
 }
 
 // New creates an instance of the collector
 func New(logger logrus.FieldLogger, conf Config) (*Collector, error) {
-	producer, err := sarama.NewSyncProducer(conf.Brokers, nil)
+	switch conf.PartitionBy.String {
+	case "", "scenario", "series":
+	default:
+		return nil, fmt.Errorf("invalid Kafka partition_by value '%s', it should be scenario or series",
+			conf.PartitionBy.String)
+	}
+
+	producerConfig, err := newProducerConfig(conf)
+	if err != nil {
+		return nil, err
+	}
+	producer, err := sarama.NewSyncProducer(conf.Brokers, producerConfig)
 	if err != nil {
 		return nil, err
 	}
@@ -58,6 +76,39 @@ func New(logger logrus.FieldLogger, conf Config) (*Collector, error) {
 	}, nil
 }
 
+// newProducerConfig returns the sarama config with the SASL and TLS options.
+func newProducerConfig(conf Config) (*sarama.Config, error) {
+	producerConfig := sarama.NewConfig()
+	producerConfig.Producer.Return.Successes = true
+
+	if conf.SASLUser.String != "" {
+		producerConfig.Net.SASL.Enable = true
+		producerConfig.Net.SASL.Handshake = true
+		producerConfig.Net.SASL.User = conf.SASLUser.String
+		producerConfig.Net.SASL.Password = conf.SASLPassword.String
+	}
+
+	if conf.TLS.Bool {
+		tlsConfig := &tls.Config{
+			InsecureSkipVerify: conf.TLSInsecureSkipVerify.Bool, //nolint:gosec
+		}
+		if conf.TLSCACert.String != "" {
+			pem, err := ioutil.ReadFile(conf.TLSCACert.String)
+			if err != nil {
+				return nil, fmt.Errorf("couldn't read the Kafka CA certificate: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in the Kafka CA certificate file %s", conf.TLSCACert.String)
+			}
+		}
+		producerConfig.Net.TLS.Enable = true
+		producerConfig.Net.TLS.Config = tlsConfig
+	}
+
+	return producerConfig, nil
+}
+
 // Init does nothing, it's only included to satisfy the lib.Collector interface
 func (c *Collector) Init() error { return nil }
 
@@ -87,10 +138,22 @@ func (c *Collector) Run(ctx context.Context) {
 // detect incorrect usage.
 // Also, theoretically the collector doesn't have to actually Run() before samples start
 // being collected, it only has to be initialized.
+// When there are already MaxBufferedSamples buffered samples, because the
+// brokers can't keep up, the new ones are dropped.
 func (c *Collector) Collect(scs []stats.SampleContainer) {
 	c.lock.Lock()
+	max := int(c.Config.MaxBufferedSamples.Int64)
 	for _, sc := range scs {
-		c.Samples = append(c.Samples, sc.GetSamples()...)
+		samples := sc.GetSamples()
+		if max > 0 && len(c.Samples)+len(samples) > max {
+			free := max - len(c.Samples)
+			if free < 0 {
+				free = 0
+			}
+			c.dropped += len(samples) - free
+			samples = samples[:free]
+		}
+		c.Samples = append(c.Samples, samples...)
 	}
 	c.lock.Unlock()
 }
@@ -104,6 +167,10 @@ func (c *Collector) formatSamples(samples stats.Samples) ([]string, error) {
 	var metrics []string
 
 	switch c.Config.Format.String {
+	case "avro":
+		for _, sample := range samples {
+			metrics = append(metrics, string(encodeAvroSample(sample)))
+		}
 	case "influxdb":
 		i, err := influxdb.New(c.logger, c.Config.InfluxDBConfig)
 		if err != nil {
@@ -134,9 +201,18 @@ func (c *Collector) pushMetrics() {
 
 	c.lock.Lock()
 	samples := c.Samples
+	dropped := c.dropped
 	c.Samples = nil
+	c.dropped = 0
 	c.lock.Unlock()
 
+	if dropped > 0 {
+		c.logger.WithField("samples", dropped).Warn("Kafka: the buffer was full, some samples were dropped")
+	}
+	if len(samples) == 0 {
+		return
+	}
+
 	// Format the samples
 	formattedSamples, err := c.formatSamples(samples)
 	if err != nil {
@@ -147,19 +223,49 @@ func (c *Collector) pushMetrics() {
 	// Send the samples
 	c.logger.Debug("Kafka: Delivering...")
 
-	for _, sample := range formattedSamples {
-		msg := &sarama.ProducerMessage{Topic: c.Config.Topic.String, Value: sarama.StringEncoder(sample)}
-		partition, offset, err := c.Producer.SendMessage(msg)
-		if err != nil {
-			c.logger.WithError(err).Error("Kafka: failed to send message.")
+	msgs := make([]*sarama.ProducerMessage, len(formattedSamples))
+	for i, sample := range formattedSamples {
+		msgs[i] = &sarama.ProducerMessage{Topic: c.Config.Topic.String, Value: sarama.StringEncoder(sample)}
+		// Some formats could merge samples, then there's no key for them
+		if c.Config.PartitionBy.String != "" && len(formattedSamples) == len(samples) {
+			msgs[i].Key = sarama.StringEncoder(c.messageKey(samples[i]))
+		}
+	}
+	if err := c.Producer.SendMessages(msgs); err != nil {
+		if errs, ok := err.(sarama.ProducerErrors); ok {
+			c.logger.WithError(errs[0].Err).WithField("messages", len(errs)).Error("Kafka: failed to send messages.")
 		} else {
-			c.logger.WithFields(logrus.Fields{
-				"partition": partition,
-				"offset":    offset,
-			}).Debug("Kafka: message sent.")
+			c.logger.WithError(err).Error("Kafka: failed to send messages.")
 		}
 	}
 
 	t := time.Since(startTime)
-	c.logger.WithField("t", t).Debug("Kafka: Delivered!")
+	c.logger.WithFields(logrus.Fields{"t": t, "messages": len(msgs)}).Debug("Kafka: Delivered!")
+}
+
+// messageKey returns the key of the message with the given sample, which
+// decides its partition.
+func (c *Collector) messageKey(sample stats.Sample) string {
+	var tags map[string]string
+	if sample.Tags != nil {
+		tags = sample.Tags.CloneTags()
+	}
+	if c.Config.PartitionBy.String == "scenario" {
+		return tags["scenario"]
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	b.WriteString(sample.Metric.Name)
+	for _, k := range keys {
+		b.WriteByte(',')
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tags[k])
+	}
+	return b.String()
 }
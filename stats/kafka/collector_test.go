@@ -22,11 +22,15 @@ package kafka
 
 import (
 	"context"
+	"encoding/binary"
+	"math"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/Shopify/sarama"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"gopkg.in/guregu/null.v3"
 
 	"github.com/loadimpact/k6/lib/testutils"
@@ -85,3 +89,74 @@ func TestFormatSamples(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, []string{expJSON1, expJSON2}, fmtdSamples)
 }
+
+func TestFormatSamplesAvro(t *testing.T) {
+	c := Collector{}
+	c.Config.Format = null.NewString("avro", false)
+	sample := stats.Sample{
+		Metric: stats.New("vus", stats.Gauge),
+		Time:   time.Unix(1, 500000),
+		Value:  2.5,
+		Tags:   stats.IntoSampleTags(&map[string]string{"b": "2", "a": "1"}),
+	}
+	fmtdSamples, err := c.formatSamples(stats.Samples{sample})
+	require.NoError(t, err)
+	require.Len(t, fmtdSamples, 1)
+
+	value := make([]byte, 8)
+	binary.LittleEndian.PutUint64(value, math.Float64bits(2.5))
+	expected := []byte{6, 'v', 'u', 's', 10, 'g', 'a', 'u', 'g', 'e'}
+	expected = append(expected, 0xe8, 0x90, 0x7a) // 1000500 microseconds as a zig-zag varint
+	expected = append(expected, value...)
+	expected = append(expected, 4, 2, 'a', 2, '1', 2, 'b', 2, '2', 0)
+	assert.Equal(t, expected, []byte(fmtdSamples[0]))
+}
+
+func TestCollectMaxBufferedSamples(t *testing.T) {
+	c := Collector{logger: testutils.NewLogger(t)}
+	c.Config.MaxBufferedSamples = null.IntFrom(3)
+	metric := stats.New("my_metric", stats.Counter)
+	sample := stats.Sample{Metric: metric, Value: 1}
+
+	c.Collect([]stats.SampleContainer{sample, sample})
+	c.Collect([]stats.SampleContainer{stats.ConnectedSamples{Samples: []stats.Sample{sample, sample}}, sample})
+	assert.Len(t, c.Samples, 3)
+	assert.Equal(t, 2, c.dropped)
+}
+
+type fakeProducer struct {
+	sarama.SyncProducer
+	messages []*sarama.ProducerMessage
+}
+
+func (p *fakeProducer) SendMessages(msgs []*sarama.ProducerMessage) error {
+	p.messages = append(p.messages, msgs...)
+	return nil
+}
+
+func TestPushMetricsPartitionBy(t *testing.T) {
+	producer := &fakeProducer{}
+	c := Collector{Producer: producer, logger: testutils.NewLogger(t)}
+	c.Config.Topic = null.StringFrom("my_topic")
+	metric := stats.New("my_metric", stats.Counter)
+	tags := stats.IntoSampleTags(&map[string]string{"scenario": "login", "status": "200"})
+	samples := []stats.SampleContainer{stats.Sample{Metric: metric, Value: 1, Tags: tags}}
+
+	c.Collect(samples)
+	c.pushMetrics()
+	require.Len(t, producer.messages, 1)
+	assert.Equal(t, "my_topic", producer.messages[0].Topic)
+	assert.Nil(t, producer.messages[0].Key)
+
+	for partitionBy, key := range map[string]string{
+		"scenario": "login",
+		"series":   "my_metric,scenario=login,status=200",
+	} {
+		producer.messages = nil
+		c.Config.PartitionBy = null.StringFrom(partitionBy)
+		c.Collect(samples)
+		c.pushMetrics()
+		require.Len(t, producer.messages, 1)
+		assert.Equal(t, sarama.StringEncoder(key), producer.messages[0].Key)
+	}
+}
@@ -38,10 +38,23 @@ type Config struct {
 	// Connection.
 	Brokers []string `json:"brokers" envconfig:"K6_KAFKA_BROKERS"`
 
+	// Authentication, SASL/PLAIN is used if there is a user.
+	SASLUser              null.String `json:"sasl_user" envconfig:"K6_KAFKA_SASL_USER"`
+	SASLPassword          null.String `json:"sasl_password" envconfig:"K6_KAFKA_SASL_PASSWORD"`
+	TLS                   null.Bool   `json:"tls" envconfig:"K6_KAFKA_TLS"`
+	TLSInsecureSkipVerify null.Bool   `json:"tls_insecure_skip_verify" envconfig:"K6_KAFKA_TLS_INSECURE_SKIP_VERIFY"`
+	TLSCACert             null.String `json:"tls_ca_cert" envconfig:"K6_KAFKA_TLS_CA_CERT"`
+
 	// Samples.
 	Topic        null.String        `json:"topic" envconfig:"K6_KAFKA_TOPIC"`
 	Format       null.String        `json:"format" envconfig:"K6_KAFKA_FORMAT"`
 	PushInterval types.NullDuration `json:"push_interval" envconfig:"K6_KAFKA_PUSH_INTERVAL"`
+	// What the message keys are, so samples with the same key go to the same
+	// partition: "scenario", "series" (the metric name and tags) or none.
+	PartitionBy null.String `json:"partition_by" envconfig:"K6_KAFKA_PARTITION_BY"`
+	// The samples that don't fit in the buffer are dropped, when the brokers
+	// can't keep up with them. 0 means unlimited.
+	MaxBufferedSamples null.Int `json:"max_buffered_samples" envconfig:"K6_KAFKA_MAX_BUFFERED_SAMPLES"`
 
 	InfluxDBConfig influxdb.Config `json:"influxdb"`
 }
@@ -54,15 +67,24 @@ type config struct {
 	Format       string   `json:"format" mapstructure:"format" envconfig:"K6_KAFKA_FORMAT"`
 	PushInterval string   `json:"push_interval" mapstructure:"push_interval" envconfig:"K6_KAFKA_PUSH_INTERVAL"`
 
+	SASLUser              string `json:"sasl_user" mapstructure:"sasl_user"`
+	SASLPassword          string `json:"sasl_password" mapstructure:"sasl_password"`
+	TLS                   *bool  `json:"tls" mapstructure:"tls"`
+	TLSInsecureSkipVerify *bool  `json:"tls_insecure_skip_verify" mapstructure:"tls_insecure_skip_verify"`
+	TLSCACert             string `json:"tls_ca_cert" mapstructure:"tls_ca_cert"`
+	PartitionBy           string `json:"partition_by" mapstructure:"partition_by"`
+	MaxBufferedSamples    *int64 `json:"max_buffered_samples" mapstructure:"max_buffered_samples"`
+
 	InfluxDBConfig influxdb.Config `json:"influxdb" mapstructure:"influxdb"`
 }
 
 // NewConfig creates a new Config instance with default values for some fields.
 func NewConfig() Config {
 	return Config{
-		Format:         null.StringFrom("json"),
-		PushInterval:   types.NullDurationFrom(1 * time.Second),
-		InfluxDBConfig: influxdb.NewConfig(),
+		Format:             null.StringFrom("json"),
+		PushInterval:       types.NullDurationFrom(1 * time.Second),
+		MaxBufferedSamples: null.IntFrom(1000000),
+		InfluxDBConfig:     influxdb.NewConfig(),
 	}
 }
 
@@ -79,6 +101,27 @@ func (c Config) Apply(cfg Config) Config {
 	if cfg.PushInterval.Valid {
 		c.PushInterval = cfg.PushInterval
 	}
+	if cfg.SASLUser.Valid {
+		c.SASLUser = cfg.SASLUser
+	}
+	if cfg.SASLPassword.Valid {
+		c.SASLPassword = cfg.SASLPassword
+	}
+	if cfg.TLS.Valid {
+		c.TLS = cfg.TLS
+	}
+	if cfg.TLSInsecureSkipVerify.Valid {
+		c.TLSInsecureSkipVerify = cfg.TLSInsecureSkipVerify
+	}
+	if cfg.TLSCACert.Valid {
+		c.TLSCACert = cfg.TLSCACert
+	}
+	if cfg.PartitionBy.Valid {
+		c.PartitionBy = cfg.PartitionBy
+	}
+	if cfg.MaxBufferedSamples.Valid {
+		c.MaxBufferedSamples = cfg.MaxBufferedSamples
+	}
 	c.InfluxDBConfig = c.InfluxDBConfig.Apply(cfg.InfluxDBConfig)
 	return c
 }
@@ -121,6 +164,28 @@ func ParseArg(arg string) (Config, error) {
 	c.Topic = null.StringFrom(cfg.Topic)
 	c.Format = null.StringFrom(cfg.Format)
 
+	if cfg.SASLUser != "" {
+		c.SASLUser = null.StringFrom(cfg.SASLUser)
+	}
+	if cfg.SASLPassword != "" {
+		c.SASLPassword = null.StringFrom(cfg.SASLPassword)
+	}
+	if cfg.TLS != nil {
+		c.TLS = null.BoolFrom(*cfg.TLS)
+	}
+	if cfg.TLSInsecureSkipVerify != nil {
+		c.TLSInsecureSkipVerify = null.BoolFrom(*cfg.TLSInsecureSkipVerify)
+	}
+	if cfg.TLSCACert != "" {
+		c.TLSCACert = null.StringFrom(cfg.TLSCACert)
+	}
+	if cfg.PartitionBy != "" {
+		c.PartitionBy = null.StringFrom(cfg.PartitionBy)
+	}
+	if cfg.MaxBufferedSamples != nil {
+		c.MaxBufferedSamples = null.IntFrom(*cfg.MaxBufferedSamples)
+	}
+
 	return c, nil
 }
 
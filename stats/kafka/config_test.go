@@ -68,6 +68,18 @@ func TestConfigParseArg(t *testing.T) {
 	assert.Equal(t, null.StringFrom("someTopic"), c.Topic)
 	assert.Equal(t, null.StringFrom("influxdb"), c.Format)
 	assert.Equal(t, expInfluxConfig, c.InfluxDBConfig)
+
+	c, err = ParseArg("brokers=broker1,topic=someTopic,format=avro,sasl_user=user,sasl_password=pass," +
+		"tls=true,tls_ca_cert=ca.pem,partition_by=scenario,max_buffered_samples=100")
+	assert.Nil(t, err)
+	assert.Equal(t, null.StringFrom("avro"), c.Format)
+	assert.Equal(t, null.StringFrom("user"), c.SASLUser)
+	assert.Equal(t, null.StringFrom("pass"), c.SASLPassword)
+	assert.Equal(t, null.BoolFrom(true), c.TLS)
+	assert.Equal(t, null.Bool{}, c.TLSInsecureSkipVerify)
+	assert.Equal(t, null.StringFrom("ca.pem"), c.TLSCACert)
+	assert.Equal(t, null.StringFrom("scenario"), c.PartitionBy)
+	assert.Equal(t, null.IntFrom(100), c.MaxBufferedSamples)
 }
 
 func TestConsolidatedConfig(t *testing.T) {
@@ -82,16 +94,18 @@ func TestConsolidatedConfig(t *testing.T) {
 	}{
 		"default": {
 			config: Config{
-				Format:         null.StringFrom("json"),
-				PushInterval:   types.NullDurationFrom(1 * time.Second),
-				InfluxDBConfig: influxdb.NewConfig(),
+				Format:             null.StringFrom("json"),
+				PushInterval:       types.NullDurationFrom(1 * time.Second),
+				MaxBufferedSamples: null.IntFrom(1000000),
+				InfluxDBConfig:     influxdb.NewConfig(),
 			},
 		},
 		"bad influxdb concurrent writes": {
 			env: map[string]string{"K6_INFLUXDB_CONCURRENT_WRITES": "-2"},
 			config: Config{
-				Format:       null.StringFrom("json"),
-				PushInterval: types.NullDurationFrom(1 * time.Second),
+				Format:             null.StringFrom("json"),
+				PushInterval:       types.NullDurationFrom(1 * time.Second),
+				MaxBufferedSamples: null.IntFrom(1000000),
 				InfluxDBConfig: influxdb.NewConfig().Apply(
 					influxdb.Config{
 						ConcurrentWrites: null.IntFrom(-2),
@@ -53,6 +53,14 @@ func (c *CounterSink) Add(s Sample) {
 	}
 }
 
+// Merge adds the value of the other sink to this one.
+func (c *CounterSink) Merge(other *CounterSink) {
+	c.Value += other.Value
+	if c.First.IsZero() || (!other.First.IsZero() && other.First.Before(c.First)) {
+		c.First = other.First
+	}
+}
+
 func (c *CounterSink) Calc() {}
 
 func (c *CounterSink) Format(t time.Duration) map[string]float64 {
@@ -79,6 +87,22 @@ func (g *GaugeSink) Add(s Sample) {
 	}
 }
 
+// Merge adds the values of the other sink to this one, as if they were added
+// after the values of this one.
+func (g *GaugeSink) Merge(other *GaugeSink) {
+	if !other.minSet {
+		return
+	}
+	g.Value = other.Value
+	if other.Max > g.Max {
+		g.Max = other.Max
+	}
+	if other.Min < g.Min || !g.minSet {
+		g.Min = other.Min
+		g.minSet = true
+	}
+}
+
 func (g *GaugeSink) Calc() {}
 
 func (g *GaugeSink) Format(t time.Duration) map[string]float64 {
@@ -89,15 +113,37 @@ type TrendSink struct {
 	Values  []float64
 	jumbled bool
 
+	spillConf *TrendSpill
+	spilled   *mappedFloats
+
+	// The values added since the last TakeNewValues() call, in the order they
+	// were added, if TrackNewValues() was called
+	newValues      []float64
+	trackNewValues bool
+
 	Count    uint64
 	Min, Max float64
 	Sum, Avg float64
 	Med      float64
+
+	// The percentiles, between 0 and 100, that are returned by Format()
+	// instead of the default ones
+	Percentiles []float64
 }
 
+// DefaultTrendPercentiles are returned by TrendSink.Format() if the sink has
+// no percentiles of its own.
+var DefaultTrendPercentiles = []float64{90, 95}
+
 func (t *TrendSink) Add(s Sample) {
+	if t.spillConf != nil {
+		t.prepareForAdd()
+	}
 	t.Values = append(t.Values, s.Value)
 	t.jumbled = true
+	if t.trackNewValues {
+		t.newValues = append(t.newValues, s.Value)
+	}
 	t.Count += 1
 	t.Sum += s.Value
 	t.Avg = t.Sum / float64(t.Count)
@@ -110,8 +156,60 @@ func (t *TrendSink) Add(s Sample) {
 	}
 }
 
+// Merge adds the values of the other sink to this one. It's much cheaper than
+// adding them one by one, unless the values of this sink are spilled to disk.
+func (t *TrendSink) Merge(other *TrendSink) {
+	if other.Count == 0 {
+		return
+	}
+	if t.spillConf != nil {
+		for _, v := range other.Values {
+			t.prepareForAdd()
+			t.Values = append(t.Values, v)
+		}
+	} else {
+		t.Values = append(t.Values, other.Values...)
+	}
+	t.jumbled = true
+	if t.trackNewValues {
+		t.newValues = append(t.newValues, other.Values...)
+	}
+	if other.Max > t.Max || t.Count == 0 {
+		t.Max = other.Max
+	}
+	if other.Min < t.Min || t.Count == 0 {
+		t.Min = other.Min
+	}
+	t.Count += other.Count
+	t.Sum += other.Sum
+	t.Avg = t.Sum / float64(t.Count)
+}
+
+// TrackNewValues makes the sink keep the values added to it since the last
+// TakeNewValues() call, separately from Values, which Calc() sorts in place.
+// It should be called before any samples are added.
+func (t *TrendSink) TrackNewValues() {
+	t.trackNewValues = true
+}
+
+// TracksNewValues returns whether TrackNewValues() was called.
+func (t *TrendSink) TracksNewValues() bool {
+	return t.trackNewValues
+}
+
+// TakeNewValues returns the values added to the sink since the previous call,
+// in the order they were added, and stops keeping them.
+func (t *TrendSink) TakeNewValues() []float64 {
+	values := t.newValues
+	t.newValues = nil
+	return values
+}
+
 // P calculates the given percentile from sink values.
 func (t *TrendSink) P(pct float64) float64 {
+	if uint64(len(t.Values)) < t.Count {
+		return 0 // the values were dropped by Close()
+	}
 	switch t.Count {
 	case 0:
 		return 0
@@ -149,14 +247,20 @@ func (t *TrendSink) Calc() {
 func (t *TrendSink) Format(tt time.Duration) map[string]float64 {
 	t.Calc()
 	// TODO: respect the summaryTrendStats for REST API
-	return map[string]float64{
-		"min":   t.Min,
-		"max":   t.Max,
-		"avg":   t.Avg,
-		"med":   t.Med,
-		"p(90)": t.P(0.90),
-		"p(95)": t.P(0.95),
+	result := map[string]float64{
+		"min": t.Min,
+		"max": t.Max,
+		"avg": t.Avg,
+		"med": t.Med,
 	}
+	percentiles := t.Percentiles
+	if len(percentiles) == 0 {
+		percentiles = DefaultTrendPercentiles
+	}
+	for _, pct := range percentiles {
+		result[PercentileColumn(pct)] = t.P(pct / 100)
+	}
+	return result
 }
 
 type RateSink struct {
@@ -171,6 +275,12 @@ func (r *RateSink) Add(s Sample) {
 	}
 }
 
+// Merge adds the values of the other sink to this one.
+func (r *RateSink) Merge(other *RateSink) {
+	r.Trues += other.Trues
+	r.Total += other.Total
+}
+
 func (r RateSink) Calc() {}
 
 func (r RateSink) Format(t time.Duration) map[string]float64 {
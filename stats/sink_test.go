@@ -21,10 +21,14 @@
 package stats
 
 import (
+	"io/ioutil"
+	"os"
+	"runtime"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestCounterSink(t *testing.T) {
@@ -211,9 +215,59 @@ func TestTrendSink(t *testing.T) {
 			"p(90)": 91.0,
 			"p(95)": 95.49999999999999,
 		}, sink.Format(0))
+
+		sink.Percentiles = []float64{50, 99.9}
+		assert.Equal(t, map[string]float64{
+			"min":     0.0,
+			"max":     100.0,
+			"avg":     54.0,
+			"med":     55.0,
+			"p(50)":   55.0,
+			"p(99.9)": 99.91000000000001,
+		}, sink.Format(0))
 	})
 }
 
+func TestTrendSinkSpill(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("spilling trend values to disk is not supported on Windows")
+	}
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "k6-trend-spill-test")
+	require.NoError(t, err)
+	defer func() { _ = os.RemoveAll(dir) }()
+
+	var spillErr error
+	sink := &TrendSink{}
+	sink.SetSpill(&TrendSpill{Dir: dir, Threshold: 10, OnError: func(err error) { spillErr = err }})
+
+	const count = 1000
+	for i := count; i > 0; i-- {
+		sink.Add(Sample{Value: float64(i)})
+	}
+	require.NoError(t, spillErr)
+	require.NotNil(t, sink.spilled)
+	assert.Len(t, sink.Values, count)
+
+	// The temp files are unlinked right after they are created
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	sink.Calc()
+	assert.Equal(t, float64(1), sink.Min)
+	assert.Equal(t, float64(count), sink.Max)
+	assert.Equal(t, 500.5, sink.Med)
+	assert.Equal(t, 990.01, sink.P(0.99))
+
+	require.NoError(t, sink.Close())
+	assert.Nil(t, sink.spilled)
+	assert.Nil(t, sink.Values)
+	assert.Equal(t, 500.5, sink.Med)
+	assert.Equal(t, float64(0), sink.P(0.99))
+}
+
 func TestRateSink(t *testing.T) {
 	samples6 := []float64{1.0, 0.0, 1.0, 0.0, 0.0, 1.0}
 
@@ -254,6 +308,45 @@ func TestRateSink(t *testing.T) {
 	})
 }
 
+func TestSinkMerge(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	values := []float64{3, -1, 7, 2, 0, 5}
+	for _, typ := range []MetricType{Counter, Gauge, Trend, Rate} {
+		typ := typ
+		t.Run(typ.String(), func(t *testing.T) {
+			t.Parallel()
+			all, first, second := NewSink(typ), NewSink(typ), NewSink(typ)
+			for i, v := range values {
+				sample := Sample{Time: now.Add(time.Duration(i) * time.Second), Value: v}
+				all.Add(sample)
+				if i < 2 {
+					first.Add(sample)
+				} else {
+					second.Add(sample)
+				}
+			}
+			merged := NewSink(typ)
+			for _, sink := range []Sink{first, NewSink(typ), second} {
+				switch sink := sink.(type) {
+				case *CounterSink:
+					merged.(*CounterSink).Merge(sink)
+				case *GaugeSink:
+					merged.(*GaugeSink).Merge(sink)
+				case *TrendSink:
+					merged.(*TrendSink).Merge(sink)
+				case *RateSink:
+					merged.(*RateSink).Merge(sink)
+				}
+			}
+			assert.Equal(t, all.Format(time.Second), merged.Format(time.Second))
+			if counter, ok := merged.(*CounterSink); ok {
+				assert.Equal(t, now, counter.First)
+			}
+		})
+	}
+}
+
 func TestDummySinkAddPanics(t *testing.T) {
 	assert.Panics(t, func() {
 		DummySink{}.Add(Sample{})
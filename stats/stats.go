@@ -35,10 +35,11 @@ import (
 )
 
 const (
-	counterString = "counter"
-	gaugeString   = "gauge"
-	trendString   = "trend"
-	rateString    = "rate"
+	counterString   = "counter"
+	gaugeString     = "gauge"
+	trendString     = "trend"
+	rateString      = "rate"
+	histogramString = "histogram"
 
 	defaultString = "default"
 	timeString    = "time"
@@ -47,10 +48,11 @@ const (
 
 // Possible values for MetricType.
 const (
-	Counter = MetricType(iota) // A counter that sums its data points
-	Gauge                      // A gauge that displays the latest value
-	Trend                      // A trend, min/max/avg/med are interesting
-	Rate                       // A rate, displays % of values that aren't 0
+	Counter   = MetricType(iota) // A counter that sums its data points
+	Gauge                        // A gauge that displays the latest value
+	Trend                        // A trend, min/max/avg/med are interesting
+	Rate                         // A rate, displays % of values that aren't 0
+	Histogram                    // A histogram, like a trend but with approximate percentiles
 )
 
 // Possible values for ValueType.
@@ -89,6 +91,8 @@ func (t MetricType) MarshalText() ([]byte, error) {
 		return []byte(trendString), nil
 	case Rate:
 		return []byte(rateString), nil
+	case Histogram:
+		return []byte(histogramString), nil
 	default:
 		return nil, ErrInvalidMetricType
 	}
@@ -105,6 +109,8 @@ func (t *MetricType) UnmarshalText(data []byte) error {
 		*t = Trend
 	case rateString:
 		*t = Rate
+	case histogramString:
+		*t = Histogram
 	default:
 		return ErrInvalidMetricType
 	}
@@ -122,6 +128,8 @@ func (t MetricType) String() string {
 		return trendString
 	case Rate:
 		return rateString
+	case Histogram:
+		return histogramString
 	default:
 		return "[INVALID]"
 	}
@@ -186,7 +194,10 @@ func (t ValueType) String() string {
 // set is created, direct modification is prohibited. It has
 // copy-on-write semantics and uses pointers for faster comparison
 // between maps, since the same tag set is often used for multiple samples.
+// The tag keys and values are interned, so that identical strings in
+// different tag sets share the same memory.
 // All methods should not panic, even if they are called on a nil pointer.
+//
 //easyjson:skip
 type SampleTags struct {
 	tags map[string]string
@@ -209,6 +220,19 @@ func (st *SampleTags) IsEmpty() bool {
 	return st == nil || len(st.tags) == 0
 }
 
+// ByteLen returns the combined length of all tag keys and values. It can be
+// used for cheaply estimating how big the tag set will be once encoded.
+func (st *SampleTags) ByteLen() int {
+	if st == nil {
+		return 0
+	}
+	var res int
+	for k, v := range st.tags {
+		res += len(k) + len(v)
+	}
+	return res
+}
+
 // IsEqual tries to compare two tag sets with maximum efficiency.
 func (st *SampleTags) IsEqual(other *SampleTags) bool {
 	if st == other {
@@ -242,6 +266,33 @@ func (st *SampleTags) Contains(other *SampleTags) bool {
 	return true
 }
 
+// Hash returns a 32-bit FNV-1a based hash of the tag set, which doesn't depend
+// on the order of the tags, so equal tag sets always have the same hash.
+func (st *SampleTags) Hash() uint32 {
+	const (
+		offset32 = 2166136261
+		prime32  = 16777619
+	)
+	if st == nil {
+		return 0
+	}
+	var res uint32
+	for k, v := range st.tags {
+		hash := uint32(offset32)
+		for i := 0; i < len(k); i++ {
+			hash ^= uint32(k[i])
+			hash *= prime32
+		}
+		hash *= prime32 // for the separator, so "ab":"c" and "a":"bc" differ
+		for i := 0; i < len(v); i++ {
+			hash ^= uint32(v[i])
+			hash *= prime32
+		}
+		res += hash
+	}
+	return res
+}
+
 // MarshalJSON serializes SampleTags to a JSON string and caches
 // the result. It is not thread safe in the sense that the Go race
 // detector will complain if it's used concurrently, but no data
@@ -306,9 +357,9 @@ func NewSampleTags(data map[string]string) *SampleTags {
 		return nil
 	}
 
-	tags := map[string]string{}
+	tags := make(map[string]string, len(data))
 	for k, v := range data {
-		tags[k] = v
+		tags[tagInterner.intern(k)] = tagInterner.intern(v)
 	}
 	return &SampleTags{tags: tags}
 }
@@ -322,17 +373,28 @@ func IntoSampleTags(data *map[string]string) *SampleTags {
 		return nil
 	}
 
+	internTags(*data)
 	res := SampleTags{tags: *data}
 	*data = nil
 	return &res
 }
 
+// An Exemplar links a sample to the trace of the operation that produced it,
+// so that e.g. a latency spike can be looked up in a tracing backend.
+type Exemplar struct {
+	// The hex-encoded 16-byte trace ID
+	TraceID string `json:"trace_id"`
+	// The hex-encoded 8-byte span ID, if known
+	SpanID string `json:"span_id,omitempty"`
+}
+
 // A Sample is a single measurement.
 type Sample struct {
-	Metric *Metric
-	Time   time.Time
-	Tags   *SampleTags
-	Value  float64
+	Metric   *Metric
+	Time     time.Time
+	Tags     *SampleTags
+	Value    float64
+	Exemplar *Exemplar
 }
 
 // SampleContainer is a simple abstraction that allows sample
@@ -445,6 +507,11 @@ type Metric struct {
 	Submetrics []*Submetric `json:"submetrics"`
 	Sub        Submetric    `json:"sub,omitempty"`
 	Sink       Sink         `json:"-"`
+
+	// Optional metadata for the outputs and the summary, like "bytes" and
+	// what the values of a custom metric mean
+	Unit        string `json:"unit,omitempty"`
+	Description string `json:"description,omitempty"`
 }
 
 func New(name string, typ MetricType, t ...ValueType) *Metric {
@@ -452,20 +519,30 @@ func New(name string, typ MetricType, t ...ValueType) *Metric {
 	if len(t) > 0 {
 		vt = t[0]
 	}
-	var sink Sink
+	sink := NewSink(typ)
+	if sink == nil {
+		return nil
+	}
+	return &Metric{Name: name, Type: typ, Contains: vt, Sink: sink}
+}
+
+// NewSink returns a new empty sink for metrics of the given type, or nil if
+// the type is unknown.
+func NewSink(typ MetricType) Sink {
 	switch typ {
 	case Counter:
-		sink = &CounterSink{}
+		return &CounterSink{}
 	case Gauge:
-		sink = &GaugeSink{}
+		return &GaugeSink{}
 	case Trend:
-		sink = &TrendSink{}
+		return &TrendSink{}
 	case Rate:
-		sink = &RateSink{}
+		return &RateSink{}
+	case Histogram:
+		return &HistogramSink{}
 	default:
 		return nil
 	}
-	return &Metric{Name: name, Type: typ, Contains: vt, Sink: sink}
 }
 
 var unitMap = map[string][]interface{}{
@@ -504,6 +581,9 @@ func (m *Metric) HumanizeValue(v float64, timeUnit string) string {
 		case Data:
 			return humanize.Bytes(uint64(v))
 		default:
+			if m.Unit != "" {
+				return humanize.Ftoa(v) + " " + m.Unit
+			}
 			return humanize.Ftoa(v)
 		}
 	}
@@ -545,8 +625,9 @@ func NewSubmetric(name string) (parentName string, sm *Submetric) {
 	return parts[0], &Submetric{Name: name, Parent: parts[0], Suffix: parts[1], Tags: IntoSampleTags(&tags)}
 }
 
-// parsePercentile is a helper function to parse and validate percentile notations
-func parsePercentile(stat string) (float64, error) {
+// ParsePercentile parses and validates a percentile notation like p(99.9) and
+// returns the percentile, between 0 and 100.
+func ParsePercentile(stat string) (float64, error) {
 	if !strings.HasPrefix(stat, "p(") || !strings.HasSuffix(stat, ")") {
 		return 0, fmt.Errorf("invalid trend stat '%s', unknown format", stat)
 	}
@@ -560,6 +641,31 @@ func parsePercentile(stat string) (float64, error) {
 	return percentile, nil
 }
 
+// PercentileColumn returns the name of the trend column for the given
+// percentile, between 0 and 100, e.g. p(99.9).
+func PercentileColumn(percentile float64) string {
+	return "p(" + strconv.FormatFloat(percentile, 'f', -1, 64) + ")"
+}
+
+// TrendColumns returns the trend columns of a trend metric: the given summary
+// trend columns, but with the percentile ones replaced by the columns for the
+// given percentiles of the metric, if there are any.
+func TrendColumns(columns []string, percentiles []float64) []string {
+	if len(percentiles) == 0 {
+		return columns
+	}
+	result := make([]string, 0, len(columns)+len(percentiles))
+	for _, col := range columns {
+		if _, err := ParsePercentile(col); err != nil {
+			result = append(result, col)
+		}
+	}
+	for _, percentile := range percentiles {
+		result = append(result, PercentileColumn(percentile))
+	}
+	return result
+}
+
 // GetResolversForTrendColumns checks if passed trend columns are valid for use in
 // the summary output and then returns a map of the corresponding resolvers.
 func GetResolversForTrendColumns(trendColumns []string) (map[string]func(s *TrendSink) float64, error) {
@@ -584,7 +690,7 @@ func GetResolversForTrendColumns(trendColumns []string) (map[string]func(s *Tren
 			continue
 		}
 
-		percentile, err := parsePercentile(stat)
+		percentile, err := ParsePercentile(stat)
 		if err != nil {
 			return nil, err
 		}
@@ -593,3 +699,33 @@ func GetResolversForTrendColumns(trendColumns []string) (map[string]func(s *Tren
 
 	return result, nil
 }
+
+// GetResolversForHistogramColumns is like GetResolversForTrendColumns, but it
+// returns the resolvers for histogram sinks.
+func GetResolversForHistogramColumns(trendColumns []string) (map[string]func(s *HistogramSink) float64, error) {
+	staticResolvers := map[string]func(s *HistogramSink) float64{
+		"avg":   (*HistogramSink).Avg,
+		"min":   func(s *HistogramSink) float64 { return s.Min },
+		"med":   func(s *HistogramSink) float64 { return s.P(0.5) },
+		"max":   func(s *HistogramSink) float64 { return s.Max },
+		"count": func(s *HistogramSink) float64 { return float64(s.Count) },
+	}
+
+	result := make(map[string]func(s *HistogramSink) float64, len(trendColumns))
+	for _, stat := range trendColumns {
+		if staticStat, ok := staticResolvers[stat]; ok {
+			result[stat] = staticStat
+			continue
+		}
+
+		percentile, err := ParsePercentile(stat)
+		if err != nil {
+			return nil, err
+		}
+		result[stat] = func(s *HistogramSink) float64 {
+			return s.P(percentile / 100)
+		}
+	}
+
+	return result, nil
+}
@@ -23,8 +23,12 @@ package stats
 import (
 	"encoding/json"
 	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
 	"testing"
 	"time"
+	"unsafe"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -42,6 +46,9 @@ func TestMetricHumanizeValue(t *testing.T) {
 			1.5:     {"1.5", "1.5", "1.5", "1.5"},
 			1.54321: {"1.54321", "1.54321", "1.54321", "1.54321"},
 		},
+		{Type: Gauge, Contains: Default, Unit: "req/s"}: {
+			1.5: {"1.5 req/s", "1.5 req/s", "1.5 req/s", "1.5 req/s"},
+		},
 		{Type: Trend, Contains: Default}: {
 			1.0:     {"1", "1", "1", "1"},
 			1.5:     {"1.5", "1.5", "1.5", "1.5"},
@@ -149,10 +156,11 @@ func TestNew(t *testing.T) {
 		Type     MetricType
 		SinkType Sink
 	}{
-		"Counter": {Counter, &CounterSink{}},
-		"Gauge":   {Gauge, &GaugeSink{}},
-		"Trend":   {Trend, &TrendSink{}},
-		"Rate":    {Rate, &RateSink{}},
+		"Counter":   {Counter, &CounterSink{}},
+		"Gauge":     {Gauge, &GaugeSink{}},
+		"Trend":     {Trend, &TrendSink{}},
+		"Rate":      {Rate, &RateSink{}},
+		"Histogram": {Histogram, &HistogramSink{}},
 	}
 
 	for name, data := range testdata {
@@ -324,6 +332,14 @@ func createTestTrendSink(count int) *TrendSink {
 	return &sink
 }
 
+func TestTrendColumns(t *testing.T) {
+	t.Parallel()
+	columns := []string{"avg", "p(90)", "max", "p(95)"}
+	assert.Equal(t, columns, TrendColumns(columns, nil))
+	assert.Equal(t, []string{"avg", "max", "p(75)", "p(99.9)"}, TrendColumns(columns, []float64{75, 99.9}))
+	assert.Equal(t, "p(99.99)", PercentileColumn(99.99))
+}
+
 func TestResolversForTrendColumnsCalculation(t *testing.T) {
 	customResolversTests := []struct {
 		stats      string
@@ -350,3 +366,69 @@ func TestResolversForTrendColumnsCalculation(t *testing.T) {
 		})
 	}
 }
+
+func TestSampleTagsInterning(t *testing.T) {
+	t.Parallel()
+	// Build the strings dynamically, so they don't point to the same constant
+	key1, key2 := string([]byte("internkey")), string([]byte("internkey"))
+	val1, val2 := string([]byte("internval")), string([]byte("internval"))
+
+	tags1 := IntoSampleTags(&map[string]string{key1: val1})
+	tags2 := NewSampleTags(map[string]string{key2: val2})
+	assert.True(t, tags1.IsEqual(tags2))
+
+	for k1, v1 := range tags1.tags {
+		for k2, v2 := range tags2.tags {
+			assert.Equal(t, unsafeStringData(k1), unsafeStringData(k2))
+			assert.Equal(t, unsafeStringData(v1), unsafeStringData(v2))
+		}
+	}
+}
+
+func TestStringInternerLimits(t *testing.T) {
+	t.Parallel()
+	si := newStringInterner(2)
+
+	long := strings.Repeat("a", maxInternedStringLen+1)
+	assert.Equal(t, long, si.intern(long))
+	assert.EqualValues(t, 0, si.size)
+
+	assert.Equal(t, "a", si.intern("a"))
+	assert.Equal(t, "b", si.intern("b"))
+	assert.Equal(t, "a", si.intern("a"))
+	assert.Equal(t, "c", si.intern("c"))
+	assert.EqualValues(t, 2, si.size)
+	_, ok := si.strings.Load("c")
+	assert.False(t, ok)
+}
+
+func unsafeStringData(s string) uintptr {
+	return (*reflect.StringHeader)(unsafe.Pointer(&s)).Data //nolint:gosec
+}
+
+func BenchmarkIntoSampleTags(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		tags := map[string]string{
+			"method": "GET",
+			"url":    "https://test.k6.io/contacts.php",
+			"name":   "https://test.k6.io/contacts.php",
+			"status": strconv.Itoa(200 + i%3),
+			"proto":  "HTTP/1.1",
+		}
+		_ = IntoSampleTags(&tags)
+	}
+}
+
+func TestSampleTagsHash(t *testing.T) {
+	t.Parallel()
+	var nilTags *SampleTags
+	assert.Equal(t, uint32(0), nilTags.Hash())
+
+	tags := NewSampleTags(map[string]string{"method": "GET", "status": "200", "url": "/"})
+	assert.Equal(t, tags.Hash(), NewSampleTags(tags.CloneTags()).Hash())
+	assert.NotEqual(t, tags.Hash(), NewSampleTags(map[string]string{"method": "GET", "status": "404", "url": "/"}).Hash())
+	assert.NotEqual(t,
+		NewSampleTags(map[string]string{"ab": "c"}).Hash(),
+		NewSampleTags(map[string]string{"a": "bc"}).Hash(),
+	)
+}
@@ -34,10 +34,12 @@ import (
 
 // Config defines the StatsD configuration.
 type Config struct {
-	Addr         null.String        `json:"addr,omitempty" envconfig:"K6_STATSD_ADDR"`
-	BufferSize   null.Int           `json:"bufferSize,omitempty" envconfig:"K6_STATSD_BUFFER_SIZE"`
-	Namespace    null.String        `json:"namespace,omitempty" envconfig:"K6_STATSD_NAMESPACE"`
-	PushInterval types.NullDuration `json:"pushInterval,omitempty" envconfig:"K6_STATSD_PUSH_INTERVAL"`
+	Addr            null.String        `json:"addr,omitempty" envconfig:"K6_STATSD_ADDR"`
+	BufferSize      null.Int           `json:"bufferSize,omitempty" envconfig:"K6_STATSD_BUFFER_SIZE"`
+	Namespace       null.String        `json:"namespace,omitempty" envconfig:"K6_STATSD_NAMESPACE"`
+	PushInterval    types.NullDuration `json:"pushInterval,omitempty" envconfig:"K6_STATSD_PUSH_INTERVAL"`
+	BatchMaxSamples null.Int           `json:"batchMaxSamples,omitempty" envconfig:"K6_STATSD_BATCH_MAX_SAMPLES"`
+	BatchMaxBytes   null.Int           `json:"batchMaxBytes,omitempty" envconfig:"K6_STATSD_BATCH_MAX_BYTES"`
 }
 
 // GetAddr returns the address of the StatsD service.
@@ -60,6 +62,16 @@ func (c Config) GetPushInterval() types.NullDuration {
 	return c.PushInterval
 }
 
+// GetBatchMaxSamples returns the number of samples that triggers a push.
+func (c Config) GetBatchMaxSamples() null.Int {
+	return c.BatchMaxSamples
+}
+
+// GetBatchMaxBytes returns the approximate batch size that triggers a push.
+func (c Config) GetBatchMaxBytes() null.Int {
+	return c.BatchMaxBytes
+}
+
 var _ common.Config = &Config{}
 
 // Apply saves config non-zero config values from the passed config in the receiver.
@@ -76,6 +88,12 @@ func (c Config) Apply(cfg Config) Config {
 	if cfg.PushInterval.Valid {
 		c.PushInterval = cfg.PushInterval
 	}
+	if cfg.BatchMaxSamples.Valid {
+		c.BatchMaxSamples = cfg.BatchMaxSamples
+	}
+	if cfg.BatchMaxBytes.Valid {
+		c.BatchMaxBytes = cfg.BatchMaxBytes
+	}
 
 	return c
 }
@@ -23,7 +23,6 @@ package common
 import (
 	"context"
 	"fmt"
-	"sync"
 	"time"
 
 	"github.com/DataDog/datadog-go/statsd"
@@ -32,6 +31,7 @@ import (
 
 	"github.com/loadimpact/k6/lib"
 	"github.com/loadimpact/k6/lib/types"
+	"github.com/loadimpact/k6/output"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -41,6 +41,8 @@ type Config interface {
 	GetBufferSize() null.Int
 	GetNamespace() null.String
 	GetPushInterval() types.NullDuration
+	GetBatchMaxSamples() null.Int
+	GetBatchMaxBytes() null.Int
 }
 
 var _ lib.Collector = &Collector{}
@@ -53,11 +55,10 @@ type Collector struct {
 	// of those tags that should be sent. No tags are send in case of ProcessTags being null
 	ProcessTags func(map[string]string) []string
 
-	Logger     logrus.FieldLogger
-	client     *statsd.Client
-	startTime  time.Time
-	buffer     []*Sample
-	bufferLock sync.Mutex
+	Logger    logrus.FieldLogger
+	client    *statsd.Client
+	startTime time.Time
+	batcher   *output.Batcher
 }
 
 // Init sets up the collector
@@ -84,6 +85,16 @@ func (c *Collector) Init() (err error) {
 		c.client.Namespace = namespace
 	}
 
+	c.batcher, err = output.NewBatcher(output.BatchConfig{
+		MaxSamples: int(c.Config.GetBatchMaxSamples().Int64),
+		MaxBytes:   int(c.Config.GetBatchMaxBytes().Int64),
+		MaxLatency: time.Duration(c.Config.GetPushInterval().Duration),
+	})
+	if err != nil {
+		c.Logger.Error(err)
+		return err
+	}
+
 	return nil
 }
 
@@ -95,47 +106,30 @@ func (c *Collector) Link() string {
 // Run the collector
 func (c *Collector) Run(ctx context.Context) {
 	c.Logger.Debugf("%s: Running!", c.Type)
-	ticker := time.NewTicker(time.Duration(c.Config.GetPushInterval().Duration))
 	c.startTime = time.Now()
-
-	for {
-		select {
-		case <-ticker.C:
-			c.pushMetrics()
-		case <-ctx.Done():
-			c.pushMetrics()
-			c.finish()
-			return
-		}
-	}
+	c.batcher.Start(c.pushMetrics)
+	<-ctx.Done()
+	c.batcher.Stop()
+	c.finish()
 }
 
 // Collect metrics
 func (c *Collector) Collect(containers []stats.SampleContainer) {
-	var pointSamples []*Sample
-
-	for _, container := range containers {
-		for _, sample := range container.GetSamples() {
-			pointSamples = append(pointSamples, generateDataPoint(sample))
-		}
-	}
-
-	if len(pointSamples) > 0 {
-		c.bufferLock.Lock()
-		c.buffer = append(c.buffer, pointSamples...)
-		c.bufferLock.Unlock()
-	}
+	c.batcher.AddMetricSamples(containers)
 }
 
 func (c *Collector) pushMetrics() {
-	c.bufferLock.Lock()
-	if len(c.buffer) == 0 {
-		c.bufferLock.Unlock()
+	containers := c.batcher.GetBufferedSamples()
+	if len(containers) == 0 {
 		return
 	}
-	buffer := c.buffer
-	c.buffer = nil
-	c.bufferLock.Unlock()
+	var buffer []*Sample
+	for _, container := range containers {
+		for _, sample := range container.GetSamples() {
+			buffer = append(buffer, generateDataPoint(sample))
+		}
+	}
+	c.batcher.ReleaseBufferedSamples(containers)
 
 	c.Logger.
 		WithField("samples", len(buffer)).
@@ -182,6 +176,8 @@ func (c *Collector) dispatch(entry *Sample) error {
 		return c.client.Count(entry.Metric, int64(entry.Value), tagList, 1)
 	case stats.Trend:
 		return c.client.TimeInMilliseconds(entry.Metric, entry.Value, tagList, 1)
+	case stats.Histogram:
+		return c.client.Histogram(entry.Metric, entry.Value, tagList, 1)
 	case stats.Gauge:
 		return c.client.Gauge(entry.Metric, entry.Value, tagList, 1)
 	case stats.Rate:
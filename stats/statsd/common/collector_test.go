@@ -52,6 +52,14 @@ func (c config) GetPushInterval() types.NullDuration {
 	return c.pushInterval
 }
 
+func (c config) GetBatchMaxSamples() null.Int {
+	return null.Int{}
+}
+
+func (c config) GetBatchMaxBytes() null.Int {
+	return null.Int{}
+}
+
 func TestInitWithoutAddressErrors(t *testing.T) {
 	c := &Collector{
 		Config: config{},
@@ -22,6 +22,7 @@ package stats
 
 import (
 	"encoding/json"
+	"reflect"
 	"time"
 
 	"github.com/dop251/goja"
@@ -50,7 +51,8 @@ func init() {
 type Threshold struct {
 	// Source is the text based source of the threshold
 	Source string
-	// LastFailed is a makrer if the last testing of this threshold failed
+	// LastFailed is a makrer if the last testing of this threshold failed, or
+	// for windowed thresholds, if any of the earlier ones did
 	LastFailed bool
 	// AbortOnFail marks if a given threshold fails that the whole test should be aborted
 	AbortOnFail bool
@@ -58,12 +60,18 @@ type Threshold struct {
 	// this threshold will abort the test
 	AbortGracePeriod types.NullDuration
 
-	pgm *goja.Program
-	rt  *goja.Runtime
+	pgm      *goja.Program
+	rt       *goja.Runtime
+	compiled thresholdEvaluator
+	windows  []thresholdWindow
 }
 
 func newThreshold(src string, newThreshold *goja.Runtime, abortOnFail bool, gracePeriod types.NullDuration) (*Threshold, error) {
-	pgm, err := goja.Compile("__threshold__", src, true)
+	windowedSrc, windows, err := parseThresholdWindows(src)
+	if err != nil {
+		return nil, err
+	}
+	pgm, err := goja.Compile("__threshold__", windowedSrc, true)
 	if err != nil {
 		return nil, err
 	}
@@ -74,10 +82,23 @@ func newThreshold(src string, newThreshold *goja.Runtime, abortOnFail bool, grac
 		AbortGracePeriod: gracePeriod,
 		pgm:              pgm,
 		rt:               newThreshold,
+		compiled:         compileThreshold(windowedSrc),
+		windows:          windows,
 	}, nil
 }
 
-func (t Threshold) runNoTaint() (bool, error) {
+// runNoTaint evaluates the threshold with its precompiled form if possible. The
+// JS runtime is used only as a fallback, after it has been prepared for that by
+// the (optional) prepareVM callback.
+func (t Threshold) runNoTaint(sink Sink, values map[string]float64, prepareVM func()) (bool, error) {
+	if t.compiled != nil {
+		if b, ok := t.compiled(sink, values); ok {
+			return b, nil
+		}
+	}
+	if prepareVM != nil {
+		prepareVM()
+	}
 	v, err := t.rt.RunProgram(t.pgm)
 	if err != nil {
 		return false, err
@@ -85,9 +106,23 @@ func (t Threshold) runNoTaint() (bool, error) {
 	return v.ToBoolean(), nil
 }
 
-func (t *Threshold) run() (bool, error) {
-	b, err := t.runNoTaint()
-	t.LastFailed = !b
+// hasWindowValues returns false if any of the windows of the threshold is
+// empty, in which case it can't be evaluated.
+func (t Threshold) hasWindowValues(values map[string]float64) bool {
+	for _, w := range t.windows {
+		if _, ok := values[w.name]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// run evaluates the threshold and updates LastFailed. Windowed thresholds
+// stay failed once they were breached, even if their windows recover later,
+// so that their end-of-test result means that they were ever breached.
+func (t *Threshold) run(sink Sink, values map[string]float64, prepareVM func()) (bool, error) {
+	b, err := t.runNoTaint(sink, values, prepareVM)
+	t.LastFailed = !b || (t.LastFailed && len(t.windows) > 0)
 	return b, err
 }
 
@@ -110,6 +145,12 @@ func (tc *thresholdConfig) UnmarshalJSON(data []byte) error {
 	return json.Unmarshal(data, rawConfig)
 }
 
+// KnownKeysType returns the type that the object form of thresholds is decoded
+// into, so unknown keys in it can be reported.
+func (tc *thresholdConfig) KnownKeysType([]byte) reflect.Type {
+	return reflect.TypeOf(rawThresholdConfig{})
+}
+
 func (tc thresholdConfig) MarshalJSON() ([]byte, error) {
 	if tc.AbortOnFail {
 		return json.Marshal(rawThresholdConfig(tc))
@@ -122,6 +163,10 @@ type Thresholds struct {
 	Runtime    *goja.Runtime
 	Thresholds []*Threshold
 	Abort      bool
+
+	// The recent samples of the metric, if any of the thresholds has windowed
+	// aggregations. It's a pointer, so it's shared by all copies.
+	windows *windowSamples
 }
 
 // NewThresholds returns Thresholds objects representing the provided source strings
@@ -141,42 +186,60 @@ func newThresholdsWithConfig(configs []thresholdConfig) (Thresholds, error) {
 	}
 
 	ts := make([]*Threshold, len(configs))
+	var maxWindow time.Duration
 	for i, config := range configs {
 		t, err := newThreshold(config.Threshold, rt, config.AbortOnFail, config.AbortGracePeriod)
 		if err != nil {
 			return Thresholds{}, errors.Wrapf(err, "%d", i)
 		}
 		ts[i] = t
+		for _, w := range t.windows {
+			if w.length > maxWindow {
+				maxWindow = w.length
+			}
+		}
 	}
 
-	return Thresholds{rt, ts, false}, nil
+	thresholds := Thresholds{Runtime: rt, Thresholds: ts}
+	if maxWindow > 0 {
+		thresholds.windows = &windowSamples{maxLength: maxWindow}
+	}
+	return thresholds, nil
 }
 
-func (ts *Thresholds) updateVM(sink Sink, t time.Duration) error {
+func (ts *Thresholds) updateVM(sink Sink, values map[string]float64) {
 	ts.Runtime.Set("__sink__", sink)
-	f := sink.Format(t)
-	for k, v := range f {
+	for k, v := range values {
 		ts.Runtime.Set(k, v)
 	}
-	return nil
 }
 
-func (ts *Thresholds) runAll(t time.Duration) (bool, error) {
+func (ts *Thresholds) runAll(sink Sink, values map[string]float64, t time.Duration) (bool, error) {
+	vmUpdated := false
+	prepareVM := func() {
+		if !vmUpdated && sink != nil {
+			ts.updateVM(sink, values)
+			vmUpdated = true
+		}
+	}
+
 	succ := true
 	for i, th := range ts.Thresholds {
-		b, err := th.run()
-		if err != nil {
-			return false, errors.Wrapf(err, "%d", i)
+		// Thresholds with empty windows aren't evaluated, since there is
+		// nothing in them that could have degraded, but they keep their
+		// earlier result
+		if th.hasWindowValues(values) {
+			b, err := th.run(sink, values, prepareVM)
+			if err != nil {
+				return false, errors.Wrapf(err, "%d", i)
+			}
+			if !b && !ts.Abort && th.AbortOnFail {
+				ts.Abort = !th.AbortGracePeriod.Valid ||
+					th.AbortGracePeriod.Duration < types.Duration(t)
+			}
 		}
-		if !b {
+		if th.LastFailed {
 			succ = false
-
-			if ts.Abort || !th.AbortOnFail {
-				continue
-			}
-
-			ts.Abort = !th.AbortGracePeriod.Valid ||
-				th.AbortGracePeriod.Duration < types.Duration(t)
 		}
 	}
 	return succ, nil
@@ -185,10 +248,19 @@ func (ts *Thresholds) runAll(t time.Duration) (bool, error) {
 // Run processes all the thresholds with the provided Sink at the provided time and returns if any
 // of them fails
 func (ts *Thresholds) Run(sink Sink, t time.Duration) (bool, error) {
-	if err := ts.updateVM(sink, t); err != nil {
-		return false, err
+	values := sink.Format(t)
+	if ts.windows != nil {
+		// The sink's own map shouldn't be modified
+		allValues := make(map[string]float64, len(values))
+		for k, v := range values {
+			allValues[k] = v
+		}
+		if err := ts.setWindowValues(sink, allValues, time.Now(), t); err != nil {
+			return false, err
+		}
+		values = allValues
 	}
-	return ts.runAll(t)
+	return ts.runAll(sink, values, t)
 }
 
 // UnmarshalJSON is implementation of json.Unmarshaler
@@ -205,6 +277,12 @@ func (ts *Thresholds) UnmarshalJSON(data []byte) error {
 	return nil
 }
 
+// KnownKeysType returns the type of the threshold configs, so unknown keys in
+// their object form can be reported.
+func (ts *Thresholds) KnownKeysType([]byte) reflect.Type {
+	return reflect.TypeOf([]thresholdConfig{})
+}
+
 // MarshalJSON is implementation of json.Marshaler
 func (ts Thresholds) MarshalJSON() ([]byte, error) {
 	configs := make([]thresholdConfig, len(ts.Thresholds))
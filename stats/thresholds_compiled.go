@@ -0,0 +1,107 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"regexp"
+	"strconv"
+)
+
+// thresholdEvaluator is the precompiled form of a threshold expression. The
+// second return value is false when the expression couldn't be evaluated
+// natively, e.g. because the aggregation method isn't supported by the sink,
+// in which case the threshold should be evaluated by the JS runtime instead.
+type thresholdEvaluator func(sink Sink, values map[string]float64) (result bool, ok bool)
+
+// The vast majority of thresholds are simple comparisons between a single
+// aggregated value of the metric and a constant, like `p(95)<500` or
+// `rate>0.99`, so it's worth it to evaluate them without going through JS.
+var simpleThresholdRegex = regexp.MustCompile(
+	`^\s*(?:([a-zA-Z_$][\w$]*)|p\(\s*(\d+(?:\.\d*)?|\.\d+)\s*\))\s*` + // aggregation method or percentile
+		`(<=|>=|===|!==|==|!=|<|>)\s*` + // operator
+		`(-?(?:\d+(?:\.\d*)?|\.\d+)(?:[eE][-+]?\d+)?)\s*;?\s*$`, // numeric constant
+)
+
+type percentileSink interface {
+	P(pct float64) float64
+}
+
+// compileThreshold tries to parse the given threshold source into a native
+// evaluator. It returns nil if the source is anything more complicated than
+// a comparison of an aggregation method with a numeric constant.
+func compileThreshold(src string) thresholdEvaluator {
+	matches := simpleThresholdRegex.FindStringSubmatch(src)
+	if matches == nil {
+		return nil
+	}
+	aggName, pctSrc, operator, constSrc := matches[1], matches[2], matches[3], matches[4]
+
+	constant, err := strconv.ParseFloat(constSrc, 64)
+	if err != nil {
+		return nil
+	}
+	compare := compileComparison(operator, constant)
+	if compare == nil {
+		return nil
+	}
+
+	if pctSrc != "" {
+		pct, err := strconv.ParseFloat(pctSrc, 64)
+		if err != nil {
+			return nil
+		}
+		pct /= 100.0
+		return func(sink Sink, _ map[string]float64) (bool, bool) {
+			ps, ok := sink.(percentileSink)
+			if !ok {
+				return false, false
+			}
+			return compare(ps.P(pct)), true
+		}
+	}
+
+	return func(_ Sink, values map[string]float64) (bool, bool) {
+		value, ok := values[aggName]
+		if !ok {
+			return false, false
+		}
+		return compare(value), true
+	}
+}
+
+func compileComparison(operator string, constant float64) func(float64) bool {
+	switch operator {
+	case "<":
+		return func(v float64) bool { return v < constant }
+	case "<=":
+		return func(v float64) bool { return v <= constant }
+	case ">":
+		return func(v float64) bool { return v > constant }
+	case ">=":
+		return func(v float64) bool { return v >= constant }
+	case "==", "===":
+		return func(v float64) bool { return v == constant }
+	case "!=", "!==":
+		return func(v float64) bool { return v != constant }
+	default:
+		return nil
+	}
+}
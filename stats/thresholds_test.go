@@ -22,11 +22,13 @@ package stats
 
 import (
 	"encoding/json"
+	"fmt"
 	"testing"
 	"time"
 
 	"github.com/dop251/goja"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/loadimpact/k6/lib/types"
 )
@@ -53,14 +55,14 @@ func TestThresholdRun(t *testing.T) {
 		assert.NoError(t, err)
 
 		t.Run("no taint", func(t *testing.T) {
-			b, err := th.runNoTaint()
+			b, err := th.runNoTaint(nil, nil, nil)
 			assert.NoError(t, err)
 			assert.True(t, b)
 			assert.False(t, th.LastFailed)
 		})
 
 		t.Run("taint", func(t *testing.T) {
-			b, err := th.run()
+			b, err := th.run(nil, nil, nil)
 			assert.NoError(t, err)
 			assert.True(t, b)
 			assert.False(t, th.LastFailed)
@@ -72,14 +74,14 @@ func TestThresholdRun(t *testing.T) {
 		assert.NoError(t, err)
 
 		t.Run("no taint", func(t *testing.T) {
-			b, err := th.runNoTaint()
+			b, err := th.runNoTaint(nil, nil, nil)
 			assert.NoError(t, err)
 			assert.False(t, b)
 			assert.False(t, th.LastFailed)
 		})
 
 		t.Run("taint", func(t *testing.T) {
-			b, err := th.run()
+			b, err := th.run(nil, nil, nil)
 			assert.NoError(t, err)
 			assert.False(t, b)
 			assert.True(t, th.LastFailed)
@@ -135,7 +137,7 @@ func TestNewThresholdsWithConfig(t *testing.T) {
 func TestThresholdsUpdateVM(t *testing.T) {
 	ts, err := NewThresholds(nil)
 	assert.NoError(t, err)
-	assert.NoError(t, ts.updateVM(DummySink{"a": 1234.5}, 0))
+	ts.updateVM(DummySink{"a": 1234.5}, DummySink{"a": 1234.5}.Format(0))
 	assert.Equal(t, 1234.5, ts.Runtime.Get("a").ToFloat())
 }
 
@@ -172,7 +174,7 @@ func TestThresholdsRunAll(t *testing.T) {
 
 			assert.NoError(t, err)
 
-			b, err := ts.runAll(runDuration)
+			b, err := ts.runAll(nil, nil, runDuration)
 
 			if data.err {
 				assert.Error(t, err)
@@ -323,3 +325,217 @@ func TestThresholdsJSON(t *testing.T) {
 		assert.False(t, ts.Abort)
 	})
 }
+
+func TestCompileThreshold(t *testing.T) {
+	t.Parallel()
+	sink := &TrendSink{}
+	for _, v := range []float64{10, 20, 30, 40, 50, 60, 70, 80, 90, 100} {
+		sink.Add(Sample{Value: v})
+	}
+
+	compiled := []string{
+		`avg<100`, `avg > 55`, `avg>=55`, `avg == 55`, `avg===55`, `avg!=55`, `avg!==55`,
+		`min<=10`, `max<-1`, `med>.5`, `p(95)<95`, `p(99.9) < 100;`, `p(50)>=5e1`, ` p( 90 ) >= 91 `,
+	}
+	for _, src := range compiled {
+		src := src
+		t.Run(src, func(t *testing.T) {
+			t.Parallel()
+			eval := compileThreshold(src)
+			require.NotNil(t, eval)
+			b, ok := eval(sink, sink.Format(0))
+			require.True(t, ok)
+
+			// The result must be exactly the same as the one from the JS runtime
+			ts, err := NewThresholds([]string{src})
+			require.NoError(t, err)
+			ts.updateVM(sink, sink.Format(0))
+			v, err := ts.Runtime.RunProgram(ts.Thresholds[0].pgm)
+			require.NoError(t, err)
+			assert.Equal(t, v.ToBoolean(), b)
+		})
+	}
+
+	for _, src := range []string{`1+1==2`, `avg<100 && avg>0`, `(avg<100)`, `avg<x`, `p(x)<100`, `100>avg`} {
+		assert.Nil(t, compileThreshold(src), src)
+	}
+
+	t.Run("fallback", func(t *testing.T) {
+		t.Parallel()
+		eval := compileThreshold(`p(95)<100`)
+		require.NotNil(t, eval)
+		_, ok := eval(DummySink{"p(95)": 1}, map[string]float64{"p(95)": 1})
+		assert.False(t, ok)
+
+		eval = compileThreshold(`rate<100`)
+		require.NotNil(t, eval)
+		_, ok = eval(sink, sink.Format(0))
+		assert.False(t, ok)
+	})
+}
+
+func TestThresholdsRunPrecompiled(t *testing.T) {
+	t.Parallel()
+	ts, err := NewThresholds([]string{`rate>0.5`, `rate<0.9`})
+	require.NoError(t, err)
+	b, err := ts.Run(&RateSink{Trues: 3, Total: 4}, 0)
+	require.NoError(t, err)
+	assert.True(t, b)
+	// Simple thresholds shouldn't touch the JS runtime at all
+	assert.Nil(t, ts.Runtime.Get("__sink__"))
+
+	ts, err = NewThresholds([]string{`rate>0.5`, `rate<0.9 && rate>0.7`})
+	require.NoError(t, err)
+	b, err = ts.Run(&RateSink{Trues: 3, Total: 4}, 0)
+	require.NoError(t, err)
+	assert.True(t, b)
+	assert.NotNil(t, ts.Runtime.Get("__sink__"))
+	assert.False(t, ts.Thresholds[0].LastFailed)
+	assert.False(t, ts.Thresholds[1].LastFailed)
+}
+
+func TestThresholdsRunWindowed(t *testing.T) {
+	t.Parallel()
+	now := time.Now()
+	newThresholds := func(t *testing.T, sink Sink, srcs []string, values map[time.Duration]float64) Thresholds {
+		ts, err := NewThresholds(srcs)
+		require.NoError(t, err)
+		for ago, value := range values {
+			for i := 0; i < 10; i++ {
+				sample := Sample{Time: now.Add(-ago), Value: value}
+				sink.Add(sample)
+				ts.AddSample(sample)
+			}
+		}
+		return ts
+	}
+
+	t.Run("trend", func(t *testing.T) {
+		t.Parallel()
+		ts := newThresholds(t, &TrendSink{}, []string{
+			`avg_over(1m) < 200`, `p_over(95, 1m) < 200`, `avg < 200`, `max_over(10m) < 200`,
+		}, map[time.Duration]float64{5 * time.Minute: 1000, 10 * time.Second: 100})
+		b, err := ts.Run(&TrendSink{}, 10*time.Minute)
+		require.NoError(t, err)
+		assert.False(t, b)
+		assert.False(t, ts.Thresholds[0].LastFailed)
+		assert.False(t, ts.Thresholds[1].LastFailed)
+		assert.False(t, ts.Thresholds[2].LastFailed) // the whole-test sink is empty
+		assert.True(t, ts.Thresholds[3].LastFailed)
+	})
+	t.Run("rate", func(t *testing.T) {
+		t.Parallel()
+		sink := &RateSink{}
+		ts := newThresholds(t, sink, []string{`rate(http_req_failed[1m]) < 0.01`, `rate < 0.01`},
+			map[time.Duration]float64{5 * time.Minute: 1, 10 * time.Second: 0})
+		b, err := ts.Run(sink, 10*time.Minute)
+		require.NoError(t, err)
+		assert.False(t, b)
+		assert.False(t, ts.Thresholds[0].LastFailed)
+		assert.True(t, ts.Thresholds[1].LastFailed)
+
+		ts.AddSample(Sample{Time: now, Value: 1})
+		b, err = ts.Run(sink, 10*time.Minute)
+		require.NoError(t, err)
+		assert.False(t, b)
+		assert.True(t, ts.Thresholds[0].LastFailed)
+	})
+	t.Run("counter", func(t *testing.T) {
+		t.Parallel()
+		sink := &CounterSink{}
+		ts := newThresholds(t, sink, []string{`rate_over(10s) == 2`, `(count_over(1m) == 20)`},
+			map[time.Duration]float64{5 * time.Second: 2, 2 * time.Minute: 5})
+		b, err := ts.Run(sink, 5*time.Minute)
+		require.NoError(t, err)
+		assert.True(t, b)
+	})
+	t.Run("empty window", func(t *testing.T) {
+		t.Parallel()
+		sink := &TrendSink{}
+		ts := newThresholds(t, sink, []string{`avg_over(1s) < 1`}, map[time.Duration]float64{time.Minute: 100})
+		b, err := ts.Run(sink, 5*time.Minute)
+		require.NoError(t, err)
+		assert.True(t, b)
+	})
+	t.Run("ever breached", func(t *testing.T) {
+		t.Parallel()
+		sink := &TrendSink{}
+		ts, err := NewThresholds([]string{`avg_over(1m) < 200`, `avg < 200`})
+		require.NoError(t, err)
+		window := ts.Thresholds[0].windows[0].name
+		sink.Add(Sample{Time: now, Value: 100})
+
+		b, err := ts.runAll(sink, map[string]float64{"avg": 100, window: 1000}, time.Minute)
+		require.NoError(t, err)
+		assert.False(t, b)
+		assert.True(t, ts.Thresholds[0].LastFailed)
+
+		// Neither a recovered window nor an empty one clear the failure
+		for _, values := range []map[string]float64{{"avg": 100, window: 100}, {"avg": 100}} {
+			b, err = ts.runAll(sink, values, 2*time.Minute)
+			require.NoError(t, err)
+			assert.False(t, b)
+			assert.True(t, ts.Thresholds[0].LastFailed)
+			assert.False(t, ts.Thresholds[1].LastFailed)
+		}
+
+		// The thresholds of the whole test run still recover
+		b, err = ts.runAll(sink, map[string]float64{"avg": 1000}, 3*time.Minute)
+		require.NoError(t, err)
+		assert.False(t, b)
+		assert.True(t, ts.Thresholds[1].LastFailed)
+		_, err = ts.runAll(sink, map[string]float64{"avg": 100}, 4*time.Minute)
+		require.NoError(t, err)
+		assert.False(t, ts.Thresholds[1].LastFailed)
+	})
+	t.Run("errors", func(t *testing.T) {
+		t.Parallel()
+		for _, src := range []string{`p_over(1m) < 1`, `avg_over(95, 1m) < 1`, `avg_over(0s) < 1`, `p_over(101, 1m) < 1`} {
+			_, err := NewThresholds([]string{src})
+			assert.Error(t, err, src)
+		}
+
+		sink := &GaugeSink{}
+		ts := newThresholds(t, sink, []string{`avg_over(1m) < 1`}, map[time.Duration]float64{time.Second: 1})
+		_, err := ts.Run(sink, time.Minute)
+		assert.Error(t, err)
+	})
+	t.Run("metric", func(t *testing.T) {
+		t.Parallel()
+		ts, err := NewThresholds([]string{`rate(http_req_failed[1m]) < 0.01`})
+		require.NoError(t, err)
+		assert.NoError(t, ts.CheckMetric("http_req_failed"))
+		assert.NoError(t, ts.CheckMetric("http_req_failed{scenario:api}"))
+		assert.Error(t, ts.CheckMetric("http_req_duration"))
+	})
+}
+
+func BenchmarkThresholdsRun(b *testing.B) {
+	sink := &TrendSink{}
+	for i := 0; i < 1000; i++ {
+		sink.Add(Sample{Value: float64(i)})
+	}
+
+	benchmarks := map[string]string{
+		"precompiled": `p(95)<%d`,
+		"js":          `(p(95)<%d)`,
+	}
+	for name, format := range benchmarks {
+		format := format
+		b.Run(name, func(b *testing.B) {
+			sources := make([]string, 200)
+			for i := range sources {
+				sources[i] = fmt.Sprintf(format, 500+i)
+			}
+			ts, err := NewThresholds(sources)
+			require.NoError(b, err)
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := ts.Run(sink, time.Second); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
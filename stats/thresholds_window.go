@@ -0,0 +1,267 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loadimpact/k6/lib/types"
+)
+
+// Windowed aggregations are evaluated only over the samples of the last part
+// of the test run, instead of over all of them, so that thresholds can catch
+// a sustained degradation without being tripped by a single spike. There are
+// two equivalent forms of them:
+//
+//   - `avg_over(1m)`, `rate_over(30s)`, `p_over(99, 1m)`, etc.
+//   - `rate(http_req_failed[1m])`, like in PromQL, where the metric name
+//     has to be the one the threshold is defined for (or its parent)
+//
+// Before the threshold source is compiled, the aggregations in it are replaced
+// with variables, which are then set to the values of the windows.
+var (
+	windowOverRegex = regexp.MustCompile(
+		`\b([a-zA-Z_]\w*?)_over\(\s*(?:(\d+(?:\.\d*)?|\.\d+)\s*,\s*)?([0-9][0-9a-zµ.]*)\s*\)`,
+	)
+	windowRangeRegex = regexp.MustCompile(
+		`\b([a-zA-Z_]\w*)\(\s*([\w.]+(?:\{[^}]*\})?)\s*\[\s*([0-9][0-9a-zµ.]*)\s*\]\s*\)`,
+	)
+)
+
+// thresholdWindow is a windowed aggregation used by a threshold.
+type thresholdWindow struct {
+	name   string // the name of the variable in the rewritten source
+	method string // a key of the Format() result or "p" for percentiles
+	pct    float64
+	length time.Duration
+	metric string // the metric in the PromQL-like form, if it was used
+}
+
+// parseThresholdWindows returns the given threshold source with all windowed
+// aggregations in it replaced by variables, and the aggregations themselves.
+func parseThresholdWindows(src string) (string, []thresholdWindow, error) {
+	var windows []thresholdWindow
+	var firstErr error
+	addWindow := func(method, pctSrc, lengthSrc, metric string) string {
+		window, err := newThresholdWindow(method, pctSrc, lengthSrc, metric)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			return "0"
+		}
+		windows = append(windows, window)
+		return window.name
+	}
+
+	src = windowOverRegex.ReplaceAllStringFunc(src, func(match string) string {
+		m := windowOverRegex.FindStringSubmatch(match)
+		return addWindow(m[1], m[2], m[3], "")
+	})
+	src = windowRangeRegex.ReplaceAllStringFunc(src, func(match string) string {
+		m := windowRangeRegex.FindStringSubmatch(match)
+		return addWindow(m[1], "", m[3], m[2])
+	})
+	return src, windows, firstErr
+}
+
+func newThresholdWindow(method, pctSrc, lengthSrc, metric string) (thresholdWindow, error) {
+	length, err := types.ParseExtendedDuration(lengthSrc)
+	if err != nil {
+		return thresholdWindow{}, fmt.Errorf("invalid window '%s': %w", lengthSrc, err)
+	}
+	if length <= 0 {
+		return thresholdWindow{}, fmt.Errorf("the window '%s' should be positive", lengthSrc)
+	}
+
+	window := thresholdWindow{method: method, length: length, metric: metric}
+	switch {
+	case method == "p" && pctSrc != "":
+		pct, err := strconv.ParseFloat(pctSrc, 64)
+		if err != nil || pct < 0 || pct > 100 {
+			return thresholdWindow{}, fmt.Errorf("invalid percentile '%s' of the %s window", pctSrc, lengthSrc)
+		}
+		window.pct = pct
+		window.name = fmt.Sprintf("__p%s_over_%d__", strings.ReplaceAll(pctSrc, ".", "_"), length)
+	case method == "p":
+		return thresholdWindow{}, fmt.Errorf("the percentile of the %s window should be specified, e.g. p_over(95, %s)",
+			lengthSrc, lengthSrc)
+	case pctSrc != "":
+		return thresholdWindow{}, fmt.Errorf("only p_over() accepts a percentile, %s_over() doesn't", method)
+	default:
+		window.name = fmt.Sprintf("__%s_over_%d__", method, length)
+	}
+	return window, nil
+}
+
+// value returns the value of the window aggregation for the given sink, which
+// contains only the samples of the window. The time is used for the per-second
+// rates and it's shorter than the window only at the start of the test run.
+func (w thresholdWindow) value(sink Sink, t time.Duration) (float64, error) {
+	if w.method == "p" {
+		ps, ok := sink.(percentileSink)
+		if !ok {
+			return 0, fmt.Errorf("the percentiles of the last %s aren't supported by the metric", w.length)
+		}
+		return ps.P(w.pct / 100.0), nil
+	}
+	if t <= 0 || t > w.length {
+		t = w.length
+	}
+	value, ok := sink.Format(t)[w.method]
+	if !ok {
+		return 0, fmt.Errorf("the metric doesn't have a '%s' aggregation for the last %s", w.method, w.length)
+	}
+	return value, nil
+}
+
+type windowSample struct {
+	time  time.Time
+	value float64
+}
+
+// windowSamples keeps the values of the samples of the longest window of the
+// thresholds of a metric. The samples are evicted roughly in the order in
+// which they were added, which is close enough to their chronological order.
+type windowSamples struct {
+	maxLength time.Duration
+	samples   []windowSample
+	head      int
+}
+
+func (ws *windowSamples) add(sample Sample) {
+	ws.evict(sample.Time)
+	ws.samples = append(ws.samples, windowSample{time: sample.Time, value: sample.Value})
+}
+
+// evict drops the samples that are too old for any of the windows at the
+// given time.
+func (ws *windowSamples) evict(now time.Time) {
+	cutoff := now.Add(-ws.maxLength)
+	for ws.head < len(ws.samples) && ws.samples[ws.head].time.Before(cutoff) {
+		ws.head++
+	}
+	if ws.head > 1024 && ws.head > len(ws.samples)/2 {
+		ws.samples = append(ws.samples[:0], ws.samples[ws.head:]...)
+		ws.head = 0
+	}
+}
+
+// sink returns a new sink of the same type as the given one, with the samples
+// of the window of the given length before now, or nil if there are none.
+func (ws *windowSamples) sink(like Sink, length time.Duration, now time.Time) (Sink, error) {
+	var sink Sink
+	switch s := like.(type) {
+	case *CounterSink:
+		sink = &CounterSink{}
+	case *GaugeSink:
+		sink = &GaugeSink{}
+	case *TrendSink:
+		sink = &TrendSink{}
+	case *RateSink:
+		sink = &RateSink{}
+	case *HistogramSink:
+		sink = &HistogramSink{Scale: s.Scale}
+	default:
+		return nil, fmt.Errorf("windowed aggregations aren't supported for %T sinks", like)
+	}
+
+	cutoff, empty := now.Add(-length), true
+	for _, s := range ws.samples[ws.head:] {
+		if s.time.Before(cutoff) {
+			continue
+		}
+		sink.Add(Sample{Time: s.time, Value: s.value})
+		empty = false
+	}
+	if empty {
+		return nil, nil
+	}
+	return sink, nil
+}
+
+// setWindowValues adds the values of all windowed aggregations of the
+// thresholds to the given values, except the ones with empty windows.
+func (ts *Thresholds) setWindowValues(sink Sink, values map[string]float64, now time.Time, t time.Duration) error {
+	ts.windows.evict(now)
+	sinks := make(map[time.Duration]Sink)
+	for _, th := range ts.Thresholds {
+		for _, w := range th.windows {
+			if _, ok := values[w.name]; ok {
+				continue
+			}
+			windowSink, ok := sinks[w.length]
+			if !ok {
+				var err error
+				if windowSink, err = ts.windows.sink(sink, w.length, now); err != nil {
+					return err
+				}
+				sinks[w.length] = windowSink
+			}
+			if windowSink == nil {
+				continue
+			}
+			value, err := w.value(windowSink, t)
+			if err != nil {
+				return err
+			}
+			values[w.name] = value
+		}
+	}
+	return nil
+}
+
+// AddSample adds the sample to the windows of the windowed aggregations of
+// the thresholds, if there are any.
+func (ts *Thresholds) AddSample(sample Sample) {
+	if ts.windows != nil {
+		ts.windows.add(sample)
+	}
+}
+
+// HasWindows returns whether any of the thresholds have windowed aggregations,
+// i.e. whether AddSample() needs to be called for the samples of the metric.
+func (ts Thresholds) HasWindows() bool {
+	return ts.windows != nil
+}
+
+// CheckMetric returns an error if a windowed aggregation of the thresholds,
+// like `rate(http_req_failed[1m])`, refers to a metric other than the one
+// with the given name, or its parent metric.
+func (ts Thresholds) CheckMetric(name string) error {
+	parent := name
+	if i := strings.IndexByte(name, '{'); i >= 0 {
+		parent = name[:i]
+	}
+	for _, th := range ts.Thresholds {
+		for _, w := range th.windows {
+			if w.metric != "" && w.metric != name && w.metric != parent {
+				return fmt.Errorf("the threshold '%s' of the metric '%s' refers to the metric '%s'",
+					th.Source, name, w.metric)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import "errors"
+
+// ErrTrendSpillUnsupported is returned when spilling trend values to disk is
+// not supported on the current platform.
+var ErrTrendSpillUnsupported = errors.New("spilling trend values to disk is not supported on this platform")
+
+// TrendSpill configures a TrendSink to move its raw values from the Go heap to
+// a memory-mapped temporary file, once their number reaches Threshold. The
+// values are still accessible through the TrendSink.Values slice, since it is
+// backed directly by the mapped memory, but the OS can page them out as needed.
+type TrendSpill struct {
+	// Directory for the temporary files; the OS default is used if empty.
+	Dir string
+	// Number of values kept on the heap before they are spilled to disk.
+	Threshold int
+	// Called if spilling fails for some reason. The sink then just falls back
+	// to keeping all of its values on the heap.
+	OnError func(error)
+}
+
+// SetSpill enables spilling of the sink values to disk with the supplied
+// configuration. It should be called before any samples are added.
+func (t *TrendSink) SetSpill(spill *TrendSpill) {
+	t.spillConf = spill
+}
+
+// Close releases any resources held by the sink, i.e. the memory-mapped file
+// if the values were spilled to disk. The spilled values are dropped instead
+// of being copied back to the heap, which would need as much memory as not
+// spilling them at all, so it should only be called once the summary and the
+// thresholds are done. Afterwards, only the aggregates like the count, the
+// median and the average are still available, the percentiles are 0 and no
+// more samples should be added.
+func (t *TrendSink) Close() error {
+	if t.spilled == nil {
+		return nil
+	}
+	t.Calc()
+	t.Values = nil
+	err := t.spilled.close()
+	t.spilled = nil
+	return err
+}
+
+// prepareForAdd makes sure there is space for at least one more value in the
+// sink, spilling the values to disk or growing the mapped file if needed.
+func (t *TrendSink) prepareForAdd() {
+	if t.spilled == nil && len(t.Values) < t.spillConf.Threshold {
+		return
+	}
+	if len(t.Values) < cap(t.Values) {
+		return
+	}
+
+	var err error
+	newCap := 2 * cap(t.Values)
+	if newCap < t.spillConf.Threshold {
+		newCap = t.spillConf.Threshold
+	}
+	if t.spilled == nil {
+		t.spilled, err = newMappedFloats(t.spillConf.Dir, newCap)
+		if err == nil {
+			t.Values = t.spilled.values[:copy(t.spilled.values, t.Values)]
+		}
+	} else {
+		length := len(t.Values)
+		if err = t.spilled.grow(newCap); err == nil {
+			t.Values = t.spilled.values[:length]
+		}
+	}
+
+	if err != nil {
+		if t.spilled != nil {
+			// Keep the current values on the heap before we unmap them
+			t.Values = append([]float64(nil), t.Values...)
+			_ = t.spilled.close()
+			t.spilled = nil
+		}
+		conf := t.spillConf
+		t.spillConf = nil
+		if conf.OnError != nil {
+			conf.OnError(err)
+		}
+	}
+}
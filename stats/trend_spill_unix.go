@@ -0,0 +1,96 @@
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package stats
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"syscall"
+	"unsafe"
+)
+
+const float64Size = int(unsafe.Sizeof(float64(0)))
+
+// mappedFloats is a float64 slice backed by a memory-mapped temporary file.
+type mappedFloats struct {
+	file   *os.File
+	mapped []byte
+	values []float64
+}
+
+func newMappedFloats(dir string, capacity int) (*mappedFloats, error) {
+	file, err := ioutil.TempFile(dir, "k6-trend-*.bin")
+	if err != nil {
+		return nil, err
+	}
+	// The file is unlinked immediately, so it's cleaned up by the OS even if
+	// k6 crashes; the open file descriptor and the mapping keep it alive.
+	if err = os.Remove(file.Name()); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	mf := &mappedFloats{file: file}
+	if err = mf.grow(capacity); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return mf, nil
+}
+
+// grow extends the file to fit the given number of values and re-maps it.
+// Since the data is stored in the file, the old values are preserved.
+func (mf *mappedFloats) grow(capacity int) error {
+	size := capacity * float64Size
+	if err := mf.file.Truncate(int64(size)); err != nil {
+		return err
+	}
+	mapped, err := syscall.Mmap(int(mf.file.Fd()), 0, size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+	if err != nil {
+		return err
+	}
+	if mf.mapped != nil {
+		if err = syscall.Munmap(mf.mapped); err != nil {
+			_ = syscall.Munmap(mapped)
+			return err
+		}
+	}
+
+	mf.mapped = mapped
+	header := (*reflect.SliceHeader)(unsafe.Pointer(&mf.values)) //nolint:gosec
+	header.Data = uintptr(unsafe.Pointer(&mapped[0]))             //nolint:gosec
+	header.Len = capacity
+	header.Cap = capacity
+	return nil
+}
+
+func (mf *mappedFloats) close() error {
+	mf.values = nil
+	err := syscall.Munmap(mf.mapped)
+	mf.mapped = nil
+	if cerr := mf.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
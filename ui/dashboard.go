@@ -0,0 +1,172 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+
+	"github.com/loadimpact/k6/lib"
+)
+
+// sparkBlocks are the characters of a sparkline, from the lowest to the
+// highest value.
+var sparkBlocks = []rune("▁▂▃▄▅▆▇█") //nolint:gochecknoglobals
+
+// Sparkline returns the values as a line of block characters, scaled between
+// the smallest and the biggest of them.
+func Sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, v := range values {
+		low, high = math.Min(low, v), math.Max(high, v)
+	}
+	var b strings.Builder
+	for _, v := range values {
+		i := 0
+		if high > low {
+			i = int((v - low) / (high - low) * float64(len(sparkBlocks)-1))
+		}
+		b.WriteRune(sparkBlocks[i])
+	}
+	return b.String()
+}
+
+// DashboardTrend is the history of a percentile of a trend metric, with the
+// latest value last, and the latest value in a human-readable form.
+type DashboardTrend struct {
+	Metric     string
+	Percentile string
+	History    []float64
+	Value      string
+}
+
+// DashboardRate is the share of failures of a rate metric.
+type DashboardRate struct {
+	Name  string
+	Rate  float64
+	Total int64
+}
+
+// DashboardThreshold is the current state of a threshold.
+type DashboardThreshold struct {
+	Metric, Source string
+	Failed         bool
+}
+
+// Dashboard is what the live terminal dashboard of `k6 run --dashboard` shows
+// under the progress bars of the scenarios.
+type Dashboard struct {
+	Elapsed    time.Duration
+	ActiveVUs  int64
+	MaxVUs     int64
+	Iterations uint64
+	Trends     []DashboardTrend
+	ErrorRates []DashboardRate
+	Thresholds []DashboardThreshold
+}
+
+// Render returns the lines of the dashboard, none of them longer than width.
+func (d Dashboard) Render(width int, noColor bool) []string {
+	paint := func(c *color.Color, s string) string {
+		if noColor {
+			return s
+		}
+		return c.Sprint(s)
+	}
+	var lines []string
+	addLine := func(plain string, colored ...string) {
+		// Lines that don't fit are cut before being colored, so the escape
+		// sequences are never cut
+		if width > 0 && len([]rune(plain)) > width {
+			lines = append(lines, string([]rune(plain)[:width]))
+			return
+		}
+		if len(colored) > 0 {
+			lines = append(lines, colored[0])
+			return
+		}
+		lines = append(lines, plain)
+	}
+	heading := func(text string) {
+		lines = append(lines, "")
+		addLine(text, paint(ExtraKeyColor, text))
+	}
+
+	var rate float64
+	if d.Elapsed > 0 {
+		rate = float64(d.Iterations) / d.Elapsed.Seconds()
+	}
+	header := fmt.Sprintf("  elapsed: %s   VUs: %d/%d   iterations: %d (%.2f/s)",
+		d.Elapsed.Truncate(time.Second), d.ActiveVUs, d.MaxVUs, d.Iterations, rate)
+	addLine(header, fmt.Sprintf("  elapsed: %s   VUs: %s   iterations: %s",
+		paint(ValueColor, d.Elapsed.Truncate(time.Second).String()),
+		paint(ValueColor, fmt.Sprintf("%d/%d", d.ActiveVUs, d.MaxVUs)),
+		paint(ValueColor, fmt.Sprintf("%d", d.Iterations))+paint(ExtraColor, fmt.Sprintf(" (%.2f/s)", rate)),
+	))
+
+	if len(d.Trends) > 0 {
+		heading("  trends")
+		for _, trend := range d.Trends {
+			label := fmt.Sprintf("    %s %s ", trend.Metric, trend.Percentile)
+			value := " " + trend.Value
+			history := trend.History
+			if room := width - len([]rune(label)) - len([]rune(value)); width > 0 && len(history) > room {
+				history = history[len(history)-int(lib.Max(int64(room), 0)):]
+			}
+			spark := Sparkline(history)
+			addLine(label+spark+value, label+paint(ValueColor, spark)+paint(ValueColor, value))
+		}
+	}
+
+	if len(d.ErrorRates) > 0 {
+		heading("  errors")
+		for _, er := range d.ErrorRates {
+			c := SuccColor
+			if er.Rate > 0 {
+				c = FailColor
+			}
+			value := fmt.Sprintf("%.2f%%", er.Rate*100)
+			extra := fmt.Sprintf(" of %d", er.Total)
+			label := fmt.Sprintf("    %s: ", er.Name)
+			addLine(label+value+extra, label+paint(c, value)+paint(ExtraColor, extra))
+		}
+	}
+
+	if len(d.Thresholds) > 0 {
+		heading("  thresholds")
+		for _, th := range d.Thresholds {
+			mark, c := succMark, SuccColor
+			if th.Failed {
+				mark, c = failMark, FailColor
+			}
+			text := fmt.Sprintf("%s %s", th.Metric, th.Source)
+			addLine("    "+mark+" "+text, "    "+paint(c, mark)+" "+text)
+		}
+	}
+	return lines
+}
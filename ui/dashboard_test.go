@@ -0,0 +1,89 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSparkline(t *testing.T) {
+	t.Parallel()
+	assert.Equal(t, "", Sparkline(nil))
+	assert.Equal(t, "▁▁▁", Sparkline([]float64{5, 5, 5}))
+	assert.Equal(t, "▁▄█▁", Sparkline([]float64{0, 50, 100, 0}))
+	assert.Equal(t, "▁▂▃▄▅▆▇█", Sparkline([]float64{1, 2, 3, 4, 5, 6, 7, 8}))
+}
+
+func TestDashboardRender(t *testing.T) {
+	t.Parallel()
+	d := Dashboard{
+		Elapsed:    10*time.Second + 300*time.Millisecond,
+		ActiveVUs:  3,
+		MaxVUs:     5,
+		Iterations: 50,
+		Trends: []DashboardTrend{
+			{Metric: "http_req_duration", Percentile: "p(95)", History: []float64{1, 2, 3, 4}, Value: "4ms"},
+		},
+		ErrorRates: []DashboardRate{{Name: "failed requests", Rate: 0.025, Total: 200}},
+		Thresholds: []DashboardThreshold{
+			{Metric: "http_req_duration", Source: "p(95)<500"},
+			{Metric: "checks", Source: "rate>0.99", Failed: true},
+		},
+	}
+
+	t.Run("full", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, []string{
+			"  elapsed: 10s   VUs: 3/5   iterations: 50 (4.85/s)",
+			"",
+			"  trends",
+			"    http_req_duration p(95) ▁▃▅█ 4ms",
+			"",
+			"  errors",
+			"    failed requests: 2.50% of 200",
+			"",
+			"  thresholds",
+			"    ✓ http_req_duration p(95)<500",
+			"    ✗ checks rate>0.99",
+		}, d.Render(80, true))
+	})
+
+	t.Run("narrow", func(t *testing.T) {
+		t.Parallel()
+		lines := d.Render(34, true)
+		for _, line := range lines {
+			assert.True(t, len([]rune(line)) <= 34, line)
+		}
+		assert.Equal(t, "  elapsed: 10s   VUs: 3/5   iterat", lines[0])
+		// The oldest values of the trends are dropped first
+		assert.Equal(t, "    http_req_duration p(95) ▁█ 4ms", lines[3])
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		t.Parallel()
+		assert.Equal(t, []string{
+			"  elapsed: 0s   VUs: 0/0   iterations: 0 (0.00/s)",
+		}, Dashboard{}.Render(80, true))
+	})
+}
@@ -31,6 +31,7 @@ import (
 	"golang.org/x/text/unicode/norm"
 
 	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/lib/slo"
 	"github.com/loadimpact/k6/stats"
 )
 
@@ -46,8 +47,9 @@ const (
 
 // Summary handles test summary output
 type Summary struct {
-	trendColumns        []string
-	trendValueResolvers map[string]func(s *stats.TrendSink) float64
+	trendColumns            []string
+	trendValueResolvers     map[string]func(s *stats.TrendSink) float64
+	histogramValueResolvers map[string]func(s *stats.HistogramSink) float64
 }
 
 // NewSummary returns a new Summary instance, used for writing a
@@ -56,9 +58,30 @@ func NewSummary(cols []string) *Summary {
 	s := Summary{trendColumns: cols}
 
 	s.trendValueResolvers, _ = stats.GetResolversForTrendColumns(cols)
+	s.histogramValueResolvers, _ = stats.GetResolversForHistogramColumns(cols)
 	return &s
 }
 
+// trendColumnResolver returns the trend columns for the trend and histogram
+// sinks and a function that calculates them, or nil for the other sinks. Trend
+// sinks with their own percentiles have them instead of the summary ones.
+func (s *Summary) trendColumnResolver(sink stats.Sink) ([]string, func(col string) float64) {
+	switch sink := sink.(type) {
+	case *stats.TrendSink:
+		return stats.TrendColumns(s.trendColumns, sink.Percentiles), func(col string) float64 {
+			if resolve, ok := s.trendValueResolvers[col]; ok {
+				return resolve(sink)
+			}
+			percentile, _ := stats.ParsePercentile(col)
+			return sink.P(percentile / 100)
+		}
+	case *stats.HistogramSink:
+		return s.trendColumns, func(col string) float64 { return s.histogramValueResolvers[col](sink) }
+	default:
+		return nil, nil
+	}
+}
+
 // StrWidth returns the actual width of the string.
 func StrWidth(s string) (n int) {
 	var it norm.Iter
@@ -192,7 +215,8 @@ func (s *Summary) summarizeMetrics(w io.Writer, indent string, t time.Duration,
 	extraMaxLens := make([]int, 2)
 
 	trendCols := make(map[string][]string)
-	trendColMaxLens := make([]int, len(s.trendColumns))
+	trendColNames := make(map[string][]string)
+	trendColMaxLens := make(map[string]int)
 
 	for name, m := range metrics {
 		names = append(names, name)
@@ -204,26 +228,25 @@ func (s *Summary) summarizeMetrics(w io.Writer, indent string, t time.Duration,
 		}
 
 		m.Sink.Calc()
-		if sink, ok := m.Sink.(*stats.TrendSink); ok {
-			cols := make([]string, len(s.trendColumns))
+		if colNames, resolve := s.trendColumnResolver(m.Sink); resolve != nil {
+			cols := make([]string, len(colNames))
 
-			for i, tc := range s.trendColumns {
+			for i, tc := range colNames {
 				var value string
 
-				resolver := s.trendValueResolvers[tc]
-
-				v := resolver(sink)
+				v := resolve(tc)
 				if tc != "count" { // sigh
 					value = m.HumanizeValue(v, timeUnit)
 				} else {
 					value = strconv.FormatInt(int64(v), 10)
 				}
-				if l := StrWidth(value); l > trendColMaxLens[i] {
-					trendColMaxLens[i] = l
+				if l := StrWidth(value); l > trendColMaxLens[tc] {
+					trendColMaxLens[tc] = l
 				}
 				cols[i] = value
 			}
 			trendCols[name] = cols
+			trendColNames[name] = colNames
 			continue
 		}
 
@@ -244,7 +267,6 @@ func (s *Summary) summarizeMetrics(w io.Writer, indent string, t time.Duration,
 
 	sort.Strings(names)
 
-	tmpCols := make([]string, len(s.trendColumns))
 	for _, name := range names {
 		m := metrics[name]
 
@@ -266,9 +288,11 @@ func (s *Summary) summarizeMetrics(w io.Writer, indent string, t time.Duration,
 
 		var fmtData string
 		if cols := trendCols[name]; cols != nil {
+			tmpCols := make([]string, len(cols))
 			for i, val := range cols {
-				tmpCols[i] = s.trendColumns[i] + "=" + ValueColor.Sprint(val) +
-					strings.Repeat(" ", trendColMaxLens[i]-StrWidth(val))
+				colName := trendColNames[name][i]
+				tmpCols[i] = colName + "=" + ValueColor.Sprint(val) +
+					strings.Repeat(" ", trendColMaxLens[colName]-StrWidth(val))
 			}
 			fmtData = strings.Join(tmpCols, " ")
 		} else {
@@ -298,6 +322,7 @@ type SummaryData struct {
 	RootGroup *lib.Group
 	Time      time.Duration
 	TimeUnit  string
+	SLOs      []slo.Result
 }
 
 // SummarizeMetrics creates a summary of provided metrics and writes it to w.
@@ -307,4 +332,52 @@ func (s *Summary) SummarizeMetrics(w io.Writer, indent string, data SummaryData)
 	}
 
 	s.summarizeMetrics(w, indent+"  ", data.Time, data.TimeUnit, data.Metrics)
+
+	if len(data.SLOs) > 0 {
+		summarizeSLOs(w, indent+"  ", data.TimeUnit, data.SLOs)
+	}
+}
+
+// summarizeSLOs writes the results of the service level objectives, in the
+// order they were defined, after the metrics.
+func summarizeSLOs(w io.Writer, indent string, timeUnit string, results []slo.Result) {
+	latency := &stats.Metric{Type: stats.Trend, Contains: stats.Time}
+
+	nameLenMax := 0
+	for _, result := range results {
+		if l := StrWidth(result.Name); l > nameLenMax {
+			nameLenMax = l
+		}
+	}
+
+	_, _ = fmt.Fprint(w, "\n"+indent+"  service level objectives\n\n")
+	for _, result := range results {
+		mark, markColor := succMark, SuccColor
+		switch {
+		case result.NoData:
+			mark, markColor = " ", StdColor
+		case !result.Met:
+			mark, markColor = failMark, FailColor
+		}
+
+		fmtName := result.Name + GrayColor.Sprint(strings.Repeat(".", nameLenMax-StrWidth(result.Name)+3)+":")
+
+		var fmtData string
+		switch {
+		case result.NoData:
+			fmtData = GrayColor.Sprint("no data")
+		case result.Kind == slo.KindLatency:
+			fmtData = ValueColor.Sprint(latency.HumanizeValue(result.Value, timeUnit))
+		default:
+			// Truncate like the rates, so that an objective isn't shown as met when it isn't
+			fmtData = ValueColor.Sprint(strconv.FormatFloat(float64(int(result.Value*100))/100, 'f', 2, 64) + "%")
+		}
+		fmtData += " " + ExtraColor.Sprint("objective: "+result.Objective)
+		if !result.NoData {
+			fmtData += " " + ExtraColor.Sprintf("error budget used: %s%%",
+				strconv.FormatFloat(result.ErrorBudgetUsed*100, 'f', 1, 64))
+		}
+
+		_, _ = fmt.Fprint(w, indent+markColor.Sprint(mark)+" "+fmtName+" "+fmtData+"\n")
+	}
 }
@@ -0,0 +1,89 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+//nolint:gochecknoglobals
+var (
+	ghDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	ghPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+// ghCommand writes a GitHub Actions workflow command, like ::error::, with a
+// title for the annotation it creates.
+func ghCommand(w io.Writer, command, title, message string) {
+	_, _ = fmt.Fprintf(w, "::%s title=%s::%s\n", command, ghPropertyEscaper.Replace(title), ghDataEscaper.Replace(message))
+}
+
+// SummarizeGitHubActions writes GitHub Actions workflow commands for the
+// thresholds and checks of the test to w, so that failures are shown as
+// annotations of the workflow run and in the checks of pull requests.
+func (s *Summary) SummarizeGitHubActions(w io.Writer, data SummaryData) {
+	names := make([]string, 0, len(data.Metrics))
+	for name := range data.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var thresholds, failed int
+	for _, name := range names {
+		m := data.Metrics[name]
+		for _, th := range m.Thresholds.Thresholds {
+			thresholds++
+			if th.LastFailed {
+				failed++
+				ghCommand(w, "error", "Threshold crossed",
+					fmt.Sprintf("%s: %s (%s)", name, th.Source, s.metricValueForMarkdown(data, m)))
+			}
+		}
+	}
+
+	var passes, fails int64
+	if data.RootGroup != nil {
+		for _, c := range collectChecks(data.RootGroup, "", nil) {
+			passes += c.passes
+			fails += c.fails
+			if c.fails > 0 {
+				ghCommand(w, "warning", "Check failed",
+					fmt.Sprintf("%s: %d of %d failed", c.name, c.fails, c.passes+c.fails))
+			}
+		}
+	}
+
+	switch {
+	case thresholds == 0:
+	case failed == 0:
+		ghCommand(w, "notice", "Thresholds", fmt.Sprintf("All %d thresholds passed", thresholds))
+	default:
+		ghCommand(w, "notice", "Thresholds", fmt.Sprintf("%d of %d thresholds failed", failed, thresholds))
+	}
+	if total := passes + fails; total > 0 {
+		ghCommand(w, "notice", "Checks", fmt.Sprintf(
+			"%d of %d checks passed (%.2f%%)", passes, total, float64(passes)/float64(total)*100,
+		))
+	}
+}
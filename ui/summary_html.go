@@ -0,0 +1,236 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/loadimpact/k6/stats"
+)
+
+const (
+	htmlHistogramBins   = 30
+	htmlHistogramWidth  = 600
+	htmlHistogramHeight = 120
+)
+
+type htmlThreshold struct {
+	Metric, Source string
+	Failed         bool
+}
+
+type htmlCheck struct {
+	Name          string
+	Passes, Fails int64
+	Rate          float64
+}
+
+type htmlMetric struct {
+	Scenario, Name, Type, Value string
+	Thresholds                  []htmlThreshold
+}
+
+type htmlBar struct {
+	X, Y, Width, Height float64
+	Label               string
+}
+
+// htmlDistribution is a histogram of the values of a trend metric.
+type htmlDistribution struct {
+	Metric   string
+	Count    uint64
+	Min, Max string
+	Bars     []htmlBar
+}
+
+type htmlReport struct {
+	Duration         string
+	Thresholds       []htmlThreshold
+	FailedThresholds int
+	Checks           []htmlCheck
+	Metrics          []htmlMetric
+	ScenarioMetrics  []htmlMetric
+	Distributions    []htmlDistribution
+}
+
+// newHTMLDistribution returns the histogram of the values of the trend, up to
+// its p(99), with the slowest 1% in the last bar, so that a few outliers don't
+// squash all of the other bars into one.
+func newHTMLDistribution(name string, m *stats.Metric, sink *stats.TrendSink, timeUnit string) htmlDistribution {
+	sink.Calc()
+	low, high := sink.Min, sink.P(0.99)
+	if high <= low {
+		high = sink.Max
+	}
+	d := htmlDistribution{
+		Metric: name,
+		Count:  sink.Count,
+		Min:    m.HumanizeValue(low, timeUnit),
+		Max:    m.HumanizeValue(high, timeUnit),
+	}
+
+	counts := make([]int, htmlHistogramBins)
+	binWidth := (high - low) / htmlHistogramBins
+	maxCount := 0
+	for _, v := range sink.Values {
+		bin := htmlHistogramBins - 1
+		if binWidth > 0 && v < high {
+			bin = int((v - low) / binWidth)
+		}
+		counts[bin]++
+		if counts[bin] > maxCount {
+			maxCount = counts[bin]
+		}
+	}
+	barWidth := float64(htmlHistogramWidth) / htmlHistogramBins
+	for i, c := range counts {
+		h := math.Round(float64(c) / float64(maxCount) * htmlHistogramHeight)
+		from := low + float64(i)*binWidth
+		label := fmt.Sprintf("%s – %s: %d", m.HumanizeValue(from, timeUnit), m.HumanizeValue(from+binWidth, timeUnit), c)
+		if i == htmlHistogramBins-1 {
+			label = fmt.Sprintf("≥ %s: %d", m.HumanizeValue(from, timeUnit), c)
+		}
+		d.Bars = append(d.Bars, htmlBar{
+			X: float64(i) * barWidth, Y: htmlHistogramHeight - h, Width: barWidth - 1, Height: h, Label: label,
+		})
+	}
+	return d
+}
+
+// SummarizeMetricsHTML writes the summary of the test to w as a standalone
+// HTML report, with the thresholds, the checks, the metrics, their per-scenario
+// submetrics and charts of the distributions of the time trends.
+func (s *Summary) SummarizeMetricsHTML(w io.Writer, data SummaryData) error {
+	report := htmlReport{Duration: data.Time.Round(time.Millisecond).String()}
+
+	names := make([]string, 0, len(data.Metrics))
+	for name := range data.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := data.Metrics[name]
+		metric := htmlMetric{Name: name, Type: m.Type.String(), Value: s.metricValueForMarkdown(data, m)}
+		for _, th := range m.Thresholds.Thresholds {
+			threshold := htmlThreshold{Metric: name, Source: th.Source, Failed: th.LastFailed}
+			metric.Thresholds = append(metric.Thresholds, threshold)
+			report.Thresholds = append(report.Thresholds, threshold)
+			if th.LastFailed {
+				report.FailedThresholds++
+			}
+		}
+
+		if m.Sub.Parent != "" {
+			if scenario, ok := m.Sub.Tags.Get("scenario"); ok {
+				metric.Scenario = scenario
+				report.ScenarioMetrics = append(report.ScenarioMetrics, metric)
+			}
+			continue
+		}
+		report.Metrics = append(report.Metrics, metric)
+
+		if sink, ok := m.Sink.(*stats.TrendSink); ok && m.Contains == stats.Time && sink.Count > 0 {
+			report.Distributions = append(report.Distributions, newHTMLDistribution(name, m, sink, data.TimeUnit))
+		}
+	}
+
+	if data.RootGroup != nil {
+		for _, c := range collectChecks(data.RootGroup, "", nil) {
+			check := htmlCheck{Name: c.name, Passes: c.passes, Fails: c.fails}
+			if total := c.passes + c.fails; total > 0 {
+				check.Rate = 100 * float64(c.passes) / float64(total)
+			}
+			report.Checks = append(report.Checks, check)
+		}
+	}
+
+	return htmlSummaryTemplate.Execute(w, report)
+}
+
+//nolint:gochecknoglobals
+var htmlSummaryTemplate = template.Must(template.New("summary").Funcs(template.FuncMap{
+	"pct": func(v float64) string { return fmt.Sprintf("%.2f%%", v) },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>k6 test summary</title>
+<style>
+body { font-family: sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin: 1em 0; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.7em; text-align: left; }
+td.num { text-align: right; }
+.pass { color: #1a7f37; }
+.fail { color: #cf222e; }
+tr.fail td { background: #f9d0d0; }
+rect { fill: #7d64ff; }
+section { page-break-inside: avoid; }
+@media print { body { margin: 0; } }
+</style>
+</head>
+<body>
+<h1>k6 test summary</h1>
+<p>{{if not .Thresholds}}No thresholds were defined.{{else if .FailedThresholds}}<strong class="fail">✗ {{.FailedThresholds}} of {{len .Thresholds}} thresholds failed.</strong>{{else}}<strong class="pass">✓ All {{len .Thresholds}} thresholds passed.</strong>{{end}}
+The test ran for {{.Duration}}.</p>
+{{if .Thresholds}}
+<h2>Thresholds</h2>
+<table>
+<tr><th></th><th>Metric</th><th>Threshold</th></tr>
+{{range .Thresholds}}<tr{{if .Failed}} class="fail"{{end}}><td>{{if .Failed}}<span class="fail">✗</span>{{else}}<span class="pass">✓</span>{{end}}</td><td>{{.Metric}}</td><td><code>{{.Source}}</code></td></tr>
+{{end}}</table>
+{{end}}{{if .Checks}}
+<h2>Checks</h2>
+<table>
+<tr><th></th><th>Check</th><th>Passes</th><th>Fails</th><th>Success rate</th></tr>
+{{range .Checks}}<tr{{if .Fails}} class="fail"{{end}}><td>{{if .Fails}}<span class="fail">✗</span>{{else}}<span class="pass">✓</span>{{end}}</td><td>{{.Name}}</td><td class="num">{{.Passes}}</td><td class="num">{{.Fails}}</td><td class="num">{{pct .Rate}}</td></tr>
+{{end}}</table>
+{{end}}
+<h2>Metrics</h2>
+<table>
+<tr><th>Metric</th><th>Type</th><th>Value</th></tr>
+{{range .Metrics}}<tr><td>{{.Name}}</td><td>{{.Type}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{if .ScenarioMetrics}}
+<h2>Scenarios</h2>
+<table>
+<tr><th>Scenario</th><th>Metric</th><th>Value</th></tr>
+{{range .ScenarioMetrics}}<tr><td>{{.Scenario}}</td><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{end}}{{if .Distributions}}
+<h2>Latency distribution</h2>
+{{range .Distributions}}<section>
+<h3>{{.Metric}} <small>({{.Count}} values)</small></h3>
+<svg width="600" height="140" viewBox="0 0 600 140">
+{{range .Bars}}<rect x="{{.X}}" y="{{.Y}}" width="{{.Width}}" height="{{.Height}}"><title>{{.Label}}</title></rect>
+{{end}}<text x="0" y="135" font-size="11">{{.Min}}</text>
+<text x="600" y="135" font-size="11" text-anchor="end">{{.Max}}</text>
+</svg>
+</section>
+{{end}}{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,128 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+)
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Time      string          `xml:"time,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+func (ts *junitTestSuite) add(tc junitTestCase) {
+	ts.Tests++
+	if tc.Failure != nil {
+		ts.Failures++
+	}
+	ts.TestCases = append(ts.TestCases, tc)
+}
+
+// SummarizeJUnit writes the thresholds and checks of the test to w as JUnit
+// XML, with a test case for each threshold and check that fails if the
+// threshold was crossed or if any of the check's assertions failed.
+func (s *Summary) SummarizeJUnit(w io.Writer, data SummaryData) error {
+	duration := fmt.Sprintf("%.3f", data.Time.Seconds())
+	thresholds := junitTestSuite{Name: "thresholds", Time: duration}
+	checks := junitTestSuite{Name: "checks", Time: duration}
+
+	names := make([]string, 0, len(data.Metrics))
+	for name := range data.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		m := data.Metrics[name]
+		for _, th := range m.Thresholds.Thresholds {
+			tc := junitTestCase{Name: name + ": " + th.Source, ClassName: "k6.thresholds." + name}
+			if th.LastFailed {
+				value := s.metricValueForMarkdown(data, m)
+				tc.Failure = &junitFailure{
+					Message: fmt.Sprintf("threshold %s crossed (%s)", th.Source, value),
+					Type:    "threshold",
+					Text:    fmt.Sprintf("%s: %s\n%s\n", name, th.Source, value),
+				}
+			}
+			thresholds.add(tc)
+		}
+	}
+
+	if data.RootGroup != nil {
+		for _, c := range collectChecks(data.RootGroup, "", nil) {
+			tc := junitTestCase{Name: c.name, ClassName: "k6.checks"}
+			if c.fails > 0 {
+				tc.Failure = &junitFailure{
+					Message: fmt.Sprintf("%d of %d failed", c.fails, c.passes+c.fails),
+					Type:    "check",
+					Text:    fmt.Sprintf("%s: %d passes, %d fails\n", c.name, c.passes, c.fails),
+				}
+			}
+			checks.add(tc)
+		}
+	}
+
+	report := junitTestSuites{
+		Name:     "k6",
+		Tests:    thresholds.Tests + checks.Tests,
+		Failures: thresholds.Failures + checks.Failures,
+		Time:     duration,
+		Suites:   []junitTestSuite{thresholds, checks},
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
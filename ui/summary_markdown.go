@@ -0,0 +1,178 @@
+/*
+ *
+ * k6 - a next-generation load testing tool
+ * Copyright (C) 2021 Load Impact
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <http://www.gnu.org/licenses/>.
+ *
+ */
+
+package ui
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/loadimpact/k6/lib"
+	"github.com/loadimpact/k6/stats"
+)
+
+const (
+	mdPassBadge = "✅"
+	mdFailBadge = "❌"
+)
+
+// mdEscape escapes the characters that would break a Markdown table cell.
+func mdEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+func mdRow(w io.Writer, cells ...string) {
+	_, _ = fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+}
+
+func mdTableHeader(w io.Writer, cells ...string) {
+	mdRow(w, cells...)
+	sep := make([]string, len(cells))
+	for i := range sep {
+		sep[i] = "---"
+	}
+	mdRow(w, sep...)
+}
+
+type mdCheck struct {
+	name          string
+	passes, fails int64
+}
+
+func collectChecks(group *lib.Group, prefix string, checks []mdCheck) []mdCheck {
+	for _, check := range group.OrderedChecks {
+		checks = append(checks, mdCheck{name: prefix + check.Name, passes: check.Passes, fails: check.Fails})
+	}
+	for _, sub := range group.OrderedGroups {
+		checks = collectChecks(sub, prefix+sub.Name+" › ", checks)
+	}
+	return checks
+}
+
+// metricValueForMarkdown returns the value of the metric in a single table
+// cell, with the trend columns of the summary or the extra values of the
+// other metric types.
+func (s *Summary) metricValueForMarkdown(data SummaryData, m *stats.Metric) string {
+	m.Sink.Calc()
+	if colNames, resolve := s.trendColumnResolver(m.Sink); resolve != nil {
+		cols := make([]string, len(colNames))
+		for i, tc := range colNames {
+			v := resolve(tc)
+			if tc == "count" {
+				cols[i] = tc + "=" + strconv.FormatInt(int64(v), 10)
+			} else {
+				cols[i] = tc + "=" + m.HumanizeValue(v, data.TimeUnit)
+			}
+		}
+		return strings.Join(cols, " ")
+	}
+
+	value, extra := nonTrendMetricValueForSum(data.Time, data.TimeUnit, m)
+	if len(extra) == 0 {
+		return value
+	}
+	return value + " (" + strings.Join(extra, " ") + ")"
+}
+
+// SummarizeMetricsMarkdown writes a compact GitHub-flavored Markdown summary
+// of the test to w, meant to be posted as a pull request comment by CI.
+//nolint:funlen
+func (s *Summary) SummarizeMetricsMarkdown(w io.Writer, data SummaryData) {
+	names := make([]string, 0, len(data.Metrics))
+	for name := range data.Metrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var thresholds, failed int
+	for _, name := range names {
+		for _, th := range data.Metrics[name].Thresholds.Thresholds {
+			thresholds++
+			if th.LastFailed {
+				failed++
+			}
+		}
+	}
+
+	switch {
+	case thresholds == 0:
+		_, _ = fmt.Fprintf(w, "### k6 test summary\n\n")
+	case failed == 0:
+		_, _ = fmt.Fprintf(w, "### %s k6: all %d thresholds passed\n\n", mdPassBadge, thresholds)
+	default:
+		_, _ = fmt.Fprintf(w, "### %s k6: %d of %d thresholds failed\n\n", mdFailBadge, failed, thresholds)
+	}
+	_, _ = fmt.Fprintf(w, "Test run duration: %s\n\n", data.Time.Round(time.Millisecond))
+
+	if thresholds > 0 {
+		mdTableHeader(w, "", "Metric", "Threshold")
+		for _, name := range names {
+			for _, th := range data.Metrics[name].Thresholds.Thresholds {
+				badge := mdPassBadge
+				if th.LastFailed {
+					badge = mdFailBadge
+				}
+				mdRow(w, badge, mdEscape(name), "`"+mdEscape(th.Source)+"`")
+			}
+		}
+		_, _ = fmt.Fprintln(w)
+	}
+
+	if data.RootGroup != nil {
+		if checks := collectChecks(data.RootGroup, "", nil); len(checks) > 0 {
+			mdTableHeader(w, "", "Check", "Passes", "Fails")
+			for _, c := range checks {
+				badge := mdPassBadge
+				if c.fails > 0 {
+					badge = mdFailBadge
+				}
+				mdRow(w, badge, mdEscape(c.name), strconv.FormatInt(c.passes, 10), strconv.FormatInt(c.fails, 10))
+			}
+			_, _ = fmt.Fprintln(w)
+		}
+	}
+
+	mdTableHeader(w, "Metric", "Value")
+	var scenarioMetrics []string
+	for _, name := range names {
+		m := data.Metrics[name]
+		if m.Sub.Parent != "" {
+			if _, ok := m.Sub.Tags.Get("scenario"); ok {
+				scenarioMetrics = append(scenarioMetrics, name)
+			}
+			continue
+		}
+		mdRow(w, mdEscape(name), mdEscape(s.metricValueForMarkdown(data, m)))
+	}
+
+	if len(scenarioMetrics) > 0 {
+		_, _ = fmt.Fprintln(w)
+		mdTableHeader(w, "Scenario", "Metric", "Value")
+		for _, name := range scenarioMetrics {
+			m := data.Metrics[name]
+			scenario, _ := m.Sub.Tags.Get("scenario")
+			mdRow(w, mdEscape(scenario), mdEscape(name), mdEscape(s.metricValueForMarkdown(data, m)))
+		}
+	}
+}